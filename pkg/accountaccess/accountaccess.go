@@ -0,0 +1,102 @@
+// Package accountaccess checks, before a query runs, that the API key can access
+// the account the query targets. NRDB reports queries to inaccessible accounts
+// as generic authorization failures; checking the key's accessible accounts
+// first lets the plugin name the account instead.
+package accountaccess
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// TTL is how long the accounts an API key can access are cached. Access granted
+// in the meantime is picked up once the entry expires.
+const TTL = 5 * time.Minute
+
+// ListerFunc returns the account lister for the API key used for queries to
+// accountID, with the API key itself, which identifies the cached accounts.
+type ListerFunc func(ctx context.Context, accountID int) (metadata.AccountLister, string, error)
+
+// Executor wraps an NRDBQueryExecutor and rejects queries to accounts the API key
+// cannot access. Queries to DefaultAccountID are not checked, as the health check
+// covers the default account. If the accessible accounts cannot be looked up,
+// the query runs anyway and NRDB reports any access problem itself.
+type Executor struct {
+	Executor         nrdbiface.NRDBQueryExecutor
+	Cache            *cache.Cache // Accessible accounts by API key
+	Listers          ListerFunc
+	DefaultAccountID int
+}
+
+// QueryWithContext executes a standard NRQL query if the API key can access accountID.
+func (e *Executor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	if err := e.check(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return e.Executor.QueryWithContext(ctx, accountID, query)
+}
+
+// PerformNRQLQueryWithContext executes an enhanced NRQL query if the API key can access accountID.
+func (e *Executor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	if err := e.check(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return e.Executor.PerformNRQLQueryWithContext(ctx, accountID, query)
+}
+
+// check returns an error naming accountID if the API key cannot access it.
+func (e *Executor) check(ctx context.Context, accountID int) error {
+	if accountID == e.DefaultAccountID {
+		return nil
+	}
+	accessible, err := e.accessible(ctx, accountID)
+	if err != nil {
+		log.DefaultLogger.Warn("Could not look up the accounts the API key can access", "accountID", accountID, "error", err)
+		return nil
+	}
+	if !accessible[accountID] {
+		return &errorsx.Error{Kind: errorsx.KindForbidden, Msg: fmt.Sprintf("API key has no access to account %d", accountID)}
+	}
+	return nil
+}
+
+// accessible returns the IDs of the accounts the API key for accountID can
+// access, from the cache if it has them.
+func (e *Executor) accessible(ctx context.Context, accountID int) (map[int]bool, error) {
+	lister, apiKey, err := e.Listers(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	// The cache is keyed by a digest so it does not hold API keys
+	digest := sha256.Sum256([]byte(apiKey))
+	key := "accounts:" + hex.EncodeToString(digest[:])
+	if e.Cache != nil {
+		if cached, ok := e.Cache.Get(key); ok {
+			return cached.(map[int]bool), nil
+		}
+	}
+
+	accounts, err := metadata.Accounts(ctx, lister)
+	if err != nil {
+		return nil, err
+	}
+	accessible := make(map[int]bool, len(accounts))
+	for _, account := range accounts {
+		accessible[account.ID] = true
+	}
+	if e.Cache != nil {
+		e.Cache.Set(key, accessible, TTL)
+	}
+	return accessible, nil
+}
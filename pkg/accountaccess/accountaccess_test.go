@@ -0,0 +1,103 @@
+package accountaccess
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/metadata"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubLister lists the accounts in ids, counting the lookups.
+type stubLister struct {
+	ids   []int
+	err   error
+	calls int
+}
+
+func (l *stubLister) ListAccountsWithContext(ctx context.Context, params accounts.ListAccountsParams) ([]accounts.AccountOutline, error) {
+	l.calls++
+	if l.err != nil {
+		return nil, l.err
+	}
+	outlines := make([]accounts.AccountOutline, len(l.ids))
+	for i, id := range l.ids {
+		outlines[i] = accounts.AccountOutline{ID: id, Name: "account"}
+	}
+	return outlines, nil
+}
+
+// countingExecutor counts the queries it runs.
+type countingExecutor struct {
+	queries int
+}
+
+func (e *countingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.queries++
+	return &nrdb.NRDBResultContainer{}, nil
+}
+
+func (e *countingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	e.queries++
+	return &nrdb.NRDBResultContainerMultiResultCustomized{}, nil
+}
+
+func newExecutor(lister *stubLister, inner *countingExecutor) *Executor {
+	return &Executor{
+		Executor: inner,
+		Cache:    cache.New(),
+		Listers: func(ctx context.Context, accountID int) (metadata.AccountLister, string, error) {
+			return lister, "test-api-key", nil
+		},
+		DefaultAccountID: 123456,
+	}
+}
+
+func TestExecutor_RejectsInaccessibleAccount(t *testing.T) {
+	lister := &stubLister{ids: []int{123456, 222}}
+	inner := &countingExecutor{}
+	executor := newExecutor(lister, inner)
+
+	_, err := executor.QueryWithContext(context.Background(), 999999, "SELECT count(*) FROM Transaction")
+	require.Error(t, err)
+	assert.Equal(t, "API key has no access to account 999999", err.Error())
+	assert.Equal(t, errorsx.KindForbidden, errorsx.Translate(err).Kind)
+	assert.Zero(t, inner.queries, "the query is not sent")
+
+	_, err = executor.PerformNRQLQueryWithContext(context.Background(), 222, "SELECT count(*) FROM Transaction FACET name TIMESERIES")
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.queries)
+	assert.Equal(t, 1, lister.calls, "the accessible accounts are cached")
+}
+
+func TestExecutor_DefaultAccountNotChecked(t *testing.T) {
+	lister := &stubLister{}
+	inner := &countingExecutor{}
+
+	_, err := newExecutor(lister, inner).QueryWithContext(context.Background(), 123456, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	assert.Zero(t, lister.calls)
+	assert.Equal(t, 1, inner.queries)
+}
+
+func TestExecutor_LookupFailureRunsQuery(t *testing.T) {
+	lister := &stubLister{err: errors.New("NerdGraph unavailable")}
+	inner := &countingExecutor{}
+	executor := newExecutor(lister, inner)
+
+	_, err := executor.QueryWithContext(context.Background(), 999999, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.queries)
+
+	// Failed lookups are not cached
+	_, err = executor.QueryWithContext(context.Background(), 999999, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	assert.Equal(t, 2, lister.calls)
+}
@@ -0,0 +1,230 @@
+// Package audit records the NRQL queries the plugin executes, so admins can see
+// which dashboards generate expensive queries. Every query is written to the
+// plugin log, and the most recent ones are kept in memory for the query-stats
+// resource.
+package audit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// DefaultBufferSize is how many recent queries are kept when the settings do not say.
+const DefaultBufferSize = 200
+
+// Entry is a single executed NRQL query.
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Query         string    `json:"query"`
+	AccountID     int       `json:"accountId"`
+	DatasourceUID string    `json:"datasourceUid"`
+	DashboardUID  string    `json:"dashboardUid,omitempty"`
+	PanelID       string    `json:"panelId,omitempty"`
+	DurationMs    int64     `json:"durationMs"`
+	Rows          int       `json:"rows"`
+	ErrorCategory string    `json:"errorCategory,omitempty"` // errorsx kind of a failed query
+}
+
+// DashboardStats summarizes the recent queries of one dashboard.
+type DashboardStats struct {
+	DashboardUID    string `json:"dashboardUid"`
+	Queries         int    `json:"queries"`
+	Errors          int    `json:"errors"`
+	Rows            int    `json:"rows"`
+	TotalDurationMs int64  `json:"totalDurationMs"`
+	MaxDurationMs   int64  `json:"maxDurationMs"`
+}
+
+// Stats is the body of the query-stats resource.
+type Stats struct {
+	Queries    []Entry          `json:"queries"`    // Most recent first
+	Dashboards []DashboardStats `json:"dashboards"` // Highest total duration first
+}
+
+// Log writes executed queries to the plugin log and keeps the most recent ones
+// in a ring buffer. It is safe for concurrent use.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// NewLog creates an audit log keeping the bufferSize most recent queries. A
+// bufferSize of zero uses DefaultBufferSize; a negative one keeps none.
+func NewLog(bufferSize int) *Log {
+	if bufferSize == 0 {
+		bufferSize = DefaultBufferSize
+	}
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	return &Log{entries: make([]Entry, bufferSize)}
+}
+
+// FromSettings creates the audit log configured by the settings, or returns nil
+// when audit logging is disabled.
+func FromSettings(settings *models.PluginSettings) *Log {
+	if settings.AuditLog == nil || !settings.AuditLog.Enabled {
+		return nil
+	}
+	return NewLog(settings.AuditLog.BufferSize)
+}
+
+// Record logs entry and adds it to the buffer.
+func (l *Log) Record(entry Entry) {
+	log.DefaultLogger.Info("NRQL query executed",
+		"query", entry.Query,
+		"accountID", entry.AccountID,
+		"datasourceUID", entry.DatasourceUID,
+		"dashboardUID", entry.DashboardUID,
+		"panelID", entry.PanelID,
+		"durationMs", entry.DurationMs,
+		"rows", entry.Rows,
+		"errorCategory", entry.ErrorCategory,
+	)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == 0 {
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the buffered queries, most recent first.
+func (l *Log) Recent() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+	recent := make([]Entry, 0, count)
+	for i := 1; i <= count; i++ {
+		recent = append(recent, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return recent
+}
+
+// Stats returns the buffered queries and their totals by dashboard. Queries not
+// made from a dashboard, e.g. in Explore, are totalled under an empty UID.
+func (l *Log) Stats() Stats {
+	recent := l.Recent()
+	byDashboard := make(map[string]*DashboardStats)
+	for _, entry := range recent {
+		stats, ok := byDashboard[entry.DashboardUID]
+		if !ok {
+			stats = &DashboardStats{DashboardUID: entry.DashboardUID}
+			byDashboard[entry.DashboardUID] = stats
+		}
+		stats.Queries++
+		stats.Rows += entry.Rows
+		stats.TotalDurationMs += entry.DurationMs
+		if entry.DurationMs > stats.MaxDurationMs {
+			stats.MaxDurationMs = entry.DurationMs
+		}
+		if entry.ErrorCategory != "" {
+			stats.Errors++
+		}
+	}
+
+	dashboards := make([]DashboardStats, 0, len(byDashboard))
+	for _, stats := range byDashboard {
+		dashboards = append(dashboards, *stats)
+	}
+	sort.Slice(dashboards, func(i, j int) bool {
+		if dashboards[i].TotalDurationMs != dashboards[j].TotalDurationMs {
+			return dashboards[i].TotalDurationMs > dashboards[j].TotalDurationMs
+		}
+		return dashboards[i].DashboardUID < dashboards[j].DashboardUID
+	})
+	return Stats{Queries: recent, Dashboards: dashboards}
+}
+
+// Source identifies where queries come from.
+type Source struct {
+	DatasourceUID string
+	DashboardUID  string
+	PanelID       string
+}
+
+// sourceKey is the context key carrying a Source.
+type sourceKey struct{}
+
+// WithSource returns a context whose queries are recorded as made from source.
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// Executor wraps an NRDBQueryExecutor and records every query it executes.
+type Executor struct {
+	Executor nrdbiface.NRDBQueryExecutor
+	Log      *Log
+	now      func() time.Time // Replaced in tests
+}
+
+// QueryWithContext executes a standard NRQL query and records it.
+func (e *Executor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	start := e.clock()
+	result, err := e.Executor.QueryWithContext(ctx, accountID, query)
+	rows := 0
+	if result != nil {
+		rows = len(result.Results)
+	}
+	e.record(ctx, start, accountID, query, rows, err)
+	return result, err
+}
+
+// PerformNRQLQueryWithContext executes an enhanced NRQL query and records it.
+func (e *Executor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	start := e.clock()
+	result, err := e.Executor.PerformNRQLQueryWithContext(ctx, accountID, query)
+	rows := 0
+	if result != nil {
+		rows = len(result.Results)
+	}
+	e.record(ctx, start, accountID, query, rows, err)
+	return result, err
+}
+
+// record adds a query that started at start to the log.
+func (e *Executor) record(ctx context.Context, start time.Time, accountID int, query nrdb.NRQL, rows int, err error) {
+	source, _ := ctx.Value(sourceKey{}).(Source)
+	entry := Entry{
+		Time:          start,
+		Query:         string(query),
+		AccountID:     accountID,
+		DatasourceUID: source.DatasourceUID,
+		DashboardUID:  source.DashboardUID,
+		PanelID:       source.PanelID,
+		DurationMs:    e.clock().Sub(start).Milliseconds(),
+		Rows:          rows,
+	}
+	if err != nil {
+		entry.ErrorCategory = string(errorsx.Classify(err))
+	}
+	e.Log.Record(entry)
+}
+
+// clock returns the current time.
+func (e *Executor) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	nrerrors "github.com/newrelic/newrelic-client-go/v2/pkg/errors"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubExecutor returns results, or err for queries in failing.
+type stubExecutor struct {
+	results *nrdb.NRDBResultContainer
+	failing map[nrdb.NRQL]error
+}
+
+func (s *stubExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	if err := s.failing[query]; err != nil {
+		return nil, err
+	}
+	return s.results, nil
+}
+
+func (s *stubExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	if err := s.failing[query]; err != nil {
+		return nil, err
+	}
+	return &nrdb.NRDBResultContainerMultiResultCustomized{Results: s.results.Results}, nil
+}
+
+func TestExecutor(t *testing.T) {
+	stub := &stubExecutor{
+		results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": 1.0}, {"count": 2.0}}},
+		failing: map[nrdb.NRQL]error{"SELECT count(*) FROM Secret": nrerrors.NewUnauthorizedError()},
+	}
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	auditLog := NewLog(10)
+	executor := &Executor{Executor: stub, Log: auditLog, now: func() time.Time {
+		clock = clock.Add(250 * time.Millisecond)
+		return clock
+	}}
+
+	ctx := WithSource(context.Background(), Source{DatasourceUID: "ds-1", DashboardUID: "dash-1", PanelID: "4"})
+	_, err := executor.QueryWithContext(ctx, 123, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	_, err = executor.PerformNRQLQueryWithContext(context.Background(), 456, "SELECT count(*) FROM Secret")
+	require.Error(t, err)
+
+	assert.Equal(t, []Entry{
+		{
+			Time:          time.Date(2024, 5, 1, 12, 0, 0, 750_000_000, time.UTC),
+			Query:         "SELECT count(*) FROM Secret",
+			AccountID:     456,
+			DurationMs:    250,
+			ErrorCategory: "auth",
+		},
+		{
+			Time:          time.Date(2024, 5, 1, 12, 0, 0, 250_000_000, time.UTC),
+			Query:         "SELECT count(*) FROM Transaction",
+			AccountID:     123,
+			DatasourceUID: "ds-1",
+			DashboardUID:  "dash-1",
+			PanelID:       "4",
+			DurationMs:    250,
+			Rows:          2,
+		},
+	}, auditLog.Recent())
+}
+
+func TestLog(t *testing.T) {
+	t.Run("keeps the most recent entries", func(t *testing.T) {
+		auditLog := NewLog(3)
+		for i := 1; i <= 5; i++ {
+			auditLog.Record(Entry{AccountID: i})
+		}
+		var accounts []int
+		for _, entry := range auditLog.Recent() {
+			accounts = append(accounts, entry.AccountID)
+		}
+		assert.Equal(t, []int{5, 4, 3}, accounts)
+	})
+
+	t.Run("negative buffer size keeps none", func(t *testing.T) {
+		auditLog := NewLog(-1)
+		auditLog.Record(Entry{AccountID: 1})
+		assert.Empty(t, auditLog.Recent())
+	})
+
+	t.Run("stats by dashboard", func(t *testing.T) {
+		auditLog := NewLog(0)
+		auditLog.Record(Entry{DashboardUID: "cheap", DurationMs: 10, Rows: 1})
+		auditLog.Record(Entry{DashboardUID: "expensive", DurationMs: 900, Rows: 1000})
+		auditLog.Record(Entry{DashboardUID: "expensive", DurationMs: 300, ErrorCategory: "timeout"})
+		auditLog.Record(Entry{DurationMs: 50})
+
+		stats := auditLog.Stats()
+		assert.Len(t, stats.Queries, 4)
+		assert.Equal(t, []DashboardStats{
+			{DashboardUID: "expensive", Queries: 2, Errors: 1, Rows: 1000, TotalDurationMs: 1200, MaxDurationMs: 900},
+			{DashboardUID: "", Queries: 1, TotalDurationMs: 50, MaxDurationMs: 50},
+			{DashboardUID: "cheap", Queries: 1, Rows: 1, TotalDurationMs: 10, MaxDurationMs: 10},
+		}, stats.Dashboards)
+	})
+}
+
+func TestFromSettings(t *testing.T) {
+	assert.Nil(t, FromSettings(&models.PluginSettings{}))
+	assert.Nil(t, FromSettings(&models.PluginSettings{AuditLog: &models.AuditLogSettings{BufferSize: 10}}))
+
+	auditLog := FromSettings(&models.PluginSettings{AuditLog: &models.AuditLogSettings{Enabled: true}})
+	require.NotNil(t, auditLog)
+	assert.Len(t, auditLog.entries, DefaultBufferSize)
+}
+
+func TestExecutor_RowsOfFailedQuery(t *testing.T) {
+	auditLog := NewLog(1)
+	executor := &Executor{Executor: &stubExecutor{failing: map[nrdb.NRQL]error{"SELECT": errors.New("boom")}}, Log: auditLog}
+	_, _ = executor.QueryWithContext(context.Background(), 1, "SELECT")
+	require.Len(t, auditLog.Recent(), 1)
+	assert.Equal(t, 0, auditLog.Recent()[0].Rows)
+	assert.NotEmpty(t, auditLog.Recent()[0].ErrorCategory)
+}
@@ -0,0 +1,89 @@
+// Package blackout implements per-datasource blackout windows. While a window
+// is active the plugin stops sending queries to New Relic and serves the last
+// cached results instead, e.g. during announced provider maintenance.
+package blackout
+
+import (
+	"fmt"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// ConfigError represents an invalid blackout window configuration.
+type ConfigError struct {
+	Msg string
+	Err error // Wrapped error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid blackout window: %s: %v", e.Msg, e.Err)
+	}
+	return fmt.Sprintf("invalid blackout window: %s", e.Msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Window is a parsed blackout window. Start is inclusive and End exclusive.
+type Window struct {
+	Start  time.Time
+	End    time.Time
+	Reason string
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// ParseWindows parses the configured blackout windows. Start and end times
+// must be RFC 3339 timestamps and each window must end after it starts.
+func ParseWindows(settings []models.BlackoutWindow) ([]Window, error) {
+	windows := make([]Window, 0, len(settings))
+	for i, s := range settings {
+		start, err := time.Parse(time.RFC3339, s.Start)
+		if err != nil {
+			return nil, &ConfigError{Msg: fmt.Sprintf("window %d: could not parse start '%s', expected RFC 3339", i, s.Start), Err: err}
+		}
+		end, err := time.Parse(time.RFC3339, s.End)
+		if err != nil {
+			return nil, &ConfigError{Msg: fmt.Sprintf("window %d: could not parse end '%s', expected RFC 3339", i, s.End), Err: err}
+		}
+		if !end.After(start) {
+			return nil, &ConfigError{Msg: fmt.Sprintf("window %d: end must be after start", i)}
+		}
+		windows = append(windows, Window{Start: start, End: end, Reason: s.Reason})
+	}
+	return windows, nil
+}
+
+// Active returns the window containing now. When windows overlap, the one
+// ending last is returned so callers report when querying actually resumes.
+func Active(windows []Window, now time.Time) (Window, bool) {
+	var active Window
+	found := false
+	for _, w := range windows {
+		if w.Contains(now) && (!found || w.End.After(active.End)) {
+			active = w
+			found = true
+		}
+	}
+	return active, found
+}
+
+// Describe returns a short user-facing description of the window.
+func (w Window) Describe() string {
+	text := fmt.Sprintf("New Relic querying is paused until %s", w.End.UTC().Format(time.RFC3339))
+	if w.Reason != "" {
+		text += fmt.Sprintf(" (%s)", w.Reason)
+	}
+	return text
+}
+
+// Notice returns the user-facing text shown on results served during the window.
+func (w Window) Notice() string {
+	return w.Describe() + "; showing cached results"
+}
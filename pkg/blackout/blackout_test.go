@@ -0,0 +1,88 @@
+package blackout
+
+import (
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []models.BlackoutWindow
+		wantLen  int
+		wantErr  string
+	}{
+		{name: "none", settings: nil, wantLen: 0},
+		{
+			name:     "valid",
+			settings: []models.BlackoutWindow{{Start: "2024-06-01T02:00:00Z", End: "2024-06-01T04:00:00Z", Reason: "NR maintenance"}},
+			wantLen:  1,
+		},
+		{
+			name:     "invalid start",
+			settings: []models.BlackoutWindow{{Start: "tonight", End: "2024-06-01T04:00:00Z"}},
+			wantErr:  "could not parse start 'tonight'",
+		},
+		{
+			name:     "invalid end",
+			settings: []models.BlackoutWindow{{Start: "2024-06-01T02:00:00Z", End: ""}},
+			wantErr:  "could not parse end",
+		},
+		{
+			name:     "end before start",
+			settings: []models.BlackoutWindow{{Start: "2024-06-01T04:00:00Z", End: "2024-06-01T02:00:00Z"}},
+			wantErr:  "window 0: end must be after start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := ParseWindows(tt.settings)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, windows, tt.wantLen)
+		})
+	}
+}
+
+func TestActive(t *testing.T) {
+	windows, err := ParseWindows([]models.BlackoutWindow{
+		{Start: "2024-06-01T02:00:00Z", End: "2024-06-01T04:00:00Z", Reason: "first"},
+		{Start: "2024-06-01T05:00:00+02:00", End: "2024-06-01T05:00:00Z", Reason: "overlapping"},
+	})
+	require.NoError(t, err)
+
+	_, active := Active(windows, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.False(t, active, "before any window")
+
+	window, active := Active(windows, time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC))
+	assert.True(t, active, "start is inclusive")
+	assert.Equal(t, "first", window.Reason)
+
+	window, active = Active(windows, time.Date(2024, 6, 1, 3, 30, 0, 0, time.UTC))
+	assert.True(t, active)
+	assert.Equal(t, "overlapping", window.Reason, "overlapping windows report the one ending last")
+
+	_, active = Active(windows, time.Date(2024, 6, 1, 5, 0, 0, 0, time.UTC))
+	assert.False(t, active, "end is exclusive")
+}
+
+func TestWindow_Notice(t *testing.T) {
+	window := Window{
+		Start:  time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC),
+		End:    time.Date(2024, 6, 1, 4, 0, 0, 0, time.UTC),
+		Reason: "NR maintenance",
+	}
+	assert.Equal(t, "New Relic querying is paused until 2024-06-01T04:00:00Z (NR maintenance); showing cached results", window.Notice())
+
+	window.Reason = ""
+	assert.Equal(t, "New Relic querying is paused until 2024-06-01T04:00:00Z", window.Describe())
+}
@@ -0,0 +1,193 @@
+// Package cache provides an in-memory, TTL-based store for NRDB query results
+// and an NRDBQueryExecutor wrapper that serves results from it. Entries are
+// written explicitly (for example by the warm-up scheduler) or, when a Policy
+// is configured, by the regular query path, which reads them. Expired entries stay available as stale results until
+// purged, so they can be served while the API must not be queried. A cache
+// holds at most a fixed number of entries, evicting the least recently used.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxEntries is the number of entries a cache created with New holds.
+const DefaultMaxEntries = 5000
+
+// entry is a single cached value with its expiry time.
+type entry struct {
+	value     interface{}
+	storedAt  time.Time
+	expiresAt time.Time
+	element   *list.Element // Position of the key in the cache's recency list
+}
+
+// Stats summarizes the cache contents and how often lookups found a fresh entry.
+type Stats struct {
+	Entries int    `json:"entries"` // Entries stored, including expired ones
+	Expired int    `json:"expired"` // Expired entries kept as stale results
+	Hits    uint64 `json:"hits"`    // Get calls that returned a fresh entry
+	Misses  uint64 `json:"misses"`  // Get calls that found no fresh entry
+}
+
+// Cache is a thread-safe in-memory key/value store with per-entry TTLs.
+type Cache struct {
+	mu         sync.RWMutex
+	entries    map[string]*entry
+	recency    *list.List // Keys, least recently used first
+	maxEntries int
+	now        func() time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// New creates an empty cache holding at most DefaultMaxEntries entries.
+func New() *Cache {
+	return NewWithLimit(DefaultMaxEntries)
+}
+
+// NewWithLimit creates an empty cache holding at most maxEntries entries. Storing
+// more evicts the least recently used entries. A non-positive limit means no limit.
+func NewWithLimit(maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[string]*entry),
+		recency:    list.New(),
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// Get returns the value stored under key if it exists and has not expired.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		c.recency.MoveToBack(e.element)
+	}
+	c.mu.Unlock()
+
+	if !ok || !c.now().Before(e.expiresAt) {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return e.value, true
+}
+
+// put stores an entry under key as the most recently used one, evicting the
+// least recently used entries over the limit. The caller holds the lock.
+func (c *Cache) put(key string, value interface{}, storedAt, expiresAt time.Time) {
+	if e, ok := c.entries[key]; ok {
+		e.value, e.storedAt, e.expiresAt = value, storedAt, expiresAt
+		c.recency.MoveToBack(e.element)
+		return
+	}
+	c.entries[key] = &entry{value: value, storedAt: storedAt, expiresAt: expiresAt, element: c.recency.PushBack(key)}
+	for c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		c.remove(c.recency.Front().Value.(string))
+	}
+}
+
+// remove deletes the entry under key. The caller holds the lock.
+func (c *Cache) remove(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.recency.Remove(e.element)
+		delete(c.entries, key)
+	}
+}
+
+// Set stores value under key for the given TTL. A non-positive TTL removes the key.
+func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= 0 {
+		c.remove(key)
+		return
+	}
+	now := c.now()
+	c.put(key, value, now, now.Add(ttl))
+}
+
+// Retain stores value under key as an already expired entry. Get does not return
+// it, but GetStale does. An existing unexpired entry is left untouched.
+func (c *Cache) Retain(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if e, ok := c.entries[key]; ok && now.Before(e.expiresAt) {
+		return
+	}
+	c.put(key, value, now, now)
+}
+
+// GetStale returns the value stored under key and when it was stored, even if
+// the entry has expired.
+func (c *Cache) GetStale(key string) (interface{}, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	c.recency.MoveToBack(e.element)
+	return e.value, e.storedAt, true
+}
+
+// Len returns the number of entries, including expired ones not yet purged.
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Stats returns the current cache statistics.
+func (c *Cache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	stats := Stats{
+		Entries: len(c.entries),
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+	for _, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			stats.Expired++
+		}
+	}
+	return stats
+}
+
+// Purge removes all expired entries.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			c.remove(key)
+		}
+	}
+}
+
+// PurgeStale removes the expired entries stored more than maxAge ago, keeping
+// recent ones available as stale results.
+func (c *Cache) PurgeStale(maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) && now.Sub(e.storedAt) > maxAge {
+			c.remove(key)
+		}
+	}
+}
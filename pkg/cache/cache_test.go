@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_GetSet(t *testing.T) {
+	c := New()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+
+	c.Set("key", "value", time.Minute)
+	value, ok := c.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "value", value)
+
+	// Expired entries are not returned
+	now = now.Add(time.Minute)
+	_, ok = c.Get("key")
+	assert.False(t, ok)
+}
+
+func TestCache_SetNonPositiveTTLRemovesKey(t *testing.T) {
+	c := New()
+	c.Set("key", "value", time.Minute)
+	c.Set("key", "value", 0)
+
+	_, ok := c.Get("key")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCache_Purge(t *testing.T) {
+	c := New()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Set("short", 1, time.Second)
+	c.Set("long", 2, time.Hour)
+	assert.Equal(t, 2, c.Len())
+
+	now = now.Add(time.Minute)
+	c.Purge()
+	assert.Equal(t, 1, c.Len())
+
+	_, ok := c.Get("long")
+	assert.True(t, ok)
+}
+
+func TestCache_RetainAndGetStale(t *testing.T) {
+	c := New()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Retain("key", "stale")
+	_, ok := c.Get("key")
+	assert.False(t, ok, "retained entries are not fresh")
+
+	value, storedAt, ok := c.GetStale("key")
+	assert.True(t, ok)
+	assert.Equal(t, "stale", value)
+	assert.Equal(t, now, storedAt)
+
+	// Retain does not overwrite a fresh entry
+	c.Set("key", "fresh", time.Minute)
+	c.Retain("key", "older")
+	value, ok = c.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "fresh", value)
+
+	// Expired entries remain available as stale results
+	now = now.Add(time.Hour)
+	value, _, ok = c.GetStale("key")
+	assert.True(t, ok)
+	assert.Equal(t, "fresh", value)
+
+	_, _, ok = c.GetStale("missing")
+	assert.False(t, ok)
+}
+
+func TestCache_Stats(t *testing.T) {
+	c := New()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Set("fresh", "value", time.Minute)
+	c.Retain("stale", "value")
+	c.Get("fresh")
+	c.Get("stale")
+	c.Get("missing")
+
+	assert.Equal(t, Stats{Entries: 2, Expired: 1, Hits: 1, Misses: 2}, c.Stats())
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	c := NewWithLimit(3)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Set("fresh", "value", time.Hour)
+	for i := 0; i < 100; i++ {
+		c.Retain(fmt.Sprintf("stale-%d", i), i)
+		// Entries in use are kept
+		_, ok := c.Get("fresh")
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 3, c.Len())
+
+	_, _, ok := c.GetStale("stale-0")
+	assert.False(t, ok, "least recently used entries are evicted")
+	value, _, ok := c.GetStale("stale-99")
+	assert.True(t, ok)
+	assert.Equal(t, 99, value)
+}
+
+func TestCache_PurgeStale(t *testing.T) {
+	c := New()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Retain("old", 1)
+	now = now.Add(2 * time.Hour)
+	c.Retain("recent", 2)
+	c.Set("fresh", 3, time.Minute)
+
+	c.PurgeStale(time.Hour)
+	assert.Equal(t, 2, c.Len())
+	_, _, ok := c.GetStale("old")
+	assert.False(t, ok)
+	_, _, ok = c.GetStale("recent")
+	assert.True(t, ok)
+}
@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/metrics"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// ErrNotCached is returned in stale-only mode when no result is cached for a query.
+var ErrNotCached = errors.New("no cached result available")
+
+// refreshKey is the context key carrying the TTL for a cache refresh.
+type refreshKey struct{}
+
+// staleOnlyKey is the context key marking stale-only execution.
+type staleOnlyKey struct{}
+
+// WithRefresh returns a context that makes CachingExecutor bypass cached results,
+// execute the query and store the fresh result for ttl.
+func WithRefresh(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, refreshKey{}, ttl)
+}
+
+// WithStaleOnly returns a context that makes CachingExecutor serve cached
+// results, including expired ones, without ever calling the wrapped executor.
+// Queries with no cached result fail with ErrNotCached.
+func WithStaleOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, staleOnlyKey{}, true)
+}
+
+// isStaleOnly reports whether ctx requests stale-only execution.
+func isStaleOnly(ctx context.Context) bool {
+	staleOnly, _ := ctx.Value(staleOnlyKey{}).(bool)
+	return staleOnly
+}
+
+// refreshTTL returns the refresh TTL carried by ctx, if any.
+func refreshTTL(ctx context.Context) (time.Duration, bool) {
+	ttl, ok := ctx.Value(refreshKey{}).(time.Duration)
+	return ttl, ok
+}
+
+// CachingExecutor wraps an NRDBQueryExecutor and serves results from a Cache.
+// Without a Policy, cache misses are executed against the wrapped executor and
+// only retained as stale results; fresh entries are written by queries executed
+// with a WithRefresh context. With a Policy, misses are stored for its TTL.
+// Every result is also retained as the stale result of its StaleBucket.
+type CachingExecutor struct {
+	Executor nrdbiface.NRDBQueryExecutor
+	Cache    *Cache
+	Policy   *Policy // Optional, caches regular query results for a short TTL
+}
+
+// Key builds the cache key for a query executed through the given executor method.
+func Key(method string, accountID int, query nrdb.NRQL) string {
+	return fmt.Sprintf("%s|%d|%s", method, accountID, query)
+}
+
+// key builds the cache key for a query, normalized by the policy if one is set.
+func (c *CachingExecutor) key(method string, accountID int, query nrdb.NRQL) string {
+	if c.Policy != nil {
+		query = c.Policy.Normalize(query)
+	}
+	return Key(method, accountID, query)
+}
+
+// staleKey builds the cache key of a query's stale results. The query's time
+// range is rounded down to StaleBucket, whatever the policy, so queries of a
+// relative time range, whose absolute range moves on every refresh, find the
+// last result of their bucket.
+func staleKey(method string, accountID int, query nrdb.NRQL) string {
+	return Key(method, accountID, stalePolicy.Normalize(query))
+}
+
+// store keeps a query result under key for ttl, if positive, and as the stale
+// result of the query's StaleBucket.
+func (c *CachingExecutor) store(method string, accountID int, query nrdb.NRQL, key string, result interface{}, ttl time.Duration) {
+	c.Cache.Retain(staleKey(method, accountID, query), result)
+	if ttl > 0 {
+		c.Cache.Set(key, result, ttl)
+	}
+}
+
+// policyTTL returns the TTL of the policy, or 0 without one.
+func (c *CachingExecutor) policyTTL() time.Duration {
+	if c.Policy == nil {
+		return 0
+	}
+	return c.Policy.TTL
+}
+
+// QueryWithContext executes a standard NRQL query, using the cache when possible.
+func (c *CachingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	const method = "standard"
+	key := c.key(method, accountID, query)
+	if ttl, refresh := refreshTTL(ctx); refresh {
+		result, err := c.Executor.QueryWithContext(ctx, accountID, query)
+		if err == nil {
+			c.store(method, accountID, query, key, result, ttl)
+		}
+		return result, err
+	}
+
+	if isStaleOnly(ctx) {
+		if cached, _, ok := c.Cache.GetStale(staleKey(method, accountID, query)); ok {
+			if result, ok := cached.(*nrdb.NRDBResultContainer); ok {
+				return result, nil
+			}
+		}
+		return nil, ErrNotCached
+	}
+
+	if cached, ok := c.Cache.Get(key); ok {
+		if result, ok := cached.(*nrdb.NRDBResultContainer); ok {
+			metrics.RecordCacheLookup(true)
+			return result, nil
+		}
+	}
+	metrics.RecordCacheLookup(false)
+	result, err := c.Executor.QueryWithContext(ctx, accountID, query)
+	if err == nil {
+		c.store(method, accountID, query, key, result, c.policyTTL())
+	}
+	return result, err
+}
+
+// PerformNRQLQueryWithContext executes an enhanced NRQL query, using the cache when possible.
+func (c *CachingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	const method = "multi"
+	key := c.key(method, accountID, query)
+	if ttl, refresh := refreshTTL(ctx); refresh {
+		result, err := c.Executor.PerformNRQLQueryWithContext(ctx, accountID, query)
+		if err == nil {
+			c.store(method, accountID, query, key, result, ttl)
+		}
+		return result, err
+	}
+
+	if isStaleOnly(ctx) {
+		if cached, _, ok := c.Cache.GetStale(staleKey(method, accountID, query)); ok {
+			if result, ok := cached.(*nrdb.NRDBResultContainerMultiResultCustomized); ok {
+				return result, nil
+			}
+		}
+		return nil, ErrNotCached
+	}
+
+	if cached, ok := c.Cache.Get(key); ok {
+		if result, ok := cached.(*nrdb.NRDBResultContainerMultiResultCustomized); ok {
+			metrics.RecordCacheLookup(true)
+			return result, nil
+		}
+	}
+	metrics.RecordCacheLookup(false)
+	result, err := c.Executor.PerformNRQLQueryWithContext(ctx, accountID, query)
+	if err == nil {
+		c.store(method, accountID, query, key, result, c.policyTTL())
+	}
+	return result, err
+}
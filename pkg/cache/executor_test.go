@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingExecutor counts calls and returns a fresh result container each time
+type countingExecutor struct {
+	standardCalls int
+	multiCalls    int
+	err           error
+}
+
+func (m *countingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	m.standardCalls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": float64(m.standardCalls)}}}, nil
+}
+
+func (m *countingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	m.multiCalls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &nrdb.NRDBResultContainerMultiResultCustomized{Results: []nrdb.NRDBResult{{"count": float64(m.multiCalls)}}}, nil
+}
+
+func TestCachingExecutor_QueryWithContext(t *testing.T) {
+	inner := &countingExecutor{}
+	executor := &CachingExecutor{Executor: inner, Cache: New()}
+	ctx := context.Background()
+	query := nrdb.NRQL("SELECT count(*) FROM Transaction")
+
+	// Misses are executed but not stored
+	_, err := executor.QueryWithContext(ctx, 1, query)
+	require.NoError(t, err)
+	_, err = executor.QueryWithContext(ctx, 1, query)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.standardCalls)
+
+	// A refresh stores the result
+	refreshed, err := executor.QueryWithContext(WithRefresh(ctx, time.Minute), 1, query)
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.standardCalls)
+
+	cached, err := executor.QueryWithContext(ctx, 1, query)
+	require.NoError(t, err)
+	assert.Same(t, refreshed, cached)
+	assert.Equal(t, 3, inner.standardCalls)
+
+	// Different accounts do not share entries
+	_, err = executor.QueryWithContext(ctx, 2, query)
+	require.NoError(t, err)
+	assert.Equal(t, 4, inner.standardCalls)
+}
+
+func TestCachingExecutor_PerformNRQLQueryWithContext(t *testing.T) {
+	inner := &countingExecutor{}
+	executor := &CachingExecutor{Executor: inner, Cache: New()}
+	ctx := context.Background()
+	query := nrdb.NRQL("SELECT count(*) FROM Transaction FACET appName TIMESERIES")
+
+	refreshed, err := executor.PerformNRQLQueryWithContext(WithRefresh(ctx, time.Minute), 1, query)
+	require.NoError(t, err)
+
+	cached, err := executor.PerformNRQLQueryWithContext(ctx, 1, query)
+	require.NoError(t, err)
+	assert.Same(t, refreshed, cached)
+	assert.Equal(t, 1, inner.multiCalls)
+
+	// The standard path does not read multi entries
+	_, err = executor.QueryWithContext(ctx, 1, query)
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.standardCalls)
+}
+
+func TestCachingExecutor_RefreshErrorNotStored(t *testing.T) {
+	inner := &countingExecutor{err: errors.New("API error")}
+	c := New()
+	executor := &CachingExecutor{Executor: inner, Cache: c}
+
+	_, err := executor.QueryWithContext(WithRefresh(context.Background(), time.Minute), 1, "SELECT 1")
+	assert.Error(t, err)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCachingExecutor_StaleOnly(t *testing.T) {
+	inner := &countingExecutor{}
+	executor := &CachingExecutor{Executor: inner, Cache: New()}
+	ctx := context.Background()
+	query := nrdb.NRQL("SELECT count(*) FROM Transaction")
+
+	// Without a cached result, stale-only execution fails without calling the API
+	_, err := executor.QueryWithContext(WithStaleOnly(ctx), 1, query)
+	assert.ErrorIs(t, err, ErrNotCached)
+	_, err = executor.PerformNRQLQueryWithContext(WithStaleOnly(ctx), 1, query)
+	assert.ErrorIs(t, err, ErrNotCached)
+	assert.Equal(t, 0, inner.standardCalls+inner.multiCalls)
+
+	// A regular miss is retained and served in stale-only mode
+	live, err := executor.QueryWithContext(ctx, 1, query)
+	require.NoError(t, err)
+
+	stale, err := executor.QueryWithContext(WithStaleOnly(ctx), 1, query)
+	require.NoError(t, err)
+	assert.Same(t, live, stale)
+	assert.Equal(t, 1, inner.standardCalls)
+}
+
+func TestCachingExecutor_StaleKeysBucketed(t *testing.T) {
+	inner := &countingExecutor{}
+	c := NewWithLimit(10)
+	executor := &CachingExecutor{Executor: inner, Cache: c}
+	ctx := context.Background()
+
+	// Refreshes of a relative time range move its absolute range every time
+	hour := int64(1704067200000)
+	for refresh := int64(0); refresh < 100; refresh++ {
+		until := hour + refresh*60000
+		_, err := executor.QueryWithContext(ctx, 1, nrdb.NRQL(fmt.Sprintf("SELECT count(*) FROM Transaction SINCE %d UNTIL %d", until-3600000, until)))
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, c.Len(), 10, "retained results are bounded")
+
+	// A stale-only query of the same hour finds the last result
+	until := hour + 3599000
+	_, err := executor.QueryWithContext(WithStaleOnly(ctx), 1, nrdb.NRQL(fmt.Sprintf("SELECT count(*) FROM Transaction SINCE %d UNTIL %d", until-3600000, until)))
+	require.NoError(t, err)
+}
+
+func TestCachingExecutor_StaleKeysWithPolicy(t *testing.T) {
+	inner := &countingExecutor{}
+	executor := &CachingExecutor{Executor: inner, Cache: New(), Policy: &Policy{TTL: time.Minute, Bucket: time.Minute}}
+	ctx := context.Background()
+
+	hour := int64(1704067200000)
+	_, err := executor.QueryWithContext(ctx, 1, nrdb.NRQL(fmt.Sprintf("SELECT count(*) FROM Transaction SINCE %d UNTIL %d", hour-3600000, hour)))
+	require.NoError(t, err)
+
+	// Stale keys use StaleBucket, not the policy's shorter bucket, so a refresh
+	// later in the hour still finds the result
+	until := hour + 30*60000
+	_, err = executor.QueryWithContext(WithStaleOnly(ctx), 1, nrdb.NRQL(fmt.Sprintf("SELECT count(*) FROM Transaction SINCE %d UNTIL %d", until-3600000, until)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.standardCalls)
+}
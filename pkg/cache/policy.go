@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// ConfigError represents an invalid query cache configuration.
+type ConfigError struct {
+	Msg string
+	Err error // Wrapped error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("invalid query cache: %v", e.Err)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("invalid query cache: %s: %v", e.Msg, e.Err)
+	}
+	return fmt.Sprintf("invalid query cache: %s", e.Msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// epochRangePattern matches the absolute SINCE and UNTIL clauses that the query
+// handler adds for the dashboard time range, in epoch milliseconds.
+var epochRangePattern = regexp.MustCompile(`(?i)\b(SINCE|UNTIL)(\s+)(\d{13})\b`)
+
+// StaleBucket is the granularity of the time range in the keys of stale results.
+const StaleBucket = time.Hour
+
+// stalePolicy normalizes the queries of stale results.
+var stalePolicy = &Policy{Bucket: StaleBucket}
+
+// Policy makes CachingExecutor store the results of regular queries for a short
+// TTL. Cache keys round the query's absolute time range down to the time bucket,
+// so panels refreshed within the same bucket share one New Relic API call.
+type Policy struct {
+	TTL    time.Duration // How long query results stay fresh
+	Bucket time.Duration // Granularity of the time range in cache keys
+}
+
+// NewPolicy validates the query cache settings and creates a Policy. The time
+// bucket defaults to the TTL.
+func NewPolicy(settings models.QueryCacheSettings) (*Policy, error) {
+	if settings.TTL == "" {
+		return nil, &ConfigError{Msg: "ttl must be set"}
+	}
+	ttl, err := timeutil.ParseDurationField("queryCache.ttl", settings.TTL)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	bucket := ttl
+	if settings.TimeBucket != "" {
+		bucket, err = timeutil.ParseDurationField("queryCache.timeBucket", settings.TimeBucket)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	}
+	if bucket < time.Millisecond {
+		return nil, &ConfigError{Msg: "timeBucket must be at least 1ms"}
+	}
+
+	return &Policy{TTL: ttl, Bucket: bucket}, nil
+}
+
+// Normalize returns the query with each absolute SINCE and UNTIL timestamp rounded
+// down to the start of its time bucket. Queries without absolute timestamps are
+// returned unchanged.
+func (p *Policy) Normalize(query nrdb.NRQL) nrdb.NRQL {
+	bucketMillis := p.Bucket.Milliseconds()
+	normalized := epochRangePattern.ReplaceAllStringFunc(string(query), func(clause string) string {
+		parts := epochRangePattern.FindStringSubmatch(clause)
+		millis, err := strconv.ParseInt(parts[3], 10, 64)
+		if err != nil {
+			return clause
+		}
+		return parts[1] + parts[2] + strconv.FormatInt(millis-millis%bucketMillis, 10)
+	})
+	return nrdb.NRQL(normalized)
+}
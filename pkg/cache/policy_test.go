@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings models.QueryCacheSettings
+		expected *Policy
+		wantErr  string
+	}{
+		{
+			name:     "bucket defaults to the ttl",
+			settings: models.QueryCacheSettings{TTL: "30s"},
+			expected: &Policy{TTL: 30 * time.Second, Bucket: 30 * time.Second},
+		},
+		{
+			name:     "explicit bucket",
+			settings: models.QueryCacheSettings{TTL: "30s", TimeBucket: "1m"},
+			expected: &Policy{TTL: 30 * time.Second, Bucket: time.Minute},
+		},
+		{
+			name:    "missing ttl",
+			wantErr: "ttl must be set",
+		},
+		{
+			name:     "invalid ttl",
+			settings: models.QueryCacheSettings{TTL: "soon"},
+			wantErr:  "queryCache.ttl",
+		},
+		{
+			name:     "invalid bucket",
+			settings: models.QueryCacheSettings{TTL: "30s", TimeBucket: "30"},
+			wantErr:  "queryCache.timeBucket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.settings)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				var configErr *ConfigError
+				assert.ErrorAs(t, err, &configErr)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, policy)
+		})
+	}
+}
+
+func TestPolicy_Normalize(t *testing.T) {
+	policy := &Policy{TTL: time.Minute, Bucket: time.Minute}
+
+	tests := []struct {
+		name     string
+		query    nrdb.NRQL
+		expected nrdb.NRQL
+	}{
+		{
+			name:     "absolute range is rounded down to the bucket",
+			query:    "SELECT count(*) FROM Transaction SINCE 1714557612345 UNTIL 1714561245678",
+			expected: "SELECT count(*) FROM Transaction SINCE 1714557600000 UNTIL 1714561200000",
+		},
+		{
+			name:     "relative range is unchanged",
+			query:    "SELECT count(*) FROM Transaction SINCE 1 hour ago",
+			expected: "SELECT count(*) FROM Transaction SINCE 1 hour ago",
+		},
+		{
+			name:     "keywords are matched case-insensitively",
+			query:    "SELECT count(*) FROM Transaction since 1714557612345",
+			expected: "SELECT count(*) FROM Transaction since 1714557600000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.Normalize(tt.query))
+		})
+	}
+}
+
+func TestCachingExecutor_Policy(t *testing.T) {
+	inner := &countingExecutor{}
+	c := New()
+	executor := &CachingExecutor{Executor: inner, Cache: c, Policy: &Policy{TTL: time.Minute, Bucket: time.Minute}}
+	ctx := context.Background()
+
+	first, err := executor.QueryWithContext(ctx, 1, "SELECT count(*) FROM Transaction SINCE 1714557601000 UNTIL 1714561201000")
+	require.NoError(t, err)
+
+	// A refresh within the same time bucket is served from the cache
+	second, err := executor.QueryWithContext(ctx, 1, "SELECT count(*) FROM Transaction SINCE 1714557631000 UNTIL 1714561231000")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, inner.standardCalls)
+
+	// The next bucket is a new entry
+	_, err = executor.QueryWithContext(ctx, 1, "SELECT count(*) FROM Transaction SINCE 1714557661000 UNTIL 1714561261000")
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.standardCalls)
+
+	// Entries expire after the TTL
+	c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = executor.QueryWithContext(ctx, 1, "SELECT count(*) FROM Transaction SINCE 1714557601000 UNTIL 1714561201000")
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.standardCalls)
+
+	_, err = executor.PerformNRQLQueryWithContext(ctx, 1, "SELECT count(*) FROM Transaction FACET appName TIMESERIES")
+	require.NoError(t, err)
+	_, err = executor.PerformNRQLQueryWithContext(ctx, 1, "SELECT count(*) FROM Transaction FACET appName TIMESERIES")
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.multiCalls)
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextTransport is an http.RoundTripper that sends requests with the
+// context of the query they are made for. The New Relic client does not pass
+// request contexts on to its HTTP requests, so without it a cancelled or timed
+// out query would keep its requests, and their retries, running to completion.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+// RoundTrip sends req with the transport's context, which aborts the request
+// once the context is done. Requests made after that fail without being sent.
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.Err(); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowServer returns a server that answers after a minute unless the client
+// gives up first, and a channel closed when a request is aborted.
+func slowServer(t *testing.T, hits *int32) (*httptest.Server, chan struct{}) {
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		// The server notices a closed connection once the body has been read
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(time.Minute):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, aborted
+}
+
+func TestContextTransport_AbortsInFlightRequest(t *testing.T) {
+	var hits int32
+	server, aborted := slowServer(t, &hits)
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := &contextTransport{ctx: ctx}
+
+	// The request itself carries no context, like those of the New Relic client
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{}`))
+	require.NoError(t, err)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = transport.RoundTrip(req)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not see the request aborted")
+	}
+}
+
+func TestContextTransport_DoneContextSendsNothing(t *testing.T) {
+	var hits int32
+	server, _ := slowServer(t, &hits)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{}`))
+	require.NoError(t, err)
+	_, err = (&contextTransport{ctx: ctx}).RoundTrip(req)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, atomic.LoadInt32(&hits), "retries after cancellation are not sent")
+}
+
+func TestClientTransport_Context(t *testing.T) {
+	ctx := context.Background()
+	transport, err := clientTransport(ClientConfig{APIKey: "primary-key", Context: ctx})
+	require.NoError(t, err)
+	require.IsType(t, &contextTransport{}, transport)
+	assert.Nil(t, transport.(*contextTransport).base)
+
+	// The context is applied before the key rotation retries requests
+	transport, err = clientTransport(ClientConfig{APIKey: "primary-key", SecondaryAPIKey: "secondary-key", Context: ctx})
+	require.NoError(t, err)
+	require.IsType(t, &contextTransport{}, transport)
+	assert.IsType(t, &keyRotationTransport{}, transport.(*contextTransport).base)
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// API keys reported by KeyRotation.Active
+const (
+	KeyPrimary   = "primary"
+	KeySecondary = "secondary"
+)
+
+// apiKeyHeader is the header the New Relic client sends the user API key in.
+const apiKeyHeader = "Api-Key"
+
+// KeyRotation holds a primary and a secondary API key and which of them is in
+// use. Requests are sent with the active key; when New Relic rejects it, the
+// request is retried with the other key, which becomes active if it is accepted.
+// This lets the primary key be revoked and replaced without downtime.
+type KeyRotation struct {
+	mu        sync.RWMutex
+	keys      [2]string
+	active    int
+	fallbacks int
+}
+
+// NewKeyRotation returns a KeyRotation that starts with the primary key.
+func NewKeyRotation(primary, secondary string) *KeyRotation {
+	return &KeyRotation{keys: [2]string{primary, secondary}}
+}
+
+// Active returns KeyPrimary or KeySecondary for the key requests are sent with.
+func (k *KeyRotation) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return keyName(k.active)
+}
+
+// Fallbacks returns how many times requests switched to the other key.
+func (k *KeyRotation) Fallbacks() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.fallbacks
+}
+
+// Transport returns an http.RoundTripper that sends requests through base with
+// the active key. A nil base uses http.DefaultTransport.
+func (k *KeyRotation) Transport(base http.RoundTripper) http.RoundTripper {
+	return &keyRotationTransport{base: base, keys: k}
+}
+
+// keyRotationTransport is the http.RoundTripper of a KeyRotation.
+type keyRotationTransport struct {
+	base http.RoundTripper
+	keys *KeyRotation
+}
+
+// RoundTrip sends req with the active key, and again with the other key if New
+// Relic rejects the first as unauthorized.
+func (t *keyRotationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// The body is read once and replayed, as the retry needs it again
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	t.keys.mu.RLock()
+	active := t.keys.active
+	t.keys.mu.RUnlock()
+
+	resp, err := base.RoundTrip(withAPIKey(req, t.keys.keys[active], body))
+	if err != nil || !isAuthFailure(resp) {
+		return resp, err
+	}
+	other := 1 - active
+	if t.keys.keys[other] == "" {
+		return resp, nil
+	}
+
+	retry, err := base.RoundTrip(withAPIKey(req, t.keys.keys[other], body))
+	if err != nil || isAuthFailure(retry) {
+		if retry != nil {
+			_ = retry.Body.Close()
+		}
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+
+	t.keys.mu.Lock()
+	if t.keys.active == active {
+		t.keys.active = other
+		t.keys.fallbacks++
+		log.DefaultLogger.Warn("New Relic rejected the API key; switched to the other key", "rejected", keyName(active), "active", keyName(other))
+	}
+	t.keys.mu.Unlock()
+	return retry, nil
+}
+
+// withAPIKey returns a copy of req sent with apiKey and a fresh reader of body.
+func withAPIKey(req *http.Request, apiKey string, body []byte) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set(apiKeyHeader, apiKey)
+	if body != nil {
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+		clone.ContentLength = int64(len(body))
+	}
+	return clone
+}
+
+// isAuthFailure reports whether New Relic rejected the request's API key.
+func isAuthFailure(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+}
+
+// keyName returns KeyPrimary or KeySecondary for a key index.
+func keyName(i int) string {
+	if i == 1 {
+		return KeySecondary
+	}
+	return KeyPrimary
+}
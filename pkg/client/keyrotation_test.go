@@ -0,0 +1,99 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyServer returns a server accepting the API keys in valid, and the keys and
+// bodies of the requests it received.
+func keyServer(t *testing.T, valid map[string]bool) (*httptest.Server, *[]string, *[]string) {
+	var keys, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		keys = append(keys, r.Header.Get(apiKeyHeader))
+		bodies = append(bodies, string(body))
+		if !valid[r.Header.Get(apiKeyHeader)] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &keys, &bodies
+}
+
+func post(t *testing.T, transport http.RoundTripper, url string) int {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"query":"{ actor { user { id } } }"}`))
+	require.NoError(t, err)
+	req.Header.Set(apiKeyHeader, "ignored")
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestKeyRotation_FallsBackToSecondary(t *testing.T) {
+	server, keys, bodies := keyServer(t, map[string]bool{"secondary-key": true})
+	rotation := NewKeyRotation("primary-key", "secondary-key")
+	transport := rotation.Transport(nil)
+
+	assert.Equal(t, KeyPrimary, rotation.Active())
+	assert.Equal(t, http.StatusOK, post(t, transport, server.URL))
+	assert.Equal(t, []string{"primary-key", "secondary-key"}, *keys)
+	assert.Equal(t, (*bodies)[0], (*bodies)[1], "the retry replays the request body")
+	assert.Equal(t, KeySecondary, rotation.Active())
+	assert.Equal(t, 1, rotation.Fallbacks())
+
+	// Later requests go straight to the active key
+	assert.Equal(t, http.StatusOK, post(t, transport, server.URL))
+	assert.Equal(t, []string{"primary-key", "secondary-key", "secondary-key"}, *keys)
+}
+
+func TestKeyRotation_SwitchesBackToPrimary(t *testing.T) {
+	valid := map[string]bool{"secondary-key": true}
+	server, _, _ := keyServer(t, valid)
+	rotation := NewKeyRotation("primary-key", "secondary-key")
+	transport := rotation.Transport(nil)
+	post(t, transport, server.URL)
+	require.Equal(t, KeySecondary, rotation.Active())
+
+	// The secondary key is revoked once the primary key has been replaced
+	valid["primary-key"], valid["secondary-key"] = true, false
+	assert.Equal(t, http.StatusOK, post(t, transport, server.URL))
+	assert.Equal(t, KeyPrimary, rotation.Active())
+	assert.Equal(t, 2, rotation.Fallbacks())
+}
+
+func TestKeyRotation_BothKeysRejected(t *testing.T) {
+	server, keys, _ := keyServer(t, map[string]bool{})
+	rotation := NewKeyRotation("primary-key", "secondary-key")
+
+	assert.Equal(t, http.StatusUnauthorized, post(t, rotation.Transport(nil), server.URL))
+	assert.Equal(t, []string{"primary-key", "secondary-key"}, *keys)
+	assert.Equal(t, KeyPrimary, rotation.Active(), "the active key only changes when the other key is accepted")
+	assert.Equal(t, 0, rotation.Fallbacks())
+}
+
+func TestClientTransport_KeyRotation(t *testing.T) {
+	transport, err := clientTransport(ClientConfig{APIKey: "primary-key"})
+	require.NoError(t, err)
+	assert.Nil(t, transport, "no secondary key keeps http.DefaultTransport")
+
+	rotation := NewKeyRotation("primary-key", "secondary-key")
+	transport, err = clientTransport(ClientConfig{APIKey: "primary-key", SecondaryAPIKey: "secondary-key", KeyRotation: rotation})
+	require.NoError(t, err)
+	require.IsType(t, &keyRotationTransport{}, transport)
+	assert.Same(t, rotation, transport.(*keyRotationTransport).keys)
+
+	transport, err = clientTransport(ClientConfig{APIKey: "primary-key", SecondaryAPIKey: "secondary-key"})
+	require.NoError(t, err)
+	require.IsType(t, &keyRotationTransport{}, transport)
+	assert.Equal(t, KeyPrimary, transport.(*keyRotationTransport).keys.Active())
+}
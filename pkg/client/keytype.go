@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyType is the kind of a New Relic API key, as told by its format.
+type KeyType string
+
+// New Relic API key types.
+const (
+	KeyTypeUser    KeyType = "User"
+	KeyTypeLicense KeyType = "License"
+	KeyTypeIngest  KeyType = "Insert"
+	KeyTypeBrowser KeyType = "Browser"
+	KeyTypeAdmin   KeyType = "Admin"
+	KeyTypeUnknown KeyType = "Unknown"
+)
+
+// UserKeyPrefix is the prefix of User keys, the only keys NerdGraph accepts.
+const UserKeyPrefix = "NRAK-"
+
+// licenseKeySuffix ends the 40-character License keys that accounts ingest with.
+const licenseKeySuffix = "NRAL"
+
+// keyPrefixes are the types of API keys, by key prefix.
+var keyPrefixes = map[string]KeyType{
+	UserKeyPrefix: KeyTypeUser,
+	"NRII-":       KeyTypeIngest,
+	"NRJS-":       KeyTypeBrowser,
+	"NRAA-":       KeyTypeAdmin,
+}
+
+// DetectKeyType returns the type of an API key by its prefix, or by its length
+// and suffix for License keys. Keys of other formats, such as legacy keys, are
+// of KeyTypeUnknown.
+func DetectKeyType(apiKey string) KeyType {
+	apiKey = strings.TrimSpace(apiKey)
+	for prefix, keyType := range keyPrefixes {
+		if strings.HasPrefix(apiKey, prefix) {
+			return keyType
+		}
+	}
+	if len(apiKey) == 40 && strings.HasSuffix(apiKey, licenseKeySuffix) {
+		return KeyTypeLicense
+	}
+	return KeyTypeUnknown
+}
+
+// CanQuery reports whether keys of the type may run NerdGraph queries. Keys of
+// unknown type are let through, for New Relic to accept or reject.
+func (t KeyType) CanQuery() bool {
+	return t == KeyTypeUser || t == KeyTypeUnknown
+}
+
+// keyRejections tell why keys of the types that cannot run queries are rejected.
+var keyRejections = map[KeyType]string{
+	KeyTypeLicense: "the configured License key can only send data to New Relic and cannot run queries",
+	KeyTypeIngest:  "the configured Insert key can only send data to New Relic and cannot run queries",
+	KeyTypeBrowser: "the configured Browser key can only send browser monitoring data to New Relic and cannot run queries",
+	KeyTypeAdmin:   "the configured Admin key is a deprecated REST API key, which NerdGraph does not accept",
+}
+
+// CheckQueryKey returns an error naming the type of apiKey when the type cannot
+// run queries, as New Relic otherwise rejects such keys with an authentication
+// error that does not tell why.
+func CheckQueryKey(apiKey string) error {
+	keyType := DetectKeyType(apiKey)
+	if keyType.CanQuery() {
+		return nil
+	}
+	return &NewRelicClientError{Msg: fmt.Sprintf("%s; use a User key, starting with %s", keyRejections[keyType], UserKeyPrefix)}
+}
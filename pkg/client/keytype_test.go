@@ -0,0 +1,41 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectKeyType(t *testing.T) {
+	tests := map[string]KeyType{
+		"NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0":          KeyTypeUser,
+		" NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0 ":        KeyTypeUser,
+		"NRII-abcdefghijklmnopqrstuvwxyz01":         KeyTypeIngest,
+		"NRJS-abcdef0123456789abc":                  KeyTypeBrowser,
+		"NRAA-abcdef0123456789abcdef0123456789abc":  KeyTypeAdmin,
+		"0123456789abcdef0123456789abcdef0123NRAL":  KeyTypeLicense,
+		"0123456789abcdef0123456789abcdef01234NRAL": KeyTypeUnknown,
+		"test-api-key": KeyTypeUnknown,
+	}
+	for apiKey, want := range tests {
+		assert.Equal(t, want, DetectKeyType(apiKey), apiKey)
+	}
+}
+
+func TestCheckQueryKey(t *testing.T) {
+	assert.NoError(t, CheckQueryKey("NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0"))
+	assert.NoError(t, CheckQueryKey("legacy-key"), "keys of unknown type are left for New Relic to check")
+
+	tests := map[string]string{
+		"0123456789abcdef0123456789abcdef0123NRAL": "the configured License key can only send data to New Relic and cannot run queries; use a User key, starting with NRAK-",
+		"NRII-abcdefghijklmnopqrstuvwxyz01":        "the configured Insert key can only send data to New Relic and cannot run queries; use a User key, starting with NRAK-",
+		"NRJS-abcdef0123456789abc":                 "the configured Browser key can only send browser monitoring data to New Relic and cannot run queries; use a User key, starting with NRAK-",
+		"NRAA-abcdef0123456789abcdef0123456789abc": "the configured Admin key is a deprecated REST API key, which NerdGraph does not accept; use a User key, starting with NRAK-",
+	}
+	for apiKey, want := range tests {
+		err := CheckQueryKey(apiKey)
+		var clientErr *NewRelicClientError
+		assert.ErrorAs(t, err, &clientErr, apiKey)
+		assert.EqualError(t, err, "new relic client error: "+want)
+	}
+}
@@ -1,10 +1,13 @@
 package client
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
 	"github.com/newrelic/newrelic-client-go/v2/newrelic"
 )
 
@@ -21,13 +24,20 @@ var (
 
 // ClientConfig holds configuration options for the New Relic client
 type ClientConfig struct {
-	APIKey        string
-	Region        string
-	Timeout       time.Duration
-	RetryCount    int
-	RetryDelay    time.Duration
-	UserAgent     string
-	DatasourceUID string // New field for datasource UID
+	APIKey           string
+	Region           string // New Relic region: US, EU, Staging or FedRAMP (empty means US)
+	Timeout          time.Duration
+	RetryCount       int
+	RetryDelay       time.Duration
+	UserAgent        string
+	DatasourceUID    string            // New field for datasource UID
+	Transport        http.RoundTripper // Optional HTTP transport for API requests, e.g. for trace propagation
+	ProxyURL         string            // Optional HTTP, HTTPS or SOCKS5 proxy; empty uses the proxy environment variables
+	TLS              *TLSConfig        // Optional TLS options, e.g. a custom CA for TLS-intercepting proxies
+	SecureSocksProxy *proxy.Options    // Grafana's secure socks proxy, when enabled for the datasource
+	SecondaryAPIKey  string            // Optional key retried when New Relic rejects APIKey
+	KeyRotation      *KeyRotation      // Optional state of APIKey and SecondaryAPIKey shared between clients; created per client if nil
+	Context          context.Context   // Optional query context; its cancellation aborts the client's in-flight requests
 }
 
 // DefaultConfig returns a ClientConfig with sensible defaults
@@ -67,6 +77,9 @@ func NewClient(config ClientConfig) (*newrelic.NewRelic, error) {
 	if config.APIKey == "" {
 		return nil, &NewRelicClientError{Msg: "New Relic API key cannot be empty"}
 	}
+	if err := checkQueryKeys(config); err != nil {
+		return nil, err
+	}
 
 	// Create service name with UID if provided
 	clientServiceName := serviceName
@@ -77,13 +90,25 @@ func NewClient(config ClientConfig) (*newrelic.NewRelic, error) {
 		log.DefaultLogger.Debug("NewRelicClient: Using default service name", "serviceName", clientServiceName)
 	}
 
+	regionOpts, err := regionOptions(config.Region)
+	if err != nil {
+		return nil, err
+	}
+
 	// Setup configuration options
 	cfgOpts := []newrelic.ConfigOption{
 		newrelic.ConfigPersonalAPIKey(config.APIKey),
-		newrelic.ConfigRegion(config.Region),
 		newrelic.ConfigUserAgent(config.UserAgent),
 		newrelic.ConfigServiceName(clientServiceName),
 	}
+	cfgOpts = append(cfgOpts, regionOpts...)
+	transport, err := clientTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		cfgOpts = append(cfgOpts, newrelic.ConfigHTTPTransport(transport))
+	}
 
 	// Create the client directly using the variable function to allow for testing
 	nrClient, err := NewrelicNewFunc(cfgOpts...)
@@ -108,6 +133,9 @@ func CreateNewRelicClient(apiKey string, factory NewRelicClientFactory) (*newrel
 	if apiKey == "" {
 		return nil, &NewRelicClientError{Msg: "New Relic API key cannot be empty"}
 	}
+	if err := CheckQueryKey(apiKey); err != nil {
+		return nil, err
+	}
 
 	// Use the provided factory to create the New Relic client.
 	// This delegates the actual client initialization logic, separating concerns.
@@ -125,6 +153,9 @@ func GetClient(config ClientConfig, factory NewRelicClientFactory) (*newrelic.Ne
 	if config.APIKey == "" {
 		return nil, &NewRelicClientError{Msg: "New Relic API key cannot be empty"}
 	}
+	if err := checkQueryKeys(config); err != nil {
+		return nil, err
+	}
 
 	// Create service name with UID if provided
 	clientServiceName := serviceName
@@ -135,12 +166,24 @@ func GetClient(config ClientConfig, factory NewRelicClientFactory) (*newrelic.Ne
 		log.DefaultLogger.Debug("GetClient: Using default service name", "serviceName", clientServiceName)
 	}
 
+	regionOpts, err := regionOptions(config.Region)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := []newrelic.ConfigOption{
 		newrelic.ConfigPersonalAPIKey(config.APIKey),
-		newrelic.ConfigRegion(config.Region),
 		newrelic.ConfigUserAgent(config.UserAgent),
 		newrelic.ConfigServiceName(clientServiceName),
 	}
+	opts = append(opts, regionOpts...)
+	transport, err := clientTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		opts = append(opts, newrelic.ConfigHTTPTransport(transport))
+	}
 
 	client, err := factory.CreateClient(opts...)
 	if err != nil {
@@ -148,3 +191,44 @@ func GetClient(config ClientConfig, factory NewRelicClientFactory) (*newrelic.Ne
 	}
 	return client, nil
 }
+
+// checkQueryKeys checks that the primary and secondary API keys of config can
+// run queries.
+func checkQueryKeys(config ClientConfig) error {
+	if err := CheckQueryKey(config.APIKey); err != nil {
+		return err
+	}
+	if config.SecondaryAPIKey == "" {
+		return nil
+	}
+	if err := CheckQueryKey(config.SecondaryAPIKey); err != nil {
+		return &NewRelicClientError{Msg: "invalid secondary API key", Err: err}
+	}
+	return nil
+}
+
+// clientTransport returns the HTTP transport for a client: config.Transport if
+// set, a transport for the proxy and TLS options otherwise, or nil to use
+// http.DefaultTransport. With a secondary API key, the transport retries
+// requests rejected as unauthorized with the other key. With a context, the
+// requests are aborted once it is done.
+func clientTransport(config ClientConfig) (http.RoundTripper, error) {
+	transport := config.Transport
+	if transport == nil && config.hasConnectionSettings() {
+		var err error
+		if transport, err = NewTransport(config); err != nil {
+			return nil, err
+		}
+	}
+	if config.SecondaryAPIKey != "" {
+		keys := config.KeyRotation
+		if keys == nil {
+			keys = NewKeyRotation(config.APIKey, config.SecondaryAPIKey)
+		}
+		transport = keys.Transport(transport)
+	}
+	if config.Context != nil {
+		transport = &contextTransport{ctx: config.Context, base: transport}
+	}
+	return transport, nil
+}
@@ -1,12 +1,18 @@
 package client
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
+	"newrelic-grafana-plugin/pkg/nrdbiface/mocknrdb"
+
 	"github.com/newrelic/newrelic-client-go/v2/newrelic"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // MockNewRelicClientFactory implements NewRelicClientFactory for testing.
@@ -27,6 +33,33 @@ func (m *MockNewRelicClientFactory) CreateClient(opts ...newrelic.ConfigOption)
 	return m.Client, nil
 }
 
+// TestNewClient_MockNerdGraph verifies that clients query NerdGraph through
+// the configured transport in every region.
+func TestNewClient_MockNerdGraph(t *testing.T) {
+	server := mocknrdb.NewServer(mocknrdb.Fixture{
+		AccountID: 123456,
+		NRQL:      "SELECT count(*) FROM Transaction",
+		Result:    []byte(`{"results":[{"count":1523}]}`),
+	})
+	defer server.Close()
+
+	for _, region := range []string{RegionUS, RegionEU, RegionStaging, RegionFedRAMP} {
+		t.Run(region, func(t *testing.T) {
+			config := DefaultConfig()
+			config.APIKey, config.Region, config.Transport = "test-api-key", region, server.Transport()
+			nrClient, err := NewClient(config)
+			require.NoError(t, err)
+			results, err := nrClient.Nrdb.QueryWithContext(context.Background(), 123456, "SELECT count(*) FROM Transaction")
+			require.NoError(t, err)
+			require.Len(t, results.Results, 1)
+			assert.EqualValues(t, 1523, results.Results[0]["count"])
+		})
+	}
+	requests := server.Requests()
+	require.Len(t, requests, 4)
+	assert.Equal(t, "test-api-key", requests[0].APIKey)
+}
+
 // TestNewClient tests the direct client creation functionality
 func TestNewClient(t *testing.T) {
 	// Save the original newrelic.New function to restore after tests
@@ -52,6 +85,22 @@ func TestNewClient(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "custom transport adds an option",
+			config: ClientConfig{
+				APIKey:    "valid-api-key",
+				Region:    "US",
+				UserAgent: "test-user-agent",
+				Transport: http.DefaultTransport,
+			},
+			mockFn: func(opts ...newrelic.ConfigOption) (*newrelic.NewRelic, error) {
+				if len(opts) != 5 {
+					return nil, fmt.Errorf("expected 5 config options, got %d", len(opts))
+				}
+				return &newrelic.NewRelic{}, nil
+			},
+			wantErr: false,
+		},
 		{
 			name: "empty api key",
 			config: ClientConfig{
@@ -262,6 +311,27 @@ func TestGetClient(t *testing.T) {
 			factory: &DefaultNewRelicClientFactory{},
 			wantErr: true,
 		},
+		{
+			name: "license key",
+			config: ClientConfig{
+				APIKey:    "0123456789abcdef0123456789abcdef0123NRAL",
+				Region:    "US",
+				UserAgent: "test-user-agent",
+			},
+			factory: &MockNewRelicClientFactory{Client: &newrelic.NewRelic{}},
+			wantErr: true,
+		},
+		{
+			name: "ingest secondary key",
+			config: ClientConfig{
+				APIKey:          "NRAK-PRIMARY",
+				SecondaryAPIKey: "NRII-SECONDARY",
+				Region:          "US",
+				UserAgent:       "test-user-agent",
+			},
+			factory: &MockNewRelicClientFactory{Client: &newrelic.NewRelic{}},
+			wantErr: true,
+		},
 		{
 			name: "factory error",
 			config: ClientConfig{
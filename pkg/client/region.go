@@ -0,0 +1,60 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+)
+
+// New Relic regions that can be selected in the datasource settings.
+const (
+	RegionUS      = "US"
+	RegionEU      = "EU"
+	RegionStaging = "Staging"
+	RegionFedRAMP = "FedRAMP"
+)
+
+// FedRAMP accounts use the US region with dedicated API endpoints, which the
+// client library has no region for.
+const (
+	fedRAMPNerdGraphURL = "https://gov-api.newrelic.com/graphql"
+	fedRAMPRestURL      = "https://gov-api.newrelic.com/v2"
+)
+
+// regions lists the supported regions by lower-cased name.
+var regions = map[string]string{
+	"us":      RegionUS,
+	"eu":      RegionEU,
+	"staging": RegionStaging,
+	"fedramp": RegionFedRAMP,
+}
+
+// NormalizeRegion returns the canonical name of a region, matched case-insensitively.
+// An empty name selects the US region.
+func NormalizeRegion(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return RegionUS, nil
+	}
+	region, ok := regions[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return "", &NewRelicClientError{Msg: fmt.Sprintf("unknown region '%s': must be one of US, EU, Staging, FedRAMP", name)}
+	}
+	return region, nil
+}
+
+// regionOptions returns the client options that point the client at the region's endpoints.
+func regionOptions(name string) ([]newrelic.ConfigOption, error) {
+	region, err := NormalizeRegion(name)
+	if err != nil {
+		return nil, err
+	}
+	if region == RegionFedRAMP {
+		return []newrelic.ConfigOption{
+			newrelic.ConfigRegion(RegionUS),
+			newrelic.ConfigNerdGraphBaseURL(fedRAMPNerdGraphURL),
+			newrelic.ConfigBaseURL(fedRAMPRestURL),
+		}, nil
+	}
+	return []newrelic.ConfigOption{newrelic.ConfigRegion(region)}, nil
+}
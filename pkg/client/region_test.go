@@ -0,0 +1,77 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   string
+		expected string
+		wantErr  bool
+	}{
+		{name: "empty defaults to US", region: "", expected: RegionUS},
+		{name: "US", region: "US", expected: RegionUS},
+		{name: "EU lower case", region: "eu", expected: RegionEU},
+		{name: "Staging", region: "staging", expected: RegionStaging},
+		{name: "FedRAMP", region: "FEDRAMP", expected: RegionFedRAMP},
+		{name: "unknown", region: "APAC", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region, err := NormalizeRegion(tt.region)
+			if tt.wantErr {
+				var clientErr *NewRelicClientError
+				require.ErrorAs(t, err, &clientErr)
+				assert.Contains(t, err.Error(), tt.region)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, region)
+		})
+	}
+}
+
+func TestRegionOptions(t *testing.T) {
+	tests := []struct {
+		region    string
+		nerdGraph string
+		rest      string
+	}{
+		{region: "", nerdGraph: "https://api.newrelic.com/graphql", rest: "https://api.newrelic.com/v2"},
+		{region: RegionEU, nerdGraph: "https://api.eu.newrelic.com/graphql", rest: "https://api.eu.newrelic.com/v2"},
+		{region: RegionStaging, nerdGraph: "https://staging-api.newrelic.com/graphql", rest: "https://staging-api.newrelic.com/v2"},
+		{region: RegionFedRAMP, nerdGraph: fedRAMPNerdGraphURL, rest: fedRAMPRestURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			opts, err := regionOptions(tt.region)
+			require.NoError(t, err)
+
+			cfg := config.New()
+			for _, opt := range opts {
+				require.NoError(t, opt(&cfg))
+			}
+			assert.Equal(t, tt.nerdGraph, cfg.Region().NerdGraphURL())
+			assert.Equal(t, tt.rest, cfg.Region().RestURL())
+		})
+	}
+}
+
+func TestNewClient_UnknownRegion(t *testing.T) {
+	config := DefaultConfig()
+	config.APIKey = "test-api-key"
+	config.Region = "APAC"
+
+	nrClient, err := NewClient(config)
+	assert.Nil(t, nrClient)
+	var clientErr *NewRelicClientError
+	assert.ErrorAs(t, err, &clientErr)
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+)
+
+// proxySchemes are the URL schemes supported for ClientConfig.ProxyURL.
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true}
+
+// TLSConfig holds TLS options for connections to the New Relic API.
+type TLSConfig struct {
+	CACert             string // PEM encoded CA certificates trusted in addition to the system roots
+	ClientCert         string // PEM encoded client certificate for mutual TLS
+	ClientKey          string // PEM encoded key of ClientCert
+	ServerName         string // Server name used to verify the certificate, if not the host name
+	InsecureSkipVerify bool   // Skip certificate verification; for testing only
+}
+
+// ConfigFromSettings returns the default client configuration for the datasource
+// settings: API key, region, and the proxy and TLS options of its connection.
+func ConfigFromSettings(settings *models.PluginSettings, datasourceUID string) ClientConfig {
+	config := DefaultConfig()
+	config.APIKey = settings.Secrets.ApiKey
+	config.SecondaryAPIKey = settings.Secrets.SecondaryApiKey
+	config.Region = settings.Region
+	config.DatasourceUID = datasourceUID // Set the datasource UID for unique service name
+	config.ProxyURL = settings.ProxyURL
+
+	tlsConfig := &TLSConfig{ServerName: settings.ServerName, InsecureSkipVerify: settings.TLSSkipVerify}
+	if settings.TLSAuthWithCACert {
+		tlsConfig.CACert = settings.Secrets.TLSCACert
+	}
+	if settings.TLSAuth {
+		tlsConfig.ClientCert = settings.Secrets.TLSClientCert
+		tlsConfig.ClientKey = settings.Secrets.TLSClientKey
+	}
+	if *tlsConfig != (TLSConfig{}) {
+		config.TLS = tlsConfig
+	}
+	return config
+}
+
+// hasConnectionSettings reports whether config needs a transport of its own
+// rather than http.DefaultTransport.
+func (c ClientConfig) hasConnectionSettings() bool {
+	return c.ProxyURL != "" || c.TLS != nil || c.SecureSocksProxy != nil
+}
+
+// ParseProxyURL parses an HTTP, HTTPS or SOCKS5 proxy URL.
+func ParseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &NewRelicClientError{Msg: "proxy URL could not be parsed", Err: err}
+	}
+	if !proxySchemes[proxyURL.Scheme] || proxyURL.Host == "" {
+		return nil, &NewRelicClientError{Msg: fmt.Sprintf("proxy URL '%s' must be http://, https:// or socks5:// followed by a host", proxyURL.Redacted())}
+	}
+	return proxyURL, nil
+}
+
+// NewTLSConfig builds the tls.Config for config.
+func NewTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify, //nolint:gosec // opt-in setting for test environments
+	}
+
+	if config.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(config.CACert)) {
+			return nil, &NewRelicClientError{Msg: "invalid CA certificate: no PEM encoded certificate found"}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCert != "" || config.ClientKey != "" {
+		certificate, err := tls.X509KeyPair([]byte(config.ClientCert), []byte(config.ClientKey))
+		if err != nil {
+			return nil, &NewRelicClientError{Msg: "invalid TLS client certificate", Err: err}
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// NewTransport creates the HTTP transport for the connection options of config.
+// Requests go through ProxyURL if it is set, otherwise through the proxy named by
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. With
+// SecureSocksProxy enabled, connections are dialed through Grafana's secure socks
+// proxy.
+func NewTransport(config ClientConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if config.ProxyURL != "" {
+		proxyURL, err := ParseProxyURL(config.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if config.TLS != nil {
+		tlsConfig, err := NewTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if config.SecureSocksProxy != nil {
+		if err := proxy.New(config.SecureSocksProxy).ConfigureSecureSocksHTTPProxy(transport); err != nil {
+			return nil, &NewRelicClientError{Msg: "failed to configure the secure socks proxy", Err: err}
+		}
+	}
+	return transport, nil
+}
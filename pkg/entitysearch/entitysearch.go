@@ -0,0 +1,223 @@
+// Package entitysearch searches New Relic entities through the NerdGraph entity
+// search API, for the entities query type and the entity autocomplete resource.
+package entitysearch
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/entities"
+)
+
+// FrameName is the name of the table frame of an entities query.
+const FrameName = "entities"
+
+// AutocompleteLimit is the number of entities returned by Autocomplete.
+const AutocompleteLimit = 20
+
+// LookupBatchSize is the most entities Lookup searches for at once.
+const LookupBatchSize = 25
+
+// guidPattern matches decoded entity GUIDs: the account ID, domain, type and
+// domain ID of the entity, e.g. 1|APM|APPLICATION|123456.
+var guidPattern = regexp.MustCompile(`^\d+\|[A-Z]+\|[A-Z_]+\|.+$`)
+
+// Searcher runs entity searches. It is implemented by the New Relic client's
+// entities.Entities.
+type Searcher interface {
+	GetEntitySearchByQueryWithContext(ctx context.Context, options entities.EntitySearchOptions, query string, sortBy []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error)
+}
+
+// RequestError represents an invalid entity search.
+type RequestError struct {
+	Msg string
+}
+
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// Entity is an entity found by a search.
+type Entity struct {
+	Name          string              `json:"name"`
+	GUID          string              `json:"guid"`
+	Type          string              `json:"type"`
+	Domain        string              `json:"domain"`
+	AccountID     int                 `json:"accountId"`
+	Reporting     *bool               `json:"reporting,omitempty"`     // Nil when New Relic does not report it for the entity type
+	AlertSeverity string              `json:"alertSeverity,omitempty"` // NOT_ALERTING, WARNING, CRITICAL or NOT_CONFIGURED
+	Tags          map[string][]string `json:"tags,omitempty"`
+}
+
+// Search returns the entities matching query, written in the entity search
+// syntax, e.g. "name LIKE 'checkout' AND type = 'APPLICATION'".
+func Search(ctx context.Context, searcher Searcher, query string) ([]Entity, error) {
+	return search(ctx, searcher, query, 0)
+}
+
+// IsGUID reports whether value is an entity GUID: the base64 encoding of the
+// account ID, domain, type and domain ID of an entity.
+func IsGUID(value string) bool {
+	if len(value) < 16 {
+		return false
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	return err == nil && guidPattern.Match(decoded)
+}
+
+// Lookup returns the entities of guids, by GUID, searching for LookupBatchSize
+// GUIDs at a time. GUIDs of entities that are not found are left out.
+func Lookup(ctx context.Context, searcher Searcher, guids []string) (map[string]Entity, error) {
+	found := make(map[string]Entity, len(guids))
+	for start := 0; start < len(guids); start += LookupBatchSize {
+		batch := guids[start:min(start+LookupBatchSize, len(guids))]
+		quoted := make([]string, len(batch))
+		for i, guid := range batch {
+			quoted[i] = quote(guid)
+		}
+		entities, err := search(ctx, searcher, fmt.Sprintf("id IN (%s)", strings.Join(quoted, ", ")), 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range entities {
+			found[entity.GUID] = entity
+		}
+	}
+	return found, nil
+}
+
+// Autocomplete returns up to AutocompleteLimit entities whose name contains
+// prefix, optionally limited to an entity type, sorted by name.
+func Autocomplete(ctx context.Context, searcher Searcher, prefix, entityType string) ([]Entity, error) {
+	conditions := []string{fmt.Sprintf("name LIKE %s", quote(prefix))}
+	if entityType != "" {
+		conditions = append(conditions, fmt.Sprintf("type = %s", quote(strings.ToUpper(entityType))))
+	}
+	found, err := search(ctx, searcher, strings.Join(conditions, " AND "), AutocompleteLimit)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(found, func(i, j int) bool { return strings.ToLower(found[i].Name) < strings.ToLower(found[j].Name) })
+	return found, nil
+}
+
+// search runs query, returning at most limit entities when limit is positive.
+func search(ctx context.Context, searcher Searcher, query string, limit int) ([]Entity, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, &RequestError{Msg: "entity search query is required"}
+	}
+	result, err := searcher.GetEntitySearchByQueryWithContext(ctx, entities.EntitySearchOptions{Limit: limit}, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]Entity, 0, len(result.Results.Entities))
+	for _, outline := range result.Results.Entities {
+		if outline != nil {
+			found = append(found, fromOutline(outline))
+		}
+	}
+	return found, nil
+}
+
+// reportingOutline and alertingOutline are implemented by the outlines of
+// entity types that have a reporting status or an alert severity.
+type reportingOutline interface {
+	GetReporting() bool
+}
+
+type alertingOutline interface {
+	GetAlertSeverity() entities.EntityAlertSeverity
+}
+
+// fromOutline converts an entity search result.
+func fromOutline(outline entities.EntityOutlineInterface) Entity {
+	entity := Entity{
+		Name:      outline.GetName(),
+		GUID:      string(outline.GetGUID()),
+		Type:      outline.GetType(),
+		Domain:    outline.GetDomain(),
+		AccountID: outline.GetAccountID(),
+	}
+	if reporting, ok := outline.(reportingOutline); ok {
+		value := reporting.GetReporting()
+		entity.Reporting = &value
+	}
+	if alerting, ok := outline.(alertingOutline); ok {
+		entity.AlertSeverity = string(alerting.GetAlertSeverity())
+	}
+
+	for _, tag := range outline.GetTags() {
+		if entity.Tags == nil {
+			entity.Tags = make(map[string][]string)
+		}
+		entity.Tags[tag.Key] = append(entity.Tags[tag.Key], tag.Values...)
+	}
+	return entity
+}
+
+// Frame returns the entities as a table with a row per entity. Tags are shown
+// as "key=value" pairs sorted by key.
+func Frame(found []Entity) *data.Frame {
+	var (
+		names      []string
+		guids      []string
+		types      []string
+		domains    []string
+		accountIDs []int64
+		reporting  []*bool
+		severities []string
+		tags       []string
+	)
+	for _, entity := range found {
+		names = append(names, entity.Name)
+		guids = append(guids, entity.GUID)
+		types = append(types, entity.Type)
+		domains = append(domains, entity.Domain)
+		accountIDs = append(accountIDs, int64(entity.AccountID))
+		reporting = append(reporting, entity.Reporting)
+		severities = append(severities, entity.AlertSeverity)
+		tags = append(tags, FormatTags(entity.Tags))
+	}
+
+	frame := data.NewFrame(FrameName,
+		data.NewField("name", nil, names),
+		data.NewField("guid", nil, guids),
+		data.NewField("type", nil, types),
+		data.NewField("domain", nil, domains),
+		data.NewField("accountId", nil, accountIDs),
+		data.NewField("reporting", nil, reporting),
+		data.NewField("alertSeverity", nil, severities),
+		data.NewField("tags", nil, tags),
+	)
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	return frame
+}
+
+// FormatTags returns entity tags as comma-separated "key=value" pairs sorted by key.
+func FormatTags(tags map[string][]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range tags[key] {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// quote returns value as a single-quoted entity search string. Entity search
+// LIKE conditions match substrings, so no wildcards are added.
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
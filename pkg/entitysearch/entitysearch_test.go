@@ -0,0 +1,154 @@
+package entitysearch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/common"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSearcher records the last search and returns a fixed result.
+type fakeSearcher struct {
+	query    string
+	options  entities.EntitySearchOptions
+	entities []entities.EntityOutlineInterface
+	err      error
+}
+
+func (f *fakeSearcher) GetEntitySearchByQueryWithContext(_ context.Context, options entities.EntitySearchOptions, query string, _ []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error) {
+	f.query = query
+	f.options = options
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &entities.EntitySearch{Results: entities.EntitySearchResult{Entities: f.entities}}, nil
+}
+
+func testOutlines() []entities.EntityOutlineInterface {
+	return []entities.EntityOutlineInterface{
+		&entities.ApmApplicationEntityOutline{
+			Name:          "checkout",
+			GUID:          common.EntityGUID("MXxBUE18QVBQTElDQVRJT058MQ"),
+			Type:          "APPLICATION",
+			Domain:        "APM",
+			AccountID:     1,
+			Reporting:     false,
+			AlertSeverity: entities.EntityAlertSeverityTypes.CRITICAL,
+			Tags: []entities.EntityTag{
+				{Key: "team", Values: []string{"payments"}},
+				{Key: "env", Values: []string{"prod", "eu"}},
+			},
+		},
+		&entities.GenericEntityOutline{Name: "Billing", GUID: "MXxWSVp8REFTSEJPQVJEfDI", Type: "DASHBOARD", Domain: "VIZ", AccountID: 1, Reporting: true},
+	}
+}
+
+func TestSearch(t *testing.T) {
+	searcher := &fakeSearcher{entities: testOutlines()}
+	found, err := Search(context.Background(), searcher, "domain = 'APM'")
+	require.NoError(t, err)
+
+	assert.Equal(t, "domain = 'APM'", searcher.query)
+	require.Len(t, found, 2)
+	assert.Equal(t, "checkout", found[0].Name)
+	assert.Equal(t, "MXxBUE18QVBQTElDQVRJT058MQ", found[0].GUID)
+	require.NotNil(t, found[0].Reporting)
+	assert.False(t, *found[0].Reporting)
+	assert.Equal(t, "CRITICAL", found[0].AlertSeverity)
+	assert.Equal(t, map[string][]string{"team": {"payments"}, "env": {"prod", "eu"}}, found[0].Tags)
+	require.NotNil(t, found[1].Reporting)
+	assert.True(t, *found[1].Reporting)
+
+	t.Run("empty query", func(t *testing.T) {
+		_, err := Search(context.Background(), &fakeSearcher{}, "  ")
+		var requestErr *RequestError
+		assert.True(t, errors.As(err, &requestErr))
+	})
+
+	t.Run("search error", func(t *testing.T) {
+		_, err := Search(context.Background(), &fakeSearcher{err: errors.New("unauthorized")}, "name = 'x'")
+		assert.EqualError(t, err, "unauthorized")
+	})
+}
+
+func TestAutocomplete(t *testing.T) {
+	searcher := &fakeSearcher{entities: testOutlines()}
+	found, err := Autocomplete(context.Background(), searcher, "o'neil", "application")
+	require.NoError(t, err)
+
+	assert.Equal(t, `name LIKE 'o\'neil' AND type = 'APPLICATION'`, searcher.query)
+	assert.Equal(t, AutocompleteLimit, searcher.options.Limit)
+	require.Len(t, found, 2)
+	assert.Equal(t, "Billing", found[0].Name)
+	assert.Equal(t, "checkout", found[1].Name)
+
+	_, err = Autocomplete(context.Background(), searcher, "web", "")
+	require.NoError(t, err)
+	assert.Equal(t, "name LIKE 'web'", searcher.query)
+}
+
+func TestIsGUID(t *testing.T) {
+	assert.True(t, IsGUID("MXxBUE18QVBQTElDQVRJT058MQ"))
+	assert.True(t, IsGUID("MXxWSVp8REFTSEJPQVJEfDI="), "padding is allowed")
+	assert.False(t, IsGUID("checkout"))
+	assert.False(t, IsGUID("aGVsbG8gd29ybGQgZnJvbSBiYXNlNjQ"), "base64 text that is not a GUID")
+	assert.False(t, IsGUID("550e8400-e29b-41d4-a716-446655440000"))
+}
+
+func TestLookup(t *testing.T) {
+	searcher := &fakeSearcher{entities: testOutlines()}
+	found, err := Lookup(context.Background(), searcher, []string{"MXxBUE18QVBQTElDQVRJT058MQ", "MXxWSVp8REFTSEJPQVJEfDI"})
+	require.NoError(t, err)
+	assert.Equal(t, "id IN ('MXxBUE18QVBQTElDQVRJT058MQ', 'MXxWSVp8REFTSEJPQVJEfDI')", searcher.query)
+	assert.Equal(t, "checkout", found["MXxBUE18QVBQTElDQVRJT058MQ"].Name)
+	assert.Equal(t, "Billing", found["MXxWSVp8REFTSEJPQVJEfDI"].Name)
+
+	// Lookups of many GUIDs are batched
+	calls := 0
+	counting := &countingSearcher{fakeSearcher: fakeSearcher{}, calls: &calls}
+	guids := make([]string, LookupBatchSize+1)
+	for i := range guids {
+		guids[i] = "MXxBUE18QVBQTElDQVRJT058MQ"
+	}
+	_, err = Lookup(context.Background(), counting, guids)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	_, err = Lookup(context.Background(), &fakeSearcher{err: errors.New("unauthorized")}, guids[:1])
+	assert.EqualError(t, err, "unauthorized")
+}
+
+// countingSearcher counts the searches of a fakeSearcher.
+type countingSearcher struct {
+	fakeSearcher
+	calls *int
+}
+
+func (c *countingSearcher) GetEntitySearchByQueryWithContext(ctx context.Context, options entities.EntitySearchOptions, query string, sortBy []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error) {
+	*c.calls++
+	return c.fakeSearcher.GetEntitySearchByQueryWithContext(ctx, options, query, sortBy)
+}
+
+func TestFrame(t *testing.T) {
+	found, err := Search(context.Background(), &fakeSearcher{entities: testOutlines()}, "name LIKE 'a'")
+	require.NoError(t, err)
+
+	frame := Frame(found)
+	assert.Equal(t, FrameName, frame.Name)
+	assert.Equal(t, data.VisType(data.VisTypeTable), frame.Meta.PreferredVisualization)
+	require.Equal(t, 2, frame.Rows())
+
+	var names []string
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"name", "guid", "type", "domain", "accountId", "reporting", "alertSeverity", "tags"}, names)
+	assert.Equal(t, "env=prod, env=eu, team=payments", frame.Fields[7].At(0))
+	assert.Equal(t, "", frame.Fields[7].At(1))
+	assert.Equal(t, int64(1), frame.Fields[4].At(0))
+}
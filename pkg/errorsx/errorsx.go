@@ -0,0 +1,216 @@
+// Package errorsx translates errors returned by NerdGraph and NRDB into errors
+// users can act on. Each error is classified by kind, given a user-friendly
+// message and attributed to its source, so that failures caused by New Relic or
+// by the user's query are reported as downstream errors and do not count
+// against the plugin's own error rate.
+package errorsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/quota"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	nrerrors "github.com/newrelic/newrelic-client-go/v2/pkg/errors"
+)
+
+// Kind classifies a translated error.
+type Kind string
+
+const (
+	KindAuth        Kind = "auth"        // The API key was rejected
+	KindForbidden   Kind = "forbidden"   // The key cannot access the account or feature
+	KindRateLimit   Kind = "rateLimit"   // New Relic or the query budget throttled the request
+	KindSyntax      Kind = "syntax"      // NRQL syntax error
+	KindTimeout     Kind = "timeout"     // The query or request timed out
+	KindCanceled    Kind = "canceled"    // The request was canceled by the caller
+	KindUnavailable Kind = "unavailable" // New Relic returned a server error or could not be reached
+	KindDownstream  Kind = "downstream"  // Any other error returned by New Relic
+	KindPlugin      Kind = "plugin"      // An error in the plugin itself
+)
+
+// messages are the user-facing messages for each kind.
+var messages = map[Kind]string{
+	KindAuth:        "New Relic rejected the API key; check that it is a valid User API key",
+	KindForbidden:   "the API key does not have access to this account or feature",
+	KindRateLimit:   "New Relic rate limit reached; reduce the dashboard refresh rate or try again later",
+	KindSyntax:      "NRQL syntax error",
+	KindTimeout:     "the query timed out; narrow the time range or simplify the query",
+	KindCanceled:    "the query was canceled",
+	KindUnavailable: "New Relic API is unavailable; try again later",
+	KindDownstream:  "New Relic API error",
+	KindPlugin:      "internal plugin error",
+}
+
+// statuses are the response statuses for each kind.
+var statuses = map[Kind]backend.Status{
+	KindAuth:        backend.StatusUnauthorized,
+	KindForbidden:   backend.StatusForbidden,
+	KindRateLimit:   backend.StatusTooManyRequests,
+	KindSyntax:      backend.StatusBadRequest,
+	KindTimeout:     backend.StatusTimeout,
+	KindCanceled:    backend.StatusTimeout,
+	KindUnavailable: backend.StatusBadGateway,
+	KindDownstream:  backend.StatusBadGateway,
+	KindPlugin:      backend.StatusInternal,
+}
+
+// Error is an error translated for display to users.
+type Error struct {
+	Kind Kind
+	Msg  string // User-facing message
+	Err  error  // Wrapped error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+	}
+	return e.Msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Source returns the error source: plugin for plugin errors and downstream for
+// all other kinds.
+func (e *Error) Source() backend.ErrorSource {
+	if e.Kind == KindPlugin {
+		return backend.ErrorSourcePlugin
+	}
+	return backend.ErrorSourceDownstream
+}
+
+// Status returns the response status for the error.
+func (e *Error) Status() backend.Status {
+	return statuses[e.Kind]
+}
+
+// Classify returns the kind of err. Errors that New Relic returns without a
+// typed error, such as GraphQL errors, are classified by their message.
+func Classify(err error) Kind {
+	var (
+		unauthorized *nrerrors.UnauthorizedError
+		payment      *nrerrors.PaymentRequiredError
+		status       *nrerrors.UnexpectedStatusCode
+		retries      *nrerrors.MaxRetriesReached
+		exceeded     *quota.ExceededError
+		netErr       net.Error
+	)
+	switch {
+	case errors.As(err, &unauthorized):
+		return KindAuth
+	case errors.As(err, &payment):
+		return KindForbidden
+	case errors.As(err, &exceeded):
+		return KindRateLimit
+	case errors.Is(err, context.DeadlineExceeded):
+		return KindTimeout
+	case errors.Is(err, context.Canceled):
+		return KindCanceled
+	case errors.As(err, &status):
+		return classifyStatus(status.Error())
+	case errors.As(err, &retries):
+		if kind := classifyMessage(retries.Error()); kind != KindDownstream {
+			return kind
+		}
+		return KindUnavailable
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return KindTimeout
+		}
+		return KindUnavailable
+	}
+	return classifyMessage(err.Error())
+}
+
+// classifyStatus classifies an UnexpectedStatusCode error by the status code
+// at the start of its message ("%d response returned: ...").
+func classifyStatus(msg string) Kind {
+	code, _, _ := strings.Cut(msg, " ")
+	switch n, _ := strconv.Atoi(code); {
+	case n == 401:
+		return KindAuth
+	case n == 403:
+		return KindForbidden
+	case n == 429:
+		return KindRateLimit
+	case n == 408 || n == 504:
+		return KindTimeout
+	case n >= 500:
+		return KindUnavailable
+	}
+	return classifyMessage(msg)
+}
+
+// messagePatterns classify errors by their message, in order. They match whole
+// words or status codes only, so that account IDs such as 4290311 or NRQL
+// functions such as timeoutCount() do not classify an error.
+var messagePatterns = []struct {
+	pattern *regexp.Regexp
+	kind    Kind
+}{
+	{regexp.MustCompile(`\bsyntax error\b`), KindSyntax},
+	{regexp.MustCompile(`\brate limit|\btoo many requests\b|\b(?:status|code|http)[ :=]*429\b`), KindRateLimit},
+	{regexp.MustCompile(`\b(?:timeout|timed out)\b`), KindTimeout},
+	{regexp.MustCompile(`\binvalid api key\b|\bunauthorized\b`), KindAuth},
+	{regexp.MustCompile(`\bforbidden\b|\baccess denied\b`), KindForbidden},
+	{regexp.MustCompile(`\b(?:internal_)?server_error\b|\bservice unavailable\b`), KindUnavailable},
+}
+
+// classifyMessage classifies an error by its message, returning KindDownstream
+// when nothing matches.
+func classifyMessage(msg string) Kind {
+	lower := strings.ToLower(msg)
+	for _, p := range messagePatterns {
+		if p.pattern.MatchString(lower) {
+			return p.kind
+		}
+	}
+	return KindDownstream
+}
+
+// Translate returns err as an *Error with the user-facing message for its kind.
+// Errors that are already translated are returned unchanged.
+func Translate(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var translated *Error
+	if errors.As(err, &translated) {
+		return translated
+	}
+	kind := Classify(err)
+	return &Error{Kind: kind, Msg: messages[kind], Err: err}
+}
+
+// Plugin returns err as an *Error attributed to the plugin.
+func Plugin(err error) *Error {
+	return &Error{Kind: KindPlugin, Msg: messages[KindPlugin], Err: err}
+}
+
+// Message returns the user-facing message for err without the wrapped error.
+func Message(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Translate(err).Msg
+}
+
+// Response returns a DataResponse for err with the status and error source of
+// its kind.
+func Response(err error) *backend.DataResponse {
+	translated := Translate(err)
+	return &backend.DataResponse{
+		Error:       translated,
+		Status:      translated.Status(),
+		ErrorSource: translated.Source(),
+	}
+}
@@ -0,0 +1,82 @@
+package errorsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/quota"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	nrerrors "github.com/newrelic/newrelic-client-go/v2/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"unauthorized", nrerrors.NewUnauthorizedError(), KindAuth},
+		{"wrapped unauthorized", fmt.Errorf("query failed: %w", nrerrors.NewUnauthorizedError()), KindAuth},
+		{"payment required", nrerrors.NewPaymentRequiredError(), KindForbidden},
+		{"status 403", nrerrors.NewUnexpectedStatusCode(403, "Forbidden"), KindForbidden},
+		{"status 429", nrerrors.NewUnexpectedStatusCode(429, "Too Many Requests"), KindRateLimit},
+		{"status 504", nrerrors.NewUnexpectedStatusCode(504, "Gateway Timeout"), KindTimeout},
+		{"status 503", nrerrors.NewUnexpectedStatusCode(503, "Service Unavailable"), KindUnavailable},
+		{"status 400", nrerrors.NewUnexpectedStatusCode(400, "Bad Request"), KindDownstream},
+		{"max retries", nrerrors.NewMaxRetriesReached("giving up after 3 attempts"), KindUnavailable},
+		{"max retries rate limited", nrerrors.NewMaxRetriesReached("429 Too Many Requests"), KindRateLimit},
+		{"query budget", &quota.ExceededError{Usage: quota.Usage{AccountID: 1, Calls: 11, Window: time.Minute, HardLimit: 10}}, KindRateLimit},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), KindTimeout},
+		{"canceled", context.Canceled, KindCanceled},
+		{"syntax error", errors.New("NRQL Syntax Error: Error at line 1 position 8, unexpected 'FORM'"), KindSyntax},
+		{"graphql timeout", errors.New("NRDB query timeout: Your query took too long"), KindTimeout},
+		{"rate limit status", errors.New("NerdGraph returned status 429"), KindRateLimit},
+		{"unauthorized message", errors.New("401 Unauthorized"), KindAuth},
+		{"account ID containing 429", errors.New("account 4290311 not found"), KindDownstream},
+		{"function named timeout", errors.New("Unknown function timeoutCount()"), KindDownstream},
+		{"attribute named unauthorized", errors.New("Unknown attribute unauthorizedCount"), KindDownstream},
+		{"other", errors.New("Unknown account"), KindDownstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Classify(tt.err))
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	assert.Nil(t, Translate(nil))
+
+	err := errors.New("NRQL Syntax Error: unexpected 'FORM'")
+	translated := Translate(err)
+	require.NotNil(t, translated)
+	assert.Equal(t, KindSyntax, translated.Kind)
+	assert.Equal(t, "NRQL syntax error: NRQL Syntax Error: unexpected 'FORM'", translated.Error())
+	assert.ErrorIs(t, translated, err)
+	assert.Same(t, translated, Translate(fmt.Errorf("wrapped: %w", translated)))
+
+	assert.Equal(t, "the query was canceled", Message(context.Canceled))
+	assert.Empty(t, Message(nil))
+}
+
+func TestResponse(t *testing.T) {
+	resp := Response(nrerrors.NewUnauthorizedError())
+	assert.Equal(t, backend.StatusUnauthorized, resp.Status)
+	assert.Equal(t, backend.ErrorSourceDownstream, resp.ErrorSource)
+	assert.Contains(t, resp.Error.Error(), "New Relic rejected the API key")
+
+	resp = Response(nrerrors.NewUnexpectedStatusCode(429, "Too Many Requests"))
+	assert.Equal(t, backend.StatusTooManyRequests, resp.Status)
+	assert.Equal(t, backend.ErrorSourceDownstream, resp.ErrorSource)
+
+	resp = Response(Plugin(errors.New("unexpected result type")))
+	assert.Equal(t, backend.StatusInternal, resp.Status)
+	assert.Equal(t, backend.ErrorSourcePlugin, resp.ErrorSource)
+}
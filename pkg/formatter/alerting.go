@@ -0,0 +1,94 @@
+package formatter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental"
+)
+
+// timeSeriesTypeVersion is the data plane contract version of the time series frames.
+var timeSeriesTypeVersion = data.FrameTypeVersion{0, 1}
+
+// queryEndTime returns the end of the query time range. Values that NRDB aggregates
+// over the whole range, such as a non-TIMESERIES count, are stamped with it so alert
+// rules evaluate them at the time the query asked about. Without a time range it
+// falls back to now.
+func queryEndTime(query backend.DataQuery) time.Time {
+	if query.TimeRange.To.IsZero() {
+		return time.Now()
+	}
+	return query.TimeRange.To
+}
+
+// queryStartTime returns the start of the query time range, or one hour before
+// queryEndTime when the query has no time range.
+func queryStartTime(query backend.DataQuery) time.Time {
+	if query.TimeRange.From.IsZero() || !query.TimeRange.From.Before(queryEndTime(query)) {
+		return queryEndTime(query).Add(-time.Hour)
+	}
+	return query.TimeRange.From
+}
+
+// markTimeSeriesFrames makes the time series frames in resp follow the data plane
+// contract that Grafana alerting relies on: rows are sorted by ascending time and
+// the frame type is set, timeseries-multi for a single value field and
+// timeseries-wide otherwise. Frames with string fields, a nullable time field or
+// non-numeric values are left as they are.
+func markTimeSeriesFrames(resp *backend.DataResponse) *backend.DataResponse {
+	if resp == nil {
+		return resp
+	}
+	for _, frame := range resp.Frames {
+		schema := frame.TimeSeriesSchema()
+		if schema.Type != data.TimeSeriesTypeWide || schema.TimeIsNullable || !numericFields(frame, schema.ValueIndices) {
+			continue
+		}
+		sorter := experimental.NewFrameSorter(frame, frame.Fields[schema.TimeIndex])
+		if !sort.IsSorted(sorter) {
+			sort.Stable(sorter)
+		}
+
+		frameType := data.FrameTypeTimeSeriesWide
+		if len(schema.ValueIndices) == 1 {
+			frameType = data.FrameTypeTimeSeriesMulti
+		}
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Type = frameType
+		frame.Meta.TypeVersion = timeSeriesTypeVersion
+	}
+	return resp
+}
+
+// numericFields reports whether the fields at indices all hold numbers.
+func numericFields(frame *data.Frame, indices []int) bool {
+	for _, i := range indices {
+		if !frame.Fields[i].Type().Numeric() {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepTimeSeriesFrames drops the frames of resp that are not time series, such as
+// the table frame next to a count series. Alert rule evaluation rejects responses
+// that mix tables with series. A response without any time series frame is left
+// untouched.
+func KeepTimeSeriesFrames(resp *backend.DataResponse) {
+	if resp == nil {
+		return
+	}
+	var series data.Frames
+	for _, frame := range resp.Frames {
+		if frame.Meta != nil && frame.Meta.Type.IsTimeSeries() {
+			series = append(series, frame)
+		}
+	}
+	if len(series) > 0 {
+		resp.Frames = series
+	}
+}
@@ -0,0 +1,177 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireTimeSeriesContract checks the data plane time series contract that
+// Grafana alerting relies on, after round-tripping the frame through Arrow and JSON
+// like the plugin protocol and the frontend do.
+func requireTimeSeriesContract(t *testing.T, frame *data.Frame) {
+	t.Helper()
+
+	encoded, err := frame.MarshalArrow()
+	require.NoError(t, err)
+	decoded, err := data.UnmarshalArrowFrame(encoded)
+	require.NoError(t, err)
+
+	jsonEncoded, err := decoded.MarshalJSON()
+	require.NoError(t, err)
+	roundTripped := &data.Frame{}
+	require.NoError(t, roundTripped.UnmarshalJSON(jsonEncoded))
+
+	for _, f := range []*data.Frame{decoded, roundTripped} {
+		require.NotNil(t, f.Meta, "frame %q has no metadata", f.Name)
+		assert.True(t, f.Meta.Type.IsTimeSeries(), "frame %q has type %q", f.Name, f.Meta.Type)
+		assert.Equal(t, timeSeriesTypeVersion, f.Meta.TypeVersion)
+
+		schema := f.TimeSeriesSchema()
+		require.Equal(t, data.TimeSeriesTypeWide, schema.Type)
+		assert.False(t, schema.TimeIsNullable)
+		if f.Meta.Type == data.FrameTypeTimeSeriesMulti {
+			assert.Len(t, schema.ValueIndices, 1)
+		}
+		for _, i := range schema.ValueIndices {
+			assert.True(t, f.Fields[i].Type().Numeric(), "field %q is %s", f.Fields[i].Name, f.Fields[i].Type())
+		}
+
+		timeField := f.Fields[schema.TimeIndex]
+		for i := 1; i < timeField.Len(); i++ {
+			prev := timeField.At(i - 1).(time.Time)
+			cur := timeField.At(i).(time.Time)
+			assert.False(t, cur.Before(prev), "time field not sorted at row %d", i)
+		}
+	}
+}
+
+func TestFormatQueryResults_AlertingContract(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	query := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: to}}
+
+	t.Run("simple count spans the query time range", func(t *testing.T) {
+		resp := FormatQueryResults(&nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{{"count": float64(42)}},
+		}, query)
+
+		require.Len(t, resp.Frames, 2)
+		assert.False(t, resp.Frames[0].Meta.Type.IsTimeSeries(), "the table frame is not a time series")
+		graph := resp.Frames[1]
+		requireTimeSeriesContract(t, graph)
+		assert.Equal(t, data.FrameTypeTimeSeriesMulti, graph.Meta.Type)
+		assert.Equal(t, from, graph.Fields[0].At(0))
+		assert.Equal(t, to, graph.Fields[0].At(1))
+	})
+
+	t.Run("faceted count uses the end of the query time range", func(t *testing.T) {
+		resp := FormatQueryResults(&nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"count": float64(10), "facet": "web", "appName": "web"},
+				{"count": float64(5), "facet": "worker", "appName": "worker"},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		}, query)
+
+		require.Len(t, resp.Frames, 2)
+		for _, frame := range resp.Frames {
+			requireTimeSeriesContract(t, frame)
+			assert.Equal(t, to, frame.Fields[0].At(0))
+		}
+	})
+
+	t.Run("faceted timeseries rows are sorted by time", func(t *testing.T) {
+		resp := FormatQueryResults(&nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"beginTimeSeconds": float64(1714557660), "endTimeSeconds": float64(1714557720), "facet": "web", "average.duration": float64(2)},
+				{"beginTimeSeconds": float64(1714557600), "endTimeSeconds": float64(1714557660), "facet": "web", "average.duration": float64(1)},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		}, query)
+
+		require.Len(t, resp.Frames, 1)
+		frame := resp.Frames[0]
+		requireTimeSeriesContract(t, frame)
+		assert.Equal(t, data.FrameTypeTimeSeriesMulti, frame.Meta.Type)
+		value, ok := frame.Fields[1].ConcreteAt(0)
+		require.True(t, ok)
+		assert.Equal(t, float64(1), value)
+	})
+
+	t.Run("timeseries with several aggregates is wide", func(t *testing.T) {
+		resp := FormatQueryResults(&nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"beginTimeSeconds": float64(1714557600), "endTimeSeconds": float64(1714557660), "average.duration": float64(1), "max.duration": float64(3)},
+				{"beginTimeSeconds": float64(1714557660), "endTimeSeconds": float64(1714557720), "average.duration": float64(2), "max.duration": float64(4)},
+			},
+		}, query)
+
+		require.Len(t, resp.Frames, 1)
+		requireTimeSeriesContract(t, resp.Frames[0])
+		assert.Equal(t, data.FrameTypeTimeSeriesWide, resp.Frames[0].Meta.Type)
+	})
+
+	t.Run("aggregate without timeseries uses the end of the query time range", func(t *testing.T) {
+		resp := FormatQueryResults(&nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{{"average.duration": float64(1.5)}},
+		}, query)
+
+		require.Len(t, resp.Frames, 1)
+		requireTimeSeriesContract(t, resp.Frames[0])
+		assert.Equal(t, to, resp.Frames[0].Fields[0].At(0))
+	})
+
+	t.Run("multi result faceted timeseries", func(t *testing.T) {
+		resp := FormatFacetedTimeseriesResults(&nrdb.NRDBResultContainerMultiResultCustomized{
+			OtherResult: []nrdb.NRDBResult{
+				{"beginTimeSeconds": float64(1714557660), "endTimeSeconds": float64(1714557720), "facet": "web", "count": float64(7)},
+				{"beginTimeSeconds": float64(1714557600), "endTimeSeconds": float64(1714557660), "facet": "web", "count": float64(3)},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		}, query)
+
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 1)
+		requireTimeSeriesContract(t, resp.Frames[0])
+	})
+
+	t.Run("event rows are not marked as time series", func(t *testing.T) {
+		resp := FormatQueryResults(&nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{utils.TimestampFieldName: float64(1714557600000), "name": "checkout", "duration": float64(1)},
+			},
+		}, query)
+
+		require.Len(t, resp.Frames, 1)
+		if resp.Frames[0].Meta != nil {
+			assert.Equal(t, data.FrameTypeUnknown, resp.Frames[0].Meta.Type)
+		}
+	})
+}
+
+func TestKeepTimeSeriesFrames(t *testing.T) {
+	series := data.NewFrame("series",
+		data.NewField("time", nil, []time.Time{time.Unix(0, 0)}),
+		data.NewField("count", nil, []float64{1}),
+	)
+	series.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesMulti}
+	table := data.NewFrame("count", data.NewField("count", nil, []float64{1}))
+
+	resp := &backend.DataResponse{Frames: data.Frames{table, series}}
+	KeepTimeSeriesFrames(resp)
+	assert.Equal(t, data.Frames{series}, resp.Frames)
+
+	tableOnly := &backend.DataResponse{Frames: data.Frames{table}}
+	KeepTimeSeriesFrames(tableOnly)
+	assert.Equal(t, data.Frames{table}, tableOnly.Frames)
+
+	KeepTimeSeriesFrames(nil)
+}
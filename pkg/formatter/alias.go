@@ -0,0 +1,78 @@
+package formatter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// aliasTokenPattern matches the placeholders of an alias pattern: {{name}} with
+// optional spaces inside the braces, $__field and $__facet.
+var aliasTokenPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}|\$__(field|facet)\b`)
+
+// ApplyAlias sets the display name of the value fields of the time series frames
+// in resp from alias, a pattern whose placeholders are replaced per field:
+//
+//   - {{field}} or $__field: the field name, e.g. average.duration
+//   - {{facet}} or $__facet: the label values of the series, ordered by label name
+//   - {{name}}: the value of the series label name, e.g. {{host}}
+//
+// Placeholders for labels the series does not have are replaced with nothing.
+// An empty alias leaves the frames unchanged.
+func ApplyAlias(resp *backend.DataResponse, alias string) {
+	if resp == nil || strings.TrimSpace(alias) == "" {
+		return
+	}
+	for _, frame := range resp.Frames {
+		if timeFieldIndex(frame) < 0 {
+			continue
+		}
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() {
+				continue
+			}
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			field.Config.DisplayNameFromDS = aliasName(alias, field)
+		}
+	}
+}
+
+// aliasName returns alias with its placeholders replaced for field.
+func aliasName(alias string, field *data.Field) string {
+	return aliasTokenPattern.ReplaceAllStringFunc(alias, func(token string) string {
+		match := aliasTokenPattern.FindStringSubmatch(token)
+		name := match[1]
+		if name == "" {
+			name = match[2]
+		}
+		switch name {
+		case "field":
+			return field.Name
+		case "facet":
+			return facetValue(field.Labels)
+		default:
+			return field.Labels[name]
+		}
+	})
+}
+
+// facetValue returns the label values of a series joined with ", ", ordered by
+// label name.
+func facetValue(labels data.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = labels[name]
+	}
+	return strings.Join(values, ", ")
+}
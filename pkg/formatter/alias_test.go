@@ -0,0 +1,54 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyAlias(t *testing.T) {
+	newResponse := func() *backend.DataResponse {
+		series := data.NewFrame("checkout, web-1",
+			data.NewField("time", nil, []time.Time{time.Unix(0, 0)}),
+			data.NewField("average.duration", data.Labels{"appName": "checkout", "host": "web-1"}, []float64{1}),
+			data.NewField("host", nil, []string{"web-1"}),
+		)
+		table := data.NewFrame("table", data.NewField("count", nil, []float64{3}))
+		return &backend.DataResponse{Frames: data.Frames{series, table}}
+	}
+
+	tests := []struct {
+		name  string
+		alias string
+		want  string
+	}{
+		{name: "facet and field", alias: "{{facet}} - {{field}}", want: "checkout, web-1 - average.duration"},
+		{name: "labels", alias: "{{ host }} ({{appName}})", want: "web-1 (checkout)"},
+		{name: "dollar placeholders", alias: "$__facet: $__field", want: "checkout, web-1: average.duration"},
+		{name: "missing label", alias: "{{region}}latency", want: "latency"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := newResponse()
+			ApplyAlias(resp, tt.alias)
+
+			value := resp.Frames[0].Fields[1]
+			require.NotNil(t, value.Config)
+			assert.Equal(t, tt.want, value.Config.DisplayNameFromDS)
+			// Time, string and table fields keep their names
+			assert.Nil(t, resp.Frames[0].Fields[0].Config)
+			assert.Nil(t, resp.Frames[0].Fields[2].Config)
+			assert.Nil(t, resp.Frames[1].Fields[0].Config)
+		})
+	}
+
+	t.Run("empty alias", func(t *testing.T) {
+		resp := newResponse()
+		ApplyAlias(resp, " ")
+		assert.Nil(t, resp.Frames[0].Fields[1].Config)
+	})
+}
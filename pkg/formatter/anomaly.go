@@ -0,0 +1,129 @@
+package formatter
+
+import (
+	"math"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// DefaultBaselineWindow is the number of points of the rolling baseline of
+// anomaly bands when a query does not set one.
+const DefaultBaselineWindow = 12
+
+// Suffixes of the display names of the fields added by ApplyAnomalyBands
+const (
+	baselineSuffix = " baseline"
+	upperSuffix    = " upper"
+	lowerSuffix    = " lower"
+)
+
+// ApplyAnomalyBands adds a rolling baseline and a band of stddevs standard
+// deviations around it to every numeric series of the time series frames of
+// resp, so panels show anomalies without transformations. The baseline at a
+// point is the mean of the window points before it, so a spike does not raise
+// its own baseline; points with fewer than two earlier values have no band.
+// The band's upper field fills down to its lower field. It returns the number
+// of series that got a band. A stddevs of 0 leaves the frames unchanged.
+func ApplyAnomalyBands(resp *backend.DataResponse, stddevs float64, window int) int {
+	if resp == nil || resp.Error != nil || stddevs <= 0 {
+		return 0
+	}
+	if window <= 0 {
+		window = DefaultBaselineWindow
+	}
+	banded := 0
+	for _, frame := range resp.Frames {
+		// A band starts at the third point, so shorter frames such as simple counts get none
+		if timeFieldIndex(frame) < 0 || frame.Rows() < 3 || (frame.Meta != nil && frame.Meta.PreferredVisualization == data.VisTypeTable) {
+			continue
+		}
+		var bands []*data.Field
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() {
+				continue
+			}
+			bands = append(bands, anomalyBandFields(field, stddevs, window)...)
+			banded++
+		}
+		frame.Fields = append(frame.Fields, bands...)
+	}
+	return banded
+}
+
+// anomalyBandFields returns the baseline, upper and lower fields of a series.
+func anomalyBandFields(field *data.Field, stddevs float64, window int) []*data.Field {
+	rows := field.Len()
+	baseline := make([]*float64, rows)
+	upper := make([]*float64, rows)
+	lower := make([]*float64, rows)
+
+	var previous []float64
+	for i := 0; i < rows; i++ {
+		if len(previous) >= 2 {
+			mean, deviation := meanAndStddev(previous)
+			baseline[i] = floatPtr(mean)
+			upper[i] = floatPtr(mean + stddevs*deviation)
+			lower[i] = floatPtr(mean - stddevs*deviation)
+		}
+		if value, err := field.NullableFloatAt(i); err == nil && value != nil && !math.IsNaN(*value) {
+			previous = append(previous, *value)
+			if len(previous) > window {
+				previous = previous[1:]
+			}
+		}
+	}
+
+	name := seriesDisplayName(field)
+	unit := ""
+	if field.Config != nil {
+		unit = field.Config.Unit
+	}
+	bandField := func(values []*float64, suffix string, custom map[string]interface{}) *data.Field {
+		band := data.NewField(field.Name+suffix, field.Labels, values)
+		band.Config = &data.FieldConfig{DisplayNameFromDS: name + suffix, Unit: unit, Custom: custom}
+		return band
+	}
+	return []*data.Field{
+		bandField(baseline, baselineSuffix, map[string]interface{}{
+			"lineStyle": map[string]interface{}{"fill": "dash", "dash": []int{10, 10}},
+		}),
+		bandField(upper, upperSuffix, map[string]interface{}{
+			"fillBelowTo": name + lowerSuffix,
+			"fillOpacity": 15,
+			"lineWidth":   0,
+		}),
+		bandField(lower, lowerSuffix, map[string]interface{}{
+			"lineWidth": 0,
+			"hideFrom":  map[string]interface{}{"legend": true, "tooltip": false, "viz": false},
+		}),
+	}
+}
+
+// seriesDisplayName returns the name a series is shown with: its display name
+// from an alias, or its label values and field name.
+func seriesDisplayName(field *data.Field) string {
+	if field.Config != nil && field.Config.DisplayNameFromDS != "" {
+		return field.Config.DisplayNameFromDS
+	}
+	return strings.TrimSpace(facetValue(field.Labels) + " " + field.Name)
+}
+
+// meanAndStddev returns the mean and the population standard deviation of values.
+func meanAndStddev(values []float64) (float64, float64) {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,55 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyAnomalyBands(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	times := []time.Time{at, at.Add(time.Minute), at.Add(2 * time.Minute), at.Add(3 * time.Minute), at.Add(4 * time.Minute)}
+	value := data.NewField("count", data.Labels{"appName": "checkout"}, []*float64{ptrFloat(1), ptrFloat(3), nil, ptrFloat(5), ptrFloat(100)})
+	value.Config = &data.FieldConfig{Unit: "short"}
+	series := data.NewFrame("checkout", data.NewField("time", nil, times), value)
+	table := data.NewFrame("table", data.NewField("count", nil, []float64{3}))
+	resp := &backend.DataResponse{Frames: data.Frames{series, table}}
+
+	assert.Equal(t, 1, ApplyAnomalyBands(resp, 2, 2))
+	require.Len(t, series.Fields, 5)
+	assert.Len(t, table.Fields, 1, "frames without time are left unchanged")
+
+	baseline, upper, lower := series.Fields[2], series.Fields[3], series.Fields[4]
+	assert.Equal(t, data.Labels{"appName": "checkout"}, baseline.Labels)
+	assert.Equal(t, "checkout count baseline", baseline.Config.DisplayNameFromDS)
+	assert.Equal(t, "short", upper.Config.Unit)
+	assert.Equal(t, "checkout count lower", upper.Config.Custom["fillBelowTo"])
+
+	// No band until two earlier values; nulls are skipped; a window of 2 points
+	want := []*float64{nil, nil, ptrFloat(2), ptrFloat(2), ptrFloat(4)}
+	for i, w := range want {
+		got, ok := baseline.ConcreteAt(i)
+		if w == nil {
+			assert.False(t, ok, "row %d", i)
+			continue
+		}
+		assert.Equal(t, *w, got, "row %d", i)
+	}
+	upperValue, _ := upper.ConcreteAt(4)
+	lowerValue, _ := lower.ConcreteAt(4)
+	assert.Equal(t, 6.0, upperValue, "two standard deviations above the baseline")
+	assert.Equal(t, 2.0, lowerValue)
+
+	// Aliased series keep their display name
+	value.Config.DisplayNameFromDS = "Checkout"
+	series.Fields = series.Fields[:2]
+	ApplyAnomalyBands(resp, 2, 0)
+	assert.Equal(t, "Checkout upper", series.Fields[3].Config.DisplayNameFromDS)
+
+	assert.Zero(t, ApplyAnomalyBands(resp, 0, 0))
+	assert.Zero(t, ApplyAnomalyBands(&backend.DataResponse{Frames: data.Frames{table}}, 2, 0))
+}
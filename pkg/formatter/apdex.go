@@ -0,0 +1,98 @@
+package formatter
+
+import (
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// apdexComponents are the components of an apdex() result, in field order.
+var apdexComponents = []string{"score", "satisfied", "tolerating", "frustrated", "count"}
+
+// apdexKeys maps the keys New Relic uses in apdex() objects to their component.
+var apdexKeys = map[string]string{
+	"score":      "score",
+	"s":          "satisfied",
+	"satisfied":  "satisfied",
+	"t":          "tolerating",
+	"tolerating": "tolerating",
+	"f":          "frustrated",
+	"frustrated": "frustrated",
+	"count":      "count",
+}
+
+// isApdexObject reports whether value is an apdex() result: an object with a
+// score and at least one of the satisfied, tolerating and frustrated counts.
+func isApdexObject(value interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, ok := object["score"]; !ok {
+		return false
+	}
+	for key, component := range apdexKeys {
+		if _, ok := object[key]; ok && component != "score" && component != "count" {
+			return true
+		}
+	}
+	return false
+}
+
+// isApdexField reports whether the fieldName values of rows are apdex() results.
+// Rows without a value are ignored.
+func isApdexField(rows []nrdb.NRDBResult, fieldName string) bool {
+	found := false
+	for _, row := range rows {
+		value, ok := row[fieldName]
+		if !ok || value == nil {
+			continue
+		}
+		if !isApdexObject(value) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// apdexComponent returns the value of component in an apdex() object.
+func apdexComponent(object map[string]interface{}, component string) interface{} {
+	for key, value := range object {
+		if apdexKeys[key] == component {
+			return value
+		}
+	}
+	return nil
+}
+
+// addApdexFields adds a numeric field per apdex() component found in the
+// fieldName objects, e.g. "apdex.duration.score", with the given labels. The
+// score field is bounded to 0-1 so that gauges and thresholds scale correctly.
+func addApdexFields(frame *data.Frame, rows []nrdb.NRDBResult, fieldName string, labels data.Labels) {
+	present := make(map[string]bool)
+	for _, row := range rows {
+		if object, ok := row[fieldName].(map[string]interface{}); ok {
+			for key := range object {
+				present[apdexKeys[key]] = true
+			}
+		}
+	}
+
+	for _, component := range apdexComponents {
+		if !present[component] {
+			continue
+		}
+		field := convertNumbers(fieldName+"."+component, len(rows), func(i int) interface{} {
+			if object, ok := rows[i][fieldName].(map[string]interface{}); ok {
+				return apdexComponent(object, component)
+			}
+			return nil
+		})
+		field.Labels = labels
+		if component == "score" {
+			minScore, maxScore := data.ConfFloat64(0), data.ConfFloat64(1)
+			field.Config = &data.FieldConfig{Min: &minScore, Max: &maxScore}
+		}
+		frame.Fields = append(frame.Fields, field)
+	}
+}
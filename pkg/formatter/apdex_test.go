@@ -0,0 +1,88 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsApdexObject(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{name: "short keys", value: map[string]interface{}{"score": 0.9, "s": 9.0, "t": 1.0, "f": 0.0, "count": 10.0}, want: true},
+		{name: "long keys", value: map[string]interface{}{"score": 0.9, "satisfied": 9.0}, want: true},
+		{name: "percentile object", value: map[string]interface{}{"95": 1.2}, want: false},
+		{name: "score only", value: map[string]interface{}{"score": 0.9}, want: false},
+		{name: "number", value: 0.9, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isApdexObject(tt.value))
+		})
+	}
+}
+
+func TestDetectFieldType_Apdex(t *testing.T) {
+	rows := []nrdb.NRDBResult{
+		{"apdex.duration": map[string]interface{}{"score": 0.9, "s": 9.0, "t": 1.0, "f": 0.0, "count": 10.0}},
+		{},
+	}
+	assert.Equal(t, "apdex", detectFieldType(rows, "apdex.duration", nil))
+
+	rows = append(rows, nrdb.NRDBResult{"apdex.duration": map[string]interface{}{"other": 1.0}})
+	assert.NotEqual(t, "apdex", detectFieldType(rows, "apdex.duration", nil))
+}
+
+func TestFormatQueryResults_Apdex(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"apdex.duration": map[string]interface{}{"score": 0.75, "s": 6.0, "t": 2.0, "f": 1.0, "count": 9.0}, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+			{"apdex.duration": map[string]interface{}{"score": 1.0, "s": 3.0, "t": 0.0, "f": 0.0, "count": 3.0}, "beginTimeSeconds": 1700000060.0, "endTimeSeconds": 1700000120.0},
+		},
+	}
+
+	resp := FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+
+	assert.Equal(t, []string{
+		"time",
+		"apdex.duration.score",
+		"apdex.duration.satisfied",
+		"apdex.duration.tolerating",
+		"apdex.duration.frustrated",
+		"apdex.duration.count",
+	}, fieldNames(frame))
+
+	score, _ := frame.Fields[1].FloatAt(0)
+	assert.Equal(t, 0.75, score)
+	frustrated, _ := frame.Fields[4].FloatAt(0)
+	assert.Equal(t, 1.0, frustrated)
+	require.NotNil(t, frame.Fields[1].Config)
+	assert.Equal(t, data.ConfFloat64(1), *frame.Fields[1].Config.Max)
+	assert.Equal(t, data.FrameTypeTimeSeriesWide, frame.Meta.Type)
+}
+
+func TestFormatQueryResults_FacetedApdex(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": "checkout", "apdex.duration": map[string]interface{}{"score": 0.5, "s": 1.0, "t": 0.0, "f": 1.0}, "beginTimeSeconds": 1700000000.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+
+	resp := FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	require.Len(t, frame.Fields, 5) // time, score, satisfied, tolerating and frustrated
+	assert.Equal(t, "apdex.duration.score", frame.Fields[1].Name)
+	assert.Equal(t, data.Labels{"appName": "checkout"}, frame.Fields[1].Labels)
+}
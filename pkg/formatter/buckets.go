@@ -0,0 +1,213 @@
+package formatter
+
+import (
+	"sort"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// maxFilledBuckets caps the number of buckets a series is filled to, so that a
+// narrow bucket over a wide time range cannot blow up the response.
+const maxFilledBuckets = 10000
+
+// bucketWidth returns the TIMESERIES bucket width of the rows from the
+// beginTimeSeconds and endTimeSeconds of the first row that has both, falling
+// back to the most common gap between bucket starts. It returns 0 for rows that
+// are not TIMESERIES buckets.
+func bucketWidth(rows []nrdb.NRDBResult) time.Duration {
+	var starts []time.Time
+	for _, row := range rows {
+		begin, ok := row["beginTimeSeconds"].(float64)
+		if !ok {
+			continue
+		}
+		if end, ok := row["endTimeSeconds"].(float64); ok && end > begin {
+			return time.Duration((end - begin) * float64(time.Second))
+		}
+		starts = append(starts, timeutil.FromEpochSeconds(begin))
+	}
+	return timeutil.InferBucketWidth(starts)
+}
+
+// alignTimeseriesBuckets sets the bucket width of the TIMESERIES rows as the
+// interval of the time field of every frame in resp, and fills the buckets that
+// New Relic omitted with nulls. Buckets are filled across the query time range,
+// or between the first and last bucket of the response when there is none, so
+// that Grafana neither interpolates over gaps nor misaligns bars, and every
+// series of a faceted query has the same buckets. With a fillMode of
+// models.FillModeZero or models.FillModePrevious the null values are then
+// replaced. Frames with non-numeric value fields only get the interval.
+func alignTimeseriesBuckets(resp *backend.DataResponse, rows []nrdb.NRDBResult, query backend.DataQuery, fillMode string) *backend.DataResponse {
+	if resp == nil || len(resp.Frames) == 0 {
+		return resp
+	}
+	width := bucketWidth(rows)
+	if width <= 0 {
+		return resp
+	}
+
+	grid := bucketGrid(resp.Frames, width, query)
+	for _, frame := range resp.Frames {
+		timeIndex := timeFieldIndex(frame)
+		if timeIndex < 0 {
+			continue
+		}
+		timeField := frame.Fields[timeIndex]
+		if timeField.Config == nil {
+			timeField.Config = &data.FieldConfig{}
+		}
+		timeField.Config.Interval = float64(width.Milliseconds())
+
+		if timeField.Nullable() || !numericValueFields(frame, timeIndex) {
+			continue
+		}
+		if len(grid) > 0 && timeField.Len() < len(grid) {
+			fillBuckets(frame, timeIndex, grid)
+		}
+		if fillMode == models.FillModeZero || fillMode == models.FillModePrevious {
+			fillNulls(frame, timeIndex, fillMode)
+		}
+	}
+	return resp
+}
+
+// bucketGrid returns the bucket start times to fill the frames to: every width
+// from the earliest bucket of the frames, extended back to the start and forward
+// to the end of the query time range. It returns nil when the grid would exceed
+// maxFilledBuckets or the frames have no buckets.
+func bucketGrid(frames data.Frames, width time.Duration, query backend.DataQuery) []time.Time {
+	var first, last time.Time
+	for _, frame := range frames {
+		timeIndex := timeFieldIndex(frame)
+		if timeIndex < 0 {
+			continue
+		}
+		for i := 0; i < frame.Fields[timeIndex].Len(); i++ {
+			t, ok := frame.Fields[timeIndex].ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			if ts := t.(time.Time); first.IsZero() || ts.Before(first) {
+				first = ts
+			}
+			if ts := t.(time.Time); ts.After(last) {
+				last = ts
+			}
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+
+	if !query.TimeRange.From.IsZero() && !query.TimeRange.To.IsZero() {
+		if before := first.Sub(query.TimeRange.From) / width; before > 0 {
+			first = first.Add(-before * width)
+		}
+		if after := (query.TimeRange.To.Sub(last) - 1) / width; after > 0 {
+			last = last.Add(after * width)
+		}
+	}
+	if int(last.Sub(first)/width)+1 > maxFilledBuckets {
+		return nil
+	}
+
+	var grid []time.Time
+	for t := first; !t.After(last); t = t.Add(width) {
+		grid = append(grid, t)
+	}
+	return grid
+}
+
+// fillBuckets rebuilds frame on grid, with nullable numeric value fields that
+// are null for the buckets the frame has no row for. Rows whose time is not on
+// the grid are kept at their own time.
+func fillBuckets(frame *data.Frame, timeIndex int, grid []time.Time) {
+	rows := make(map[int64]int, frame.Fields[timeIndex].Len())
+	times := append([]time.Time(nil), grid...)
+	onGrid := make(map[int64]bool, len(grid))
+	for _, t := range grid {
+		onGrid[t.UnixMilli()] = true
+	}
+	for i := 0; i < frame.Fields[timeIndex].Len(); i++ {
+		t := frame.Fields[timeIndex].At(i).(time.Time)
+		rows[t.UnixMilli()] = i
+		if !onGrid[t.UnixMilli()] {
+			times = append(times, t)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	fields := make([]*data.Field, len(frame.Fields))
+	for f, field := range frame.Fields {
+		if f == timeIndex {
+			fields[f] = data.NewField(field.Name, field.Labels, times)
+			fields[f].Config = field.Config
+			continue
+		}
+		values := make([]*float64, len(times))
+		for i, t := range times {
+			if row, ok := rows[t.UnixMilli()]; ok {
+				values[i], _ = field.NullableFloatAt(row)
+			}
+		}
+		fields[f] = data.NewField(field.Name, field.Labels, values)
+		fields[f].Config = field.Config
+	}
+	frame.Fields = fields
+}
+
+// fillNulls replaces the null values of the value fields of frame with 0 for
+// models.FillModeZero, or with the previous non-null value of the field for
+// models.FillModePrevious. Nulls before the first value of a field are left for
+// models.FillModePrevious, as there is nothing to carry forward.
+func fillNulls(frame *data.Frame, timeIndex int, fillMode string) {
+	for f, field := range frame.Fields {
+		if f == timeIndex || !field.Nullable() {
+			continue
+		}
+		values := make([]*float64, field.Len())
+		var previous *float64
+		for i := range values {
+			value, _ := field.NullableFloatAt(i)
+			switch {
+			case value != nil:
+				previous = value
+			case fillMode == models.FillModeZero:
+				value = new(float64)
+			case previous != nil:
+				carried := *previous
+				value = &carried
+			}
+			values[i] = value
+		}
+		filled := data.NewField(field.Name, field.Labels, values)
+		filled.Config = field.Config
+		frame.Fields[f] = filled
+	}
+}
+
+// timeFieldIndex returns the index of the first time field of the frame, or -1.
+func timeFieldIndex(frame *data.Frame) int {
+	for i, field := range frame.Fields {
+		if field.Type().Time() {
+			return i
+		}
+	}
+	return -1
+}
+
+// numericValueFields reports whether every field but the time field is numeric.
+func numericValueFields(frame *data.Frame, timeIndex int) bool {
+	for i, field := range frame.Fields {
+		if i != timeIndex && !field.Type().Numeric() {
+			return false
+		}
+	}
+	return len(frame.Fields) > 1
+}
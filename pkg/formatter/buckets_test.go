@@ -0,0 +1,142 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []nrdb.NRDBResult
+		want time.Duration
+	}{
+		{
+			name: "from end timestamps",
+			rows: []nrdb.NRDBResult{{"beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000300.0}},
+			want: 5 * time.Minute,
+		},
+		{
+			name: "inferred from bucket starts",
+			rows: []nrdb.NRDBResult{
+				{"beginTimeSeconds": 1700000000.0},
+				{"beginTimeSeconds": 1700000060.0},
+				{"beginTimeSeconds": 1700000120.0},
+			},
+			want: time.Minute,
+		},
+		{
+			name: "not timeseries",
+			rows: []nrdb.NRDBResult{{"count": 1.0}},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, bucketWidth(tt.rows))
+		})
+	}
+}
+
+func TestFormatQueryResults_FillsMissingBuckets(t *testing.T) {
+	begin := 1700000040.0
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"count": 1.0, "beginTimeSeconds": begin, "endTimeSeconds": begin + 60},
+			{"count": 3.0, "beginTimeSeconds": begin + 120, "endTimeSeconds": begin + 180},
+		},
+	}
+	from := time.Unix(int64(begin)-60, 0)
+	query := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: from.Add(5 * time.Minute)}}
+
+	resp := FormatQueryResults(results, query)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	require.Len(t, frame.Fields, 2)
+
+	timeField, countField := frame.Fields[0], frame.Fields[1]
+	require.NotNil(t, timeField.Config)
+	assert.Equal(t, 60000.0, timeField.Config.Interval)
+
+	// Buckets from the start to the end of the range, with nulls where New Relic returned none
+	require.Equal(t, 5, timeField.Len())
+	for i := 0; i < timeField.Len(); i++ {
+		assert.Equal(t, from.Add(time.Duration(i)*time.Minute).Unix(), timeField.At(i).(time.Time).Unix())
+	}
+	values := make([]*float64, countField.Len())
+	for i := range values {
+		values[i], _ = countField.NullableFloatAt(i)
+	}
+	assert.Nil(t, values[0])
+	assert.Equal(t, 1.0, *values[1])
+	assert.Nil(t, values[2])
+	assert.Equal(t, 3.0, *values[3])
+	assert.Nil(t, values[4])
+}
+
+func TestFormatQueryResults_CompleteBuckets(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"count": 1.0, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+			{"count": 2.0, "beginTimeSeconds": 1700000060.0, "endTimeSeconds": 1700000120.0},
+		},
+	}
+
+	resp := FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+	require.Len(t, resp.Frames, 1)
+	assert.Equal(t, 2, resp.Frames[0].Fields[0].Len())
+	assert.Equal(t, 60000.0, resp.Frames[0].Fields[0].Config.Interval)
+	assert.Equal(t, 2, resp.Frames[0].Fields[1].Len())
+}
+
+func TestFormatQueryResultsWithOptions_FillMode(t *testing.T) {
+	begin := 1700000040.0
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": "web-1", "average.duration": 1.0, "beginTimeSeconds": begin, "endTimeSeconds": begin + 60},
+			{"facet": "web-1", "average.duration": 3.0, "beginTimeSeconds": begin + 120, "endTimeSeconds": begin + 180},
+			{"facet": "web-2", "average.duration": 2.0, "beginTimeSeconds": begin + 60, "endTimeSeconds": begin + 120},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"host"}},
+	}
+	from := time.Unix(int64(begin), 0)
+	query := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Minute)}}
+
+	values := func(t *testing.T, fillMode string) map[string][]interface{} {
+		resp := FormatQueryResultsWithOptions(results, query, FormatOptions{FillMode: fillMode})
+		require.NoError(t, resp.Error)
+		series := map[string][]interface{}{}
+		for _, frame := range resp.Frames {
+			require.Len(t, frame.Fields, 2)
+			// Every series is aligned on the same three buckets
+			require.Equal(t, 3, frame.Rows())
+			for i := 0; i < frame.Rows(); i++ {
+				value, ok := frame.Fields[1].ConcreteAt(i)
+				if !ok {
+					value = nil
+				}
+				series[frame.Name] = append(series[frame.Name], value)
+			}
+		}
+		return series
+	}
+
+	assert.Equal(t, map[string][]interface{}{
+		"web-1": {1.0, nil, 3.0},
+		"web-2": {nil, 2.0, nil},
+	}, values(t, ""))
+	assert.Equal(t, map[string][]interface{}{
+		"web-1": {1.0, 0.0, 3.0},
+		"web-2": {0.0, 2.0, 0.0},
+	}, values(t, "zero"))
+	assert.Equal(t, map[string][]interface{}{
+		"web-1": {1.0, 1.0, 3.0},
+		"web-2": {nil, 2.0, 2.0},
+	}, values(t, "previous"))
+}
@@ -0,0 +1,77 @@
+package formatter
+
+import (
+	"runtime"
+	"sync"
+
+	"newrelic-grafana-plugin/pkg/framebuilder"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// parallelCells is the number of result cells (rows × fields) above which the
+// fields of a frame are converted concurrently. Smaller results are faster to
+// convert on one goroutine.
+const parallelCells = 50000
+
+// collectColumns returns the values of each of fieldNames in rows, gathered in a
+// single pass over the rows. Values a row does not have are nil. The columns are
+// pooled scratch buffers; give them back with releaseColumns.
+func collectColumns(rows []nrdb.NRDBResult, fieldNames []string) map[string][]interface{} {
+	columns := make(map[string][]interface{}, len(fieldNames))
+	for _, fieldName := range fieldNames {
+		columns[fieldName] = framebuilder.Values(len(rows))
+	}
+	for i, row := range rows {
+		for key, value := range row {
+			if column, ok := columns[key]; ok {
+				column[i] = value
+			}
+		}
+	}
+	return columns
+}
+
+// releaseColumns returns the columns of collectColumns to the pool.
+func releaseColumns(columns map[string][]interface{}) {
+	for _, column := range columns {
+		framebuilder.Release(column)
+	}
+}
+
+// buildFields returns the fields build returns for each of fieldNames, in the
+// order of fieldNames. For results of more than parallelCells cells, the names
+// are built concurrently by up to GOMAXPROCS goroutines, so build must not
+// modify shared state.
+func buildFields(fieldNames []string, rows int, build func(fieldName string) []*data.Field) []*data.Field {
+	built := make([][]*data.Field, len(fieldNames))
+	if workers := min(runtime.GOMAXPROCS(0), len(fieldNames)); workers > 1 && len(fieldNames)*rows > parallelCells {
+		next := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					built[i] = build(fieldNames[i])
+				}
+			}()
+		}
+		for i := range fieldNames {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	} else {
+		for i, fieldName := range fieldNames {
+			built[i] = build(fieldName)
+		}
+	}
+
+	var fields []*data.Field
+	for _, f := range built {
+		fields = append(fields, f...)
+	}
+	return fields
+}
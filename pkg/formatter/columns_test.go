@@ -0,0 +1,153 @@
+package formatter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wideEventRows returns SELECT * style log rows with attrs attributes each,
+// alternating string, number and boolean values.
+func wideEventRows(rows, attrs int) []nrdb.NRDBResult {
+	results := make([]nrdb.NRDBResult, rows)
+	for i := range results {
+		row := nrdb.NRDBResult{"timestamp": float64(1700000000000 + i)}
+		for a := 0; a < attrs; a++ {
+			name := fmt.Sprintf("attr%02d", a)
+			switch a % 3 {
+			case 0:
+				row[name] = fmt.Sprintf("value-%d", i)
+			case 1:
+				row[name] = float64(i * a)
+			default:
+				row[name] = i%2 == 0
+			}
+		}
+		results[i] = row
+	}
+	return results
+}
+
+func TestCollectColumns(t *testing.T) {
+	rows := []nrdb.NRDBResult{
+		{"a": 1.0, "b": "x", "ignored": true},
+		{"b": "y"},
+	}
+	columns := collectColumns(rows, []string{"a", "b", "missing"})
+	assert.Equal(t, map[string][]interface{}{
+		"a":       {1.0, nil},
+		"b":       {"x", "y"},
+		"missing": {nil, nil},
+	}, columns)
+}
+
+func TestBuildFields_KeepsOrder(t *testing.T) {
+	var names []string
+	for i := 0; i < 40; i++ {
+		names = append(names, fmt.Sprintf("field%02d", i))
+	}
+	build := func(name string) []*data.Field {
+		return []*data.Field{data.NewField(name, nil, []float64{}), data.NewField(name+".extra", nil, []float64{})}
+	}
+
+	for _, rows := range []int{1, parallelCells} {
+		fields := buildFields(names, rows, build)
+		require.Len(t, fields, 2*len(names))
+		for i, name := range names {
+			assert.Equal(t, name, fields[2*i].Name)
+			assert.Equal(t, name+".extra", fields[2*i+1].Name)
+		}
+	}
+}
+
+func TestAddEventFields_LargeResult(t *testing.T) {
+	rows := wideEventRows(1500, 60)
+	require.Greater(t, 1500*60, parallelCells, "the result must be converted concurrently")
+	fieldNames := orderColumns(extractFieldNames(&nrdb.NRDBResultContainer{Results: rows}), nil)
+
+	frame := data.NewFrame("")
+	addEventFields(frame, rows, fieldNames, nil)
+
+	require.Len(t, frame.Fields, len(fieldNames))
+	for i, fieldName := range fieldNames {
+		want := convertField(fieldName, rows, fieldName, eventFieldType(rows, fieldName))
+		assert.Equal(t, want, frame.Fields[i], fieldName)
+	}
+}
+
+// quietLogs logs at info level for the rest of the benchmark, as a plugin does
+// by default, so that debug messages are not rendered.
+func quietLogs(b *testing.B) {
+	previous := log.DefaultLogger
+	log.DefaultLogger = log.NewWithLevel(log.Info)
+	b.Cleanup(func() { log.DefaultLogger = previous })
+}
+
+func BenchmarkFormatQueryResults_WideEvents(b *testing.B) {
+	quietLogs(b)
+	for _, size := range []struct{ rows, attrs int }{{100, 20}, {2000, 60}, {5000, 80}} {
+		results := &nrdb.NRDBResultContainer{Results: wideEventRows(size.rows, size.attrs)}
+		b.Run(fmt.Sprintf("%dx%d", size.rows, size.attrs), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+			}
+		})
+	}
+}
+
+func BenchmarkFormatQueryResults(b *testing.B) {
+	quietLogs(b)
+	for _, rows := range []int{1000, 10000, 50000} {
+		timeseries := make([]nrdb.NRDBResult, rows)
+		for i := range timeseries {
+			timeseries[i] = nrdb.NRDBResult{
+				"beginTimeSeconds": float64(1700000000 + 60*i),
+				"endTimeSeconds":   float64(1700000060 + 60*i),
+				"count":            float64(i),
+				"average.duration": float64(i) / 3,
+			}
+		}
+		events := &nrdb.NRDBResultContainer{Results: wideEventRows(rows, 12)}
+		b.Run(fmt.Sprintf("timeseries/%d", rows), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				FormatQueryResults(&nrdb.NRDBResultContainer{Results: timeseries}, backend.DataQuery{RefID: "A"})
+			}
+		})
+		b.Run(fmt.Sprintf("events/%d", rows), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				FormatQueryResults(events, backend.DataQuery{RefID: "A"})
+			}
+		})
+	}
+}
+
+func BenchmarkAddDataFields(b *testing.B) {
+	quietLogs(b)
+	rows := make([]nrdb.NRDBResult, 2000)
+	var fieldNames []string
+	for a := 0; a < 50; a++ {
+		fieldNames = append(fieldNames, fmt.Sprintf("average.attr%02d", a))
+	}
+	for i := range rows {
+		row := nrdb.NRDBResult{"beginTimeSeconds": float64(1700000000 + 60*i)}
+		for a, fieldName := range fieldNames {
+			row[fieldName] = float64(i * a)
+		}
+		rows[i] = row
+	}
+	results := &nrdb.NRDBResultContainer{Results: rows}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		addDataFields(data.NewFrame(""), results, fieldNames, nil)
+	}
+}
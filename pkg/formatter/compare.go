@@ -0,0 +1,141 @@
+package formatter
+
+import (
+	"time"
+
+	"newrelic-grafana-plugin/pkg/timeutil"
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// ComparisonLabel is the label that marks the fields of the comparison window of
+// a COMPARE WITH query.
+const ComparisonLabel = "comparison"
+
+// Values of the comparison field that NRDB adds to each row of COMPARE WITH results.
+const (
+	comparisonCurrent  = "current"
+	comparisonPrevious = "previous"
+)
+
+// comparisonFieldName is the result field that tells the windows of COMPARE WITH results apart.
+const comparisonFieldName = "comparison"
+
+// previousFrameSuffix is appended to the names of the comparison window's frames.
+const previousFrameSuffix = " (previous)"
+
+// isCompareResult reports whether the results come from a COMPARE WITH query.
+func isCompareResult(results *nrdb.NRDBResultContainer) bool {
+	for _, row := range results.Results {
+		switch row[comparisonFieldName] {
+		case comparisonCurrent, comparisonPrevious:
+			return true
+		}
+	}
+	return false
+}
+
+// formatCompareQuery formats COMPARE WITH results as two sets of frames: the
+// current window, formatted as if the query had no COMPARE WITH, followed by the
+// comparison window. The comparison window's fields are labeled
+// comparison="previous" and its timestamps are shifted onto the current window so
+// that both series can be drawn on the same time axis.
+func formatCompareQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+	current := &nrdb.NRDBResultContainer{Metadata: results.Metadata}
+	previous := &nrdb.NRDBResultContainer{Metadata: results.Metadata}
+	for _, row := range results.Results {
+		window := row[comparisonFieldName]
+		row = copyRow(row)
+		delete(row, comparisonFieldName)
+		if window == comparisonPrevious {
+			previous.Results = append(previous.Results, row)
+		} else {
+			current.Results = append(current.Results, row)
+		}
+	}
+	shiftRows(previous.Results, compareOffset(current.Results, previous.Results))
+
+	resp := formatQueryResults(current, query, opts)
+	if resp.Error != nil {
+		return resp
+	}
+	previousResp := formatQueryResults(previous, query, opts)
+	if previousResp.Error != nil {
+		return previousResp
+	}
+	for _, frame := range previousResp.Frames {
+		frame.Name += previousFrameSuffix
+		for _, field := range frame.Fields {
+			if field.Type().Time() {
+				continue
+			}
+			if field.Labels == nil {
+				field.Labels = data.Labels{}
+			}
+			field.Labels[ComparisonLabel] = comparisonPrevious
+		}
+	}
+	resp.Frames = append(resp.Frames, previousResp.Frames...)
+	return resp
+}
+
+// compareOffset returns how far the comparison window's rows must be moved to
+// line up with the current window: the distance between the earliest timestamps
+// of the two windows. It is zero when either window has no timestamps.
+func compareOffset(current, previous []nrdb.NRDBResult) time.Duration {
+	currentStart, ok := earliestRowTime(current)
+	if !ok {
+		return 0
+	}
+	previousStart, ok := earliestRowTime(previous)
+	if !ok {
+		return 0
+	}
+	return currentStart.Sub(previousStart)
+}
+
+// earliestRowTime returns the earliest beginTimeSeconds or timestamp of the rows.
+func earliestRowTime(rows []nrdb.NRDBResult) (time.Time, bool) {
+	var earliest time.Time
+	found := false
+	for _, row := range rows {
+		t, ok := rowTime(row)
+		if ok && (!found || t.Before(earliest)) {
+			earliest = t
+			found = true
+		}
+	}
+	return earliest, found
+}
+
+// rowTime returns the time of a result row from its beginTimeSeconds or
+// timestamp field.
+func rowTime(row nrdb.NRDBResult) (time.Time, bool) {
+	if seconds, ok := row["beginTimeSeconds"].(float64); ok {
+		return timeutil.FromEpochSeconds(seconds), true
+	}
+	if millis, ok := row[utils.TimestampFieldName].(float64); ok {
+		return timeutil.FromEpoch(millis), true
+	}
+	return time.Time{}, false
+}
+
+// shiftRows moves the timestamps of the rows by offset.
+func shiftRows(rows []nrdb.NRDBResult, offset time.Duration) {
+	if offset == 0 {
+		return
+	}
+	for _, row := range rows {
+		for _, key := range []string{"beginTimeSeconds", "endTimeSeconds"} {
+			if seconds, ok := row[key].(float64); ok {
+				row[key] = seconds + offset.Seconds()
+			}
+		}
+		if millis, ok := row[utils.TimestampFieldName].(float64); ok {
+			row[utils.TimestampFieldName] = millis + float64(offset.Milliseconds())
+		}
+	}
+}
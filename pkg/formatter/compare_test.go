@@ -0,0 +1,88 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatQueryResults_CompareWith(t *testing.T) {
+	t.Run("timeseries windows are paired on one time axis", func(t *testing.T) {
+		day := 86400.0
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"comparison": "current", "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0, "count": 10.0},
+			{"comparison": "current", "beginTimeSeconds": 1700000060.0, "endTimeSeconds": 1700000120.0, "count": 12.0},
+			{"comparison": "previous", "beginTimeSeconds": 1700000000.0 - day, "endTimeSeconds": 1700000060.0 - day, "count": 7.0},
+			{"comparison": "previous", "beginTimeSeconds": 1700000060.0 - day, "endTimeSeconds": 1700000120.0 - day, "count": 9.0},
+		}}
+
+		assert.Equal(t, DetectorCompare, detectRoute(results))
+
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 2)
+
+		current, previous := resp.Frames[0], resp.Frames[1]
+		assert.Equal(t, previous.Name, current.Name+previousFrameSuffix)
+		currentCount, _ := current.FieldByName("count")
+		require.NotNil(t, currentCount)
+		assert.Empty(t, currentCount.Labels)
+		assert.Nil(t, current.Fields[0].Labels)
+
+		previousCount := previous.Fields[1]
+		assert.Equal(t, "count", previousCount.Name)
+		assert.Equal(t, data.Labels{ComparisonLabel: "previous"}, previousCount.Labels)
+		assert.Equal(t, []interface{}{7.0, 9.0}, fieldValues(previousCount))
+
+		// The comparison window is shifted onto the current window
+		assert.Equal(t, fieldValues(current.Fields[0]), fieldValues(previous.Fields[0]))
+		assert.Equal(t, time.Unix(1700000000, 0), previous.Fields[0].At(0))
+
+		for _, frame := range resp.Frames {
+			require.NotNil(t, frame.Meta)
+			assert.Equal(t, data.FrameTypeTimeSeriesMulti, frame.Meta.Type)
+		}
+	})
+
+	t.Run("aggregate windows", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"comparison": "current", "average.duration": 0.5},
+			{"comparison": "previous", "average.duration": 0.4},
+		}}
+
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 2)
+		for _, frame := range resp.Frames {
+			_, idx := frame.FieldByName("comparison")
+			assert.Equal(t, -1, idx, "comparison column is removed")
+		}
+		field, _ := resp.Frames[1].FieldByName("average.duration")
+		require.NotNil(t, field)
+		assert.Equal(t, "previous", field.Labels[ComparisonLabel])
+	})
+
+	t.Run("multi result container", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainerMultiResultCustomized{
+			Results: []nrdb.NRDBResult{
+				{"comparison": "current", "facet": "app1", "beginTimeSeconds": 1700000000.0, "count": 3.0},
+				{"comparison": "previous", "facet": "app1", "beginTimeSeconds": 1699999400.0, "count": 2.0},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		}
+
+		assert.Equal(t, DetectorCompare, ExplainRoutingMulti(results).Detector)
+
+		resp := FormatFacetedTimeseriesResults(results, backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 2)
+		assert.Equal(t, "app1", resp.Frames[0].Name)
+		assert.Equal(t, "app1"+previousFrameSuffix, resp.Frames[1].Name)
+		assert.Equal(t, time.Unix(1700000000, 0), resp.Frames[1].Fields[0].At(0))
+	})
+}
@@ -0,0 +1,288 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/framebuilder"
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/converters"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// numberValue converts an NRDB number or numeric string (including scientific
+// notation) to a float64.
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case uint64:
+		return float64(n), true
+	}
+	f, err := converters.JSONValueToFloat64.Converter(v)
+	if err != nil {
+		return 0, false
+	}
+	return f.(float64), true
+}
+
+// jsonTextConverter renders arrays (e.g. histogram, uniques) and objects as JSON
+// text so they can be displayed in a table cell.
+var jsonTextConverter = data.FieldConverter{
+	OutputFieldType: data.FieldTypeString,
+	Converter: func(v interface{}) (interface{}, error) {
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			if b, err := json.Marshal(v); err == nil {
+				return string(b), nil
+			}
+		}
+		return fmt.Sprintf("%v", v), nil
+	},
+}
+
+// stringConverter renders values as text, writing numbers in full rather than
+// in scientific notation, so IDs forced to strings keep all their digits.
+var stringConverter = data.FieldConverter{
+	OutputFieldType: data.FieldTypeString,
+	Converter: func(v interface{}) (interface{}, error) {
+		if f, ok := v.(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		return fmt.Sprintf("%v", v), nil
+	},
+}
+
+// fieldConverters maps the type detected by detectFieldType to the converter used
+// to build the field, for the types that fieldBuilders does not build. Values a
+// converter rejects are left null (or empty for strings).
+var fieldConverters = map[string]data.FieldConverter{
+	"array":  jsonTextConverter,
+	"object": jsonTextConverter,
+	"apdex":  jsonTextConverter, // Only where apdex objects are not expanded into components
+	"funnel": jsonTextConverter, // Only where funnel results are not expanded into steps
+	"string": stringConverter,
+}
+
+// fieldBuilders maps the detected types of numbers, times and booleans, the bulk
+// of most results, to builders that keep a field's values in one backing array rather
+// than allocating each value.
+var fieldBuilders = map[string]func(name string, n int, value func(i int) interface{}) *data.Field{
+	"number":    convertNumbers,
+	"timestamp": convertEpochTimes,
+	"boolean":   convertBools,
+}
+
+// convertField builds the named field from the rows' values for fieldName for
+// its detected fieldType, falling back to strings.
+func convertField(name string, rows []nrdb.NRDBResult, fieldName, fieldType string) *data.Field {
+	return buildField(name, len(rows), fieldType, func(i int) interface{} { return rows[i][fieldName] })
+}
+
+// convertColumn builds the named field from a column of values, as returned by
+// collectColumns, for its detected fieldType.
+func convertColumn(name string, values []interface{}, fieldType string) *data.Field {
+	return buildField(name, len(values), fieldType, func(i int) interface{} { return values[i] })
+}
+
+// buildField builds a field of length n of fieldType with the builder or
+// converter registered for it, falling back to strings.
+func buildField(name string, n int, fieldType string, value func(i int) interface{}) *data.Field {
+	if build, ok := fieldBuilders[fieldType]; ok {
+		return build(name, n, value)
+	}
+	conv, ok := fieldConverters[fieldType]
+	if !ok {
+		conv = fieldConverters["string"]
+	}
+	return convertValues(name, n, conv, value)
+}
+
+// convertValues builds a field of length n from the values returned by value.
+// Missing values (nil or empty strings) and values the converter rejects are
+// left at the field type's zero value.
+func convertValues(name string, n int, conv data.FieldConverter, value func(i int) interface{}) *data.Field {
+	field := data.NewFieldFromFieldType(conv.OutputFieldType, n)
+	field.Name = name
+	for i := 0; i < n; i++ {
+		v := value(i)
+		if v == nil || v == "" {
+			continue
+		}
+		if converted, err := conv.Converter(v); err == nil {
+			field.Set(i, converted)
+		} // Unconvertible values stay null
+	}
+	return field
+}
+
+// maxExactInteger is 2^53, the largest magnitude up to which float64 holds every
+// whole number exactly.
+const maxExactInteger = 1 << 53
+
+// convertNumbers builds a nullable float64 field of length n from NRDB numbers
+// and numeric strings. Missing and non-numeric values are left null. Whole
+// numbers that float64 cannot hold exactly, such as 64-bit IDs, are kept in an
+// integer field instead; see convertIntegers.
+func convertNumbers(name string, n int, value func(i int) interface{}) *data.Field {
+	if field, ok := convertIntegers(name, n, value); ok {
+		return field
+	}
+	b := framebuilder.NewNullable[float64](n)
+	for i := 0; i < n; i++ {
+		v := value(i)
+		if v == nil || v == "" {
+			continue
+		}
+		if f, ok := numberValue(v); ok {
+			b.Set(i, f)
+		}
+	}
+	return b.Field(name)
+}
+
+// convertIntegers builds a nullable int64 field of length n, or a uint64 field
+// when a value is above math.MaxInt64, so that IDs and counters above 2^53 keep
+// every digit. It applies only when all values are whole numbers and at least
+// one of them is beyond 2^53 with its precision intact, as an integer or an
+// integer string; fields of smaller integers stay float64 fields.
+func convertIntegers(name string, n int, value func(i int) interface{}) (*data.Field, bool) {
+	precise, unsigned := false, false
+	for i := 0; i < n; i++ {
+		v := value(i)
+		if v == nil || v == "" {
+			continue
+		}
+		if f, ok := v.(float64); ok {
+			// Floats have already lost any precision above 2^53
+			if f != math.Trunc(f) || math.Abs(f) >= math.MaxInt64 {
+				return nil, false
+			}
+			continue
+		}
+		if x, ok := int64Value(v); ok {
+			precise = precise || x > maxExactInteger || x < -maxExactInteger
+			continue
+		}
+		if _, ok := uint64Value(v); ok {
+			precise, unsigned = true, true
+			continue
+		}
+		return nil, false
+	}
+	if !precise {
+		return nil, false
+	}
+
+	if unsigned {
+		b := framebuilder.NewNullable[uint64](n)
+		for i := 0; i < n; i++ {
+			v := value(i)
+			if v == nil || v == "" {
+				continue
+			}
+			u, ok := uint64Value(v)
+			if !ok {
+				return nil, false // Negative values do not fit a uint64 field
+			}
+			b.Set(i, u)
+		}
+		return b.Field(name), true
+	}
+	b := framebuilder.NewNullable[int64](n)
+	for i := 0; i < n; i++ {
+		v := value(i)
+		if v == nil || v == "" {
+			continue
+		}
+		if x, ok := int64Value(v); ok {
+			b.Set(i, x)
+		}
+	}
+	return b.Field(name), true
+}
+
+// int64Value converts an integer, whole float or integer string to an int64.
+func int64Value(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case float64:
+		return int64(n), n == math.Trunc(n) && math.Abs(n) < math.MaxInt64
+	case json.Number:
+		x, err := n.Int64()
+		return x, err == nil
+	case string:
+		x, err := strconv.ParseInt(n, 10, 64)
+		return x, err == nil
+	}
+	return 0, false
+}
+
+// uint64Value converts a non-negative integer, whole float or integer string to
+// a uint64.
+func uint64Value(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case json.Number:
+		u, err := strconv.ParseUint(string(n), 10, 64)
+		return u, err == nil
+	case string:
+		u, err := strconv.ParseUint(n, 10, 64)
+		return u, err == nil
+	}
+	if x, ok := int64Value(v); ok && x >= 0 {
+		return uint64(x), true
+	}
+	return 0, false
+}
+
+// convertEpochTimes builds a nullable time field of length n from epoch values
+// in seconds, milliseconds (as NRDB reports them), microseconds or nanoseconds,
+// given as numbers or numeric strings; see timeutil.FromEpoch. Missing and
+// non-numeric values are left null.
+func convertEpochTimes(name string, n int, value func(i int) interface{}) *data.Field {
+	b := framebuilder.NewNullable[time.Time](n)
+	for i := 0; i < n; i++ {
+		v := value(i)
+		if v == nil || v == "" {
+			continue
+		}
+		if epoch, ok := numberValue(v); ok {
+			b.Set(i, timeutil.FromEpoch(epoch))
+		}
+	}
+	return b.Field(name)
+}
+
+// convertBools builds a nullable bool field of length n from booleans, and from
+// "true"/"false" strings and 0/1 numbers for fields forced to booleans. Other
+// values are left null.
+func convertBools(name string, n int, value func(i int) interface{}) *data.Field {
+	b := framebuilder.NewNullable[bool](n)
+	for i := 0; i < n; i++ {
+		switch v := value(i).(type) {
+		case bool:
+			b.Set(i, v)
+		case string:
+			if parsed, err := strconv.ParseBool(v); err == nil {
+				b.Set(i, parsed)
+			}
+		case float64:
+			if v == 0 || v == 1 {
+				b.Set(i, v == 1)
+			}
+		}
+	}
+	return b.Field(name)
+}
@@ -0,0 +1,152 @@
+package formatter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertField(t *testing.T) {
+	float := func(f float64) *float64 { return &f }
+	integer := func(i int64) *int64 { return &i }
+	unsigned := func(u uint64) *uint64 { return &u }
+	boolean := func(b bool) *bool { return &b }
+	ts := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		fieldType string
+		values    []interface{}
+		wantType  data.FieldType
+		want      []interface{}
+	}{
+		{
+			name:      "numbers",
+			fieldType: "number",
+			values:    []interface{}{1.5, 2, int64(3), "4e2", "", nil, "n/a", true},
+			wantType:  data.FieldTypeNullableFloat64,
+			want:      []interface{}{float(1.5), float(2), float(3), float(400), (*float64)(nil), (*float64)(nil), (*float64)(nil), (*float64)(nil)},
+		},
+		{
+			name:      "integers above 2^53",
+			fieldType: "number",
+			values:    []interface{}{int64(9007199254740993), "-9007199254740995", json.Number("42"), 7.0, nil},
+			wantType:  data.FieldTypeNullableInt64,
+			want:      []interface{}{integer(9007199254740993), integer(-9007199254740995), integer(42), integer(7), (*int64)(nil)},
+		},
+		{
+			name:      "integers above math.MaxInt64",
+			fieldType: "number",
+			values:    []interface{}{uint64(18446744073709551615), "18446744073709551614", 1.0},
+			wantType:  data.FieldTypeNullableUint64,
+			want:      []interface{}{unsigned(18446744073709551615), unsigned(18446744073709551614), unsigned(1)},
+		},
+		{
+			name:      "small integers stay floats",
+			fieldType: "number",
+			values:    []interface{}{int64(3), "4", 9007199254740993.0},
+			wantType:  data.FieldTypeNullableFloat64,
+			want:      []interface{}{float(3), float(4), float(9007199254740992)},
+		},
+		{
+			name:      "large integers with fractions stay floats",
+			fieldType: "number",
+			values:    []interface{}{int64(9007199254740993), 1.5},
+			wantType:  data.FieldTypeNullableFloat64,
+			want:      []interface{}{float(9007199254740992), float(1.5)},
+		},
+		{
+			name:      "timestamps",
+			fieldType: "timestamp",
+			values:    []interface{}{1700000000000.0, "1700000000000", nil},
+			wantType:  data.FieldTypeNullableTime,
+			want:      []interface{}{&ts, &ts, (*time.Time)(nil)},
+		},
+		{
+			name:      "timestamps in other units",
+			fieldType: "timestamp",
+			values:    []interface{}{1700000000.0, 1700000000000000.0, int64(1700000000000000000), "1700000000000000"},
+			wantType:  data.FieldTypeNullableTime,
+			want:      []interface{}{&ts, &ts, &ts, &ts},
+		},
+		{
+			name:      "arrays and objects",
+			fieldType: "array",
+			values:    []interface{}{[]interface{}{1.0, "a"}, map[string]interface{}{"k": 1.0}, 7.0, nil},
+			wantType:  data.FieldTypeString,
+			want:      []interface{}{`[1,"a"]`, `{"k":1}`, "7", ""},
+		},
+		{
+			name:      "booleans",
+			fieldType: "boolean",
+			values:    []interface{}{true, "yes", nil},
+			wantType:  data.FieldTypeNullableBool,
+			want:      []interface{}{boolean(true), (*bool)(nil), (*bool)(nil)},
+		},
+		{
+			name:      "unknown type falls back to strings",
+			fieldType: "geo",
+			values:    []interface{}{"a", 1.0, nil},
+			wantType:  data.FieldTypeString,
+			want:      []interface{}{"a", "1", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := make([]nrdb.NRDBResult, len(tt.values))
+			for i, v := range tt.values {
+				rows[i] = nrdb.NRDBResult{"value": v}
+			}
+
+			field := convertField("out", rows, "value", tt.fieldType)
+			assert.Equal(t, "out", field.Name)
+			assert.Equal(t, tt.wantType, field.Type())
+			require.Equal(t, len(tt.want), field.Len())
+			for i, want := range tt.want {
+				assert.Equal(t, want, field.At(i), "row %d", i)
+			}
+		})
+	}
+}
+
+func TestAddPercentileValueFields(t *testing.T) {
+	frame := data.NewFrame("test")
+	rows := []nrdb.NRDBResult{
+		{"percentile.duration": map[string]interface{}{"95": 1.5}},
+		{"percentile.duration": map[string]interface{}{"95": "2.5"}},
+		{},
+	}
+
+	addPercentileValueFields(frame, rows, "percentile.duration", data.Labels{"appName": "app1"})
+
+	require.Len(t, frame.Fields, 1)
+	field := frame.Fields[0]
+	assert.Equal(t, "percentile.duration.95", field.Name)
+	assert.Equal(t, data.Labels{"appName": "app1"}, field.Labels)
+	assert.Equal(t, 1.5, *field.At(0).(*float64))
+	assert.Equal(t, 2.5, *field.At(1).(*float64))
+	assert.Nil(t, field.At(2).(*float64))
+}
+
+func TestAddDataFields_Int64Precision(t *testing.T) {
+	// Nanosecond timestamps and 64-bit IDs are beyond float64's 53-bit mantissa
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"latest.spanId": "1234567890123456789", "max.nanoTime": int64(1700000000123456789), "average.duration": 0.5},
+		{"latest.spanId": "1234567890123456791", "max.nanoTime": int64(1700000000123456791), "average.duration": 1.5},
+	}}
+	frame := data.NewFrame("")
+	addDataFields(frame, results, []string{"latest.spanId", "max.nanoTime", "average.duration"}, nil)
+	require.Len(t, frame.Fields, 3)
+
+	assert.Equal(t, data.FieldTypeNullableInt64, frame.Fields[0].Type())
+	assert.Equal(t, int64(1234567890123456791), *frame.Fields[0].At(1).(*int64))
+	assert.Equal(t, data.FieldTypeNullableInt64, frame.Fields[1].Type())
+	assert.Equal(t, int64(1700000000123456789), *frame.Fields[1].At(0).(*int64))
+	assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[2].Type())
+}
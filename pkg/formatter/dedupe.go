@@ -0,0 +1,70 @@
+package formatter
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// OriginalNameConfigKey is the key under FieldConfig.Custom that holds the name a
+// field had before it was renamed to resolve a duplicate.
+const OriginalNameConfigKey = "originalName"
+
+// dedupeResponseFieldNames applies dedupeFieldNames to every frame in resp.
+func dedupeResponseFieldNames(resp *backend.DataResponse) *backend.DataResponse {
+	if resp == nil {
+		return resp
+	}
+	for _, frame := range resp.Frames {
+		dedupeFieldNames(frame)
+	}
+	return resp
+}
+
+// dedupeFieldNames renames fields that share both name and labels with an earlier
+// field of the frame, e.g. when a query selects the same attribute twice or a
+// result key collides with the time field. Duplicates get a " (2)", " (3)", ...
+// suffix and keep their original name in the field config.
+func dedupeFieldNames(frame *data.Frame) {
+	seen := make(map[string]bool, len(frame.Fields))
+	for _, field := range frame.Fields {
+		seen[fieldIdentity(field.Name, field.Labels)] = true
+	}
+	if len(seen) == len(frame.Fields) {
+		return
+	}
+
+	claimed := make(map[string]bool, len(frame.Fields))
+	for _, field := range frame.Fields {
+		identity := fieldIdentity(field.Name, field.Labels)
+		if !claimed[identity] {
+			claimed[identity] = true
+			continue
+		}
+
+		original := field.Name
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s (%d)", original, n)
+			candidateIdentity := fieldIdentity(candidate, field.Labels)
+			if !seen[candidateIdentity] && !claimed[candidateIdentity] {
+				field.Name = candidate
+				claimed[candidateIdentity] = true
+				break
+			}
+		}
+
+		if field.Config == nil {
+			field.Config = &data.FieldConfig{}
+		}
+		if field.Config.Custom == nil {
+			field.Config.Custom = make(map[string]interface{})
+		}
+		field.Config.Custom[OriginalNameConfigKey] = original
+	}
+}
+
+// fieldIdentity returns the key under which Grafana considers two fields of a frame the same.
+func fieldIdentity(name string, labels data.Labels) string {
+	return name + labels.String()
+}
@@ -0,0 +1,79 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fieldNames(frame *data.Frame) []string {
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
+func TestDedupeFieldNames(t *testing.T) {
+	t.Run("duplicates get suffixes and keep the original name", func(t *testing.T) {
+		frame := data.NewFrame("response",
+			data.NewField("duration", nil, []float64{1}),
+			data.NewField("duration", nil, []float64{2}),
+			data.NewField("duration (2)", nil, []float64{3}),
+			data.NewField("duration", nil, []float64{4}),
+		)
+
+		dedupeFieldNames(frame)
+
+		assert.Equal(t, []string{"duration", "duration (3)", "duration (2)", "duration (4)"}, fieldNames(frame))
+		assert.Nil(t, frame.Fields[0].Config)
+		assert.Nil(t, frame.Fields[2].Config)
+		assert.Equal(t, "duration", frame.Fields[1].Config.Custom[OriginalNameConfigKey])
+		assert.Equal(t, "duration", frame.Fields[3].Config.Custom[OriginalNameConfigKey])
+	})
+
+	t.Run("same name with different labels is not a duplicate", func(t *testing.T) {
+		frame := data.NewFrame("response",
+			data.NewField("count", data.Labels{"appName": "a"}, []float64{1}),
+			data.NewField("count", data.Labels{"appName": "b"}, []float64{2}),
+		)
+
+		dedupeFieldNames(frame)
+
+		assert.Equal(t, []string{"count", "count"}, fieldNames(frame))
+	})
+
+	t.Run("existing field config is preserved", func(t *testing.T) {
+		frame := data.NewFrame("response",
+			data.NewField("x", nil, []float64{1}),
+			data.NewField("x", nil, []float64{2}).SetConfig(&data.FieldConfig{Unit: "ms"}),
+		)
+
+		dedupeFieldNames(frame)
+
+		assert.Equal(t, "x (2)", frame.Fields[1].Name)
+		assert.Equal(t, "ms", frame.Fields[1].Config.Unit)
+		assert.Equal(t, "x", frame.Fields[1].Config.Custom[OriginalNameConfigKey])
+	})
+}
+
+func TestFormatQueryResults_DedupesFieldNames(t *testing.T) {
+	// A result key named like the generated time field
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"time": "morning", "timestamp": float64(1700000000000)},
+		},
+	}
+
+	resp := FormatQueryResults(results, backend.DataQuery{})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+
+	names := fieldNames(resp.Frames[0])
+	assert.Contains(t, names, "time")
+	assert.Contains(t, names, "time (2)")
+}
@@ -0,0 +1,74 @@
+package formatter
+
+import (
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// metricEventType is the event type of dimensional metric queries (FROM Metric).
+const metricEventType = "Metric"
+
+// dimensionsFacet is the facet name of FACET dimensions(), which facets by every
+// dimension of the metrics and returns each as a row attribute.
+const dimensionsFacet = "dimensions()"
+
+// timeAttributes are the result attributes holding bucket or event times rather
+// than dimensions.
+var timeAttributes = map[string]bool{
+	"beginTimeSeconds": true,
+	"endTimeSeconds":   true,
+	"timestamp":        true,
+}
+
+// isMetricResult reports whether results come from a query of dimensional
+// metrics, whose rows can carry dimension attributes beyond the declared facets,
+// e.g. for FACET dimensions().
+func isMetricResult(results *nrdb.NRDBResultContainer) bool {
+	for _, eventType := range results.Metadata.EventTypes {
+		if eventType == metricEventType {
+			return true
+		}
+	}
+	return false
+}
+
+// dimensionLabels returns the labels of a metric series: every string or boolean
+// attribute of its rows that is not a time, facet or value field, plus the
+// declared facet labels. The dimensions() facet label is only kept when the rows
+// carry no dimension attributes.
+func dimensionLabels(rows []nrdb.NRDBResult, valueFields []string, facetLabels data.Labels) data.Labels {
+	values := make(map[string]bool, len(valueFields))
+	for _, name := range valueFields {
+		values[name] = true
+	}
+
+	labels := data.Labels{}
+	for _, row := range rows {
+		for name, value := range row {
+			if name == utils.FacetFieldName || timeAttributes[name] || values[name] {
+				continue
+			}
+			if _, seen := labels[name]; seen {
+				continue
+			}
+			switch value.(type) {
+			case string, bool:
+				labels[name] = fmt.Sprintf("%v", value)
+			}
+		}
+	}
+
+	if len(labels) == 0 {
+		return facetLabels
+	}
+	for name, value := range facetLabels {
+		if name != dimensionsFacet {
+			labels[name] = value
+		}
+	}
+	return labels
+}
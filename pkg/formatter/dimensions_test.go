@@ -0,0 +1,50 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatQueryResults_MetricDimensions(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": []interface{}{"checkout", "200"}, "appName": "checkout", "http.statusCode": "200", "rate.sum.http.server.requests": 5.0, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+			{"facet": []interface{}{"checkout", "500"}, "appName": "checkout", "http.statusCode": "500", "rate.sum.http.server.requests": 1.0, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+		},
+		Metadata: nrdb.NRDBMetadata{EventTypes: []string{"Metric"}, Facets: []string{"dimensions()"}},
+	}
+
+	resp := FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 2)
+
+	labels := map[string]data.Labels{}
+	for _, frame := range resp.Frames {
+		require.Len(t, frame.Fields, 2)
+		labels[frame.Name] = frame.Fields[1].Labels
+	}
+	assert.Equal(t, map[string]data.Labels{
+		"checkout, 200": {"appName": "checkout", "http.statusCode": "200"},
+		"checkout, 500": {"appName": "checkout", "http.statusCode": "500"},
+	}, labels)
+}
+
+func TestDimensionLabels(t *testing.T) {
+	valueFields := []string{"latest.version"}
+
+	t.Run("declared facets are kept", func(t *testing.T) {
+		rows := []nrdb.NRDBResult{{"facet": "web-1", "host": "web-1", "region": "eu", "sampled": true, "latest.version": "1.2", "timestamp": 1.0}}
+		assert.Equal(t, data.Labels{"host": "web-1", "region": "eu", "sampled": "true"},
+			dimensionLabels(rows, valueFields, data.Labels{"host": "web-1"}))
+	})
+
+	t.Run("dimensions facet without dimension attributes", func(t *testing.T) {
+		rows := []nrdb.NRDBResult{{"facet": []interface{}{"a"}, "latest.version": "1.2"}}
+		assert.Equal(t, data.Labels{"dimensions()": "a"}, dimensionLabels(rows, valueFields, data.Labels{"dimensions()": "a"}))
+	})
+}
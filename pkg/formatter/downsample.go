@@ -0,0 +1,199 @@
+package formatter
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/framebuilder"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Downsampling methods
+const (
+	DownsampleLTTB = "lttb" // Largest-Triangle-Three-Buckets, keeping the visual shape of the series (default)
+	DownsampleNth  = "nth"  // Every Nth point
+)
+
+// IsValidDownsample reports whether method is a recognised downsampling method.
+// An empty value is treated as DownsampleLTTB.
+func IsValidDownsample(method string) bool {
+	switch strings.ToLower(method) {
+	case "", DownsampleLTTB, DownsampleNth:
+		return true
+	default:
+		return false
+	}
+}
+
+// DownsampleFrame reduces a wide time series frame to at most target rows with
+// the given method, and reports whether rows were removed. LTTB picks the rows
+// from the first value field and keeps the same rows of the other fields, so
+// all series of the frame stay aligned. Other frames are left unchanged.
+func DownsampleFrame(frame *data.Frame, target int, method string) bool {
+	schema := frame.TimeSeriesSchema()
+	if schema.Type != data.TimeSeriesTypeWide {
+		return false
+	}
+	rows, err := frame.RowLen()
+	if err != nil || target <= 0 || rows <= target {
+		return false
+	}
+
+	var keep []int
+	if strings.EqualFold(method, DownsampleNth) || len(schema.ValueIndices) == 0 {
+		keep = nthIndices(rows, target)
+	} else {
+		x := make([]float64, rows)
+		y := make([]float64, rows)
+		timeField, valueField := frame.Fields[schema.TimeIndex], frame.Fields[schema.ValueIndices[0]]
+		for i := 0; i < rows; i++ {
+			if t, ok := timeField.ConcreteAt(i); ok {
+				x[i] = float64(t.(time.Time).UnixMilli())
+			}
+			y[i] = math.NaN()
+			if v, err := valueField.NullableFloatAt(i); err == nil && v != nil {
+				y[i] = *v
+			}
+		}
+		keep = lttbIndices(x, y, target)
+	}
+	selectRows(frame, keep)
+	return true
+}
+
+// nthIndices returns the indices of every Nth of n rows, so that at most
+// target rows are kept. The last row is always kept.
+func nthIndices(n, target int) []int {
+	step := int(math.Ceil(float64(n) / float64(target)))
+	keep := make([]int, 0, target)
+	for i := 0; i < n; i += step {
+		keep = append(keep, i)
+	}
+	if last := n - 1; keep[len(keep)-1] != last {
+		if len(keep) == target {
+			keep[len(keep)-1] = last
+		} else {
+			keep = append(keep, last)
+		}
+	}
+	return keep
+}
+
+// lttbIndices returns the indices of target points of the series (x, y) chosen
+// with the Largest-Triangle-Three-Buckets algorithm. The first and last points
+// are always kept; NaN values count as zero when comparing areas.
+func lttbIndices(x, y []float64, target int) []int {
+	n := len(x)
+	if target >= n || target < 3 {
+		return nthIndices(n, max(target, 1))
+	}
+
+	value := func(i int) float64 {
+		if math.IsNaN(y[i]) {
+			return 0
+		}
+		return y[i]
+	}
+
+	keep := make([]int, 0, target)
+	keep = append(keep, 0)
+	bucketSize := float64(n-2) / float64(target-2)
+	a := 0
+	for b := 0; b < target-2; b++ {
+		// Average of the next bucket, the third point of the triangle
+		nextStart := int(float64(b+1)*bucketSize) + 1
+		nextEnd := min(int(float64(b+2)*bucketSize)+1, n)
+		var avgX, avgY float64
+		for i := nextStart; i < nextEnd; i++ {
+			avgX += x[i]
+			avgY += value(i)
+		}
+		if count := float64(nextEnd - nextStart); count > 0 {
+			avgX /= count
+			avgY /= count
+		}
+
+		start := int(float64(b)*bucketSize) + 1
+		end := int(float64(b+1)*bucketSize) + 1
+		best, bestArea := start, -1.0
+		for i := start; i < end; i++ {
+			area := math.Abs((x[a]-avgX)*(value(i)-value(a)) - (x[a]-x[i])*(avgY-value(a)))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		keep = append(keep, best)
+		a = best
+	}
+	return append(keep, n-1)
+}
+
+// selectRows replaces the fields of frame with the rows at the ascending
+// indices keep.
+func selectRows(frame *data.Frame, keep []int) {
+	for i, field := range frame.Fields {
+		selected := data.NewFieldFromFieldType(field.Type(), len(keep))
+		selected.Name, selected.Labels, selected.Config = field.Name, field.Labels, field.Config
+		for j, row := range keep {
+			selected.Set(j, field.At(row))
+		}
+		frame.Fields[i] = selected
+	}
+}
+
+// MergeBuckets merges adjacent buckets of the wide time series frames in resp so
+// that each has at most maxDataPoints rows. Every group of k consecutive rows
+// becomes one row stamped with the time of its first bucket, holding the
+// average of the group's non-null numbers and the first value of other fields.
+// A limit of zero or less is not applied.
+func MergeBuckets(resp *backend.DataResponse, maxDataPoints int) {
+	if resp == nil || resp.Error != nil || maxDataPoints <= 0 {
+		return
+	}
+	for _, frame := range resp.Frames {
+		if frame.TimeSeriesSchema().Type != data.TimeSeriesTypeWide {
+			continue
+		}
+		rows, err := frame.RowLen()
+		if err != nil || rows <= maxDataPoints {
+			continue
+		}
+		size := (rows + maxDataPoints - 1) / maxDataPoints
+		for i, field := range frame.Fields {
+			frame.Fields[i] = mergeField(field, rows, size)
+		}
+	}
+}
+
+// mergeField returns field with each group of size rows merged into one.
+func mergeField(field *data.Field, rows, size int) *data.Field {
+	groups := (rows + size - 1) / size
+	var merged *data.Field
+	if field.Type().Numeric() {
+		values := framebuilder.NewNullable[float64](groups)
+		for g := 0; g < groups; g++ {
+			sum, count := 0.0, 0
+			for i := g * size; i < min((g+1)*size, rows); i++ {
+				if v, err := field.NullableFloatAt(i); err == nil && v != nil && !math.IsNaN(*v) {
+					sum += *v
+					count++
+				}
+			}
+			if count > 0 {
+				values.Set(g, sum/float64(count))
+			}
+		}
+		merged = values.Field(field.Name)
+	} else {
+		merged = data.NewFieldFromFieldType(field.Type(), groups)
+		merged.Name = field.Name
+		for g := 0; g < groups; g++ {
+			merged.Set(g, field.At(g*size))
+		}
+	}
+	merged.Labels, merged.Config = field.Labels, field.Config
+	return merged
+}
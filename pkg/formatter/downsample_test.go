@@ -0,0 +1,134 @@
+package formatter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNthIndices(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		target int
+		want   []int
+	}{
+		{name: "even step", n: 10, target: 5, want: []int{0, 2, 4, 6, 9}},
+		{name: "last row replaces the final pick", n: 10, target: 3, want: []int{0, 4, 9}},
+		{name: "last row appended", n: 10, target: 6, want: []int{0, 2, 4, 6, 8, 9}},
+		{name: "exact multiple", n: 10, target: 4, want: []int{0, 3, 6, 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nthIndices(tt.n, tt.target))
+		})
+	}
+}
+
+func TestLTTBIndices(t *testing.T) {
+	x := make([]float64, 100)
+	y := make([]float64, 100)
+	for i := range x {
+		x[i] = float64(i)
+	}
+	y[37] = 50  // spike
+	y[71] = -20 // dip
+	y[80] = math.NaN()
+
+	got := lttbIndices(x, y, 10)
+	require.Len(t, got, 10)
+	assert.Equal(t, 0, got[0])
+	assert.Equal(t, 99, got[9])
+	assert.Contains(t, got, 37, "spikes are kept")
+	assert.Contains(t, got, 71, "dips are kept")
+	assert.IsIncreasing(t, got)
+}
+
+func TestDownsampleFrame(t *testing.T) {
+	t.Run("keeps series aligned", func(t *testing.T) {
+		frame := seriesFrame(100, "a", "b")
+		for i := 0; i < 100; i++ {
+			frame.Fields[1].Set(i, float64(i%7))
+			frame.Fields[2].Set(i, float64(i))
+		}
+		require.True(t, DownsampleFrame(frame, 20, DownsampleLTTB))
+
+		rows, err := frame.RowLen()
+		require.NoError(t, err)
+		assert.Equal(t, 20, rows)
+		for i := 0; i < rows; i++ {
+			// b holds the original row number, so the time must match it
+			row := int(frame.Fields[2].At(i).(float64))
+			assert.Equal(t, seriesFrame(100).Fields[0].At(row), frame.Fields[0].At(i))
+		}
+	})
+
+	t.Run("every nth", func(t *testing.T) {
+		frame := seriesFrame(100, "a")
+		require.True(t, DownsampleFrame(frame, 10, DownsampleNth))
+		rows, _ := frame.RowLen()
+		assert.Equal(t, 10, rows)
+	})
+
+	t.Run("small and non time series frames are unchanged", func(t *testing.T) {
+		frame := seriesFrame(5, "a")
+		assert.False(t, DownsampleFrame(frame, 10, DownsampleLTTB))
+
+		table := data.NewFrame("", data.NewField("name", nil, make([]string, 100)))
+		assert.False(t, DownsampleFrame(table, 10, DownsampleLTTB))
+		rows, _ := table.RowLen()
+		assert.Equal(t, 100, rows)
+	})
+}
+
+func TestIsValidDownsample(t *testing.T) {
+	assert.True(t, IsValidDownsample(""))
+	assert.True(t, IsValidDownsample("lttb"))
+	assert.True(t, IsValidDownsample("NTH"))
+	assert.False(t, IsValidDownsample("average"))
+}
+
+func TestMergeBuckets(t *testing.T) {
+	frame := seriesFrame(10, "a")
+	values := []*float64{}
+	for i := 0; i < 10; i++ {
+		v := float64(i)
+		values = append(values, &v)
+	}
+	values[3] = nil
+	frame.Fields[1] = data.NewField("a", data.Labels{"host": "web"}, values)
+	times := frame.Fields[0]
+	resp := &backend.DataResponse{Frames: data.Frames{frame, data.NewFrame("table", data.NewField("name", nil, make([]string, 10)))}}
+
+	MergeBuckets(resp, 4)
+
+	// 10 rows into at most 4: groups of 3, the last one partial
+	merged := resp.Frames[0]
+	rows, err := merged.RowLen()
+	require.NoError(t, err)
+	require.Equal(t, 4, rows)
+	for g := 0; g < rows; g++ {
+		assert.Equal(t, times.At(g*3), merged.Fields[0].At(g))
+	}
+	want := []float64{1, 4.5, 7, 9} // (0+1+2)/3, (4+5)/2 without the null, (6+7+8)/3, 9
+	for g, w := range want {
+		v, err := merged.Fields[1].NullableFloatAt(g)
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		assert.Equal(t, w, *v)
+	}
+	assert.Equal(t, data.Labels{"host": "web"}, merged.Fields[1].Labels)
+
+	tableRows, _ := resp.Frames[1].RowLen()
+	assert.Equal(t, 10, tableRows, "tables are not merged")
+
+	// Frames within the limit are unchanged
+	frame = seriesFrame(4, "a")
+	MergeBuckets(&backend.DataResponse{Frames: data.Frames{frame}}, 4)
+	rows, _ = frame.RowLen()
+	assert.Equal(t, 4, rows)
+}
@@ -0,0 +1,114 @@
+package formatter
+
+import (
+	"encoding/json"
+	"sort"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// isEventRows reports whether rows are raw events, as returned by SELECT * or
+// SELECT attr1, attr2: every row has a timestamp and none is a TIMESERIES bucket.
+func isEventRows(rows []nrdb.NRDBResult) bool {
+	if len(rows) == 0 {
+		return false
+	}
+	for _, row := range rows {
+		if _, ok := row[utils.TimestampFieldName]; !ok {
+			return false
+		}
+		if _, ok := row["beginTimeSeconds"]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// eventFieldType returns the type of an event attribute from the JSON types of its
+// values. Unlike detectFieldType it never parses strings as numbers, so an
+// attribute keeps the same type on every page of results whatever its values
+// look like; an attribute with both strings and numbers is a string.
+func eventFieldType(rows []nrdb.NRDBResult, fieldName string) string {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row[fieldName]
+	}
+	return eventColumnType(values)
+}
+
+// eventColumnType returns the eventFieldType of a column of attribute values.
+func eventColumnType(values []interface{}) string {
+	found := make(map[string]bool)
+	for _, value := range values {
+		switch value.(type) {
+		case nil:
+		case string:
+			found["string"] = true
+		case float64, int, int64, uint64, json.Number:
+			found["number"] = true
+		case bool:
+			found["boolean"] = true
+		case []interface{}:
+			found["array"] = true
+		case map[string]interface{}:
+			found["object"] = true
+		default:
+			found["string"] = true
+		}
+	}
+	for _, fieldType := range []string{"string", "number", "boolean", "array", "object"} {
+		if found[fieldType] {
+			if fieldType == "number" && len(found) > 1 {
+				return "string"
+			}
+			return fieldType
+		}
+	}
+	return "string"
+}
+
+// addEventFields adds a field per event attribute, typed by eventFieldType or
+// forced by rules. The attribute values are gathered in one pass over the rows,
+// then converted.
+func addEventFields(frame *data.Frame, rows []nrdb.NRDBResult, fieldNames []string, rules []models.FieldTypeRule) {
+	columns := collectColumns(rows, fieldNames)
+	defer releaseColumns(columns)
+	frame.Fields = append(frame.Fields, buildFields(fieldNames, len(rows), func(fieldName string) []*data.Field {
+		values := columns[fieldName]
+		fieldType := eventColumnType(values)
+		if forced, ok := forcedFieldType(rules, fieldName); ok && fieldType != "array" && fieldType != "object" {
+			fieldType = forced
+		}
+		return []*data.Field{convertColumn(fieldName, values, fieldType)}
+	})...)
+}
+
+// orderColumns returns names with the names listed in columns first, in that
+// order, followed by the others in ascending order. Listed columns that are not
+// in names are ignored.
+func orderColumns(names []string, columns []string) []string {
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+
+	ordered := make([]string, 0, len(names))
+	for _, column := range columns {
+		if present[column] {
+			ordered = append(ordered, column)
+			delete(present, column)
+		}
+	}
+	rest := make([]string, 0, len(present))
+	for _, name := range names {
+		if present[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(ordered, rest...)
+}
@@ -0,0 +1,76 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatQueryResults_EventColumns(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "name": "WebTransaction/checkout", "duration": 0.5, "host": "web-1", "error": false},
+		{"timestamp": 1700000001000.0, "name": "WebTransaction/cart", "duration": 1.5, "host": "web-2", "error": true, "port": "8080"},
+	}}
+	names := func(frame *data.Frame) []string {
+		var names []string
+		for _, field := range frame.Fields {
+			names = append(names, field.Name)
+		}
+		return names
+	}
+
+	t.Run("time first, then columns alphabetically", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			resp := FormatQueryResults(results, backend.DataQuery{})
+			require.NoError(t, resp.Error)
+			require.Len(t, resp.Frames, 1)
+			assert.Equal(t, []string{"time", "duration", "error", "host", "name", "port"}, names(resp.Frames[0]))
+		}
+	})
+
+	t.Run("listed columns first", func(t *testing.T) {
+		resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, FormatOptions{Columns: []string{"name", "missing", "host"}})
+		require.NoError(t, resp.Error)
+		assert.Equal(t, []string{"time", "name", "host", "duration", "error", "port"}, names(resp.Frames[0]))
+	})
+
+	t.Run("event attribute types follow the JSON values", func(t *testing.T) {
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		frame := resp.Frames[0]
+		port, _ := frame.FieldByName("port")
+		require.NotNil(t, port)
+		assert.Equal(t, data.FieldTypeString, port.Type(), "numeric-looking strings stay strings")
+		duration, _ := frame.FieldByName("duration")
+		assert.Equal(t, data.FieldTypeNullableFloat64, duration.Type())
+		errField, _ := frame.FieldByName("error")
+		assert.Equal(t, data.FieldTypeNullableBool, errField.Type())
+	})
+}
+
+func TestEventFieldType(t *testing.T) {
+	rows := []nrdb.NRDBResult{
+		{"code": "200", "mixed": 1.0, "tags": []interface{}{"a"}},
+		{"code": "404", "mixed": "n/a", "tags": nil},
+	}
+	assert.Equal(t, "string", eventFieldType(rows, "code"))
+	assert.Equal(t, "string", eventFieldType(rows, "mixed"))
+	assert.Equal(t, "array", eventFieldType(rows, "tags"))
+	assert.Equal(t, "string", eventFieldType(rows, "missing"))
+}
+
+func TestIsEventRows(t *testing.T) {
+	assert.True(t, isEventRows([]nrdb.NRDBResult{{"timestamp": 1.0, "name": "a"}}))
+	assert.False(t, isEventRows([]nrdb.NRDBResult{{"timestamp": 1.0}, {"count": 1.0}}))
+	assert.False(t, isEventRows([]nrdb.NRDBResult{{"timestamp": 1.0, "beginTimeSeconds": 1.0}}))
+	assert.False(t, isEventRows(nil))
+}
+
+func TestOrderColumns(t *testing.T) {
+	assert.Equal(t, []string{"c", "a", "b"}, orderColumns([]string{"b", "c", "a"}, []string{"c", "x"}))
+	assert.Equal(t, []string{"a", "b"}, orderColumns([]string{"b", "a"}, nil))
+	assert.Empty(t, orderColumns(nil, []string{"a"}))
+}
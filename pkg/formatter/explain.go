@@ -0,0 +1,107 @@
+package formatter
+
+import (
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// Detector names reported in routing traces
+const (
+	DetectorSimpleCount            = "simpleCount"
+	DetectorFacetedCount           = "facetedCount"
+	DetectorFacetedTimeseries      = "facetedTimeseries"
+	DetectorFacetedTimeseriesMulti = "facetedTimeseriesMulti"
+	DetectorStandard               = "standard"
+	DetectorUniques                = "uniques"
+	DetectorKeyset                 = "keyset"
+	DetectorCompare                = "compare"
+)
+
+// RoutingTraceMetaKey is the key under FrameMeta.Custom that holds the routing trace.
+const RoutingTraceMetaKey = "routing"
+
+// RoutingTrace describes how a query result was routed through the formatter.
+// It is attached to frame metadata when a query sets explainRouting.
+type RoutingTrace struct {
+	Executor   string            `json:"executor,omitempty"` // Executor path used ("standard" or "multi")
+	Detector   string            `json:"detector"`           // Detector that matched the result shape
+	Formatter  string            `json:"formatter"`          // Formatter function that produced the frames
+	Facets     []string          `json:"facets"`             // Facet names from the NRDB metadata
+	FieldTypes map[string]string `json:"fieldTypes"`         // Detected type for each result field
+}
+
+// ExplainRouting returns the routing trace FormatQueryResults would follow for results.
+func ExplainRouting(results *nrdb.NRDBResultContainer) *RoutingTrace {
+	route := matchRoute(results)
+	detector := route.Name
+	facetNames := extractFacetNames(results)
+
+	formatterName := route.Formatter
+	switch detector {
+	case DetectorFacetedTimeseries:
+		// Without facets the faceted timeseries formatter falls back to the standard one
+		formatterName = "formatStandardQuery"
+		if len(facetNames) > 0 {
+			formatterName = "formatFacetedAggregationQuery"
+		}
+	case DetectorStandard:
+		if len(facetNames) > 0 && !hasCountField(results) {
+			formatterName = "formatFacetedAggregationQuery"
+		}
+	}
+
+	return &RoutingTrace{
+		Detector:   detector,
+		Formatter:  formatterName,
+		Facets:     facetNames,
+		FieldTypes: detectFieldTypes(results.Results),
+	}
+}
+
+// ExplainRoutingMulti returns the routing trace FormatFacetedTimeseriesResults would follow for results.
+func ExplainRoutingMulti(results *nrdb.NRDBResultContainerMultiResultCustomized) *RoutingTrace {
+	standardResults := toStandardContainerMulti(results)
+	facetNames := extractFacetNames(standardResults)
+
+	detector := DetectorFacetedTimeseriesMulti
+	formatterName := "formatStandardQuery"
+	switch {
+	case isCompareResult(standardResults):
+		detector = DetectorCompare
+		formatterName = "formatCompareQuery"
+	case len(facetNames) > 0:
+		formatterName = "formatFacetedAggregationQuery"
+	}
+
+	return &RoutingTrace{
+		Detector:   detector,
+		Formatter:  formatterName,
+		Facets:     facetNames,
+		FieldTypes: detectFieldTypes(standardResults.Results),
+	}
+}
+
+// detectFieldTypes runs field type detection for every field present in the results.
+func detectFieldTypes(results []nrdb.NRDBResult) map[string]string {
+	fieldNames := extractFieldNames(&nrdb.NRDBResultContainer{Results: results})
+	sort.Strings(fieldNames)
+
+	fieldTypes := make(map[string]string, len(fieldNames))
+	for _, fieldName := range fieldNames {
+		fieldTypes[fieldName] = detectFieldType(results, fieldName, nil)
+	}
+	return fieldTypes
+}
+
+// AttachRoutingTrace adds the routing trace to the custom metadata of every frame in resp.
+// Existing custom metadata maps are preserved; frames without metadata get a new one.
+func AttachRoutingTrace(resp *backend.DataResponse, trace *RoutingTrace) {
+	if resp == nil || trace == nil {
+		return
+	}
+	for _, frame := range resp.Frames {
+		setCustomMeta(frame, RoutingTraceMetaKey, trace)
+	}
+}
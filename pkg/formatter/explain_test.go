@@ -0,0 +1,121 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainRouting(t *testing.T) {
+	tests := []struct {
+		name              string
+		results           *nrdb.NRDBResultContainer
+		expectedDetector  string
+		expectedFormatter string
+		expectedFacets    []string
+		expectedTypes     map[string]string
+	}{
+		{
+			name: "simple count",
+			results: &nrdb.NRDBResultContainer{
+				Results: []nrdb.NRDBResult{{"count": 42.0}},
+			},
+			expectedDetector:  DetectorSimpleCount,
+			expectedFormatter: "formatSimpleCountQuery",
+			expectedFacets:    []string{},
+			expectedTypes:     map[string]string{"count": "number"},
+		},
+		{
+			name: "faceted count",
+			results: &nrdb.NRDBResultContainer{
+				Results: []nrdb.NRDBResult{
+					{"count": 10.0, "facet": "app1", "appName": "app1"},
+					{"count": 5.0, "facet": "app2", "appName": "app2"},
+				},
+				Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+			},
+			expectedDetector:  DetectorFacetedCount,
+			expectedFormatter: "formatFacetedCountQuery",
+			expectedFacets:    []string{"appName"},
+			expectedTypes:     map[string]string{"count": "number", "facet": "string", "appName": "string"},
+		},
+		{
+			name: "faceted timeseries",
+			results: &nrdb.NRDBResultContainer{
+				Results: []nrdb.NRDBResult{
+					{"sum.duration": 1.5, "facet": "/a", "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+				},
+				Metadata: nrdb.NRDBMetadata{Facets: []string{"request.uri"}},
+			},
+			expectedDetector:  DetectorFacetedTimeseries,
+			expectedFormatter: "formatFacetedAggregationQuery",
+			expectedFacets:    []string{"request.uri"},
+			expectedTypes:     map[string]string{"sum.duration": "number", "facet": "string"},
+		},
+		{
+			name: "standard timeseries",
+			results: &nrdb.NRDBResultContainer{
+				Results: []nrdb.NRDBResult{
+					{"average.duration": 0.2, "beginTimeSeconds": 1700000000.0},
+				},
+			},
+			expectedDetector:  DetectorStandard,
+			expectedFormatter: "formatStandardQuery",
+			expectedFacets:    []string{},
+			expectedTypes:     map[string]string{"average.duration": "number"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := ExplainRouting(tt.results)
+			assert.Equal(t, tt.expectedDetector, trace.Detector)
+			assert.Equal(t, tt.expectedFormatter, trace.Formatter)
+			assert.Equal(t, tt.expectedFacets, trace.Facets)
+			assert.Equal(t, tt.expectedTypes, trace.FieldTypes)
+		})
+	}
+}
+
+func TestExplainRoutingMulti(t *testing.T) {
+	results := &nrdb.NRDBResultContainerMultiResultCustomized{
+		OtherResult: nrdb.NRDBMultiResultCustomized{
+			{"count": 3.0, "facet": "app1", "beginTimeSeconds": 1700000000.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+
+	trace := ExplainRoutingMulti(results)
+	assert.Equal(t, DetectorFacetedTimeseriesMulti, trace.Detector)
+	assert.Equal(t, "formatFacetedAggregationQuery", trace.Formatter)
+	assert.Equal(t, []string{"appName"}, trace.Facets)
+	assert.Equal(t, map[string]string{"count": "number", "facet": "string"}, trace.FieldTypes)
+}
+
+func TestAttachRoutingTrace(t *testing.T) {
+	withMeta := data.NewFrame("pie")
+	withMeta.Meta = &data.FrameMeta{Custom: map[string]interface{}{"chartType": "pie"}}
+	withoutMeta := data.NewFrame("plain")
+
+	resp := &backend.DataResponse{Frames: data.Frames{withMeta, withoutMeta}}
+	trace := &RoutingTrace{Detector: DetectorStandard, Formatter: "formatStandardQuery"}
+	AttachRoutingTrace(resp, trace)
+
+	custom, ok := withMeta.Meta.Custom.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "pie", custom["chartType"])
+	assert.Equal(t, trace, custom[RoutingTraceMetaKey])
+
+	require.NotNil(t, withoutMeta.Meta)
+	custom, ok = withoutMeta.Meta.Custom.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, trace, custom[RoutingTraceMetaKey])
+
+	// Nil inputs are ignored
+	AttachRoutingTrace(nil, trace)
+	AttachRoutingTrace(resp, nil)
+}
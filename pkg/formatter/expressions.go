@@ -0,0 +1,336 @@
+package formatter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Expression is a parsed math expression over the fields of a query's frames,
+// such as ($A.errors / $A.total) * 100. It supports numbers, field references,
+// parentheses, unary minus and the operators + - * / %.
+type Expression struct {
+	text   string
+	fields []string // Names of the referenced fields, in order of appearance
+	eval   func(values map[string]float64) (float64, bool)
+}
+
+// Fields returns the names of the fields the expression references.
+func (e *Expression) Fields() []string {
+	return e.fields
+}
+
+// expressionParser is a recursive descent parser of expressions.
+type expressionParser struct {
+	text  string
+	pos   int
+	refID string
+	seen  map[string]bool
+	expr  *Expression
+}
+
+// ParseExpression parses the expression text of the query refID. Fields are
+// referenced as $<refId>.<name>, with names holding characters other than
+// letters, digits, underscores and dots quoted in backticks, e.g.
+// $A.`Error Rate`. Fields of other queries cannot be referenced.
+func ParseExpression(text, refID string) (*Expression, error) {
+	p := &expressionParser{text: text, refID: refID, seen: make(map[string]bool), expr: &Expression{text: text}}
+	eval, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.text) {
+		return nil, p.errorf("unexpected '%c'", p.text[p.pos])
+	}
+	if len(p.expr.fields) == 0 {
+		return nil, fmt.Errorf("invalid expression '%s': it references no field", text)
+	}
+	p.expr.eval = eval
+	return p.expr, nil
+}
+
+type evalFunc = func(values map[string]float64) (float64, bool)
+
+func (p *expressionParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expression '%s' at position %d: %s", p.text, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next character after spaces, or 0 at the end.
+func (p *expressionParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.text) {
+		return p.text[p.pos]
+	}
+	return 0
+}
+
+func (p *expressionParser) parseSum() (evalFunc, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(op, left, right)
+	}
+}
+
+func (p *expressionParser) parseProduct() (evalFunc, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(op, left, right)
+	}
+}
+
+func (p *expressionParser) parseUnary() (evalFunc, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(values map[string]float64) (float64, bool) {
+			value, ok := operand(values)
+			return -value, ok
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (evalFunc, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	case c == '(':
+		p.pos++
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing ')'")
+		}
+		p.pos++
+		return inner, nil
+	case c == '$':
+		return p.parseField()
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.text) && (p.text[p.pos] == '.' || (p.text[p.pos] >= '0' && p.text[p.pos] <= '9')) {
+			p.pos++
+		}
+		number, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number")
+		}
+		return func(map[string]float64) (float64, bool) { return number, true }, nil
+	default:
+		return nil, p.errorf("unexpected '%c'", c)
+	}
+}
+
+// parseField parses a field reference, $<refId>.<name>.
+func (p *expressionParser) parseField() (evalFunc, error) {
+	start := p.pos
+	p.pos++
+	refStart := p.pos
+	for p.pos < len(p.text) && isNameChar(p.text[p.pos]) && p.text[p.pos] != '.' {
+		p.pos++
+	}
+	refID := p.text[refStart:p.pos]
+	if p.pos >= len(p.text) || p.text[p.pos] != '.' || refID == "" {
+		p.pos = start
+		return nil, p.errorf("field references must be $<refId>.<field>")
+	}
+	if refID != p.refID {
+		p.pos = start
+		return nil, p.errorf("$%s references another query; only fields of query %s can be used", refID, p.refID)
+	}
+	p.pos++
+
+	var name string
+	if p.pos < len(p.text) && p.text[p.pos] == '`' {
+		end := strings.IndexByte(p.text[p.pos+1:], '`')
+		if end < 0 {
+			return nil, p.errorf("unterminated field name")
+		}
+		name = p.text[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else {
+		nameStart := p.pos
+		for p.pos < len(p.text) && isNameChar(p.text[p.pos]) {
+			p.pos++
+		}
+		name = strings.TrimRight(p.text[nameStart:p.pos], ".")
+		p.pos = nameStart + len(name)
+	}
+	if name == "" {
+		return nil, p.errorf("missing field name")
+	}
+	if !p.seen[name] {
+		p.seen[name] = true
+		p.expr.fields = append(p.expr.fields, name)
+	}
+	return func(values map[string]float64) (float64, bool) {
+		value, ok := values[name]
+		return value, ok
+	}, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// binary returns the evaluation of an operator. Missing operands and division
+// by zero have no value.
+func binary(op byte, left, right evalFunc) evalFunc {
+	return func(values map[string]float64) (float64, bool) {
+		l, ok := left(values)
+		if !ok {
+			return 0, false
+		}
+		r, ok := right(values)
+		if !ok {
+			return 0, false
+		}
+		switch op {
+		case '+':
+			return l + r, true
+		case '-':
+			return l - r, true
+		case '*':
+			return l * r, true
+		case '/':
+			if r == 0 {
+				return 0, false
+			}
+			return l / r, true
+		default:
+			if r == 0 {
+				return 0, false
+			}
+			return math.Mod(l, r), true
+		}
+	}
+}
+
+// ApplyExpressions adds a field per expression to the frames of resp that hold
+// the fields it references, computed row by row. Fields are grouped by their
+// labels, so the series of each facet, in its own frame or in a wide frame,
+// get their own derived field with the same labels. Rows where a referenced
+// value is null, or that divide by zero, are null. It returns a warning for
+// each expression no frame holds the fields of.
+func ApplyExpressions(resp *backend.DataResponse, expressions []models.FieldExpression, refID string) []string {
+	if resp == nil || resp.Error != nil || len(expressions) == 0 {
+		return nil
+	}
+	var warnings []string
+	for _, fieldExpr := range expressions {
+		expr, err := ParseExpression(fieldExpr.Expr, refID)
+		if err != nil {
+			// Expressions are validated before the query runs
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		added := 0
+		for _, frame := range resp.Frames {
+			added += applyExpression(frame, fieldExpr.Name, expr)
+		}
+		if added == 0 {
+			warnings = append(warnings, fmt.Sprintf("expression %s skipped: no series has the fields %s", fieldExpr.Name, strings.Join(expr.Fields(), ", ")))
+		}
+	}
+	return warnings
+}
+
+// applyExpression adds the field name computed by expr to frame for each label
+// set whose series hold every referenced field, and returns how many it added.
+func applyExpression(frame *data.Frame, name string, expr *Expression) int {
+	groups := make(map[string]map[string]*data.Field)
+	groupLabels := make(map[string]data.Labels)
+	for _, field := range frame.Fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		key := field.Labels.String()
+		if groups[key] == nil {
+			groups[key] = make(map[string]*data.Field)
+			groupLabels[key] = field.Labels
+		}
+		if _, ok := groups[key][field.Name]; !ok {
+			groups[key][field.Name] = field
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	added := 0
+	for _, key := range keys {
+		fields := groups[key]
+		complete := true
+		for _, fieldName := range expr.Fields() {
+			if fields[fieldName] == nil {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		rows := frame.Rows()
+		values := make([]*float64, rows)
+		row := make(map[string]float64, len(fields))
+		for i := 0; i < rows; i++ {
+			clear(row)
+			for _, fieldName := range expr.Fields() {
+				if value, err := fields[fieldName].NullableFloatAt(i); err == nil && value != nil {
+					row[fieldName] = *value
+				}
+			}
+			if value, ok := expr.eval(row); ok && !math.IsNaN(value) && !math.IsInf(value, 0) {
+				values[i] = floatPtr(value)
+			}
+		}
+		frame.Fields = append(frame.Fields, data.NewField(name, groupLabels[key], values))
+		added++
+	}
+	return added
+}
@@ -0,0 +1,90 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expr   string
+		values map[string]float64
+		want   float64
+		ok     bool
+	}{
+		{expr: "($A.errors / $A.total) * 100", values: map[string]float64{"errors": 5, "total": 50}, want: 10, ok: true},
+		{expr: "$A.a + $A.b * 2", values: map[string]float64{"a": 1, "b": 3}, want: 7, ok: true},
+		{expr: "-$A.a - -1", values: map[string]float64{"a": 4}, want: -3, ok: true},
+		{expr: "$A.average.duration * 1000", values: map[string]float64{"average.duration": 0.25}, want: 250, ok: true},
+		{expr: "$A.`Error Rate` % 3", values: map[string]float64{"Error Rate": 7}, want: 1, ok: true},
+		{expr: "$A.a / $A.b", values: map[string]float64{"a": 1, "b": 0}},
+		{expr: "$A.a + $A.b", values: map[string]float64{"a": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseExpression(tt.expr, "A")
+			require.NoError(t, err)
+			got, ok := expr.eval(tt.values)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.InDelta(t, tt.want, got, 1e-9)
+			}
+		})
+	}
+
+	expr, err := ParseExpression("$A.errors / $A.total + $A.errors", "A")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"errors", "total"}, expr.Fields())
+
+	for _, invalid := range []string{"", "1 + 2", "$A.a +", "($A.a", "$B.a * 2", "$A", "$A.a $A.b", "$A.`a", "1.2.3 * $A.a"} {
+		_, err := ParseExpression(invalid, "A")
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestApplyExpressions(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	times := []time.Time{at, at.Add(time.Minute)}
+	resp := &backend.DataResponse{Frames: data.Frames{
+		data.NewFrame("checkout",
+			data.NewField("time", nil, times),
+			data.NewField("errors", data.Labels{"appName": "checkout"}, []float64{1, 2}),
+			data.NewField("total", data.Labels{"appName": "checkout"}, []*float64{ptrFloat(10), nil}),
+		),
+		data.NewFrame("wide",
+			data.NewField("time", nil, times),
+			data.NewField("errors", data.Labels{"appName": "a"}, []float64{3, 4}),
+			data.NewField("total", data.Labels{"appName": "a"}, []float64{6, 0}),
+			data.NewField("errors", data.Labels{"appName": "b"}, []float64{1, 1}),
+		),
+	}}
+
+	warnings := ApplyExpressions(resp, []models.FieldExpression{
+		{Name: "error %", Expr: "$A.errors / $A.total * 100"},
+		{Name: "latency", Expr: "$A.duration * 1000"},
+	}, "A")
+	assert.Equal(t, []string{"expression latency skipped: no series has the fields duration"}, warnings)
+
+	checkout := resp.Frames[0].Fields[3]
+	assert.Equal(t, "error %", checkout.Name)
+	assert.Equal(t, data.Labels{"appName": "checkout"}, checkout.Labels)
+	value, ok := checkout.ConcreteAt(0)
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, value)
+	_, ok = checkout.ConcreteAt(1)
+	assert.False(t, ok, "null operands give null")
+
+	// Only the series with both fields get one in a wide frame
+	wide := resp.Frames[1]
+	require.Len(t, wide.Fields, 5)
+	assert.Equal(t, data.Labels{"appName": "a"}, wide.Fields[4].Labels)
+	_, ok = wide.Fields[4].ConcreteAt(1)
+	assert.False(t, ok, "division by zero gives null")
+}
@@ -0,0 +1,81 @@
+package formatter
+
+import (
+	"sort"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// ApplyFacetAs rewrites how facet values appear in the frames of resp. The faceted
+// formatters emit facet values as field labels; with models.FacetAsColumn they are
+// moved into dedicated string columns, and with models.FacetAsBoth the columns are
+// added while the labels are kept. Frames whose labeled fields disagree on their
+// labels cannot be represented as columns and are left unchanged.
+func ApplyFacetAs(resp *backend.DataResponse, facetAs string) {
+	if resp == nil || facetAs == "" || facetAs == models.FacetAsLabels {
+		return
+	}
+	for _, frame := range resp.Frames {
+		labels, ok := sharedFieldLabels(frame)
+		if !ok || len(labels) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		rows, _ := frame.RowLen()
+		columns := make([]*data.Field, 0, len(keys))
+		for _, key := range keys {
+			values := make([]string, rows)
+			for i := range values {
+				values[i] = labels[key]
+			}
+			columns = append(columns, data.NewField(key, nil, values))
+		}
+
+		if facetAs == models.FacetAsColumn {
+			for _, field := range frame.Fields {
+				field.Labels = nil
+			}
+		}
+
+		// Keep a leading time field first so the frame stays a valid time series
+		insertAt := 0
+		if len(frame.Fields) > 0 && frame.Fields[0].Type().Time() {
+			insertAt = 1
+		}
+		fields := make([]*data.Field, 0, len(frame.Fields)+len(columns))
+		fields = append(fields, frame.Fields[:insertAt]...)
+		fields = append(fields, columns...)
+		fields = append(fields, frame.Fields[insertAt:]...)
+		frame.Fields = fields
+
+		dedupeFieldNames(frame)
+	}
+}
+
+// sharedFieldLabels returns the labels shared by every labeled field of the frame.
+// It reports false if two labeled fields have different labels.
+func sharedFieldLabels(frame *data.Frame) (data.Labels, bool) {
+	var shared data.Labels
+	for _, field := range frame.Fields {
+		if len(field.Labels) == 0 {
+			continue
+		}
+		if shared == nil {
+			shared = field.Labels
+			continue
+		}
+		if !shared.Equals(field.Labels) {
+			return nil, false
+		}
+	}
+	return shared, true
+}
@@ -0,0 +1,104 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// facetedAggregationResults returns faceted timeseries results for two apps.
+func facetedAggregationResults() *nrdb.NRDBResultContainer {
+	return &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": "app1", "appName": "app1", "average.duration": 1.5, "beginTimeSeconds": 1700000000.0},
+			{"facet": "app1", "appName": "app1", "average.duration": 2.5, "beginTimeSeconds": 1700000060.0},
+			{"facet": "app2", "appName": "app2", "average.duration": 3.5, "beginTimeSeconds": 1700000000.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+}
+
+func TestApplyFacetAs(t *testing.T) {
+	tests := []struct {
+		name       string
+		facetAs    string
+		wantColumn bool
+		wantLabels bool
+	}{
+		{name: "default keeps labels", facetAs: "", wantColumn: false, wantLabels: true},
+		{name: "labels", facetAs: models.FacetAsLabels, wantColumn: false, wantLabels: true},
+		{name: "column", facetAs: models.FacetAsColumn, wantColumn: true, wantLabels: false},
+		{name: "both", facetAs: models.FacetAsBoth, wantColumn: true, wantLabels: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := FormatQueryResults(facetedAggregationResults(), backend.DataQuery{})
+			require.NoError(t, resp.Error)
+			require.Len(t, resp.Frames, 2)
+
+			ApplyFacetAs(resp, tt.facetAs)
+
+			for _, frame := range resp.Frames {
+				assert.True(t, frame.Fields[0].Type().Time(), "time field stays first")
+
+				column, _ := frame.FieldByName("appName")
+				assert.Equal(t, tt.wantColumn, column != nil)
+				if column != nil {
+					rows, err := frame.RowLen()
+					require.NoError(t, err)
+					assert.Equal(t, rows, column.Len())
+					assert.Equal(t, frame.Name, column.At(0))
+				}
+
+				value, _ := frame.FieldByName("average.duration")
+				require.NotNil(t, value)
+				assert.Equal(t, tt.wantLabels, value.Labels != nil)
+			}
+		})
+	}
+}
+
+func TestApplyFacetAs_FacetedCount(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"count": 10.0, "facet": "app1", "appName": "app1"},
+			{"count": 20.0, "facet": "app2", "appName": "app2"},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+
+	resp := FormatQueryResults(results, backend.DataQuery{})
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+
+	ApplyFacetAs(resp, models.FacetAsColumn)
+	for _, frame := range resp.Frames {
+		column, _ := frame.FieldByName("appName")
+		require.NotNil(t, column)
+		count, _ := frame.FieldByName("count")
+		require.NotNil(t, count)
+		assert.Nil(t, count.Labels)
+	}
+}
+
+func TestApplyFacetAs_MixedLabelsUnchanged(t *testing.T) {
+	frame := data.NewFrame("mixed",
+		data.NewField("time", nil, []time.Time{time.Unix(0, 0)}),
+		data.NewField("count", data.Labels{"appName": "a"}, []float64{1}),
+		data.NewField("count", data.Labels{"appName": "b"}, []float64{2}),
+	)
+	resp := &backend.DataResponse{Frames: data.Frames{frame}}
+
+	ApplyFacetAs(resp, models.FacetAsColumn)
+
+	assert.Len(t, frame.Fields, 3)
+	assert.Equal(t, data.Labels{"appName": "a"}, frame.Fields[1].Labels)
+}
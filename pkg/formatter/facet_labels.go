@@ -0,0 +1,161 @@
+package formatter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// facetPrefixSeparators are the characters a trimmed facet value prefix ends with.
+const facetPrefixSeparators = "/.:-_| "
+
+// FacetLabelValues returns the distinct values of the field labels of resp, sorted.
+func FacetLabelValues(resp *backend.DataResponse) []string {
+	if resp == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var values []string
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields {
+			for _, value := range field.Labels {
+				if !seen[value] {
+					seen[value] = true
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// ApplyFacetLabels replaces the field label values of resp that have a display
+// name in mappings, keyed by raw value. With trimPrefix, the leading text all
+// the values of a label share, up to and including a separator such as / or .,
+// is then removed, e.g. https://example.com/api/users and
+// https://example.com/api/orders become users and orders. Labels with a single
+// value are not trimmed. Frames named after the facet values of their series
+// are renamed to match.
+func ApplyFacetLabels(resp *backend.DataResponse, mappings map[string]string, trimPrefix bool) {
+	if resp == nil || (len(mappings) == 0 && !trimPrefix) {
+		return
+	}
+
+	// Frames of a facet value are named by the labels of their series
+	named := make(map[*data.Frame]bool)
+	for _, frame := range resp.Frames {
+		if labels := firstFieldLabels(frame); len(labels) > 0 && frame.Name == facetValue(labels) {
+			named[frame] = true
+		}
+	}
+
+	if len(mappings) > 0 {
+		relabelFields(resp, func(_, value string) string {
+			if mapped, ok := mappings[value]; ok {
+				return mapped
+			}
+			return value
+		})
+	}
+	if trimPrefix {
+		prefixes := labelPrefixes(resp)
+		if len(prefixes) > 0 {
+			relabelFields(resp, func(name, value string) string {
+				return strings.TrimPrefix(value, prefixes[name])
+			})
+		}
+	}
+
+	for frame := range named {
+		frame.Name = facetValue(firstFieldLabels(frame))
+	}
+}
+
+// relabelFields replaces the label values of the fields of resp with relabel
+// of their label name and value. Labels are copied, as fields may share them.
+func relabelFields(resp *backend.DataResponse, relabel func(name, value string) string) {
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields {
+			if len(field.Labels) == 0 {
+				continue
+			}
+			labels := make(data.Labels, len(field.Labels))
+			for name, value := range field.Labels {
+				labels[name] = relabel(name, value)
+			}
+			field.Labels = labels
+		}
+	}
+}
+
+// labelPrefixes returns, by label name, the prefix every value of the label
+// shares, up to its last separator. Labels whose values share none, or that
+// would be left empty, are missing.
+func labelPrefixes(resp *backend.DataResponse) map[string]string {
+	values := make(map[string]map[string]bool)
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields {
+			for name, value := range field.Labels {
+				if values[name] == nil {
+					values[name] = make(map[string]bool)
+				}
+				values[name][value] = true
+			}
+		}
+	}
+
+	prefixes := make(map[string]string)
+	for name, distinct := range values {
+		if len(distinct) < 2 {
+			continue
+		}
+		prefix := ""
+		first := true
+		for value := range distinct {
+			if first {
+				prefix, first = value, false
+				continue
+			}
+			prefix = commonPrefix(prefix, value)
+		}
+		prefix = prefix[:strings.LastIndexAny(prefix, facetPrefixSeparators)+1]
+		if prefix == "" {
+			continue
+		}
+		emptied := false
+		for value := range distinct {
+			if len(value) == len(prefix) {
+				emptied = true
+				break
+			}
+		}
+		if !emptied {
+			prefixes[name] = prefix
+		}
+	}
+	return prefixes
+}
+
+// commonPrefix returns the longest prefix of a and b.
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// firstFieldLabels returns the labels of the first labeled field of frame.
+func firstFieldLabels(frame *data.Frame) data.Labels {
+	for _, field := range frame.Fields {
+		if len(field.Labels) > 0 {
+			return field.Labels
+		}
+	}
+	return nil
+}
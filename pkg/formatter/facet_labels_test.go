@@ -0,0 +1,56 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyFacetLabels(t *testing.T) {
+	newResponse := func() *backend.DataResponse {
+		at := []time.Time{time.Unix(0, 0)}
+		shared := data.Labels{"request.uri": "https://example.com/api/users", "appName": "MXxBUE18QVBQTElDQVRJT058MQ"}
+		return &backend.DataResponse{Frames: data.Frames{
+			data.NewFrame("MXxBUE18QVBQTElDQVRJT058MQ, https://example.com/api/users",
+				data.NewField("time", nil, at),
+				data.NewField("count", shared, []float64{1}),
+				data.NewField("average.duration", shared, []float64{2}),
+			),
+			data.NewFrame("custom name",
+				data.NewField("time", nil, at),
+				data.NewField("count", data.Labels{"request.uri": "https://example.com/api/orders", "appName": "billing"}, []float64{3}),
+			),
+		}}
+	}
+
+	t.Run("mappings", func(t *testing.T) {
+		resp := newResponse()
+		ApplyFacetLabels(resp, map[string]string{"MXxBUE18QVBQTElDQVRJT058MQ": "checkout"}, false)
+		assert.Equal(t, "checkout", resp.Frames[0].Fields[1].Labels["appName"])
+		assert.Equal(t, "checkout", resp.Frames[0].Fields[2].Labels["appName"])
+		assert.Equal(t, "checkout, https://example.com/api/users", resp.Frames[0].Name, "frames named by their facet values are renamed")
+		assert.Equal(t, "custom name", resp.Frames[1].Name)
+	})
+
+	t.Run("trim prefix", func(t *testing.T) {
+		resp := newResponse()
+		ApplyFacetLabels(resp, nil, true)
+		assert.Equal(t, "users", resp.Frames[0].Fields[1].Labels["request.uri"])
+		assert.Equal(t, "orders", resp.Frames[1].Fields[1].Labels["request.uri"])
+		assert.Equal(t, "billing", resp.Frames[1].Fields[1].Labels["appName"], "values without a shared prefix are kept")
+	})
+
+	t.Run("values are not emptied", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{data.NewFrame("",
+			data.NewField("a", data.Labels{"path": "/api/"}, []float64{1}),
+			data.NewField("b", data.Labels{"path": "/api/users"}, []float64{1}),
+		)}}
+		ApplyFacetLabels(resp, nil, true)
+		assert.Equal(t, "/api/", resp.Frames[0].Fields[0].Labels["path"])
+	})
+
+	assert.Equal(t, []string{"MXxBUE18QVBQTElDQVRJT058MQ", "billing", "https://example.com/api/orders", "https://example.com/api/users"}, FacetLabelValues(newResponse()))
+}
@@ -0,0 +1,39 @@
+package formatter
+
+import (
+	"path"
+
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// forcedFieldType returns the type the first matching rule forces on a result
+// field, matched on the field name or on the attribute of an aggregation, so
+// a rule for orderId also applies to latest.orderId.
+func forcedFieldType(rules []models.FieldTypeRule, fieldName string) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+	_, attribute := splitFieldName(fieldName)
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.Pattern, fieldName); matched {
+			return rule.Type, true
+		}
+		if attribute != "" && attribute != fieldName {
+			if matched, _ := path.Match(rule.Pattern, attribute); matched {
+				return rule.Type, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isComposite reports whether v is an object or array, such as a percentile()
+// or histogram() result. Forced types do not apply to fields holding them.
+func isComposite(v interface{}) bool {
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+		return true
+	default:
+		return false
+	}
+}
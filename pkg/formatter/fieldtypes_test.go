@@ -0,0 +1,105 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForcedFieldType(t *testing.T) {
+	rules := []models.FieldTypeRule{
+		{Pattern: "orderId", Type: models.FieldTypeString},
+		{Pattern: "*.enabled", Type: models.FieldTypeBoolean},
+		{Pattern: "*Time", Type: models.FieldTypeTimestamp},
+	}
+	tests := []struct {
+		fieldName string
+		wantType  string
+		wantOK    bool
+	}{
+		{"orderId", models.FieldTypeString, true},
+		{"latest.orderId", models.FieldTypeString, true},
+		{"feature.enabled", models.FieldTypeBoolean, true},
+		{"startTime", models.FieldTypeTimestamp, true},
+		{"max.startTime", models.FieldTypeTimestamp, true},
+		{"customerId", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fieldName, func(t *testing.T) {
+			fieldType, ok := forcedFieldType(rules, tt.fieldName)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantType, fieldType)
+		})
+	}
+
+	_, ok := forcedFieldType(nil, "orderId")
+	assert.False(t, ok, "no rules")
+}
+
+func TestFormatQueryResults_FieldTypes(t *testing.T) {
+	opts := FormatOptions{FieldTypes: []models.FieldTypeRule{
+		{Pattern: "orderId", Type: models.FieldTypeString},
+		{Pattern: "startedAt", Type: models.FieldTypeTimestamp},
+		{Pattern: "enabled", Type: models.FieldTypeBoolean},
+		{Pattern: "duration", Type: models.FieldTypeString},
+	}}
+	field := func(t *testing.T, frame *data.Frame, name string) *data.Field {
+		f, _ := frame.FieldByName(name)
+		require.NotNil(t, f, "field %s", name)
+		return f
+	}
+
+	t.Run("events", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"timestamp": 1700000000000.0, "orderId": "00123", "startedAt": "1700000000000", "enabled": "true", "duration": 0.5},
+			{"timestamp": 1700000001000.0, "orderId": "00456", "startedAt": 1700000001000.0, "enabled": 0.0, "duration": 1.5},
+		}}
+		resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, opts)
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 1)
+		frame := resp.Frames[0]
+
+		orderID := field(t, frame, "orderId")
+		assert.Equal(t, data.FieldTypeString, orderID.Type())
+		assert.Equal(t, "00123", orderID.At(0), "numeric strings keep their leading zeros")
+
+		startedAt := field(t, frame, "startedAt")
+		assert.Equal(t, data.FieldTypeNullableTime, startedAt.Type())
+		assert.Equal(t, time.UnixMilli(1700000000000).UTC(), startedAt.At(0).(*time.Time).UTC())
+
+		enabled := field(t, frame, "enabled")
+		assert.Equal(t, data.FieldTypeNullableBool, enabled.Type())
+		assert.True(t, *enabled.At(0).(*bool))
+		assert.False(t, *enabled.At(1).(*bool))
+
+		assert.Equal(t, data.FieldTypeString, field(t, frame, "duration").Type(), "numbers forced to strings")
+	})
+
+	t.Run("aggregations", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"latest.orderId": 12345678901234.0, "average.latency": 0.5},
+		}}
+		resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, opts)
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 1)
+
+		orderID := field(t, resp.Frames[0], "latest.orderId")
+		require.Equal(t, data.FieldTypeString, orderID.Type())
+		assert.Equal(t, "12345678901234", orderID.At(0), "numbers are written in full")
+		assert.Equal(t, data.FieldTypeNullableFloat64, field(t, resp.Frames[0], "average.latency").Type())
+	})
+
+	t.Run("objects keep their type", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"orderId": map[string]interface{}{"50": 1.0}},
+		}}
+		assert.Equal(t, "object", detectFieldType(results.Results, "orderId", opts.FieldTypes))
+	})
+}
@@ -0,0 +1,98 @@
+package formatter
+
+import (
+	"strconv"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// MaxFlattenDepth is the most levels of nested attribute values a query flattens.
+const MaxFlattenDepth = 10
+
+// flattenResults returns results with the nested object and array values of
+// its rows flattened into a column per leaf, named by the dotted path of the
+// leaf, e.g. attributes.request.headers.host, and array elements by their
+// index, e.g. tags.0. Values nested deeper than depth levels are kept whole,
+// so they are still shown as JSON text. Aggregation results such as
+// percentile() and apdex() objects, which have formatters of their own, and
+// columns the row already has are left as they are. Results without nested
+// values are returned unchanged; the rows of results are never modified, as
+// they may be cached.
+func flattenResults(results *nrdb.NRDBResultContainer, depth int) *nrdb.NRDBResultContainer {
+	if depth <= 0 {
+		return results
+	}
+	var flattened []nrdb.NRDBResult
+	for i, row := range results.Results {
+		if !hasNestedValues(row) {
+			if flattened != nil {
+				flattened = append(flattened, row)
+			}
+			continue
+		}
+		if flattened == nil {
+			flattened = make([]nrdb.NRDBResult, i, len(results.Results))
+			copy(flattened, results.Results[:i])
+		}
+		flat := make(nrdb.NRDBResult, len(row))
+		for name, value := range row {
+			if !isNestedValue(value) {
+				flat[name] = value
+			}
+		}
+		for name, value := range row {
+			if isNestedValue(value) {
+				flattenValue(flat, name, value, depth)
+			}
+		}
+		flattened = append(flattened, flat)
+	}
+	if flattened == nil {
+		return results
+	}
+	copied := *results
+	copied.Results = flattened
+	return &copied
+}
+
+// hasNestedValues reports whether row has a nested value to flatten.
+func hasNestedValues(row nrdb.NRDBResult) bool {
+	for name, value := range row {
+		if isNestedValue(value) && !isAggregationField(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNestedValue reports whether value is a non-empty object or array.
+func isNestedValue(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// flattenValue sets the leaves of value under path in row, down to depth
+// levels. Paths the row already has keep their value.
+func flattenValue(row nrdb.NRDBResult, path string, value interface{}, depth int) {
+	if depth == 0 || !isNestedValue(value) || isAggregationField(path) {
+		if _, exists := row[path]; !exists {
+			row[path] = value
+		}
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenValue(row, path+"."+key, child, depth-1)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(row, path+"."+strconv.Itoa(i), child, depth-1)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenResults(t *testing.T) {
+	row := nrdb.NRDBResult{
+		"timestamp": 1700000000000.0,
+		"message":   "GET /",
+		"attributes": map[string]interface{}{
+			"request": map[string]interface{}{
+				"headers": map[string]interface{}{"host": "example.com", "accept": []interface{}{"text/html", "*/*"}},
+				"method":  "GET",
+			},
+		},
+		"tags":                []interface{}{"a", map[string]interface{}{"team": "web"}},
+		"empty":               map[string]interface{}{},
+		"percentile.duration": map[string]interface{}{"95": 1.5},
+	}
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"timestamp": 1.0}, row}}
+
+	flat := flattenResults(results, MaxFlattenDepth).Results[1]
+	assert.Equal(t, "example.com", flat["attributes.request.headers.host"])
+	assert.Equal(t, "*/*", flat["attributes.request.headers.accept.1"])
+	assert.Equal(t, "GET", flat["attributes.request.method"])
+	assert.Equal(t, "web", flat["tags.1.team"])
+	assert.Equal(t, "a", flat["tags.0"])
+	assert.Equal(t, map[string]interface{}{}, flat["empty"], "empty objects are kept")
+	assert.Equal(t, map[string]interface{}{"95": 1.5}, flat["percentile.duration"], "aggregation results are kept")
+	assert.NotContains(t, flat, "attributes")
+	assert.Contains(t, row, "attributes", "rows are not modified")
+	assert.Equal(t, nrdb.NRDBResult{"timestamp": 1.0}, flattenResults(results, 1).Results[0])
+
+	// Deeper values are kept whole
+	flat = flattenResults(results, 2).Results[1]
+	assert.Equal(t, map[string]interface{}{"host": "example.com", "accept": []interface{}{"text/html", "*/*"}}, flat["attributes.request.headers"])
+
+	// Columns the row already has keep their value
+	flat = flattenResults(&nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{
+		"request":        map[string]interface{}{"uri": "/nested"},
+		"request.uri":    "/flat",
+		"request.method": "GET",
+	}}}, 1).Results[0]
+	assert.Equal(t, "/flat", flat["request.uri"])
+
+	unnested := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": 1.0}}}
+	assert.Same(t, unnested, flattenResults(unnested, 3))
+	assert.Same(t, results, flattenResults(results, 0))
+}
+
+func TestFormatQueryResults_FlattenDepth(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "attributes": map[string]interface{}{"request": map[string]interface{}{"host": "a"}}},
+		{"timestamp": 1700000001000.0, "attributes": map[string]interface{}{"request": map[string]interface{}{"host": "b", "port": 443.0}}},
+	}}
+
+	resp := FormatQueryResultsWithOptions(results, backend.DataQuery{RefID: "A"}, FormatOptions{FlattenDepth: 3})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	host, _ := resp.Frames[0].FieldByName("attributes.request.host")
+	require.NotNil(t, host)
+	assert.Equal(t, 2, host.Len())
+	port, _ := resp.Frames[0].FieldByName("attributes.request.port")
+	require.NotNil(t, port)
+	assert.True(t, port.Type().Numeric(), "leaves keep their type")
+
+	resp = FormatQueryResultsWithOptions(results, backend.DataQuery{RefID: "A"}, FormatOptions{})
+	attributes, _ := resp.Frames[0].FieldByName("attributes")
+	assert.NotNil(t, attributes, "nested values are JSON text by default")
+}
@@ -6,10 +6,13 @@ package formatter
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
 	"newrelic-grafana-plugin/pkg/utils"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -26,28 +29,44 @@ func IsCountQuery(results *nrdb.NRDBResultContainer) bool {
 // FormatQueryResults creates a unified Grafana DataFrame from New Relic NRDB query results
 // that works for both count and regular queries, supporting both tabular and time series formats
 func FormatQueryResults(results *nrdb.NRDBResultContainer, query backend.DataQuery) *backend.DataResponse {
+	return formatQueryResults(results, query, FormatOptions{})
+}
+
+// formatQueryResults routes the results to the matching formatter, applying opts.
+func formatQueryResults(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
 	resp := &backend.DataResponse{}
 
 	// Print results as JSON for debugging
-	resultsJSON, _ := json.MarshalIndent(results, "", "  ")
-	log.DefaultLogger.Debug("Result count: %d\nResults:\n%s",
-		len(results.Results), string(resultsJSON))
+	if debugLogging() {
+		resultsJSON, _ := json.MarshalIndent(results, "", "  ")
+		log.DefaultLogger.Debug("Result count: %d\nResults:\n%s",
+			len(results.Results), string(resultsJSON))
+	}
 
 	if len(results.Results) == 0 {
 		return resp
 	}
 
-	// Route to appropriate formatter based on query type
-	if isSimpleCountQuery(results) {
-		return formatSimpleCountQuery(results, query)
-	} else if isFacetedCountQuery(results) {
-		return formatFacetedCountQuery(results, query)
-	} else if isFacetedTimeseriesQuery(results) {
-		// Handle faceted timeseries queries (e.g., "SELECT sum(duration) FROM Transaction facet request.uri TIMESERIES")
-		return formatFacetedTimeseriesQuery(results, query)
-	} else {
-		return formatStandardQuery(results, query)
+	// Route to the formatter registered for the result shape
+	route := matchRoute(results)
+	resp = route.Format(results, query, opts)
+	if route.Complete {
+		return resp
 	}
+	return markTimeSeriesFrames(dedupeResponseFieldNames(alignTimeseriesBuckets(resp, results.Results, query, opts.FillMode)))
+}
+
+// debugLogging reports whether debug messages are logged, so that results are
+// only rendered as JSON for the log when the text is used.
+func debugLogging() bool {
+	level := log.DefaultLogger.Level()
+	return level != log.NoLevel && level <= log.Debug
+}
+
+// detectRoute returns the name of the route that matches the results, in the
+// order FormatQueryResults checks them.
+func detectRoute(results *nrdb.NRDBResultContainer) string {
+	return matchRoute(results).Name
 }
 
 // isSimpleCountQuery checks if the results represent a simple count query
@@ -109,6 +128,11 @@ func isFacetedTimeseriesQueryMulti(results *nrdb.NRDBResultContainerMultiResultC
 	return result
 }
 
+// IsFacetedTimeseriesResult checks if a multi-result container holds faceted timeseries data.
+func IsFacetedTimeseriesResult(results *nrdb.NRDBResultContainerMultiResultCustomized) bool {
+	return isFacetedTimeseriesQueryMulti(results)
+}
+
 func hasTimeseriesData(results *nrdb.NRDBResultContainer) bool {
 	if len(results.Results) == 0 {
 		return false
@@ -173,9 +197,8 @@ func formatSimpleCountQuery(results *nrdb.NRDBResultContainer, query backend.Dat
 func createCountTimeSeriesFrame(count float64, query backend.DataQuery) *data.Frame {
 	graphFrame := data.NewFrame(utils.CountTimeSeriesFrameName)
 
-	// Add time points using current time (since we removed time range processing)
-	now := time.Now()
-	timePoints := []time.Time{now.Add(-time.Hour), now}
+	// The count covers the whole query time range, so span it
+	timePoints := []time.Time{queryStartTime(query), queryEndTime(query)}
 	graphFrame.Fields = append(graphFrame.Fields,
 		data.NewField("time", nil, timePoints))
 
@@ -209,8 +232,10 @@ func extractCountValueMulti(result nrdb.NRDBResult) float64 {
 	return 0.0
 }
 
-// formatFacetedCountQuery formats results from a faceted count query
-func formatFacetedCountQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery) *backend.DataResponse {
+// formatFacetedCountQuery formats results from a faceted count query. The counts
+// cover the whole query time range, so each frame is stamped according to
+// opts.FacetTime, or the results are returned as one table frame in table mode.
+func formatFacetedCountQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
 	resp := &backend.DataResponse{}
 
 	// Get facet names
@@ -221,24 +246,29 @@ func formatFacetedCountQuery(results *nrdb.NRDBResultContainer, query backend.Da
 	counts, facetFields := extractFacetedData(results, facetNames)
 	log.DefaultLogger.Debug("Counts: %v, Facet fields: %v", counts, facetFields)
 
+	if opts.FacetTime == models.FacetTimeTable {
+		resp.Frames = append(resp.Frames, createFacetTableFrame(facetNames, counts, facetFields))
+		return resp
+	}
+	stamp, stamped := facetCountTime(query, opts.FacetTime)
+
 	// Create separate frames for each facet value (like Grafana Cloud plugin)
 	if len(facetNames) > 0 {
-		facetName := facetNames[0] // Use the first facet for labels
-		facetValues := facetFields[facetName]
-
-		for i, facetValue := range facetValues {
-			// Create a frame for each facet value
+		for i := range facetFields[facetNames[0]] {
+			// Create a frame for each facet value tuple
 			frame := data.NewFrame("")
 
-			// Add time field
-			now := time.Now()
-			frame.Fields = append(frame.Fields,
-				data.NewField("time", nil, []time.Time{now}))
+			if stamped {
+				frame.Fields = append(frame.Fields,
+					data.NewField("time", nil, []time.Time{stamp}))
+			}
 
-			// Add count field with facet label (matching Grafana Cloud plugin)
-			countField := data.NewField("count", map[string]string{
-				facetName: facetValue,
-			}, []float64{counts[i]})
+			// Add count field labeled with every facet (matching Grafana Cloud plugin)
+			labels := data.Labels{}
+			for _, name := range facetNames {
+				labels[name] = facetFields[name][i]
+			}
+			countField := data.NewField("count", labels, []float64{counts[i]})
 			frame.Fields = append(frame.Fields, countField)
 
 			resp.Frames = append(resp.Frames, frame)
@@ -365,21 +395,35 @@ func createFacetTableFrame(facetNames []string, counts []float64, facetFields ma
 	return facetFrame
 }
 
-// createFacetTimeSeriesFrame creates a time series frame for faceted count queries
-func createFacetTimeSeriesFrame(facetNames []string, counts []float64, facetFields map[string][]string, query backend.DataQuery) *data.Frame {
+// facetCountTime returns the time to stamp faceted counts with for the facet
+// time mode, and false when the time field should be omitted.
+func facetCountTime(query backend.DataQuery, mode string) (time.Time, bool) {
+	switch mode {
+	case models.FacetTimeNone, models.FacetTimeTable:
+		return time.Time{}, false
+	case models.FacetTimeMidpoint:
+		start := queryStartTime(query)
+		return start.Add(queryEndTime(query).Sub(start) / 2), true
+	default:
+		return queryEndTime(query), true
+	}
+}
+
+// createFacetTimeSeriesFrame creates a time series frame for faceted count queries,
+// stamped according to the facet time mode
+func createFacetTimeSeriesFrame(facetNames []string, counts []float64, facetFields map[string][]string, query backend.DataQuery, mode string) *data.Frame {
 	timeSeriesFrame := data.NewFrame(utils.FacetedTimeSeriesFrameName)
 
-	// Create time points using current time
-	now := time.Now()
-	timePoints := make([]time.Time, len(counts))
-	for i := range timePoints {
-		timePoints[i] = now
+	// Create time points within the query time range the counts cover
+	if stamp, ok := facetCountTime(query, mode); ok {
+		timePoints := make([]time.Time, len(counts))
+		for i := range timePoints {
+			timePoints[i] = stamp
+		}
+		timeSeriesFrame.Fields = append(timeSeriesFrame.Fields,
+			data.NewField(utils.TimeFieldName, nil, timePoints))
 	}
 
-	// Add time field
-	timeSeriesFrame.Fields = append(timeSeriesFrame.Fields,
-		data.NewField(utils.TimeFieldName, nil, timePoints))
-
 	// Add facet fields
 	for _, facetName := range facetNames {
 		// Create labels for this field
@@ -406,46 +450,52 @@ func createFacetTimeSeriesFrame(facetNames []string, counts []float64, facetFiel
 
 // formatStandardQuery formats standard query results (time series or other data)
 // Now enhanced to handle both regular and faceted aggregation fields
-func formatStandardQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery) *backend.DataResponse {
+func formatStandardQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
 	resp := &backend.DataResponse{}
 
 	// Check if this is a faceted aggregation query (not count-based)
 	facetNames := extractFacetNames(results)
 	if len(facetNames) > 0 && !hasCountField(results) {
 		// This is a faceted aggregation query like "SELECT sum(duration) FROM Transaction facet request.uri TIMESERIES"
-		return formatFacetedAggregationQuery(results, query, facetNames)
+		return formatFacetedAggregationQuery(results, query, facetNames, opts)
 	}
 
+	// Nested attribute values become a column per leaf
+	results = flattenResults(results, opts.FlattenDepth)
+
 	// Standard single-frame response for non-faceted queries
 	frame := data.NewFrame(utils.StandardResponseFrameName)
 
-	// Extract field names
-	fieldNames := extractFieldNames(results)
+	// Extract field names, listed columns first and the rest alphabetically
+	fieldNames := orderColumns(extractFieldNames(results), opts.Columns)
 
 	// Add time field
 	times := createTimeField(results, query)
 	frame.Fields = append(frame.Fields, data.NewField(utils.TimeFieldName, nil, times))
 
-	// Add data fields
-	addDataFields(frame, results, fieldNames)
+	// Add data fields; event attributes are typed so that every page agrees
+	if isEventRows(results.Results) {
+		addEventFields(frame, results.Results, fieldNames, opts.FieldTypes)
+	} else {
+		addDataFields(frame, results, fieldNames, opts.FieldTypes)
+	}
 
 	resp.Frames = append(resp.Frames, frame)
 	return resp
 }
 
 // formatFacetedAggregationQuery handles faceted aggregation queries like Grafana Cloud
-// Creates separate frames for each facet value with proper labels
-func formatFacetedAggregationQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery, facetNames []string) *backend.DataResponse {
+// Creates separate frames for each facet value with proper labels, or a single
+// wide frame with a column per facet value when opts.Wide is set
+func formatFacetedAggregationQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery, facetNames []string, opts FormatOptions) *backend.DataResponse {
 	resp := &backend.DataResponse{}
 
 	if len(facetNames) == 0 {
 		return resp
 	}
 
-	facetName := facetNames[0] // Use the first facet for grouping
-
-	// Group results by facet value
-	facetData := groupResultsByFacet(results, facetName)
+	// Group results by facet value tuple
+	facetData, unfaceted := groupByFacetValue(results.Results, opts.KeepUnfaceted)
 	log.DefaultLogger.Debug("Faceted aggregation - Grouped into %d facet groups", len(facetData))
 
 	// Get all field names and filter to only include aggregation fields
@@ -461,106 +511,70 @@ func formatFacetedAggregationQuery(results *nrdb.NRDBResultContainer, query back
 
 	log.DefaultLogger.Debug("Faceted aggregation - Aggregation fields: %v", aggregationFields)
 
-	// Create separate frames for each facet value
-	for facetValue, facetResults := range facetData {
+	// Series of dimensional metrics are labeled with all their dimensions
+	metric := isMetricResult(results)
+
+	// Create separate frames for each facet value, in a stable order
+	valueField := ""
+	if len(aggregationFields) > 0 {
+		valueField = aggregationFields[0]
+	}
+	for _, facetValue := range sortedFacetValues(facetData, opts.FacetOrder, valueField) {
+		facetResults := facetData[facetValue]
 		// Use facet value directly in the frame name
 		log.DefaultLogger.Debug("Creating frame with facet value: %s", facetValue)
 		frame := data.NewFrame(facetValue)
 		times := createTimeField(&nrdb.NRDBResultContainer{Results: facetResults}, query)
 		frame.Fields = append(frame.Fields, data.NewField("time", nil, times))
 
-		// Add aggregation fields with facet labels
+		// Add aggregation fields labeled with every facet
+		labels := facetLabels(facetResults, facetNames, facetValue)
+		if metric && facetValue != UnfacetedGroupName {
+			labels = dimensionLabels(facetResults, aggregationFields, labels)
+		}
 		for _, fieldName := range aggregationFields {
 			// Handle different aggregation field types
 			if strings.HasPrefix(fieldName, "percentile.") {
 				// Handle percentile objects - extract individual percentile values
-				addPercentileFields(frame, facetResults, fieldName, facetName, facetValue)
+				addPercentileFields(frame, facetResults, fieldName, labels)
+			} else if isApdexField(facetResults, fieldName) {
+				// Handle apdex objects - extract the score and counts
+				addApdexFields(frame, facetResults, fieldName, labels)
+			} else if isFunnelField(facetResults, fieldName) {
+				// Handle funnel results - extract the step counts
+				addFunnelFields(frame, facetResults, fieldName, labels)
 			} else {
 				// Handle regular aggregation fields (sum.duration, average.duration, etc.)
-				addRegularAggregationField(frame, facetResults, fieldName, facetName, facetValue)
+				addRegularAggregationField(frame, facetResults, fieldName, labels)
 			}
 		}
 
 		resp.Frames = append(resp.Frames, frame)
 	}
 
+	if opts.Wide && len(resp.Frames) > 0 {
+		resp.Frames = data.Frames{wideFrame(resp.Frames)}
+	}
+
+	if unfaceted > 0 {
+		log.DefaultLogger.Debug("Faceted aggregation - Rows without facet value", "count", unfaceted, "kept", opts.KeepUnfaceted)
+		AppendNotices(resp, unfacetedNotice(unfaceted, opts.KeepUnfaceted))
+	}
+
 	log.DefaultLogger.Debug("Faceted aggregation - Total frames in response: %d", len(resp.Frames))
 	return resp
 }
 
 // addPercentileFields handles percentile objects by extracting individual percentile values
-func addPercentileFields(frame *data.Frame, facetResults []nrdb.NRDBResult, fieldName, facetName, facetValue string) {
-	// First pass: collect all percentile keys across all results
-	percentileKeys := make(map[string]bool)
-	for _, result := range facetResults {
-		if result[fieldName] != nil {
-			if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-				for key := range objVal {
-					percentileKeys[key] = true
-				}
-			}
-		}
-	}
-
-	// Create a field for each percentile (e.g., percentile.duration.95)
-	for percentileKey := range percentileKeys {
-		fieldNameWithPercentile := fmt.Sprintf("%s.%s", fieldName, percentileKey)
-		labels := map[string]string{
-			facetName: facetValue,
-		}
-
-		// Extract values for this specific percentile
-		values := make([]*float64, len(facetResults))
-		for i, result := range facetResults {
-			if result[fieldName] != nil {
-				if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-					if percentileVal, exists := objVal[percentileKey]; exists {
-						if floatVal, ok := percentileVal.(float64); ok {
-							values[i] = &floatVal
-						} else if strVal, ok := percentileVal.(string); ok {
-							if parsed, err := parseNumericString(strVal); err == nil {
-								values[i] = &parsed
-							}
-						}
-					}
-				}
-			}
-		}
-
-		// Create field with facet label
-		field := data.NewField(fieldNameWithPercentile, labels, values)
-		frame.Fields = append(frame.Fields, field)
-	}
+func addPercentileFields(frame *data.Frame, facetResults []nrdb.NRDBResult, fieldName string, labels data.Labels) {
+	addPercentileValueFields(frame, facetResults, fieldName, labels)
 }
 
 // addRegularAggregationField handles regular aggregation fields (sum.duration, average.duration, etc.)
-func addRegularAggregationField(frame *data.Frame, facetResults []nrdb.NRDBResult, fieldName, facetName, facetValue string) {
-	labels := map[string]string{
-		facetName: facetValue,
-	}
-
-	// Extract values for this field
-	values := make([]*float64, len(facetResults))
-	for i, result := range facetResults {
-		if result[fieldName] != nil && result[fieldName] != "" {
-			if val, ok := result[fieldName].(float64); ok {
-				values[i] = &val
-			} else if strVal, ok := result[fieldName].(string); ok && strVal != "" {
-				if parsed, err := parseNumericString(strVal); err == nil {
-					values[i] = &parsed
-				}
-			} else if intVal, ok := result[fieldName].(int); ok {
-				floatVal := float64(intVal)
-				values[i] = &floatVal
-			} else if int64Val, ok := result[fieldName].(int64); ok {
-				floatVal := float64(int64Val)
-				values[i] = &floatVal
-			}
-		}
-	}
-
-	// Create field with facet label
-	field := data.NewField(fieldName, labels, values)
+func addRegularAggregationField(frame *data.Frame, facetResults []nrdb.NRDBResult, fieldName string, labels data.Labels) {
+	// Create field with facet labels
+	field := convertField(fieldName, facetResults, fieldName, "number")
+	field.Labels = labels
 	frame.Fields = append(frame.Fields, field)
 }
 
@@ -576,21 +590,7 @@ func isFacetFieldName(fieldName string, facetNames []string) bool {
 
 // groupResultsByFacet groups results by facet value for aggregation queries
 func groupResultsByFacet(results *nrdb.NRDBResultContainer, facetName string) map[string][]nrdb.NRDBResult {
-	grouped := make(map[string][]nrdb.NRDBResult)
-
-	for _, result := range results.Results {
-		facetValue := ""
-		if facetArray, ok := result[utils.FacetFieldName].([]interface{}); ok && len(facetArray) > 0 {
-			facetValue = fmt.Sprintf("%v", facetArray[0])
-		} else if result[utils.FacetFieldName] != nil {
-			facetValue = fmt.Sprintf("%v", result[utils.FacetFieldName])
-		}
-
-		if facetValue != "" {
-			grouped[facetValue] = append(grouped[facetValue], result)
-		}
-	}
-
+	grouped, _ := groupByFacetValue(results.Results, false)
 	return grouped
 }
 
@@ -603,7 +603,7 @@ func hasCountField(results *nrdb.NRDBResultContainer) bool {
 	return hasCount
 }
 
-// extractFieldNames extracts unique field names from results
+// extractFieldNames extracts unique field names from results in ascending order
 func extractFieldNames(results *nrdb.NRDBResultContainer) []string {
 	fieldNamesMap := make(map[string]struct{})
 	for _, result := range results.Results {
@@ -619,6 +619,7 @@ func extractFieldNames(results *nrdb.NRDBResultContainer) []string {
 	for key := range fieldNamesMap {
 		fieldNames = append(fieldNames, key)
 	}
+	sort.Strings(fieldNames)
 
 	return fieldNames
 }
@@ -626,18 +627,18 @@ func extractFieldNames(results *nrdb.NRDBResultContainer) []string {
 // createTimeField creates a time field from result timestamps
 func createTimeField(results *nrdb.NRDBResultContainer, query backend.DataQuery) []time.Time {
 	times := make([]time.Time, len(results.Results))
-	now := time.Now()
+	end := queryEndTime(query)
 
 	for i, result := range results.Results {
 		// First check for standard timestamp field
-		if ts, ok := result[utils.TimestampFieldName].(float64); ok {
-			times[i] = time.Unix(int64(ts/1000), 0)
+		if ts, ok := numberValue(result[utils.TimestampFieldName]); ok {
+			times[i] = timeutil.FromEpoch(ts)
 		} else if beginTs, ok := result["beginTimeSeconds"].(float64); ok {
 			// Handle New Relic TIMESERIES data which uses beginTimeSeconds
-			times[i] = time.Unix(int64(beginTs), 0)
+			times[i] = timeutil.FromEpochSeconds(beginTs)
 		} else {
-			// Fallback to current time instead of query time range
-			times[i] = now
+			// Aggregates without TIMESERIES cover the whole query time range
+			times[i] = end
 		}
 	}
 	return times
@@ -649,180 +650,99 @@ func parseNumericString(s string) (float64, error) {
 	return strconv.ParseFloat(s, 64)
 }
 
-// addDataFields adds data fields to the frame based on their types
-func addDataFields(frame *data.Frame, results *nrdb.NRDBResultContainer, fieldNames []string) {
-	for _, fieldName := range fieldNames {
-		if len(results.Results) > 0 {
-			// Use improved field type detection
-			fieldType := detectFieldType(results.Results, fieldName)
-
-			switch fieldType {
-			case "number":
-				// Use nullable float64 to handle nil/empty values properly
-				values := make([]*float64, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil && result[fieldName] != "" {
-						if val, ok := result[fieldName].(float64); ok {
-							values[i] = &val
-						} else if strVal, ok := result[fieldName].(string); ok && strVal != "" {
-							// Try to parse scientific notation strings
-							if parsed, err := parseNumericString(strVal); err == nil {
-								values[i] = &parsed
-							}
-						} else if intVal, ok := result[fieldName].(int); ok {
-							floatVal := float64(intVal)
-							values[i] = &floatVal
-						} else if int64Val, ok := result[fieldName].(int64); ok {
-							floatVal := float64(int64Val)
-							values[i] = &floatVal
-						}
-					}
-					// For nil/empty values, values[i] remains nil (which becomes null in JSON)
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			case "timestamp":
-				// Handle timestamp fields specially
-				values := make([]*time.Time, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil && result[fieldName] != "" {
-						if timestampVal, ok := result[fieldName].(float64); ok {
-							// Convert Unix timestamp to time.Time
-							t := time.Unix(int64(timestampVal/1000), 0)
-							values[i] = &t
-						} else if timestampStr, ok := result[fieldName].(string); ok {
-							// Try to parse timestamp string
-							if parsed, err := strconv.ParseFloat(timestampStr, 64); err == nil {
-								t := time.Unix(int64(parsed/1000), 0)
-								values[i] = &t
-							}
-						}
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			case "array":
-				// Handle arrays (like histogram, uniques) - convert to JSON string for display
-				values := make([]string, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil {
-						if arrayVal, ok := result[fieldName].([]interface{}); ok {
-							// Convert array to JSON string for better display
-							if jsonBytes, err := json.Marshal(arrayVal); err == nil {
-								values[i] = string(jsonBytes)
-							} else {
-								values[i] = fmt.Sprintf("%v", arrayVal)
-							}
-						} else {
-							values[i] = fmt.Sprintf("%v", result[fieldName])
-						}
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			case "object":
-				// Handle objects (like percentile results) - convert to JSON string or extract values
-				if strings.HasPrefix(fieldName, "percentile.") {
-					// Special handling for percentile objects - try to extract individual percentile values
-					handlePercentileField(frame, results, fieldName)
-				} else {
-					// General object handling - convert to JSON string
-					values := make([]string, len(results.Results))
-					for i, result := range results.Results {
-						if result[fieldName] != nil {
-							if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-								if jsonBytes, err := json.Marshal(objVal); err == nil {
-									values[i] = string(jsonBytes)
-								} else {
-									values[i] = fmt.Sprintf("%v", objVal)
-								}
-							} else {
-								values[i] = fmt.Sprintf("%v", result[fieldName])
-							}
-						}
-					}
-					frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-				}
+// addDataFields adds data fields to the frame, converting each field's values
+// with the converter registered for its detected type
+func addDataFields(frame *data.Frame, results *nrdb.NRDBResultContainer, fieldNames []string, rules []models.FieldTypeRule) {
+	addResultFields(frame, results.Results, fieldNames, rules)
+}
 
-			case "boolean":
-				// Handle boolean values
-				values := make([]*bool, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil {
-						if boolVal, ok := result[fieldName].(bool); ok {
-							values[i] = &boolVal
-						}
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			default: // "string" and fallback
-				// Convert to string for other types
-				values := make([]string, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil {
-						values[i] = fmt.Sprintf("%v", result[fieldName])
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-			}
+// addResultFields adds a field per name, converting values according to the type
+// detected by detectFieldType, or forced by rules. Percentile objects are expanded into a field per
+// percentile, apdex() objects into a field per component and funnel() results
+// into a field per step. The values are gathered in one pass over the rows, and
+// the fields of large results are converted concurrently.
+func addResultFields(frame *data.Frame, rows []nrdb.NRDBResult, fieldNames []string, rules []models.FieldTypeRule) {
+	if len(rows) == 0 {
+		return
+	}
+	columns := collectColumns(rows, fieldNames)
+	defer releaseColumns(columns)
+	frame.Fields = append(frame.Fields, buildFields(fieldNames, len(rows), func(fieldName string) []*data.Field {
+		// Expanded objects are added to a scratch frame, as fields are built concurrently
+		expanded := data.NewFrame("")
+		switch fieldType := detectFieldType(rows, fieldName, rules); {
+		case fieldType == "apdex":
+			addApdexFields(expanded, rows, fieldName, nil)
+		case fieldType == "funnel":
+			addFunnelFields(expanded, rows, fieldName, nil)
+		case fieldType == "object" && strings.HasPrefix(fieldName, "percentile."):
+			// Try to extract individual percentile values
+			addPercentileValueFields(expanded, rows, fieldName, nil)
+		default:
+			return []*data.Field{convertColumn(fieldName, columns[fieldName], fieldType)}
 		}
-	}
+		return expanded.Fields
+	})...)
 }
 
 // handlePercentileField handles percentile objects by creating separate fields for each percentile
 func handlePercentileField(frame *data.Frame, results *nrdb.NRDBResultContainer, fieldName string) {
+	addPercentileValueFields(frame, results.Results, fieldName, nil)
+}
+
+// addPercentileValueFields adds a numeric field per percentile key found in the
+// fieldName objects, e.g. "percentile.duration.95", with the given labels. The
+// fields are in ascending order of percentile.
+func addPercentileValueFields(frame *data.Frame, rows []nrdb.NRDBResult, fieldName string, labels data.Labels) {
 	// Collect all percentile keys from all results
-	percentileKeys := make(map[string]bool)
-	for _, result := range results.Results {
-		if result[fieldName] != nil {
-			if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-				for key := range objVal {
-					percentileKeys[key] = true
+	seen := make(map[string]bool)
+	var percentileKeys []string
+	for _, result := range rows {
+		if objVal, ok := result[fieldName].(map[string]interface{}); ok {
+			for key := range objVal {
+				if !seen[key] {
+					seen[key] = true
+					percentileKeys = append(percentileKeys, key)
 				}
 			}
 		}
 	}
+	sort.Slice(percentileKeys, func(i, j int) bool {
+		a, errA := strconv.ParseFloat(percentileKeys[i], 64)
+		b, errB := strconv.ParseFloat(percentileKeys[j], 64)
+		if errA != nil || errB != nil || a == b {
+			return percentileKeys[i] < percentileKeys[j]
+		}
+		return a < b
+	})
 
 	// Create a field for each percentile
-	for percentileKey := range percentileKeys {
-		fieldNameWithPercentile := fmt.Sprintf("%s.%s", fieldName, percentileKey)
-		values := make([]*float64, len(results.Results))
-
-		for i, result := range results.Results {
-			if result[fieldName] != nil {
-				if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-					if percentileVal, exists := objVal[percentileKey]; exists {
-						if floatVal, ok := percentileVal.(float64); ok {
-							values[i] = &floatVal
-						} else if strVal, ok := percentileVal.(string); ok {
-							if parsed, err := parseNumericString(strVal); err == nil {
-								values[i] = &parsed
-							}
-						}
-					}
-				}
+	for _, percentileKey := range percentileKeys {
+		field := convertNumbers(fmt.Sprintf("%s.%s", fieldName, percentileKey), len(rows), func(i int) interface{} {
+			if objVal, ok := rows[i][fieldName].(map[string]interface{}); ok {
+				return objVal[percentileKey]
 			}
-		}
-
-		frame.Fields = append(frame.Fields, data.NewField(fieldNameWithPercentile, nil, values))
+			return nil
+		})
+		field.Labels = labels
+		frame.Fields = append(frame.Fields, field)
 	}
 }
 
 // formatFacetedTimeseriesQuery formats results from a faceted timeseries query
-func formatFacetedTimeseriesQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery) *backend.DataResponse {
+func formatFacetedTimeseriesQuery(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
 	// Get facet names
 	facetNames := extractFacetNames(results)
 	log.DefaultLogger.Debug("Faceted timeseries - Facet names extracted: %v", facetNames)
 
 	if len(facetNames) == 0 {
 		// No facets, fall back to standard query
-		return formatStandardQuery(results, query)
+		return formatStandardQuery(results, query, opts)
 	}
 
 	// Use the enhanced faceted aggregation formatter to handle any aggregation field
 	// This handles count, sum.duration, average.duration, etc.
-	return formatFacetedAggregationQuery(results, query, facetNames)
+	return formatFacetedAggregationQuery(results, query, facetNames, opts)
 }
 
 // Overloaded for NRDBResultContainerMultiResultCustomized
@@ -846,7 +766,8 @@ func formatFacetedTimeseriesQueryMulti(results *nrdb.NRDBResultContainerMultiRes
 	}
 	log.DefaultLogger.Debug("Facet data keys: %v", keys)
 
-	for facetValue, facetResults := range facetData {
+	for _, facetValue := range sortedFacetValues(facetData, models.FacetOrderName, "") {
+		facetResults := facetData[facetValue]
 		// Use just the facet value as the frame name to match test expectations
 		log.DefaultLogger.Debug("Creating frame with name: %s", facetValue)
 		frame := data.NewFrame(facetValue)
@@ -860,9 +781,7 @@ func formatFacetedTimeseriesQueryMulti(results *nrdb.NRDBResultContainerMultiRes
 			}
 		}
 
-		countField := data.NewField("count", map[string]string{
-			facetNames[0]: facetValue,
-		}, counts)
+		countField := data.NewField("count", facetLabels(facetResults, facetNames, facetValue), counts)
 		frame.Fields = append(frame.Fields, countField)
 
 		resp.Frames = append(resp.Frames, frame)
@@ -880,59 +799,40 @@ func formatFacetedTimeseriesQueryMulti(results *nrdb.NRDBResultContainerMultiRes
 
 // groupTimeseriesByFacet groups timeseries results by facet value
 func groupTimeseriesByFacet(results *nrdb.NRDBResultContainer, facetName string) map[string][]nrdb.NRDBResult {
-	grouped := make(map[string][]nrdb.NRDBResult)
-
-	for _, result := range results.Results {
-		facetValue := ""
-		if facetArray, ok := result[utils.FacetFieldName].([]interface{}); ok && len(facetArray) > 0 {
-			facetValue = fmt.Sprintf("%v", facetArray[0])
-		} else if result[utils.FacetFieldName] != nil {
-			facetValue = fmt.Sprintf("%v", result[utils.FacetFieldName])
-		}
-
-		if facetValue != "" {
-			grouped[facetValue] = append(grouped[facetValue], result)
-		}
-	}
-
+	grouped, _ := groupByFacetValue(results.Results, false)
 	return grouped
 }
 
 // Multi version for NRDBResultContainerMultiResultCustomized
 func groupTimeseriesByFacetMulti(results *nrdb.NRDBResultContainerMultiResultCustomized, facetName string) map[string][]nrdb.NRDBResult {
-	grouped := make(map[string][]nrdb.NRDBResult)
-
 	// Process data from OtherResult first, as it's the preferred location for faceted timeseries
-	resultsToProcess := results.OtherResult
+	resultsToProcess := []nrdb.NRDBResult(results.OtherResult)
 	if len(resultsToProcess) == 0 {
 		// Fallback to Results if OtherResult is empty
 		resultsToProcess = results.Results
 	}
 
-	for _, result := range resultsToProcess {
-		facetValue := ""
-		if facetArray, ok := result[utils.FacetFieldName].([]interface{}); ok && len(facetArray) > 0 {
-			// Clean up the format for array facets, extracting just the first value
-			facetValue = fmt.Sprintf("%v", facetArray[0])
-			log.DefaultLogger.Debug("Found facet array, extracted value: %v", facetValue)
-		} else if result[utils.FacetFieldName] != nil {
-			facetValue = fmt.Sprintf("%v", result[utils.FacetFieldName])
-			log.DefaultLogger.Debug("Found direct facet value: %v", facetValue)
-		}
-		if facetValue != "" {
-			log.DefaultLogger.Debug("Using facet value '%s' for grouping", facetValue)
-			grouped[facetValue] = append(grouped[facetValue], result)
-		}
-	}
+	grouped, _ := groupByFacetValue(resultsToProcess, false)
 	return grouped
 }
 
 // FormatFacetedTimeseriesResults returns a Grafana DataResponse for faceted timeseries queries
 func FormatFacetedTimeseriesResults(results *nrdb.NRDBResultContainerMultiResultCustomized, query backend.DataQuery) *backend.DataResponse {
+	return formatFacetedTimeseriesResults(results, query, FormatOptions{})
+}
 
-	resultsJSON, _ := json.MarshalIndent(results, "", "  ")
-	log.DefaultLogger.Debug("FormatFacetedTimeseriesResults Result count: %d\nResults:\n%s",
-		len(results.Results), string(resultsJSON))
+// formatFacetedTimeseriesResults formats faceted timeseries results, applying opts.
+func formatFacetedTimeseriesResults(results *nrdb.NRDBResultContainerMultiResultCustomized, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+	if debugLogging() {
+		resultsJSON, _ := json.MarshalIndent(results, "", "  ")
+		log.DefaultLogger.Debug("FormatFacetedTimeseriesResults Result count: %d\nResults:\n%s",
+			len(results.Results), string(resultsJSON))
+	}
+
+	standardResults := toStandardContainerMulti(results)
+	if isCompareResult(standardResults) {
+		return formatCompareQuery(standardResults, query, opts)
+	}
 
 	if !isFacetedTimeseriesQueryMulti(results) {
 		resp := &backend.DataResponse{}
@@ -940,31 +840,33 @@ func FormatFacetedTimeseriesResults(results *nrdb.NRDBResultContainerMultiResult
 		return resp
 	}
 
-	// For faceted timeseries queries, the data can be in either OtherResult or Results
-	// Convert to standard format and use the enhanced faceted aggregation formatter
+	// Get facet names from metadata (not from result data)
+	facetNames := extractFacetNames(standardResults)
+	if len(facetNames) == 0 {
+		// No facets found, fall back to standard query
+		resp := formatStandardQuery(standardResults, query, opts)
+		return markTimeSeriesFrames(dedupeResponseFieldNames(alignTimeseriesBuckets(resp, standardResults.Results, query, opts.FillMode)))
+	}
+
+	// Use the enhanced faceted aggregation formatter
+	resp := formatFacetedAggregationQuery(standardResults, query, facetNames, opts)
+	return markTimeSeriesFrames(dedupeResponseFieldNames(alignTimeseriesBuckets(resp, standardResults.Results, query, opts.FillMode)))
+}
+
+// toStandardContainerMulti converts a faceted timeseries multi-result container into a
+// standard container. The data can be in either Results or OtherResult; Results is
+// preferred and OtherResult is used as a fallback when Results is empty.
+func toStandardContainerMulti(results *nrdb.NRDBResultContainerMultiResultCustomized) *nrdb.NRDBResultContainer {
 	var actualResults []nrdb.NRDBResult
+	source := "Results"
 
-	// First check Results as it's the preferred location for faceted timeseries
 	if len(results.Results) > 0 {
 		actualResults = results.Results
-		log.DefaultLogger.Debug("Using Results with %d entries", len(actualResults))
-		// Debug facet values
-		for i, result := range actualResults {
-			if facetVal, ok := result["facet"]; ok {
-				log.DefaultLogger.Debug("Results[%d] facet: %v", i, facetVal)
-			}
-		}
 	} else {
-		// Fallback to OtherResult if Results is empty
 		actualResults = results.OtherResult
-		log.DefaultLogger.Debug("Using OtherResult with %d entries", len(actualResults))
-		// Debug facet values
-		for i, result := range actualResults {
-			if facetVal, ok := result["facet"]; ok {
-				log.DefaultLogger.Debug("OtherResult[%d] facet: %v", i, facetVal)
-			}
-		}
+		source = "OtherResult"
 	}
+	log.DefaultLogger.Debug("Using %s with %d entries", source, len(actualResults))
 
 	standardResults := &nrdb.NRDBResultContainer{
 		Results:  make([]nrdb.NRDBResult, len(actualResults)),
@@ -973,18 +875,13 @@ func FormatFacetedTimeseriesResults(results *nrdb.NRDBResultContainerMultiResult
 
 	// Copy the actual results data
 	for i, result := range actualResults {
+		if facetVal, ok := result[utils.FacetFieldName]; ok {
+			log.DefaultLogger.Debug("%s[%d] facet: %v", source, i, facetVal)
+		}
 		standardResults.Results[i] = result
 	}
 
-	// Get facet names from metadata (not from result data)
-	facetNames := extractFacetNames(standardResults)
-	if len(facetNames) == 0 {
-		// No facets found, fall back to standard query
-		return formatStandardQuery(standardResults, query)
-	}
-
-	// Use the enhanced faceted aggregation formatter
-	return formatFacetedAggregationQuery(standardResults, query, facetNames)
+	return standardResults
 }
 
 // isAggregationField checks if a field name represents an aggregation function result
@@ -993,7 +890,7 @@ func isAggregationField(fieldName string) bool {
 	aggregationPrefixes := []string{
 		"average.", "sum.", "min.", "max.", "count", "uniqueCount.", "latest.", "earliest.",
 		"median.", "percentile.", "rate.", "apdex.", "histogram.", "uniques.",
-		"getField.", "round.", "percentage.", "stddev.", "variance.", "filter.",
+		"getField.", "round.", "percentage.", "stddev.", "variance.", "filter.", "funnel.",
 	}
 
 	// Check for exact matches (count is standalone)
@@ -1032,8 +929,31 @@ func isAggregationField(fieldName string) bool {
 	return false
 }
 
-// detectFieldType analyzes a field across all results to determine the best data type
-func detectFieldType(results []nrdb.NRDBResult, fieldName string) string {
+// detectFieldType analyzes a field across all results to determine the best data
+// type. A type forced by one of rules takes precedence over the inferred one,
+// unless the field holds objects or arrays.
+func detectFieldType(results []nrdb.NRDBResult, fieldName string, rules []models.FieldTypeRule) string {
+	// apdex() and funnel() results are expanded into a field per component or step
+	if isApdexField(results, fieldName) {
+		return "apdex"
+	}
+	if isFunnelField(results, fieldName) {
+		return "funnel"
+	}
+
+	if forced, ok := forcedFieldType(rules, fieldName); ok {
+		composite := false
+		for _, result := range results {
+			if isComposite(result[fieldName]) {
+				composite = true
+				break
+			}
+		}
+		if !composite {
+			return forced
+		}
+	}
+
 	// Check if it's an aggregation field first
 	if isAggregationField(fieldName) {
 		// Special handling for specific aggregation types
@@ -1067,7 +987,7 @@ func detectFieldType(results []nrdb.NRDBResult, fieldName string) string {
 	for _, result := range results {
 		if result[fieldName] != nil && result[fieldName] != "" {
 			switch val := result[fieldName].(type) {
-			case float64, int, int64:
+			case float64, int, int64, uint64, json.Number:
 				foundTypes["number"] = true
 			case string:
 				// Try to parse as number
@@ -1121,201 +1041,25 @@ func formatStandardQueryMulti(results *nrdb.NRDBResultContainerMultiResultCustom
 	return resp
 }
 
-// Multi version for NRDBResultContainerMultiResultCustomized
+// extractFieldNamesMulti is extractFieldNames for the results of a multi-result container.
 func extractFieldNamesMulti(results *nrdb.NRDBResultContainerMultiResultCustomized) []string {
-	fieldNamesMap := make(map[string]struct{})
-	for _, result := range results.Results {
-		for key := range result {
-			if key != utils.TimestampFieldName && key != "beginTimeSeconds" && key != "endTimeSeconds" {
-				fieldNamesMap[key] = struct{}{}
-			}
-		}
-	}
-	var fieldNames []string
-	for key := range fieldNamesMap {
-		fieldNames = append(fieldNames, key)
-	}
-	return fieldNames
+	return extractFieldNames(&nrdb.NRDBResultContainer{Results: results.Results})
 }
 
-// Multi version for NRDBResultContainerMultiResultCustomized
+// createTimeFieldMulti is createTimeField for the results of a multi-result
+// container, so both result shapes are stamped the same way.
 func createTimeFieldMulti(results *nrdb.NRDBResultContainerMultiResultCustomized, query backend.DataQuery) []time.Time {
-	times := make([]time.Time, len(results.Results))
-	now := time.Now()
-	for i, result := range results.Results {
-		if ts, ok := result[utils.TimestampFieldName].(float64); ok {
-			times[i] = time.Unix(int64(ts/1000), 0)
-		} else if beginTs, ok := result["beginTimeSeconds"].(float64); ok {
-			times[i] = time.Unix(int64(beginTs), 0)
-		} else {
-			times[i] = now
-		}
-	}
-	return times
+	return createTimeField(&nrdb.NRDBResultContainer{Results: results.Results}, query)
 }
 
 // Multi version for NRDBResultContainerMultiResultCustomized
 func addDataFieldsMulti(frame *data.Frame, results *nrdb.NRDBResultContainerMultiResultCustomized, fieldNames []string) {
-	for _, fieldName := range fieldNames {
-		if len(results.Results) > 0 {
-			// Use improved field type detection (convert to regular results for type detection)
-			regularResults := make([]nrdb.NRDBResult, len(results.Results))
-			for i, result := range results.Results {
-				regularResults[i] = result
-			}
-			fieldType := detectFieldType(regularResults, fieldName)
-
-			switch fieldType {
-			case "number":
-				// Use nullable float64 to handle nil/empty values properly
-				values := make([]*float64, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil && result[fieldName] != "" {
-						if val, ok := result[fieldName].(float64); ok {
-							values[i] = &val
-						} else if strVal, ok := result[fieldName].(string); ok && strVal != "" {
-							// Try to parse scientific notation strings
-							if parsed, err := parseNumericString(strVal); err == nil {
-								values[i] = &parsed
-							}
-						} else if intVal, ok := result[fieldName].(int); ok {
-							floatVal := float64(intVal)
-							values[i] = &floatVal
-						} else if int64Val, ok := result[fieldName].(int64); ok {
-							floatVal := float64(int64Val)
-							values[i] = &floatVal
-						}
-					}
-					// For nil/empty values, values[i] remains nil (which becomes null in JSON)
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			case "timestamp":
-				// Handle timestamp fields specially
-				values := make([]*time.Time, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil && result[fieldName] != "" {
-						if timestampVal, ok := result[fieldName].(float64); ok {
-							// Convert Unix timestamp to time.Time
-							t := time.Unix(int64(timestampVal/1000), 0)
-							values[i] = &t
-						} else if timestampStr, ok := result[fieldName].(string); ok {
-							// Try to parse timestamp string
-							if parsed, err := strconv.ParseFloat(timestampStr, 64); err == nil {
-								t := time.Unix(int64(parsed/1000), 0)
-								values[i] = &t
-							}
-						}
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			case "array":
-				// Handle arrays (like histogram, uniques) - convert to JSON string for display
-				values := make([]string, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil {
-						if arrayVal, ok := result[fieldName].([]interface{}); ok {
-							// Convert array to JSON string for better display
-							if jsonBytes, err := json.Marshal(arrayVal); err == nil {
-								values[i] = string(jsonBytes)
-							} else {
-								values[i] = fmt.Sprintf("%v", arrayVal)
-							}
-						} else {
-							values[i] = fmt.Sprintf("%v", result[fieldName])
-						}
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			case "object":
-				// Handle objects (like percentile results) - convert to JSON string or extract values
-				if strings.HasPrefix(fieldName, "percentile.") {
-					// Special handling for percentile objects - try to extract individual percentile values
-					handlePercentileFieldMulti(frame, results, fieldName)
-				} else {
-					// General object handling - convert to JSON string
-					values := make([]string, len(results.Results))
-					for i, result := range results.Results {
-						if result[fieldName] != nil {
-							if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-								if jsonBytes, err := json.Marshal(objVal); err == nil {
-									values[i] = string(jsonBytes)
-								} else {
-									values[i] = fmt.Sprintf("%v", objVal)
-								}
-							} else {
-								values[i] = fmt.Sprintf("%v", result[fieldName])
-							}
-						}
-					}
-					frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-				}
-
-			case "boolean":
-				// Handle boolean values
-				values := make([]*bool, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil {
-						if boolVal, ok := result[fieldName].(bool); ok {
-							values[i] = &boolVal
-						}
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-
-			default: // "string" and fallback
-				// Convert to string for other types
-				values := make([]string, len(results.Results))
-				for i, result := range results.Results {
-					if result[fieldName] != nil {
-						values[i] = fmt.Sprintf("%v", result[fieldName])
-					}
-				}
-				frame.Fields = append(frame.Fields, data.NewField(fieldName, nil, values))
-			}
-		}
-	}
+	addResultFields(frame, results.Results, fieldNames, nil)
 }
 
 // handlePercentileFieldMulti handles percentile objects by creating separate fields for each percentile (Multi version)
 func handlePercentileFieldMulti(frame *data.Frame, results *nrdb.NRDBResultContainerMultiResultCustomized, fieldName string) {
-	// Collect all percentile keys from all results
-	percentileKeys := make(map[string]bool)
-	for _, result := range results.Results {
-		if result[fieldName] != nil {
-			if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-				for key := range objVal {
-					percentileKeys[key] = true
-				}
-			}
-		}
-	}
-
-	// Create a field for each percentile
-	for percentileKey := range percentileKeys {
-		fieldNameWithPercentile := fmt.Sprintf("%s.%s", fieldName, percentileKey)
-		values := make([]*float64, len(results.Results))
-
-		for i, result := range results.Results {
-			if result[fieldName] != nil {
-				if objVal, ok := result[fieldName].(map[string]interface{}); ok {
-					if percentileVal, exists := objVal[percentileKey]; exists {
-						if floatVal, ok := percentileVal.(float64); ok {
-							values[i] = &floatVal
-						} else if strVal, ok := percentileVal.(string); ok {
-							if parsed, err := parseNumericString(strVal); err == nil {
-								values[i] = &parsed
-							}
-						}
-					}
-				}
-			}
-		}
-
-		frame.Fields = append(frame.Fields, data.NewField(fieldNameWithPercentile, nil, values))
-	}
+	addPercentileValueFields(frame, results.Results, fieldName, nil)
 }
 
 // getMapKeys returns the keys of a map as a slice for debugging
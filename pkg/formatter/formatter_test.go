@@ -769,7 +769,7 @@ func TestAddDataFields(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			frame := data.NewFrame("test")
-			addDataFields(frame, tt.results, tt.fieldNames)
+			addDataFields(frame, tt.results, tt.fieldNames, nil)
 			tt.expectFunc(t, frame)
 		})
 	}
@@ -949,7 +949,7 @@ func TestAddDataFieldsComprehensive(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			frame := data.NewFrame("test_frame")
-			addDataFields(frame, tt.results, tt.fieldNames)
+			addDataFields(frame, tt.results, tt.fieldNames, nil)
 			tt.validate(t, frame)
 		})
 	}
@@ -1549,8 +1549,8 @@ func TestFormatFacetedTimeseriesQueryMulti(t *testing.T) {
 			},
 			query:             backend.DataQuery{RefID: "A"},
 			expectedFrames:    2,
-			expectedFrameName: "api", // First frame name
-			expectedFields:    2,     // time and count fields
+			expectedFrameName: "api, v1", // Frames are named by the full facet tuple
+			expectedFields:    2,         // time and count fields
 		},
 		{
 			name: "falls back to standard query when no facets",
@@ -2278,6 +2278,27 @@ func TestHandlePercentileFieldMultiComprehensive_Formatter(t *testing.T) {
 
 // TestHandlePercentileField comprehensively tests the handlePercentileField function
 // with various scenarios to ensure proper handling of percentile data
+func TestHandlePercentileField_Order(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"percentile.duration": map[string]interface{}{"99.9": 3.0, "5": 0.1, "99": 2.0, "50": 1.0}},
+		},
+	}
+	frame := data.NewFrame("response")
+	handlePercentileField(frame, results, "percentile.duration")
+
+	var names []string
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{
+		"percentile.duration.5",
+		"percentile.duration.50",
+		"percentile.duration.99",
+		"percentile.duration.99.9",
+	}, names, "fields are in ascending order of percentile")
+}
+
 func TestHandlePercentileField_Formatter(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -2620,7 +2641,7 @@ func TestAddRegularAggregationField(t *testing.T) {
 			},
 		}
 
-		addRegularAggregationField(frame, facetResults, "sum.duration", "service", "serviceA")
+		addRegularAggregationField(frame, facetResults, "sum.duration", data.Labels{"service": "serviceA"})
 
 		// Check the field was created
 		assert.Equal(t, 1, len(frame.Fields))
@@ -2650,7 +2671,7 @@ func TestAddRegularAggregationField(t *testing.T) {
 			},
 		}
 
-		addRegularAggregationField(frame, facetResults, "avg.duration", "service", "serviceA")
+		addRegularAggregationField(frame, facetResults, "avg.duration", data.Labels{"service": "serviceA"})
 
 		// Check values were properly parsed from strings
 		assert.Equal(t, 123.45, *frame.Fields[0].At(0).(*float64))
@@ -2667,7 +2688,7 @@ func TestAddRegularAggregationField(t *testing.T) {
 			},
 		}
 
-		addRegularAggregationField(frame, facetResults, "count", "service", "serviceA")
+		addRegularAggregationField(frame, facetResults, "count", data.Labels{"service": "serviceA"})
 
 		// Check value was properly converted from int
 		assert.Equal(t, float64(123), *frame.Fields[0].At(0).(*float64))
@@ -2683,7 +2704,7 @@ func TestAddRegularAggregationField(t *testing.T) {
 			},
 		}
 
-		addRegularAggregationField(frame, facetResults, "count", "service", "serviceA")
+		addRegularAggregationField(frame, facetResults, "count", data.Labels{"service": "serviceA"})
 
 		// Check value was properly converted from int64
 		assert.Equal(t, float64(9876543210), *frame.Fields[0].At(0).(*float64))
@@ -2714,7 +2735,7 @@ func TestAddRegularAggregationField(t *testing.T) {
 			},
 		}
 
-		addRegularAggregationField(frame, facetResults, "sum.duration", "service", "serviceA")
+		addRegularAggregationField(frame, facetResults, "sum.duration", data.Labels{"service": "serviceA"})
 
 		// Check the field length
 		assert.Equal(t, 4, frame.Fields[0].Len())
@@ -2856,7 +2877,7 @@ func TestCreateFacetTimeSeriesFrame(t *testing.T) {
 		}
 
 		// Create the frame
-		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query)
+		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query, "")
 
 		// Verify frame properties
 		assert.Equal(t, utils.FacetedTimeSeriesFrameName, frame.Name)
@@ -2902,7 +2923,7 @@ func TestCreateFacetTimeSeriesFrame(t *testing.T) {
 		}
 
 		// Create the frame
-		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query)
+		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query, "")
 
 		// Should have 4 fields: time, service, environment, count
 		assert.Equal(t, 4, len(frame.Fields))
@@ -2929,7 +2950,7 @@ func TestCreateFacetTimeSeriesFrame(t *testing.T) {
 		}
 
 		// Create the frame
-		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query)
+		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query, "")
 
 		// Should have 2 fields: time and count
 		assert.Equal(t, 2, len(frame.Fields))
@@ -2949,7 +2970,7 @@ func TestCreateFacetTimeSeriesFrame(t *testing.T) {
 		}
 
 		// Create the frame
-		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query)
+		frame := createFacetTimeSeriesFrame(facetNames, counts, facetFields, query, "")
 
 		// Should have 3 fields: time, service, count
 		assert.Equal(t, 3, len(frame.Fields))
@@ -3846,7 +3867,7 @@ func TestFormatStandardQuery(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			response := formatStandardQuery(tt.results, tt.query)
+			response := formatStandardQuery(tt.results, tt.query, FormatOptions{})
 
 			assert.Equal(t, tt.expectedError, response.Error != nil)
 			assert.Equal(t, tt.expectedFrames, len(response.Frames))
@@ -3927,7 +3948,7 @@ func TestFormatFacetedCountQuery(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			response := formatFacetedCountQuery(tt.results, tt.query)
+			response := formatFacetedCountQuery(tt.results, tt.query, FormatOptions{})
 
 			assert.Equal(t, tt.expectedError, response.Error != nil)
 			assert.Equal(t, tt.expectedFrames, len(response.Frames))
@@ -4116,7 +4137,7 @@ func TestFormatFacetedTimeseriesQueryBasic(t *testing.T) {
 	}
 
 	// Just check that the function doesn't panic
-	response := formatFacetedTimeseriesQuery(results, query)
+	response := formatFacetedTimeseriesQuery(results, query, FormatOptions{})
 
 	// Basic checks
 	assert.NotNil(t, response)
@@ -0,0 +1,131 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// funnelStepsKey is the key of the step counts in funnel() results that do not
+// name their steps.
+const funnelStepsKey = "steps"
+
+// isFunnelField reports whether the fieldName values of rows are funnel()
+// results: objects of named step counts, or step count lists under "steps" or
+// as the value itself. Rows without a value are ignored.
+func isFunnelField(rows []nrdb.NRDBResult, fieldName string) bool {
+	if !strings.HasPrefix(fieldName, "funnel") {
+		return false
+	}
+	found := false
+	for _, row := range rows {
+		switch value := row[fieldName].(type) {
+		case nil:
+			continue
+		case []interface{}:
+		case map[string]interface{}:
+			if isApdexObject(value) {
+				return false
+			}
+		default:
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// funnelSteps returns the step counts of a funnel() value keyed by step name.
+// Unnamed steps are named "step 1", "step 2" and so on.
+func funnelSteps(value interface{}) map[string]interface{} {
+	if object, ok := value.(map[string]interface{}); ok {
+		steps, ok := object[funnelStepsKey].([]interface{})
+		if !ok {
+			return object
+		}
+		value = steps
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	steps := make(map[string]interface{}, len(list))
+	for i, count := range list {
+		steps[funnelStepName(i)] = count
+	}
+	return steps
+}
+
+// funnelStepName returns the name of the unnamed step at index i.
+func funnelStepName(i int) string {
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// addFunnelFields adds a numeric field per funnel() step found in the fieldName
+// values, e.g. "funnel.session.Checkout", with the given labels. Funnel steps
+// only ever narrow, so named steps are ordered by descending count in the first
+// row that has them, and unnamed steps by position.
+func addFunnelFields(frame *data.Frame, rows []nrdb.NRDBResult, fieldName string, labels data.Labels) {
+	counts := make(map[string]float64)
+	var names []string
+	for _, row := range rows {
+		for name, count := range funnelSteps(row[fieldName]) {
+			if _, seen := counts[name]; !seen {
+				value, _ := count.(float64)
+				counts[name] = value
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		var a, b int
+		if _, err := fmt.Sscanf(names[i], "step %d", &a); err == nil {
+			if _, err := fmt.Sscanf(names[j], "step %d", &b); err == nil {
+				return a < b
+			}
+		}
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		field := convertNumbers(fieldName+"."+name, len(rows), func(i int) interface{} {
+			return funnelSteps(rows[i][fieldName])[name]
+		})
+		field.Labels = labels
+		frame.Fields = append(frame.Fields, field)
+	}
+}
+
+// isRateField reports whether fieldName holds rate() results.
+func isRateField(fieldName string) bool {
+	return fieldName == "rate" || strings.HasPrefix(fieldName, "rate.")
+}
+
+// ApplyRateUnit sets unit as the unit of the rate() fields of every frame in
+// resp, so that rates are displayed per the interval of the rate() call. An
+// empty unit, or fields that already have a unit, are left as they are.
+func ApplyRateUnit(resp *backend.DataResponse, unit string) {
+	if resp == nil || unit == "" {
+		return
+	}
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields {
+			if !isRateField(field.Name) {
+				continue
+			}
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			if field.Config.Unit == "" {
+				field.Config.Unit = unit
+			}
+		}
+	}
+}
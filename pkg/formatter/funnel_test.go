@@ -0,0 +1,71 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatQueryResults_Funnel(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		wantNames []string
+		wantFirst float64
+	}{
+		{
+			name:      "named steps ordered by count",
+			value:     map[string]interface{}{"Checkout": 40.0, "Home": 1000.0, "Cart": 150.0},
+			wantNames: []string{"time", "funnel.session.Home", "funnel.session.Cart", "funnel.session.Checkout"},
+			wantFirst: 1000,
+		},
+		{
+			name:      "unnamed steps",
+			value:     map[string]interface{}{"steps": []interface{}{500.0, 120.0}},
+			wantNames: []string{"time", "funnel.session.step 1", "funnel.session.step 2"},
+			wantFirst: 500,
+		},
+		{
+			name:      "step list",
+			value:     []interface{}{7.0, 3.0, 1.0},
+			wantNames: []string{"time", "funnel.session.step 1", "funnel.session.step 2", "funnel.session.step 3"},
+			wantFirst: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"funnel.session": tt.value}}}
+
+			resp := FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+			require.Len(t, resp.Frames, 1)
+			assert.Equal(t, tt.wantNames, fieldNames(resp.Frames[0]))
+			first, err := resp.Frames[0].Fields[1].FloatAt(0)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFirst, first)
+		})
+	}
+}
+
+func TestIsFunnelField(t *testing.T) {
+	assert.True(t, isFunnelField([]nrdb.NRDBResult{{"funnel.session": map[string]interface{}{"A": 1.0}}}, "funnel.session"))
+	assert.False(t, isFunnelField([]nrdb.NRDBResult{{"funnel.session": 1.0}}, "funnel.session"))
+	assert.False(t, isFunnelField([]nrdb.NRDBResult{{"steps": []interface{}{1.0}}}, "steps"))
+}
+
+func TestApplyRateUnit(t *testing.T) {
+	rate := data.NewField("rate.count", nil, []float64{1})
+	custom := data.NewField("rate.sum", nil, []float64{1}).SetConfig(&data.FieldConfig{Unit: "reqps"})
+	count := data.NewField("count", nil, []float64{1})
+	resp := &backend.DataResponse{Frames: data.Frames{data.NewFrame("", rate, custom, count)}}
+
+	ApplyRateUnit(resp, "suffix: /min")
+
+	assert.Equal(t, "suffix: /min", rate.Config.Unit)
+	assert.Equal(t, "reqps", custom.Config.Unit)
+	assert.Nil(t, count.Config)
+}
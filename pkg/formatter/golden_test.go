@@ -0,0 +1,189 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run `go test ./pkg/formatter -run TestGolden -update-golden` after an
+// intended change to the frames, and review the diff of testdata/golden.
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden files under testdata/golden")
+
+const (
+	responsesDir = "testdata/responses"
+	goldenDir    = "testdata/golden"
+)
+
+// recordedResponse is a file of testdata/responses: NRDB results recorded for
+// a query, and the formatter the query handler sends them to.
+type recordedResponse struct {
+	// Formatter is "facetedTimeseries", "logs" or "traces"; empty formats the
+	// results through the route registry, as most queries are.
+	Formatter string          `json:"formatter"`
+	Query     json.RawMessage `json:"query"`
+	Options   FormatOptions   `json:"options"`
+	Results   json.RawMessage `json:"results"`
+}
+
+// fieldSchema and frameSchema are what dashboards rely on of a frame: its
+// type, field names, types, labels and config. The values are not included.
+type fieldSchema struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels data.Labels       `json:"labels,omitempty"`
+	Config *data.FieldConfig `json:"config,omitempty"`
+}
+
+type frameSchema struct {
+	Name                   string         `json:"name"`
+	Type                   data.FrameType `json:"type,omitempty"`
+	PreferredVisualization data.VisType   `json:"preferredVisualization,omitempty"`
+	Fields                 []fieldSchema  `json:"fields"`
+}
+
+// goldenTimeRange is the dashboard time range of the recorded queries.
+var goldenTimeRange = backend.TimeRange{
+	From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	To:   time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+}
+
+// TestGolden formats every recorded response and compares the frames with the
+// golden files: the schema byte for byte, and the frames with their values as
+// Grafana receives them.
+func TestGolden(t *testing.T) {
+	names := recordedNames(t)
+	require.NotEmpty(t, names)
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			resp := formatRecorded(t, name)
+			require.NoError(t, resp.Error)
+
+			schema := schemaJSON(t, resp.Frames)
+			checkGoldenSchema(t, name, schema)
+
+			// Frames reach Grafana as Arrow, which must not lose any of the schema
+			decoded := make(data.Frames, len(resp.Frames))
+			for i, frame := range resp.Frames {
+				encoded, err := frame.MarshalArrow()
+				require.NoError(t, err)
+				decoded[i], err = data.UnmarshalArrowFrame(encoded)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, string(schema), string(schemaJSON(t, decoded)), "schema changed by the Arrow encoding")
+
+			experimental.CheckGoldenJSONResponse(t, goldenDir, name, resp, *updateGolden)
+		})
+	}
+}
+
+// TestGolden_NoOrphans checks that every golden file belongs to a recorded
+// response, so removing a response also removes its golden files.
+func TestGolden_NoOrphans(t *testing.T) {
+	recorded := make(map[string]bool)
+	for _, name := range recordedNames(t) {
+		recorded[name] = true
+	}
+	entries, err := os.ReadDir(goldenDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".jsonc"), ".schema.json")
+		assert.True(t, recorded[name], "golden file %s has no recorded response", entry.Name())
+	}
+}
+
+// recordedNames returns the names of the files of testdata/responses, without
+// the .json extension.
+func recordedNames(t *testing.T) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(responsesDir, "*.json"))
+	require.NoError(t, err)
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(filepath.Base(file), ".json")
+	}
+	return names
+}
+
+// formatRecorded formats the recorded response name.
+func formatRecorded(t *testing.T, name string) *backend.DataResponse {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join(responsesDir, name+".json"))
+	require.NoError(t, err)
+	var recorded recordedResponse
+	require.NoError(t, json.Unmarshal(raw, &recorded))
+
+	query := backend.DataQuery{RefID: "A", JSON: recorded.Query, TimeRange: goldenTimeRange, Interval: time.Minute}
+	if recorded.Formatter == "facetedTimeseries" {
+		var results nrdb.NRDBResultContainerMultiResultCustomized
+		require.NoError(t, json.Unmarshal(recorded.Results, &results))
+		return FormatFacetedTimeseriesResultsWithOptions(&results, query, recorded.Options)
+	}
+
+	var results nrdb.NRDBResultContainer
+	require.NoError(t, json.Unmarshal(recorded.Results, &results))
+	switch recorded.Formatter {
+	case "":
+		return FormatQueryResultsWithOptions(&results, query, recorded.Options)
+	case "logs":
+		return FormatLogResults(&results)
+	case "traces":
+		return FormatTraceResults(&results)
+	}
+	require.Failf(t, "unknown formatter", "%s: %q", name, recorded.Formatter)
+	return nil
+}
+
+// schemaJSON returns the indented JSON of the schema of frames.
+func schemaJSON(t *testing.T, frames data.Frames) []byte {
+	t.Helper()
+	schemas := make([]frameSchema, len(frames))
+	for i, frame := range frames {
+		schemas[i] = frameSchema{Name: frame.Name, Fields: make([]fieldSchema, len(frame.Fields))}
+		if frame.Meta != nil {
+			schemas[i].Type = frame.Meta.Type
+			schemas[i].PreferredVisualization = frame.Meta.PreferredVisualization
+		}
+		for j, field := range frame.Fields {
+			schemas[i].Fields[j] = fieldSchema{
+				Name:   field.Name,
+				Type:   field.Type().ItemTypeString(),
+				Labels: field.Labels,
+				Config: field.Config,
+			}
+		}
+	}
+	encoded, err := json.MarshalIndent(schemas, "", "  ")
+	require.NoError(t, err)
+	return append(encoded, '\n')
+}
+
+// checkGoldenSchema compares schema byte for byte with the golden schema of
+// name, rewriting the golden file when -update-golden is set.
+func checkGoldenSchema(t *testing.T, name string, schema []byte) {
+	t.Helper()
+	path := filepath.Join(goldenDir, name+".schema.json")
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(goldenDir, 0o755))
+		require.NoError(t, os.WriteFile(path, schema, 0o600))
+		return
+	}
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err, "no golden schema; run the test with -update-golden to create it")
+	if !bytes.Equal(golden, schema) {
+		assert.Equal(t, string(golden), string(schema), "frame schema of %s changed; if intended, rerun with -update-golden", name)
+	}
+}
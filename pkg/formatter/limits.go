@@ -0,0 +1,107 @@
+package formatter
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// DefaultMaxSeries is how many series a response may hold when neither the
+// datasource settings nor the query set a limit, so that a high-cardinality
+// FACET does not send tens of thousands of frames to the browser.
+const DefaultMaxSeries = 1000
+
+// ApplyLimits keeps the first maxSeries series of resp and the first maxRows
+// rows of each of its frames, adding a warning notice for every limit that
+// truncated the response. A series is a value field of a time series frame;
+// frames left without one are dropped. A limit of zero or less is not applied.
+func ApplyLimits(resp *backend.DataResponse, maxSeries, maxRows int) {
+	if resp == nil || resp.Error != nil {
+		return
+	}
+	if maxSeries > 0 {
+		if total := limitSeries(resp, maxSeries); total > maxSeries {
+			AppendNotices(resp, data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("Showing first %d of %d series; narrow the FACET or raise maxSeries to see more", maxSeries, total),
+			})
+		}
+	}
+	if maxRows > 0 {
+		for _, frame := range resp.Frames {
+			limitRows(frame, maxRows)
+		}
+	}
+}
+
+// limitSeries removes the series after the first maxSeries from resp, in frame
+// and field order, and returns how many series resp held.
+func limitSeries(resp *backend.DataResponse, maxSeries int) int {
+	total := 0
+	frames := resp.Frames[:0]
+	for _, frame := range resp.Frames {
+		values := seriesIndices(frame)
+		if len(values) == 0 {
+			frames = append(frames, frame)
+			continue
+		}
+		keep := maxSeries - total
+		total += len(values)
+		if keep <= 0 {
+			continue
+		}
+		if keep < len(values) {
+			dropFields(frame, values[keep:])
+		}
+		frames = append(frames, frame)
+	}
+	resp.Frames = frames
+	return total
+}
+
+// seriesIndices returns the indices of the value fields of a time series frame,
+// or nil for frames that are not time series.
+func seriesIndices(frame *data.Frame) []int {
+	schema := frame.TimeSeriesSchema()
+	if schema.Type != data.TimeSeriesTypeWide {
+		return nil
+	}
+	return schema.ValueIndices
+}
+
+// dropFields removes the fields at the given ascending indices from frame.
+func dropFields(frame *data.Frame, indices []int) {
+	drop := make(map[int]bool, len(indices))
+	for _, i := range indices {
+		drop[i] = true
+	}
+	fields := frame.Fields[:0]
+	for i, field := range frame.Fields {
+		if !drop[i] {
+			fields = append(fields, field)
+		}
+	}
+	frame.Fields = fields
+}
+
+// limitRows keeps the first maxRows rows of frame, adding a warning notice to
+// the frame when rows were removed.
+func limitRows(frame *data.Frame, maxRows int) {
+	rows, err := frame.RowLen()
+	if err != nil || rows <= maxRows {
+		return
+	}
+	for _, field := range frame.Fields {
+		for i := field.Len() - 1; i >= maxRows; i-- {
+			field.Delete(i)
+		}
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.Notices = append(frame.Meta.Notices, data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("Showing first %d of %d rows; raise maxFrameRows to see more", maxRows, rows),
+	})
+}
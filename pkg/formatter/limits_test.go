@@ -0,0 +1,96 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seriesFrame returns a time series frame with a value field per name and rows buckets.
+func seriesFrame(rows int, names ...string) *data.Frame {
+	times := make([]time.Time, rows)
+	for i := range times {
+		times[i] = time.Unix(int64(1700000000+60*i), 0)
+	}
+	frame := data.NewFrame("", data.NewField("time", nil, times))
+	for _, name := range names {
+		frame.Fields = append(frame.Fields, data.NewField(name, nil, make([]float64, rows)))
+	}
+	return frame
+}
+
+func seriesNames(resp *backend.DataResponse) []string {
+	var names []string
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields[1:] {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
+
+func TestApplyLimits_Series(t *testing.T) {
+	t.Run("keeps the first series across frames", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{
+			seriesFrame(2, "a"), seriesFrame(2, "b", "c"), seriesFrame(2, "d"),
+		}}
+		ApplyLimits(resp, 2, 0)
+
+		require.Len(t, resp.Frames, 2)
+		assert.Equal(t, []string{"a", "b"}, seriesNames(resp))
+		for _, frame := range resp.Frames {
+			require.NotNil(t, frame.Meta)
+			require.Len(t, frame.Meta.Notices, 1)
+			assert.Equal(t, data.NoticeSeverityWarning, frame.Meta.Notices[0].Severity)
+			assert.Contains(t, frame.Meta.Notices[0].Text, "Showing first 2 of 4 series")
+		}
+	})
+
+	t.Run("within the limit", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{seriesFrame(2, "a", "b")}}
+		ApplyLimits(resp, 2, 0)
+
+		assert.Equal(t, []string{"a", "b"}, seriesNames(resp))
+		assert.Nil(t, resp.Frames[0].Meta)
+	})
+
+	t.Run("tables are not series", func(t *testing.T) {
+		table := data.NewFrame("", data.NewField("appName", nil, []string{"web", "api"}), data.NewField("count", nil, []float64{1, 2}))
+		resp := &backend.DataResponse{Frames: data.Frames{table, seriesFrame(2, "a", "b")}}
+		ApplyLimits(resp, 1, 0)
+
+		require.Len(t, resp.Frames, 2)
+		assert.Len(t, resp.Frames[0].Fields, 2)
+		assert.Len(t, resp.Frames[1].Fields, 2)
+	})
+}
+
+func TestApplyLimits_Rows(t *testing.T) {
+	long, short := seriesFrame(5, "a"), seriesFrame(2, "b")
+	resp := &backend.DataResponse{Frames: data.Frames{long, short}}
+	ApplyLimits(resp, 0, 3)
+
+	rows, err := long.RowLen()
+	require.NoError(t, err)
+	assert.Equal(t, 3, rows)
+	require.NotNil(t, long.Meta)
+	require.Len(t, long.Meta.Notices, 1)
+	assert.Contains(t, long.Meta.Notices[0].Text, "Showing first 3 of 5 rows")
+
+	rows, err = short.RowLen()
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Nil(t, short.Meta)
+}
+
+func TestApplyLimits_ErrorResponse(t *testing.T) {
+	assert.NotPanics(t, func() { ApplyLimits(nil, 1, 1) })
+
+	resp := &backend.DataResponse{Error: assert.AnError, Frames: data.Frames{seriesFrame(2, "a", "b")}}
+	ApplyLimits(resp, 1, 1)
+	assert.Len(t, resp.Frames[0].Fields, 3)
+}
@@ -0,0 +1,145 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/timeutil"
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// LogsFrameName is the name of the frame produced for log lines.
+const LogsFrameName = "logs"
+
+// Field names of the log-lines frame, as defined by Grafana's data plane contract.
+const (
+	logTimestampField = "timestamp"
+	logBodyField      = "body"
+	logSeverityField  = "severity"
+	logIDField        = "id"
+	logLabelsField    = "labels"
+)
+
+// logBodyAttributes are the attributes holding the log message, in order of preference.
+var logBodyAttributes = []string{"message", "log", "msg"}
+
+// logSeverityAttributes are the attributes holding the log level, in order of preference.
+var logSeverityAttributes = []string{"level", "log.level", "severity", "loglevel", "log_level"}
+
+// logIDAttributes are the attributes holding a unique log line ID, in order of preference.
+var logIDAttributes = []string{"messageId", "id"}
+
+// logLevels maps log level spellings to the levels Grafana's Logs panel knows.
+var logLevels = map[string]string{
+	"emerg": "critical", "emergency": "critical", "alert": "critical", "crit": "critical",
+	"critical": "critical", "fatal": "critical", "panic": "critical",
+	"err": "error", "error": "error", "severe": "error",
+	"warn": "warning", "warning": "warning",
+	"info": "info", "information": "info", "informational": "info", "notice": "info",
+	"debug": "debug", "dbug": "debug", "fine": "debug",
+	"trace": "trace", "finer": "trace", "finest": "trace",
+}
+
+// IsEventResult reports whether results are raw events, as returned by
+// SELECT * or SELECT attr1, attr2 queries, rather than aggregates.
+func IsEventResult(results *nrdb.NRDBResultContainer) bool {
+	return results != nil && isEventRows(results.Results)
+}
+
+// LogLevel returns the Grafana log level for a New Relic log level, or "unknown".
+func LogLevel(level string) string {
+	if mapped, ok := logLevels[strings.ToLower(strings.TrimSpace(level))]; ok {
+		return mapped
+	}
+	return "unknown"
+}
+
+// FormatLogResults formats log events as a Grafana log-lines frame, which the
+// Logs panel and Explore's log view render: a timestamp, the message as body,
+// the mapped severity, an ID when the logs carry one and the remaining
+// attributes as labels.
+func FormatLogResults(results *nrdb.NRDBResultContainer) *backend.DataResponse {
+	rows := results.Results
+	bodyAttribute := firstAttribute(rows, logBodyAttributes)
+	severityAttribute := firstAttribute(rows, logSeverityAttributes)
+	idAttribute := firstAttribute(rows, logIDAttributes)
+
+	timestamps := make([]time.Time, len(rows))
+	bodies := make([]string, len(rows))
+	severities := make([]string, len(rows))
+	ids := make([]string, len(rows))
+	labels := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		if ts, ok := row[utils.TimestampFieldName].(float64); ok {
+			timestamps[i] = timeutil.FromEpoch(ts)
+		}
+		bodies[i] = logText(row[bodyAttribute])
+		severities[i] = LogLevel(logText(row[severityAttribute]))
+		ids[i] = logText(row[idAttribute])
+
+		rowLabels := make(map[string]string, len(row))
+		for key, value := range row {
+			switch key {
+			case utils.TimestampFieldName, bodyAttribute, severityAttribute, idAttribute:
+				continue
+			}
+			if value != nil {
+				rowLabels[key] = logText(value)
+			}
+		}
+		labels[i], _ = json.Marshal(rowLabels) // Marshal sorts the keys
+	}
+
+	frame := data.NewFrame(LogsFrameName,
+		data.NewField(logTimestampField, nil, timestamps),
+		data.NewField(logBodyField, nil, bodies),
+		data.NewField(logSeverityField, nil, severities),
+	)
+	if idAttribute != "" {
+		frame.Fields = append(frame.Fields, data.NewField(logIDField, nil, ids))
+	}
+	frame.Fields = append(frame.Fields, data.NewField(logLabelsField, nil, labels))
+	frame.Meta = &data.FrameMeta{
+		Type:                   data.FrameTypeLogLines,
+		TypeVersion:            data.FrameTypeVersion{0, 0},
+		PreferredVisualization: data.VisTypeLogs,
+	}
+	return &backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// firstAttribute returns the first of candidates that any row has, or "".
+func firstAttribute(rows []nrdb.NRDBResult, candidates []string) string {
+	for _, candidate := range candidates {
+		for _, row := range rows {
+			if _, ok := row[candidate]; ok {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// logText renders an attribute value as log text. Arrays and objects are
+// rendered as JSON.
+func logText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}, map[string]interface{}:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(value)
+}
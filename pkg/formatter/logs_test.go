@@ -0,0 +1,81 @@
+package formatter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatLogResults(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000001000.0, "message": "payment declined", "level": "ERROR", "messageId": "b2", "service.name": "checkout", "attempt": 2.0},
+		{"timestamp": 1700000000000.0, "message": "payment started", "level": "info", "messageId": "a1", "service.name": "checkout"},
+		{"timestamp": 1699999999000.0, "message": "no level", "messageId": "a0", "tags": []interface{}{"x"}},
+	}}
+
+	resp := FormatLogResults(results)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+
+	require.NotNil(t, frame.Meta)
+	assert.Equal(t, data.FrameTypeLogLines, frame.Meta.Type)
+	assert.Equal(t, data.VisTypeLogs, string(frame.Meta.PreferredVisualization))
+
+	var names []string
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"timestamp", "body", "severity", "id", "labels"}, names)
+
+	assert.Equal(t, time.UnixMilli(1700000001000), frame.Fields[0].At(0))
+	assert.Equal(t, []interface{}{"payment declined", "payment started", "no level"}, fieldValues(frame.Fields[1]))
+	assert.Equal(t, []interface{}{"error", "info", "unknown"}, fieldValues(frame.Fields[2]))
+	assert.Equal(t, []interface{}{"b2", "a1", "a0"}, fieldValues(frame.Fields[3]))
+
+	var labels map[string]string
+	require.NoError(t, json.Unmarshal(frame.Fields[4].At(0).(json.RawMessage), &labels))
+	assert.Equal(t, map[string]string{"service.name": "checkout", "attempt": "2"}, labels)
+	assert.JSONEq(t, `{"tags":"[\"x\"]"}`, string(frame.Fields[4].At(2).(json.RawMessage)))
+}
+
+func TestFormatLogResults_WithoutID(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "log": "started", "severity": "warn"},
+	}}
+
+	frame := FormatLogResults(results).Frames[0]
+	_, idx := frame.FieldByName("id")
+	assert.Equal(t, -1, idx)
+	body, _ := frame.FieldByName("body")
+	assert.Equal(t, "started", body.At(0))
+	severity, _ := frame.FieldByName("severity")
+	assert.Equal(t, "warning", severity.At(0))
+}
+
+func TestFormatLogResults_TimestampUnits(t *testing.T) {
+	// Logs forwarded by some agents carry micro- or nanosecond timestamps
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000000.0, "message": "microseconds"},
+		{"timestamp": 1700000000000000000.0, "message": "nanoseconds"},
+		{"timestamp": 1700000000.0, "message": "seconds"},
+	}}
+
+	frame := FormatLogResults(results).Frames[0]
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Unix(1700000000, 0), frame.Fields[0].At(i), "row %d", i)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	assert.Equal(t, "critical", LogLevel("FATAL"))
+	assert.Equal(t, "error", LogLevel(" err "))
+	assert.Equal(t, "debug", LogLevel("Debug"))
+	assert.Equal(t, "unknown", LogLevel("verbose"))
+	assert.Equal(t, "unknown", LogLevel(""))
+}
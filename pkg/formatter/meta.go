@@ -0,0 +1,141 @@
+package formatter
+
+import (
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// TraceIDMetaKey is the key under FrameMeta.Custom that holds the distributed trace ID.
+const TraceIDMetaKey = "traceId"
+
+// PaginationMetaKey is the key under FrameMeta.Custom that holds the page information.
+const PaginationMetaKey = "pagination"
+
+// QueryStatsMetaKey is the key under FrameMeta.Custom that holds the query statistics.
+const QueryStatsMetaKey = "queryStats"
+
+// QueryStats describes what a query cost, for the Grafana query inspector.
+type QueryStats struct {
+	AccountID   int                    `json:"accountID"`
+	WallClockMs int64                  `json:"wallClockMs"`           // Time the plugin waited for New Relic
+	Performance map[string]interface{} `json:"performance,omitempty"` // NRDB performanceStats, when New Relic returned them
+}
+
+// performanceStats lists the NRDB performanceStats shown in the inspector's
+// stats tab, with their display names and units.
+var performanceStats = []struct {
+	Key         string
+	DisplayName string
+	Unit        string
+}{
+	{"inspectedCount", "NRDB inspected count", ""},
+	{"matchCount", "NRDB match count", ""},
+	{"omittedCount", "NRDB omitted count", ""},
+	{"wallClockTime", "NRDB wall clock time", "ms"},
+}
+
+// Pagination describes the page of rows returned for a paginated query.
+type Pagination struct {
+	PageSize  int  `json:"pageSize"`
+	PageIndex int  `json:"pageIndex"`
+	Rows      int  `json:"rows"`    // Rows returned on this page
+	HasMore   bool `json:"hasMore"` // A full page was returned, so a next page may exist
+}
+
+// setCustomMeta stores value under key in the frame's custom metadata map.
+func setCustomMeta(frame *data.Frame, key string, value interface{}) {
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	custom, ok := frame.Meta.Custom.(map[string]interface{})
+	if !ok {
+		custom = make(map[string]interface{})
+		frame.Meta.Custom = custom
+	}
+	custom[key] = value
+}
+
+// AppendNotices adds the notices to the metadata of every frame in resp.
+func AppendNotices(resp *backend.DataResponse, notices ...data.Notice) {
+	if resp == nil || len(notices) == 0 {
+		return
+	}
+	for _, frame := range resp.Frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Notices = append(frame.Meta.Notices, notices...)
+	}
+}
+
+// AttachTraceID adds the trace ID to the custom metadata of every frame in resp.
+// An empty trace ID leaves the frames untouched.
+func AttachTraceID(resp *backend.DataResponse, traceID string) {
+	if resp == nil || traceID == "" {
+		return
+	}
+	for _, frame := range resp.Frames {
+		setCustomMeta(frame, TraceIDMetaKey, traceID)
+	}
+}
+
+// AttachPagination adds the page information to the custom metadata of every frame in resp.
+func AttachPagination(resp *backend.DataResponse, pagination *Pagination) {
+	if resp == nil || pagination == nil {
+		return
+	}
+	for _, frame := range resp.Frames {
+		setCustomMeta(frame, PaginationMetaKey, pagination)
+	}
+}
+
+// PerformanceStats returns the NRDB performanceStats from the raw response of
+// the results, or nil if New Relic did not return them.
+func PerformanceStats(results interface{}) map[string]interface{} {
+	var raw nrdb.NRDBRawResults
+	switch r := results.(type) {
+	case *nrdb.NRDBResultContainer:
+		raw = r.RawResponse
+	case *nrdb.NRDBResultContainerMultiResultCustomized:
+		raw = r.RawResponse
+	}
+	stats, _ := raw["performanceStats"].(map[string]interface{})
+	return stats
+}
+
+// AttachQueryInfo sets the NRQL sent to New Relic as the executed query string of
+// every frame in resp and attaches the query statistics, both as custom metadata
+// and as stats shown in the query inspector.
+func AttachQueryInfo(resp *backend.DataResponse, executedQuery string, stats *QueryStats) {
+	if resp == nil {
+		return
+	}
+
+	var queryStats []data.QueryStat
+	if stats != nil {
+		queryStats = append(queryStats, data.QueryStat{
+			FieldConfig: data.FieldConfig{DisplayName: "Wall clock time", Unit: "ms"},
+			Value:       float64(stats.WallClockMs),
+		})
+		for _, stat := range performanceStats {
+			if value, ok := stats.Performance[stat.Key].(float64); ok {
+				queryStats = append(queryStats, data.QueryStat{
+					FieldConfig: data.FieldConfig{DisplayName: stat.DisplayName, Unit: stat.Unit},
+					Value:       value,
+				})
+			}
+		}
+	}
+
+	for _, frame := range resp.Frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.ExecutedQueryString = executedQuery
+		if stats != nil {
+			frame.Meta.Stats = append(frame.Meta.Stats, queryStats...)
+			setCustomMeta(frame, QueryStatsMetaKey, stats)
+		}
+	}
+}
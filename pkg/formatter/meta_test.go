@@ -0,0 +1,53 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformanceStats(t *testing.T) {
+	stats := map[string]interface{}{"inspectedCount": 10.0}
+
+	assert.Equal(t, stats, PerformanceStats(&nrdb.NRDBResultContainer{
+		RawResponse: nrdb.NRDBRawResults{"performanceStats": stats},
+	}))
+	assert.Equal(t, stats, PerformanceStats(&nrdb.NRDBResultContainerMultiResultCustomized{
+		RawResponse: nrdb.NRDBRawResults{"performanceStats": stats},
+	}))
+	assert.Nil(t, PerformanceStats(&nrdb.NRDBResultContainer{}))
+	assert.Nil(t, PerformanceStats(nil))
+}
+
+func TestAttachQueryInfo(t *testing.T) {
+	resp := &backend.DataResponse{Frames: data.Frames{data.NewFrame("A"), data.NewFrame("B")}}
+	stats := &QueryStats{
+		AccountID:   123,
+		WallClockMs: 250,
+		Performance: map[string]interface{}{"matchCount": 5.0, "omittedCount": 0.0, "exceedsRetentionWindow": false},
+	}
+
+	AttachQueryInfo(resp, "SELECT count(*) FROM Transaction", stats)
+
+	for _, frame := range resp.Frames {
+		require.NotNil(t, frame.Meta)
+		assert.Equal(t, "SELECT count(*) FROM Transaction", frame.Meta.ExecutedQueryString)
+		assert.Equal(t, []data.QueryStat{
+			{FieldConfig: data.FieldConfig{DisplayName: "Wall clock time", Unit: "ms"}, Value: 250},
+			{FieldConfig: data.FieldConfig{DisplayName: "NRDB match count"}, Value: 5},
+			{FieldConfig: data.FieldConfig{DisplayName: "NRDB omitted count"}, Value: 0},
+		}, frame.Meta.Stats)
+		assert.Equal(t, stats, frame.Meta.Custom.(map[string]interface{})[QueryStatsMetaKey])
+	}
+
+	// Without stats only the executed query is set
+	resp = &backend.DataResponse{Frames: data.Frames{data.NewFrame("A")}}
+	AttachQueryInfo(resp, "SELECT 1", nil)
+	assert.Equal(t, "SELECT 1", resp.Frames[0].Meta.ExecutedQueryString)
+	assert.Empty(t, resp.Frames[0].Meta.Stats)
+	assert.Nil(t, resp.Frames[0].Meta.Custom)
+}
@@ -0,0 +1,183 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// UnfacetedGroupName is the facet value used for rows without a facet value
+// when FormatOptions.KeepUnfaceted is set.
+const UnfacetedGroupName = "(unfaceted)"
+
+// FormatOptions holds per-query options that change how results are formatted.
+// The zero value gives the default formatting.
+type FormatOptions struct {
+	// KeepUnfaceted groups rows of faceted results that have no facet value under
+	// UnfacetedGroupName instead of dropping them.
+	KeepUnfaceted bool
+
+	// JoinUniques renders each uniques() array as one comma-separated string cell
+	// instead of a row per unique value.
+	JoinUniques bool
+
+	// Columns lists the columns to put first, in order, in tables of events or
+	// aggregates. The other columns follow in ascending order.
+	Columns []string
+
+	// Wide returns faceted TIMESERIES results as one wide frame with a shared
+	// time field and a labeled value column per facet value, instead of a frame
+	// per facet value.
+	Wide bool
+
+	// FacetTime is the models.FacetTime mode of faceted count results that have
+	// no TIMESERIES buckets. Empty means models.FacetTimeEnd.
+	FacetTime string
+
+	// FillMode is the models.FillMode value given to TIMESERIES buckets without
+	// data, after every series is aligned on the same buckets. Empty means
+	// models.FillModeNull.
+	FillMode string
+
+	// FacetOrder is the models.FacetOrder of the series of faceted results.
+	// Empty means models.FacetOrderName.
+	FacetOrder string
+
+	// FlattenDepth is the number of levels of nested object and array values
+	// of result rows flattened into dotted columns, e.g.
+	// attributes.request.headers.host. Zero keeps nested values as JSON text.
+	FlattenDepth int
+
+	// FieldTypes are the datasource's rules forcing the type of result fields,
+	// consulted before a field's type is inferred from its values.
+	FieldTypes []models.FieldTypeRule
+}
+
+// FormatQueryResultsWithOptions formats results like FormatQueryResults, applying opts.
+func FormatQueryResultsWithOptions(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+	return formatQueryResults(results, query, opts)
+}
+
+// FormatFacetedTimeseriesResultsWithOptions formats results like
+// FormatFacetedTimeseriesResults, applying opts.
+func FormatFacetedTimeseriesResultsWithOptions(results *nrdb.NRDBResultContainerMultiResultCustomized, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+	return formatFacetedTimeseriesResults(results, query, opts)
+}
+
+// groupByFacetValue groups rows by their facet values. Rows of multi-facet
+// queries are keyed on the full facet tuple, joined with ", " as New Relic
+// displays it. Rows without a facet value are grouped under UnfacetedGroupName
+// when keepUnfaceted is set and dropped otherwise; the number of such rows is
+// returned either way.
+func groupByFacetValue(rows []nrdb.NRDBResult, keepUnfaceted bool) (map[string][]nrdb.NRDBResult, int) {
+	grouped := make(map[string][]nrdb.NRDBResult)
+	unfaceted := 0
+
+	for _, result := range rows {
+		facetValue := strings.Join(facetTuple(result), ", ")
+		if strings.Trim(facetValue, ", ") == "" {
+			facetValue = ""
+		}
+
+		if facetValue == "" {
+			unfaceted++
+			if !keepUnfaceted {
+				continue
+			}
+			facetValue = UnfacetedGroupName
+		}
+		grouped[facetValue] = append(grouped[facetValue], result)
+	}
+
+	return grouped, unfaceted
+}
+
+// sortedFacetValues returns the facet values of grouped in the given
+// models.FacetOrder, so that series keep their order, and legend colors, across
+// refreshes. With models.FacetOrderValue, groups are ordered by the valueField
+// of their first row, largest first; groups without a numeric value come last
+// and ties are ordered by name.
+func sortedFacetValues(grouped map[string][]nrdb.NRDBResult, order string, valueField string) []string {
+	values := make([]string, 0, len(grouped))
+	for facetValue := range grouped {
+		values = append(values, facetValue)
+	}
+	sort.Strings(values)
+	if order != models.FacetOrderValue || valueField == "" {
+		return values
+	}
+
+	first := func(facetValue string) (float64, bool) {
+		rows := grouped[facetValue]
+		if len(rows) == 0 {
+			return 0, false
+		}
+		value, ok := rows[0][valueField].(float64)
+		return value, ok
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		a, aOK := first(values[i])
+		b, bOK := first(values[j])
+		if aOK != bOK {
+			return aOK
+		}
+		return aOK && a > b
+	})
+	return values
+}
+
+// facetTuple returns the facet values of a result row: one per facet for
+// multi-facet queries, or the single facet value.
+func facetTuple(result nrdb.NRDBResult) []string {
+	switch facet := result[utils.FacetFieldName].(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		values := make([]string, len(facet))
+		for i, value := range facet {
+			values[i] = fmt.Sprintf("%v", value)
+		}
+		return values
+	default:
+		return []string{fmt.Sprintf("%v", facet)}
+	}
+}
+
+// facetLabels returns the labels of the series for a group of rows returned by
+// groupByFacetValue: a label per facet name with the row's value for it.
+func facetLabels(rows []nrdb.NRDBResult, facetNames []string, facetValue string) data.Labels {
+	if len(facetNames) == 0 {
+		return nil
+	}
+	if facetValue == UnfacetedGroupName || len(rows) == 0 {
+		return data.Labels{facetNames[0]: facetValue}
+	}
+	labels := data.Labels{}
+	for i, value := range facetTuple(rows[0]) {
+		if i < len(facetNames) {
+			labels[facetNames[i]] = value
+		}
+	}
+	return labels
+}
+
+// unfacetedNotice returns the notice describing how rows without a facet value were handled.
+func unfacetedNotice(unfaceted int, kept bool) data.Notice {
+	if kept {
+		return data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("%d row(s) without a facet value grouped under %s", unfaceted, UnfacetedGroupName),
+		}
+	}
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("%d row(s) without a facet value were dropped; enable keepUnfaceted to include them", unfaceted),
+	}
+}
@@ -0,0 +1,230 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mixedFacetRows returns faceted timeseries rows where one row has no facet value.
+func mixedFacetRows() []nrdb.NRDBResult {
+	return []nrdb.NRDBResult{
+		{"facet": "app1", "average.duration": 1.0, "beginTimeSeconds": 1700000000.0},
+		{"facet": []interface{}{"app2"}, "average.duration": 2.0, "beginTimeSeconds": 1700000000.0},
+		{"average.duration": 3.0, "beginTimeSeconds": 1700000000.0},
+		{"facet": "", "average.duration": 4.0, "beginTimeSeconds": 1700000060.0},
+	}
+}
+
+func TestGroupByFacetValue(t *testing.T) {
+	t.Run("drops unfaceted rows by default", func(t *testing.T) {
+		grouped, unfaceted := groupByFacetValue(mixedFacetRows(), false)
+		assert.Equal(t, 2, unfaceted)
+		assert.Len(t, grouped, 2)
+		assert.NotContains(t, grouped, UnfacetedGroupName)
+	})
+
+	t.Run("keeps unfaceted rows when requested", func(t *testing.T) {
+		grouped, unfaceted := groupByFacetValue(mixedFacetRows(), true)
+		assert.Equal(t, 2, unfaceted)
+		assert.Len(t, grouped, 3)
+		require.Len(t, grouped[UnfacetedGroupName], 2)
+		assert.Equal(t, 3.0, grouped[UnfacetedGroupName][0]["average.duration"])
+		assert.Equal(t, 4.0, grouped[UnfacetedGroupName][1]["average.duration"])
+	})
+}
+
+func TestSortedFacetValues(t *testing.T) {
+	grouped := map[string][]nrdb.NRDBResult{
+		"web":    {{"count": 5.0}},
+		"api":    {{"count": 9.0}},
+		"worker": {{"count": 5.0}},
+		"batch":  {{"count": "n/a"}},
+		"cron":   {},
+	}
+
+	assert.Equal(t, []string{"api", "batch", "cron", "web", "worker"}, sortedFacetValues(grouped, "", "count"))
+	assert.Equal(t, []string{"api", "batch", "cron", "web", "worker"}, sortedFacetValues(grouped, models.FacetOrderName, "count"))
+	assert.Equal(t, []string{"api", "web", "worker", "batch", "cron"}, sortedFacetValues(grouped, models.FacetOrderValue, "count"))
+	assert.Equal(t, []string{"api", "batch", "cron", "web", "worker"}, sortedFacetValues(grouped, models.FacetOrderValue, ""))
+}
+
+func TestFormatQueryResultsWithOptions_FacetOrder(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": "web", "count": 2.0, "beginTimeSeconds": 1700000000.0},
+			{"facet": "api", "count": 1.0, "beginTimeSeconds": 1700000000.0},
+			{"facet": "worker", "count": 3.0, "beginTimeSeconds": 1700000000.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+
+	frameNames := func(resp *backend.DataResponse) []string {
+		var names []string
+		for _, frame := range resp.Frames {
+			names = append(names, frame.Name)
+		}
+		return names
+	}
+
+	for i := 0; i < 10; i++ {
+		resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, FormatOptions{})
+		require.NoError(t, resp.Error)
+		require.Equal(t, []string{"api", "web", "worker"}, frameNames(resp))
+	}
+
+	resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, FormatOptions{FacetOrder: models.FacetOrderValue})
+	require.NoError(t, resp.Error)
+	assert.Equal(t, []string{"worker", "web", "api"}, frameNames(resp))
+
+	resp = FormatQueryResultsWithOptions(results, backend.DataQuery{}, FormatOptions{FacetOrder: models.FacetOrderValue, Wide: true})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	var columns []string
+	for _, field := range resp.Frames[0].Fields[1:] {
+		columns = append(columns, field.Labels["appName"])
+	}
+	assert.Equal(t, []string{"worker", "web", "api"}, columns)
+}
+
+func TestFormatQueryResultsWithOptions_UnfacetedRows(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results:  mixedFacetRows(),
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+
+	frameNames := func(resp *backend.DataResponse) []string {
+		var names []string
+		for _, frame := range resp.Frames {
+			names = append(names, frame.Name)
+		}
+		return names
+	}
+
+	t.Run("dropped rows are reported", func(t *testing.T) {
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		assert.ElementsMatch(t, []string{"app1", "app2"}, frameNames(resp))
+		for _, frame := range resp.Frames {
+			require.NotNil(t, frame.Meta)
+			require.Len(t, frame.Meta.Notices, 1)
+			assert.Equal(t, data.NoticeSeverityWarning, frame.Meta.Notices[0].Severity)
+			assert.Contains(t, frame.Meta.Notices[0].Text, "2 row(s) without a facet value were dropped")
+		}
+	})
+
+	t.Run("kept rows get their own group", func(t *testing.T) {
+		resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, FormatOptions{KeepUnfaceted: true})
+		require.NoError(t, resp.Error)
+		assert.ElementsMatch(t, []string{"app1", "app2", UnfacetedGroupName}, frameNames(resp))
+		for _, frame := range resp.Frames {
+			require.Len(t, frame.Meta.Notices, 1)
+			assert.Contains(t, frame.Meta.Notices[0].Text, "grouped under (unfaceted)")
+			if frame.Name == UnfacetedGroupName {
+				field, _ := frame.FieldByName("average.duration")
+				require.NotNil(t, field)
+				assert.Equal(t, data.Labels{"appName": UnfacetedGroupName}, field.Labels)
+				assert.Equal(t, 2, field.Len())
+			}
+		}
+	})
+
+	t.Run("no notice when every row is faceted", func(t *testing.T) {
+		resp := FormatQueryResults(facetedAggregationResults(), backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		for _, frame := range resp.Frames {
+			if frame.Meta != nil {
+				assert.Empty(t, frame.Meta.Notices)
+			}
+		}
+	})
+}
+
+func TestFormatQueryResultsWithOptions_FacetTime(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: from.Add(2 * time.Hour)}}
+	results := func() *nrdb.NRDBResultContainer {
+		return &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"count": 10.0, "facet": []interface{}{"app1"}},
+				{"count": 20.0, "facet": []interface{}{"app2"}},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		facetTime string
+		want      time.Time
+	}{
+		{name: "default stamps the range end", facetTime: "", want: from.Add(2 * time.Hour)},
+		{name: "end", facetTime: models.FacetTimeEnd, want: from.Add(2 * time.Hour)},
+		{name: "midpoint", facetTime: models.FacetTimeMidpoint, want: from.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := FormatQueryResultsWithOptions(results(), query, FormatOptions{FacetTime: tt.facetTime})
+			require.Len(t, resp.Frames, 2)
+			for _, frame := range resp.Frames {
+				require.Len(t, frame.Fields, 2)
+				assert.Equal(t, tt.want, frame.Fields[0].At(0))
+			}
+		})
+	}
+
+	t.Run("none omits the time field", func(t *testing.T) {
+		resp := FormatQueryResultsWithOptions(results(), query, FormatOptions{FacetTime: models.FacetTimeNone})
+		require.Len(t, resp.Frames, 2)
+		for _, frame := range resp.Frames {
+			require.Len(t, frame.Fields, 1)
+			assert.Equal(t, "count", frame.Fields[0].Name)
+		}
+	})
+
+	t.Run("table returns one table frame", func(t *testing.T) {
+		resp := FormatQueryResultsWithOptions(results(), query, FormatOptions{FacetTime: models.FacetTimeTable})
+		require.Len(t, resp.Frames, 1)
+		frame := resp.Frames[0]
+		assert.Equal(t, data.VisType(data.VisTypeTable), frame.Meta.PreferredVisualization)
+		require.Len(t, frame.Fields, 2)
+		assert.Equal(t, "appName", frame.Fields[0].Name)
+		assert.Equal(t, []interface{}{"app1", "app2"}, []interface{}{frame.Fields[0].At(0), frame.Fields[0].At(1)})
+		assert.Equal(t, 20.0, frame.Fields[1].At(1))
+	})
+}
+
+func TestFormatQueryResultsWithOptions_MultiFacet(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": []interface{}{"checkout", "host-1"}, "average.duration": 1.0, "beginTimeSeconds": 1700000000.0},
+			{"facet": []interface{}{"checkout", "host-2"}, "average.duration": 2.0, "beginTimeSeconds": 1700000000.0},
+			{"facet": []interface{}{"checkout", "host-1"}, "average.duration": 3.0, "beginTimeSeconds": 1700000060.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"service", "host"}},
+	}
+
+	resp := FormatQueryResultsWithOptions(results, backend.DataQuery{RefID: "A"}, FormatOptions{})
+	require.Len(t, resp.Frames, 2)
+
+	labels := map[string]data.Labels{}
+	rows := map[string]int{}
+	for _, frame := range resp.Frames {
+		require.Len(t, frame.Fields, 2)
+		labels[frame.Name] = frame.Fields[1].Labels
+		rows[frame.Name] = frame.Fields[1].Len()
+	}
+	assert.Equal(t, map[string]data.Labels{
+		"checkout, host-1": {"service": "checkout", "host": "host-1"},
+		"checkout, host-2": {"service": "checkout", "host": "host-2"},
+	}, labels)
+	// The missing host-2 bucket is filled with null
+	assert.Equal(t, map[string]int{"checkout, host-1": 2, "checkout, host-2": 2}, rows)
+}
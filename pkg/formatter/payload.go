@@ -0,0 +1,182 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// DefaultMaxResponseBytes is the estimated serialized size a query response may
+// reach when the datasource settings do not set a budget. Browsers struggle
+// with responses of hundreds of megabytes, e.g. from unfiltered log queries.
+const DefaultMaxResponseBytes = 64 << 20
+
+// minDownsampleRows is the fewest rows a frame is reduced to by the payload
+// budget, so that every series still draws a line.
+const minDownsampleRows = 10
+
+// Estimated serialized size of values that are not strings, as JSON text
+const (
+	nullValueBytes   = 4  // null
+	numberValueBytes = 12 // Typical number, with separator
+	timeValueBytes   = 14 // Epoch milliseconds, with separator
+	boolValueBytes   = 6  // true or false, with separator
+)
+
+// EstimateSize returns the approximate size of resp's frames once serialized
+// for the browser. It costs a pass over the values instead of an encoding of
+// the response, so it is cheap enough to run on every response.
+func EstimateSize(resp *backend.DataResponse) int {
+	if resp == nil {
+		return 0
+	}
+	size := 0
+	for _, frame := range resp.Frames {
+		size += frameSize(frame)
+	}
+	return size
+}
+
+// frameSize returns the estimated serialized size of frame.
+func frameSize(frame *data.Frame) int {
+	size := headerSize(frame)
+	for _, field := range frame.Fields {
+		size += valuesSize(field)
+	}
+	return size
+}
+
+// headerSize returns the estimated serialized size of the names and labels of
+// frame, which do not shrink with its rows.
+func headerSize(frame *data.Frame) int {
+	size := len(frame.Name)
+	for _, field := range frame.Fields {
+		size += len(field.Name)
+		for name, value := range field.Labels {
+			size += len(name) + len(value)
+		}
+	}
+	return size
+}
+
+// valuesSize returns the estimated serialized size of field's values.
+func valuesSize(field *data.Field) int {
+	size := 0
+	n := field.Len()
+	switch field.Type() {
+	case data.FieldTypeString:
+		for i := 0; i < n; i++ {
+			size += len(field.At(i).(string)) + 3
+		}
+	case data.FieldTypeNullableString:
+		for i := 0; i < n; i++ {
+			if s := field.At(i).(*string); s != nil {
+				size += len(*s) + 3
+			} else {
+				size += nullValueBytes
+			}
+		}
+	case data.FieldTypeJSON, data.FieldTypeNullableJSON:
+		for i := 0; i < n; i++ {
+			switch v := field.At(i).(type) {
+			case json.RawMessage:
+				size += len(v) + 1
+			case *json.RawMessage:
+				if v != nil {
+					size += len(*v) + 1
+				} else {
+					size += nullValueBytes
+				}
+			}
+		}
+	case data.FieldTypeTime, data.FieldTypeNullableTime:
+		size += n * timeValueBytes
+	case data.FieldTypeBool, data.FieldTypeNullableBool:
+		size += n * boolValueBytes
+	default:
+		size += n * numberValueBytes
+	}
+	return size
+}
+
+// ApplyPayloadBudget keeps resp under roughly maxBytes once serialized, and
+// returns its estimated size before any reduction. Wide time series frames are
+// downsampled with method; if the response is still over budget, the rows of
+// every frame are truncated in proportion. A warning notice explains what was
+// removed. A budget of zero or less is not applied.
+func ApplyPayloadBudget(resp *backend.DataResponse, maxBytes int, method string) int {
+	if resp == nil || resp.Error != nil {
+		return 0
+	}
+	size := EstimateSize(resp)
+	if maxBytes <= 0 || size <= maxBytes {
+		return size
+	}
+	// Names and labels stay, so only the values are scaled down to the budget
+	headers := 0
+	for _, frame := range resp.Frames {
+		headers += headerSize(frame)
+	}
+	ratio := float64(max(maxBytes-headers, 0)) / float64(size-headers)
+
+	downsampled := 0
+	for _, frame := range resp.Frames {
+		rows, err := frame.RowLen()
+		if err != nil {
+			continue
+		}
+		if DownsampleFrame(frame, max(int(float64(rows)*ratio), minDownsampleRows), method) {
+			downsampled++
+		}
+	}
+	if downsampled > 0 {
+		AppendNotices(resp, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Response of about %s exceeds the %s payload budget; downsampled %d time series frames", formatBytes(size), formatBytes(maxBytes), downsampled),
+		})
+	}
+
+	reduced := EstimateSize(resp)
+	if reduced <= maxBytes {
+		return size
+	}
+	ratio = float64(max(maxBytes-headers, 0)) / float64(reduced-headers)
+	truncated := 0
+	for _, frame := range resp.Frames {
+		rows, err := frame.RowLen()
+		if err != nil || rows == 0 {
+			continue
+		}
+		if keep := int(float64(rows) * ratio); keep < rows {
+			for _, field := range frame.Fields {
+				for i := rows - 1; i >= keep; i-- {
+					field.Delete(i)
+				}
+			}
+			truncated += rows - keep
+		}
+	}
+	if truncated > 0 {
+		AppendNotices(resp, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Response of about %s exceeds the %s payload budget; removed the last %d rows, narrow the query to see them", formatBytes(reduced), formatBytes(maxBytes), truncated),
+		})
+	}
+	return size
+}
+
+// formatBytes renders n bytes in the largest binary unit below it, e.g. "1.5 MiB".
+func formatBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,87 @@
+package formatter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateSize(t *testing.T) {
+	message := "hello"
+	raw := json.RawMessage(`{"a":1}`)
+	frame := data.NewFrame("logs",
+		data.NewField("message", nil, []string{"abc", "de"}),
+		data.NewField("level", nil, []*string{&message, nil}),
+		data.NewField("attributes", nil, []json.RawMessage{raw, raw}),
+		data.NewField("value", nil, []float64{1, 2}),
+	)
+	resp := &backend.DataResponse{Frames: data.Frames{frame}}
+
+	want := len("logs") +
+		len("message") + (3 + 3) + (2 + 3) +
+		len("level") + (5 + 3) + nullValueBytes +
+		len("attributes") + 2*(len(raw)+1) +
+		len("value") + 2*numberValueBytes
+	assert.Equal(t, want, EstimateSize(resp))
+	assert.Equal(t, 0, EstimateSize(nil))
+}
+
+func TestApplyPayloadBudget(t *testing.T) {
+	t.Run("under budget is unchanged", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{seriesFrame(100, "a")}}
+		size := ApplyPayloadBudget(resp, 1<<20, "")
+
+		assert.Equal(t, EstimateSize(resp), size)
+		rows, _ := resp.Frames[0].RowLen()
+		assert.Equal(t, 100, rows)
+		assert.Nil(t, resp.Frames[0].Meta)
+	})
+
+	t.Run("downsamples time series", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{seriesFrame(1000, "a", "b")}}
+		size := EstimateSize(resp)
+		assert.Equal(t, size, ApplyPayloadBudget(resp, size/4, DownsampleLTTB))
+
+		assert.LessOrEqual(t, EstimateSize(resp), size/4)
+		rows, _ := resp.Frames[0].RowLen()
+		assert.InDelta(t, 250, rows, 1)
+		require.NotNil(t, resp.Frames[0].Meta)
+		require.Len(t, resp.Frames[0].Meta.Notices, 1)
+		assert.Contains(t, resp.Frames[0].Meta.Notices[0].Text, "downsampled 1 time series frames")
+	})
+
+	t.Run("truncates tables", func(t *testing.T) {
+		messages := make([]string, 1000)
+		for i := range messages {
+			messages[i] = strings.Repeat("x", 100)
+		}
+		resp := &backend.DataResponse{Frames: data.Frames{data.NewFrame("logs", data.NewField("message", nil, messages))}}
+		ApplyPayloadBudget(resp, 10000, "")
+
+		assert.LessOrEqual(t, EstimateSize(resp), 10000)
+		rows, _ := resp.Frames[0].RowLen()
+		assert.Greater(t, rows, 0)
+		require.NotNil(t, resp.Frames[0].Meta)
+		require.Len(t, resp.Frames[0].Meta.Notices, 1)
+		assert.Contains(t, resp.Frames[0].Meta.Notices[0].Text, "payload budget; removed the last")
+	})
+
+	t.Run("disabled budget and errors", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{seriesFrame(100, "a")}}
+		ApplyPayloadBudget(resp, 0, "")
+		rows, _ := resp.Frames[0].RowLen()
+		assert.Equal(t, 100, rows)
+		assert.Equal(t, 0, ApplyPayloadBudget(nil, 10, ""))
+	})
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "64.0 MiB", formatBytes(DefaultMaxResponseBytes))
+}
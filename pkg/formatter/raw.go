@@ -0,0 +1,145 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// FormatterRawFields is the formatter name reported in routing traces for raw field queries.
+const FormatterRawFields = "formatRawResults"
+
+// FormatRawResults creates a single frame whose columns are keyed exactly as New Relic
+// returns them. No renaming happens: timestamps are not aliased to a time field,
+// percentile objects are not expanded and facets are not turned into labels.
+// Columns are only typed, based on the values present in the results.
+func FormatRawResults(results *nrdb.NRDBResultContainer, query backend.DataQuery) *backend.DataResponse {
+	resp := &backend.DataResponse{}
+	if len(results.Results) == 0 {
+		return resp
+	}
+
+	frame := data.NewFrame(utils.StandardResponseFrameName)
+	for _, fieldName := range rawFieldNames(results.Results) {
+		frame.Fields = append(frame.Fields, newRawField(results.Results, fieldName))
+	}
+
+	resp.Frames = append(resp.Frames, frame)
+	return resp
+}
+
+// FormatRawResultsMulti is the multi-result container version of FormatRawResults.
+func FormatRawResultsMulti(results *nrdb.NRDBResultContainerMultiResultCustomized, query backend.DataQuery) *backend.DataResponse {
+	return FormatRawResults(toStandardContainerMulti(results), query)
+}
+
+// rawFieldNames returns every key present in the results, sorted for stable column order.
+func rawFieldNames(results []nrdb.NRDBResult) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, result := range results {
+		for key := range result {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				names = append(names, key)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectRawFieldType determines a column type purely from the values in the results.
+// Mixed columns fall back to "string"; arrays and objects are reported as "json".
+func detectRawFieldType(results []nrdb.NRDBResult, fieldName string) string {
+	fieldType := ""
+	for _, result := range results {
+		var valueType string
+		switch result[fieldName].(type) {
+		case nil:
+			continue
+		case float64, int, int64:
+			valueType = "number"
+		case bool:
+			valueType = "boolean"
+		case []interface{}, map[string]interface{}:
+			valueType = "json"
+		default:
+			valueType = "string"
+		}
+
+		if fieldType == "" {
+			fieldType = valueType
+		} else if fieldType != valueType {
+			return "string"
+		}
+	}
+
+	if fieldType == "" {
+		return "string"
+	}
+	return fieldType
+}
+
+// newRawField builds a typed field for fieldName without changing its name or shape.
+func newRawField(results []nrdb.NRDBResult, fieldName string) *data.Field {
+	switch detectRawFieldType(results, fieldName) {
+	case "number":
+		values := make([]*float64, len(results))
+		for i, result := range results {
+			switch v := result[fieldName].(type) {
+			case float64:
+				values[i] = &v
+			case int:
+				f := float64(v)
+				values[i] = &f
+			case int64:
+				f := float64(v)
+				values[i] = &f
+			}
+		}
+		return data.NewField(fieldName, nil, values)
+
+	case "boolean":
+		values := make([]*bool, len(results))
+		for i, result := range results {
+			if v, ok := result[fieldName].(bool); ok {
+				values[i] = &v
+			}
+		}
+		return data.NewField(fieldName, nil, values)
+
+	case "json":
+		values := make([]*json.RawMessage, len(results))
+		for i, result := range results {
+			if result[fieldName] == nil {
+				continue
+			}
+			if jsonBytes, err := json.Marshal(result[fieldName]); err == nil {
+				raw := json.RawMessage(jsonBytes)
+				values[i] = &raw
+			}
+		}
+		return data.NewField(fieldName, nil, values)
+
+	default:
+		values := make([]*string, len(results))
+		for i, result := range results {
+			if result[fieldName] == nil {
+				continue
+			}
+			s, ok := result[fieldName].(string)
+			if !ok {
+				s = fmt.Sprintf("%v", result[fieldName])
+			}
+			values[i] = &s
+		}
+		return data.NewField(fieldName, nil, values)
+	}
+}
@@ -0,0 +1,107 @@
+package formatter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatRawResults(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{
+				"beginTimeSeconds":    1700000000.0,
+				"timestamp":           1700000000123.0,
+				"percentile.duration": map[string]interface{}{"95": 1.2},
+				"facet":               []interface{}{"app1", "host1"},
+				"appName":             "app1",
+				"error":               true,
+			},
+			{
+				"beginTimeSeconds": 1700000060.0,
+				"appName":          "app2",
+			},
+		},
+	}
+
+	resp := FormatRawResults(results, backend.DataQuery{RefID: "A"})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+
+	names := make([]string, len(frame.Fields))
+	for i, field := range frame.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"appName", "beginTimeSeconds", "error", "facet", "percentile.duration", "timestamp"}, names)
+
+	byName := func(name string) *data.Field {
+		field, _ := frame.FieldByName(name)
+		require.NotNil(t, field, name)
+		return field
+	}
+
+	// Timestamps stay numeric and keep their names
+	assert.Equal(t, data.FieldTypeNullableFloat64, byName("beginTimeSeconds").Type())
+	assert.Equal(t, data.FieldTypeNullableFloat64, byName("timestamp").Type())
+	assert.Nil(t, byName("timestamp").At(1))
+
+	// Percentile objects are not expanded
+	percentile := byName("percentile.duration")
+	assert.Equal(t, data.FieldTypeNullableJSON, percentile.Type())
+	assert.JSONEq(t, `{"95":1.2}`, string(*percentile.At(0).(*json.RawMessage)))
+
+	assert.Equal(t, data.FieldTypeNullableJSON, byName("facet").Type())
+	assert.Equal(t, data.FieldTypeNullableBool, byName("error").Type())
+	assert.Equal(t, data.FieldTypeNullableString, byName("appName").Type())
+	assert.Equal(t, "app2", *byName("appName").At(1).(*string))
+}
+
+func TestFormatRawResults_Empty(t *testing.T) {
+	resp := FormatRawResults(&nrdb.NRDBResultContainer{}, backend.DataQuery{})
+	assert.NoError(t, resp.Error)
+	assert.Empty(t, resp.Frames)
+}
+
+func TestFormatRawResultsMulti(t *testing.T) {
+	results := &nrdb.NRDBResultContainerMultiResultCustomized{
+		OtherResult: nrdb.NRDBMultiResultCustomized{
+			{"count": 3.0, "facet": "app1", "beginTimeSeconds": 1700000000.0},
+		},
+	}
+
+	resp := FormatRawResultsMulti(results, backend.DataQuery{})
+	require.Len(t, resp.Frames, 1)
+	assert.Len(t, resp.Frames[0].Fields, 3)
+}
+
+func TestDetectRawFieldType(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []interface{}
+		expected string
+	}{
+		{"numbers", []interface{}{1.0, 2}, "number"},
+		{"strings", []interface{}{"a", "1.5"}, "string"},
+		{"booleans", []interface{}{true, nil}, "boolean"},
+		{"arrays", []interface{}{[]interface{}{1.0}}, "json"},
+		{"objects", []interface{}{map[string]interface{}{"a": 1.0}}, "json"},
+		{"mixed falls back to string", []interface{}{1.0, "a"}, "string"},
+		{"all nil", []interface{}{nil, nil}, "string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := make([]nrdb.NRDBResult, len(tt.values))
+			for i, v := range tt.values {
+				results[i] = nrdb.NRDBResult{"field": v}
+			}
+			assert.Equal(t, tt.expected, detectRawFieldType(results, "field"))
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package formatter
+
+import (
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// Route pairs a result shape with the formatter that converts results of that
+// shape. FormatQueryResults uses the first route whose Detect matches.
+type Route struct {
+	// Name is the detector name reported in routing traces.
+	Name string
+	// Formatter is the formatter name reported in routing traces.
+	Formatter string
+	// Detect reports whether results have the shape of this route.
+	Detect func(results *nrdb.NRDBResultContainer) bool
+	// Format converts results of this shape into frames.
+	Format func(results *nrdb.NRDBResultContainer, query backend.DataQuery, opts FormatOptions) *backend.DataResponse
+	// Complete is set when Format returns the final response, so bucket
+	// alignment and field name dedupe are skipped.
+	Complete bool
+}
+
+var (
+	routesMu sync.RWMutex
+	routes   []Route
+)
+
+// The built-in routes are set in init, as the compare formatter formats each
+// window through the registry.
+func init() {
+	routes = builtinRoutes()
+}
+
+// builtinRoutes returns the routes for the result shapes NRDB returns, in the
+// order they are checked. The standard route matches any results and is last.
+// Logs and traces are not routes: the handler picks FormatLogResults and
+// FormatTraceResults from the query type and event types, which the results
+// alone do not carry.
+func builtinRoutes() []Route {
+	return []Route{
+		{
+			Name:      DetectorCompare,
+			Formatter: "formatCompareQuery",
+			Detect:    isCompareResult,
+			Format:    formatCompareQuery,
+			Complete:  true,
+		},
+		{
+			Name:      DetectorKeyset,
+			Formatter: "formatKeysetQuery",
+			Detect:    isKeysetResult,
+			Format: func(results *nrdb.NRDBResultContainer, _ backend.DataQuery, _ FormatOptions) *backend.DataResponse {
+				return formatKeysetQuery(results)
+			},
+		},
+		{
+			Name:      DetectorUniques,
+			Formatter: "formatUniquesQuery",
+			Detect:    isUniquesResult,
+			Format: func(results *nrdb.NRDBResultContainer, _ backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+				return formatUniquesQuery(results, opts)
+			},
+		},
+		{
+			Name:      DetectorSimpleCount,
+			Formatter: "formatSimpleCountQuery",
+			Detect:    isSimpleCountQuery,
+			Format: func(results *nrdb.NRDBResultContainer, query backend.DataQuery, _ FormatOptions) *backend.DataResponse {
+				return formatSimpleCountQuery(results, query)
+			},
+		},
+		{
+			Name:      DetectorFacetedCount,
+			Formatter: "formatFacetedCountQuery",
+			Detect:    isFacetedCountQuery,
+			Format:    formatFacetedCountQuery,
+		},
+		{
+			// Faceted timeseries queries, e.g. "SELECT sum(duration) FROM Transaction FACET request.uri TIMESERIES"
+			Name:      DetectorFacetedTimeseries,
+			Formatter: "formatFacetedTimeseriesQuery",
+			Detect:    isFacetedTimeseriesQuery,
+			Format:    formatFacetedTimeseriesQuery,
+		},
+		{
+			Name:      DetectorStandard,
+			Formatter: "formatStandardQuery",
+			Detect:    func(*nrdb.NRDBResultContainer) bool { return true },
+			Format:    formatStandardQuery,
+		},
+	}
+}
+
+// RegisterRoute adds route ahead of the registered routes, so it is checked
+// before them and can take over results a built-in route would format. It
+// returns a function that removes the route again, for tests.
+func RegisterRoute(route Route) (unregister func()) {
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	routes = append([]Route{route}, routes...)
+
+	return func() {
+		routesMu.Lock()
+		defer routesMu.Unlock()
+		for i := range routes {
+			if routes[i].Name == route.Name && routes[i].Formatter == route.Formatter {
+				routes = append(routes[:i:i], routes[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Routes returns the registered routes in the order they are checked.
+func Routes() []Route {
+	routesMu.RLock()
+	defer routesMu.RUnlock()
+	return append([]Route(nil), routes...)
+}
+
+// matchRoute returns the first registered route that detects results, or the
+// standard route if none does.
+func matchRoute(results *nrdb.NRDBResultContainer) Route {
+	routesMu.RLock()
+	defer routesMu.RUnlock()
+	for _, route := range routes {
+		if route.Detect(results) {
+			return route
+		}
+	}
+	return Route{Name: DetectorStandard, Formatter: "formatStandardQuery", Format: formatStandardQuery}
+}
@@ -0,0 +1,93 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutes_BuiltinOrder(t *testing.T) {
+	var names []string
+	for _, route := range Routes() {
+		names = append(names, route.Name)
+	}
+	assert.Equal(t, []string{
+		DetectorCompare,
+		DetectorKeyset,
+		DetectorUniques,
+		DetectorSimpleCount,
+		DetectorFacetedCount,
+		DetectorFacetedTimeseries,
+		DetectorStandard,
+	}, names)
+}
+
+func TestRegisterRoute(t *testing.T) {
+	histogram := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"histogram.duration": []interface{}{1.0, 4.0, 2.0}}},
+	}
+	count := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"count": 42.0}},
+	}
+
+	unregister := RegisterRoute(Route{
+		Name:      "histogram",
+		Formatter: "formatHistogramQuery",
+		Detect: func(results *nrdb.NRDBResultContainer) bool {
+			_, ok := results.Results[0]["histogram.duration"]
+			return ok
+		},
+		Format: func(results *nrdb.NRDBResultContainer, query backend.DataQuery, _ FormatOptions) *backend.DataResponse {
+			buckets := results.Results[0]["histogram.duration"].([]interface{})
+			counts := make([]float64, len(buckets))
+			for i, bucket := range buckets {
+				counts[i] = bucket.(float64)
+			}
+			return &backend.DataResponse{Frames: data.Frames{data.NewFrame(query.RefID, data.NewField("count", nil, counts))}}
+		},
+	})
+
+	assert.Equal(t, "histogram", Routes()[0].Name)
+	assert.Equal(t, "histogram", detectRoute(histogram))
+	assert.Equal(t, DetectorSimpleCount, detectRoute(count), "other shapes keep their built-in route")
+
+	resp := FormatQueryResults(histogram, backend.DataQuery{RefID: "A"})
+	require.Len(t, resp.Frames, 1)
+	require.Len(t, resp.Frames[0].Fields, 1)
+	assert.Equal(t, "count", resp.Frames[0].Fields[0].Name)
+	assert.Equal(t, 3, resp.Frames[0].Fields[0].Len())
+
+	trace := ExplainRouting(histogram)
+	assert.Equal(t, "histogram", trace.Detector)
+	assert.Equal(t, "formatHistogramQuery", trace.Formatter)
+
+	unregister()
+	assert.Equal(t, DetectorStandard, detectRoute(histogram))
+	assert.Len(t, Routes(), len(builtinRoutes()))
+}
+
+func TestRegisterRoute_OverridesBuiltin(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"count": 42.0}},
+	}
+
+	called := false
+	unregister := RegisterRoute(Route{
+		Name:      DetectorSimpleCount,
+		Formatter: "customCount",
+		Detect:    isSimpleCountQuery,
+		Format: func(*nrdb.NRDBResultContainer, backend.DataQuery, FormatOptions) *backend.DataResponse {
+			called = true
+			return &backend.DataResponse{}
+		},
+		Complete: true,
+	})
+	defer unregister()
+
+	FormatQueryResults(results, backend.DataQuery{RefID: "A"})
+	assert.True(t, called)
+}
@@ -0,0 +1,178 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/framebuilder"
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// TableViewFrameName is the name of the table frame added by AddTableView.
+const TableViewFrameName = "table"
+
+// tableRow is a row of the table view: a time and series labels, with the
+// values of the fields reported for them.
+type tableRow struct {
+	time   time.Time
+	labels data.Labels
+	values map[string]interface{}
+}
+
+// AddTableView appends a table of the time series frames of resp, so Explore
+// can switch between the graph and table views without rerunning the query.
+// The table has a row per time and series, with a column per label and per
+// value field; the time series frames are marked to prefer the graph view.
+// Responses that already hold a table frame, such as simple counts, and
+// responses without time series are left unchanged.
+func AddTableView(resp *backend.DataResponse) {
+	if resp == nil || resp.Error != nil {
+		return
+	}
+	var series []*data.Frame
+	for _, frame := range resp.Frames {
+		if frame.Meta != nil && frame.Meta.PreferredVisualization == data.VisTypeTable {
+			return
+		}
+		if frame.TimeSeriesSchema().Type != data.TimeSeriesTypeNot {
+			series = append(series, frame)
+		}
+	}
+	if len(series) == 0 {
+		return
+	}
+
+	table := tableOf(series)
+	table.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	for _, frame := range series {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.PreferredVisualization = data.VisTypeGraph
+	}
+	resp.Frames = append(resp.Frames, table)
+}
+
+// tableOf joins the rows of time series frames into one table, ordered by time
+// and then by labels.
+func tableOf(frames []*data.Frame) *data.Frame {
+	rows := make(map[string]*tableRow)
+	labelNames := make(map[string]bool)
+	var valueNames []string
+	numeric := make(map[string]bool)
+
+	add := func(t time.Time, labels data.Labels, name string, field *data.Field, i int) {
+		key := fmt.Sprintf("%d\x00%s", t.UnixNano(), labels.String())
+		row, ok := rows[key]
+		if !ok {
+			row = &tableRow{time: t, labels: labels, values: make(map[string]interface{})}
+			rows[key] = row
+			for label := range labels {
+				labelNames[label] = true
+			}
+		}
+		if _, seen := numeric[name]; !seen {
+			valueNames = append(valueNames, name)
+			numeric[name] = field.Type().Numeric()
+		}
+		row.values[name] = nil
+		if numeric[name] {
+			if v, err := field.NullableFloatAt(i); err == nil && v != nil {
+				row.values[name] = *v
+			}
+		} else if v, ok := field.ConcreteAt(i); ok {
+			row.values[name] = v
+		}
+	}
+
+	for _, frame := range frames {
+		schema := frame.TimeSeriesSchema()
+		n, err := frame.RowLen()
+		if err != nil {
+			continue
+		}
+		timeField := frame.Fields[schema.TimeIndex]
+		for i := 0; i < n; i++ {
+			t, ok := timeField.ConcreteAt(i)
+			if !ok {
+				continue
+			}
+			// Long frames keep the series labels in string columns
+			labels := data.Labels{}
+			for _, idx := range schema.FactorIndices {
+				if v, ok := frame.Fields[idx].ConcreteAt(i); ok {
+					labels[frame.Fields[idx].Name] = fmt.Sprintf("%v", v)
+				}
+			}
+			for _, idx := range schema.ValueIndices {
+				field := frame.Fields[idx]
+				rowLabels := labels
+				if len(field.Labels) > 0 {
+					rowLabels = field.Labels.Copy()
+					for name, value := range labels {
+						rowLabels[name] = value
+					}
+				}
+				add(t.(time.Time), rowLabels, field.Name, field, i)
+			}
+		}
+	}
+
+	ordered := make([]*tableRow, 0, len(rows))
+	for _, row := range rows {
+		ordered = append(ordered, row)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].time.Equal(ordered[j].time) {
+			return ordered[i].time.Before(ordered[j].time)
+		}
+		return ordered[i].labels.String() < ordered[j].labels.String()
+	})
+
+	times := make([]time.Time, len(ordered))
+	for i, row := range ordered {
+		times[i] = row.time
+	}
+	table := data.NewFrame(TableViewFrameName, data.NewField(utils.TimeFieldName, nil, times))
+
+	names := make([]string, 0, len(labelNames))
+	for name := range labelNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := make([]*string, len(ordered))
+		for i, row := range ordered {
+			if value, ok := row.labels[name]; ok {
+				values[i] = &value
+			}
+		}
+		table.Fields = append(table.Fields, data.NewField(name, nil, values))
+	}
+
+	for _, name := range valueNames {
+		if numeric[name] {
+			values := framebuilder.NewNullable[float64](len(ordered))
+			for i, row := range ordered {
+				if v, ok := row.values[name].(float64); ok {
+					values.Set(i, v)
+				}
+			}
+			table.Fields = append(table.Fields, values.Field(name))
+			continue
+		}
+		values := make([]*string, len(ordered))
+		for i, row := range ordered {
+			if v := row.values[name]; v != nil {
+				s := fmt.Sprintf("%v", v)
+				values[i] = &s
+			}
+		}
+		table.Fields = append(table.Fields, data.NewField(name, nil, values))
+	}
+	return table
+}
@@ -0,0 +1,93 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddTableView_MultiFrame(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+	t1 := t0.Add(time.Minute)
+	web := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{t0, t1}),
+		data.NewField("count", data.Labels{"appName": "web"}, []float64{1, 2}),
+	)
+	api := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{t0, t1}),
+		data.NewField("count", data.Labels{"appName": "api"}, []*float64{nil, ptrFloat(4)}),
+	)
+	resp := &backend.DataResponse{Frames: data.Frames{web, api}}
+
+	AddTableView(resp)
+	require.Len(t, resp.Frames, 3)
+	assert.EqualValues(t, data.VisTypeGraph, web.Meta.PreferredVisualization)
+	assert.EqualValues(t, data.VisTypeGraph, api.Meta.PreferredVisualization)
+
+	table := resp.Frames[2]
+	assert.Equal(t, TableViewFrameName, table.Name)
+	assert.EqualValues(t, data.VisTypeTable, table.Meta.PreferredVisualization)
+	require.Len(t, table.Fields, 3)
+	assert.Equal(t, []string{"time", "appName", "count"}, []string{table.Fields[0].Name, table.Fields[1].Name, table.Fields[2].Name})
+
+	rows, err := table.RowLen()
+	require.NoError(t, err)
+	require.Equal(t, 4, rows)
+	want := []struct {
+		time    time.Time
+		appName string
+		count   *float64
+	}{
+		{t0, "api", nil},
+		{t0, "web", ptrFloat(1)},
+		{t1, "api", ptrFloat(4)},
+		{t1, "web", ptrFloat(2)},
+	}
+	for i, row := range want {
+		assert.Equal(t, row.time, table.Fields[0].At(i))
+		assert.Equal(t, row.appName, *table.Fields[1].At(i).(*string))
+		assert.Equal(t, row.count, table.Fields[2].At(i))
+	}
+}
+
+func TestAddTableView_WideFrame(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+	frame := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{t0}),
+		data.NewField("average.duration", nil, []float64{0.25}),
+		data.NewField("max.duration", nil, []float64{1.5}),
+	)
+	resp := &backend.DataResponse{Frames: data.Frames{frame}}
+
+	AddTableView(resp)
+	require.Len(t, resp.Frames, 2)
+	table := resp.Frames[1]
+	require.Len(t, table.Fields, 3, "series without labels get no label columns")
+	assert.Equal(t, 0.25, *table.Fields[1].At(0).(*float64))
+	assert.Equal(t, 1.5, *table.Fields[2].At(0).(*float64))
+}
+
+func TestAddTableView_Unchanged(t *testing.T) {
+	t.Run("response with a table frame", func(t *testing.T) {
+		table := data.NewFrame("count", data.NewField("count", nil, []float64{3}))
+		table.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		graph := data.NewFrame("", data.NewField("time", nil, []time.Time{time.Now()}), data.NewField("count", nil, []float64{3}))
+		resp := &backend.DataResponse{Frames: data.Frames{table, graph}}
+		AddTableView(resp)
+		assert.Len(t, resp.Frames, 2)
+		assert.Nil(t, graph.Meta)
+	})
+	t.Run("response without time series", func(t *testing.T) {
+		resp := &backend.DataResponse{Frames: data.Frames{data.NewFrame("", data.NewField("name", nil, []string{"a"}))}}
+		AddTableView(resp)
+		assert.Len(t, resp.Frames, 1)
+	})
+}
+
+func ptrFloat(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,212 @@
+package formatter
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// Frame names of trace results.
+const (
+	TraceFrameName     = "Trace"  // Spans of a trace, rendered by the Traces panel
+	TraceListFrameName = "Traces" // One row per trace, from DistributedTraceSummary
+)
+
+// Span and trace summary attributes read by the trace formatter.
+const (
+	traceIDAttribute  = "trace.id"
+	spanIDAttribute   = "id"
+	parentIDAttribute = "parent.id"
+	spanNameAttribute = "name"
+	spanKindAttribute = "span.kind"
+)
+
+// spanServiceAttributes hold the service name of a span, in order of preference.
+var spanServiceAttributes = []string{"service.name", "entity.name", "appName"}
+
+// spanServiceTagAttributes describe the service rather than the span and are
+// reported as service tags.
+var spanServiceTagAttributes = []string{"entity.guid", "host", "service.instance.id", "telemetry.sdk.language"}
+
+// Span status codes used by Grafana's trace view (OpenTelemetry semantics).
+const (
+	spanStatusUnset int64 = 0
+	spanStatusError int64 = 2
+)
+
+// traceTag is a key/value pair in the tags and serviceTags fields of a trace frame.
+type traceTag struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// IsSpanResult reports whether results are Span events with trace and span IDs.
+func IsSpanResult(results *nrdb.NRDBResultContainer) bool {
+	return IsEventResult(results) && everyRowHas(results.Results, traceIDAttribute, spanIDAttribute)
+}
+
+// IsTraceSummaryResult reports whether results are trace summaries, such as
+// DistributedTraceSummary events: events with a trace ID but no span ID.
+func IsTraceSummaryResult(results *nrdb.NRDBResultContainer) bool {
+	return IsEventResult(results) && everyRowHas(results.Results, traceIDAttribute) && !IsSpanResult(results)
+}
+
+// everyRowHas reports whether every row has all of the attributes.
+func everyRowHas(rows []nrdb.NRDBResult, attributes ...string) bool {
+	for _, row := range rows {
+		for _, attribute := range attributes {
+			if row[attribute] == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FormatTraceResults formats Span events as a Grafana trace frame, which the
+// Traces panel and Explore's trace view render. Trace summaries are formatted
+// as a table with one row per trace instead.
+func FormatTraceResults(results *nrdb.NRDBResultContainer) *backend.DataResponse {
+	if !IsSpanResult(results) {
+		return formatTraceList(results.Results)
+	}
+
+	rows := results.Results
+	n := len(rows)
+	traceIDs := make([]string, n)
+	spanIDs := make([]string, n)
+	parentSpanIDs := make([]string, n)
+	operationNames := make([]string, n)
+	serviceNames := make([]string, n)
+	serviceTags := make([]json.RawMessage, n)
+	startTimes := make([]float64, n)
+	durations := make([]float64, n)
+	tags := make([]json.RawMessage, n)
+	kinds := make([]string, n)
+	statusCodes := make([]int64, n)
+	for i, row := range rows {
+		traceIDs[i] = logText(row[traceIDAttribute])
+		spanIDs[i] = logText(row[spanIDAttribute])
+		parentSpanIDs[i] = logText(row[parentIDAttribute])
+		operationNames[i] = logText(row[spanNameAttribute])
+		serviceNames[i] = logText(row[firstAttribute([]nrdb.NRDBResult{row}, spanServiceAttributes)])
+		startTimes[i], _ = row[utils.TimestampFieldName].(float64)
+		durations[i] = spanDurationMs(row)
+		kinds[i] = strings.ToLower(logText(row[spanKindAttribute]))
+		statusCodes[i] = spanStatusCode(row)
+
+		var rowServiceTags, rowTags []traceTag
+		for _, key := range sortedRowKeys(row) {
+			switch key {
+			case traceIDAttribute, spanIDAttribute, parentIDAttribute, spanNameAttribute, spanKindAttribute,
+				utils.TimestampFieldName, "duration", "duration.ms":
+				continue
+			}
+			if containsString(spanServiceAttributes, key) {
+				continue
+			}
+			if containsString(spanServiceTagAttributes, key) {
+				rowServiceTags = append(rowServiceTags, traceTag{Key: key, Value: row[key]})
+			} else {
+				rowTags = append(rowTags, traceTag{Key: key, Value: row[key]})
+			}
+		}
+		serviceTags[i] = marshalTags(rowServiceTags)
+		tags[i] = marshalTags(rowTags)
+	}
+
+	frame := data.NewFrame(TraceFrameName,
+		data.NewField("traceID", nil, traceIDs),
+		data.NewField("spanID", nil, spanIDs),
+		data.NewField("parentSpanID", nil, parentSpanIDs),
+		data.NewField("operationName", nil, operationNames),
+		data.NewField("serviceName", nil, serviceNames),
+		data.NewField("serviceTags", nil, serviceTags),
+		data.NewField("startTime", nil, startTimes),
+		data.NewField("duration", nil, durations),
+		data.NewField("tags", nil, tags),
+		data.NewField("kind", nil, kinds),
+		data.NewField("statusCode", nil, statusCodes),
+	)
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTrace}
+	return &backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// formatTraceList formats trace summaries as a table with the trace ID first,
+// so panels can link each row to the trace view.
+func formatTraceList(rows []nrdb.NRDBResult) *backend.DataResponse {
+	frame := data.NewFrame(TraceListFrameName)
+	frame.Fields = append(frame.Fields, convertField("traceID", rows, traceIDAttribute, "string"))
+	frame.Fields = append(frame.Fields, convertField("startTime", rows, utils.TimestampFieldName, "timestamp"))
+
+	names := extractFieldNames(&nrdb.NRDBResultContainer{Results: rows})
+	for _, name := range names {
+		if name == traceIDAttribute {
+			continue
+		}
+		frame.Fields = append(frame.Fields, convertField(name, rows, name, eventFieldType(rows, name)))
+	}
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	return &backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// spanDurationMs returns the span duration in milliseconds from duration.ms, or
+// from duration, which New Relic reports in seconds.
+func spanDurationMs(row nrdb.NRDBResult) float64 {
+	if ms, ok := row["duration.ms"].(float64); ok {
+		return ms
+	}
+	if seconds, ok := row["duration"].(float64); ok {
+		return seconds * 1000
+	}
+	return 0
+}
+
+// spanStatusCode returns the OpenTelemetry status code of a span: error when the
+// span has error set or an ERROR otel.status_code, unset otherwise.
+func spanStatusCode(row nrdb.NRDBResult) int64 {
+	if isError, ok := row["error"].(bool); ok && isError {
+		return spanStatusError
+	}
+	if status, ok := row["otel.status_code"].(string); ok && strings.EqualFold(status, "ERROR") {
+		return spanStatusError
+	}
+	return spanStatusUnset
+}
+
+// sortedRowKeys returns the keys of row with non-nil values in ascending order.
+func sortedRowKeys(row nrdb.NRDBResult) []string {
+	keys := make([]string, 0, len(row))
+	for key, value := range row {
+		if value != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsString reports whether values contains s.
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalTags renders tags as the JSON array a trace frame expects.
+func marshalTags(tags []traceTag) json.RawMessage {
+	if len(tags) == 0 {
+		return json.RawMessage("[]")
+	}
+	b, _ := json.Marshal(tags)
+	return b
+}
@@ -0,0 +1,78 @@
+package formatter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatTraceResults_Spans(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{
+			"timestamp": 1700000000000.0, "trace.id": "t1", "id": "s1", "name": "GET /checkout",
+			"service.name": "checkout", "host": "web-1", "duration.ms": 120.0, "span.kind": "SERVER", "http.method": "GET",
+		},
+		{
+			"timestamp": 1700000000010.0, "trace.id": "t1", "id": "s2", "parent.id": "s1", "name": "SELECT orders",
+			"entity.name": "checkout", "duration": 0.05, "error": true, "db.system": "postgres",
+		},
+	}}
+
+	assert.True(t, IsSpanResult(results))
+	assert.False(t, IsTraceSummaryResult(results))
+
+	resp := FormatTraceResults(results)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	assert.Equal(t, TraceFrameName, frame.Name)
+	require.NotNil(t, frame.Meta)
+	assert.Equal(t, data.VisTypeTrace, string(frame.Meta.PreferredVisualization))
+
+	value := func(name string, i int) interface{} {
+		field, _ := frame.FieldByName(name)
+		require.NotNil(t, field, name)
+		return field.At(i)
+	}
+	assert.Equal(t, "t1", value("traceID", 1))
+	assert.Equal(t, "s2", value("spanID", 1))
+	assert.Equal(t, "", value("parentSpanID", 0))
+	assert.Equal(t, "s1", value("parentSpanID", 1))
+	assert.Equal(t, "GET /checkout", value("operationName", 0))
+	assert.Equal(t, "checkout", value("serviceName", 1))
+	assert.Equal(t, 1700000000010.0, value("startTime", 1))
+	assert.Equal(t, 120.0, value("duration", 0))
+	assert.Equal(t, 50.0, value("duration", 1))
+	assert.Equal(t, "server", value("kind", 0))
+	assert.Equal(t, int64(0), value("statusCode", 0))
+	assert.Equal(t, int64(2), value("statusCode", 1))
+
+	assert.JSONEq(t, `[{"key":"host","value":"web-1"}]`, string(value("serviceTags", 0).(json.RawMessage)))
+	assert.JSONEq(t, `[]`, string(value("serviceTags", 1).(json.RawMessage)))
+	assert.JSONEq(t, `[{"key":"http.method","value":"GET"}]`, string(value("tags", 0).(json.RawMessage)))
+	assert.JSONEq(t, `[{"key":"db.system","value":"postgres"},{"key":"error","value":true}]`, string(value("tags", 1).(json.RawMessage)))
+}
+
+func TestFormatTraceResults_Summaries(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "trace.id": "t1", "root.entity.name": "checkout", "duration.ms": 120.0, "span.count": 4.0},
+		{"timestamp": 1700000001000.0, "trace.id": "t2", "root.entity.name": "cart", "duration.ms": 80.0, "span.count": 2.0},
+	}}
+
+	assert.True(t, IsTraceSummaryResult(results))
+	assert.False(t, IsSpanResult(results))
+
+	frame := FormatTraceResults(results).Frames[0]
+	assert.Equal(t, TraceListFrameName, frame.Name)
+	var names []string
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"traceID", "startTime", "duration.ms", "root.entity.name", "span.count"}, names)
+	assert.Equal(t, "t2", frame.Fields[0].At(1))
+	assert.Equal(t, data.VisTypeTable, string(frame.Meta.PreferredVisualization))
+}
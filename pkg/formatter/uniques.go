@@ -0,0 +1,202 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// uniquesPrefix is the prefix of the result fields holding uniques() values.
+const uniquesPrefix = "uniques."
+
+// uniquesSeparator separates the values of a uniques() field when
+// FormatOptions.JoinUniques is set.
+const uniquesSeparator = ", "
+
+// keysetTypeColumns maps the typed key lists of a keyset() result to the
+// attribute type reported for their keys.
+var keysetTypeColumns = map[string]string{
+	"stringKeys":  "string",
+	"numericKeys": "numeric",
+	"booleanKeys": "boolean",
+}
+
+// isUniquesResult reports whether the results come from a query selecting
+// uniques() without TIMESERIES: every row holds at least one uniques() array.
+func isUniquesResult(results *nrdb.NRDBResultContainer) bool {
+	if len(results.Results) == 0 || hasTimeseriesData(results) {
+		return false
+	}
+	for _, row := range results.Results {
+		if len(uniquesFieldNames(row)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isKeysetResult reports whether the results are the key lists returned by keyset().
+func isKeysetResult(results *nrdb.NRDBResultContainer) bool {
+	if len(results.Results) != 1 {
+		return false
+	}
+	_, ok := results.Results[0]["allKeys"].([]interface{})
+	return ok
+}
+
+// uniquesFieldNames returns the sorted names of the row's uniques() arrays.
+func uniquesFieldNames(row nrdb.NRDBResult) []string {
+	var names []string
+	for name, value := range row {
+		if _, ok := value.([]interface{}); ok && strings.HasPrefix(name, uniquesPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatUniquesQuery formats uniques() results as a table with one row per unique
+// value, repeating the row's other fields (such as the facet) on each of them.
+// When a row holds several uniques() arrays, shorter ones are padded with empty values.
+// With opts.JoinUniques, each array is instead joined into a single string cell.
+func formatUniquesQuery(results *nrdb.NRDBResultContainer, opts FormatOptions) *backend.DataResponse {
+	var rows []nrdb.NRDBResult
+	for _, row := range results.Results {
+		rows = append(rows, expandUniques(row, opts.JoinUniques)...)
+	}
+
+	frame := data.NewFrame(utils.StandardResponseFrameName)
+	for _, name := range uniquesTableFieldNames(results) {
+		if strings.HasPrefix(name, uniquesPrefix) {
+			frame.Fields = append(frame.Fields, convertField(name, rows, name, uniqueValuesType(rows, name)))
+			continue
+		}
+		frame.Fields = append(frame.Fields, convertField(name, rows, name, detectFieldType(rows, name, opts.FieldTypes)))
+	}
+	return &backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// expandUniques returns the rows that replace row in a uniques() table.
+func expandUniques(row nrdb.NRDBResult, join bool) []nrdb.NRDBResult {
+	names := uniquesFieldNames(row)
+	if join {
+		joined := copyRow(row)
+		for _, name := range names {
+			values := row[name].([]interface{})
+			parts := make([]string, len(values))
+			for i, value := range values {
+				parts[i] = fmt.Sprintf("%v", value)
+			}
+			joined[name] = strings.Join(parts, uniquesSeparator)
+		}
+		return []nrdb.NRDBResult{joined}
+	}
+
+	count := 0
+	for _, name := range names {
+		count = max(count, len(row[name].([]interface{})))
+	}
+	expanded := make([]nrdb.NRDBResult, count)
+	for i := range expanded {
+		expanded[i] = copyRow(row)
+		for _, name := range names {
+			values := row[name].([]interface{})
+			expanded[i][name] = nil
+			if i < len(values) {
+				expanded[i][name] = values[i]
+			}
+		}
+	}
+	return expanded
+}
+
+// copyRow returns a shallow copy of row.
+func copyRow(row nrdb.NRDBResult) nrdb.NRDBResult {
+	copied := make(nrdb.NRDBResult, len(row))
+	for key, value := range row {
+		copied[key] = value
+	}
+	return copied
+}
+
+// uniquesTableFieldNames returns the field names of a uniques() table: the facet
+// first, then the other fields in name order.
+func uniquesTableFieldNames(results *nrdb.NRDBResultContainer) []string {
+	names := extractFieldNames(results)
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == utils.FacetFieldName) != (names[j] == utils.FacetFieldName) {
+			return names[i] == utils.FacetFieldName
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// uniqueValuesType returns the field type for the values of a uniques() field:
+// number or boolean when all values are, and string otherwise.
+func uniqueValuesType(rows []nrdb.NRDBResult, fieldName string) string {
+	fieldType := ""
+	for _, row := range rows {
+		var valueType string
+		switch row[fieldName].(type) {
+		case nil:
+			continue
+		case float64, int, int64:
+			valueType = "number"
+		case bool:
+			valueType = "boolean"
+		default:
+			return "string"
+		}
+		if fieldType != "" && fieldType != valueType {
+			return "string"
+		}
+		fieldType = valueType
+	}
+	if fieldType == "" {
+		return "string"
+	}
+	return fieldType
+}
+
+// formatKeysetQuery formats the key lists returned by keyset() as a table with a
+// row per key and its attribute type, sorted by key.
+func formatKeysetQuery(results *nrdb.NRDBResultContainer) *backend.DataResponse {
+	row := results.Results[0]
+	types := make(map[string]string)
+	for column, attrType := range keysetTypeColumns {
+		values, _ := row[column].([]interface{})
+		for _, value := range values {
+			types[fmt.Sprintf("%v", value)] = attrType
+		}
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, value := range row["allKeys"].([]interface{}) {
+		key := fmt.Sprintf("%v", value)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	keyTypes := make([]string, len(keys))
+	for i, key := range keys {
+		keyTypes[i] = types[key]
+	}
+
+	frame := data.NewFrame(utils.StandardResponseFrameName,
+		data.NewField("key", nil, keys),
+		data.NewField("type", nil, keyTypes),
+	)
+	return &backend.DataResponse{Frames: data.Frames{frame}}
+}
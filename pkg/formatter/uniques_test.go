@@ -0,0 +1,108 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fieldValues returns the values of a field, dereferencing nullable values.
+func fieldValues(field *data.Field) []interface{} {
+	values := make([]interface{}, field.Len())
+	for i := range values {
+		values[i], _ = field.ConcreteAt(i)
+	}
+	return values
+}
+
+func TestFormatQueryResults_Uniques(t *testing.T) {
+	t.Run("one row per unique value", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"uniques.appName": []interface{}{"checkout", "cart", "search"}},
+		}}
+
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 1)
+		frame := resp.Frames[0]
+		require.Len(t, frame.Fields, 1)
+		assert.Equal(t, "uniques.appName", frame.Fields[0].Name)
+		assert.Equal(t, []interface{}{"checkout", "cart", "search"}, fieldValues(frame.Fields[0]))
+	})
+
+	t.Run("faceted uniques repeat the facet", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"facet": "prod", "count": 10.0, "uniques.port": []interface{}{80.0, 443.0}},
+				{"facet": "dev", "count": 2.0, "uniques.port": []interface{}{8080.0}},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"env"}},
+		}
+
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 1)
+		frame := resp.Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, "facet", frame.Fields[0].Name)
+		assert.Equal(t, []interface{}{"prod", "prod", "dev"}, fieldValues(frame.Fields[0]))
+		assert.Equal(t, "count", frame.Fields[1].Name)
+		assert.Equal(t, []interface{}{10.0, 10.0, 2.0}, fieldValues(frame.Fields[1]))
+		assert.Equal(t, "uniques.port", frame.Fields[2].Name)
+		assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[2].Type())
+		assert.Equal(t, []interface{}{80.0, 443.0, 8080.0}, fieldValues(frame.Fields[2]))
+	})
+
+	t.Run("shorter arrays are padded with empty values", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"uniques.host": []interface{}{"a", "b"}, "uniques.region": []interface{}{"us"}},
+		}}
+
+		resp := FormatQueryResults(results, backend.DataQuery{})
+		require.Len(t, resp.Frames, 1)
+		require.Len(t, resp.Frames[0].Fields, 2)
+		assert.Equal(t, []interface{}{"a", "b"}, fieldValues(resp.Frames[0].Fields[0]))
+		assert.Equal(t, []interface{}{"us", ""}, fieldValues(resp.Frames[0].Fields[1]))
+	})
+
+	t.Run("joined values", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"uniques.appName": []interface{}{"checkout", "cart"}},
+		}}
+
+		resp := FormatQueryResultsWithOptions(results, backend.DataQuery{}, FormatOptions{JoinUniques: true})
+		require.Len(t, resp.Frames, 1)
+		assert.Equal(t, []interface{}{"checkout, cart"}, fieldValues(resp.Frames[0].Fields[0]))
+	})
+
+	t.Run("timeseries uniques use the standard formatter", func(t *testing.T) {
+		results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+			{"uniques.appName": []interface{}{"checkout"}, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+		}}
+		assert.Equal(t, DetectorStandard, detectRoute(results))
+	})
+}
+
+func TestFormatQueryResults_Keyset(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{
+		"allKeys":     []interface{}{"name", "duration", "error", "custom"},
+		"stringKeys":  []interface{}{"name"},
+		"numericKeys": []interface{}{"duration"},
+		"booleanKeys": []interface{}{"error"},
+	}}}
+
+	assert.Equal(t, DetectorKeyset, ExplainRouting(results).Detector)
+	assert.Equal(t, "formatKeysetQuery", ExplainRouting(results).Formatter)
+
+	resp := FormatQueryResults(results, backend.DataQuery{})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	require.Len(t, frame.Fields, 2)
+	assert.Equal(t, []interface{}{"custom", "duration", "error", "name"}, fieldValues(frame.Fields[0]))
+	assert.Equal(t, []interface{}{"", "numeric", "boolean", "string"}, fieldValues(frame.Fields[1]))
+}
@@ -0,0 +1,125 @@
+package formatter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// percentileSuffixPattern matches the percentile that ends percentile result
+// field names, e.g. the .95 of percentile.duration.95 or the .99.9 of
+// percentile.duration.99.9.
+var percentileSuffixPattern = regexp.MustCompile(`(\.\d+)+$`)
+
+// unitPreservingFunctions are the NRQL functions whose results have the unit of
+// the attribute they aggregate. Results of other functions, such as count() or
+// uniqueCount(), get no unit from their attribute.
+var unitPreservingFunctions = map[string]bool{
+	"average": true, "sum": true, "min": true, "max": true, "latest": true,
+	"earliest": true, "median": true, "percentile": true, "stddev": true,
+}
+
+// unitlessFunctions are the NRQL functions whose results are counts, scores or
+// other values without the unit of their attribute.
+var unitlessFunctions = map[string]bool{
+	"count": true, "uniqueCount": true, "apdex": true, "funnel": true,
+	"histogram": true, "uniques": true, "filter": true, "variance": true,
+}
+
+// attributeUnits map attribute naming conventions to Grafana units, checked in
+// order against the attribute name. New Relic reports durations in seconds.
+var attributeUnits = []struct {
+	pattern *regexp.Regexp
+	unit    string
+}{
+	{regexp.MustCompile(`([._]ms|[a-z]Ms|[Mm]illis|[Mm]illiseconds)$`), "ms"},
+	{regexp.MustCompile(`(?i)(duration|totalTime)$`), "s"},
+	{regexp.MustCompile(`(?i)bytesPerSecond`), "Bps"},
+	{regexp.MustCompile(`(?i)bytes`), "bytes"},
+	{regexp.MustCompile(`(?i)percent`), "percent"},
+}
+
+// ApplyUnits sets the unit of the numeric fields of resp that have none, inferred
+// from the NRQL function and attribute of the field name: durations in seconds,
+// milliseconds, bytes, bytes per second and percentages. overrides maps field
+// names, e.g. average.duration, or attribute names, e.g. duration, to the unit to
+// use instead; an override also replaces a unit set by the formatter.
+func ApplyUnits(resp *backend.DataResponse, overrides map[string]string) {
+	if resp == nil {
+		return
+	}
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() {
+				continue
+			}
+			unit, override := unitOverride(field.Name, overrides)
+			if !override {
+				if field.Config != nil && field.Config.Unit != "" {
+					continue
+				}
+				unit = inferUnit(field.Name)
+			}
+			if unit == "" {
+				continue
+			}
+			if field.Config == nil {
+				field.Config = &data.FieldConfig{}
+			}
+			field.Config.Unit = unit
+		}
+	}
+}
+
+// unitOverride returns the override for a field name or its attribute.
+func unitOverride(fieldName string, overrides map[string]string) (string, bool) {
+	if unit, ok := overrides[fieldName]; ok {
+		return unit, true
+	}
+	if _, attribute := splitFieldName(fieldName); attribute != fieldName {
+		if unit, ok := overrides[attribute]; ok {
+			return unit, true
+		}
+	}
+	return "", false
+}
+
+// inferUnit returns the unit of a result field from its name, or "" if none can
+// be inferred.
+func inferUnit(fieldName string) string {
+	function, attribute := splitFieldName(fieldName)
+	if function == "percentage" {
+		return "percent"
+	}
+	if unitlessFunctions[function] || (function != "" && !unitPreservingFunctions[function]) {
+		return ""
+	}
+	for _, rule := range attributeUnits {
+		if rule.pattern.MatchString(attribute) {
+			return rule.unit
+		}
+	}
+	return ""
+}
+
+// splitFieldName splits a result field name such as average.duration or
+// percentile.duration.95 into its NRQL function and attribute. Field names that
+// do not start with a function, such as event attributes, have no function.
+func splitFieldName(fieldName string) (string, string) {
+	function, attribute, found := strings.Cut(fieldName, ".")
+	if !found {
+		if fieldName == "percentage" || unitlessFunctions[fieldName] {
+			return fieldName, ""
+		}
+		return "", fieldName
+	}
+	if !unitPreservingFunctions[function] && !unitlessFunctions[function] && function != "percentage" && function != "rate" {
+		return "", fieldName
+	}
+	if function == "percentile" {
+		attribute = percentileSuffixPattern.ReplaceAllString(attribute, "")
+	}
+	return function, attribute
+}
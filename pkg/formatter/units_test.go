@@ -0,0 +1,69 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInferUnit(t *testing.T) {
+	tests := []struct {
+		fieldName string
+		want      string
+	}{
+		{"average.duration", "s"},
+		{"duration", "s"},
+		{"percentile.duration.95", "s"},
+		{"percentile.databaseDuration.99.9", "s"},
+		{"max.totalTime", "s"},
+		{"average.http.server.duration", "s"},
+		{"average.responseTimeMs", "ms"},
+		{"latest.gc.pause_ms", "ms"},
+		{"sum.bytesSent", "bytes"},
+		{"average.receiveBytesPerSecond", "Bps"},
+		{"average.cpuPercent", "percent"},
+		{"percentage", "percent"},
+		{"percentage.count", "percent"},
+		{"count", ""},
+		{"uniqueCount.duration", ""},
+		{"rate.count", ""},
+		{"sum.items", ""},
+		{"appName", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fieldName, func(t *testing.T) {
+			assert.Equal(t, tt.want, inferUnit(tt.fieldName))
+		})
+	}
+}
+
+func TestApplyUnits(t *testing.T) {
+	frame := data.NewFrame("A",
+		data.NewField("time", nil, []time.Time{time.Unix(0, 0)}),
+		data.NewField("average.duration", nil, []float64{1}),
+		data.NewField("sum.bytesSent", nil, []float64{2}),
+		data.NewField("rate.count", nil, []float64{3}),
+		data.NewField("max.queueDepth", nil, []float64{4}),
+		data.NewField("appName", nil, []string{"checkout"}),
+	)
+	frame.Fields[3].Config = &data.FieldConfig{Unit: "suffix: /min"}
+	resp := &backend.DataResponse{Frames: data.Frames{frame}}
+
+	ApplyUnits(resp, map[string]string{"sum.bytesSent": "decbytes", "queueDepth": "short"})
+
+	units := map[string]string{}
+	for _, field := range frame.Fields {
+		if field.Config != nil {
+			units[field.Name] = field.Config.Unit
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"average.duration": "s",
+		"sum.bytesSent":    "decbytes",
+		"rate.count":       "suffix: /min",
+		"max.queueDepth":   "short",
+	}, units)
+}
@@ -0,0 +1,202 @@
+package formatter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// maxDiscrepancies bounds how many differences DiffResponses reports for one response.
+const maxDiscrepancies = 20
+
+// timeTolerance is the difference allowed between time values. Some formatters
+// stamp synthetic points with time.Now, so two runs never produce identical times.
+const timeTolerance = time.Second
+
+// ResultFormatter converts executor results (*nrdb.NRDBResultContainer or
+// *nrdb.NRDBResultContainerMultiResultCustomized) into a DataResponse.
+type ResultFormatter func(results interface{}, query backend.DataQuery, opts FormatOptions) *backend.DataResponse
+
+// CandidateFormatter is the formatter implementation being migrated to, by
+// default the consolidated formatter. When a datasource enables verifyFormatter
+// it runs alongside the served formatter and its output is compared, but never
+// served. Verification is off unless enabled; setting CandidateFormatter to nil
+// turns it off for every datasource once no migration is in progress.
+var CandidateFormatter ResultFormatter = formatConsolidated
+
+// formatConsolidated is the consolidated formatter: results of both executors
+// are routed through the formatter registry, so faceted timeseries results of
+// the multi-result executor no longer have a formatter of their own.
+func formatConsolidated(results interface{}, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+	switch r := results.(type) {
+	case *nrdb.NRDBResultContainer:
+		return formatQueryResults(r, query, opts)
+	case *nrdb.NRDBResultContainerMultiResultCustomized:
+		return formatQueryResults(toStandardContainerMulti(r), query, opts)
+	default:
+		return &backend.DataResponse{Error: fmt.Errorf("unexpected result type %T", results)}
+	}
+}
+
+// VerifyDualWrite runs CandidateFormatter on the same results that produced legacy
+// and logs every difference between the two responses together with a hash of the
+// payload, so discrepancies can be matched across log lines without logging the data.
+// The legacy response is never modified. It returns the discrepancies found.
+func VerifyDualWrite(legacy *backend.DataResponse, results interface{}, query backend.DataQuery, opts FormatOptions) []string {
+	if CandidateFormatter == nil {
+		log.DefaultLogger.Debug("Formatter verification enabled but no candidate formatter is registered", "refId", query.RefID)
+		return nil
+	}
+
+	candidate, err := runCandidate(results, query, opts)
+	hash := PayloadHash(results)
+	if err != nil {
+		log.DefaultLogger.Warn("Candidate formatter failed", "refId", query.RefID, "payloadHash", hash, "error", err)
+		return []string{err.Error()}
+	}
+
+	discrepancies := DiffResponses(legacy, candidate)
+	for _, d := range discrepancies {
+		log.DefaultLogger.Warn("Formatter output mismatch", "refId", query.RefID, "payloadHash", hash, "discrepancy", d)
+	}
+	if len(discrepancies) == 0 {
+		log.DefaultLogger.Debug("Formatter outputs match", "refId", query.RefID, "payloadHash", hash)
+	}
+	return discrepancies
+}
+
+// runCandidate calls CandidateFormatter, turning a panic into an error so that an
+// unfinished implementation cannot break the query being served.
+func runCandidate(results interface{}, query backend.DataQuery, opts FormatOptions) (resp *backend.DataResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("candidate formatter panicked: %v", r)
+		}
+	}()
+	return CandidateFormatter(results, query, opts), nil
+}
+
+// PayloadHash returns a short, stable hash of the executor results.
+func PayloadHash(results interface{}) string {
+	payload, err := json.Marshal(results)
+	if err != nil {
+		return "unhashable"
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:8])
+}
+
+// DiffResponses compares two responses frame by frame and field by field and
+// describes each difference. At most maxDiscrepancies differences are returned.
+func DiffResponses(legacy, candidate *backend.DataResponse) []string {
+	var diffs []string
+	add := func(format string, args ...interface{}) bool {
+		if len(diffs) >= maxDiscrepancies {
+			return false
+		}
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+		return true
+	}
+
+	if legacy == nil || candidate == nil {
+		if legacy != candidate {
+			add("response: legacy is nil %t, candidate is nil %t", legacy == nil, candidate == nil)
+		}
+		return diffs
+	}
+	if errorText(legacy.Error) != errorText(candidate.Error) {
+		add("error: legacy %q, candidate %q", errorText(legacy.Error), errorText(candidate.Error))
+	}
+	if len(legacy.Frames) != len(candidate.Frames) {
+		add("frames: legacy has %d, candidate has %d", len(legacy.Frames), len(candidate.Frames))
+		return diffs
+	}
+
+	for i := range legacy.Frames {
+		if !diffFrame(i, legacy.Frames[i], candidate.Frames[i], add) {
+			break
+		}
+	}
+	return diffs
+}
+
+// diffFrame reports the differences between two frames at index i. It returns
+// false once the discrepancy limit is reached.
+func diffFrame(i int, legacy, candidate *data.Frame, add func(string, ...interface{}) bool) bool {
+	if legacy.Name != candidate.Name && !add("frame %d: name legacy %q, candidate %q", i, legacy.Name, candidate.Name) {
+		return false
+	}
+	if len(legacy.Fields) != len(candidate.Fields) {
+		return add("frame %d: legacy has %d fields, candidate has %d", i, len(legacy.Fields), len(candidate.Fields))
+	}
+
+	for j, lf := range legacy.Fields {
+		cf := candidate.Fields[j]
+		prefix := fmt.Sprintf("frame %d field %d (%s)", i, j, lf.Name)
+		if lf.Name != cf.Name && !add("%s: name legacy %q, candidate %q", prefix, lf.Name, cf.Name) {
+			return false
+		}
+		if lf.Type() != cf.Type() {
+			if !add("%s: type legacy %s, candidate %s", prefix, lf.Type(), cf.Type()) {
+				return false
+			}
+			continue
+		}
+		if lf.Labels.String() != cf.Labels.String() && !add("%s: labels legacy %s, candidate %s", prefix, lf.Labels, cf.Labels) {
+			return false
+		}
+		if lf.Len() != cf.Len() {
+			if !add("%s: legacy has %d values, candidate has %d", prefix, lf.Len(), cf.Len()) {
+				return false
+			}
+			continue
+		}
+		for row := 0; row < lf.Len(); row++ {
+			if !valuesEqual(lf, cf, row) {
+				if !add("%s row %d: legacy %v, candidate %v", prefix, row, valueText(lf, row), valueText(cf, row)) {
+					return false
+				}
+				break // One mismatch per field keeps the log readable
+			}
+		}
+	}
+	return true
+}
+
+// valuesEqual compares the values of two fields of the same type at row.
+func valuesEqual(legacy, candidate *data.Field, row int) bool {
+	lv, lok := legacy.ConcreteAt(row)
+	cv, cok := candidate.ConcreteAt(row)
+	if lok != cok {
+		return false
+	}
+	if lt, ok := lv.(time.Time); ok {
+		diff := lt.Sub(cv.(time.Time))
+		return diff <= timeTolerance && diff >= -timeTolerance
+	}
+	return reflect.DeepEqual(lv, cv)
+}
+
+// errorText returns the error message, or an empty string for a nil error.
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// valueText formats the value at row, dereferencing nullable values.
+func valueText(field *data.Field, row int) string {
+	if value, ok := field.ConcreteAt(row); ok {
+		return fmt.Sprintf("%v", value)
+	}
+	return "null"
+}
@@ -0,0 +1,145 @@
+package formatter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffResponses(t *testing.T) {
+	frame := func(name string, values ...float64) *data.Frame {
+		return data.NewFrame(name, data.NewField("value", data.Labels{"app": "a"}, values))
+	}
+
+	tests := []struct {
+		name      string
+		legacy    *backend.DataResponse
+		candidate *backend.DataResponse
+		want      []string
+	}{
+		{
+			name:      "identical",
+			legacy:    &backend.DataResponse{Frames: data.Frames{frame("A", 1, 2)}},
+			candidate: &backend.DataResponse{Frames: data.Frames{frame("A", 1, 2)}},
+		},
+		{
+			name:      "frame count",
+			legacy:    &backend.DataResponse{Frames: data.Frames{frame("A", 1)}},
+			candidate: &backend.DataResponse{},
+			want:      []string{"frames: legacy has 1, candidate has 0"},
+		},
+		{
+			name:      "name and value",
+			legacy:    &backend.DataResponse{Frames: data.Frames{frame("A", 1, 2)}},
+			candidate: &backend.DataResponse{Frames: data.Frames{frame("B", 1, 3)}},
+			want: []string{
+				`frame 0: name legacy "A", candidate "B"`,
+				"frame 0 field 0 (value) row 1: legacy 2, candidate 3",
+			},
+		},
+		{
+			name:   "type",
+			legacy: &backend.DataResponse{Frames: data.Frames{frame("A", 1)}},
+			candidate: &backend.DataResponse{Frames: data.Frames{
+				data.NewFrame("A", data.NewField("value", data.Labels{"app": "a"}, []string{"1"})),
+			}},
+			want: []string{"frame 0 field 0 (value): type legacy []float64, candidate []string"},
+		},
+		{
+			name:      "error",
+			legacy:    &backend.DataResponse{},
+			candidate: &backend.DataResponse{Error: errors.New("boom")},
+			want:      []string{`error: legacy "", candidate "boom"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DiffResponses(tt.legacy, tt.candidate))
+		})
+	}
+}
+
+func TestDiffResponses_Limit(t *testing.T) {
+	legacy := &backend.DataResponse{}
+	candidate := &backend.DataResponse{}
+	for i := 0; i < maxDiscrepancies+5; i++ {
+		legacy.Frames = append(legacy.Frames, data.NewFrame("legacy"))
+		candidate.Frames = append(candidate.Frames, data.NewFrame("candidate"))
+	}
+	assert.Len(t, DiffResponses(legacy, candidate), maxDiscrepancies)
+}
+
+func TestVerifyDualWrite(t *testing.T) {
+	original := CandidateFormatter
+	defer func() { CandidateFormatter = original }()
+
+	results := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": float64(3)}}}
+	query := backend.DataQuery{RefID: "A"}
+	legacy := FormatQueryResults(results, query)
+	legacyFrames := len(legacy.Frames)
+
+	CandidateFormatter = nil
+	assert.Empty(t, VerifyDualWrite(legacy, results, query, FormatOptions{}))
+
+	CandidateFormatter = func(results interface{}, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+		return FormatQueryResultsWithOptions(results.(*nrdb.NRDBResultContainer), query, opts)
+	}
+	assert.Empty(t, VerifyDualWrite(legacy, results, query, FormatOptions{}))
+
+	CandidateFormatter = func(results interface{}, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+		return &backend.DataResponse{}
+	}
+	assert.NotEmpty(t, VerifyDualWrite(legacy, results, query, FormatOptions{}))
+
+	CandidateFormatter = func(results interface{}, query backend.DataQuery, opts FormatOptions) *backend.DataResponse {
+		panic("not implemented")
+	}
+	discrepancies := VerifyDualWrite(legacy, results, query, FormatOptions{})
+	require.Len(t, discrepancies, 1)
+	assert.Contains(t, discrepancies[0], "candidate formatter panicked: not implemented")
+
+	assert.Len(t, legacy.Frames, legacyFrames, "the legacy response must not be modified")
+}
+
+func TestVerifyDualWrite_ConsolidatedFormatter(t *testing.T) {
+	results := &nrdb.NRDBResultContainerMultiResultCustomized{
+		Results: []nrdb.NRDBResult{
+			{"facet": "web", "appName": "web", "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0, "count": 3.0},
+			{"facet": "api", "appName": "api", "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0, "count": 5.0},
+			{"facet": "web", "appName": "web", "beginTimeSeconds": 1700000060.0, "endTimeSeconds": 1700000120.0, "count": 4.0},
+			{"facet": "api", "appName": "api", "beginTimeSeconds": 1700000060.0, "endTimeSeconds": 1700000120.0, "count": 6.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+	query := backend.DataQuery{RefID: "A"}
+	legacy := FormatFacetedTimeseriesResultsWithOptions(results, query, FormatOptions{})
+	require.NoError(t, legacy.Error)
+	require.NotEmpty(t, legacy.Frames)
+
+	assert.Empty(t, VerifyDualWrite(legacy, results, query, FormatOptions{}), "the consolidated formatter is the default candidate")
+}
+
+func TestPayloadHash(t *testing.T) {
+	a := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": float64(3)}}}
+	b := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": float64(4)}}}
+	assert.Equal(t, PayloadHash(a), PayloadHash(a))
+	assert.NotEqual(t, PayloadHash(a), PayloadHash(b))
+	assert.Len(t, PayloadHash(a), 16)
+}
+
+func TestDiffResponses_TimeTolerance(t *testing.T) {
+	now := time.Now()
+	timeFrame := func(ts time.Time) *backend.DataResponse {
+		return &backend.DataResponse{Frames: data.Frames{data.NewFrame("A", data.NewField("time", nil, []time.Time{ts}))}}
+	}
+
+	assert.Empty(t, DiffResponses(timeFrame(now), timeFrame(now.Add(time.Millisecond))))
+	assert.Len(t, DiffResponses(timeFrame(now), timeFrame(now.Add(time.Minute))), 1)
+}
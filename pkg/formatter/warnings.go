@@ -0,0 +1,89 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// infoMessageHints mark NRDB metadata messages that only describe the results,
+// such as how the time window was bucketed. Other messages are warnings, since
+// they usually mean the results are incomplete: sampled data, an unknown event
+// type or attribute, or a limit that was hit.
+var infoMessageHints = []string{"time window", "bucket", "timeseries", "rounded"}
+
+// NRDBNotices returns the notices for what New Relic reported about results:
+// the messages in the NRDB metadata, events omitted from the results, and an
+// asynchronous query that had not completed.
+func NRDBNotices(results interface{}) []data.Notice {
+	var metadata nrdb.NRDBMetadata
+	var progress nrdb.NRDBQueryProgress
+	switch r := results.(type) {
+	case *nrdb.NRDBResultContainer:
+		metadata, progress = r.Metadata, r.QueryProgress
+	case *nrdb.NRDBResultContainerMultiResultCustomized:
+		metadata, progress = r.Metadata, r.QueryProgress
+	default:
+		return nil
+	}
+
+	var notices []data.Notice
+	seen := make(map[string]bool)
+	for _, message := range metadata.Messages {
+		message = strings.TrimSpace(message)
+		if message == "" || seen[message] {
+			continue
+		}
+		seen[message] = true
+		notices = append(notices, data.Notice{
+			Severity: messageSeverity(message),
+			Text:     "New Relic: " + message,
+		})
+	}
+
+	if omitted, ok := PerformanceStats(results)["omittedCount"].(float64); ok && omitted > 0 {
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("New Relic omitted %.0f matching events from the results, which may be sampled or incomplete", omitted),
+		})
+	}
+
+	if progress.QueryId != 0 && !progress.Completed {
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "The query had not completed in New Relic; the results are partial",
+		})
+	}
+	return notices
+}
+
+// messageSeverity returns the notice severity of an NRDB metadata message.
+func messageSeverity(message string) data.NoticeSeverity {
+	lower := strings.ToLower(message)
+	for _, hint := range infoMessageHints {
+		if strings.Contains(lower, hint) {
+			return data.NoticeSeverityInfo
+		}
+	}
+	return data.NoticeSeverityWarning
+}
+
+// AttachNRDBNotices adds the NRDBNotices of results to every frame in resp. A
+// response without frames gets an empty one to carry them, so a query of an
+// unknown event type shows why it returned nothing.
+func AttachNRDBNotices(resp *backend.DataResponse, results interface{}) {
+	if resp == nil || resp.Error != nil {
+		return
+	}
+	notices := NRDBNotices(results)
+	if len(notices) == 0 {
+		return
+	}
+	if len(resp.Frames) == 0 {
+		resp.Frames = append(resp.Frames, data.NewFrame(""))
+	}
+	AppendNotices(resp, notices...)
+}
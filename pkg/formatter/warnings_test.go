@@ -0,0 +1,81 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNRDBNotices(t *testing.T) {
+	tests := []struct {
+		name    string
+		results interface{}
+		want    []data.Notice
+	}{
+		{name: "no metadata", results: &nrdb.NRDBResultContainer{}},
+		{name: "unsupported results", results: "not results"},
+		{
+			name: "metadata messages",
+			results: &nrdb.NRDBResultContainer{Metadata: nrdb.NRDBMetadata{Messages: []string{
+				"Your query's time window was rounded to the nearest minute.",
+				"Event type 'Transactions' does not exist",
+				"Event type 'Transactions' does not exist",
+				" ",
+			}}},
+			want: []data.Notice{
+				{Severity: data.NoticeSeverityInfo, Text: "New Relic: Your query's time window was rounded to the nearest minute."},
+				{Severity: data.NoticeSeverityWarning, Text: "New Relic: Event type 'Transactions' does not exist"},
+			},
+		},
+		{
+			name: "omitted events",
+			results: &nrdb.NRDBResultContainerMultiResultCustomized{RawResponse: nrdb.NRDBRawResults{
+				"performanceStats": map[string]interface{}{"omittedCount": 1200.0},
+			}},
+			want: []data.Notice{
+				{Severity: data.NoticeSeverityWarning, Text: "New Relic omitted 1200 matching events from the results, which may be sampled or incomplete"},
+			},
+		},
+		{
+			name:    "incomplete asynchronous query",
+			results: &nrdb.NRDBResultContainer{QueryProgress: nrdb.NRDBQueryProgress{QueryId: 7}},
+			want: []data.Notice{
+				{Severity: data.NoticeSeverityWarning, Text: "The query had not completed in New Relic; the results are partial"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NRDBNotices(tt.results))
+		})
+	}
+}
+
+func TestAttachNRDBNotices(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{Metadata: nrdb.NRDBMetadata{Messages: []string{"Event type 'Transactions' does not exist"}}}
+
+	t.Run("adds a frame to an empty response", func(t *testing.T) {
+		resp := &backend.DataResponse{}
+		AttachNRDBNotices(resp, results)
+		require.Len(t, resp.Frames, 1)
+		require.NotNil(t, resp.Frames[0].Meta)
+		assert.Len(t, resp.Frames[0].Meta.Notices, 1)
+	})
+
+	t.Run("failed responses are left alone", func(t *testing.T) {
+		resp := &backend.DataResponse{Error: assert.AnError}
+		AttachNRDBNotices(resp, results)
+		assert.Empty(t, resp.Frames)
+	})
+
+	t.Run("no notices", func(t *testing.T) {
+		resp := &backend.DataResponse{}
+		AttachNRDBNotices(resp, &nrdb.NRDBResultContainer{})
+		assert.Empty(t, resp.Frames)
+	})
+}
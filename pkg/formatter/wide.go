@@ -0,0 +1,61 @@
+package formatter
+
+import (
+	"sort"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// wideFrame joins frames that each start with a time field into one wide frame
+// with a shared, ascending time field and every value field of every frame.
+// Values are nullable numbers, null where a frame has no row for a time. Frames
+// are joined in the order given, which is the facet order of the query.
+func wideFrame(frames data.Frames) *data.Frame {
+	// Collect the distinct times of all frames
+	index := make(map[time.Time]int)
+	var times []time.Time
+	for _, frame := range frames {
+		if len(frame.Fields) == 0 || !frame.Fields[0].Type().Time() {
+			continue
+		}
+		for i := 0; i < frame.Fields[0].Len(); i++ {
+			if t, ok := frame.Fields[0].ConcreteAt(i); ok {
+				if _, seen := index[t.(time.Time)]; !seen {
+					index[t.(time.Time)] = 0
+					times = append(times, t.(time.Time))
+				}
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i, t := range times {
+		index[t] = i
+	}
+
+	wide := data.NewFrame(utils.FacetedTimeSeriesFrameName, data.NewField(utils.TimeFieldName, nil, times))
+	for _, frame := range frames {
+		if len(frame.Fields) == 0 || !frame.Fields[0].Type().Time() {
+			continue
+		}
+		timeField := frame.Fields[0]
+		for _, field := range frame.Fields[1:] {
+			values := make([]*float64, len(times))
+			for i := 0; i < field.Len(); i++ {
+				t, ok := timeField.ConcreteAt(i)
+				if !ok {
+					continue
+				}
+				if value, err := field.NullableFloatAt(i); err == nil {
+					values[index[t.(time.Time)]] = value
+				}
+			}
+			column := data.NewField(field.Name, field.Labels, values)
+			column.Config = field.Config
+			wide.Fields = append(wide.Fields, column)
+		}
+	}
+	return wide
+}
@@ -0,0 +1,42 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatQueryResultsWithOptions_Wide(t *testing.T) {
+	results := &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": "web", "average.duration": 1.0, "beginTimeSeconds": 1700000060.0},
+			{"facet": "api", "average.duration": 2.0, "beginTimeSeconds": 1700000000.0},
+			{"facet": "api", "average.duration": 3.0, "beginTimeSeconds": 1700000060.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}
+
+	resp := FormatQueryResultsWithOptions(results, backend.DataQuery{RefID: "A"}, FormatOptions{Wide: true})
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	require.Len(t, frame.Fields, 3)
+
+	assert.Equal(t, []interface{}{time.Unix(1700000000, 0).UTC(), time.Unix(1700000060, 0).UTC()},
+		[]interface{}{frame.Fields[0].At(0).(time.Time).UTC(), frame.Fields[0].At(1).(time.Time).UTC()})
+
+	api, web := frame.Fields[1], frame.Fields[2]
+	assert.Equal(t, data.Labels{"appName": "api"}, api.Labels)
+	assert.Equal(t, data.Labels{"appName": "web"}, web.Labels)
+	assert.Equal(t, 2.0, *api.At(0).(*float64))
+	assert.Equal(t, 3.0, *api.At(1).(*float64))
+	assert.Nil(t, web.At(0).(*float64))
+	assert.Equal(t, 1.0, *web.At(1).(*float64))
+
+	require.NotNil(t, frame.Meta)
+	assert.Equal(t, data.FrameTypeTimeSeriesWide, frame.Meta.Type)
+}
@@ -0,0 +1,63 @@
+// Package framebuilder builds data frame fields with few allocations, so that
+// formatting large results on high-refresh dashboards does not churn the
+// garbage collector. Nullable fields keep their values in one backing array
+// instead of allocating each value, and the scratch buffers used while
+// formatting are pooled.
+package framebuilder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// valuesPool holds scratch slices of raw result values.
+var valuesPool = sync.Pool{
+	New: func() interface{} { return new([]interface{}) },
+}
+
+// Values returns a scratch slice of n nil values. Give it back with Release
+// once nothing refers to it.
+func Values(n int) []interface{} {
+	buf := valuesPool.Get().(*[]interface{})
+	if cap(*buf) < n {
+		*buf = make([]interface{}, n)
+	}
+	return (*buf)[:n]
+}
+
+// Release clears values, so the pool does not keep results alive, and returns
+// it to the pool.
+func Release(values []interface{}) {
+	clear(values)
+	values = values[:0]
+	valuesPool.Put(&values)
+}
+
+// Value is a type of the values of fields built by Nullable.
+type Value interface {
+	float64 | int64 | uint64 | time.Time | bool
+}
+
+// Nullable builds a []*T field of a fixed length.
+type Nullable[T Value] struct {
+	values  []*T
+	backing []T
+}
+
+// NewNullable returns a builder of n null values.
+func NewNullable[T Value](n int) *Nullable[T] {
+	return &Nullable[T]{values: make([]*T, n), backing: make([]T, n)}
+}
+
+// Set sets the value at row i.
+func (b *Nullable[T]) Set(i int, value T) {
+	b.backing[i] = value
+	b.values[i] = &b.backing[i]
+}
+
+// Field returns the built field. The builder must not be used afterwards.
+func (b *Nullable[T]) Field(name string) *data.Field {
+	return data.NewField(name, nil, b.values)
+}
@@ -0,0 +1,92 @@
+package framebuilder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValues(t *testing.T) {
+	values := Values(3)
+	require.Len(t, values, 3)
+	values[0], values[2] = "a", 1.0
+	Release(values)
+
+	// A released buffer comes back cleared
+	for i := 0; i < 10; i++ {
+		reused := Values(2)
+		assert.Equal(t, []interface{}{nil, nil}, reused)
+		reused[0] = "b"
+		Release(reused)
+	}
+	assert.Len(t, Values(1000), 1000)
+}
+
+func TestNullable_Float64(t *testing.T) {
+	b := NewNullable[float64](3)
+	b.Set(0, 1.5)
+	b.Set(2, -2)
+	field := b.Field("value")
+
+	assert.Equal(t, "value", field.Name)
+	assert.Equal(t, data.FieldTypeNullableFloat64, field.Type())
+	require.Equal(t, 3, field.Len())
+	assert.Equal(t, 1.5, *field.At(0).(*float64))
+	assert.Nil(t, field.At(1).(*float64))
+	assert.Equal(t, -2.0, *field.At(2).(*float64))
+}
+
+func TestNullable_Int64(t *testing.T) {
+	b := NewNullable[int64](2)
+	b.Set(1, 9007199254740993)
+	field := b.Field("id")
+
+	assert.Equal(t, data.FieldTypeNullableInt64, field.Type())
+	assert.Nil(t, field.At(0).(*int64))
+	assert.Equal(t, int64(9007199254740993), *field.At(1).(*int64))
+}
+
+func TestNullable_Uint64(t *testing.T) {
+	b := NewNullable[uint64](2)
+	b.Set(0, 18446744073709551615)
+	field := b.Field("id")
+
+	assert.Equal(t, data.FieldTypeNullableUint64, field.Type())
+	assert.Equal(t, uint64(18446744073709551615), *field.At(0).(*uint64))
+	assert.Nil(t, field.At(1).(*uint64))
+}
+
+func TestNullable_Time(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewNullable[time.Time](2)
+	b.Set(1, now)
+	field := b.Field("time")
+
+	assert.Equal(t, data.FieldTypeNullableTime, field.Type())
+	assert.Nil(t, field.At(0).(*time.Time))
+	assert.Equal(t, now, *field.At(1).(*time.Time))
+}
+
+func TestNullable_Bool(t *testing.T) {
+	b := NewNullable[bool](2)
+	b.Set(0, true)
+	field := b.Field("ok")
+
+	assert.Equal(t, data.FieldTypeNullableBool, field.Type())
+	assert.True(t, *field.At(0).(*bool))
+	assert.Nil(t, field.At(1).(*bool))
+}
+
+func BenchmarkNullable_Float64(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder := NewNullable[float64](10000)
+		for row := 0; row < 10000; row++ {
+			builder.Set(row, float64(row))
+		}
+		builder.Field("value")
+	}
+}
@@ -0,0 +1,299 @@
+// Package graphql runs raw GraphQL queries against NerdGraph for the nerdgraph
+// query type and flattens the selected part of the response into a table frame.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// FrameName is the name of the table frame of a nerdgraph query.
+const FrameName = "nerdgraph"
+
+// MaxRows is the number of selected nodes returned as rows; the rest are dropped
+// with a warning notice.
+const MaxRows = 10000
+
+// AccountIDVariable is the GraphQL variable set to the query account when a
+// query declares it without a value.
+const AccountIDVariable = "accountId"
+
+var (
+	// commentPattern matches GraphQL comments, which run to the end of the line.
+	commentPattern = regexp.MustCompile(`#[^\n]*`)
+	// stringPattern matches GraphQL string literals.
+	stringPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	// writeOperationPattern matches mutation and subscription operations, which
+	// start the document or follow the closing brace of another definition.
+	writeOperationPattern = regexp.MustCompile(`(^|\})\s*(mutation|subscription)\b`)
+	// accountIDPattern matches a declaration of the AccountIDVariable variable.
+	accountIDPattern = regexp.MustCompile(`\$` + AccountIDVariable + `\s*:`)
+	// segmentPattern matches a selector step: a field name, or an index or
+	// wildcard in brackets.
+	segmentPattern = regexp.MustCompile(`^(?:([A-Za-z_][A-Za-z0-9_]*|\*)|\[(\d+|\*)\])`)
+)
+
+// RequestError represents an invalid nerdgraph query.
+type RequestError struct {
+	Msg string
+}
+
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// ValidateQuery checks that query is a read-only GraphQL document: the nerdgraph
+// query type does not run mutations or subscriptions.
+func ValidateQuery(query string) error {
+	stripped := commentPattern.ReplaceAllString(stringPattern.ReplaceAllString(query, `""`), "")
+	if strings.TrimSpace(stripped) == "" {
+		return &RequestError{Msg: "GraphQL query is required"}
+	}
+	if match := writeOperationPattern.FindStringSubmatch(stripped); match != nil {
+		return &RequestError{Msg: fmt.Sprintf("GraphQL %s operations are not allowed; only queries can be run", match[2])}
+	}
+	return nil
+}
+
+// Run runs query with variables and returns the response data. If the query
+// declares $accountId and variables has no value for it, accountID is used.
+func Run(ctx context.Context, executor nrdbiface.GraphQLExecutor, query string, variables map[string]interface{}, accountID int) (interface{}, error) {
+	if err := ValidateQuery(query); err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]interface{}, len(variables)+1)
+	for name, value := range variables {
+		vars[name] = value
+	}
+	if _, ok := vars[AccountIDVariable]; !ok && accountIDPattern.MatchString(query) {
+		vars[AccountIDVariable] = accountID
+	}
+
+	var respData interface{}
+	if err := executor.QueryWithResponseAndContext(ctx, query, vars, &respData); err != nil {
+		return nil, err
+	}
+	return respData, nil
+}
+
+// Select returns the nodes of respData picked by selector, a dotted path such as
+// "actor.account.nrql.results" or "actor.entitySearch.results.entities[*].tags[0]".
+// A leading "$" is ignored, "*" or "[*]" selects every element or field value,
+// and "[N]" selects one element. When the selector picks a single array, its
+// elements are returned. An empty selector selects the whole response.
+func Select(respData interface{}, selector string) ([]interface{}, error) {
+	steps, err := parseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []interface{}{respData}
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			next = append(next, step.apply(node)...)
+		}
+		nodes = next
+	}
+
+	if len(nodes) == 1 {
+		if items, ok := nodes[0].([]interface{}); ok {
+			return items, nil
+		}
+	}
+	return nodes, nil
+}
+
+// selectorStep is one step of a selector: a field name, an index, or a wildcard.
+type selectorStep struct {
+	field    string
+	index    int
+	wildcard bool
+}
+
+// apply returns the nodes node leads to through the step. Missing fields and
+// out-of-range indexes lead nowhere.
+func (s selectorStep) apply(node interface{}) []interface{} {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			nodes := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				nodes = append(nodes, value[key])
+			}
+			return nodes
+		}
+		if child, ok := value[s.field]; ok && s.field != "" {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return value
+		}
+		if s.field == "" && s.index < len(value) {
+			return []interface{}{value[s.index]}
+		}
+		if s.field != "" {
+			// A field of a list selects the field of each element
+			var nodes []interface{}
+			for _, item := range value {
+				nodes = append(nodes, s.apply(item)...)
+			}
+			return nodes
+		}
+	}
+	return nil
+}
+
+// parseSelector splits a selector into its steps.
+func parseSelector(selector string) ([]selectorStep, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(selector), "$")
+	var steps []selectorStep
+	for rest != "" {
+		rest = strings.TrimPrefix(rest, ".")
+		match := segmentPattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, &RequestError{Msg: fmt.Sprintf("invalid selector '%s' at '%s'", selector, rest)}
+		}
+		switch {
+		case match[1] == "*" || match[2] == "*":
+			steps = append(steps, selectorStep{wildcard: true})
+		case match[1] != "":
+			steps = append(steps, selectorStep{field: match[1]})
+		default:
+			index, _ := strconv.Atoi(match[2])
+			steps = append(steps, selectorStep{index: index})
+		}
+		rest = rest[len(match[0]):]
+	}
+	return steps, nil
+}
+
+// Frame returns nodes as a table with a row per node. Objects are flattened into
+// a column per leaf field, named by the dotted path to it; arrays are kept as
+// JSON text, and other values are put in a "value" column. Columns are sorted by
+// name and typed as numbers, booleans or strings from their values.
+func Frame(nodes []interface{}) *data.Frame {
+	var notices []data.Notice
+	if len(nodes) > MaxRows {
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Showing the first %d of %d selected nodes", MaxRows, len(nodes)),
+		})
+		nodes = nodes[:MaxRows]
+	}
+
+	rows := make([]map[string]interface{}, len(nodes))
+	columns := make(map[string]bool)
+	for i, node := range nodes {
+		rows[i] = make(map[string]interface{})
+		flatten(rows[i], "", node)
+		for column := range rows[i] {
+			columns[column] = true
+		}
+	}
+
+	names := make([]string, 0, len(columns))
+	for column := range columns {
+		names = append(names, column)
+	}
+	sort.Strings(names)
+
+	frame := data.NewFrame(FrameName)
+	for _, name := range names {
+		frame.Fields = append(frame.Fields, column(name, rows))
+	}
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable, Notices: notices}
+	return frame
+}
+
+// flatten adds the leaf values of node to row, keyed by their dotted path below prefix.
+func flatten(row map[string]interface{}, prefix string, node interface{}) {
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		if prefix == "" {
+			prefix = "value"
+		}
+		row[prefix] = node
+		return
+	}
+	for key, value := range object {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		flatten(row, name, value)
+	}
+}
+
+// column returns the field holding the values of a column, typed as numbers or
+// booleans when all its values are, and as strings otherwise.
+func column(name string, rows []map[string]interface{}) *data.Field {
+	numeric, boolean := true, true
+	for _, row := range rows {
+		switch row[name].(type) {
+		case nil:
+		case float64:
+			boolean = false
+		case bool:
+			numeric = false
+		default:
+			numeric, boolean = false, false
+		}
+	}
+
+	switch {
+	case numeric:
+		values := make([]*float64, len(rows))
+		for i, row := range rows {
+			if value, ok := row[name].(float64); ok {
+				values[i] = &value
+			}
+		}
+		return data.NewField(name, nil, values)
+	case boolean:
+		values := make([]*bool, len(rows))
+		for i, row := range rows {
+			if value, ok := row[name].(bool); ok {
+				values[i] = &value
+			}
+		}
+		return data.NewField(name, nil, values)
+	default:
+		values := make([]*string, len(rows))
+		for i, row := range rows {
+			if row[name] != nil {
+				text := stringValue(row[name])
+				values[i] = &text
+			}
+		}
+		return data.NewField(name, nil, values)
+	}
+}
+
+// stringValue returns value as text: strings as is, anything else as JSON.
+func stringValue(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return text
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(raw)
+}
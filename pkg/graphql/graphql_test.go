@@ -0,0 +1,170 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResponse is a NerdGraph response with NRQL results and entity tags.
+func testResponse() interface{} {
+	return map[string]interface{}{
+		"actor": map[string]interface{}{
+			"account": map[string]interface{}{
+				"nrql": map[string]interface{}{
+					"results": []interface{}{
+						map[string]interface{}{"appName": "checkout", "count": 12.0, "error": false},
+						map[string]interface{}{"appName": "billing", "count": 3.0, "meta": map[string]interface{}{"region": "eu"}},
+					},
+				},
+			},
+			"entitySearch": map[string]interface{}{
+				"results": map[string]interface{}{
+					"entities": []interface{}{
+						map[string]interface{}{"name": "a", "tags": []interface{}{map[string]interface{}{"key": "env"}}},
+						map[string]interface{}{"name": "b", "tags": []interface{}{map[string]interface{}{"key": "team"}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "query", query: "{ actor { user { name } } }"},
+		{name: "named query", query: "query Apps($accountId: Int!) { actor { account(id: $accountId) { name } } }"},
+		{name: "mutation in a string", query: `{ actor { nrql(query: "mutation {") { results } } }`},
+		{name: "mutation in a comment", query: "# mutation {\n{ actor { user { name } } }"},
+		{name: "empty", query: "  ", wantErr: "GraphQL query is required"},
+		{name: "mutation", query: "mutation { alertsPolicyDelete(id: 1) { id } }", wantErr: "GraphQL mutation operations are not allowed; only queries can be run"},
+		{name: "mutation after a query", query: "query A { actor { user { name } } }\nmutation B { x }", wantErr: "GraphQL mutation operations are not allowed"},
+		{name: "subscription", query: "subscription { x }", wantErr: "GraphQL subscription operations are not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateQuery(tt.query)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var requestErr *RequestError
+			require.True(t, errors.As(err, &requestErr))
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	var gotVariables map[string]interface{}
+	executor := nrdbiface.GraphQLExecutorFunc(func(_ context.Context, _ string, variables map[string]interface{}) (interface{}, error) {
+		gotVariables = variables
+		return testResponse(), nil
+	})
+
+	t.Run("defaults the declared account ID", func(t *testing.T) {
+		respData, err := Run(context.Background(), executor, "query($accountId: Int!) { actor { account(id: $accountId) { name } } }", map[string]interface{}{"limit": 5.0}, 42)
+		require.NoError(t, err)
+		assert.NotNil(t, respData)
+		assert.Equal(t, map[string]interface{}{"limit": 5.0, "accountId": 42}, gotVariables)
+	})
+
+	t.Run("keeps an explicit account ID", func(t *testing.T) {
+		_, err := Run(context.Background(), executor, "query($accountId: Int!) { x }", map[string]interface{}{"accountId": 7.0}, 42)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"accountId": 7.0}, gotVariables)
+	})
+
+	t.Run("undeclared account ID", func(t *testing.T) {
+		_, err := Run(context.Background(), executor, "{ actor { user { name } } }", nil, 42)
+		require.NoError(t, err)
+		assert.Empty(t, gotVariables)
+	})
+
+	t.Run("executor error", func(t *testing.T) {
+		failing := nrdbiface.GraphQLExecutorFunc(func(context.Context, string, map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("unauthorized")
+		})
+		_, err := Run(context.Background(), failing, "{ x }", nil, 42)
+		assert.EqualError(t, err, "unauthorized")
+	})
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     []interface{}
+		wantErr  bool
+	}{
+		{name: "array elements", selector: "actor.account.nrql.results", want: testResponse().(map[string]interface{})["actor"].(map[string]interface{})["account"].(map[string]interface{})["nrql"].(map[string]interface{})["results"].([]interface{})},
+		{name: "index", selector: "$.actor.account.nrql.results[1].appName", want: []interface{}{"billing"}},
+		{name: "wildcard", selector: "actor.entitySearch.results.entities[*].name", want: []interface{}{"a", "b"}},
+		{name: "field of each element", selector: "actor.entitySearch.results.entities.tags[0].key", want: []interface{}{"env", "team"}},
+		{name: "missing field", selector: "actor.missing", want: nil},
+		{name: "invalid", selector: "actor..[x]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Select(testResponse(), tt.selector)
+			if tt.wantErr {
+				var requestErr *RequestError
+				assert.True(t, errors.As(err, &requestErr))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	whole, err := Select(testResponse(), "")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{testResponse()}, whole)
+}
+
+func TestFrame(t *testing.T) {
+	nodes, err := Select(testResponse(), "actor.account.nrql.results")
+	require.NoError(t, err)
+
+	frame := Frame(nodes)
+	assert.Equal(t, FrameName, frame.Name)
+	require.Equal(t, 2, frame.Rows())
+
+	var names []string
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"appName", "count", "error", "meta.region"}, names)
+
+	count, _ := frame.Fields[1].ConcreteAt(0)
+	assert.Equal(t, 12.0, count)
+	flag, _ := frame.Fields[2].ConcreteAt(0)
+	assert.Equal(t, false, flag)
+	_, ok := frame.Fields[2].ConcreteAt(1)
+	assert.False(t, ok)
+	region, _ := frame.Fields[3].ConcreteAt(1)
+	assert.Equal(t, "eu", region)
+
+	t.Run("scalars and arrays", func(t *testing.T) {
+		frame := Frame([]interface{}{"a", []interface{}{1.0, 2.0}})
+		require.Len(t, frame.Fields, 1)
+		assert.Equal(t, "value", frame.Fields[0].Name)
+		value, _ := frame.Fields[0].ConcreteAt(1)
+		assert.Equal(t, "[1,2]", value)
+	})
+
+	t.Run("row limit", func(t *testing.T) {
+		frame := Frame(make([]interface{}, MaxRows+1))
+		assert.Equal(t, MaxRows, frame.Rows())
+		require.Len(t, frame.Meta.Notices, 1)
+	})
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// Limits of the anomaly bands of a query
+const (
+	MaxAnomalyBands   = 10   // Widest band, in standard deviations
+	MaxBaselineWindow = 1000 // Most points of the rolling baseline
+)
+
+// validateAnomalyBands checks the anomaly band options of a query.
+func validateAnomalyBands(qm models.QueryModel) error {
+	if qm.AnomalyBands < 0 || qm.AnomalyBands > MaxAnomalyBands {
+		return fmt.Errorf("invalid anomalyBands %g: must be between 0 and %d standard deviations", qm.AnomalyBands, MaxAnomalyBands)
+	}
+	if qm.BaselineWindow < 0 || qm.BaselineWindow > MaxBaselineWindow {
+		return fmt.Errorf("invalid baselineWindow %d: must be between 0 and %d points", qm.BaselineWindow, MaxBaselineWindow)
+	}
+	return nil
+}
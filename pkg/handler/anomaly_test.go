@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAnomalyBands(t *testing.T) {
+	assert.NoError(t, validateAnomalyBands(models.QueryModel{}))
+	assert.NoError(t, validateAnomalyBands(models.QueryModel{AnomalyBands: 2.5, BaselineWindow: 30}))
+	assert.Error(t, validateAnomalyBands(models.QueryModel{AnomalyBands: -1}))
+	assert.Error(t, validateAnomalyBands(models.QueryModel{AnomalyBands: MaxAnomalyBands + 1}))
+	assert.Error(t, validateAnomalyBands(models.QueryModel{AnomalyBands: 2, BaselineWindow: MaxBaselineWindow + 1}))
+}
+
+func TestHandleQuery_AnomalyBands(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	from := time.UnixMilli(1700000000000).UTC()
+	query := backend.DataQuery{
+		RefID:         "A",
+		TimeRange:     backend.TimeRange{From: from, To: from.Add(time.Hour)},
+		MaxDataPoints: 1000,
+		JSON:          []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES 1 minute", "anomalyBands": 2}`),
+	}
+
+	resp := HandleQuery(context.Background(), &bucketExecutor{}, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	var names []string
+	for _, field := range resp.Frames[0].Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"time", "count", "count baseline", "count upper", "count lower"}, names)
+
+	// Results without time series get a notice instead
+	query.JSON = []byte(`{"queryText": "SELECT count(*) FROM Transaction", "anomalyBands": 2}`)
+	resp = HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.NoError(t, resp.Error)
+	assert.Contains(t, noticeTexts(resp), "anomalyBands ignored: only TIMESERIES results get bands")
+
+	query.JSON = []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES", "anomalyBands": 20}`)
+	resp = HandleQuery(context.Background(), &bucketExecutor{}, config, query)
+	assert.Error(t, resp.Error)
+}
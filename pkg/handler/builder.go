@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// builderFunctions are the aggregation functions the query builder offers, and
+// whether each requires an attribute.
+var builderFunctions = map[string]bool{
+	"count":       false,
+	"sum":         true,
+	"average":     true,
+	"min":         true,
+	"max":         true,
+	"median":      true,
+	"latest":      true,
+	"earliest":    true,
+	"stddev":      true,
+	"uniqueCount": true,
+	"uniques":     true,
+	"percentile":  true,
+}
+
+// relativeTimePattern matches relative SINCE and UNTIL times such as "30 minutes ago".
+var relativeTimePattern = regexp.MustCompile(`(?i)^\d+ (second|minute|hour|day|week)s? ago$`)
+
+// BuilderError represents a part of a structured query that cannot be compiled to NRQL.
+type BuilderError struct {
+	Field string // Builder field at fault, e.g. "select[1]" or "where[0]"
+	Msg   string
+}
+
+func (e *BuilderError) Error() string {
+	return fmt.Sprintf("cannot compile query builder %s: %s", e.Field, e.Msg)
+}
+
+// CompileQuery builds the NRQL query for a structured query from the visual
+// editor. Attributes and event types are backtick-quoted as needed and values
+// are quoted as string literals, so no part of the builder can add clauses.
+func CompileQuery(b models.QueryBuilder) (string, error) {
+	if len(b.Select) == 0 {
+		return "", &BuilderError{Field: "select", Msg: "at least one aggregation is required"}
+	}
+	selects := make([]string, len(b.Select))
+	for i, expr := range b.Select {
+		compiled, err := compileSelect(expr)
+		if err != nil {
+			return "", &BuilderError{Field: fmt.Sprintf("select[%d]", i), Msg: err.Error()}
+		}
+		selects[i] = compiled
+	}
+
+	eventType, err := builderName(b.EventType)
+	if err != nil {
+		return "", &BuilderError{Field: "eventType", Msg: err.Error()}
+	}
+	clauses := []string{"SELECT " + strings.Join(selects, ", "), "FROM " + eventType}
+
+	if len(b.Where) > 0 {
+		conditions := make([]string, len(b.Where))
+		for i, filter := range b.Where {
+			condition, err := filterCondition(filter)
+			if err != nil {
+				var filterErr *FilterError
+				if errors.As(err, &filterErr) {
+					err = errors.New(filterErr.Msg)
+				}
+				return "", &BuilderError{Field: fmt.Sprintf("where[%d]", i), Msg: err.Error()}
+			}
+			conditions[i] = condition
+		}
+		clauses = append(clauses, "WHERE "+strings.Join(conditions, " AND "))
+	}
+
+	if len(b.Facet) > 0 {
+		facets := make([]string, len(b.Facet))
+		for i, facet := range b.Facet {
+			if facets[i], err = builderName(facet); err != nil {
+				return "", &BuilderError{Field: fmt.Sprintf("facet[%d]", i), Msg: err.Error()}
+			}
+		}
+		clauses = append(clauses, "FACET "+strings.Join(facets, ", "))
+	}
+
+	for _, bound := range []struct{ field, keyword, value string }{{"since", "SINCE", b.Since}, {"until", "UNTIL", b.Until}} {
+		if bound.value == "" {
+			continue
+		}
+		if !isBuilderTime(bound.value) {
+			return "", &BuilderError{Field: bound.field, Msg: fmt.Sprintf("'%s' is neither epoch milliseconds nor a relative time such as '1 hour ago'", bound.value)}
+		}
+		clauses = append(clauses, bound.keyword+" "+bound.value)
+	}
+
+	if b.Limit < 0 || b.Limit > MaxPageSize {
+		return "", &BuilderError{Field: "limit", Msg: fmt.Sprintf("%d is not between 1 and %d", b.Limit, MaxPageSize)}
+	}
+	if b.Limit > 0 {
+		clauses = append(clauses, fmt.Sprintf("LIMIT %d", b.Limit))
+	}
+
+	if b.Timeseries != "" {
+		bucket := strings.ToUpper(b.Timeseries)
+		if _, ok := parseNRQLDuration(b.Timeseries); ok {
+			bucket = strings.ToLower(b.Timeseries)
+		} else if bucket != "AUTO" && bucket != "MAX" {
+			return "", &BuilderError{Field: "timeseries", Msg: fmt.Sprintf("'%s' is not a bucket such as '5 minutes', AUTO or MAX", b.Timeseries)}
+		}
+		clauses = append(clauses, "TIMESERIES "+bucket)
+	}
+	return strings.Join(clauses, " "), nil
+}
+
+// compileSelect returns the NRQL of one aggregation.
+func compileSelect(expr models.SelectExpression) (string, error) {
+	needsAttribute, ok := builderFunctions[expr.Function]
+	if !ok {
+		return "", fmt.Errorf("unsupported function '%s'", expr.Function)
+	}
+
+	args := []string{"*"}
+	if expr.Attribute != "" {
+		attribute, err := builderName(expr.Attribute)
+		if err != nil {
+			return "", err
+		}
+		args = []string{attribute}
+	} else if needsAttribute {
+		return "", fmt.Errorf("%s requires an attribute", expr.Function)
+	}
+	for _, arg := range expr.Args {
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			return "", fmt.Errorf("argument '%s' is not a number", arg)
+		}
+		args = append(args, arg)
+	}
+	if expr.Function == "percentile" && len(expr.Args) == 0 {
+		return "", fmt.Errorf("percentile requires at least one percentile argument")
+	}
+
+	compiled := fmt.Sprintf("%s(%s)", expr.Function, strings.Join(args, ", "))
+	if expr.Alias != "" {
+		compiled += " AS " + quoteString(expr.Alias)
+	}
+	return compiled, nil
+}
+
+// builderName returns an attribute or event type name for use in NRQL,
+// backtick-quoted unless it is a plain identifier.
+func builderName(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", fmt.Errorf("name is empty")
+	case strings.Contains(name, "`"):
+		return "", fmt.Errorf("name '%s' cannot contain a backtick", name)
+	case plainAttributePattern.MatchString(name):
+		return name, nil
+	default:
+		return "`" + name + "`", nil
+	}
+}
+
+// isBuilderTime reports whether value is a SINCE or UNTIL time the builder
+// accepts: epoch milliseconds or a relative time.
+func isBuilderTime(value string) bool {
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return millis >= 0
+	}
+	return relativeTimePattern.MatchString(value)
+}
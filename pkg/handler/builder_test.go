@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder models.QueryBuilder
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "count",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}, EventType: "Transaction"},
+			want:    "SELECT count(*) FROM Transaction",
+		},
+		{
+			name: "every clause",
+			builder: models.QueryBuilder{
+				Select: []models.SelectExpression{
+					{Function: "average", Attribute: "duration", Alias: "Avg duration"},
+					{Function: "percentile", Attribute: "duration", Args: []string{"95", "99"}},
+				},
+				EventType:  "Transaction",
+				Where:      []models.AdHocFilter{{Key: "appName", Operator: "=", Value: "checkout"}, {Key: "duration", Operator: ">", Value: "1.5"}},
+				Facet:      []string{"host", "request.uri"},
+				Since:      "3 hours ago",
+				Until:      "1700000000000",
+				Limit:      20,
+				Timeseries: "5 minutes",
+			},
+			want: "SELECT average(duration) AS 'Avg duration', percentile(duration, 95, 99) FROM Transaction " +
+				"WHERE appName = 'checkout' AND duration > 1.5 FACET host, request.uri " +
+				"SINCE 3 hours ago UNTIL 1700000000000 LIMIT 20 TIMESERIES 5 minutes",
+		},
+		{
+			name: "quotes names and values",
+			builder: models.QueryBuilder{
+				Select:     []models.SelectExpression{{Function: "uniqueCount", Attribute: "user id"}},
+				EventType:  "My-Events",
+				Where:      []models.AdHocFilter{{Key: "name", Operator: "=", Value: "x' OR true"}},
+				Facet:      []string{"http status"},
+				Timeseries: "auto",
+			},
+			want: "SELECT uniqueCount(`user id`) FROM `My-Events` WHERE name = 'x\\' OR true' FACET `http status` TIMESERIES AUTO",
+		},
+		{
+			name:    "no aggregation",
+			builder: models.QueryBuilder{EventType: "Transaction"},
+			wantErr: "cannot compile query builder select: at least one aggregation is required",
+		},
+		{
+			name:    "unsupported function",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "drop"}}, EventType: "Transaction"},
+			wantErr: "cannot compile query builder select[0]: unsupported function 'drop'",
+		},
+		{
+			name:    "function without attribute",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}, {Function: "sum"}}, EventType: "Transaction"},
+			wantErr: "cannot compile query builder select[1]: sum requires an attribute",
+		},
+		{
+			name:    "percentile without percentiles",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "percentile", Attribute: "duration"}}, EventType: "Transaction"},
+			wantErr: "percentile requires at least one percentile argument",
+		},
+		{
+			name:    "non-numeric argument",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "percentile", Attribute: "duration", Args: []string{"95) FROM Log"}}}, EventType: "Transaction"},
+			wantErr: "argument '95) FROM Log' is not a number",
+		},
+		{
+			name:    "no event type",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}},
+			wantErr: "cannot compile query builder eventType: name is empty",
+		},
+		{
+			name:    "backtick in facet",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}, EventType: "Transaction", Facet: []string{"a`b"}},
+			wantErr: "cannot compile query builder facet[0]",
+		},
+		{
+			name:    "bad operator",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}, EventType: "Transaction", Where: []models.AdHocFilter{{Key: "a", Operator: "LIKE", Value: "b"}}},
+			wantErr: "cannot compile query builder where[0]: unsupported operator 'LIKE'",
+		},
+		{
+			name:    "free text since",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}, EventType: "Transaction", Since: "1 hour ago LIMIT MAX"},
+			wantErr: "cannot compile query builder since",
+		},
+		{
+			name:    "limit too large",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}, EventType: "Transaction", Limit: MaxPageSize + 1},
+			wantErr: "cannot compile query builder limit",
+		},
+		{
+			name:    "bad bucket",
+			builder: models.QueryBuilder{Select: []models.SelectExpression{{Function: "count"}}, EventType: "Transaction", Timeseries: "5m"},
+			wantErr: "cannot compile query builder timeseries",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CompileQuery(tt.builder)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				var builderErr *BuilderError
+				assert.ErrorAs(t, err, &builderErr)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleQuery_Builder(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+
+	t.Run("compiles the builder query", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{
+			"queryText": "SELECT stale FROM Old",
+			"editorMode": "builder",
+			"ignoreTimeRange": true,
+			"builder": {"select": [{"function": "count"}], "eventType": "Transaction", "where": [{"key": "appName", "operator": "=", "value": "web"}]}
+		}`)}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		assert.Equal(t, "SELECT count(*) FROM Transaction WHERE appName = 'web'", resp.Frames[0].Meta.ExecutedQueryString)
+	})
+
+	t.Run("builder mode without a builder query", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction", "editorMode": "builder"}`)}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "builder mode requires a builder query")
+	})
+
+	t.Run("invalid builder query", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"editorMode": "builder", "builder": {"select": [], "eventType": "Transaction"}}`)}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		var builderErr *BuilderError
+		assert.ErrorAs(t, resp.Error, &builderErr)
+	})
+
+	t.Run("invalid editor mode", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction", "editorMode": "visual"}`)}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid editorMode 'visual'")
+	})
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// niceBuckets are the TIMESERIES buckets chosen for panels, shortest first.
+// Spans needing wider buckets use whole days.
+var niceBuckets = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// nrqlDurationUnits maps the NRQL TIMESERIES bucket units to their length.
+var nrqlDurationUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// followsDashboardRange reports whether the query runs over the dashboard time
+// range: it uses $__timeFilter, or has no SINCE/UNTIL of its own and the range
+// is applied to it. Call it before macros are expanded.
+func followsDashboardRange(query string, ignoreTimeRange bool) bool {
+	if strings.Contains(maskStringLiterals(query), macroTimeFilter) {
+		return true
+	}
+	return !ignoreTimeRange && !containsKeyword(query, "SINCE") && !containsKeyword(query, "UNTIL")
+}
+
+// alignToMaxDataPoints rewrites the TIMESERIES clause of a query over the time
+// range so each series has at most maxDataPoints buckets. A bare, AUTO or MAX
+// TIMESERIES gets the bucket that fits the panel; an explicit bucket is only
+// widened if it yields too many points. Sliding windows and queries without a
+// TIMESERIES clause or time range are left unchanged.
+func alignToMaxDataPoints(query string, timeRange backend.TimeRange, maxDataPoints int64) string {
+	span := timeRange.Duration()
+	if maxDataPoints <= 0 || span <= 0 || containsKeyword(query, "SLIDE") {
+		return query
+	}
+	masked := maskStringLiterals(query)
+	start := topLevelKeyword(masked, "TIMESERIES", 0)
+	if start < 0 {
+		return query
+	}
+	end := clauseEnd(masked, start+len("TIMESERIES"))
+
+	bucket := dataPointsBucket(span, maxDataPoints)
+	switch clause := strings.ToUpper(strings.TrimSpace(query[start+len("TIMESERIES") : end])); clause {
+	case "", "AUTO", "MAX":
+	default:
+		current, ok := parseNRQLDuration(clause)
+		if !ok || current >= bucket {
+			return query
+		}
+	}
+	return joinClause(query[:start], "TIMESERIES "+formatNRQLDuration(bucket), query[end:])
+}
+
+// dataPointsBucket returns the shortest nice bucket that splits span into at
+// most maxDataPoints buckets, and at most maxTimeseriesBuckets.
+func dataPointsBucket(span time.Duration, maxDataPoints int64) time.Duration {
+	points := min(maxDataPoints, maxTimeseriesBuckets)
+	minBucket := (span + time.Duration(points) - 1) / time.Duration(points)
+	for _, bucket := range niceBuckets {
+		if bucket >= minBucket {
+			return bucket
+		}
+	}
+	day := 24 * time.Hour
+	return (minBucket + day - 1) / day * day
+}
+
+// parseNRQLDuration parses a TIMESERIES bucket such as "5 minutes" or "1 hour".
+func parseNRQLDuration(s string) (time.Duration, bool) {
+	parts := strings.Fields(strings.ToLower(s))
+	if len(parts) != 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	unit, ok := nrqlDurationUnits[strings.TrimSuffix(parts[1], "s")]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataPointsBucket(t *testing.T) {
+	tests := []struct {
+		name          string
+		span          time.Duration
+		maxDataPoints int64
+		want          time.Duration
+	}{
+		{name: "exact fit", span: time.Hour, maxDataPoints: 60, want: time.Minute},
+		{name: "rounded up to a nice bucket", span: time.Hour, maxDataPoints: 100, want: time.Minute},
+		{name: "narrow panel", span: 24 * time.Hour, maxDataPoints: 50, want: 30 * time.Minute},
+		{name: "capped at the NRQL bucket limit", span: time.Hour, maxDataPoints: 1000, want: 10 * time.Second},
+		{name: "whole days beyond the nice buckets", span: 365 * 24 * time.Hour, maxDataPoints: 100, want: 4 * 24 * time.Hour},
+		{name: "seconds", span: time.Minute, maxDataPoints: 20, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dataPointsBucket(tt.span, tt.maxDataPoints)
+			assert.Equal(t, tt.want, got)
+			points := int64((tt.span + got - 1) / got)
+			assert.LessOrEqual(t, points, min(tt.maxDataPoints, maxTimeseriesBuckets))
+		})
+	}
+}
+
+func TestAlignToMaxDataPoints(t *testing.T) {
+	from := time.Unix(1700000000, 0)
+	lastDay := backend.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+
+	tests := []struct {
+		name          string
+		query         string
+		timeRange     backend.TimeRange
+		maxDataPoints int64
+		want          string
+	}{
+		{
+			name:          "bare TIMESERIES gets the panel bucket",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES SINCE 1700000000000 UNTIL 1700086400000",
+			timeRange:     lastDay,
+			maxDataPoints: 100,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES 15 minutes SINCE 1700000000000 UNTIL 1700086400000",
+		},
+		{
+			name:          "AUTO at the end of the query",
+			query:         "SELECT count(*) FROM Transaction FACET appName TIMESERIES auto",
+			timeRange:     lastDay,
+			maxDataPoints: 24,
+			want:          "SELECT count(*) FROM Transaction FACET appName TIMESERIES 1 hour",
+		},
+		{
+			name:          "MAX",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES MAX",
+			timeRange:     lastDay,
+			maxDataPoints: 50,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES 30 minutes",
+		},
+		{
+			name:          "explicit bucket with too many points is widened",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES 1 minute LIMIT 5",
+			timeRange:     lastDay,
+			maxDataPoints: 100,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES 15 minutes LIMIT 5",
+		},
+		{
+			name:          "explicit bucket that fits is kept",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES 1 hour",
+			timeRange:     lastDay,
+			maxDataPoints: 100,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES 1 hour",
+		},
+		{
+			name:          "sliding windows are kept",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES 1 minute SLIDE BY 30 seconds",
+			timeRange:     lastDay,
+			maxDataPoints: 100,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES 1 minute SLIDE BY 30 seconds",
+		},
+		{
+			name:          "no TIMESERIES",
+			query:         "SELECT count(*) FROM Transaction WHERE name = 'TIMESERIES'",
+			timeRange:     lastDay,
+			maxDataPoints: 100,
+			want:          "SELECT count(*) FROM Transaction WHERE name = 'TIMESERIES'",
+		},
+		{
+			name:          "no maxDataPoints",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES",
+			timeRange:     lastDay,
+			maxDataPoints: 0,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES",
+		},
+		{
+			name:          "no time range",
+			query:         "SELECT count(*) FROM Transaction TIMESERIES",
+			maxDataPoints: 100,
+			want:          "SELECT count(*) FROM Transaction TIMESERIES",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, alignToMaxDataPoints(tt.query, tt.timeRange, tt.maxDataPoints))
+		})
+	}
+}
+
+func TestFollowsDashboardRange(t *testing.T) {
+	assert.True(t, followsDashboardRange("SELECT count(*) FROM Transaction TIMESERIES", false))
+	assert.False(t, followsDashboardRange("SELECT count(*) FROM Transaction TIMESERIES", true))
+	assert.False(t, followsDashboardRange("SELECT count(*) FROM Transaction SINCE 1 week ago TIMESERIES", false))
+	assert.True(t, followsDashboardRange("SELECT count(*) FROM Transaction $__timeFilter TIMESERIES", true))
+	assert.True(t, followsDashboardRange("SELECT count(*) FROM Transaction WHERE name = 'SINCE' TIMESERIES", false))
+}
+
+func TestParseNRQLDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{in: "5 minutes", want: 5 * time.Minute, ok: true},
+		{in: "1 HOUR", want: time.Hour, ok: true},
+		{in: "2 weeks", want: 14 * 24 * time.Hour, ok: true},
+		{in: "30 seconds", want: 30 * time.Second, ok: true},
+		{in: "5m", ok: false},
+		{in: "0 minutes", ok: false},
+		{in: "5 fortnights", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := parseNRQLDuration(tt.in)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
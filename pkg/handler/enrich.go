@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// entityColumns are the entity metadata columns joined to an entity GUID
+// column, by the suffix of their name.
+var entityColumns = []struct {
+	suffix string
+	value  func(entity entitysearch.Entity) interface{}
+	kind   data.FieldType
+}{
+	{suffix: "name", value: func(e entitysearch.Entity) interface{} { return e.Name }, kind: data.FieldTypeNullableString},
+	{suffix: "type", value: func(e entitysearch.Entity) interface{} { return e.Type }, kind: data.FieldTypeNullableString},
+	{suffix: "accountId", value: func(e entitysearch.Entity) interface{} { return int64(e.AccountID) }, kind: data.FieldTypeNullableInt64},
+	{suffix: "tags", value: func(e entitysearch.Entity) interface{} { return entitysearch.FormatTags(e.Tags) }, kind: data.FieldTypeNullableString},
+}
+
+// enrichEntities joins the name, type, account and tags of entities to the
+// entity GUID columns of resp: string columns whose name ends with guid, such
+// as entityGuid or entity.guid, that hold entity GUIDs. The columns are named
+// after the GUID column without its guid suffix, e.g. entity.name, and placed
+// after it; rows of GUIDs without an entity are null. Entities are looked up
+// once for all the frames of resp. A failed lookup leaves resp unchanged and
+// returns a notice telling why.
+func enrichEntities(ctx context.Context, resp *backend.DataResponse) *data.Notice {
+	type guidColumn struct {
+		frame *data.Frame
+		index int
+	}
+	var columns []guidColumn
+	seen := make(map[string]bool)
+	var guids []string
+	for _, frame := range resp.Frames {
+		for i, field := range frame.Fields {
+			if !isGUIDColumn(field) {
+				continue
+			}
+			columns = append(columns, guidColumn{frame: frame, index: i})
+			for row := 0; row < field.Len(); row++ {
+				if guid := stringAt(field, row); guid != "" && !seen[guid] && entitysearch.IsGUID(guid) {
+					seen[guid] = true
+					guids = append(guids, guid)
+				}
+			}
+		}
+	}
+	if len(guids) == 0 {
+		return nil
+	}
+	sort.Strings(guids)
+
+	lookup := entityLookupFrom(ctx)
+	if lookup == nil {
+		return &data.Notice{Severity: data.NoticeSeverityWarning, Text: "Entities not joined: entity lookups are not available"}
+	}
+	found, err := lookup(ctx, guids)
+	if err != nil {
+		return &data.Notice{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("Entities not joined: %v", err)}
+	}
+
+	// Columns are inserted last to first, so the indexes of earlier ones hold
+	for i := len(columns) - 1; i >= 0; i-- {
+		column := columns[i]
+		guidField := column.frame.Fields[column.index]
+		prefix := entityColumnPrefix(guidField.Name)
+		var joined []*data.Field
+		for _, entityColumn := range entityColumns {
+			name := prefix + "." + entityColumn.suffix
+			if existing, _ := column.frame.FieldByName(name); existing != nil {
+				continue
+			}
+			field := data.NewFieldFromFieldType(entityColumn.kind, guidField.Len())
+			field.Name = name
+			for row := 0; row < guidField.Len(); row++ {
+				if entity, ok := found[stringAt(guidField, row)]; ok {
+					field.SetConcrete(row, entityColumn.value(entity))
+				}
+			}
+			joined = append(joined, field)
+		}
+		fields := append([]*data.Field{}, column.frame.Fields[:column.index+1]...)
+		fields = append(fields, joined...)
+		column.frame.Fields = append(fields, column.frame.Fields[column.index+1:]...)
+	}
+	return nil
+}
+
+// isGUIDColumn reports whether field is a string column named like an entity
+// GUID attribute.
+func isGUIDColumn(field *data.Field) bool {
+	kind := field.Type()
+	return (kind == data.FieldTypeString || kind == data.FieldTypeNullableString) &&
+		strings.HasSuffix(strings.ToLower(field.Name), "guid")
+}
+
+// entityColumnPrefix returns the prefix of the entity columns joined to the
+// GUID column name: the name without its guid suffix, or entity when nothing
+// is left.
+func entityColumnPrefix(name string) string {
+	prefix := strings.TrimRight(name[:len(name)-len("guid")], "._")
+	if prefix == "" {
+		return "entity"
+	}
+	return prefix
+}
+
+// stringAt returns the string at row of a string or nullable string field.
+func stringAt(field *data.Field, row int) string {
+	value, ok := field.ConcreteAt(row)
+	if !ok {
+		return ""
+	}
+	s, _ := value.(string)
+	return s
+}
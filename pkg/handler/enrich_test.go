@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityColumnPrefix(t *testing.T) {
+	assert.Equal(t, "entity", entityColumnPrefix("entityGuid"))
+	assert.Equal(t, "entity", entityColumnPrefix("entity.guid"))
+	assert.Equal(t, "parent.entity", entityColumnPrefix("parent.entityGuid"))
+	assert.Equal(t, "entity", entityColumnPrefix("guid"))
+}
+
+func TestHandleQuery_EnrichEntities(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "name": "GET /cart", "entityGuid": checkoutGUID},
+		{"timestamp": 1700000001000.0, "name": "GET /unknown", "entityGuid": "MXxBUE18QVBQTElDQVRJT058Mg"},
+	}}}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT timestamp, name, entityGuid FROM Span", "enrichEntities": true}`),
+	}
+	ctx := WithEntityLookup(context.Background(), func(ctx context.Context, guids []string) (map[string]entitysearch.Entity, error) {
+		assert.Len(t, guids, 2)
+		return map[string]entitysearch.Entity{checkoutGUID: {
+			Name: "checkout", GUID: checkoutGUID, Type: "APPLICATION", AccountID: 1, Tags: map[string][]string{"team": {"payments"}},
+		}}, nil
+	})
+
+	resp := HandleQuery(ctx, executor, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	var names []string
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Subset(t, names, []string{"entityGuid", "entity.name", "entity.type", "entity.accountId", "entity.tags"})
+
+	row := func(name string, i int) interface{} {
+		field, _ := frame.FieldByName(name)
+		require.NotNil(t, field, name)
+		value, ok := field.ConcreteAt(i)
+		if !ok {
+			return nil
+		}
+		return value
+	}
+	assert.Equal(t, "checkout", row("entity.name", 0))
+	assert.Equal(t, int64(1), row("entity.accountId", 0))
+	assert.Equal(t, "team=payments", row("entity.tags", 0))
+	assert.Nil(t, row("entity.name", 1), "GUIDs without an entity get nulls")
+
+	// Failed lookups leave the table unchanged
+	ctx = WithEntityLookup(context.Background(), func(context.Context, []string) (map[string]entitysearch.Entity, error) {
+		return nil, errors.New("unauthorized")
+	})
+	resp = HandleQuery(ctx, executor, config, query)
+	require.NoError(t, resp.Error)
+	field, _ := resp.Frames[0].FieldByName("entity.name")
+	assert.Nil(t, field)
+	assert.Contains(t, noticeTexts(resp), "Entities not joined: unauthorized")
+}
+
+func TestEnrichEntities_Placement(t *testing.T) {
+	frame := data.NewFrame("",
+		data.NewField("entityGuid", nil, []string{checkoutGUID}),
+		data.NewField("duration", nil, []float64{1}),
+	)
+	ctx := WithEntityLookup(context.Background(), func(context.Context, []string) (map[string]entitysearch.Entity, error) {
+		return map[string]entitysearch.Entity{checkoutGUID: {Name: "checkout"}}, nil
+	})
+	assert.Nil(t, enrichEntities(ctx, &backend.DataResponse{Frames: data.Frames{frame}}))
+	require.Len(t, frame.Fields, 6)
+	assert.Equal(t, "entity.name", frame.Fields[1].Name, "entity columns follow the GUID column")
+	assert.Equal(t, "duration", frame.Fields[5].Name)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// EntitySearcherFunc returns the entity searcher for an account.
+type EntitySearcherFunc func(ctx context.Context, accountID int) (entitysearch.Searcher, error)
+
+// HandleEntitiesQuery processes a Grafana query of type models.QueryTypeEntities.
+// Instead of running NRQL it runs the query text as a NerdGraph entity search,
+// e.g. "type = 'APPLICATION' AND name LIKE 'checkout'", and returns the entities
+// found as a table. The query account selects the API key used for the search.
+func HandleEntitiesQuery(ctx context.Context, searcherFor EntitySearcherFunc, config *models.PluginSettings, query backend.DataQuery) *backend.DataResponse {
+	resp := &backend.DataResponse{}
+	logger := queryLogger(tracing.TraceIDFromContext(ctx))
+
+	qm, _, err := models.ParseQueryModel(query.JSON, config.StrictQueryParsing)
+	if err != nil {
+		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
+		logger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		return resp
+	}
+
+	accountID := config.Secrets.AccountId
+	if qm.AccountID > 0 {
+		accountID = qm.AccountID
+	}
+
+	searcher, err := searcherFor(ctx, accountID)
+	if err != nil {
+		logger.Error("Failed to create New Relic client for entity search", "refId", query.RefID, "accountID", accountID, "error", err)
+		return errorsx.Response(errorsx.Plugin(err))
+	}
+
+	found, err := entitysearch.Search(ctx, searcher, qm.QueryText)
+	if err != nil {
+		var requestErr *entitysearch.RequestError
+		if errors.As(err, &requestErr) {
+			resp.Error = err
+			return resp
+		}
+		logger.Error("Entity search failed", "refId", query.RefID, "accountID", accountID, "kind", errorsx.Classify(err), "error", err)
+		return errorsx.Response(fmt.Errorf("entity search failed: %w", err))
+	}
+
+	logger.Debug("Entity search completed", "refId", query.RefID, "accountID", accountID, "entities", len(found))
+	return &backend.DataResponse{Frames: data.Frames{entitysearch.Frame(found)}}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubEntitySearcher records the search query and finds one entity.
+type stubEntitySearcher struct {
+	query string
+	err   error
+}
+
+func (s *stubEntitySearcher) GetEntitySearchByQueryWithContext(_ context.Context, _ entities.EntitySearchOptions, query string, _ []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error) {
+	s.query = query
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &entities.EntitySearch{Results: entities.EntitySearchResult{Entities: []entities.EntityOutlineInterface{
+		&entities.GenericEntityOutline{Name: "checkout", GUID: "guid-1", Type: "APPLICATION"},
+	}}}, nil
+}
+
+func TestHandleEntitiesQuery(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	query := backend.DataQuery{
+		RefID:     "A",
+		QueryType: models.QueryTypeEntities,
+		JSON:      []byte(`{"accountID": 42, "queryText": "type = 'APPLICATION'"}`),
+	}
+
+	t.Run("searches with the query text", func(t *testing.T) {
+		searcher := &stubEntitySearcher{}
+		var gotAccount int
+		resp := HandleEntitiesQuery(context.Background(), func(_ context.Context, accountID int) (entitysearch.Searcher, error) {
+			gotAccount = accountID
+			return searcher, nil
+		}, config, query)
+
+		require.NoError(t, resp.Error)
+		assert.Equal(t, 42, gotAccount)
+		assert.Equal(t, "type = 'APPLICATION'", searcher.query)
+		require.Len(t, resp.Frames, 1)
+		assert.Equal(t, entitysearch.FrameName, resp.Frames[0].Name)
+		assert.Equal(t, 1, resp.Frames[0].Rows())
+	})
+
+	t.Run("empty query text", func(t *testing.T) {
+		empty := query
+		empty.JSON = []byte(`{"queryText": ""}`)
+		resp := HandleEntitiesQuery(context.Background(), func(context.Context, int) (entitysearch.Searcher, error) {
+			return &stubEntitySearcher{}, nil
+		}, config, empty)
+
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "entity search query is required")
+	})
+
+	t.Run("search error", func(t *testing.T) {
+		resp := HandleEntitiesQuery(context.Background(), func(context.Context, int) (entitysearch.Searcher, error) {
+			return &stubEntitySearcher{err: errors.New("forbidden")}, nil
+		}, config, query)
+
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "entity search failed")
+	})
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// EntityLookupFunc returns the entities of GUIDs, by GUID. GUIDs of entities
+// that are not found are left out.
+type EntityLookupFunc func(ctx context.Context, guids []string) (map[string]entitysearch.Entity, error)
+
+type entityLookupKey struct{}
+
+// WithEntityLookup returns a context whose queries look entities up with lookup,
+// to show entity names in place of entity GUIDs.
+func WithEntityLookup(ctx context.Context, lookup EntityLookupFunc) context.Context {
+	return context.WithValue(ctx, entityLookupKey{}, lookup)
+}
+
+// entityLookupFrom returns the entity lookup of ctx, or nil if it has none.
+func entityLookupFrom(ctx context.Context) EntityLookupFunc {
+	lookup, _ := ctx.Value(entityLookupKey{}).(EntityLookupFunc)
+	return lookup
+}
+
+// facetLabelMappings returns the display names of the facet values of resp: the
+// query's facetLabelMappings and, with resolveEntityNames, the names of the
+// entities whose GUIDs are facet values. Mappings of the query take precedence.
+// Entities that cannot be looked up keep their GUIDs, with a notice telling why.
+func facetLabelMappings(ctx context.Context, resp *backend.DataResponse, qm models.QueryModel) (map[string]string, *data.Notice) {
+	if !qm.ResolveEntityNames {
+		return qm.FacetLabelMappings, nil
+	}
+	var guids []string
+	for _, value := range formatter.FacetLabelValues(resp) {
+		if _, mapped := qm.FacetLabelMappings[value]; !mapped && entitysearch.IsGUID(value) {
+			guids = append(guids, value)
+		}
+	}
+	if len(guids) == 0 {
+		return qm.FacetLabelMappings, nil
+	}
+	lookup := entityLookupFrom(ctx)
+	if lookup == nil {
+		return qm.FacetLabelMappings, &data.Notice{Severity: data.NoticeSeverityWarning, Text: "Entity names not resolved: entity lookups are not available"}
+	}
+	found, err := lookup(ctx, guids)
+	if err != nil {
+		return qm.FacetLabelMappings, &data.Notice{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("Entity names not resolved: %v", err)}
+	}
+
+	mappings := make(map[string]string, len(found)+len(qm.FacetLabelMappings))
+	for guid, entity := range found {
+		if entity.Name != "" {
+			mappings[guid] = entity.Name
+		}
+	}
+	for value, name := range qm.FacetLabelMappings {
+		mappings[value] = name
+	}
+	return mappings, nil
+}
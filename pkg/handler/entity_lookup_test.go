@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checkoutGUID = "MXxBUE18QVBQTElDQVRJT058MQ"
+
+func TestHandleQuery_FacetLabels(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	executor := &routingNRDBExecutor{multiResults: &nrdb.NRDBResultContainerMultiResultCustomized{
+		Results: []nrdb.NRDBResult{
+			{"facet": checkoutGUID, "entityGuid": checkoutGUID, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0, "count": 1.0},
+			{"facet": "other", "entityGuid": "other", "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0, "count": 2.0},
+		},
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"entityGuid"}},
+	}}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Span FACET entityGuid TIMESERIES", "resolveEntityNames": true, "facetLabelMappings": {"other": "Other services"}}`),
+	}
+	labels := func(resp *backend.DataResponse) []string {
+		var values []string
+		for _, frame := range resp.Frames {
+			for _, field := range frame.Fields {
+				if value, ok := field.Labels["entityGuid"]; ok {
+					values = append(values, value)
+				}
+			}
+		}
+		return values
+	}
+
+	var looked []string
+	ctx := WithEntityLookup(context.Background(), func(ctx context.Context, guids []string) (map[string]entitysearch.Entity, error) {
+		looked = guids
+		return map[string]entitysearch.Entity{checkoutGUID: {Name: "checkout", GUID: checkoutGUID}}, nil
+	})
+	resp := HandleQuery(ctx, executor, config, query)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, []string{checkoutGUID}, looked, "only GUIDs are looked up")
+	assert.ElementsMatch(t, []string{"checkout", "Other services"}, labels(resp))
+
+	// Failed lookups keep the GUIDs
+	ctx = WithEntityLookup(context.Background(), func(context.Context, []string) (map[string]entitysearch.Entity, error) {
+		return nil, errors.New("unauthorized")
+	})
+	resp = HandleQuery(ctx, executor, config, query)
+	require.NoError(t, resp.Error)
+	assert.ElementsMatch(t, []string{checkoutGUID, "Other services"}, labels(resp))
+	assert.Contains(t, noticeTexts(resp), "Entity names not resolved: unauthorized")
+}
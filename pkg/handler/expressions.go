@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// MaxExpressions is the most fields a query derives with expressions.
+const MaxExpressions = 10
+
+// validateExpressions checks the expressions of the query refID: each needs a
+// name no other expression has and must parse.
+func validateExpressions(expressions []models.FieldExpression, refID string) error {
+	if len(expressions) > MaxExpressions {
+		return fmt.Errorf("too many expressions: %d, at most %d are allowed", len(expressions), MaxExpressions)
+	}
+	names := make(map[string]bool, len(expressions))
+	for i, expr := range expressions {
+		if expr.Name == "" {
+			return fmt.Errorf("expression %d has no name", i+1)
+		}
+		if names[expr.Name] {
+			return fmt.Errorf("duplicate expression name '%s'", expr.Name)
+		}
+		names[expr.Name] = true
+		if _, err := formatter.ParseExpression(expr.Expr, refID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateExpressions(t *testing.T) {
+	assert.NoError(t, validateExpressions(nil, "A"))
+	assert.NoError(t, validateExpressions([]models.FieldExpression{{Name: "ratio", Expr: "$A.a / $A.b"}}, "A"))
+	assert.Error(t, validateExpressions([]models.FieldExpression{{Expr: "$A.a"}}, "A"), "missing name")
+	assert.Error(t, validateExpressions([]models.FieldExpression{{Name: "x", Expr: "$A.a"}, {Name: "x", Expr: "$A.b"}}, "A"), "duplicate name")
+	assert.Error(t, validateExpressions([]models.FieldExpression{{Name: "x", Expr: "$B.a"}}, "A"), "another query")
+	assert.Error(t, validateExpressions(make([]models.FieldExpression, MaxExpressions+1), "A"))
+}
+
+func TestHandleQuery_Expressions(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"errors": 5.0, "total": 200.0}},
+	}}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT filter(count(*), WHERE error IS true) AS 'errors', count(*) AS 'total' FROM Transaction", "expressions": [{"name": "error %", "expr": "($A.errors / $A.total) * 100"}]}`),
+	}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+	var found bool
+	for _, field := range resp.Frames[0].Fields {
+		if field.Name == "error %" {
+			found = true
+			value, ok := field.ConcreteAt(0)
+			assert.True(t, ok)
+			assert.Equal(t, 2.5, value)
+		}
+	}
+	assert.True(t, found, "the derived field is added")
+
+	query.JSON = []byte(`{"queryText": "SELECT count(*) FROM Transaction", "expressions": [{"name": "x", "expr": "$A.count *"}]}`)
+	resp = HandleQuery(context.Background(), executor, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "invalid expression")
+}
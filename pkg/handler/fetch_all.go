@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// DefaultNRQLLimit is the number of rows NRQL returns for event queries without a LIMIT clause.
+const DefaultNRQLLimit = 100
+
+// isRowQuery reports whether the query returns event rows rather than facets or
+// time buckets, and does not choose its own row limit.
+func isRowQuery(query string) bool {
+	for _, keyword := range []string{"FACET", "TIMESERIES", "COMPARE", "LIMIT", "OFFSET"} {
+		if containsKeyword(query, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// shouldFetchAllPages reports whether the query's rows are fetched page by page
+// up to maxRows, rather than stopping at the NRQL default limit.
+func shouldFetchAllPages(query string, qm models.QueryModel, maxRows int) bool {
+	return maxRows > 0 && qm.PageSize == 0 &&
+		!useEnhancedQueryForMode(query, qm.ResultMode) && isRowQuery(query)
+}
+
+// fetchAllPages runs the query with LIMIT/OFFSET pages of at most MaxPageSize rows
+// until a page comes back short or maxRows rows were fetched, and concatenates the
+// pages into one result. truncated reports that more rows may exist beyond maxRows.
+// NerdGraph does not return a cursor for NRQL results, so pages are addressed by offset.
+// The pages are not modified, since they may be cached.
+func fetchAllPages(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, query string, maxRows int) (results *nrdb.NRDBResultContainer, truncated bool, err error) {
+	for offset := 0; offset < maxRows; {
+		limit := min(MaxPageSize, maxRows-offset)
+		page, err := ExecuteNRQLQueryWithMode(ctx, executor, accountID, fmt.Sprintf("%s LIMIT %d OFFSET %d", query, limit, offset), models.ResultModeStandard)
+		if err != nil {
+			if offset > 0 {
+				return nil, false, fmt.Errorf("fetching rows from offset %d: %w", offset, err)
+			}
+			return nil, false, err
+		}
+
+		container, ok := page.(*nrdb.NRDBResultContainer)
+		if !ok || container == nil {
+			return nil, false, fmt.Errorf("unexpected result type %T", page)
+		}
+		if results == nil {
+			merged := *container
+			merged.Results = slices.Clone(container.Results)
+			merged.Metadata.Messages = slices.Clone(container.Metadata.Messages)
+			results = &merged
+		} else {
+			results.Results = append(results.Results, container.Results...)
+		}
+
+		if len(container.Results) < limit {
+			return results, false, nil
+		}
+		offset += limit
+	}
+	return results, true, nil
+}
+
+// rowLimitNotice returns a notice when the rows of a row query were cut off: by
+// maxRows when the query was paged, or by the NRQL default limit otherwise.
+func rowLimitNotice(query string, qm models.QueryModel, rows, maxRows int, paged, truncated bool) (data.Notice, bool) {
+	if paged {
+		if !truncated {
+			return data.Notice{}, false
+		}
+		return data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Showing the first %d rows; more rows are available. Raise maxRows in the datasource settings to fetch more", maxRows),
+		}, true
+	}
+
+	if qm.PageSize > 0 || rows != DefaultNRQLLimit || useEnhancedQueryForMode(query, qm.ResultMode) || !isRowQuery(query) {
+		return data.Notice{}, false
+	}
+	return data.Notice{
+		Severity: data.NoticeSeverityInfo,
+		Text:     fmt.Sprintf("New Relic returned its default limit of %d rows; add a LIMIT clause or set maxRows in the datasource settings to fetch more", DefaultNRQLLimit),
+	}, true
+}
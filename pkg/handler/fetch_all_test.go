@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedExecutor serves totalRows rows according to the LIMIT/OFFSET in each query.
+type pagedExecutor struct {
+	totalRows int
+	failAt    int // Offset at which queries fail, -1 for never
+	queries   []string
+}
+
+func (e *pagedExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.queries = append(e.queries, string(query))
+
+	limit, offset := DefaultNRQLLimit, 0
+	_, _ = fmt.Sscanf(lastClauses(string(query)), "LIMIT %d OFFSET %d", &limit, &offset)
+	if offset == e.failAt {
+		return nil, errors.New("boom")
+	}
+
+	results := &nrdb.NRDBResultContainer{}
+	for i := offset; i < min(offset+limit, e.totalRows); i++ {
+		results.Results = append(results.Results, nrdb.NRDBResult{"timestamp": float64(1700000000000 + i), "row": float64(i)})
+	}
+	return results, nil
+}
+
+func (e *pagedExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, errors.New("not supported")
+}
+
+// lastClauses returns the trailing "LIMIT n OFFSET m" part of a query, if any.
+func lastClauses(query string) string {
+	idx := findKeyword(query, "LIMIT")
+	if idx < 0 {
+		return ""
+	}
+	return query[idx:]
+}
+
+func TestFetchAllPages(t *testing.T) {
+	tests := []struct {
+		name          string
+		totalRows     int
+		maxRows       int
+		wantRows      int
+		wantTruncated bool
+		wantQueries   []string
+	}{
+		{
+			name:        "single short page",
+			totalRows:   10,
+			maxRows:     20000,
+			wantRows:    10,
+			wantQueries: []string{"SELECT * FROM Log LIMIT 5000 OFFSET 0"},
+		},
+		{
+			name:      "several pages",
+			totalRows: 12000,
+			maxRows:   20000,
+			wantRows:  12000,
+			wantQueries: []string{
+				"SELECT * FROM Log LIMIT 5000 OFFSET 0",
+				"SELECT * FROM Log LIMIT 5000 OFFSET 5000",
+				"SELECT * FROM Log LIMIT 5000 OFFSET 10000",
+			},
+		},
+		{
+			name:          "stops at maxRows",
+			totalRows:     12000,
+			maxRows:       7000,
+			wantRows:      7000,
+			wantTruncated: true,
+			wantQueries: []string{
+				"SELECT * FROM Log LIMIT 5000 OFFSET 0",
+				"SELECT * FROM Log LIMIT 2000 OFFSET 5000",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &pagedExecutor{totalRows: tt.totalRows, failAt: -1}
+			results, truncated, err := fetchAllPages(context.Background(), executor, 1, "SELECT * FROM Log", tt.maxRows)
+			require.NoError(t, err)
+			assert.Len(t, results.Results, tt.wantRows)
+			assert.Equal(t, tt.wantTruncated, truncated)
+			assert.Equal(t, tt.wantQueries, executor.queries)
+		})
+	}
+}
+
+func TestFetchAllPages_Error(t *testing.T) {
+	executor := &pagedExecutor{totalRows: 12000, failAt: 5000}
+	_, _, err := fetchAllPages(context.Background(), executor, 1, "SELECT * FROM Log", 20000)
+	assert.EqualError(t, err, "fetching rows from offset 5000: boom")
+}
+
+func TestFetchAllPages_CachedPages(t *testing.T) {
+	executor := &pagedExecutor{totalRows: 7000, failAt: -1}
+	caching := &cache.CachingExecutor{Executor: executor, Cache: cache.New(), Policy: &cache.Policy{TTL: time.Minute, Bucket: time.Minute}}
+
+	for run := 1; run <= 2; run++ {
+		results, truncated, err := fetchAllPages(context.Background(), caching, 1, "SELECT * FROM Log", 20000)
+		require.NoError(t, err)
+		assert.False(t, truncated)
+		assert.Len(t, results.Results, 7000, "run %d", run)
+	}
+	assert.Len(t, executor.queries, 2, "the second run is served from the cache")
+}
+
+func TestShouldFetchAllPages(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		qm      models.QueryModel
+		maxRows int
+		want    bool
+	}{
+		{name: "event query", query: "SELECT * FROM Log", maxRows: 1000, want: true},
+		{name: "disabled", query: "SELECT * FROM Log", want: false},
+		{name: "explicit limit", query: "SELECT * FROM Log LIMIT 10", maxRows: 1000, want: false},
+		{name: "faceted", query: "SELECT count(*) FROM Log FACET level", maxRows: 1000, want: false},
+		{name: "timeseries", query: "SELECT count(*) FROM Log TIMESERIES", maxRows: 1000, want: false},
+		{name: "page requested", query: "SELECT * FROM Log", qm: models.QueryModel{PageSize: 10}, maxRows: 1000, want: false},
+		{name: "multi result mode", query: "SELECT * FROM Log", qm: models.QueryModel{ResultMode: models.ResultModeMulti}, maxRows: 1000, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, shouldFetchAllPages(tt.query, tt.qm, tt.maxRows))
+		})
+	}
+}
+
+// TestHandleQuery_MaxRows verifies paging through HandleQuery and the row limit notices.
+func TestHandleQuery_MaxRows(t *testing.T) {
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT * FROM Log"}`)}
+
+	t.Run("paged and truncated", func(t *testing.T) {
+		config := &models.PluginSettings{MaxRows: 6000, Secrets: &models.SecretPluginSettings{AccountId: 1}}
+		executor := &pagedExecutor{totalRows: 8000, failAt: -1}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		assert.Equal(t, 6000, resp.Frames[0].Rows())
+		require.NotNil(t, resp.Frames[0].Meta)
+		require.Len(t, resp.Frames[0].Meta.Notices, 1)
+		assert.Equal(t, data.NoticeSeverityWarning, resp.Frames[0].Meta.Notices[0].Severity)
+		assert.Contains(t, resp.Frames[0].Meta.Notices[0].Text, "Showing the first 6000 rows")
+	})
+
+	t.Run("default limit reached", func(t *testing.T) {
+		config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+		executor := &pagedExecutor{totalRows: 8000, failAt: -1}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		assert.Equal(t, []string{"SELECT * FROM Log"}, executor.queries)
+		require.NotNil(t, resp.Frames[0].Meta)
+		require.Len(t, resp.Frames[0].Meta.Notices, 1)
+		assert.Contains(t, resp.Frames[0].Meta.Notices[0].Text, "default limit of 100 rows")
+	})
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// plainAttributePattern matches attribute names that need no backtick quoting.
+var plainAttributePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// whereClauseEndKeywords are the clauses that can follow a WHERE clause.
+var whereClauseEndKeywords = []string{
+	"FACET", "SINCE", "UNTIL", "TIMESERIES", "LIMIT", "OFFSET", "COMPARE",
+	"ORDER", "EXTRAPOLATE", "WITH", "SLIDE", "PREDICT",
+}
+
+// FilterError represents an ad-hoc filter that cannot be applied to a query.
+type FilterError struct {
+	Key string
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("cannot apply ad-hoc filter on '%s': %s", e.Key, e.Msg)
+}
+
+// applyFilters adds the ad-hoc filters to the query's WHERE clause, joined with
+// AND. An existing condition is parenthesized so that an OR in it cannot bypass
+// the filters. Queries without a FROM clause, such as SHOW EVENT TYPES, are
+// returned unchanged.
+func applyFilters(query string, filters []models.AdHocFilter) (string, error) {
+	if len(filters) == 0 {
+		return query, nil
+	}
+	conditions := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		condition, err := filterCondition(filter)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, condition)
+	}
+	filterClause := strings.Join(conditions, " AND ")
+
+	masked := maskStringLiterals(query)
+	from := topLevelKeyword(masked, "FROM", 0)
+	if from < 0 {
+		return query, nil
+	}
+
+	where := topLevelKeyword(masked, "WHERE", from)
+	if where < 0 {
+		// Add the WHERE clause right after the FROM clause
+		end := clauseEnd(masked, from+len("FROM"))
+		return joinClause(query[:end], "WHERE "+filterClause, query[end:]), nil
+	}
+
+	start := where + len("WHERE")
+	end := clauseEnd(masked, start)
+	condition := strings.TrimSpace(query[start:end])
+	return joinClause(query[:where], fmt.Sprintf("WHERE (%s) AND %s", condition, filterClause), query[end:]), nil
+}
+
+// joinClause inserts clause between before and after, separated by single spaces.
+func joinClause(before, clause, after string) string {
+	before = strings.TrimRight(before, " \t")
+	after = strings.TrimLeft(after, " \t")
+	if after == "" {
+		return before + " " + clause
+	}
+	return before + " " + clause + " " + after
+}
+
+// clauseEnd returns the offset in the masked query at which the clause starting
+// at start ends: the next top-level clause keyword, or the end of the query.
+func clauseEnd(masked string, start int) int {
+	end := len(masked)
+	for _, keyword := range whereClauseEndKeywords {
+		if idx := topLevelKeyword(masked, keyword, start); idx >= 0 && idx < end {
+			end = idx
+		}
+	}
+	return end
+}
+
+// topLevelKeyword returns the offset of the first occurrence of keyword at or
+// after start in the masked query that is a standalone word outside of
+// parentheses, e.g. not the WHERE of filter(count(*), WHERE ...), or -1.
+func topLevelKeyword(masked string, keyword string, start int) int {
+	upper := strings.ToUpper(masked)
+	depth := 0
+	for i := 0; i < len(upper); i++ {
+		switch upper[i] {
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+		if i < start || depth != 0 || !strings.HasPrefix(upper[i:], keyword) {
+			continue
+		}
+		end := i + len(keyword)
+		if (i == 0 || !isIdentifierChar(upper[i-1])) && (end == len(upper) || !isIdentifierChar(upper[end])) {
+			return i
+		}
+	}
+	return -1
+}
+
+// filterCondition returns the NRQL condition for an ad-hoc filter.
+func filterCondition(filter models.AdHocFilter) (string, error) {
+	attribute, err := quoteAttribute(filter.Key)
+	if err != nil {
+		return "", err
+	}
+
+	switch filter.Operator {
+	case "=", "!=":
+		return fmt.Sprintf("%s %s %s", attribute, filter.Operator, quoteString(filter.Value)), nil
+	case "<", ">", "<=", ">=":
+		if _, err := strconv.ParseFloat(filter.Value, 64); err != nil {
+			return "", &FilterError{Key: filter.Key, Msg: fmt.Sprintf("operator %s requires a number, got '%s'", filter.Operator, filter.Value)}
+		}
+		return fmt.Sprintf("%s %s %s", attribute, filter.Operator, filter.Value), nil
+	case "=~":
+		return fmt.Sprintf("%s RLIKE %s", attribute, quoteString(filter.Value)), nil
+	case "!~":
+		return fmt.Sprintf("%s NOT RLIKE %s", attribute, quoteString(filter.Value)), nil
+	case "=|", "!=|":
+		values := filter.Values
+		if len(values) == 0 {
+			values = []string{filter.Value}
+		}
+		quoted := make([]string, len(values))
+		for i, value := range values {
+			quoted[i] = quoteString(value)
+		}
+		operator := "IN"
+		if filter.Operator == "!=|" {
+			operator = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (%s)", attribute, operator, strings.Join(quoted, ", ")), nil
+	default:
+		return "", &FilterError{Key: filter.Key, Msg: fmt.Sprintf("unsupported operator '%s'", filter.Operator)}
+	}
+}
+
+// quoteAttribute returns the attribute name for use in NRQL, backtick-quoted
+// unless it is a plain identifier.
+func quoteAttribute(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", &FilterError{Key: name, Msg: "key is empty"}
+	case strings.Contains(name, "`"):
+		return "", &FilterError{Key: name, Msg: "key cannot contain a backtick"}
+	case plainAttributePattern.MatchString(name):
+		return name, nil
+	default:
+		return "`" + name + "`", nil
+	}
+}
+
+// quoteString returns value as a single-quoted NRQL string literal, escaping
+// backslashes and single quotes.
+func quoteString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyFilters(t *testing.T) {
+	appName := models.AdHocFilter{Key: "appName", Operator: "=", Value: "checkout"}
+
+	tests := []struct {
+		name    string
+		query   string
+		filters []models.AdHocFilter
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "no filters",
+			query: "SELECT count(*) FROM Transaction",
+			want:  "SELECT count(*) FROM Transaction",
+		},
+		{
+			name:    "adds a WHERE clause",
+			query:   "SELECT count(*) FROM Transaction",
+			filters: []models.AdHocFilter{appName},
+			want:    "SELECT count(*) FROM Transaction WHERE appName = 'checkout'",
+		},
+		{
+			name:    "adds a WHERE clause before other clauses",
+			query:   "SELECT count(*) FROM Transaction FACET host SINCE 1 hour ago",
+			filters: []models.AdHocFilter{appName},
+			want:    "SELECT count(*) FROM Transaction WHERE appName = 'checkout' FACET host SINCE 1 hour ago",
+		},
+		{
+			name:    "extends an existing WHERE clause",
+			query:   "SELECT count(*) FROM Transaction WHERE error IS TRUE OR duration > 1 TIMESERIES",
+			filters: []models.AdHocFilter{appName, {Key: "host", Operator: "!=", Value: "web-1"}},
+			want:    "SELECT count(*) FROM Transaction WHERE (error IS TRUE OR duration > 1) AND appName = 'checkout' AND host != 'web-1' TIMESERIES",
+		},
+		{
+			name:    "ignores WHERE in filter() and string literals",
+			query:   "SELECT filter(count(*), WHERE error IS TRUE) FROM Transaction WHERE name = 'FACET SINCE'",
+			filters: []models.AdHocFilter{appName},
+			want:    "SELECT filter(count(*), WHERE error IS TRUE) FROM Transaction WHERE (name = 'FACET SINCE') AND appName = 'checkout'",
+		},
+		{
+			name:    "escapes string values",
+			query:   "SELECT * FROM Log",
+			filters: []models.AdHocFilter{{Key: "message", Operator: "=", Value: `it's a \ test`}},
+			want:    `SELECT * FROM Log WHERE message = 'it\'s a \\ test'`,
+		},
+		{
+			name:    "quotes unusual attribute names",
+			query:   "SELECT * FROM Log",
+			filters: []models.AdHocFilter{{Key: "k8s-pod name", Operator: "=~", Value: "web-.*"}},
+			want:    "SELECT * FROM Log WHERE `k8s-pod name` RLIKE 'web-.*'",
+		},
+		{
+			name:  "numeric and multi-value operators",
+			query: "SELECT * FROM Transaction",
+			filters: []models.AdHocFilter{
+				{Key: "duration", Operator: ">", Value: "0.5"},
+				{Key: "host", Operator: "=|", Values: []string{"web-1", "web-2"}},
+				{Key: "name", Operator: "!~", Value: "health"},
+				{Key: "region", Operator: "!=|", Value: "eu"},
+			},
+			want: "SELECT * FROM Transaction WHERE duration > 0.5 AND host IN ('web-1', 'web-2') AND name NOT RLIKE 'health' AND region NOT IN ('eu')",
+		},
+		{
+			name:    "query without FROM",
+			query:   "SHOW EVENT TYPES",
+			filters: []models.AdHocFilter{appName},
+			want:    "SHOW EVENT TYPES",
+		},
+		{
+			name:    "non-numeric comparison",
+			query:   "SELECT * FROM Transaction",
+			filters: []models.AdHocFilter{{Key: "duration", Operator: "<", Value: "1; DROP"}},
+			wantErr: "cannot apply ad-hoc filter on 'duration': operator < requires a number",
+		},
+		{
+			name:    "unsupported operator",
+			query:   "SELECT * FROM Transaction",
+			filters: []models.AdHocFilter{{Key: "host", Operator: "LIKE", Value: "web"}},
+			wantErr: "unsupported operator 'LIKE'",
+		},
+		{
+			name:    "backtick in key",
+			query:   "SELECT * FROM Transaction",
+			filters: []models.AdHocFilter{{Key: "a` OR true", Operator: "=", Value: "x"}},
+			wantErr: "key cannot contain a backtick",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyFilters(tt.query, tt.filters)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleQuery_Filters(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": 1.0}}}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{
+		"queryText": "SELECT count(*) FROM Transaction",
+		"filters": [{"key": "appName", "operator": "=", "value": "checkout"}]
+	}`)}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+	assert.Equal(t, "SELECT count(*) FROM Transaction WHERE appName = 'checkout'", resp.Frames[0].Meta.ExecutedQueryString)
+}
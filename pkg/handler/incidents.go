@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/incidents"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// IncidentsQuerierFunc returns the NerdGraph querier for an account.
+type IncidentsQuerierFunc func(ctx context.Context, accountID int) (incidents.Querier, error)
+
+// HandleIncidentsQuery processes a Grafana query of type models.QueryTypeIncidents.
+// Instead of running NRQL it fetches the New Relic issues of the query account
+// that were open during the query time range, optionally limited to the query's
+// incident states, and returns them as a table and as annotations.
+func HandleIncidentsQuery(ctx context.Context, querierFor IncidentsQuerierFunc, config *models.PluginSettings, query backend.DataQuery) *backend.DataResponse {
+	resp := &backend.DataResponse{}
+	logger := queryLogger(tracing.TraceIDFromContext(ctx))
+
+	qm, _, err := models.ParseQueryModel(query.JSON, config.StrictQueryParsing)
+	if err != nil {
+		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
+		logger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		return resp
+	}
+
+	accountID := config.Secrets.AccountId
+	if qm.AccountID > 0 {
+		accountID = qm.AccountID
+	}
+
+	querier, err := querierFor(ctx, accountID)
+	if err != nil {
+		logger.Error("Failed to create New Relic client for incidents", "refId", query.RefID, "accountID", accountID, "error", err)
+		return errorsx.Response(errorsx.Plugin(err))
+	}
+
+	issues, err := incidents.Fetch(ctx, querier, accountID, query.TimeRange.From, query.TimeRange.To, qm.IncidentStates)
+	if err != nil {
+		var requestErr *incidents.RequestError
+		if errors.As(err, &requestErr) {
+			resp.Error = err
+			return resp
+		}
+		logger.Error("Incidents query failed", "refId", query.RefID, "accountID", accountID, "kind", errorsx.Classify(err), "error", err)
+		return errorsx.Response(fmt.Errorf("incidents query failed: %w", err))
+	}
+
+	logger.Debug("Incidents query completed", "refId", query.RefID, "accountID", accountID, "issues", len(issues))
+	return incidents.Response(issues)
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/incidents"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIncidentsQuerier answers every NerdGraph query with no issues.
+type stubIncidentsQuerier struct {
+	accountID interface{}
+}
+
+func (s *stubIncidentsQuerier) QueryWithResponseAndContext(_ context.Context, _ string, variables map[string]interface{}, _ interface{}) error {
+	s.accountID = variables["accountId"]
+	return nil
+}
+
+func TestHandleIncidentsQuery(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	now := time.Now()
+	query := backend.DataQuery{
+		RefID:     "A",
+		QueryType: models.QueryTypeIncidents,
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		JSON:      []byte(`{"accountID": 42, "incidentStates": ["ACTIVATED"]}`),
+	}
+
+	t.Run("fetches issues of the query account", func(t *testing.T) {
+		querier := &stubIncidentsQuerier{}
+		var gotAccount int
+		resp := HandleIncidentsQuery(context.Background(), func(_ context.Context, accountID int) (incidents.Querier, error) {
+			gotAccount = accountID
+			return querier, nil
+		}, config, query)
+
+		require.NoError(t, resp.Error)
+		assert.Equal(t, 42, gotAccount)
+		assert.Equal(t, 42, querier.accountID)
+		require.Len(t, resp.Frames, 2)
+		assert.Equal(t, incidents.TableFrameName, resp.Frames[0].Name)
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		invalid := query
+		invalid.JSON = []byte(`{"incidentStates": ["OPEN"]}`)
+		resp := HandleIncidentsQuery(context.Background(), func(context.Context, int) (incidents.Querier, error) {
+			return &stubIncidentsQuerier{}, nil
+		}, config, invalid)
+
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid incident state 'OPEN'")
+	})
+
+	t.Run("client error is a plugin error", func(t *testing.T) {
+		resp := HandleIncidentsQuery(context.Background(), func(context.Context, int) (incidents.Querier, error) {
+			return nil, errors.New("no client")
+		}, config, query)
+
+		require.Error(t, resp.Error)
+		assert.Equal(t, backend.ErrorSourcePlugin, resp.ErrorSource)
+	})
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// validateLimits checks the series and row limits a query overrides.
+func validateLimits(qm models.QueryModel) error {
+	if qm.MaxSeries < 0 {
+		return fmt.Errorf("invalid maxSeries %d: must not be negative", qm.MaxSeries)
+	}
+	if qm.MaxFrameRows < 0 {
+		return fmt.Errorf("invalid maxFrameRows %d: must not be negative", qm.MaxFrameRows)
+	}
+	return nil
+}
+
+// frameLimits returns how many series a query's response and how many rows each
+// of its frames may hold: the query's own limits if it sets them, otherwise the
+// datasource limits. A zero row limit means no limit.
+func frameLimits(qm models.QueryModel, config *models.PluginSettings) (maxSeries, maxRows int) {
+	maxSeries, maxRows = config.MaxSeries, config.MaxFrameRows
+	if maxSeries == 0 {
+		maxSeries = formatter.DefaultMaxSeries
+	}
+	if qm.MaxSeries > 0 {
+		maxSeries = qm.MaxSeries
+	}
+	if qm.MaxFrameRows > 0 {
+		maxRows = qm.MaxFrameRows
+	}
+	return maxSeries, maxRows
+}
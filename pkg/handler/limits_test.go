@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		qm         models.QueryModel
+		config     models.PluginSettings
+		wantSeries int
+		wantRows   int
+	}{
+		{name: "defaults", wantSeries: formatter.DefaultMaxSeries},
+		{name: "datasource limits", config: models.PluginSettings{MaxSeries: 50, MaxFrameRows: 100}, wantSeries: 50, wantRows: 100},
+		{
+			name:       "query overrides",
+			qm:         models.QueryModel{MaxSeries: 5, MaxFrameRows: 10},
+			config:     models.PluginSettings{MaxSeries: 50, MaxFrameRows: 100},
+			wantSeries: 5,
+			wantRows:   10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxSeries, maxRows := frameLimits(tt.qm, &tt.config)
+			assert.Equal(t, tt.wantSeries, maxSeries)
+			assert.Equal(t, tt.wantRows, maxRows)
+		})
+	}
+}
+
+func TestHandleQuery_Limits(t *testing.T) {
+	var rows []nrdb.NRDBResult
+	for _, app := range []string{"web", "api", "worker"} {
+		for _, begin := range []float64{1700000000, 1700000060} {
+			rows = append(rows, nrdb.NRDBResult{"facet": app, "count": 1.0, "beginTimeSeconds": begin, "endTimeSeconds": begin + 60})
+		}
+	}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{
+		Results:  rows,
+		Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+	}}
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}, MaxSeries: 2}
+
+	t.Run("datasource series limit", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName TIMESERIES", "resultMode": "standard"}`)}
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 2)
+		assert.Contains(t, noticeTexts(resp), "Showing first 2 of 3 series; narrow the FACET or raise maxSeries to see more")
+	})
+
+	t.Run("query override", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName TIMESERIES", "resultMode": "standard", "maxSeries": 5}`)}
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		assert.Len(t, resp.Frames, 3)
+	})
+
+	t.Run("negative limit", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction", "maxFrameRows": -1}`)}
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid maxFrameRows -1")
+	})
+}
+
+// noticeTexts returns the text of every notice of the first frame of resp.
+func noticeTexts(resp *backend.DataResponse) []string {
+	var texts []string
+	if len(resp.Frames) == 0 || resp.Frames[0].Meta == nil {
+		return nil
+	}
+	for _, notice := range resp.Frames[0].Meta.Notices {
+		texts = append(texts, notice.Text)
+	}
+	return texts
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/timeutil"
+)
+
+// largeLimit is the LIMIT above which a query without SINCE is flagged.
+const largeLimit = 1000
+
+// Lint rules reported in LintIssue.Rule
+const (
+	LintSelectStar       = "selectStar"       // SELECT * without LIMIT
+	LintUnboundedLimit   = "unboundedLimit"   // Large LIMIT without SINCE
+	LintFacetCardinality = "facetCardinality" // FACET on a function or attribute with a value per event
+	LintRetention        = "retention"        // SINCE before the account's data retention
+)
+
+// selectStarPattern matches queries selecting every attribute.
+var selectStarPattern = regexp.MustCompile(`(?i)^\s*SELECT\s+\*\s+FROM\b`)
+
+// highCardinalityFacets are the FACET functions and attributes that yield a
+// series per distinct value or per event.
+var highCardinalityFacets = regexp.MustCompile(`(?i)\b(uniqueCount|uniques)\s*\(|\b(timestamp|traceId|spanId|guid|messageId)\b`)
+
+// agoPattern matches relative SINCE times such as "3 months ago".
+var agoPattern = regexp.MustCompile(`(?i)^(\d+)\s+(second|minute|hour|day|week|month|year)s?\s+ago$`)
+
+// agoUnits maps the units of relative SINCE times to their nominal length.
+var agoUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    timeutil.Day,
+	"week":   7 * timeutil.Day,
+	"month":  30 * timeutil.Day,
+	"year":   365 * timeutil.Day,
+}
+
+// LintIssue is a risky pattern found in an NRQL query.
+type LintIssue struct {
+	Rule string // One of the Lint* rules
+	Msg  string // What is wrong and how to fix it
+}
+
+// LintError represents a query rejected because it matches NRQL guardrails.
+type LintError struct {
+	Issues []LintIssue
+}
+
+func (e *LintError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.Msg
+	}
+	return "query blocked by NRQL guardrails: " + strings.Join(msgs, "; ")
+}
+
+// lintQuery returns the risky patterns in the query as it will be sent to New
+// Relic. fetchAll reports that the rows are fetched page by page, so a missing
+// LIMIT does not truncate them. retentionDays enables the check of SINCE
+// against the account's data retention; zero disables it.
+func lintQuery(query string, fetchAll bool, retentionDays int, now time.Time) []LintIssue {
+	masked := maskStringLiterals(query)
+	var issues []LintIssue
+
+	limit, hasLimit := queryLimit(query, masked)
+	if selectStarPattern.MatchString(masked) && !hasLimit && !fetchAll {
+		issues = append(issues, LintIssue{
+			Rule: LintSelectStar,
+			Msg:  "SELECT * without LIMIT returns only the first 100 events; select the attributes you need or add a LIMIT",
+		})
+	}
+	if hasLimit && (limit == "MAX" || atoiOrZero(limit) > largeLimit) && !containsKeyword(query, "SINCE") {
+		issues = append(issues, LintIssue{
+			Rule: LintUnboundedLimit,
+			Msg:  fmt.Sprintf("LIMIT %s without a SINCE clause; add SINCE to bound how many events are read", limit),
+		})
+	}
+
+	if facet := topLevelKeyword(masked, "FACET", 0); facet >= 0 {
+		clause := masked[facet+len("FACET") : clauseEnd(masked, facet+len("FACET"))]
+		if match := highCardinalityFacets.FindString(clause); match != "" {
+			issues = append(issues, LintIssue{
+				Rule: LintFacetCardinality,
+				Msg:  fmt.Sprintf("FACET on %s creates a series for nearly every event; facet on a lower-cardinality attribute or add a LIMIT", strings.TrimRight(strings.TrimSpace(match), "( ")),
+			})
+		}
+	}
+
+	if retentionDays > 0 {
+		if since, ok := sinceTime(query, masked, now); ok {
+			oldest := now.Add(-time.Duration(retentionDays) * timeutil.Day)
+			if since.Before(oldest) {
+				issues = append(issues, LintIssue{
+					Rule: LintRetention,
+					Msg:  fmt.Sprintf("SINCE reaches beyond the account's %d-day retention; data before %s is no longer stored, so shorten the time range", retentionDays, oldest.UTC().Format("2006-01-02")),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// queryLimit returns the value of the query's LIMIT clause, upper-cased, and
+// whether it has one.
+func queryLimit(query, masked string) (string, bool) {
+	idx := topLevelKeyword(masked, "LIMIT", 0)
+	if idx < 0 {
+		return "", false
+	}
+	fields := strings.Fields(query[idx+len("LIMIT") : clauseEnd(masked, idx+len("LIMIT"))])
+	if len(fields) == 0 {
+		return "", false
+	}
+	return strings.ToUpper(fields[0]), true
+}
+
+// sinceTime returns the start of the query's SINCE clause when it is epoch
+// milliseconds or a relative time.
+func sinceTime(query, masked string, now time.Time) (time.Time, bool) {
+	idx := topLevelKeyword(masked, "SINCE", 0)
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	value := strings.TrimSpace(query[idx+len("SINCE") : clauseEnd(masked, idx+len("SINCE"))])
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), true
+	}
+	match := agoPattern.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return now.Add(-time.Duration(n) * agoUnits[strings.ToLower(match[2])]), true
+}
+
+// atoiOrZero returns s as an integer, or zero if it is not one.
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintQuery(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         string
+		fetchAll      bool
+		retentionDays int
+		want          []string
+	}{
+		{name: "clean query", query: "SELECT count(*) FROM Transaction FACET appName SINCE 1 day ago"},
+		{name: "select star without limit", query: "SELECT * FROM Log SINCE 1 hour ago", want: []string{LintSelectStar}},
+		{name: "select star paged", query: "SELECT * FROM Log SINCE 1 hour ago", fetchAll: true},
+		{name: "select star with limit", query: "SELECT * FROM Log SINCE 1 hour ago LIMIT 50"},
+		{name: "large limit without since", query: "SELECT message FROM Log LIMIT 5000", want: []string{LintUnboundedLimit}},
+		{name: "limit max without since", query: "SELECT message FROM Log LIMIT MAX", want: []string{LintUnboundedLimit}},
+		{name: "small limit without since", query: "SELECT message FROM Log LIMIT 100"},
+		{name: "large limit with since", query: "SELECT message FROM Log SINCE 1 hour ago LIMIT MAX"},
+		{name: "facet uniqueCount", query: "SELECT count(*) FROM Transaction FACET uniqueCount(session) SINCE 1 hour ago", want: []string{LintFacetCardinality}},
+		{name: "facet timestamp", query: "SELECT count(*) FROM Transaction FACET appName, timestamp SINCE 1 hour ago", want: []string{LintFacetCardinality}},
+		{name: "facet value in a string", query: "SELECT count(*) FROM Transaction WHERE name = 'FACET timestamp' FACET appName"},
+		{name: "since beyond retention", query: "SELECT count(*) FROM Transaction SINCE 3 months ago", retentionDays: 30, want: []string{LintRetention}},
+		{name: "since in epoch milliseconds beyond retention", query: "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700086400000", retentionDays: 30, want: []string{LintRetention}},
+		{name: "since within retention", query: "SELECT count(*) FROM Transaction SINCE 2 weeks ago", retentionDays: 30},
+		{name: "retention check disabled", query: "SELECT count(*) FROM Transaction SINCE 3 months ago"},
+		{
+			name:          "several issues",
+			query:         "SELECT * FROM Log FACET traceId SINCE 1 year ago",
+			retentionDays: 30,
+			want:          []string{LintSelectStar, LintFacetCardinality, LintRetention},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, issue := range lintQuery(tt.query, tt.fetchAll, tt.retentionDays, now) {
+				rules = append(rules, issue.Rule)
+				assert.NotEmpty(t, issue.Msg)
+			}
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestHandleQuery_Lint(t *testing.T) {
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET uniqueCount(session)"}`)}
+
+	t.Run("warns by default", func(t *testing.T) {
+		config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		assert.Contains(t, noticeTexts(resp), "FACET on uniqueCount creates a series for nearly every event; facet on a lower-cardinality attribute or add a LIMIT")
+	})
+
+	t.Run("blocks", func(t *testing.T) {
+		config := &models.PluginSettings{QueryLint: models.QueryLintBlock, Secrets: &models.SecretPluginSettings{AccountId: 1}}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		var lintErr *LintError
+		require.ErrorAs(t, resp.Error, &lintErr)
+		require.Len(t, lintErr.Issues, 1)
+		assert.Equal(t, LintFacetCardinality, lintErr.Issues[0].Rule)
+		assert.Contains(t, resp.Error.Error(), "query blocked by NRQL guardrails: FACET on uniqueCount")
+	})
+
+	t.Run("off", func(t *testing.T) {
+		config := &models.PluginSettings{QueryLint: models.QueryLintOff, Secrets: &models.SecretPluginSettings{AccountId: 1}}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		assert.Empty(t, noticeTexts(resp))
+	})
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// logEventType is the event type New Relic stores logs under. Data partitions
+// are named with a Log_ prefix.
+const logEventType = "Log"
+
+// useLogsFormat reports whether results should be formatted as log lines: the
+// query must return raw events and either set queryType "logs" or read only
+// from Log event types.
+func useLogsFormat(queryType string, nrqlQueryText string, results interface{}) bool {
+	container, ok := results.(*nrdb.NRDBResultContainer)
+	if !ok || !formatter.IsEventResult(container) {
+		return false
+	}
+	if queryType == models.QueryTypeLogs {
+		return true
+	}
+	types := eventTypes(nrqlQueryText)
+	for _, eventType := range types {
+		if !strings.EqualFold(eventType, logEventType) && !strings.HasPrefix(strings.ToLower(eventType), strings.ToLower(logEventType)+"_") {
+			return false
+		}
+	}
+	return len(types) > 0
+}
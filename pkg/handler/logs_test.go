@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseLogsFormat(t *testing.T) {
+	events := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"timestamp": 1700000000000.0, "message": "hello"}}}
+	aggregate := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": 10.0}}}
+
+	tests := []struct {
+		name      string
+		queryType string
+		query     string
+		results   interface{}
+		want      bool
+	}{
+		{"FROM Log", "", "SELECT * FROM Log", events, true},
+		{"FROM Log partition", "", "SELECT * FROM Log_audit", events, true},
+		{"mixed event types", "", "SELECT * FROM Log, Transaction", events, false},
+		{"other event type", "", "SELECT * FROM Transaction", events, false},
+		{"explicit logs query type", models.QueryTypeLogs, "SELECT * FROM Transaction", events, true},
+		{"aggregate from Log", "", "SELECT count(*) FROM Log", aggregate, false},
+		{"explicit logs with aggregate", models.QueryTypeLogs, "SELECT count(*) FROM Log", aggregate, false},
+		{"multi result", models.QueryTypeLogs, "SELECT * FROM Log", &nrdb.NRDBResultContainerMultiResultCustomized{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, useLogsFormat(tt.queryType, tt.query, tt.results))
+		})
+	}
+}
+
+func TestHandleQuery_Logs(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "message": "hello", "level": "warn", "hostname": "web-1"},
+	}}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT * FROM Log"}`)}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	frame := resp.Frames[0]
+	require.NotNil(t, frame.Meta)
+	assert.Equal(t, data.FrameTypeLogLines, frame.Meta.Type)
+	assert.Equal(t, "SELECT * FROM Log", frame.Meta.ExecutedQueryString)
+	severity, _ := frame.FieldByName("severity")
+	require.NotNil(t, severity)
+	assert.Equal(t, "warning", severity.At(0))
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// maxTimeseriesBuckets is the largest number of TIMESERIES buckets NRQL returns.
+const maxTimeseriesBuckets = 366
+
+// Time range macros expanded by expandMacros. Each may be followed by "()".
+const (
+	macroTimeFilter = "$__timeFilter" // SINCE <from> UNTIL <to> in epoch milliseconds
+	macroFromTime   = "$__fromTime"   // Range start in epoch milliseconds
+	macroToTime     = "$__toTime"     // Range end in epoch milliseconds
+	macroIntervalMs = "$__interval_ms"
+	macroInterval   = "$__interval" // TIMESERIES bucket, e.g. "5 minutes"
+)
+
+// macroNames lists the macros longest first, so $__interval_ms wins over $__interval.
+var macroNames = []string{macroTimeFilter, macroIntervalMs, macroFromTime, macroInterval, macroToTime}
+
+// MacroError represents a macro that cannot be expanded for a query.
+type MacroError struct {
+	Macro string
+	Msg   string
+}
+
+func (e *MacroError) Error() string {
+	return fmt.Sprintf("cannot expand macro '%s': %s", e.Macro, e.Msg)
+}
+
+// expandMacros replaces the time range macros outside string literals with values
+// derived from the query time range and interval. Unknown $__ names are left as is.
+func expandMacros(query string, timeRange backend.TimeRange, interval time.Duration) (string, error) {
+	masked := maskStringLiterals(query)
+	if !strings.Contains(masked, "$__") {
+		return query, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for offset := 0; ; {
+		idx := strings.Index(masked[offset:], "$__")
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		name, end := matchMacro(masked, start)
+		if name == "" {
+			offset = start + 3
+			continue
+		}
+
+		value, err := macroValue(name, timeRange, interval)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(query[last:start])
+		b.WriteString(value)
+		last = end
+		offset = end
+	}
+	b.WriteString(query[last:])
+	return b.String(), nil
+}
+
+// matchMacro returns the macro starting at offset start and the offset after it,
+// including an optional "()". It returns an empty name if no macro matches.
+func matchMacro(masked string, start int) (string, int) {
+	for _, name := range macroNames {
+		end := start + len(name)
+		if !strings.HasPrefix(masked[start:], name) || (end < len(masked) && isIdentifierChar(masked[end])) {
+			continue
+		}
+		if strings.HasPrefix(masked[end:], "()") {
+			end += 2
+		}
+		return name, end
+	}
+	return "", start
+}
+
+// macroValue returns the NRQL text that replaces the macro.
+func macroValue(name string, timeRange backend.TimeRange, interval time.Duration) (string, error) {
+	switch name {
+	case macroInterval, macroIntervalMs:
+		bucket := timeseriesBucket(timeRange, interval)
+		if bucket <= 0 {
+			return "", &MacroError{Macro: name, Msg: "the query has no interval or time range"}
+		}
+		if name == macroIntervalMs {
+			return strconv.FormatInt(bucket.Milliseconds(), 10), nil
+		}
+		return formatNRQLDuration(bucket), nil
+	}
+
+	if timeRange.From.IsZero() || timeRange.To.IsZero() {
+		return "", &MacroError{Macro: name, Msg: "the query has no time range"}
+	}
+	switch name {
+	case macroFromTime:
+		return strconv.FormatInt(timeRange.From.UnixMilli(), 10), nil
+	case macroToTime:
+		return strconv.FormatInt(timeRange.To.UnixMilli(), 10), nil
+	default:
+		return timeRangeClause(timeRange), nil
+	}
+}
+
+// timeRangeClause returns the SINCE/UNTIL clause for the time range in epoch milliseconds.
+func timeRangeClause(timeRange backend.TimeRange) string {
+	return fmt.Sprintf("SINCE %d UNTIL %d", timeRange.From.UnixMilli(), timeRange.To.UnixMilli())
+}
+
+// applyTimeRange appends the query time range as a SINCE/UNTIL clause when the
+// query has neither, so the dashboard time picker applies instead of the NRQL
+// default of the last hour.
+func applyTimeRange(query string, timeRange backend.TimeRange) string {
+	if timeRange.From.IsZero() || timeRange.To.IsZero() {
+		return query
+	}
+	if containsKeyword(query, "SINCE") || containsKeyword(query, "UNTIL") {
+		return query
+	}
+	return query + " " + timeRangeClause(timeRange)
+}
+
+// timeseriesBucket returns the TIMESERIES bucket for the interval, rounded up to
+// whole seconds and widened so the time range yields at most maxTimeseriesBuckets.
+func timeseriesBucket(timeRange backend.TimeRange, interval time.Duration) time.Duration {
+	bucket := interval
+	if span := timeRange.Duration(); span > 0 {
+		if minBucket := span / maxTimeseriesBuckets; bucket < minBucket {
+			bucket = minBucket
+		}
+	}
+	if bucket <= 0 {
+		return 0
+	}
+	return ((bucket + time.Second - 1) / time.Second) * time.Second
+}
+
+// formatNRQLDuration formats d in the largest NRQL unit that divides it evenly,
+// e.g. "90 seconds", "5 minutes" or "1 day".
+func formatNRQLDuration(d time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+	}
+	for _, unit := range units {
+		if d%unit.size == 0 {
+			return pluralize(int64(d/unit.size), unit.name)
+		}
+	}
+	return pluralize(int64(d/time.Second), "second")
+}
+
+// pluralize returns "<n> <unit>" with the unit pluralized when n is not 1.
+func pluralize(n int64, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandMacros(t *testing.T) {
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(6 * time.Hour)}
+
+	tests := []struct {
+		name     string
+		query    string
+		interval time.Duration
+		want     string
+	}{
+		{
+			name:  "no macros",
+			query: "SELECT count(*) FROM Transaction",
+			want:  "SELECT count(*) FROM Transaction",
+		},
+		{
+			name:  "time filter",
+			query: "SELECT count(*) FROM Transaction $__timeFilter",
+			want:  "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700021600000",
+		},
+		{
+			name:  "time filter with parentheses",
+			query: "SELECT count(*) FROM Transaction $__timeFilter()",
+			want:  "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700021600000",
+		},
+		{
+			name:  "from and to",
+			query: "SELECT count(*) FROM Transaction SINCE $__fromTime UNTIL $__toTime",
+			want:  "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700021600000",
+		},
+		{
+			name:     "interval",
+			query:    "SELECT count(*) FROM Transaction $__timeFilter TIMESERIES $__interval",
+			interval: 5 * time.Minute,
+			want:     "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700021600000 TIMESERIES 5 minutes",
+		},
+		{
+			name:     "interval widened to the bucket limit",
+			query:    "SELECT count(*) FROM Transaction TIMESERIES $__interval",
+			interval: time.Second,
+			want:     "SELECT count(*) FROM Transaction TIMESERIES 1 minute",
+		},
+		{
+			name:     "interval in milliseconds",
+			query:    "SELECT count(*) FROM Transaction WHERE duration < $__interval_ms",
+			interval: 2 * time.Hour,
+			want:     "SELECT count(*) FROM Transaction WHERE duration < 7200000",
+		},
+		{
+			name:  "macros inside string literals are kept",
+			query: "SELECT count(*) FROM Transaction WHERE name = '$__timeFilter' $__timeFilter",
+			want:  "SELECT count(*) FROM Transaction WHERE name = '$__timeFilter' SINCE 1700000000000 UNTIL 1700021600000",
+		},
+		{
+			name:  "unknown macros are kept",
+			query: "SELECT count(*) FROM Transaction WHERE x = $__unknown AND y = $__timeFilterX",
+			want:  "SELECT count(*) FROM Transaction WHERE x = $__unknown AND y = $__timeFilterX",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandMacros(tt.query, timeRange, tt.interval)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpandMacros_MissingTimeRange(t *testing.T) {
+	_, err := expandMacros("SELECT count(*) FROM Transaction $__timeFilter", backend.TimeRange{}, 0)
+	var macroErr *MacroError
+	require.True(t, errors.As(err, &macroErr))
+	assert.Equal(t, "cannot expand macro '$__timeFilter': the query has no time range", err.Error())
+
+	_, err = expandMacros("SELECT count(*) FROM Transaction TIMESERIES $__interval", backend.TimeRange{}, 0)
+	assert.True(t, errors.As(err, &macroErr))
+}
+
+func TestFormatNRQLDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Second:      "1 second",
+		90 * time.Second: "90 seconds",
+		time.Minute:      "1 minute",
+		5 * time.Minute:  "5 minutes",
+		2 * time.Hour:    "2 hours",
+		24 * time.Hour:   "1 day",
+		36 * time.Hour:   "36 hours",
+	}
+	for d, want := range tests {
+		assert.Equal(t, want, formatNRQLDuration(d), d.String())
+	}
+}
+
+func TestApplyTimeRange(t *testing.T) {
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+
+	tests := []struct {
+		name      string
+		query     string
+		timeRange backend.TimeRange
+		want      string
+	}{
+		{
+			name:      "appended without SINCE or UNTIL",
+			query:     "SELECT count(*) FROM Transaction TIMESERIES",
+			timeRange: timeRange,
+			want:      "SELECT count(*) FROM Transaction TIMESERIES SINCE 1700000000000 UNTIL 1700003600000",
+		},
+		{
+			name:      "existing SINCE is kept",
+			query:     "SELECT count(*) FROM Transaction SINCE 1 day ago",
+			timeRange: timeRange,
+			want:      "SELECT count(*) FROM Transaction SINCE 1 day ago",
+		},
+		{
+			name:      "existing UNTIL is kept",
+			query:     "SELECT count(*) FROM Transaction until 10 minutes ago",
+			timeRange: timeRange,
+			want:      "SELECT count(*) FROM Transaction until 10 minutes ago",
+		},
+		{
+			name:      "SINCE inside a string literal does not count",
+			query:     "SELECT count(*) FROM Transaction WHERE name = 'since'",
+			timeRange: timeRange,
+			want:      "SELECT count(*) FROM Transaction WHERE name = 'since' SINCE 1700000000000 UNTIL 1700003600000",
+		},
+		{
+			name:  "no time range",
+			query: "SELECT count(*) FROM Transaction",
+			want:  "SELECT count(*) FROM Transaction",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, applyTimeRange(tt.query, tt.timeRange))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/graphql"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// GraphQLExecutorFunc returns the NerdGraph executor for an account.
+type GraphQLExecutorFunc func(ctx context.Context, accountID int) (nrdbiface.GraphQLExecutor, error)
+
+// HandleNerdGraphQuery processes a Grafana query of type models.QueryTypeNerdGraph.
+// The query text is a read-only GraphQL query, run against NerdGraph with the
+// query's GraphQL variables using the API key of the query account. The part of
+// the response picked by the query's selector is returned as a table frame.
+func HandleNerdGraphQuery(ctx context.Context, executorFor GraphQLExecutorFunc, config *models.PluginSettings, query backend.DataQuery) *backend.DataResponse {
+	resp := &backend.DataResponse{}
+	logger := queryLogger(tracing.TraceIDFromContext(ctx))
+
+	qm, _, err := models.ParseQueryModel(query.JSON, config.StrictQueryParsing)
+	if err != nil {
+		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
+		logger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if err := graphql.ValidateQuery(qm.QueryText); err != nil {
+		resp.Error = err
+		return resp
+	}
+
+	accountID := config.Secrets.AccountId
+	if qm.AccountID > 0 {
+		accountID = qm.AccountID
+	}
+
+	executor, err := executorFor(ctx, accountID)
+	if err != nil {
+		logger.Error("Failed to create New Relic client for NerdGraph query", "refId", query.RefID, "accountID", accountID, "error", err)
+		return errorsx.Response(errorsx.Plugin(err))
+	}
+
+	respData, err := graphql.Run(ctx, executor, qm.QueryText, qm.GraphQLVariables, accountID)
+	if err != nil {
+		logger.Error("NerdGraph query failed", "refId", query.RefID, "accountID", accountID, "kind", errorsx.Classify(err), "error", err)
+		return errorsx.Response(fmt.Errorf("NerdGraph query failed: %w", err))
+	}
+
+	nodes, err := graphql.Select(respData, qm.Selector)
+	if err != nil {
+		var requestErr *graphql.RequestError
+		if errors.As(err, &requestErr) {
+			resp.Error = err
+			return resp
+		}
+		return errorsx.Response(err)
+	}
+
+	logger.Debug("NerdGraph query completed", "refId", query.RefID, "accountID", accountID, "rows", len(nodes))
+	return &backend.DataResponse{Frames: data.Frames{graphql.Frame(nodes)}}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/graphql"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleNerdGraphQuery(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	var gotVariables map[string]interface{}
+	executor := nrdbiface.GraphQLExecutorFunc(func(_ context.Context, _ string, variables map[string]interface{}) (interface{}, error) {
+		gotVariables = variables
+		return map[string]interface{}{"actor": map[string]interface{}{"account": map[string]interface{}{
+			"nrql": map[string]interface{}{"results": []interface{}{
+				map[string]interface{}{"count": 1.0},
+				map[string]interface{}{"count": 2.0},
+			}},
+		}}}, nil
+	})
+	nerdGraphQuery := func(json string) backend.DataQuery {
+		return backend.DataQuery{RefID: "A", QueryType: models.QueryTypeNerdGraph, JSON: []byte(json)}
+	}
+
+	t.Run("selects rows from the response", func(t *testing.T) {
+		var gotAccount int
+		resp := HandleNerdGraphQuery(context.Background(), func(_ context.Context, accountID int) (nrdbiface.GraphQLExecutor, error) {
+			gotAccount = accountID
+			return executor, nil
+		}, config, nerdGraphQuery(`{
+			"accountID": 42,
+			"queryText": "query($accountId: Int!) { actor { account(id: $accountId) { nrql(query: \"SELECT count(*) FROM Transaction\") { results } } } }",
+			"selector": "actor.account.nrql.results"
+		}`))
+
+		require.NoError(t, resp.Error)
+		assert.Equal(t, 42, gotAccount)
+		assert.Equal(t, map[string]interface{}{"accountId": 42}, gotVariables)
+		require.Len(t, resp.Frames, 1)
+		assert.Equal(t, graphql.FrameName, resp.Frames[0].Name)
+		assert.Equal(t, 2, resp.Frames[0].Rows())
+	})
+
+	t.Run("mutation", func(t *testing.T) {
+		resp := HandleNerdGraphQuery(context.Background(), func(context.Context, int) (nrdbiface.GraphQLExecutor, error) {
+			t.Fatal("mutations must not be run")
+			return nil, nil
+		}, config, nerdGraphQuery(`{"queryText": "mutation { alertsPolicyDelete(id: 1) { id } }"}`))
+
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "mutation operations are not allowed")
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		resp := HandleNerdGraphQuery(context.Background(), func(context.Context, int) (nrdbiface.GraphQLExecutor, error) {
+			return executor, nil
+		}, config, nerdGraphQuery(`{"queryText": "{ actor { user { name } } }", "selector": "actor[x]"}`))
+
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid selector")
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		resp := HandleNerdGraphQuery(context.Background(), func(context.Context, int) (nrdbiface.GraphQLExecutor, error) {
+			return nrdbiface.GraphQLExecutorFunc(func(context.Context, string, map[string]interface{}) (interface{}, error) {
+				return nil, errors.New("unauthorized")
+			}), nil
+		}, config, nerdGraphQuery(`{"queryText": "{ actor { user { name } } }"}`))
+
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "NerdGraph query failed")
+	})
+}
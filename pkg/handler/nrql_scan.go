@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"strings"
+)
+
+// maskStringLiterals returns a copy of the query in which the contents of
+// single-quoted, double-quoted and backtick-quoted sections are replaced with
+// spaces. The quotes themselves and the overall length are preserved, so
+// offsets found in the masked query are valid in the original one.
+func maskStringLiterals(query string) string {
+	masked := []byte(query)
+	var quote byte
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		if quote == 0 {
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+			}
+			continue
+		}
+
+		switch {
+		case c == '\\' && quote != '`' && i+1 < len(masked):
+			// Escaped character inside a string literal
+			masked[i] = ' '
+			masked[i+1] = ' '
+			i++
+		case c == quote:
+			quote = 0
+		default:
+			masked[i] = ' '
+		}
+	}
+	return string(masked)
+}
+
+// isIdentifierChar reports whether c can be part of an NRQL identifier.
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '.' ||
+		(c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
+
+// findKeyword returns the byte offset of the first occurrence of keyword in the
+// query as a standalone word outside of string literals, or -1 if not found.
+// The match is case-insensitive.
+func findKeyword(query, keyword string) int {
+	upper := strings.ToUpper(maskStringLiterals(query))
+	keyword = strings.ToUpper(keyword)
+
+	offset := 0
+	for {
+		idx := strings.Index(upper[offset:], keyword)
+		if idx < 0 {
+			return -1
+		}
+		start := offset + idx
+		end := start + len(keyword)
+
+		before := start == 0 || !isIdentifierChar(upper[start-1])
+		after := end == len(upper) || !isIdentifierChar(upper[end])
+		if before && after {
+			return start
+		}
+		offset = start + 1
+	}
+}
+
+// containsKeyword reports whether the NRQL query contains keyword as a
+// standalone word outside of string literals and quoted identifiers.
+func containsKeyword(query, keyword string) bool {
+	return findKeyword(query, keyword) >= 0
+}
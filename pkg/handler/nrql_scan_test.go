@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskStringLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "no literals",
+			input:    "SELECT count(*) FROM Transaction",
+			expected: "SELECT count(*) FROM Transaction",
+		},
+		{
+			name:     "single quoted literal",
+			input:    "WHERE name = 'FACET'",
+			expected: "WHERE name = '     '",
+		},
+		{
+			name:     "double quoted literal with escape",
+			input:    `WHERE name = "a\"b"`,
+			expected: `WHERE name = "    "`,
+		},
+		{
+			name:     "backtick identifier",
+			input:    "FACET `timeseries`",
+			expected: "FACET `          `",
+		},
+		{
+			name:     "unterminated literal",
+			input:    "WHERE name = 'abc",
+			expected: "WHERE name = '   ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, maskStringLiterals(tt.input))
+		})
+	}
+}
+
+func TestContainsKeyword(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		keyword  string
+		expected bool
+	}{
+		{"plain keyword", "SELECT count(*) FROM Transaction FACET appName", "FACET", true},
+		{"lowercase keyword", "select count(*) from Transaction facet appName", "FACET", true},
+		{"keyword inside single quotes", "SELECT count(*) FROM Transaction WHERE name = 'FACET'", "FACET", false},
+		{"keyword inside double quotes", `SELECT count(*) FROM Transaction WHERE name = "timeseries"`, "TIMESERIES", false},
+		{"keyword inside backticks", "SELECT count(*) FROM Transaction FACET `timeseries`", "TIMESERIES", false},
+		{"keyword as part of identifier", "SELECT count(*) FROM Transaction WHERE facetName = 'x'", "FACET", false},
+		{"keyword as attribute suffix", "SELECT latest(custom.facet) FROM Transaction", "FACET", false},
+		{"keyword at end of query", "SELECT count(*) FROM Transaction TIMESERIES", "TIMESERIES", true},
+		{"keyword followed by value", "SELECT count(*) FROM Transaction TIMESERIES 5 minutes", "TIMESERIES", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, containsKeyword(tt.query, tt.keyword))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// MaxPageSize is the largest page size a query may request. It matches the
+// maximum LIMIT NRQL accepts for event queries.
+const MaxPageSize = 5000
+
+// validatePagination checks the page options of a query. A zero page size
+// disables pagination, in which case a non-zero page index is rejected.
+func validatePagination(query string, pageSize, pageIndex int) error {
+	if pageSize == 0 {
+		if pageIndex != 0 {
+			return fmt.Errorf("pageIndex requires pageSize to be set")
+		}
+		return nil
+	}
+	if pageSize < 0 || pageSize > MaxPageSize {
+		return fmt.Errorf("invalid pageSize %d: must be between 1 and %d", pageSize, MaxPageSize)
+	}
+	if pageIndex < 0 || pageIndex > math.MaxInt32/pageSize {
+		return fmt.Errorf("invalid pageIndex %d: must be between 0 and %d", pageIndex, math.MaxInt32/pageSize)
+	}
+	if containsKeyword(query, "LIMIT") || containsKeyword(query, "OFFSET") {
+		return fmt.Errorf("pageSize cannot be combined with a LIMIT or OFFSET clause in the query")
+	}
+	if containsKeyword(query, "TIMESERIES") {
+		return fmt.Errorf("pageSize cannot be used with TIMESERIES queries")
+	}
+	return nil
+}
+
+// applyPagination appends the LIMIT and OFFSET clauses selecting the requested
+// page. The query must have been checked with validatePagination.
+func applyPagination(query string, pageSize, pageIndex int) string {
+	if pageSize == 0 {
+		return query
+	}
+	return fmt.Sprintf("%s LIMIT %d OFFSET %d", query, pageSize, pageSize*pageIndex)
+}
+
+// applyAutoLimit appends LIMIT MAX to a query that sets no LIMIT, so table and
+// variable queries return every value instead of NRQL's default limit.
+// TIMESERIES and SHOW queries are left unchanged, as LIMIT only caps their facets
+// or is not accepted.
+func applyAutoLimit(query string) string {
+	for _, keyword := range []string{"LIMIT", "TIMESERIES", "SHOW"} {
+		if containsKeyword(query, keyword) {
+			return query
+		}
+	}
+	return query + " LIMIT MAX"
+}
+
+// resultRowCount returns the number of result rows returned by the executor.
+func resultRowCount(results interface{}) int {
+	switch r := results.(type) {
+	case *nrdb.NRDBResultContainer:
+		return len(r.Results)
+	case *nrdb.NRDBResultContainerMultiResultCustomized:
+		return max(len(r.Results), len(r.OtherResult))
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		pageSize  int
+		pageIndex int
+		wantErr   string
+	}{
+		{name: "disabled", query: "SELECT * FROM Transaction"},
+		{name: "first page", query: "SELECT * FROM Transaction", pageSize: 100},
+		{name: "later page", query: "SELECT * FROM Transaction", pageSize: 100, pageIndex: 5},
+		{name: "limit inside literal", query: "SELECT * FROM Transaction WHERE name = 'LIMIT 5'", pageSize: 100},
+		{name: "index without size", query: "SELECT * FROM Transaction", pageIndex: 1, wantErr: "pageIndex requires pageSize"},
+		{name: "negative size", query: "SELECT * FROM Transaction", pageSize: -1, wantErr: "invalid pageSize -1"},
+		{name: "size too large", query: "SELECT * FROM Transaction", pageSize: MaxPageSize + 1, wantErr: "must be between 1 and 5000"},
+		{name: "negative index", query: "SELECT * FROM Transaction", pageSize: 10, pageIndex: -1, wantErr: "invalid pageIndex -1"},
+		{name: "existing limit", query: "SELECT * FROM Transaction LIMIT 10", pageSize: 10, wantErr: "LIMIT or OFFSET"},
+		{name: "existing offset", query: "SELECT * FROM Transaction offset 10", pageSize: 10, wantErr: "LIMIT or OFFSET"},
+		{name: "timeseries", query: "SELECT count(*) FROM Transaction TIMESERIES", pageSize: 10, wantErr: "TIMESERIES"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePagination(tt.query, tt.pageSize, tt.pageIndex)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestApplyPagination(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM Transaction", applyPagination("SELECT * FROM Transaction", 0, 0))
+	assert.Equal(t, "SELECT * FROM Transaction LIMIT 50 OFFSET 0", applyPagination("SELECT * FROM Transaction", 50, 0))
+	assert.Equal(t, "SELECT * FROM Transaction LIMIT 50 OFFSET 100", applyPagination("SELECT * FROM Transaction", 50, 2))
+}
+
+func TestApplyAutoLimit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM Transaction", "SELECT * FROM Transaction LIMIT MAX"},
+		{"SELECT uniques(appName) FROM Transaction", "SELECT uniques(appName) FROM Transaction LIMIT MAX"},
+		{"SELECT count(*) FROM Transaction FACET appName", "SELECT count(*) FROM Transaction FACET appName LIMIT MAX"},
+		{"SELECT * FROM Transaction LIMIT 10", "SELECT * FROM Transaction LIMIT 10"},
+		{"SELECT count(*) FROM Transaction TIMESERIES", "SELECT count(*) FROM Transaction TIMESERIES"},
+		{"SHOW EVENT TYPES", "SHOW EVENT TYPES"},
+		{"SELECT * FROM Transaction WHERE name = 'LIMIT'", "SELECT * FROM Transaction WHERE name = 'LIMIT' LIMIT MAX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, applyAutoLimit(tt.query))
+		})
+	}
+}
+
+func TestResultRowCount(t *testing.T) {
+	assert.Equal(t, 2, resultRowCount(&nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{}, {}}}))
+	assert.Equal(t, 3, resultRowCount(&nrdb.NRDBResultContainerMultiResultCustomized{
+		OtherResult: nrdb.NRDBMultiResultCustomized{{}, {}, {}},
+	}))
+	assert.Equal(t, 0, resultRowCount(nil))
+}
@@ -8,14 +8,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"newrelic-grafana-plugin/pkg/errorsx"
 	"newrelic-grafana-plugin/pkg/formatter"
 	"newrelic-grafana-plugin/pkg/models"
 	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // NRQLExecutionError represents an error during NRQL query execution.
@@ -36,11 +41,22 @@ func (e *NRQLExecutionError) Unwrap() error {
 	return e.Err
 }
 
-// shouldUseEnhancedQuery determines if the enhanced query should be used (FACET + TIMESERIES)
+// shouldUseEnhancedQuery determines if the enhanced query should be used (FACET + TIMESERIES).
+// Keywords appearing inside string literals or quoted identifiers are ignored.
 func shouldUseEnhancedQuery(query string) bool {
-	hasFacet := strings.Contains(strings.ToUpper(query), "FACET")
-	hasTimeseries := strings.Contains(strings.ToUpper(query), "TIMESERIES")
-	return hasFacet && hasTimeseries
+	return containsKeyword(query, "FACET") && containsKeyword(query, "TIMESERIES")
+}
+
+// useEnhancedQueryForMode resolves the executor path for a query given its result mode.
+func useEnhancedQueryForMode(query string, resultMode string) bool {
+	switch resultMode {
+	case models.ResultModeStandard:
+		return false
+	case models.ResultModeMulti:
+		return true
+	default:
+		return shouldUseEnhancedQuery(query)
+	}
 }
 
 // NormalizeQuery cleans up NRQL queries to fix common issues:
@@ -85,6 +101,12 @@ func NormalizeQuery(query string) string {
 // ExecuteNRQLQuery takes an NRDB query executor, account ID, and NRQL query string,
 // executes the query, and returns the results.
 func ExecuteNRQLQuery(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, nrqlQueryText string) (interface{}, error) {
+	return ExecuteNRQLQueryWithMode(ctx, executor, accountID, nrqlQueryText, models.ResultModeAuto)
+}
+
+// ExecuteNRQLQueryWithMode executes the query like ExecuteNRQLQuery, but lets the
+// caller force the standard or enhanced (multi-result) executor via resultMode.
+func ExecuteNRQLQueryWithMode(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, nrqlQueryText string, resultMode string) (interface{}, error) {
 	if executor == nil {
 		return nil, &NRQLExecutionError{Query: nrqlQueryText, Msg: "NRDB query executor is nil, cannot execute query"}
 	}
@@ -96,7 +118,7 @@ func ExecuteNRQLQuery(ctx context.Context, executor nrdbiface.NRDBQueryExecutor,
 	}
 
 	nrql := nrdb.NRQL(nrqlQueryText)
-	if shouldUseEnhancedQuery(nrqlQueryText) {
+	if useEnhancedQueryForMode(nrqlQueryText, resultMode) {
 		return executor.PerformNRQLQueryWithContext(ctx, accountID, nrql)
 	}
 	return executor.QueryWithContext(ctx, accountID, nrql)
@@ -104,9 +126,7 @@ func ExecuteNRQLQuery(ctx context.Context, executor nrdbiface.NRDBQueryExecutor,
 
 // checkFacetAndTimeseries logs if both FACET and TIMESERIES are present in the query
 func checkFacetAndTimeseries(query string) {
-	hasFacet := strings.Contains(strings.ToUpper(query), "FACET")
-	hasTimeseries := strings.Contains(strings.ToUpper(query), "TIMESERIES")
-	if hasFacet && hasTimeseries {
+	if shouldUseEnhancedQuery(query) {
 		log.DefaultLogger.Info("Query contains both FACET and TIMESERIES", "query", query)
 	}
 }
@@ -114,54 +134,464 @@ func checkFacetAndTimeseries(query string) {
 // HandleQuery processes a single Grafana data query using our interface-based approach.
 func HandleQuery(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, config *models.PluginSettings, query backend.DataQuery) *backend.DataResponse {
 	resp := &backend.DataResponse{}
+	traceID := tracing.TraceIDFromContext(ctx)
+	logger := queryLogger(traceID)
 
 	// Parse the query JSON
-	var qm models.QueryModel
-	if err := json.Unmarshal(query.JSON, &qm); err != nil {
+	qm, unknownFields, err := models.ParseQueryModel(query.JSON, config.StrictQueryParsing)
+	if err != nil {
 		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
-		log.DefaultLogger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		logger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if len(unknownFields) > 0 {
+		logger.Warn("Query contains unknown fields", "refId", query.RefID, "unknownFields", unknownFields)
+	}
+	if len(qm.Statements) > 0 {
+		return handleStatements(ctx, executor, config, query, qm.Statements)
+	}
+
+	if !models.IsValidEditorMode(qm.EditorMode) {
+		resp.Error = fmt.Errorf("invalid editorMode '%s': must be one of code, builder", qm.EditorMode)
+		logger.Error("Invalid editor mode", "refId", query.RefID, "editorMode", qm.EditorMode)
 		return resp
 	}
+	if qm.EditorMode == models.EditorModeBuilder {
+		if qm.Builder == nil {
+			resp.Error = fmt.Errorf("builder mode requires a builder query")
+			logger.Error("Builder mode without a builder query", "refId", query.RefID)
+			return resp
+		}
+		// The visual editor's query replaces any NRQL left from code mode
+		qm.QueryText, err = CompileQuery(*qm.Builder)
+		if err != nil {
+			resp.Error = err
+			logger.Error("Failed to compile builder query", "refId", query.RefID, "error", err)
+			return resp
+		}
+	}
 
-	log.DefaultLogger.Debug("Processing query", "refId", query.RefID, "queryText", qm.QueryText, "configAccountID", config.Secrets.AccountId, "queryAccountID", qm.AccountID)
+	logger.Debug("Processing query", "refId", query.RefID, "queryText", qm.QueryText, "configAccountID", config.Secrets.AccountId, "queryAccountID", qm.AccountID)
 
 	// Check if query is empty
 	if qm.QueryText == "" {
 		resp.Error = fmt.Errorf("query text cannot be empty")
-		log.DefaultLogger.Error("Query text is empty", "refId", query.RefID)
+		logger.Error("Query text is empty", "refId", query.RefID)
+		return resp
+	}
+
+	if !models.IsValidResultMode(qm.ResultMode) {
+		resp.Error = fmt.Errorf("invalid resultMode '%s': must be one of auto, standard, multi", qm.ResultMode)
+		logger.Error("Invalid result mode", "refId", query.RefID, "resultMode", qm.ResultMode)
+		return resp
+	}
+
+	if !models.IsValidFacetAs(qm.FacetAs) {
+		resp.Error = fmt.Errorf("invalid facetAs '%s': must be one of labels, column, both", qm.FacetAs)
+		logger.Error("Invalid facetAs option", "refId", query.RefID, "facetAs", qm.FacetAs)
+		return resp
+	}
+	if !models.IsValidFormat(qm.Format) {
+		resp.Error = fmt.Errorf("invalid format '%s': must be one of multi, wide", qm.Format)
+		logger.Error("Invalid format option", "refId", query.RefID, "format", qm.Format)
+		return resp
+	}
+	if !models.IsValidFacetTime(qm.FacetTime) {
+		resp.Error = fmt.Errorf("invalid facetTime '%s': must be one of end, midpoint, none, table", qm.FacetTime)
+		logger.Error("Invalid facetTime option", "refId", query.RefID, "facetTime", qm.FacetTime)
+		return resp
+	}
+	if !models.IsValidFacetOrder(qm.FacetOrder) {
+		resp.Error = fmt.Errorf("invalid facetOrder '%s': must be one of name, value", qm.FacetOrder)
+		logger.Error("Invalid facetOrder option", "refId", query.RefID, "facetOrder", qm.FacetOrder)
+		return resp
+	}
+	if !models.IsValidFillMode(qm.FillMode) {
+		resp.Error = fmt.Errorf("invalid fillMode '%s': must be one of null, zero, previous", qm.FillMode)
+		logger.Error("Invalid fillMode option", "refId", query.RefID, "fillMode", qm.FillMode)
+		return resp
+	}
+
+	if err := validateLimits(qm); err != nil {
+		resp.Error = err
+		logger.Error("Invalid series or row limit", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if err := validateSplitRange(qm); err != nil {
+		resp.Error = err
+		logger.Error("Invalid splitRange", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if qm.FlattenDepth < 0 || qm.FlattenDepth > formatter.MaxFlattenDepth {
+		resp.Error = fmt.Errorf("invalid flattenDepth %d: must be between 0 and %d", qm.FlattenDepth, formatter.MaxFlattenDepth)
+		logger.Error("Invalid flattenDepth", "refId", query.RefID, "flattenDepth", qm.FlattenDepth)
+		return resp
+	}
+	if err := validateAnomalyBands(qm); err != nil {
+		resp.Error = err
+		logger.Error("Invalid anomaly bands", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if err := validateExpressions(qm.Expressions, query.RefID); err != nil {
+		resp.Error = err
+		logger.Error("Invalid expressions", "refId", query.RefID, "error", err)
 		return resp
 	}
 
 	// Normalize the query by removing line breaks that cause issues
 	nrqlQueryText := NormalizeQuery(qm.QueryText)
+	unsupported := unsupportedFeaturesOf(nrqlQueryText)
+	if len(unsupported) > 0 {
+		logger.Debug("Query uses NRQL features the formatter does not fully handle", "refId", query.RefID, "features", unsupported)
+	}
+
+	// Render multi-value template variables with NRQL quoting
+	nrqlQueryText, err = interpolateVariables(nrqlQueryText, qm.Variables)
+	if err != nil {
+		resp.Error = err
+		logger.Error("Failed to interpolate template variables", "refId", query.RefID, "error", err)
+		return resp
+	}
+
+	// Buckets are only fitted to the panel when the query covers the dashboard time range
+	alignBuckets := !qm.IgnoreMaxPoints && followsDashboardRange(nrqlQueryText, qm.IgnoreTimeRange)
+
+	// The time range of TIMESERIES queries may be split into sequential queries
+	splitRanges, splitNotice := planSplit(nrqlQueryText, qm, query)
+	if splitRanges != nil {
+		if alignBuckets {
+			// Every part gets the bucket fitted to the first
+			nrqlQueryText = alignToMaxDataPoints(nrqlQueryText, splitRanges[0], splitMaxDataPoints(query.MaxDataPoints, len(splitRanges)))
+		}
+		// Parts of whole buckets, so no bucket straddles two parts
+		splitRanges = splitTimeRange(query.TimeRange, len(splitRanges), timeseriesBucketOf(nrqlQueryText))
+	}
+	templateText := nrqlQueryText
+
+	// The buckets of split queries are already fitted to the panel
+	nrqlQueryText, err = buildNRQL(logger, templateText, qm, query, alignBuckets && splitRanges == nil)
+	if err != nil {
+		resp.Error = err
+		return resp
+	}
+
+	// Check the query as it will be sent against the NRQL guardrails
+	var lintIssues []LintIssue
+	if config.QueryLint != models.QueryLintOff {
+		lintIssues = lintQuery(nrqlQueryText, shouldFetchAllPages(nrqlQueryText, qm, config.MaxRows), config.RetentionDays, time.Now())
+		if len(lintIssues) > 0 && config.QueryLint == models.QueryLintBlock {
+			resp.Error = &LintError{Issues: lintIssues}
+			logger.Error("Query blocked by NRQL guardrails", "refId", query.RefID, "error", resp.Error)
+			return resp
+		}
+	}
 
 	accountID := config.Secrets.AccountId
 	if qm.AccountID > 0 {
 		accountID = qm.AccountID
 	}
 
-	results, err := ExecuteNRQLQuery(ctx, executor, accountID, nrqlQueryText)
+	timeout, err := queryTimeout(qm, config)
 	if err != nil {
-		resp.Error = fmt.Errorf("NRQL query execution failed: %w", err)
-		log.DefaultLogger.Error("NRQL query execution failed", "refId", query.RefID, "query", nrqlQueryText, "accountID", accountID, "error", err)
+		resp.Error = err
+		logger.Error("Invalid query timeout", "refId", query.RefID, "error", err)
 		return resp
 	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	// DEBUG: Log the actual response structure to understand the issue
-	if resultsJSON, err := json.MarshalIndent(results, "", "  "); err == nil {
-		log.DefaultLogger.Debug("Raw API response", "refId", query.RefID, "type", fmt.Sprintf("%T", results), "response", string(resultsJSON))
+	var results interface{}
+	paged, truncated := false, false
+	start := time.Now()
+	execCtx, execSpan := tracing.Start(ctx, "newrelic.nrql.execute", attribute.Int("accountId", accountID), attribute.String("refId", query.RefID))
+	if tracing.Detailed(ctx) {
+		execSpan.SetAttributes(attribute.String("nrql", nrqlQueryText))
+	}
+	if splitRanges != nil {
+		execSpan.SetAttributes(attribute.Int("splitRange", len(splitRanges)))
+		results, err = executeSplit(execCtx, executor, accountID, qm.ResultMode, query, splitRanges, func(part backend.DataQuery) (string, error) {
+			return buildNRQL(logger, templateText, qm, part, alignBuckets)
+		})
+	} else if shouldFetchAllPages(nrqlQueryText, qm, config.MaxRows) {
+		paged = true
+		results, truncated, err = fetchAllPages(execCtx, executor, accountID, nrqlQueryText, config.MaxRows)
+	} else {
+		results, err = ExecuteNRQLQueryWithMode(execCtx, executor, accountID, nrqlQueryText, qm.ResultMode)
+	}
+	wallClock := time.Since(start)
+	execSpan.SetAttributes(attribute.Bool("paged", paged))
+	if err == nil && tracing.Detailed(ctx) {
+		execSpan.SetAttributes(attribute.Int("rows", resultRowCount(results)))
+	}
+	tracing.End(execSpan, err)
+	if err != nil {
+		if timedOut := timeoutError(ctx, err, timeout); timedOut != nil {
+			err = timedOut
+		}
+		resp = errorsx.Response(fmt.Errorf("NRQL query execution failed: %w", err))
+		logger.Error("NRQL query execution failed", "refId", query.RefID, "query", nrqlQueryText, "accountID", accountID, "kind", errorsx.Classify(err), "error", err)
+		return resp
+	}
+
+	// DEBUG: Log the actual response structure to understand the issue. Rendering
+	// large results is costly, so it is skipped unless debug messages are logged.
+	if level := logger.Level(); level != log.NoLevel && level <= log.Debug {
+		if resultsJSON, err := json.MarshalIndent(results, "", "  "); err == nil {
+			logger.Debug("Raw API response", "refId", query.RefID, "type", fmt.Sprintf("%T", results), "response", string(resultsJSON))
+		}
+	}
+
+	_, formatSpan := tracing.Start(ctx, "newrelic.format", attribute.String("refId", query.RefID))
+	var dedicated func(*nrdb.NRDBResultContainer) *backend.DataResponse
+	if !qm.RawFields {
+		dedicated = dedicatedFormatter(query.QueryType, nrqlQueryText, results)
+	}
+	if dedicated != nil {
+		resp = dedicated(results.(*nrdb.NRDBResultContainer))
+	} else {
+		resp = formatResults(results, qm, formatOptions(qm, config), query)
+	}
+	if resp.Error != nil {
+		logger.Error("Failed to format query results", "refId", query.RefID, "type", fmt.Sprintf("%T", results), "error", resp.Error)
+	}
+	if config.VerifyFormatter && !qm.RawFields && dedicated == nil {
+		// Dual-write verification: diff the candidate formatter against the served output
+		_, verifySpan := tracing.StartDetailed(ctx, "newrelic.format.verify")
+		formatter.VerifyDualWrite(resp, results, query, formatOptions(qm, config))
+		verifySpan.End()
+	}
+	if !qm.IgnoreMaxPoints && !qm.RawFields && dedicated == nil {
+		// Buckets the query could not be fitted to the panel are merged instead
+		formatter.MergeBuckets(resp, int(query.MaxDataPoints))
+	}
+	// Truncate high-cardinality results before they are decorated and sent to the browser
+	maxSeries, maxRows := frameLimits(qm, config)
+	formatter.ApplyLimits(resp, maxSeries, maxRows)
+	if !qm.RawFields && dedicated == nil {
+		_, displaySpan := tracing.StartDetailed(ctx, "newrelic.format.display")
+		mappings, mappingNotice := facetLabelMappings(ctx, resp, qm)
+		formatter.ApplyFacetLabels(resp, mappings, qm.TrimFacetPrefix)
+		if mappingNotice != nil {
+			formatter.AppendNotices(resp, *mappingNotice)
+		}
+		if qm.EnrichEntities {
+			if notice := enrichEntities(ctx, resp); notice != nil {
+				formatter.AppendNotices(resp, *notice)
+			}
+		}
+		for _, warning := range formatter.ApplyExpressions(resp, qm.Expressions, query.RefID) {
+			formatter.AppendNotices(resp, data.Notice{Severity: data.NoticeSeverityWarning, Text: warning})
+		}
+		formatter.ApplyAlias(resp, qm.Alias)
+		formatter.ApplyFacetAs(resp, qm.FacetAs)
+		formatter.ApplyRateUnit(resp, rateUnit(nrqlQueryText))
+		formatter.ApplyUnits(resp, config.UnitOverrides)
+		if qm.AnomalyBands > 0 && formatter.ApplyAnomalyBands(resp, qm.AnomalyBands, qm.BaselineWindow) == 0 && len(resp.Frames) > 0 {
+			formatter.AppendNotices(resp, data.Notice{Severity: data.NoticeSeverityInfo, Text: "anomalyBands ignored: only TIMESERIES results get bands"})
+		}
+		if qm.DualOutput {
+			formatter.AddTableView(resp)
+		}
+		displaySpan.End()
+	}
+	formatSpan.SetAttributes(attribute.Int("frames", len(resp.Frames)))
+	tracing.End(formatSpan, resp.Error)
+	formatter.AttachNRDBNotices(resp, results)
+	formatter.AttachTraceID(resp, traceID)
+	formatter.AttachQueryInfo(resp, nrqlQueryText, &formatter.QueryStats{
+		AccountID:   accountID,
+		WallClockMs: wallClock.Milliseconds(),
+		Performance: formatter.PerformanceStats(results),
+	})
+	if qm.PageSize > 0 {
+		rows := resultRowCount(results)
+		formatter.AttachPagination(resp, &formatter.Pagination{
+			PageSize:  qm.PageSize,
+			PageIndex: qm.PageIndex,
+			Rows:      rows,
+			HasMore:   rows >= qm.PageSize,
+		})
+	}
+	rowNotice, rowLimited := rowLimitNotice(nrqlQueryText, qm, resultRowCount(results), config.MaxRows, paged, truncated)
+	if rowLimited {
+		formatter.AppendNotices(resp, rowNotice)
+	}
+	for _, issue := range lintIssues {
+		if issue.Rule == LintSelectStar && rowLimited {
+			// The row limit notice already explains the missing rows
+			continue
+		}
+		formatter.AppendNotices(resp, data.Notice{Severity: data.NoticeSeverityWarning, Text: issue.Msg})
+	}
+	if splitNotice != nil {
+		formatter.AppendNotices(resp, *splitNotice)
+	}
+	formatter.AppendNotices(resp, unsupportedFeatureNotices(unsupported)...)
+	if len(unknownFields) > 0 {
+		formatter.AppendNotices(resp, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Unknown query field(s) ignored: %s", strings.Join(unknownFields, ", ")),
+		})
+	}
+	return resp
+}
+
+// buildNRQL returns the query text sent to New Relic for the time range,
+// interval and maxDataPoints of query: time range macros are expanded, the
+// ad-hoc filters, time range and time zone applied, buckets fitted to the panel
+// when alignBuckets is set, and pagination and the automatic limit added.
+func buildNRQL(logger log.Logger, text string, qm models.QueryModel, query backend.DataQuery, alignBuckets bool) (string, error) {
+	// Expand time range macros such as $__timeFilter and $__interval
+	text, err := expandMacros(text, query.TimeRange, query.Interval)
+	if err != nil {
+		logger.Error("Failed to expand query macros", "refId", query.RefID, "error", err)
+		return "", err
+	}
+	text, err = applyFilters(text, qm.Filters)
+	if err != nil {
+		logger.Error("Failed to apply ad-hoc filters", "refId", query.RefID, "error", err)
+		return "", err
+	}
+	if !qm.IgnoreTimeRange {
+		text = applyTimeRange(text, query.TimeRange)
+	}
+	if qm.UseTimeZone {
+		text, err = applyTimeZone(text, qm.TimeZone, query.TimeRange)
+		if err != nil {
+			logger.Error("Invalid time zone", "refId", query.RefID, "timeZone", qm.TimeZone, "error", err)
+			return "", err
+		}
+	}
+	if alignBuckets {
+		text = alignToMaxDataPoints(text, query.TimeRange, query.MaxDataPoints)
+	}
+
+	if err := validatePagination(text, qm.PageSize, qm.PageIndex); err != nil {
+		logger.Error("Invalid pagination options", "refId", query.RefID, "pageSize", qm.PageSize, "pageIndex", qm.PageIndex, "error", err)
+		return "", err
+	}
+	text = applyPagination(text, qm.PageSize, qm.PageIndex)
+	if qm.AutoLimit {
+		text = applyAutoLimit(text)
+	}
+	return text, nil
+}
+
+// queryLogger returns the logger for a query, tagged with the trace ID when one is known.
+func queryLogger(traceID string) log.Logger {
+	if traceID == "" {
+		return log.DefaultLogger
+	}
+	return log.DefaultLogger.With("traceID", traceID)
+}
+
+// formatResults converts the executor results into a DataResponse with opts,
+// picking the formatter that matches the result container type. When the query
+// sets explainRouting, the routing trace is attached to the frame metadata.
+func formatResults(results interface{}, qm models.QueryModel, opts formatter.FormatOptions, query backend.DataQuery) *backend.DataResponse {
+	var resp *backend.DataResponse
+	var trace *formatter.RoutingTrace
+
+	if qm.RawFields {
+		return formatRawResults(results, qm, query)
 	}
 
 	switch r := results.(type) {
 	case *nrdb.NRDBResultContainer:
 		log.DefaultLogger.Debug("Using standard formatter", "refId", query.RefID)
-		return formatter.FormatQueryResults(r, query)
+		resp = formatter.FormatQueryResultsWithOptions(r, query, opts)
+		if qm.ExplainRouting {
+			trace = formatter.ExplainRouting(r)
+			trace.Executor = models.ResultModeStandard
+		}
 	case *nrdb.NRDBResultContainerMultiResultCustomized:
-		log.DefaultLogger.Debug("Using faceted timeseries formatter", "refId", query.RefID)
-		return formatter.FormatFacetedTimeseriesResults(r, query)
+		if qm.ResultMode == models.ResultModeMulti && !formatter.IsFacetedTimeseriesResult(r) {
+			// The multi path was forced for a query that is not faceted timeseries,
+			// so format its results like a standard query.
+			log.DefaultLogger.Debug("Using standard formatter for forced multi result", "refId", query.RefID)
+			standard := &nrdb.NRDBResultContainer{Results: r.Results, Metadata: r.Metadata}
+			resp = formatter.FormatQueryResultsWithOptions(standard, query, opts)
+			if qm.ExplainRouting {
+				trace = formatter.ExplainRouting(standard)
+			}
+		} else {
+			log.DefaultLogger.Debug("Using faceted timeseries formatter", "refId", query.RefID)
+			resp = formatter.FormatFacetedTimeseriesResultsWithOptions(r, query, opts)
+			if qm.ExplainRouting {
+				trace = formatter.ExplainRoutingMulti(r)
+			}
+		}
+		if trace != nil {
+			trace.Executor = models.ResultModeMulti
+		}
 	default:
-		resp.Error = fmt.Errorf("unexpected result type from NRQL query execution")
-		log.DefaultLogger.Error("Unexpected result type", "refId", query.RefID, "type", fmt.Sprintf("%T", results))
-		return resp
+		return &backend.DataResponse{Error: fmt.Errorf("unexpected result type from NRQL query execution")}
+	}
+
+	formatter.AttachRoutingTrace(resp, trace)
+	return resp
+}
+
+// dedicatedFormatter returns the formatter for results that a dedicated Grafana
+// panel renders, such as logs and traces, or nil if the results are formatted as
+// data frames for the general-purpose panels.
+func dedicatedFormatter(queryType string, nrqlQueryText string, results interface{}) func(*nrdb.NRDBResultContainer) *backend.DataResponse {
+	switch {
+	case useLogsFormat(queryType, nrqlQueryText, results):
+		return formatter.FormatLogResults
+	case useTracesFormat(queryType, nrqlQueryText, results):
+		return formatter.FormatTraceResults
+	}
+	return nil
+}
+
+// formatOptions returns the formatter options requested by the query, with the
+// field type rules of the datasource.
+func formatOptions(qm models.QueryModel, config *models.PluginSettings) formatter.FormatOptions {
+	return formatter.FormatOptions{
+		KeepUnfaceted: qm.KeepUnfaceted,
+		JoinUniques:   qm.JoinUniques,
+		Columns:       qm.Columns,
+		FacetTime:     qm.FacetTime,
+		FillMode:      qm.FillMode,
+		FacetOrder:    qm.FacetOrder,
+		Wide:          qm.Format == models.FormatWide,
+		FlattenDepth:  qm.FlattenDepth,
+		FieldTypes:    config.FieldTypes,
+	}
+}
+
+// formatRawResults formats the executor results with the raw field formatter,
+// keeping column names exactly as New Relic returns them.
+func formatRawResults(results interface{}, qm models.QueryModel, query backend.DataQuery) *backend.DataResponse {
+	var resp *backend.DataResponse
+	var trace *formatter.RoutingTrace
+
+	switch r := results.(type) {
+	case *nrdb.NRDBResultContainer:
+		log.DefaultLogger.Debug("Using raw fields formatter", "refId", query.RefID)
+		resp = formatter.FormatRawResults(r, query)
+		if qm.ExplainRouting {
+			trace = formatter.ExplainRouting(r)
+			trace.Executor = models.ResultModeStandard
+		}
+	case *nrdb.NRDBResultContainerMultiResultCustomized:
+		log.DefaultLogger.Debug("Using raw fields formatter for multi result", "refId", query.RefID)
+		resp = formatter.FormatRawResultsMulti(r, query)
+		if qm.ExplainRouting {
+			trace = formatter.ExplainRoutingMulti(r)
+			trace.Executor = models.ResultModeMulti
+		}
+	default:
+		return &backend.DataResponse{Error: fmt.Errorf("unexpected result type from NRQL query execution")}
+	}
+
+	if trace != nil {
+		trace.Formatter = formatter.FormatterRawFields
 	}
+	formatter.AttachRoutingTrace(resp, trace)
+	return resp
 }
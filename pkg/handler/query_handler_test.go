@@ -4,14 +4,25 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"newrelic-grafana-plugin/pkg/formatter"
 	"newrelic-grafana-plugin/pkg/models"
 	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	sdktracing "github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	nrErrors "github.com/newrelic/newrelic-client-go/v2/pkg/errors"
 	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 // mockNRDBExecutor implements the nrdbiface.NRDBQueryExecutor interface for testing
@@ -426,6 +437,220 @@ func TestExecuteNRQLQueryEdgeCases_QueryHandler(t *testing.T) {
 	})
 }
 
+// routingNRDBExecutor records which executor path was used for a query
+type routingNRDBExecutor struct {
+	standardCalls   int
+	multiCalls      int
+	lastQuery       nrdb.NRQL
+	standardResults *nrdb.NRDBResultContainer
+	multiResults    *nrdb.NRDBResultContainerMultiResultCustomized
+}
+
+func (m *routingNRDBExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	m.standardCalls++
+	m.lastQuery = query
+	if m.standardResults != nil {
+		return m.standardResults, nil
+	}
+	return &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": 42.0}}}, nil
+}
+
+func (m *routingNRDBExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	m.multiCalls++
+	m.lastQuery = query
+	if m.multiResults != nil {
+		return m.multiResults, nil
+	}
+	return &nrdb.NRDBResultContainerMultiResultCustomized{Results: []nrdb.NRDBResult{{"count": 42.0}}}, nil
+}
+
+func TestExecuteNRQLQueryWithMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		resultMode    string
+		expectedMulti bool
+	}{
+		{"auto faceted timeseries", "SELECT count(*) FROM Transaction FACET appName TIMESERIES", models.ResultModeAuto, true},
+		{"empty mode behaves as auto", "SELECT count(*) FROM Transaction FACET appName TIMESERIES", "", true},
+		{"auto facet only", "SELECT count(*) FROM Transaction FACET appName", models.ResultModeAuto, false},
+		{"auto keywords inside literals", "SELECT count(*) FROM Transaction WHERE name IN ('FACET', 'TIMESERIES')", models.ResultModeAuto, false},
+		{"auto keyword inside literal with real facet", "SELECT count(*) FROM Transaction WHERE name = 'TIMESERIES' FACET appName", models.ResultModeAuto, false},
+		{"forced standard", "SELECT count(*) FROM Transaction FACET appName TIMESERIES", models.ResultModeStandard, false},
+		{"forced multi", "SELECT count(*) FROM Transaction", models.ResultModeMulti, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &routingNRDBExecutor{}
+			_, err := ExecuteNRQLQueryWithMode(context.Background(), executor, 123456, tt.query, tt.resultMode)
+			assert.NoError(t, err)
+			if tt.expectedMulti {
+				assert.Equal(t, 1, executor.multiCalls)
+				assert.Equal(t, 0, executor.standardCalls)
+			} else {
+				assert.Equal(t, 0, executor.multiCalls)
+				assert.Equal(t, 1, executor.standardCalls)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_ResultMode(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+
+	t.Run("invalid result mode", func(t *testing.T) {
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction", "resultMode": "bogus"}`),
+		}
+
+		resp := HandleQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+		assert.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid resultMode")
+	})
+
+	t.Run("forced multi on non-faceted query formats as standard", func(t *testing.T) {
+		executor := &routingNRDBExecutor{}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction", "resultMode": "multi"}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		assert.NoError(t, resp.Error)
+		assert.Equal(t, 1, executor.multiCalls)
+		assert.NotEmpty(t, resp.Frames)
+	})
+}
+
+func TestHandleQuery_ExplainRouting(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+
+	t.Run("trace attached when requested", func(t *testing.T) {
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction", "explainRouting": true}`),
+		}
+
+		resp := HandleQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+		assert.NoError(t, resp.Error)
+		assert.NotEmpty(t, resp.Frames)
+		for _, frame := range resp.Frames {
+			custom, ok := frame.Meta.Custom.(map[string]interface{})
+			assert.True(t, ok)
+			trace, ok := custom[formatter.RoutingTraceMetaKey].(*formatter.RoutingTrace)
+			assert.True(t, ok)
+			assert.Equal(t, models.ResultModeStandard, trace.Executor)
+			assert.Equal(t, formatter.DetectorSimpleCount, trace.Detector)
+			assert.Equal(t, "formatSimpleCountQuery", trace.Formatter)
+		}
+	})
+
+	t.Run("trace attached for multi executor", func(t *testing.T) {
+		executor := &routingNRDBExecutor{
+			multiResults: &nrdb.NRDBResultContainerMultiResultCustomized{
+				Results:  []nrdb.NRDBResult{{"count": 3.0, "facet": "app1", "beginTimeSeconds": 1700000000.0}},
+				Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+			},
+		}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName TIMESERIES", "explainRouting": true}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		assert.NoError(t, resp.Error)
+		assert.NotEmpty(t, resp.Frames)
+		custom := resp.Frames[0].Meta.Custom.(map[string]interface{})
+		trace := custom[formatter.RoutingTraceMetaKey].(*formatter.RoutingTrace)
+		assert.Equal(t, models.ResultModeMulti, trace.Executor)
+		assert.Equal(t, formatter.DetectorFacetedTimeseriesMulti, trace.Detector)
+		assert.Equal(t, []string{"appName"}, trace.Facets)
+	})
+
+	t.Run("no trace by default", func(t *testing.T) {
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction"}`),
+		}
+
+		resp := HandleQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+		assert.NoError(t, resp.Error)
+		for _, frame := range resp.Frames {
+			if frame.Meta == nil {
+				continue
+			}
+			custom, _ := frame.Meta.Custom.(map[string]interface{})
+			assert.NotContains(t, custom, formatter.RoutingTraceMetaKey)
+		}
+	})
+}
+
+func TestHandleQuery_RawFields(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction", "rawFields": true, "explainRouting": true}`),
+	}
+
+	resp := HandleQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+	assert.NoError(t, resp.Error)
+	assert.Len(t, resp.Frames, 1)
+	assert.Len(t, resp.Frames[0].Fields, 1)
+	assert.Equal(t, "count", resp.Frames[0].Fields[0].Name)
+
+	custom := resp.Frames[0].Meta.Custom.(map[string]interface{})
+	trace := custom[formatter.RoutingTraceMetaKey].(*formatter.RoutingTrace)
+	assert.Equal(t, formatter.FormatterRawFields, trace.Formatter)
+}
+
+func TestHandleQuery_UnknownFields(t *testing.T) {
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction", "acountID": 789012}`),
+	}
+
+	t.Run("lenient mode attaches a notice", func(t *testing.T) {
+		config := &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{AccountId: 123456},
+		}
+
+		resp := HandleQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+		assert.NoError(t, resp.Error)
+		assert.NotEmpty(t, resp.Frames)
+		for _, frame := range resp.Frames {
+			assert.Len(t, frame.Meta.Notices, 1)
+			assert.Contains(t, frame.Meta.Notices[0].Text, "acountID")
+		}
+	})
+
+	t.Run("strict mode rejects the query", func(t *testing.T) {
+		config := &models.PluginSettings{
+			StrictQueryParsing: true,
+			Secrets:            &models.SecretPluginSettings{AccountId: 123456},
+		}
+		executor := &routingNRDBExecutor{}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		assert.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "unknown query field(s): acountID")
+		assert.Equal(t, 0, executor.standardCalls)
+	})
+}
+
 func TestHandleEdgeCases_QueryHandler(t *testing.T) {
 	t.Run("invalid JSON query model", func(t *testing.T) {
 		mockExecutor := &mockNRDBExecutor{}
@@ -471,3 +696,524 @@ func TestHandleEdgeCases_QueryHandler(t *testing.T) {
 		assert.Contains(t, response.Error.Error(), "query text cannot be empty")
 	})
 }
+
+func TestHandleQuery_TraceID(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction"}`),
+	}
+
+	t.Run("trace ID attached when the request is traced", func(t *testing.T) {
+		traceID, err := oteltrace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		require.NoError(t, err)
+		spanID, err := oteltrace.SpanIDFromHex("00f067aa0ba902b7")
+		require.NoError(t, err)
+		ctx := oteltrace.ContextWithSpanContext(context.Background(), oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+
+		resp := HandleQuery(ctx, &routingNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		for _, frame := range resp.Frames {
+			custom, ok := frame.Meta.Custom.(map[string]interface{})
+			require.True(t, ok)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", custom[formatter.TraceIDMetaKey])
+		}
+	})
+
+	t.Run("no trace ID without a span", func(t *testing.T) {
+		resp := HandleQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		for _, frame := range resp.Frames {
+			if frame.Meta == nil {
+				continue
+			}
+			custom, _ := frame.Meta.Custom.(map[string]interface{})
+			assert.NotContains(t, custom, formatter.TraceIDMetaKey)
+		}
+	})
+}
+
+func TestHandleQuery_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	sdktracing.InitDefaultTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"))
+	defer sdktracing.InitDefaultTracer(otel.Tracer("test"))
+
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction"}`),
+	}
+
+	ctx := tracing.WithVerbosity(context.Background(), tracing.VerbosityDetailed)
+	resp := HandleQuery(ctx, &routingNRDBExecutor{}, config, query)
+	require.NoError(t, resp.Error)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "newrelic.nrql.execute")
+	require.Contains(t, spans, "newrelic.format")
+	require.Contains(t, spans, "newrelic.format.display")
+	attributes := make(map[string]interface{})
+	for _, kv := range spans["newrelic.nrql.execute"].Attributes() {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, int64(123456), attributes["accountId"])
+	assert.Equal(t, "SELECT count(*) FROM Transaction", attributes["nrql"])
+	assert.Equal(t, false, attributes["paged"])
+}
+
+func TestHandleQuery_QueryInfo(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction $__timeFilter"}`),
+		TimeRange: backend.TimeRange{
+			From: time.UnixMilli(1700000000000),
+			To:   time.UnixMilli(1700003600000),
+		},
+	}
+	executor := &routingNRDBExecutor{standardResults: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"count": 42.0}},
+		RawResponse: nrdb.NRDBRawResults{
+			"performanceStats": map[string]interface{}{"inspectedCount": 32420.0, "wallClockTime": 34.0},
+		},
+	}}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+	for _, frame := range resp.Frames {
+		require.NotNil(t, frame.Meta)
+		assert.Equal(t, "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700003600000", frame.Meta.ExecutedQueryString)
+
+		custom, ok := frame.Meta.Custom.(map[string]interface{})
+		require.True(t, ok)
+		stats, ok := custom[formatter.QueryStatsMetaKey].(*formatter.QueryStats)
+		require.True(t, ok)
+		assert.Equal(t, 123456, stats.AccountID)
+		assert.Equal(t, 32420.0, stats.Performance["inspectedCount"])
+
+		var names []string
+		for _, stat := range frame.Meta.Stats {
+			names = append(names, stat.DisplayName)
+		}
+		assert.Equal(t, []string{"Wall clock time", "NRDB inspected count", "NRDB wall clock time"}, names)
+	}
+}
+
+func TestHandleQuery_ErrorSource(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FORM Transaction"}`)}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus backend.Status
+		wantMsg    string
+	}{
+		{"auth failure", nrErrors.NewUnauthorizedError(), backend.StatusUnauthorized, "New Relic rejected the API key"},
+		{"rate limit", nrErrors.NewUnexpectedStatusCode(429, "Too Many Requests"), backend.StatusTooManyRequests, "rate limit reached"},
+		{"syntax error", errors.New("NRQL Syntax Error: unexpected 'FORM'"), backend.StatusBadRequest, "NRQL syntax error"},
+		{"timeout", context.DeadlineExceeded, backend.StatusTimeout, "the query timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := HandleQuery(context.Background(), &mockNRDBExecutor{queryErr: tt.err}, config, query)
+			require.Error(t, resp.Error)
+			assert.Equal(t, backend.ErrorSourceDownstream, resp.ErrorSource)
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			assert.Contains(t, resp.Error.Error(), tt.wantMsg)
+			assert.ErrorIs(t, resp.Error, tt.err)
+		})
+	}
+}
+
+func TestHandleQuery_Pagination(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+
+	t.Run("page translated to LIMIT and OFFSET", func(t *testing.T) {
+		executor := &routingNRDBExecutor{
+			standardResults: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+				{"name": "a"}, {"name": "b"},
+			}},
+		}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT name FROM Transaction SINCE 1 day ago", "pageSize": 2, "pageIndex": 3}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		assert.Equal(t, nrdb.NRQL("SELECT name FROM Transaction SINCE 1 day ago LIMIT 2 OFFSET 6"), executor.lastQuery)
+
+		require.NotEmpty(t, resp.Frames)
+		custom, ok := resp.Frames[0].Meta.Custom.(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, &formatter.Pagination{PageSize: 2, PageIndex: 3, Rows: 2, HasMore: true}, custom[formatter.PaginationMetaKey])
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		executor := &routingNRDBExecutor{
+			standardResults: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"name": "a"}}},
+		}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT name FROM Transaction", "pageSize": 2}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		custom := resp.Frames[0].Meta.Custom.(map[string]interface{})
+		pagination := custom[formatter.PaginationMetaKey].(*formatter.Pagination)
+		assert.False(t, pagination.HasMore)
+	})
+
+	t.Run("query unchanged without pageSize", func(t *testing.T) {
+		executor := &routingNRDBExecutor{}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction"}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		assert.Equal(t, nrdb.NRQL("SELECT count(*) FROM Transaction"), executor.lastQuery)
+	})
+
+	t.Run("invalid options rejected before execution", func(t *testing.T) {
+		executor := &routingNRDBExecutor{}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT name FROM Transaction LIMIT 10", "pageSize": 2}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		assert.ErrorContains(t, resp.Error, "cannot be combined with a LIMIT or OFFSET clause")
+		assert.Equal(t, 0, executor.standardCalls+executor.multiCalls)
+	})
+}
+
+func TestHandleQuery_FacetAs(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	executor := &routingNRDBExecutor{
+		standardResults: &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"count": 10.0, "facet": "app1", "appName": "app1"},
+				{"count": 20.0, "facet": "app2", "appName": "app2"},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		},
+	}
+
+	t.Run("column", func(t *testing.T) {
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName", "facetAs": "column"}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		for _, frame := range resp.Frames {
+			column, _ := frame.FieldByName("appName")
+			assert.NotNil(t, column)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName", "facetAs": "rows"}`),
+		}
+
+		resp := HandleQuery(context.Background(), executor, config, query)
+		assert.EqualError(t, resp.Error, "invalid facetAs 'rows': must be one of labels, column, both")
+	})
+}
+
+func TestHandleQuery_KeepUnfaceted(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+		},
+	}
+	executor := &routingNRDBExecutor{
+		standardResults: &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{
+				{"facet": "app1", "average.duration": 1.0, "beginTimeSeconds": 1700000000.0},
+				{"average.duration": 2.0, "beginTimeSeconds": 1700000000.0},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"appName"}},
+		},
+	}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT average(duration) FROM Transaction FACET appName", "keepUnfaceted": true}`),
+	}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+
+	var names []string
+	for _, frame := range resp.Frames {
+		names = append(names, frame.Name)
+	}
+	assert.ElementsMatch(t, []string{"app1", formatter.UnfacetedGroupName}, names)
+}
+
+// TestHandleQuery_VerifyFormatter ensures dual-write verification runs the candidate
+// formatter but always serves the legacy output.
+func TestHandleQuery_VerifyFormatter(t *testing.T) {
+	original := formatter.CandidateFormatter
+	defer func() { formatter.CandidateFormatter = original }()
+
+	candidateCalls := 0
+	formatter.CandidateFormatter = func(results interface{}, query backend.DataQuery, opts formatter.FormatOptions) *backend.DataResponse {
+		candidateCalls++
+		return &backend.DataResponse{Frames: data.Frames{data.NewFrame("candidate")}}
+	}
+
+	config := &models.PluginSettings{
+		VerifyFormatter: true,
+		Secrets:         &models.SecretPluginSettings{AccountId: 123456},
+	}
+	executor := &routingNRDBExecutor{
+		standardResults: &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{{"count": float64(42)}},
+		},
+	}
+	query := backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryText": "SELECT count(*) FROM Transaction"}`),
+	}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, 1, candidateCalls)
+	for _, frame := range resp.Frames {
+		assert.NotEqual(t, "candidate", frame.Name)
+	}
+
+	config.VerifyFormatter = false
+	HandleQuery(context.Background(), executor, config, query)
+	assert.Equal(t, 1, candidateCalls, "the candidate must not run when verification is disabled")
+}
+
+// TestHandleQuery_Macros verifies that time range macros are expanded before execution.
+func TestHandleQuery_Macros(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{AccountId: 123456},
+	}
+	executor := &routingNRDBExecutor{}
+	from := time.UnixMilli(1700000000000)
+	query := backend.DataQuery{
+		RefID:     "A",
+		JSON:      []byte(`{"queryText": "SELECT count(*) FROM Transaction $__timeFilter() TIMESERIES $__interval"}`),
+		TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+		Interval:  time.Minute,
+	}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	assert.Equal(t, nrdb.NRQL("SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700003600000 TIMESERIES 1 minute"), executor.lastQuery)
+
+	query.TimeRange = backend.TimeRange{}
+	resp = HandleQuery(context.Background(), executor, config, query)
+	var macroErr *MacroError
+	assert.ErrorAs(t, resp.Error, &macroErr)
+}
+
+// TestHandleQuery_TimeRange verifies the dashboard time range is applied to queries
+// without SINCE/UNTIL unless the query opts out.
+func TestHandleQuery_TimeRange(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{AccountId: 123456},
+	}
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+
+	tests := []struct {
+		name string
+		json string
+		want nrdb.NRQL
+	}{
+		{
+			name: "time range applied",
+			json: `{"queryText": "SELECT count(*) FROM Transaction"}`,
+			want: "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700003600000",
+		},
+		{
+			name: "opted out",
+			json: `{"queryText": "SELECT count(*) FROM Transaction", "ignoreTimeRange": true}`,
+			want: "SELECT count(*) FROM Transaction",
+		},
+		{
+			name: "dashboard time zone",
+			json: `{"queryText": "SELECT count(*) FROM Transaction", "timeZone": "Europe/Berlin", "useTimeZone": true}`,
+			want: "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700003600000 WITH TIMEZONE 'Europe/Berlin'",
+		},
+		{
+			name: "dashboard time zone not used",
+			json: `{"queryText": "SELECT count(*) FROM Transaction", "timeZone": "Europe/Berlin"}`,
+			want: "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700003600000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &routingNRDBExecutor{}
+			query := backend.DataQuery{RefID: "A", JSON: []byte(tt.json), TimeRange: timeRange}
+
+			resp := HandleQuery(context.Background(), executor, config, query)
+			require.NoError(t, resp.Error)
+			assert.Equal(t, tt.want, executor.lastQuery)
+		})
+	}
+}
+
+func TestHandleQuery_InvalidTimeZone(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	from := time.UnixMilli(1700000000000)
+	query := backend.DataQuery{
+		RefID:     "A",
+		JSON:      []byte(`{"queryText": "SELECT count(*) FROM Transaction", "timeZone": "Mars/Olympus", "useTimeZone": true}`),
+		TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour)},
+	}
+
+	executor := &routingNRDBExecutor{}
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "invalid timeZone 'Mars/Olympus'")
+	assert.Zero(t, executor.standardCalls)
+}
+
+func TestHandleQuery_InvalidFacetTime(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName", "facetTime": "start"}`)}
+
+	resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "invalid facetTime 'start'")
+}
+
+func TestHandleQuery_InvalidFillMode(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES", "fillMode": "linear"}`)}
+
+	resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "invalid fillMode 'linear'")
+}
+
+func TestHandleQuery_InvalidFacetOrder(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction FACET appName", "facetOrder": "random"}`)}
+
+	resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "invalid facetOrder 'random'")
+}
+
+func TestHandleQuery_NRDBNotices(t *testing.T) {
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{
+		Metadata: nrdb.NRDBMetadata{Messages: []string{"Event type 'Transactions' does not exist"}},
+	}}
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transactions"}`)}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	require.NotNil(t, resp.Frames[0].Meta)
+	assert.Equal(t, "SELECT count(*) FROM Transactions", resp.Frames[0].Meta.ExecutedQueryString)
+	assert.Contains(t, noticeTexts(resp), "New Relic: Event type 'Transactions' does not exist")
+}
+
+func TestHandleQuery_AutoLimit(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT uniques(appName) FROM Transaction", "autoLimit": true, "ignoreTimeRange": true}`)}
+
+	resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+	assert.Equal(t, "SELECT uniques(appName) FROM Transaction LIMIT MAX", resp.Frames[0].Meta.ExecutedQueryString)
+}
+
+func TestHandleQuery_MaxDataPoints(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	from := time.Unix(1700000000, 0)
+	timeRange := backend.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+
+	t.Run("fits the TIMESERIES bucket to the panel", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", TimeRange: timeRange, MaxDataPoints: 100, JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES"}`)}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		assert.Equal(t, "SELECT count(*) FROM Transaction TIMESERIES 15 minutes SINCE 1700000000000 UNTIL 1700086400000", resp.Frames[0].Meta.ExecutedQueryString)
+	})
+
+	t.Run("ignoreMaxPoints keeps the query", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", TimeRange: timeRange, MaxDataPoints: 100, JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES", "ignoreMaxPoints": true}`)}
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.NoError(t, resp.Error)
+		require.NotEmpty(t, resp.Frames)
+		assert.Equal(t, "SELECT count(*) FROM Transaction TIMESERIES SINCE 1700000000000 UNTIL 1700086400000", resp.Frames[0].Meta.ExecutedQueryString)
+	})
+}
+
+func TestHandleQuery_DualOutput(t *testing.T) {
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"beginTimeSeconds": float64(1700000000), "endTimeSeconds": float64(1700000060), "average.duration": 0.5},
+			{"beginTimeSeconds": float64(1700000060), "endTimeSeconds": float64(1700000120), "average.duration": 0.75},
+		},
+	}}
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	queryText := `"queryText": "SELECT average(duration) FROM Transaction TIMESERIES 1 minute SINCE 1700000000000 UNTIL 1700000120000"`
+
+	resp := HandleQuery(context.Background(), executor, config, backend.DataQuery{RefID: "A", JSON: []byte(`{` + queryText + `}`)})
+	require.NoError(t, resp.Error)
+	frames := len(resp.Frames)
+
+	resp = HandleQuery(context.Background(), executor, config, backend.DataQuery{RefID: "A", JSON: []byte(`{` + queryText + `, "dualOutput": true}`)})
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, frames+1)
+	table := resp.Frames[len(resp.Frames)-1]
+	assert.Equal(t, formatter.TableViewFrameName, table.Name)
+	assert.EqualValues(t, data.VisTypeTable, table.Meta.PreferredVisualization)
+	assert.EqualValues(t, data.VisTypeGraph, resp.Frames[0].Meta.PreferredVisualization)
+	rows, err := table.RowLen()
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+}
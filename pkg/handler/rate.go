@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ratePattern matches the interval argument of an NRQL rate() call, e.g.
+// rate(count(*), 5 minutes).
+var ratePattern = regexp.MustCompile(`(?i)\brate\s*\((?:[^()]|\([^()]*\))*,\s*(\d+)?\s*(second|minute|hour|day|week)s?\s*\)`)
+
+// rateUnitSuffixes are the abbreviations of the rate() interval units.
+var rateUnitSuffixes = map[string]string{
+	"second": "s",
+	"minute": "min",
+	"hour":   "h",
+	"day":    "d",
+	"week":   "w",
+}
+
+// rateUnit returns the Grafana unit of the rate() results of query, e.g.
+// "suffix: /min" for rate(count(*), 1 minute) and "suffix: /5min" for an
+// interval of 5 minutes. It returns "" when the query has no rate() call or its
+// rate() calls use different intervals, since the fields cannot be told apart.
+func rateUnit(query string) string {
+	unit := ""
+	for _, match := range ratePattern.FindAllStringSubmatch(maskStringLiterals(query), -1) {
+		count := match[1]
+		if count == "1" {
+			count = ""
+		}
+		candidate := "suffix: /" + count + rateUnitSuffixes[strings.ToLower(match[2])]
+		if unit != "" && unit != candidate {
+			return ""
+		}
+		unit = candidate
+	}
+	return unit
+}
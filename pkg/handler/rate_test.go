@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateUnit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "SELECT rate(count(*), 1 minute) FROM Transaction", want: "suffix: /min"},
+		{query: "SELECT rate(sum(duration), 5 minutes) FROM Transaction TIMESERIES", want: "suffix: /5min"},
+		{query: "SELECT rate(count(*), 1 second), rate(count(*), 1 SECOND) FROM Transaction", want: "suffix: /s"},
+		{query: "SELECT rate(count(*), 1 minute), rate(count(*), 1 hour) FROM Transaction", want: ""},
+		{query: "SELECT count(*) FROM Transaction WHERE name = 'rate(x, 1 minute)'", want: ""},
+		{query: "SELECT count(*) FROM Transaction", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, rateUnit(tt.query))
+		})
+	}
+}
+
+func TestHandleQuery_RateUnit(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"rate.count": 12.5, "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700000060.0},
+	}}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT rate(count(*), 1 minute) FROM Transaction TIMESERIES"}`)}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+
+	var rate bool
+	for _, field := range resp.Frames[0].Fields {
+		if field.Name == "rate.count" {
+			rate = true
+			require.NotNil(t, field.Config)
+			assert.Equal(t, "suffix: /min", field.Config.Unit)
+		}
+	}
+	assert.True(t, rate, "expected a rate.count field")
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// MaxSplitRange is the most queries the time range of a query is split into.
+const MaxSplitRange = 24
+
+// validateSplitRange checks the number of queries a query's time range is split into.
+func validateSplitRange(qm models.QueryModel) error {
+	if qm.SplitRange < 0 || qm.SplitRange > MaxSplitRange {
+		return fmt.Errorf("invalid splitRange %d: must be between 0 and %d", qm.SplitRange, MaxSplitRange)
+	}
+	return nil
+}
+
+// splitIneligibility returns why the time range of a query cannot be split, or
+// "" if it can. Only TIMESERIES queries over the dashboard time range are
+// split, since their buckets can be stitched back into continuous series. Call
+// it before macros are expanded.
+func splitIneligibility(query string, qm models.QueryModel, timeRange backend.TimeRange) string {
+	switch {
+	case !containsKeyword(query, "TIMESERIES"):
+		return "only TIMESERIES queries are split"
+	case containsKeyword(query, "COMPARE"):
+		return "COMPARE WITH queries are not split"
+	case !followsDashboardRange(query, qm.IgnoreTimeRange) || timeRange.From.IsZero() || timeRange.To.IsZero():
+		return "only queries over the dashboard time range are split"
+	case qm.PageSize > 0:
+		return "paginated queries are not split"
+	}
+	return ""
+}
+
+// planSplit returns the time ranges a query requesting splitRange runs over,
+// or nil if it runs as a single query. A query that cannot be split gets a
+// notice telling why.
+func planSplit(query string, qm models.QueryModel, dataQuery backend.DataQuery) ([]backend.TimeRange, *data.Notice) {
+	if qm.SplitRange <= 1 {
+		return nil, nil
+	}
+	if reason := splitIneligibility(query, qm, dataQuery.TimeRange); reason != "" {
+		return nil, &data.Notice{Severity: data.NoticeSeverityInfo, Text: fmt.Sprintf("splitRange ignored: %s", reason)}
+	}
+	ranges := splitTimeRange(dataQuery.TimeRange, qm.SplitRange, 0)
+	if len(ranges) < 2 {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// splitTimeRange splits the time range into at most n consecutive ranges of
+// equal length, the last one possibly shorter. When bucket is known, the length
+// is rounded up to whole buckets, so no TIMESERIES bucket straddles two ranges.
+func splitTimeRange(timeRange backend.TimeRange, n int, bucket time.Duration) []backend.TimeRange {
+	span := timeRange.Duration()
+	if n < 1 || span <= 0 {
+		return nil
+	}
+	part := (span + time.Duration(n) - 1) / time.Duration(n)
+	if bucket > 0 {
+		part = (part + bucket - 1) / bucket * bucket
+	}
+	var ranges []backend.TimeRange
+	for from := timeRange.From; from.Before(timeRange.To); from = from.Add(part) {
+		to := from.Add(part)
+		if to.After(timeRange.To) {
+			to = timeRange.To
+		}
+		ranges = append(ranges, backend.TimeRange{From: from, To: to})
+	}
+	return ranges
+}
+
+// splitMaxDataPoints returns the points each of n split queries may return, so
+// the stitched series have at most maxDataPoints.
+func splitMaxDataPoints(maxDataPoints int64, n int) int64 {
+	if maxDataPoints <= 0 || n < 1 {
+		return maxDataPoints
+	}
+	return (maxDataPoints + int64(n) - 1) / int64(n)
+}
+
+// timeseriesBucketOf returns the explicit TIMESERIES bucket of a query, or 0
+// when it has none or lets New Relic choose it.
+func timeseriesBucketOf(query string) time.Duration {
+	masked := maskStringLiterals(query)
+	start := topLevelKeyword(masked, "TIMESERIES", 0)
+	if start < 0 {
+		return 0
+	}
+	end := clauseEnd(masked, start+len("TIMESERIES"))
+	bucket, _ := parseNRQLDuration(strings.TrimSpace(query[start+len("TIMESERIES") : end]))
+	return bucket
+}
+
+// executeSplit runs a query over each of the time ranges in turn, with the
+// query text build returns for it, and stitches the results into one result
+// as if a single query had returned every bucket. It fails if any part fails.
+func executeSplit(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, resultMode string, query backend.DataQuery, ranges []backend.TimeRange, build func(backend.DataQuery) (string, error)) (interface{}, error) {
+	parts := make([]interface{}, 0, len(ranges))
+	for i, timeRange := range ranges {
+		part := query
+		part.TimeRange = timeRange
+		part.MaxDataPoints = splitMaxDataPoints(query.MaxDataPoints, len(ranges))
+		text, err := build(part)
+		if err != nil {
+			return nil, err
+		}
+		results, err := ExecuteNRQLQueryWithMode(ctx, executor, accountID, text, resultMode)
+		if err != nil {
+			return nil, fmt.Errorf("time range part %d of %d: %w", i+1, len(ranges), err)
+		}
+		parts = append(parts, results)
+	}
+	return mergeSplitResults(parts)
+}
+
+// mergeSplitResults returns a result with the result rows of the parts of a
+// split query, in order. The parts are not modified, since they may be cached.
+// The metadata is the first part's, with the time window extended to the last
+// part's end and the messages of every part.
+func mergeSplitResults(parts []interface{}) (interface{}, error) {
+	switch first := parts[0].(type) {
+	case *nrdb.NRDBResultContainer:
+		merged := *first
+		merged.Results = slices.Clone(first.Results)
+		merged.Metadata.Messages = slices.Clone(first.Metadata.Messages)
+		for _, part := range parts[1:] {
+			next, ok := part.(*nrdb.NRDBResultContainer)
+			if !ok || next == nil {
+				return nil, fmt.Errorf("unexpected result type %T", part)
+			}
+			merged.Results = append(merged.Results, next.Results...)
+			mergeSplitMetadata(&merged.Metadata, next.Metadata)
+		}
+		return &merged, nil
+	case *nrdb.NRDBResultContainerMultiResultCustomized:
+		merged := *first
+		merged.Results = slices.Clone(first.Results)
+		merged.OtherResult = slices.Clone(first.OtherResult)
+		merged.Metadata.Messages = slices.Clone(first.Metadata.Messages)
+		for _, part := range parts[1:] {
+			next, ok := part.(*nrdb.NRDBResultContainerMultiResultCustomized)
+			if !ok || next == nil {
+				return nil, fmt.Errorf("unexpected result type %T", part)
+			}
+			merged.Results = append(merged.Results, next.Results...)
+			merged.OtherResult = append(merged.OtherResult, next.OtherResult...)
+			mergeSplitMetadata(&merged.Metadata, next.Metadata)
+		}
+		return &merged, nil
+	default:
+		return nil, fmt.Errorf("unexpected result type %T", parts[0])
+	}
+}
+
+// mergeSplitMetadata extends the metadata of the merged result with the next part's.
+func mergeSplitMetadata(merged *nrdb.NRDBMetadata, next nrdb.NRDBMetadata) {
+	if !time.Time(next.TimeWindow.End).IsZero() {
+		merged.TimeWindow.End = next.TimeWindow.End
+		merged.TimeWindow.Until = next.TimeWindow.Until
+	}
+	for _, message := range next.Messages {
+		if !slices.Contains(merged.Messages, message) {
+			merged.Messages = append(merged.Messages, message)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sinceUntilPattern = regexp.MustCompile(`SINCE (\d+) UNTIL (\d+)`)
+
+// bucketExecutor returns a TIMESERIES bucket per TIMESERIES interval of the
+// SINCE/UNTIL window of each query, like NRDB does.
+type bucketExecutor struct {
+	queries []string
+	failAt  int // Query at which execution fails, 0 for never
+}
+
+func (e *bucketExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.queries = append(e.queries, string(query))
+	if len(e.queries) == e.failAt {
+		return nil, errors.New("boom")
+	}
+	match := sinceUntilPattern.FindStringSubmatch(string(query))
+	if match == nil {
+		return nil, fmt.Errorf("no time window in %q", query)
+	}
+	since, _ := strconv.ParseInt(match[1], 10, 64)
+	until, _ := strconv.ParseInt(match[2], 10, 64)
+	bucket := timeseriesBucketOf(string(query)).Milliseconds()
+	if bucket == 0 {
+		return nil, fmt.Errorf("no TIMESERIES bucket in %q", query)
+	}
+
+	results := &nrdb.NRDBResultContainer{Metadata: nrdb.NRDBMetadata{Messages: []string{"sampled"}}}
+	for begin := since; begin < until; begin += bucket {
+		results.Results = append(results.Results, nrdb.NRDBResult{
+			"beginTimeSeconds": float64(begin / 1000),
+			"endTimeSeconds":   float64(min(begin+bucket, until) / 1000),
+			"count":            1.0,
+		})
+	}
+	return results, nil
+}
+
+func (e *bucketExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestSplitTimeRange(t *testing.T) {
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(10 * time.Hour)}
+
+	ranges := splitTimeRange(timeRange, 3, 0)
+	require.Len(t, ranges, 3)
+	assert.Equal(t, timeRange.From, ranges[0].From)
+	assert.Equal(t, timeRange.To, ranges[2].To)
+	for i := 1; i < len(ranges); i++ {
+		assert.Equal(t, ranges[i-1].To, ranges[i].From, "ranges are contiguous")
+	}
+
+	// Whole buckets: 10 hours in 3 parts of 4 hour-long buckets
+	ranges = splitTimeRange(timeRange, 3, time.Hour)
+	require.Len(t, ranges, 3)
+	assert.Equal(t, 4*time.Hour, ranges[0].Duration())
+	assert.Equal(t, 4*time.Hour, ranges[1].Duration())
+	assert.Equal(t, 2*time.Hour, ranges[2].Duration())
+
+	// Rounding to buckets may leave fewer parts
+	ranges = splitTimeRange(timeRange, 4, 6*time.Hour)
+	assert.Len(t, ranges, 2)
+
+	assert.Nil(t, splitTimeRange(backend.TimeRange{}, 3, 0))
+}
+
+func TestSplitIneligibility(t *testing.T) {
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(90 * 24 * time.Hour)}
+	tests := []struct {
+		name     string
+		query    string
+		qm       models.QueryModel
+		eligible bool
+	}{
+		{name: "timeseries", query: "SELECT count(*) FROM Transaction TIMESERIES", eligible: true},
+		{name: "faceted timeseries", query: "SELECT count(*) FROM Transaction FACET appName TIMESERIES 1 hour", eligible: true},
+		{name: "time filter macro", query: "SELECT count(*) FROM Transaction $__timeFilter TIMESERIES", eligible: true},
+		{name: "no timeseries", query: "SELECT count(*) FROM Transaction"},
+		{name: "compare with", query: "SELECT count(*) FROM Transaction TIMESERIES COMPARE WITH 1 week ago"},
+		{name: "own since", query: "SELECT count(*) FROM Transaction SINCE 1 week ago TIMESERIES"},
+		{name: "ignored time range", query: "SELECT count(*) FROM Transaction TIMESERIES", qm: models.QueryModel{IgnoreTimeRange: true}},
+		{name: "paginated", query: "SELECT count(*) FROM Transaction TIMESERIES", qm: models.QueryModel{PageSize: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := splitIneligibility(tt.query, tt.qm, timeRange)
+			assert.Equal(t, tt.eligible, reason == "", reason)
+		})
+	}
+}
+
+func TestValidateSplitRange(t *testing.T) {
+	assert.NoError(t, validateSplitRange(models.QueryModel{}))
+	assert.NoError(t, validateSplitRange(models.QueryModel{SplitRange: MaxSplitRange}))
+	assert.Error(t, validateSplitRange(models.QueryModel{SplitRange: -1}))
+	assert.Error(t, validateSplitRange(models.QueryModel{SplitRange: MaxSplitRange + 1}))
+}
+
+func TestMergeSplitResults(t *testing.T) {
+	first := &nrdb.NRDBResultContainer{
+		Results:  []nrdb.NRDBResult{{"count": 1.0}},
+		Metadata: nrdb.NRDBMetadata{Messages: []string{"a"}},
+	}
+	second := &nrdb.NRDBResultContainer{
+		Results:  []nrdb.NRDBResult{{"count": 2.0}},
+		Metadata: nrdb.NRDBMetadata{Messages: []string{"a", "b"}},
+	}
+	merged, err := mergeSplitResults([]interface{}{first, second})
+	require.NoError(t, err)
+	container := merged.(*nrdb.NRDBResultContainer)
+	assert.Len(t, container.Results, 2)
+	assert.Equal(t, []string{"a", "b"}, container.Metadata.Messages)
+	assert.Len(t, first.Results, 1, "the parts are not modified")
+	assert.Equal(t, []string{"a"}, first.Metadata.Messages)
+
+	multi := &nrdb.NRDBResultContainerMultiResultCustomized{Results: []nrdb.NRDBResult{{"facet": "a"}}}
+	merged, err = mergeSplitResults([]interface{}{multi, &nrdb.NRDBResultContainerMultiResultCustomized{Results: []nrdb.NRDBResult{{"facet": "a"}}}})
+	require.NoError(t, err)
+	assert.Len(t, merged.(*nrdb.NRDBResultContainerMultiResultCustomized).Results, 2)
+
+	_, err = mergeSplitResults([]interface{}{first, multi})
+	assert.Error(t, err)
+}
+
+func TestHandleQuery_SplitRange(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	from := time.UnixMilli(1700000000000).UTC()
+	query := backend.DataQuery{
+		RefID:         "A",
+		TimeRange:     backend.TimeRange{From: from, To: from.Add(90 * 24 * time.Hour)},
+		MaxDataPoints: 1000,
+		JSON:          []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES", "splitRange": 3}`),
+	}
+
+	executor := &bucketExecutor{}
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, executor.queries, 3)
+
+	// Every part has the same bucket: 30 days in at most 334 points
+	for _, sent := range executor.queries {
+		assert.Equal(t, 3*time.Hour, timeseriesBucketOf(sent), sent)
+	}
+
+	// The stitched series is continuous over the whole range
+	require.Len(t, resp.Frames, 1)
+	times := resp.Frames[0].Fields[0]
+	require.Equal(t, data.FieldTypeTime, times.Type())
+	require.Equal(t, 720, times.Len())
+	for i := 1; i < times.Len(); i++ {
+		step := times.At(i).(time.Time).Sub(times.At(i - 1).(time.Time))
+		require.Equal(t, 3*time.Hour, step, "row %d", i)
+	}
+}
+
+func TestHandleQuery_SplitRangeErrors(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(90 * 24 * time.Hour)}
+
+	// A failed part fails the query
+	query := backend.DataQuery{RefID: "A", TimeRange: timeRange, MaxDataPoints: 1000, JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES", "splitRange": 3}`)}
+	resp := HandleQuery(context.Background(), &bucketExecutor{failAt: 2}, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "time range part 2 of 3")
+
+	// Queries that cannot be split run whole, with a notice
+	query.JSON = []byte(`{"queryText": "SELECT count(*) FROM Transaction", "splitRange": 3}`)
+	executor := &mockNRDBExecutor{}
+	resp = HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	assert.Contains(t, noticeTexts(resp), "splitRange ignored: only TIMESERIES queries are split")
+
+	query.JSON = []byte(`{"queryText": "SELECT count(*) FROM Transaction TIMESERIES", "splitRange": 100}`)
+	resp = HandleQuery(context.Background(), &bucketExecutor{}, config, query)
+	assert.Error(t, resp.Error)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// MaxStatements is the most NRQL statements a query runs.
+const MaxStatements = 10
+
+// StatementLabel is the label of the series of a query statement, holding the
+// statement's alias.
+const StatementLabel = "statement"
+
+// validateStatements checks the statements of a query: each needs NRQL and an
+// alias no other statement has.
+func validateStatements(statements []models.QueryStatement) error {
+	if len(statements) > MaxStatements {
+		return fmt.Errorf("too many statements: %d, at most %d are allowed", len(statements), MaxStatements)
+	}
+	aliases := make(map[string]bool, len(statements))
+	for i, statement := range statements {
+		switch {
+		case statement.Alias == "":
+			return fmt.Errorf("statement %d has no alias", i+1)
+		case aliases[statement.Alias]:
+			return fmt.Errorf("duplicate statement alias '%s'", statement.Alias)
+		case statement.QueryText == "":
+			return fmt.Errorf("statement '%s' has no query text", statement.Alias)
+		case !models.IsValidAxis(statement.Axis):
+			return fmt.Errorf("invalid axis '%s' of statement '%s': must be one of left, right", statement.Axis, statement.Alias)
+		}
+		aliases[statement.Alias] = true
+	}
+	return nil
+}
+
+// handleStatements runs the statements of a query concurrently, each like a
+// query of its own with the options of the query, and merges their frames into
+// one response. The numeric fields of each statement are labeled with its alias
+// and placed on its axis. A failed statement fails the query.
+func handleStatements(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, config *models.PluginSettings, query backend.DataQuery, statements []models.QueryStatement) *backend.DataResponse {
+	logger := queryLogger(tracing.TraceIDFromContext(ctx))
+	if err := validateStatements(statements); err != nil {
+		logger.Error("Invalid query statements", "refId", query.RefID, "error", err)
+		return &backend.DataResponse{Error: err}
+	}
+
+	responses := make([]*backend.DataResponse, len(statements))
+	var wg sync.WaitGroup
+	for i, statement := range statements {
+		statementQuery := query
+		var err error
+		statementQuery.JSON, err = withQueryText(query.JSON, statement.QueryText)
+		if err != nil {
+			return &backend.DataResponse{Error: fmt.Errorf("error parsing query JSON: %w", err)}
+		}
+		wg.Add(1)
+		go func(i int, statementQuery backend.DataQuery) {
+			defer wg.Done()
+			responses[i] = HandleQuery(ctx, executor, config, statementQuery)
+		}(i, statementQuery)
+	}
+	wg.Wait()
+
+	resp := &backend.DataResponse{}
+	for i, statement := range statements {
+		statementResp := responses[i]
+		if statementResp.Error != nil {
+			logger.Error("Query statement failed", "refId", query.RefID, "statement", statement.Alias, "error", statementResp.Error)
+			return &backend.DataResponse{
+				Error:       fmt.Errorf("statement '%s': %w", statement.Alias, statementResp.Error),
+				Status:      statementResp.Status,
+				ErrorSource: statementResp.ErrorSource,
+			}
+		}
+		for _, frame := range statementResp.Frames {
+			labelStatementFields(frame, statement)
+		}
+		resp.Frames = append(resp.Frames, statementResp.Frames...)
+	}
+	logger.Debug("Merged query statements", "refId", query.RefID, "statements", len(statements), "frames", len(resp.Frames))
+	return resp
+}
+
+// labelStatementFields labels the numeric fields of a frame of a statement with
+// the statement's alias and places them on its axis.
+func labelStatementFields(frame *data.Frame, statement models.QueryStatement) {
+	for _, field := range frame.Fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		labels := make(data.Labels, len(field.Labels)+1)
+		for name, value := range field.Labels {
+			labels[name] = value
+		}
+		labels[StatementLabel] = statement.Alias
+		field.Labels = labels
+		if statement.Axis == "" {
+			continue
+		}
+		if field.Config == nil {
+			field.Config = &data.FieldConfig{}
+		}
+		if field.Config.Custom == nil {
+			field.Config.Custom = make(map[string]interface{})
+		}
+		field.Config.Custom["axisPlacement"] = statement.Axis
+	}
+}
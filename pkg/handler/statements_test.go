@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statementExecutor returns the results of the first event type a query reads
+// from. It is safe for concurrent use.
+type statementExecutor struct {
+	mu      sync.Mutex
+	queries []string
+	results map[string]*nrdb.NRDBResultContainer // By event type; missing event types fail
+}
+
+func (e *statementExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queries = append(e.queries, string(query))
+	for eventType, results := range e.results {
+		if strings.Contains(string(query), "FROM "+eventType) {
+			return results, nil
+		}
+	}
+	return nil, errors.New("unknown event type")
+}
+
+func (e *statementExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestValidateStatements(t *testing.T) {
+	valid := models.QueryStatement{Alias: "throughput", QueryText: "SELECT count(*) FROM Transaction"}
+	assert.NoError(t, validateStatements([]models.QueryStatement{valid, {Alias: "errors", QueryText: "SELECT count(*) FROM TransactionError", Axis: models.AxisRight}}))
+	assert.Error(t, validateStatements([]models.QueryStatement{valid, valid}), "duplicate alias")
+	assert.Error(t, validateStatements([]models.QueryStatement{{QueryText: "SELECT 1"}}), "missing alias")
+	assert.Error(t, validateStatements([]models.QueryStatement{{Alias: "a"}}), "missing query text")
+	assert.Error(t, validateStatements([]models.QueryStatement{{Alias: "a", QueryText: "SELECT 1", Axis: "top"}}))
+	assert.Error(t, validateStatements(make([]models.QueryStatement, MaxStatements+1)))
+}
+
+func TestHandleQuery_Statements(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	from := time.UnixMilli(1700000000000).UTC()
+	series := func(field string, values ...float64) *nrdb.NRDBResultContainer {
+		results := &nrdb.NRDBResultContainer{}
+		for i, value := range values {
+			begin := float64(from.Unix()) + float64(i*60)
+			results.Results = append(results.Results, nrdb.NRDBResult{"beginTimeSeconds": begin, "endTimeSeconds": begin + 60, field: value})
+		}
+		return results
+	}
+	executor := &statementExecutor{results: map[string]*nrdb.NRDBResultContainer{
+		"Transaction ":     series("count", 10, 12),
+		"TransactionError": series("percentage", 1.5, 2.5),
+	}}
+	query := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: from, To: from.Add(2 * time.Minute)},
+		JSON: []byte(`{"ignoreMaxPoints": true, "statements": [
+			{"alias": "throughput", "queryText": "SELECT count(*) FROM Transaction TIMESERIES 1 minute"},
+			{"alias": "error rate", "queryText": "SELECT percentage(count(*), WHERE error IS true) FROM TransactionError TIMESERIES 1 minute", "axis": "right"}
+		]}`),
+	}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, executor.queries, 2)
+	for _, sent := range executor.queries {
+		assert.Contains(t, sent, "SINCE 1700000000000 UNTIL 1700000120000", "statements get the dashboard time range")
+	}
+
+	values := map[string]*data.Field{}
+	for _, frame := range resp.Frames {
+		for _, field := range frame.Fields {
+			if field.Type().Numeric() {
+				values[field.Labels[StatementLabel]] = field
+			}
+		}
+	}
+	require.Len(t, values, 2)
+	assert.Equal(t, "count", values["throughput"].Name)
+	assert.True(t, values["throughput"].Config == nil || values["throughput"].Config.Custom["axisPlacement"] == nil, "no axis leaves the placement to the panel")
+	assert.Equal(t, "right", values["error rate"].Config.Custom["axisPlacement"])
+
+	// A failed statement fails the query
+	query.JSON = []byte(`{"statements": [
+		{"alias": "throughput", "queryText": "SELECT count(*) FROM Transaction TIMESERIES"},
+		{"alias": "pages", "queryText": "SELECT count(*) FROM PageView TIMESERIES"}
+	]}`)
+	resp = HandleQuery(context.Background(), executor, config, query)
+	require.Error(t, resp.Error)
+	assert.Contains(t, resp.Error.Error(), "statement 'pages'")
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
+)
+
+// queryTimeout returns how long a query may run: the query's own timeout if it
+// sets one, otherwise the datasource query timeout. Zero means no limit.
+func queryTimeout(qm models.QueryModel, config *models.PluginSettings) (time.Duration, error) {
+	if qm.Timeout != "" {
+		return timeutil.ParseDurationField("timeout", qm.Timeout)
+	}
+	if config.QueryTimeout != "" {
+		return timeutil.ParseDurationField("queryTimeout", config.QueryTimeout)
+	}
+	return 0, nil
+}
+
+// timeoutError returns the error for a query that ran into its timeout, or
+// nil if err was not caused by ctx reaching its deadline.
+func timeoutError(ctx context.Context, err error, timeout time.Duration) error {
+	if timeout <= 0 || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	return &errorsx.Error{
+		Kind: errorsx.KindTimeout,
+		Msg:  fmt.Sprintf("query timed out after %gs", timeout.Seconds()),
+		Err:  err,
+	}
+}
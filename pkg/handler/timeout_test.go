@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingExecutor blocks every query until its context is done.
+type blockingExecutor struct {
+	deadline time.Time // Deadline of the last query's context
+}
+
+func (e *blockingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.deadline, _ = ctx.Deadline()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (e *blockingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	e.deadline, _ = ctx.Deadline()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		setting string
+		want    time.Duration
+		wantErr string
+	}{
+		{name: "no timeout"},
+		{name: "datasource default", setting: "30s", want: 30 * time.Second},
+		{name: "query overrides default", query: "2m", setting: "30s", want: 2 * time.Minute},
+		{name: "invalid query timeout", query: "soon", wantErr: "invalid duration for timeout: 'soon'"},
+		{name: "zero query timeout", query: "0s", setting: "30s", wantErr: "must be greater than zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryTimeout(models.QueryModel{Timeout: tt.query}, &models.PluginSettings{QueryTimeout: tt.setting})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleQuery_Timeout(t *testing.T) {
+	config := &models.PluginSettings{
+		Secrets:      &models.SecretPluginSettings{AccountId: 123456},
+		QueryTimeout: "1h",
+	}
+
+	t.Run("query timeout overrides the datasource default", func(t *testing.T) {
+		executor := &blockingExecutor{}
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction", "timeout": "50ms"}`)}
+
+		start := time.Now()
+		resp := HandleQuery(context.Background(), executor, config, query)
+		require.Error(t, resp.Error)
+		assert.Less(t, time.Since(start), time.Minute)
+		assert.WithinDuration(t, start.Add(50*time.Millisecond), executor.deadline, time.Second)
+		assert.Contains(t, resp.Error.Error(), "query timed out after 0.05s")
+		assert.Equal(t, backend.StatusTimeout, resp.Status)
+		assert.Equal(t, backend.ErrorSourceDownstream, resp.ErrorSource)
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction", "timeout": "30"}`)}
+
+		resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid duration for timeout")
+	})
+}
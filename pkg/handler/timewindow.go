@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/timeutil"
+)
+
+// datePhrases lists the calendar phrases SINCE and UNTIL accept, each resolving
+// to the start of the named day, week, month, quarter or year.
+var datePhrases = []string{
+	"today", "yesterday",
+	"this week", "last week",
+	"this month", "last month",
+	"this quarter", "last quarter",
+	"this year", "last year",
+}
+
+// dateLayouts are the layouts of quoted SINCE and UNTIL dates, such as
+// '2024-01-31 09:30'.
+var dateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", time.RFC3339}
+
+// spacePattern matches runs of whitespace, collapsed when normalizing phrases.
+var spacePattern = regexp.MustCompile(`\s+`)
+
+// TimeWindow is the absolute window a SINCE/UNTIL pair resolves to.
+type TimeWindow struct {
+	Since    string    `json:"since"`    // SINCE expression, normalized, e.g. "3 hours ago"
+	Until    string    `json:"until"`    // UNTIL expression, normalized; "now" when none was given
+	From     time.Time `json:"from"`     // Start of the window
+	To       time.Time `json:"to"`       // End of the window
+	Duration string    `json:"duration"` // Length of the window, e.g. "1 day"
+	Clause   string    `json:"clause"`   // Equivalent SINCE/UNTIL clause in epoch milliseconds
+	TimeZone string    `json:"timeZone"` // Time zone calendar phrases and dates were resolved in
+}
+
+// TimeWindowError represents a SINCE or UNTIL expression that cannot be resolved.
+type TimeWindowError struct {
+	Clause string // SINCE or UNTIL
+	Value  string
+	Msg    string
+}
+
+func (e *TimeWindowError) Error() string {
+	return fmt.Sprintf("invalid %s '%s': %s", e.Clause, e.Value, e.Msg)
+}
+
+// ResolveTimeWindow resolves the SINCE and UNTIL expressions of a query to the
+// absolute window it scans at now. Expressions are epoch milliseconds, relative
+// times such as "3 hours ago", "now", calendar phrases such as "yesterday" or
+// "this week", and quoted dates such as '2024-01-31 09:30'. Calendar phrases and
+// dates are resolved in timeZone (UTC when empty, as in NRQL); weeks start on
+// Monday. An empty until means now.
+func ResolveTimeWindow(since, until, timeZone string, now time.Time) (*TimeWindow, error) {
+	name, err := resolveTimeZone(timeZone)
+	if err != nil {
+		return nil, err
+	}
+	loc := time.UTC
+	if name != "" {
+		loc, _ = time.LoadLocation(name)
+	}
+	now = now.In(loc)
+
+	if strings.TrimSpace(since) == "" {
+		return nil, &TimeWindowError{Clause: "SINCE", Value: since, Msg: "a time is required"}
+	}
+	from, sinceText, err := resolveTimeBound(since, now)
+	if err != nil {
+		return nil, &TimeWindowError{Clause: "SINCE", Value: since, Msg: err.Error()}
+	}
+	to, untilText := now, "now"
+	if strings.TrimSpace(until) != "" {
+		if to, untilText, err = resolveTimeBound(until, now); err != nil {
+			return nil, &TimeWindowError{Clause: "UNTIL", Value: until, Msg: err.Error()}
+		}
+	}
+	if !from.Before(to) {
+		return nil, &TimeWindowError{Clause: "SINCE", Value: since, Msg: fmt.Sprintf("%s is not before UNTIL %s", from.Format(time.RFC3339), to.Format(time.RFC3339))}
+	}
+
+	return &TimeWindow{
+		Since:    sinceText,
+		Until:    untilText,
+		From:     from,
+		To:       to,
+		Duration: formatNRQLDuration(to.Sub(from).Truncate(time.Second)),
+		Clause:   fmt.Sprintf("SINCE %d UNTIL %d", from.UnixMilli(), to.UnixMilli()),
+		TimeZone: loc.String(),
+	}, nil
+}
+
+// resolveTimeBound returns the time a SINCE or UNTIL expression stands for at
+// now, in now's location, and the expression normalized.
+func resolveTimeBound(expr string, now time.Time) (time.Time, string, error) {
+	value := strings.TrimSpace(expr)
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		date := strings.TrimSpace(value[1 : len(value)-1])
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, date, now.Location()); err == nil {
+				return t, "'" + date + "'", nil
+			}
+		}
+		return time.Time{}, "", fmt.Errorf("dates must look like '2024-01-31', '2024-01-31 09:30' or '2024-01-31 09:30:00'")
+	}
+
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if millis < 0 {
+			return time.Time{}, "", fmt.Errorf("epoch milliseconds cannot be negative")
+		}
+		return time.UnixMilli(millis).In(now.Location()), value, nil
+	}
+
+	phrase := strings.ToLower(spacePattern.ReplaceAllString(value, " "))
+	if phrase == "now" {
+		return now, phrase, nil
+	}
+	if match := agoPattern.FindStringSubmatch(phrase); match != nil {
+		n, err := strconv.ParseInt(match[1], 10, 64)
+		unit := agoUnits[match[2]]
+		if err != nil || n > int64(100*365*timeutil.Day/unit) {
+			return time.Time{}, "", fmt.Errorf("relative time is too far in the past")
+		}
+		return now.Add(-time.Duration(n) * unit), pluralize(n, match[2]) + " ago", nil
+	}
+	for _, known := range datePhrases {
+		if phrase == known {
+			return startOfPhrase(phrase, now), phrase, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("expected epoch milliseconds, a relative time such as '3 hours ago', one of %s, or a quoted date", strings.Join(datePhrases, ", "))
+}
+
+// startOfPhrase returns the start of the period a calendar phrase names at now.
+func startOfPhrase(phrase string, now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	quarterStart := time.Date(now.Year(), now.Month()-(now.Month()-1)%3, 1, 0, 0, 0, 0, now.Location())
+	yearStart := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+
+	switch phrase {
+	case "yesterday":
+		return today.AddDate(0, 0, -1)
+	case "this week":
+		return weekStart
+	case "last week":
+		return weekStart.AddDate(0, 0, -7)
+	case "this month":
+		return monthStart
+	case "last month":
+		return monthStart.AddDate(0, -1, 0)
+	case "this quarter":
+		return quarterStart
+	case "last quarter":
+		return quarterStart.AddDate(0, -3, 0)
+	case "this year":
+		return yearStart
+	case "last year":
+		return yearStart.AddDate(-1, 0, 0)
+	default:
+		return today
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTimeWindow(t *testing.T) {
+	// Wednesday 2024-05-15 14:30 UTC
+	now := time.Date(2024, 5, 15, 14, 30, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name      string
+		since     string
+		until     string
+		wantSince string
+		wantUntil string
+		wantFrom  time.Time
+		wantTo    time.Time
+	}{
+		{"relative time", " 3  Hours AGO ", "", "3 hours ago", "now", now.Add(-3 * time.Hour), now},
+		{"one unit", "1 days ago", "", "1 day ago", "now", now.Add(-24 * time.Hour), now},
+		{"yesterday until today", "yesterday", "today", "yesterday", "today", day(5, 14), day(5, 15)},
+		{"this week starts on Monday", "this week", "", "this week", "now", day(5, 13), now},
+		{"last week", "Last Week", "this week", "last week", "this week", day(5, 6), day(5, 13)},
+		{"this month", "this month", "", "this month", "now", day(5, 1), now},
+		{"last month", "last month", "this month", "last month", "this month", day(4, 1), day(5, 1)},
+		{"this quarter", "this quarter", "", "this quarter", "now", day(4, 1), now},
+		{"last quarter", "last quarter", "this quarter", "last quarter", "this quarter", day(1, 1), day(4, 1)},
+		{"last year", "last year", "this year", "last year", "this year", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), day(1, 1)},
+		{"epoch milliseconds", "1715731200000", "1715734800000", "1715731200000", "1715734800000", time.UnixMilli(1715731200000), time.UnixMilli(1715734800000)},
+		{"quoted dates", "'2024-05-01'", "'2024-05-02 12:00'", "'2024-05-01'", "'2024-05-02 12:00'", day(5, 1), time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := ResolveTimeWindow(tt.since, tt.until, "", now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSince, window.Since)
+			assert.Equal(t, tt.wantUntil, window.Until)
+			assert.True(t, tt.wantFrom.Equal(window.From), "from: expected %s, got %s", tt.wantFrom, window.From)
+			assert.True(t, tt.wantTo.Equal(window.To), "to: expected %s, got %s", tt.wantTo, window.To)
+			assert.Equal(t, timeRangeClause(backend.TimeRange{From: tt.wantFrom, To: tt.wantTo}), window.Clause)
+			assert.Equal(t, "UTC", window.TimeZone)
+		})
+	}
+}
+
+func TestResolveTimeWindow_TimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	now := time.Date(2024, 5, 15, 2, 0, 0, 0, time.UTC) // 22:00 on May 14 in New York
+
+	window, err := ResolveTimeWindow("today", "", "America/New_York", now)
+	require.NoError(t, err)
+	assert.True(t, time.Date(2024, 5, 14, 0, 0, 0, 0, loc).Equal(window.From))
+	assert.Equal(t, "22 hours", window.Duration)
+	assert.Equal(t, "America/New_York", window.TimeZone)
+}
+
+func TestResolveTimeWindow_Errors(t *testing.T) {
+	now := time.Date(2024, 5, 15, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		since   string
+		until   string
+		wantMsg string
+	}{
+		{"missing SINCE", "", "", "invalid SINCE '': a time is required"},
+		{"unknown phrase", "last fortnight", "", "invalid SINCE 'last fortnight'"},
+		{"bad date", "'May 1st'", "", "dates must look like"},
+		{"bad UNTIL", "1 day ago", "later", "invalid UNTIL 'later'"},
+		{"SINCE after UNTIL", "today", "yesterday", "is not before UNTIL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolveTimeWindow(tt.since, tt.until, "", now)
+			var windowErr *TimeWindowError
+			require.True(t, errors.As(err, &windowErr), "got %v", err)
+			assert.Contains(t, err.Error(), tt.wantMsg)
+		})
+	}
+
+	_, err := ResolveTimeWindow("1 day ago", "", "Mars/Olympus", now)
+	assert.ErrorContains(t, err, "invalid timeZone")
+}
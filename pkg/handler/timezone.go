@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// resolveTimeZone returns the IANA name of a dashboard time zone for a WITH
+// TIMEZONE clause, or "" when NRQL's default of UTC applies: for utc, and for
+// browser and empty time zones, which only the frontend can resolve.
+func resolveTimeZone(timeZone string) (string, error) {
+	switch name := strings.TrimSpace(timeZone); strings.ToLower(name) {
+	case "", "browser", "utc", "default":
+		return "", nil
+	case "local":
+		return "", fmt.Errorf("invalid timeZone '%s': must be an IANA time zone such as Europe/Berlin", timeZone)
+	default:
+		if _, err := time.LoadLocation(name); err != nil || strings.ContainsAny(name, "'\\") {
+			return "", fmt.Errorf("invalid timeZone '%s': must be an IANA time zone such as Europe/Berlin", timeZone)
+		}
+		return name, nil
+	}
+}
+
+// applyTimeZone appends a WITH TIMEZONE clause for the dashboard time zone to a
+// query whose SINCE/UNTIL clause was generated from the time range, by
+// $__timeFilter or applyTimeRange, so TIMESERIES day buckets and date facets
+// start at local midnight rather than UTC. Queries with their own SINCE/UNTIL or
+// WITH TIMEZONE clause are left unchanged.
+func applyTimeZone(query, timeZone string, timeRange backend.TimeRange) (string, error) {
+	name, err := resolveTimeZone(timeZone)
+	if err != nil || name == "" {
+		return query, err
+	}
+	if timeRange.From.IsZero() || timeRange.To.IsZero() || !strings.Contains(query, timeRangeClause(timeRange)) {
+		return query, nil
+	}
+	if containsKeyword(query, "TIMEZONE") {
+		return query, nil
+	}
+	return fmt.Sprintf("%s WITH TIMEZONE '%s'", query, name), nil
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTimeZone(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+	generated := "SELECT count(*) FROM Transaction TIMESERIES 1 day " + timeRangeClause(timeRange)
+
+	tests := []struct {
+		name     string
+		query    string
+		timeZone string
+		want     string
+	}{
+		{
+			name:     "generated time range",
+			query:    generated,
+			timeZone: "America/New_York",
+			want:     generated + " WITH TIMEZONE 'America/New_York'",
+		},
+		{
+			name:     "utc is NRQL's default",
+			query:    generated,
+			timeZone: "utc",
+			want:     generated,
+		},
+		{
+			name:     "browser time zone is resolved by the frontend",
+			query:    generated,
+			timeZone: "browser",
+			want:     generated,
+		},
+		{
+			name:     "query's own SINCE",
+			query:    "SELECT count(*) FROM Transaction SINCE 1 week ago TIMESERIES 1 day",
+			timeZone: "America/New_York",
+			want:     "SELECT count(*) FROM Transaction SINCE 1 week ago TIMESERIES 1 day",
+		},
+		{
+			name:     "query's own WITH TIMEZONE",
+			query:    generated + " WITH TIMEZONE 'Asia/Tokyo'",
+			timeZone: "America/New_York",
+			want:     generated + " WITH TIMEZONE 'Asia/Tokyo'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTimeZone(tt.query, tt.timeZone, timeRange)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveTimeZone_Invalid(t *testing.T) {
+	for _, timeZone := range []string{"Mars/Olympus", "Local", "Europe/Berlin'"} {
+		_, err := resolveTimeZone(timeZone)
+		assert.Error(t, err, timeZone)
+	}
+}
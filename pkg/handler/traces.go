@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// traceEventTypes are the event types holding spans and trace summaries.
+var traceEventTypes = []string{"Span", "DistributedTraceSummary"}
+
+// useTracesFormat reports whether results should be formatted as traces: the
+// query must return spans or trace summaries and either set queryType "traces"
+// or read only from trace event types.
+func useTracesFormat(queryType string, nrqlQueryText string, results interface{}) bool {
+	container, ok := results.(*nrdb.NRDBResultContainer)
+	if !ok || !(formatter.IsSpanResult(container) || formatter.IsTraceSummaryResult(container)) {
+		return false
+	}
+	if queryType == models.QueryTypeTraces {
+		return true
+	}
+	types := eventTypes(nrqlQueryText)
+	for _, eventType := range types {
+		if !isTraceEventType(eventType) {
+			return false
+		}
+	}
+	return len(types) > 0
+}
+
+// isTraceEventType reports whether eventType is one of traceEventTypes.
+func isTraceEventType(eventType string) bool {
+	for _, traceEventType := range traceEventTypes {
+		if strings.EqualFold(eventType, traceEventType) {
+			return true
+		}
+	}
+	return false
+}
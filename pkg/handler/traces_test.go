@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseTracesFormat(t *testing.T) {
+	spans := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"timestamp": 1700000000000.0, "trace.id": "t1", "id": "s1"}}}
+	summaries := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"timestamp": 1700000000000.0, "trace.id": "t1"}}}
+	events := &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"timestamp": 1700000000000.0, "name": "a"}}}
+
+	tests := []struct {
+		name      string
+		queryType string
+		query     string
+		results   interface{}
+		want      bool
+	}{
+		{"FROM Span", "", "SELECT * FROM Span WHERE trace.id = 't1'", spans, true},
+		{"FROM DistributedTraceSummary", "", "SELECT * FROM DistributedTraceSummary", summaries, true},
+		{"other event type", "", "SELECT * FROM Transaction", spans, false},
+		{"explicit traces query type", models.QueryTypeTraces, "SELECT * FROM Transaction", spans, true},
+		{"events without trace IDs", models.QueryTypeTraces, "SELECT * FROM Span", events, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, useTracesFormat(tt.queryType, tt.query, tt.results))
+		})
+	}
+}
+
+func TestHandleQuery_Traces(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"timestamp": 1700000000000.0, "trace.id": "t1", "id": "s1", "name": "GET /", "service.name": "web", "duration.ms": 12.0},
+	}}}
+	query := backend.DataQuery{RefID: "A", QueryType: models.QueryTypeTraces, JSON: []byte(`{"queryText": "SELECT * FROM Span WHERE trace.id = 't1'"}`)}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.Len(t, resp.Frames, 1)
+	assert.Equal(t, formatter.TraceFrameName, resp.Frames[0].Name)
+	spanID, _ := resp.Frames[0].FieldByName("spanID")
+	require.NotNil(t, spanID)
+	assert.Equal(t, "s1", spanID.At(0))
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// NRQL features reported in UnsupportedFeature.Feature
+const (
+	FeatureNestedAggregation = "nestedAggregation" // FROM (SELECT ...)
+	FeatureJoin              = "join"              // JOIN (FROM ...)
+	FeatureSubquery          = "subquery"          // A subquery in a condition or expression, e.g. IN (FROM ... SELECT ...)
+)
+
+// UnsupportedFeature is an NRQL feature of a query that the formatter does not
+// fully handle, and how the query's frames are degraded by it.
+type UnsupportedFeature struct {
+	Feature string `json:"feature"` // One of the Feature* names
+	Msg     string `json:"message"`
+}
+
+// featureRule detects an NRQL feature in a query whose string literals are masked.
+type featureRule struct {
+	feature string
+	detect  func(masked string) bool
+	msg     string
+}
+
+var (
+	nestedAggregationPattern = regexp.MustCompile(`(?i)\bFROM\s*\(\s*SELECT\b`)
+	joinPattern              = regexp.MustCompile(`(?i)\bJOIN\s*\(`)
+	// subqueryPattern matches parenthesized queries with the word before them,
+	// which tells nested aggregations and joins from other subqueries.
+	subqueryPattern = regexp.MustCompile(`(?i)(\w*)\s*\(\s*(?:FROM|SELECT)\b`)
+)
+
+// unsupportedFeatures lists the NRQL features the formatter does not fully
+// handle, in the order they are reported. It is the one place new features are
+// added; query notices and query validation both report from it.
+var unsupportedFeatures = []featureRule{
+	{
+		feature: FeatureNestedAggregation,
+		detect:  nestedAggregationPattern.MatchString,
+		msg:     "Nested aggregation: only the outer query's results are formatted; the FACET and TIMESERIES clauses of the inner query do not appear in the frames",
+	},
+	{
+		feature: FeatureJoin,
+		detect:  joinPattern.MatchString,
+		msg:     "JOIN: the joined rows are formatted like the outer query's results; series and labels are not built from the joined query's columns",
+	},
+	{
+		feature: FeatureSubquery,
+		detect:  hasSubquery,
+		msg:     "Subquery: the frames hold the outer query's results only; values returned by the subquery are not shown",
+	},
+}
+
+// hasSubquery reports whether the masked query has a parenthesized query other
+// than the inner query of a nested aggregation or a joined query.
+func hasSubquery(masked string) bool {
+	for _, match := range subqueryPattern.FindAllStringSubmatch(masked, -1) {
+		switch strings.ToUpper(match[1]) {
+		case "FROM", "JOIN":
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// unsupportedFeaturesOf returns the NRQL features of the query that the
+// formatter does not fully handle.
+func unsupportedFeaturesOf(query string) []UnsupportedFeature {
+	masked := maskStringLiterals(query)
+	var features []UnsupportedFeature
+	for _, rule := range unsupportedFeatures {
+		if rule.detect(masked) {
+			features = append(features, UnsupportedFeature{Feature: rule.feature, Msg: rule.msg})
+		}
+	}
+	return features
+}
+
+// unsupportedFeatureNotices returns a warning notice per unsupported feature.
+func unsupportedFeatureNotices(features []UnsupportedFeature) []data.Notice {
+	notices := make([]data.Notice, len(features))
+	for i, feature := range features {
+		notices[i] = data.Notice{Severity: data.NoticeSeverityWarning, Text: feature.Msg}
+	}
+	return notices
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsupportedFeaturesOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "plain query", query: "SELECT count(*) FROM Transaction FACET appName TIMESERIES"},
+		{name: "filter function", query: "SELECT filter(count(*), WHERE error IS true) FROM Transaction"},
+		{
+			name:  "nested aggregation",
+			query: "SELECT average(total) FROM (SELECT count(*) AS total FROM Transaction FACET appName TIMESERIES)",
+			want:  []string{FeatureNestedAggregation},
+		},
+		{
+			name:  "join",
+			query: "FROM Transaction JOIN (FROM PageView SELECT count(*) FACET session) ON session SELECT count(*) FACET appName",
+			want:  []string{FeatureJoin},
+		},
+		{
+			name:  "subquery condition",
+			query: "SELECT count(*) FROM Transaction WHERE traceId IN (FROM Span SELECT uniques(traceId) WHERE error IS true)",
+			want:  []string{FeatureSubquery},
+		},
+		{
+			name:  "subquery expression",
+			query: "SELECT count(*) / (SELECT count(*) FROM PageView) FROM Transaction",
+			want:  []string{FeatureSubquery},
+		},
+		{
+			name:  "several features",
+			query: "SELECT max(c) FROM (SELECT count(*) AS c FROM Transaction WHERE host IN (FROM SystemSample SELECT uniques(hostname)) FACET host)",
+			want:  []string{FeatureNestedAggregation, FeatureSubquery},
+		},
+		{
+			name:  "keywords in string literals",
+			query: "SELECT count(*) FROM Log WHERE message = 'JOIN (FROM x)' OR message LIKE '%(SELECT %'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, feature := range unsupportedFeaturesOf(tt.query) {
+				got = append(got, feature.Feature)
+				assert.NotEmpty(t, feature.Msg)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUnsupportedFeatures_List(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, rule := range unsupportedFeatures {
+		assert.False(t, seen[rule.feature], "feature %s listed twice", rule.feature)
+		seen[rule.feature] = true
+		assert.NotNil(t, rule.detect, rule.feature)
+		assert.NotEmpty(t, rule.msg, rule.feature)
+	}
+}
+
+func TestHandleQuery_UnsupportedFeatureNotices(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT average(total) FROM (SELECT count(*) AS total FROM Transaction FACET appName)"}`)}
+	resp := HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.NoError(t, resp.Error)
+	assert.Contains(t, noticeTexts(resp), unsupportedFeatures[0].msg)
+
+	query = backend.DataQuery{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction"}`)}
+	resp = HandleQuery(context.Background(), &mockNRDBExecutor{}, config, query)
+	require.NoError(t, resp.Error)
+	assert.Empty(t, noticeTexts(resp))
+}
+
+func TestValidateQuery_Unsupported(t *testing.T) {
+	timeRange := backend.TimeRange{From: time.UnixMilli(1700000000000), To: time.UnixMilli(1700003600000)}
+	validation := ValidateQuery(context.Background(), &mockNRDBExecutor{}, 1, "FROM Transaction JOIN (FROM PageView SELECT count(*) FACET session) ON session SELECT count(*)", timeRange)
+	require.Len(t, validation.Unsupported, 1)
+	assert.Equal(t, FeatureJoin, validation.Unsupported[0].Feature)
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/formatter"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Grafana units of the fields of usage queries
+const (
+	unitGigabytes = "decgbytes"
+	unitCount     = "none"
+)
+
+// usagePricing is the pricing of usage cost estimates, with defaults applied.
+type usagePricing struct {
+	perGB, perFullPlatformUser, perCoreUser float64
+	currency                                string
+}
+
+// pricingOf returns the usage pricing of the settings.
+func pricingOf(settings *models.UsagePricingSettings) usagePricing {
+	pricing := usagePricing{perGB: models.DefaultPricePerGB, currency: "USD"}
+	if settings == nil {
+		return pricing
+	}
+	if settings.PerGB > 0 {
+		pricing.perGB = settings.PerGB
+	}
+	if settings.Currency != "" {
+		pricing.currency = strings.ToUpper(settings.Currency)
+	}
+	pricing.perFullPlatformUser = settings.PerFullPlatformUser
+	pricing.perCoreUser = settings.PerCoreUser
+	return pricing
+}
+
+// unit returns the Grafana unit of amounts in the pricing's currency.
+func (p usagePricing) unit() string {
+	return "currency" + p.currency
+}
+
+// usageQuery returns the prebuilt NRQL of a usage metric and the units of its
+// result fields, by field name. Templates of this month's consumption have a
+// SINCE clause of their own, so the dashboard time range does not apply to them.
+func usageQuery(usageMetric string, pricing usagePricing) (string, map[string]string) {
+	switch usageMetric {
+	case models.UsageMetricIngest:
+		// Not aliased: faceted series are only built from aggregation fields
+		return "SELECT sum(GigabytesIngested) FROM NrConsumption WHERE productLine = 'DataPlatform' FACET usageMetric TIMESERIES",
+			map[string]string{"sum.GigabytesIngested": unitGigabytes}
+	case models.UsageMetricIngestMonthToDate:
+		return "SELECT latest(GigabytesIngested) AS 'ingestedGB', latest(GigabytesIngestedBillable) AS 'billableGB' FROM NrMTDConsumption WHERE productLine = 'DataPlatform' SINCE this month",
+			map[string]string{"ingestedGB": unitGigabytes, "billableGB": unitGigabytes}
+	case models.UsageMetricUsers:
+		return "SELECT latest(FullPlatformUsersBillable) AS 'fullPlatformUsers', latest(CoreUsersBillable) AS 'coreUsers' FROM NrMTDConsumption SINCE this month",
+			map[string]string{"fullPlatformUsers": unitCount, "coreUsers": unitCount}
+	case models.UsageMetricCost:
+		selects := []string{fmt.Sprintf("filter(latest(GigabytesIngestedBillable), WHERE productLine = 'DataPlatform') * %s AS 'ingestCost'", formatPrice(pricing.perGB))}
+		units := map[string]string{"ingestCost": pricing.unit()}
+		if pricing.perFullPlatformUser > 0 {
+			selects = append(selects, fmt.Sprintf("latest(FullPlatformUsersBillable) * %s AS 'fullPlatformUserCost'", formatPrice(pricing.perFullPlatformUser)))
+			units["fullPlatformUserCost"] = pricing.unit()
+		}
+		if pricing.perCoreUser > 0 {
+			selects = append(selects, fmt.Sprintf("latest(CoreUsersBillable) * %s AS 'coreUserCost'", formatPrice(pricing.perCoreUser)))
+			units["coreUserCost"] = pricing.unit()
+		}
+		return "SELECT " + strings.Join(selects, ", ") + " FROM NrMTDConsumption SINCE this month", units
+	}
+	return "", nil
+}
+
+// formatPrice formats a price as an NRQL number.
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
+
+// HandleUsageQuery processes a Grafana query of type models.QueryTypeUsage. It
+// runs the prebuilt NRQL of the query's usage metric like an NRQL query, so the
+// query's display options apply, and sets the units of the results: GB for data
+// ingested and the pricing's currency for cost estimates. Unit overrides of the
+// datasource still take precedence.
+func HandleUsageQuery(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, config *models.PluginSettings, query backend.DataQuery) *backend.DataResponse {
+	resp := &backend.DataResponse{}
+	logger := queryLogger(tracing.TraceIDFromContext(ctx))
+
+	qm, _, err := models.ParseQueryModel(query.JSON, config.StrictQueryParsing)
+	if err != nil {
+		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
+		logger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if !models.IsValidUsageMetric(qm.UsageMetric) {
+		resp.Error = fmt.Errorf("invalid usageMetric '%s': must be one of %s, %s, %s or %s", qm.UsageMetric,
+			models.UsageMetricIngest, models.UsageMetricIngestMonthToDate, models.UsageMetricUsers, models.UsageMetricCost)
+		return resp
+	}
+
+	pricing := pricingOf(config.UsagePricing)
+	nrql, units := usageQuery(qm.UsageMetric, pricing)
+	query.JSON, err = withQueryText(query.JSON, nrql)
+	if err != nil {
+		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
+		return resp
+	}
+	query.QueryType = ""
+
+	usageConfig := *config
+	usageConfig.UnitOverrides = make(map[string]string, len(units)+len(config.UnitOverrides))
+	for name, unit := range units {
+		usageConfig.UnitOverrides[name] = unit
+	}
+	for name, unit := range config.UnitOverrides {
+		usageConfig.UnitOverrides[name] = unit
+	}
+
+	logger.Debug("Running usage query", "refId", query.RefID, "usageMetric", qm.UsageMetric)
+	resp = HandleQuery(ctx, executor, &usageConfig, query)
+	if resp.Error == nil && qm.UsageMetric == models.UsageMetricCost {
+		formatter.AppendNotices(resp, data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     fmt.Sprintf("Estimated at %s %s per billable GB; discounts and commitments are not included", formatPrice(pricing.perGB), pricing.currency),
+		})
+	}
+	return resp
+}
+
+// withQueryText returns the query JSON with its query text replaced by nrql,
+// in code mode and without statements.
+func withQueryText(queryJSON json.RawMessage, nrql string) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(queryJSON) > 0 {
+		if err := json.Unmarshal(queryJSON, &fields); err != nil {
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(nrql)
+	if err != nil {
+		return nil, err
+	}
+	fields["queryText"] = encoded
+	delete(fields, "editorMode")
+	delete(fields, "builder")
+	delete(fields, "statements")
+	return json.Marshal(fields)
+}
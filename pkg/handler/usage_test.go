@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageQuery(t *testing.T) {
+	pricing := pricingOf(nil)
+	for _, usageMetric := range []string{models.UsageMetricIngest, models.UsageMetricIngestMonthToDate, models.UsageMetricUsers, models.UsageMetricCost} {
+		nrql, units := usageQuery(usageMetric, pricing)
+		assert.NotEmpty(t, nrql, usageMetric)
+		assert.NotEmpty(t, units, usageMetric)
+		assert.Empty(t, lintQuery(nrql, false, 0, time.Now()), usageMetric)
+	}
+
+	nrql, units := usageQuery(models.UsageMetricCost, pricing)
+	assert.Contains(t, nrql, "* 0.4 AS 'ingestCost'")
+	assert.NotContains(t, nrql, "fullPlatformUserCost", "users are only costed with a price")
+	assert.Equal(t, map[string]string{"ingestCost": "currencyUSD"}, units)
+
+	pricing = pricingOf(&models.UsagePricingSettings{PerGB: 0.3, PerFullPlatformUser: 349, Currency: "eur"})
+	nrql, units = usageQuery(models.UsageMetricCost, pricing)
+	assert.Contains(t, nrql, "* 0.3 AS 'ingestCost'")
+	assert.Contains(t, nrql, "latest(FullPlatformUsersBillable) * 349 AS 'fullPlatformUserCost'")
+	assert.NotContains(t, nrql, "coreUserCost")
+	assert.Equal(t, "currencyEUR", units["fullPlatformUserCost"])
+}
+
+func TestHandleUsageQuery(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 1}}
+	from := time.UnixMilli(1700000000000)
+	timeRange := backend.TimeRange{From: from, To: from.Add(24 * time.Hour)}
+
+	t.Run("ingest over the dashboard time range", func(t *testing.T) {
+		executor := &routingNRDBExecutor{multiResults: &nrdb.NRDBResultContainerMultiResultCustomized{
+			Results: []nrdb.NRDBResult{
+				{"facet": "ApmEventsBytes", "usageMetric": "ApmEventsBytes", "beginTimeSeconds": 1700000000.0, "endTimeSeconds": 1700003600.0, "sum.GigabytesIngested": 12.5},
+			},
+			Metadata: nrdb.NRDBMetadata{Facets: []string{"usageMetric"}},
+		}}
+		query := backend.DataQuery{RefID: "A", QueryType: models.QueryTypeUsage, TimeRange: timeRange, JSON: []byte(`{"usageMetric": "ingest", "queryText": "ignored", "editorMode": "builder"}`)}
+		resp := HandleUsageQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		assert.Contains(t, string(executor.lastQuery), "FROM NrConsumption")
+		assert.Contains(t, string(executor.lastQuery), "SINCE 1700000000000 UNTIL 1700086400000")
+		assert.Equal(t, unitGigabytes, fieldUnit(resp.Frames, "sum.GigabytesIngested"))
+	})
+
+	t.Run("cost estimate", func(t *testing.T) {
+		executor := &routingNRDBExecutor{standardResults: &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{{"ingestCost": 120.0}},
+		}}
+		query := backend.DataQuery{RefID: "A", QueryType: models.QueryTypeUsage, TimeRange: timeRange, JSON: []byte(`{"usageMetric": "cost"}`)}
+		resp := HandleUsageQuery(context.Background(), executor, config, query)
+		require.NoError(t, resp.Error)
+		assert.Contains(t, string(executor.lastQuery), "SINCE this month")
+		assert.NotContains(t, string(executor.lastQuery), "1700000000000", "month-to-date queries keep their own time range")
+		assert.Equal(t, "currencyUSD", fieldUnit(resp.Frames, "ingestCost"))
+		assert.Contains(t, noticeTexts(resp), "Estimated at 0.4 USD per billable GB; discounts and commitments are not included")
+	})
+
+	t.Run("unit overrides win", func(t *testing.T) {
+		overridden := *config
+		overridden.UnitOverrides = map[string]string{"ingestCost": "currencyGBP"}
+		executor := &routingNRDBExecutor{standardResults: &nrdb.NRDBResultContainer{
+			Results: []nrdb.NRDBResult{{"ingestCost": 120.0}},
+		}}
+		query := backend.DataQuery{RefID: "A", QueryType: models.QueryTypeUsage, TimeRange: timeRange, JSON: []byte(`{"usageMetric": "cost"}`)}
+		resp := HandleUsageQuery(context.Background(), executor, &overridden, query)
+		require.NoError(t, resp.Error)
+		assert.Equal(t, "currencyGBP", fieldUnit(resp.Frames, "ingestCost"))
+	})
+
+	t.Run("invalid usage metric", func(t *testing.T) {
+		query := backend.DataQuery{RefID: "A", QueryType: models.QueryTypeUsage, JSON: []byte(`{"usageMetric": "bandwidth"}`)}
+		resp := HandleUsageQuery(context.Background(), &routingNRDBExecutor{}, config, query)
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid usageMetric 'bandwidth'")
+	})
+}
+
+// fieldUnit returns the unit of the first field named name.
+func fieldUnit(frames data.Frames, name string) string {
+	for _, frame := range frames {
+		for _, field := range frame.Fields {
+			if field.Name == name && field.Config != nil {
+				return field.Config.Unit
+			}
+		}
+	}
+	return ""
+}
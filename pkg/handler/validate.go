@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// validationInterval is the interval used to expand $__interval macros when a
+// query is validated outside of a panel.
+const validationInterval = time.Minute
+
+// QueryValidation is the outcome of validating an NRQL query before a panel runs it.
+type QueryValidation struct {
+	Valid       bool                 `json:"valid"`
+	Errors      []string             `json:"errors,omitempty"`     // Syntax and parse errors found in the query
+	EventTypes  []string             `json:"eventTypes,omitempty"` // Event types named in the FROM clause
+	Facet       bool                 `json:"facet"`
+	Timeseries  bool                 `json:"timeseries"`
+	Compare     bool                 `json:"compare"`
+	Unsupported []UnsupportedFeature `json:"unsupported,omitempty"` // NRQL features of the query the formatter does not fully handle
+	Probe       string               `json:"probe,omitempty"`       // Query sent to New Relic to check the query
+	DurationMs  int64                `json:"durationMs,omitempty"`  // Time New Relic took to answer the probe
+}
+
+// ValidateQuery checks an NRQL query without running the full panel query. It
+// reports the clauses and event types it detects, and unless the query has
+// syntax errors, runs it with LIMIT 1 so New Relic reports any parse errors.
+// Macros are expanded for timeRange.
+func ValidateQuery(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, query string, timeRange backend.TimeRange) QueryValidation {
+	query = NormalizeQuery(query)
+	validation := QueryValidation{
+		EventTypes:  eventTypes(query),
+		Facet:       containsKeyword(query, "FACET"),
+		Timeseries:  containsKeyword(query, "TIMESERIES"),
+		Compare:     containsKeyword(query, "COMPARE"),
+		Errors:      syntaxErrors(query),
+		Unsupported: unsupportedFeaturesOf(query),
+	}
+	if len(validation.Errors) > 0 {
+		return validation
+	}
+
+	probe, err := expandMacros(query, timeRange, validationInterval)
+	if err != nil {
+		validation.Errors = append(validation.Errors, err.Error())
+		return validation
+	}
+	if !containsKeyword(probe, "LIMIT") && !containsKeyword(probe, "SHOW") {
+		probe += " LIMIT 1"
+	}
+	validation.Probe = probe
+
+	start := time.Now()
+	_, err = ExecuteNRQLQuery(ctx, executor, accountID, probe)
+	validation.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		validation.Errors = append(validation.Errors, err.Error())
+		return validation
+	}
+	validation.Valid = true
+	return validation
+}
+
+// syntaxErrors returns the problems that can be found in a query without sending
+// it to New Relic: an empty query, missing SELECT or FROM clauses, unterminated
+// quotes and unbalanced parentheses.
+func syntaxErrors(query string) []string {
+	if query == "" {
+		return []string{"query is empty"}
+	}
+
+	var errs []string
+	if quote := unterminatedQuote(query); quote != 0 {
+		errs = append(errs, fmt.Sprintf("unterminated %c quote", quote))
+	}
+	if !containsKeyword(query, "SHOW") {
+		if !containsKeyword(query, "SELECT") {
+			errs = append(errs, "query has no SELECT clause")
+		}
+		if !containsKeyword(query, "FROM") {
+			errs = append(errs, "query has no FROM clause")
+		}
+	}
+
+	depth := 0
+	for _, c := range maskStringLiterals(query) {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	switch {
+	case depth < 0:
+		errs = append(errs, "unexpected ')'")
+	case depth > 0:
+		errs = append(errs, "missing ')'")
+	}
+	return errs
+}
+
+// unterminatedQuote returns the quote character of a string literal or quoted
+// identifier that is not closed, or 0 if all are closed.
+func unterminatedQuote(query string) byte {
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote == 0:
+			if c == '\'' || c == '"' || c == '`' {
+				quote = c
+			}
+		case c == '\\' && quote != '`':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return quote
+}
+
+// eventTypes returns the event types listed in the query's first FROM clause.
+// Backtick-quoted names are returned without their quotes.
+func eventTypes(query string) []string {
+	idx := findKeyword(query, "FROM")
+	if idx < 0 {
+		return nil
+	}
+
+	var names []string
+	i := idx + len("FROM")
+	for {
+		for i < len(query) && query[i] == ' ' {
+			i++
+		}
+		start := i
+		if i < len(query) && query[i] == '`' {
+			end := strings.IndexByte(query[i+1:], '`')
+			if end < 0 {
+				return names
+			}
+			names = append(names, query[i+1:i+1+end])
+			i += end + 2
+		} else {
+			for i < len(query) && (isIdentifierChar(query[i]) || query[i] == ':') {
+				i++
+			}
+			if i == start {
+				return names
+			}
+			names = append(names, query[start:i])
+		}
+
+		for i < len(query) && query[i] == ' ' {
+			i++
+		}
+		if i >= len(query) || query[i] != ',' {
+			return names
+		}
+		i++
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateQuery(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.UnixMilli(1700000000000),
+		To:   time.UnixMilli(1700003600000),
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		queryErr           error
+		expectedValid      bool
+		expectedErrors     []string
+		expectedEventTypes []string
+		expectedFacet      bool
+		expectedTimeseries bool
+		expectedProbe      nrdb.NRQL
+	}{
+		{
+			name:               "valid faceted timeseries query",
+			query:              "SELECT count(*) FROM Transaction FACET appName TIMESERIES",
+			expectedValid:      true,
+			expectedEventTypes: []string{"Transaction"},
+			expectedFacet:      true,
+			expectedTimeseries: true,
+			expectedProbe:      "SELECT count(*) FROM Transaction FACET appName TIMESERIES LIMIT 1",
+		},
+		{
+			name:               "existing limit and macros",
+			query:              "SELECT * FROM Log, `My Events` WHERE message = 'FACET' $__timeFilter LIMIT 10",
+			expectedValid:      true,
+			expectedEventTypes: []string{"Log", "My Events"},
+			expectedProbe:      "SELECT * FROM Log, `My Events` WHERE message = 'FACET' SINCE 1700000000000 UNTIL 1700003600000 LIMIT 10",
+		},
+		{
+			name:               "parse error from New Relic",
+			query:              "SELECT count(*) FROM Transaction WHERE",
+			queryErr:           errors.New("NRQL Syntax Error: Error at end of input"),
+			expectedErrors:     []string{"NRQL Syntax Error: Error at end of input"},
+			expectedEventTypes: []string{"Transaction"},
+			expectedProbe:      "SELECT count(*) FROM Transaction WHERE LIMIT 1",
+		},
+		{
+			name:           "empty query",
+			query:          " -- comment only\n",
+			expectedErrors: []string{"query is empty"},
+		},
+		{
+			name:           "syntax errors are reported without a probe",
+			query:          "SELECT count(* WHERE name = 'x",
+			expectedErrors: []string{"unterminated ' quote", "query has no FROM clause", "missing ')'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &routingNRDBExecutor{}
+			validation := ValidateQuery(context.Background(), &mockNRDBExecutor{queryErr: tt.queryErr}, 123, tt.query, timeRange)
+			ValidateQuery(context.Background(), executor, 123, tt.query, timeRange)
+
+			assert.Equal(t, tt.expectedValid, validation.Valid)
+			assert.Equal(t, tt.expectedEventTypes, validation.EventTypes)
+			assert.Equal(t, tt.expectedFacet, validation.Facet)
+			assert.Equal(t, tt.expectedTimeseries, validation.Timeseries)
+			assert.Equal(t, string(tt.expectedProbe), validation.Probe)
+			if tt.queryErr != nil {
+				assert.Len(t, validation.Errors, 1)
+				assert.Contains(t, validation.Errors[0], tt.expectedErrors[0])
+			} else {
+				assert.Equal(t, tt.expectedErrors, validation.Errors)
+			}
+			assert.Equal(t, tt.expectedProbe, executor.lastQuery, "probe sent to New Relic")
+		})
+	}
+}
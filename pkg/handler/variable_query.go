@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// VariableCacheTTL is how long the values of variable queries stay cached, so
+// that dashboards refreshing their variables do not rerun the lookups each time.
+const VariableCacheTTL = 5 * time.Minute
+
+// VariableFrameName is the name of the frame returned by variable queries.
+const VariableFrameName = "values"
+
+// VariableSourcesFunc returns the query executor and account lister used by the
+// variable queries of an account.
+type VariableSourcesFunc func(ctx context.Context, accountID int) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister, error)
+
+// HandleVariableQuery processes a Grafana query of type models.QueryTypeVariable.
+// It lists the accounts, event types, attributes or attribute values selected by
+// the query's variable type and returns them as a frame with a single string
+// field, the shape Grafana reads template variable values from. Values are cached
+// in valueCache for VariableCacheTTL; a nil valueCache disables caching.
+func HandleVariableQuery(ctx context.Context, sourcesFor VariableSourcesFunc, valueCache *cache.Cache, config *models.PluginSettings, query backend.DataQuery) *backend.DataResponse {
+	resp := &backend.DataResponse{}
+	logger := queryLogger(tracing.TraceIDFromContext(ctx))
+
+	qm, _, err := models.ParseQueryModel(query.JSON, config.StrictQueryParsing)
+	if err != nil {
+		resp.Error = fmt.Errorf("error parsing query JSON: %w", err)
+		logger.Error("Error parsing query JSON", "refId", query.RefID, "error", err)
+		return resp
+	}
+	if !models.IsValidVariableType(qm.VariableType) {
+		resp.Error = fmt.Errorf("invalid variableType '%s': must be one of %s, %s, %s or %s", qm.VariableType,
+			models.VariableTypeAccounts, models.VariableTypeEventTypes, models.VariableTypeAttributeKeys, models.VariableTypeAttributeValues)
+		return resp
+	}
+
+	accountID := config.Secrets.AccountId
+	if qm.AccountID > 0 {
+		accountID = qm.AccountID
+	}
+
+	key := fmt.Sprintf("variable|%s|%d|%s|%s", qm.VariableType, accountID, qm.EventType, qm.Attribute)
+	values, cached := cachedVariableValues(valueCache, key)
+	if !cached {
+		values, err = variableValues(ctx, sourcesFor, accountID, qm)
+		if err != nil {
+			var requestErr *metadata.RequestError
+			if errors.As(err, &requestErr) {
+				resp.Error = err
+				return resp
+			}
+			logger.Error("Variable query failed", "refId", query.RefID, "variableType", qm.VariableType, "accountID", accountID, "kind", errorsx.Classify(err), "error", err)
+			return errorsx.Response(fmt.Errorf("variable query failed: %w", err))
+		}
+		if valueCache != nil {
+			valueCache.Set(key, values, VariableCacheTTL)
+		}
+	}
+
+	logger.Debug("Variable query completed", "refId", query.RefID, "variableType", qm.VariableType, "accountID", accountID, "values", len(values), "cached", cached)
+	return &backend.DataResponse{Frames: data.Frames{data.NewFrame(VariableFrameName, data.NewField(variableFieldName(qm), nil, values))}}
+}
+
+// cachedVariableValues returns the values cached under key.
+func cachedVariableValues(valueCache *cache.Cache, key string) ([]string, bool) {
+	if valueCache == nil {
+		return nil, false
+	}
+	cached, ok := valueCache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	values, ok := cached.([]string)
+	return values, ok
+}
+
+// variableValues runs the lookup of a variable query.
+func variableValues(ctx context.Context, sourcesFor VariableSourcesFunc, accountID int, qm models.QueryModel) ([]string, error) {
+	executor, lister, err := sourcesFor(ctx, accountID)
+	if err != nil {
+		return nil, errorsx.Plugin(err)
+	}
+
+	values := []string{}
+	switch qm.VariableType {
+	case models.VariableTypeAccounts:
+		accounts, err := metadata.Accounts(ctx, lister)
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			values = append(values, strconv.Itoa(account.ID))
+		}
+	case models.VariableTypeEventTypes:
+		eventTypes, err := metadata.EventTypes(ctx, executor, accountID)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, eventTypes...)
+	case models.VariableTypeAttributeKeys:
+		attributes, err := metadata.Attributes(ctx, executor, accountID, qm.EventType)
+		if err != nil {
+			return nil, err
+		}
+		for _, attribute := range attributes {
+			values = append(values, attribute.Name)
+		}
+	case models.VariableTypeAttributeValues:
+		attributeValues, err := metadata.AttributeValues(ctx, executor, accountID, qm.EventType, qm.Attribute)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, attributeValues...)
+	}
+	return values, nil
+}
+
+// variableFieldName returns the name of the field holding a variable query's values.
+func variableFieldName(qm models.QueryModel) string {
+	switch qm.VariableType {
+	case models.VariableTypeAccounts:
+		return "accountId"
+	case models.VariableTypeEventTypes:
+		return "eventType"
+	case models.VariableTypeAttributeKeys:
+		return "attribute"
+	default:
+		return qm.Attribute
+	}
+}
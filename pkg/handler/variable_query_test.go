@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAccountLister lists two accounts.
+type stubAccountLister struct{}
+
+func (stubAccountLister) ListAccountsWithContext(context.Context, accounts.ListAccountsParams) ([]accounts.AccountOutline, error) {
+	return []accounts.AccountOutline{{ID: 2, Name: "staging"}, {ID: 1, Name: "production"}}, nil
+}
+
+func TestHandleVariableQuery(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{
+		{"facet": "web-1", "count": 2.0},
+		{"facet": "web-2", "count": 1.0},
+	}}}
+	lookups := 0
+	sources := func(_ context.Context, accountID int) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister, error) {
+		lookups++
+		return executor, stubAccountLister{}, nil
+	}
+	variableQuery := func(json string) backend.DataQuery {
+		return backend.DataQuery{RefID: "A", QueryType: models.QueryTypeVariable, JSON: []byte(json)}
+	}
+
+	t.Run("accounts", func(t *testing.T) {
+		resp := HandleVariableQuery(context.Background(), sources, nil, config, variableQuery(`{"variableType": "accounts"}`))
+		require.NoError(t, resp.Error)
+		require.Len(t, resp.Frames, 1)
+		require.Len(t, resp.Frames[0].Fields, 1)
+		field := resp.Frames[0].Fields[0]
+		assert.Equal(t, "accountId", field.Name)
+		assert.Equal(t, []string{"1", "2"}, []string{field.At(0).(string), field.At(1).(string)})
+	})
+
+	t.Run("attribute values are cached", func(t *testing.T) {
+		valueCache := cache.New()
+		query := variableQuery(`{"variableType": "attributeValues", "eventType": "Transaction", "attribute": "host"}`)
+		lookups = 0
+		for i := 0; i < 2; i++ {
+			resp := HandleVariableQuery(context.Background(), sources, valueCache, config, query)
+			require.NoError(t, resp.Error)
+			field := resp.Frames[0].Fields[0]
+			assert.Equal(t, "host", field.Name)
+			assert.Equal(t, 2, field.Len())
+		}
+		assert.Equal(t, 1, lookups)
+	})
+
+	t.Run("invalid variable type", func(t *testing.T) {
+		resp := HandleVariableQuery(context.Background(), sources, nil, config, variableQuery(`{"variableType": "hosts"}`))
+		require.Error(t, resp.Error)
+		assert.Contains(t, resp.Error.Error(), "invalid variableType 'hosts'")
+	})
+
+	t.Run("missing event type", func(t *testing.T) {
+		resp := HandleVariableQuery(context.Background(), sources, nil, config, variableQuery(`{"variableType": "attributeKeys"}`))
+		require.Error(t, resp.Error)
+		assert.Equal(t, "eventType is required", resp.Error.Error())
+	})
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/models"
+)
+
+// AllValue is the value Grafana sends for a variable's All option when the
+// variable has no custom all value.
+const AllValue = "$__all"
+
+// variableNamePattern matches valid template variable names.
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// globListPattern matches a multi-value variable Grafana has already formatted
+// in its default glob format inside an IN list, e.g. IN ({a,b}).
+var globListPattern = regexp.MustCompile(`(?i)(\bIN\s*\(\s*)\{([^{}]*)\}(\s*\))`)
+
+// conditionAttribute matches the attribute on the left of a WHERE condition.
+const conditionAttribute = "(?:`[^`]+`|[A-Za-z_][A-Za-z0-9_.]*)"
+
+// VariableError represents a template variable that cannot be interpolated.
+type VariableError struct {
+	Name string
+	Msg  string
+}
+
+func (e *VariableError) Error() string {
+	return fmt.Sprintf("cannot interpolate variable '%s': %s", e.Name, e.Msg)
+}
+
+// interpolateVariables renders multi-value template variables into the query.
+// Each reference ($name, ${name} or [[name]], optionally in single quotes) is
+// replaced with the variable's values as a comma-separated list of NRQL string
+// literals, which fits both attr = $name and attr IN ($name). Conditions on a
+// variable set to All are removed from the WHERE clause instead, as are
+// conditions on Grafana's $__all value. Lists already rendered in Grafana's
+// glob format, IN ({a,b}), are quoted the same way.
+func interpolateVariables(query string, variables []models.TemplateVariable) (string, error) {
+	for _, variable := range variables {
+		if !variableNamePattern.MatchString(variable.Name) {
+			return "", &VariableError{Name: variable.Name, Msg: "invalid variable name"}
+		}
+		ref := variableReference(regexp.QuoteMeta(variable.Name))
+		values := variable.Values
+		if variable.All || (len(values) == 1 && values[0] == AllValue) {
+			query = dropConditions(query, ref)
+			if values = allValues(values); len(values) == 0 && regexp.MustCompile(ref).MatchString(query) {
+				return "", &VariableError{Name: variable.Name, Msg: "All is selected but the variable is not in a WHERE condition that can be removed"}
+			}
+		}
+		if len(values) == 0 {
+			if regexp.MustCompile(ref).MatchString(query) {
+				return "", &VariableError{Name: variable.Name, Msg: "no value selected"}
+			}
+			continue
+		}
+		list := quotedList(values)
+		query = regexp.MustCompile(ref).ReplaceAllLiteralString(query, list)
+	}
+
+	query = dropConditions(query, `'?`+regexp.QuoteMeta(AllValue)+`'?`)
+	query = globListPattern.ReplaceAllStringFunc(query, func(match string) string {
+		parts := globListPattern.FindStringSubmatch(match)
+		return parts[1] + quotedList(strings.Split(parts[2], ",")) + parts[3]
+	})
+	return query, nil
+}
+
+// variableReference returns the pattern matching a reference to the variable,
+// optionally wrapped in single quotes.
+func variableReference(name string) string {
+	return `'?(?:\$\{` + name + `(?::[A-Za-z]+)?\}|\$` + name + `\b|\[\[` + name + `\]\])'?`
+}
+
+// dropConditions removes the WHERE conditions comparing an attribute with ref,
+// together with the AND joining them to the rest of the clause, or the whole
+// WHERE clause when it has no other condition. Conditions joined with OR are
+// left alone since removing them would change the meaning of the clause.
+func dropConditions(query string, ref string) string {
+	condition := conditionAttribute + `(?:\s+(?:NOT\s+)?IN\s*\(\s*` + ref + `\s*\)|\s*(?:=|!=)\s*` + ref + `)`
+	query = regexp.MustCompile(`(?i)\s+AND\s+`+condition).ReplaceAllString(query, "")
+	query = regexp.MustCompile(`(?i)`+condition+`\s+AND\s+`).ReplaceAllString(query, "")
+	clauseEnd := `(\s*$|\s+(?:` + strings.Join(whereClauseEndKeywords, "|") + `)\b)`
+	return regexp.MustCompile(`(?i)\s*\bWHERE\s+`+condition+clauseEnd).ReplaceAllString(query, "$1")
+}
+
+// allValues returns values without Grafana's $__all value.
+func allValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != AllValue {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// quotedList renders values as a comma-separated list of NRQL string literals.
+func quotedList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quoteString(strings.TrimSpace(value))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolateVariables(t *testing.T) {
+	apps := models.TemplateVariable{Name: "app", Values: []string{"checkout", "o'brien"}}
+
+	tests := []struct {
+		name      string
+		query     string
+		variables []models.TemplateVariable
+		want      string
+		wantErr   string
+	}{
+		{
+			name:  "no variables",
+			query: "SELECT count(*) FROM Transaction",
+			want:  "SELECT count(*) FROM Transaction",
+		},
+		{
+			name:      "multiple values in IN list",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ($app)",
+			variables: []models.TemplateVariable{apps},
+			want:      "SELECT count(*) FROM Transaction WHERE appName IN ('checkout', 'o\\'brien')",
+		},
+		{
+			name:      "braced and quoted reference",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ('${app}')",
+			variables: []models.TemplateVariable{apps},
+			want:      "SELECT count(*) FROM Transaction WHERE appName IN ('checkout', 'o\\'brien')",
+		},
+		{
+			name:      "single value",
+			query:     "SELECT count(*) FROM Transaction WHERE appName = [[app]]",
+			variables: []models.TemplateVariable{{Name: "app", Values: []string{"checkout"}}},
+			want:      "SELECT count(*) FROM Transaction WHERE appName = 'checkout'",
+		},
+		{
+			name:      "all drops the only condition",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ($app) FACET host",
+			variables: []models.TemplateVariable{{Name: "app", Values: []string{"a", "b"}, All: true}},
+			want:      "SELECT count(*) FROM Transaction FACET host",
+		},
+		{
+			name:      "all drops an ANDed condition",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ($app) AND duration > 1",
+			variables: []models.TemplateVariable{{Name: "app", All: true}},
+			want:      "SELECT count(*) FROM Transaction WHERE duration > 1",
+		},
+		{
+			name:      "all value from Grafana",
+			query:     "SELECT count(*) FROM Transaction WHERE duration > 1 AND appName = '$app'",
+			variables: []models.TemplateVariable{{Name: "app", Values: []string{AllValue}}},
+			want:      "SELECT count(*) FROM Transaction WHERE duration > 1",
+		},
+		{
+			name:      "all outside a removable condition uses every value",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ($app) OR host = 'x'",
+			variables: []models.TemplateVariable{{Name: "app", Values: []string{"a", "b"}, All: true}},
+			want:      "SELECT count(*) FROM Transaction WHERE appName IN ('a', 'b') OR host = 'x'",
+		},
+		{
+			name:      "all without values outside a removable condition",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ($app) OR host = 'x'",
+			variables: []models.TemplateVariable{{Name: "app", All: true}},
+			wantErr:   "cannot interpolate variable 'app'",
+		},
+		{
+			name:      "no value selected",
+			query:     "SELECT count(*) FROM Transaction WHERE appName IN ($app)",
+			variables: []models.TemplateVariable{{Name: "app"}},
+			wantErr:   "no value selected",
+		},
+		{
+			name:      "invalid name",
+			query:     "SELECT count(*) FROM Transaction",
+			variables: []models.TemplateVariable{{Name: "a b", Values: []string{"x"}}},
+			wantErr:   "invalid variable name",
+		},
+		{
+			name:  "pre-formatted glob list",
+			query: "SELECT count(*) FROM Transaction WHERE appName IN ({checkout,cart})",
+			want:  "SELECT count(*) FROM Transaction WHERE appName IN ('checkout', 'cart')",
+		},
+		{
+			name:  "pre-formatted all value",
+			query: "SELECT count(*) FROM Transaction WHERE appName IN ('$__all')",
+			want:  "SELECT count(*) FROM Transaction",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateVariables(tt.query, tt.variables)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleQuery_Variables(t *testing.T) {
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{AccountId: 123456}}
+	executor := &mockNRDBExecutor{results: &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"count": 1.0}}}}
+	query := backend.DataQuery{RefID: "A", JSON: []byte(`{
+		"queryText": "SELECT count(*) FROM Transaction WHERE appName IN ($app)",
+		"variables": [{"var": "app", "values": ["a", "b"]}]
+	}`)}
+
+	resp := HandleQuery(context.Background(), executor, config, query)
+	require.NoError(t, resp.Error)
+	require.NotEmpty(t, resp.Frames)
+	assert.Equal(t, "SELECT count(*) FROM Transaction WHERE appName IN ('a', 'b')", resp.Frames[0].Meta.ExecutedQueryString)
+}
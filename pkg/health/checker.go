@@ -8,17 +8,49 @@ import (
 	"fmt"
 
 	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/errorsx"
 	"newrelic-grafana-plugin/pkg/models"
 	"newrelic-grafana-plugin/pkg/nrdbiface"
 	"newrelic-grafana-plugin/pkg/validator"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
 )
 
 // checkHealthFunction allows for mocking the validator.CheckHealth function in tests
 var checkHealthFunction = validator.CheckHealth
 
+// clientKey is the context key carrying a New Relic client for the health check to reuse.
+type clientKey struct{}
+
+// WithClient returns a context that makes the health check use nrClient instead
+// of creating a New Relic client of its own.
+func WithClient(ctx context.Context, nrClient *newrelic.NewRelic) context.Context {
+	return context.WithValue(ctx, clientKey{}, nrClient)
+}
+
+// clientFromContext returns the New Relic client carried by ctx, if any.
+func clientFromContext(ctx context.Context) (*newrelic.NewRelic, bool) {
+	nrClient, ok := ctx.Value(clientKey{}).(*newrelic.NewRelic)
+	return nrClient, ok && nrClient != nil
+}
+
+// keyRotationKey is the context key carrying the API key state of the client.
+type keyRotationKey struct{}
+
+// WithKeyRotation returns a context that makes the health check report the
+// active API key of keys, the key state of the client passed with WithClient.
+func WithKeyRotation(ctx context.Context, keys *client.KeyRotation) context.Context {
+	return context.WithValue(ctx, keyRotationKey{}, keys)
+}
+
+// keyRotationFromContext returns the API key state carried by ctx, if any.
+func keyRotationFromContext(ctx context.Context) (*client.KeyRotation, bool) {
+	keys, ok := ctx.Value(keyRotationKey{}).(*client.KeyRotation)
+	return keys, ok && keys != nil
+}
+
 // ExecuteHealthCheck performs a comprehensive health check for the New Relic datasource.
 // It encapsulates the full logic for validating plugin settings, initializing the
 // New Relic client, and performing a test API call to New Relic.
@@ -41,19 +73,27 @@ func PerformHealthCheck1(ctx context.Context, dsSettings backend.DataSourceInsta
 	config, err := models.LoadPluginSettings(dsSettings)
 	if err != nil {
 		log.DefaultLogger.Error("health.ExecuteHealthCheck: Failed to load plugin settings", "error", err)
-		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("Failed to load datasource configuration: %s", err.Error()),
-		}, nil
+		return validator.SettingsErrorResult(fmt.Sprintf("Failed to load datasource configuration: %s", err.Error()), err), nil
+	}
+
+	// Invalid settings are reported with the path of each invalid setting, without
+	// contacting New Relic or running the diagnostics.
+	if err := validator.ValidatePluginSettings(config); err != nil {
+		log.DefaultLogger.Debug("health.ExecuteHealthCheck: Invalid plugin settings", "error", err)
+		return validator.SettingsErrorResult(fmt.Sprintf("Plugin configuration validation failed: %s", err.Error()), err), nil
 	}
 
 	// Step 2: Attempt to create a New Relic client using the API key from settings.
 	// This verifies that the API key is present and allows for basic client initialization.
-	clientConfig := client.DefaultConfig()
-	clientConfig.APIKey = config.Secrets.ApiKey
-	clientConfig.DatasourceUID = dsSettings.UID // Set the datasource UID for unique service name
-	log.DefaultLogger.Debug("health.ExecuteHealthCheck: Creating client with UID", "uid", dsSettings.UID)
-	nrClient, err := client.NewClient(clientConfig)
+	// A client passed in with WithClient is reused instead.
+	nrClient, ok := clientFromContext(ctx)
+	keys, _ := keyRotationFromContext(ctx)
+	if !ok {
+		if secondary := config.Secrets.SecondaryApiKey; secondary != "" {
+			keys = client.NewKeyRotation(config.Secrets.ApiKey, secondary)
+		}
+		nrClient, err = newHealthClient(ctx, config, dsSettings, keys)
+	}
 	if err != nil {
 		log.DefaultLogger.Error("health.ExecuteHealthCheck: Failed to create New Relic client", "error", err)
 		// Return a HealthStatusError to Grafana, indicating an issue with client setup.
@@ -74,14 +114,36 @@ func PerformHealthCheck1(ctx context.Context, dsSettings backend.DataSourceInsta
 		// This condition catches any unexpected Go errors returned by the validator.
 		// Ideally, validator.CheckHealth should always return a *backend.CheckHealthResult
 		// with an appropriate Status, making this 'checkErr' nil on expected outcomes.
-		log.DefaultLogger.Error("health.ExecuteHealthCheck: Unexpected error from validator.CheckHealth", "error", checkErr)
+		// Errors from New Relic are reported with their user-facing message, errors
+		// of the plugin itself as internal errors.
+		translated := errorsx.Translate(checkErr)
+		log.DefaultLogger.Error("health.ExecuteHealthCheck: Unexpected error from validator.CheckHealth", "kind", translated.Kind, "error", checkErr)
+		if translated.Kind == errorsx.KindPlugin {
+			return &backend.CheckHealthResult{
+				Status:  backend.HealthStatusError,
+				Message: fmt.Sprintf("Internal error during New Relic API check: %s", checkErr.Error()),
+			}, nil
+		}
 		return &backend.CheckHealthResult{
 			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("Internal error during New Relic API check: %s", checkErr.Error()),
+			Message: fmt.Sprintf("New Relic API check failed: %s", translated.Error()),
 		}, nil
 	}
 
-	// Step 5: Log the final health check status and message for internal debugging.
+	// Step 5: Explain a failed check by diagnosing the API key, account access and
+	// region, so users can tell which of them is wrong.
+	if healthResult != nil && healthResult.Status != backend.HealthStatusOk {
+		report := diagnoseFunction(ctx, config, &nrClient.NerdGraph, healthResult, dsSettings)
+		healthResult = withDiagnostics(healthResult, report)
+	}
+
+	// Step 6: Report which API key is in use, so users rotating keys can tell
+	// when the primary key has been rejected.
+	if healthResult != nil && keys != nil {
+		healthResult = withActiveKey(healthResult, keys)
+	}
+
+	// Step 7: Log the final health check status and message for internal debugging.
 	log.DefaultLogger.Debug("health.ExecuteHealthCheck: Health check completed", "status", healthResult.Status.String(), "message", healthResult.Message)
 	// Return the result directly from the validator to Grafana.
 	return healthResult, nil
@@ -91,3 +153,31 @@ var ExecuteHealthCheck = func(ctx context.Context, dsSettings backend.DataSource
 	// This variable is used to allow mocking in tests.
 	return PerformHealthCheck1(ctx, dsSettings)
 }
+
+// newHealthClient creates the New Relic client used by a health check. It uses
+// the datasource's proxy and TLS settings, and Grafana's secure socks proxy when
+// the datasource enables it.
+func newHealthClient(ctx context.Context, config *models.PluginSettings, dsSettings backend.DataSourceInstanceSettings, keys *client.KeyRotation) (*newrelic.NewRelic, error) {
+	clientConfig := client.ConfigFromSettings(config, dsSettings.UID)
+	clientConfig.KeyRotation = keys
+	proxyOptions, err := dsSettings.ProxyOptionsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clientConfig.SecureSocksProxy = proxyOptions
+	log.DefaultLogger.Debug("health.ExecuteHealthCheck: Creating client with UID", "uid", dsSettings.UID)
+	return client.NewClient(clientConfig)
+}
+
+// withActiveKey returns result with a line naming the API key in use.
+func withActiveKey(result *backend.CheckHealthResult, keys *client.KeyRotation) *backend.CheckHealthResult {
+	line := "Active API key: primary"
+	if keys.Active() == client.KeySecondary {
+		line = "Active API key: secondary. New Relic rejected the primary key; replace it to complete the key rotation."
+	}
+	return &backend.CheckHealthResult{
+		Status:      result.Status,
+		Message:     result.Message + "\n\n" + line,
+		JSONDetails: result.JSONDetails,
+	}
+}
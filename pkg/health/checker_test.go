@@ -3,9 +3,12 @@ package health
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/errorsx"
 	"newrelic-grafana-plugin/pkg/models"
 	"newrelic-grafana-plugin/pkg/nrdbiface"
 
@@ -234,7 +237,7 @@ func TestPerformHealthCheck1WithMockValidatorError(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, result)
 	assert.Equal(t, backend.HealthStatusError, result.Status)
-	assert.Contains(t, result.Message, "Internal error during New Relic API check")
+	assert.Contains(t, result.Message, "New Relic API check failed: New Relic API error")
 	assert.Contains(t, result.Message, "unexpected validator error")
 }
 
@@ -244,9 +247,9 @@ func TestPerformHealthCheck1_ValidatorError(t *testing.T) {
 	originalCheckHealthFunc := checkHealthFunction
 	defer func() { checkHealthFunction = originalCheckHealthFunc }()
 
-	// Mock the CheckHealth function to return an error
+	// Mock the CheckHealth function to return an error of the plugin itself
 	checkHealthFunction = func(ctx context.Context, settings *models.PluginSettings, executor nrdbiface.NRDBQueryExecutor) (*backend.CheckHealthResult, error) {
-		return nil, fmt.Errorf("unexpected validator error")
+		return nil, errorsx.Plugin(fmt.Errorf("unexpected validator error"))
 	}
 
 	// Use a valid settings object that would normally pass the earlier checks
@@ -395,3 +398,128 @@ func TestPerformHealthCheck1_WithUID(t *testing.T) {
 	// The key thing is that the function completes successfully with UID present
 	assert.NotEmpty(t, settings.UID, "UID should be present for this test")
 }
+
+// TestPerformHealthCheck1_WithClient verifies that a client passed with WithClient
+// is used instead of creating one from the settings.
+func TestPerformHealthCheck1_WithClient(t *testing.T) {
+	originalCheckHealthFunc := checkHealthFunction
+	defer func() { checkHealthFunction = originalCheckHealthFunc }()
+
+	checkHealthFunction = func(ctx context.Context, settings *models.PluginSettings, executor nrdbiface.NRDBQueryExecutor) (*backend.CheckHealthResult, error) {
+		if _, err := executor.QueryWithContext(ctx, settings.Secrets.AccountId, "SELECT 1"); err != nil {
+			return &backend.CheckHealthResult{Status: backend.HealthStatusError, Message: err.Error()}, nil
+		}
+		return &backend.CheckHealthResult{Status: backend.HealthStatusOk}, nil
+	}
+
+	// Only the passed client is pointed at this server; one created from the
+	// settings would query New Relic
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"actor":{"account":{"nrql":{"results":[{"count":1}]}}}}}`))
+	}))
+	defer server.Close()
+
+	settings := backend.DataSourceInstanceSettings{
+		DecryptedSecureJSONData: map[string]string{
+			"apiKey":    "test-api-key",
+			"accountID": "123456",
+		},
+		JSONData: []byte(`{}`),
+	}
+
+	nrClient, err := newrelic.New(newrelic.ConfigPersonalAPIKey("test-api-key"), newrelic.ConfigNerdGraphBaseURL(server.URL))
+	require.NoError(t, err)
+	result, err := PerformHealthCheck1(WithClient(context.Background(), nrClient), settings)
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, result.Status)
+	assert.Equal(t, 1, requests)
+}
+
+// TestPerformHealthCheck1_InvalidSettings verifies that invalid settings are
+// reported with the path and code of each problem, without contacting New Relic.
+func TestPerformHealthCheck1_InvalidSettings(t *testing.T) {
+	originalCheckHealthFunc := checkHealthFunction
+	defer func() { checkHealthFunction = originalCheckHealthFunc }()
+	checkHealthFunction = func(ctx context.Context, settings *models.PluginSettings, executor nrdbiface.NRDBQueryExecutor) (*backend.CheckHealthResult, error) {
+		t.Fatal("invalid settings must not be checked against New Relic")
+		return nil, nil
+	}
+
+	t.Run("invalid settings", func(t *testing.T) {
+		result, err := PerformHealthCheck1(context.Background(), backend.DataSourceInstanceSettings{
+			DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+			JSONData:                []byte(`{"region": "APAC", "maxSeries": -1}`),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, backend.HealthStatusError, result.Status)
+		assert.Contains(t, result.Message, "region: invalid region")
+		assert.Contains(t, result.Message, "maxSeries: invalid limits")
+		assert.JSONEq(t, `{"errors": [
+			{"field": "region", "code": "invalid", "message": "invalid region: new relic client error: unknown region 'APAC': must be one of US, EU, Staging, FedRAMP"},
+			{"field": "maxSeries", "code": "outOfRange", "message": "invalid limits: maxSeries must not be negative"}
+		]}`, string(result.JSONDetails))
+	})
+
+	t.Run("missing API key", func(t *testing.T) {
+		result, err := PerformHealthCheck1(context.Background(), backend.DataSourceInstanceSettings{
+			DecryptedSecureJSONData: map[string]string{"accountID": "123456"},
+			JSONData:                []byte(`{}`),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, backend.HealthStatusError, result.Status)
+		assert.JSONEq(t, `{"errors": [{"field": "apiKey", "code": "required", "message": "Enter New Relic API key."}]}`, string(result.JSONDetails))
+	})
+}
+
+// TestPerformHealthCheck1_ActiveKey verifies that the health check names the
+// active API key when a secondary key is configured.
+func TestPerformHealthCheck1_ActiveKey(t *testing.T) {
+	originalCheckHealthFunc := checkHealthFunction
+	defer func() { checkHealthFunction = originalCheckHealthFunc }()
+
+	checkHealthFunction = func(ctx context.Context, settings *models.PluginSettings, executor nrdbiface.NRDBQueryExecutor) (*backend.CheckHealthResult, error) {
+		return &backend.CheckHealthResult{Status: backend.HealthStatusOk, Message: "connected"}, nil
+	}
+
+	settings := backend.DataSourceInstanceSettings{
+		DecryptedSecureJSONData: map[string]string{
+			"apiKey":          "test-api-key",
+			"secondaryApiKey": "next-api-key",
+			"accountID":       "123456",
+		},
+		JSONData: []byte(`{}`),
+	}
+	nrClient, err := newrelic.New(newrelic.ConfigPersonalAPIKey("test-api-key"))
+	require.NoError(t, err)
+
+	result, err := PerformHealthCheck1(WithClient(context.Background(), nrClient), settings)
+	require.NoError(t, err)
+	assert.Equal(t, "connected", result.Message, "without the client's key state the active key is unknown")
+
+	keys := client.NewKeyRotation("test-api-key", "next-api-key")
+	ctx := WithKeyRotation(WithClient(context.Background(), nrClient), keys)
+	result, err = PerformHealthCheck1(ctx, settings)
+	require.NoError(t, err)
+	assert.Equal(t, "connected\n\nActive API key: primary", result.Message)
+
+	// A rejected primary key switches the rotation to the secondary key
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "next-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := keys.Transport(nil).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	result, err = PerformHealthCheck1(ctx, settings)
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusOk, result.Status)
+	assert.Contains(t, result.Message, "Active API key: secondary")
+}
@@ -0,0 +1,245 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// diagnosticsTimeout bounds the diagnostics run after a failed health check, so
+// that probing unreachable endpoints cannot hold up the health check response.
+const diagnosticsTimeout = 15 * time.Second
+
+// Diagnostic statuses.
+const (
+	DiagnosticOK      = "ok"
+	DiagnosticFailed  = "failed"
+	DiagnosticSkipped = "skipped"
+)
+
+// Diagnostic names, in the order they are run.
+const (
+	DiagnosticAPIKey        = "apiKey"
+	DiagnosticAccountAccess = "accountAccess"
+	DiagnosticNRQLQuery     = "nrqlQuery"
+	DiagnosticRegion        = "region"
+)
+
+// diagnosticTitles are the names of the diagnostics in the health check message.
+var diagnosticTitles = map[string]string{
+	DiagnosticAPIKey:        "API key",
+	DiagnosticAccountAccess: "Account access",
+	DiagnosticNRQLQuery:     "NRQL query",
+	DiagnosticRegion:        "Region",
+}
+
+// probedRegions are the regions tried with the API key when the configured
+// region rejects it.
+var probedRegions = []string{client.RegionUS, client.RegionEU}
+
+const userQuery = `{ actor { user { email } } }`
+
+const accountQuery = `query($accountId: Int!) { actor { account(id: $accountId) { id name } } }`
+
+// Diagnostic is the outcome of one diagnostic step.
+type Diagnostic struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Report is the outcome of the diagnostics, returned as the JSON details of a
+// failed health check.
+type Report struct {
+	Region          string       `json:"region"`
+	AccountID       int          `json:"accountId"`
+	Query           string       `json:"query"` // NRQL run by the health check
+	Diagnostics     []Diagnostic `json:"diagnostics"`
+	SuggestedRegion string       `json:"suggestedRegion,omitempty"` // Region that accepts the API key, when the configured one does not
+}
+
+// RegionProbe returns the NerdGraph executor of a client for another region.
+type RegionProbe func(ctx context.Context, region string) (nrdbiface.GraphQLExecutor, error)
+
+// diagnoseFunction runs the diagnostics of a failed health check. It is a
+// variable so tests can replace it.
+var diagnoseFunction = func(ctx context.Context, config *models.PluginSettings, executor nrdbiface.GraphQLExecutor, nrqlResult *backend.CheckHealthResult, dsSettings backend.DataSourceInstanceSettings) Report {
+	return Diagnose(ctx, config, executor, nrqlResult, func(ctx context.Context, region string) (nrdbiface.GraphQLExecutor, error) {
+		regionConfig := *config
+		regionConfig.Region = region
+		nrClient, err := newHealthClient(ctx, &regionConfig, dsSettings, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &nrClient.NerdGraph, nil
+	})
+}
+
+// Diagnose explains a failed health check by checking, in turn, that NerdGraph
+// accepts the API key, that the key can access the configured account, and the
+// result of the NRQL health query. When the configured region rejects the key,
+// the other regions are tried to detect a key created for a different region.
+func Diagnose(ctx context.Context, config *models.PluginSettings, executor nrdbiface.GraphQLExecutor, nrqlResult *backend.CheckHealthResult, probe RegionProbe) Report {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+
+	region, err := client.NormalizeRegion(config.Region)
+	if err != nil {
+		region = config.Region
+	}
+	report := Report{Region: region, AccountID: config.Secrets.AccountId, Query: validator.HealthCheckQuery(config)}
+
+	email, keyErr := checkAPIKey(ctx, executor)
+	keyRejected := keyErr != nil && errorsx.Classify(keyErr) == errorsx.KindAuth
+	switch {
+	case keyErr == nil:
+		report.add(DiagnosticAPIKey, DiagnosticOK, fmt.Sprintf("valid for user %s", email))
+	case keyRejected:
+		report.add(DiagnosticAPIKey, DiagnosticFailed, fmt.Sprintf("rejected by the %s region%s", region, keyTypeHint(config.Secrets.ApiKey)))
+	default:
+		report.add(DiagnosticAPIKey, DiagnosticFailed, fmt.Sprintf("could not be checked: %s", errorsx.Message(keyErr)))
+	}
+
+	if keyErr != nil {
+		report.add(DiagnosticAccountAccess, DiagnosticSkipped, "requires a valid API key")
+	} else {
+		report.add(checkAccountAccess(ctx, executor, config.Secrets.AccountId))
+	}
+
+	switch {
+	case nrqlResult == nil:
+		report.add(DiagnosticNRQLQuery, DiagnosticSkipped, "not run")
+	case nrqlResult.Status == backend.HealthStatusOk:
+		report.add(DiagnosticNRQLQuery, DiagnosticOK, nrqlResult.Message)
+	default:
+		report.add(DiagnosticNRQLQuery, DiagnosticFailed, fmt.Sprintf("%s (query: %s)", nrqlResult.Message, report.Query))
+	}
+
+	switch {
+	case keyErr == nil:
+		report.add(DiagnosticRegion, DiagnosticOK, fmt.Sprintf("the API key belongs to the %s region", region))
+	case !keyRejected || probe == nil:
+		report.add(DiagnosticRegion, DiagnosticSkipped, "the API key could not be checked")
+	default:
+		report.add(probeRegions(ctx, probe, region, &report))
+	}
+	return report
+}
+
+// add appends a diagnostic to the report.
+func (r *Report) add(name, status, message string) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Name: name, Status: status, Message: message})
+}
+
+// Message returns the report as lines to append to the health check message.
+func (r Report) Message() string {
+	lines := []string{"Diagnostics:"}
+	for _, diagnostic := range r.Diagnostics {
+		mark := "✅"
+		switch diagnostic.Status {
+		case DiagnosticFailed:
+			mark = "❌"
+		case DiagnosticSkipped:
+			mark = "⏭️"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s", mark, diagnosticTitles[diagnostic.Name], diagnostic.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkAPIKey returns the email of the user the API key belongs to.
+func checkAPIKey(ctx context.Context, executor nrdbiface.GraphQLExecutor) (string, error) {
+	var resp struct {
+		Actor struct {
+			User struct {
+				Email string `json:"email"`
+			} `json:"user"`
+		} `json:"actor"`
+	}
+	if err := executor.QueryWithResponseAndContext(ctx, userQuery, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Actor.User.Email, nil
+}
+
+// keyTypeHint returns a note on the type of a rejected API key: keys not in the
+// User key format are likely of a type NerdGraph does not accept.
+func keyTypeHint(apiKey string) string {
+	switch keyType := client.DetectKeyType(apiKey); {
+	case keyType == client.KeyTypeUser:
+		return ""
+	case keyType.CanQuery():
+		return fmt.Sprintf("; it is not a User key, which starts with %s", client.UserKeyPrefix)
+	default:
+		return fmt.Sprintf("; its %s key type cannot query New Relic", keyType)
+	}
+}
+
+// checkAccountAccess returns the diagnostic of the API key's access to accountID.
+func checkAccountAccess(ctx context.Context, executor nrdbiface.GraphQLExecutor, accountID int) (string, string, string) {
+	var resp struct {
+		Actor struct {
+			Account *struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			} `json:"account"`
+		} `json:"actor"`
+	}
+	err := executor.QueryWithResponseAndContext(ctx, accountQuery, map[string]interface{}{"accountId": accountID}, &resp)
+	switch {
+	case err != nil && errorsx.Classify(err) != errorsx.KindAuth:
+		return DiagnosticAccountAccess, DiagnosticFailed, fmt.Sprintf("could not be checked: %s", errorsx.Message(err))
+	case err != nil || resp.Actor.Account == nil:
+		return DiagnosticAccountAccess, DiagnosticFailed, fmt.Sprintf("the API key has no access to account %d", accountID)
+	default:
+		return DiagnosticAccountAccess, DiagnosticOK, fmt.Sprintf("account %d (%s)", accountID, resp.Actor.Account.Name)
+	}
+}
+
+// probeRegions returns the region diagnostic of an API key rejected by region,
+// setting the report's suggested region to the first other region accepting it.
+func probeRegions(ctx context.Context, probe RegionProbe, region string, report *Report) (string, string, string) {
+	var tried []string
+	for _, candidate := range probedRegions {
+		if candidate == region {
+			continue
+		}
+		tried = append(tried, candidate)
+		executor, err := probe(ctx, candidate)
+		if err != nil {
+			log.DefaultLogger.Debug("health: region probe client failed", "region", candidate, "error", err)
+			continue
+		}
+		if _, err := checkAPIKey(ctx, executor); err == nil {
+			report.SuggestedRegion = candidate
+			return DiagnosticRegion, DiagnosticFailed, fmt.Sprintf("the API key belongs to the %s region; change the datasource region from %s to %s", candidate, region, candidate)
+		}
+	}
+	return DiagnosticRegion, DiagnosticFailed, fmt.Sprintf("the API key is not accepted in %s either; it may be invalid, revoked or not a User key", strings.Join(tried, " or "))
+}
+
+// withDiagnostics returns result with the diagnostics report appended to its
+// message and attached as its JSON details.
+func withDiagnostics(result *backend.CheckHealthResult, report Report) *backend.CheckHealthResult {
+	details, err := json.Marshal(report)
+	if err != nil {
+		log.DefaultLogger.Error("health: failed to marshal diagnostics", "error", err)
+		return result
+	}
+	return &backend.CheckHealthResult{
+		Status:      result.Status,
+		Message:     result.Message + "\n\n" + report.Message(),
+		JSONDetails: details,
+	}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	nrerrors "github.com/newrelic/newrelic-client-go/v2/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nerdGraphStub answers the diagnostics queries, rejecting the API key when
+// unauthorized is set and finding no account when account is empty.
+func nerdGraphStub(unauthorized bool, account string) nrdbiface.GraphQLExecutor {
+	return nrdbiface.GraphQLExecutorFunc(func(_ context.Context, query string, _ map[string]interface{}) (interface{}, error) {
+		if unauthorized {
+			return nil, nrerrors.NewUnauthorizedError()
+		}
+		if query == userQuery {
+			return map[string]interface{}{"actor": map[string]interface{}{"user": map[string]interface{}{"email": "ada@example.com"}}}, nil
+		}
+		if account == "" {
+			return map[string]interface{}{"actor": map[string]interface{}{"account": nil}}, nil
+		}
+		return map[string]interface{}{"actor": map[string]interface{}{"account": map[string]interface{}{"id": 123456, "name": account}}}, nil
+	})
+}
+
+func TestDiagnose(t *testing.T) {
+	config := &models.PluginSettings{Region: "us", Secrets: &models.SecretPluginSettings{ApiKey: "key", AccountId: 123456}}
+	failed := &backend.CheckHealthResult{Status: backend.HealthStatusError, Message: "Authentication failed for account ID 123456."}
+	statuses := func(report Report) map[string]string {
+		result := map[string]string{}
+		for _, diagnostic := range report.Diagnostics {
+			result[diagnostic.Name] = diagnostic.Status
+		}
+		return result
+	}
+
+	t.Run("no access to the account", func(t *testing.T) {
+		report := Diagnose(context.Background(), config, nerdGraphStub(false, ""), failed, nil)
+		assert.Equal(t, "US", report.Region)
+		assert.Equal(t, 123456, report.AccountID)
+		assert.Equal(t, validator.DefaultHealthCheckQuery, report.Query)
+		assert.Equal(t, map[string]string{
+			DiagnosticAPIKey:        DiagnosticOK,
+			DiagnosticAccountAccess: DiagnosticFailed,
+			DiagnosticNRQLQuery:     DiagnosticFailed,
+			DiagnosticRegion:        DiagnosticOK,
+		}, statuses(report))
+		assert.Contains(t, report.Message(), "❌ Account access: the API key has no access to account 123456")
+		assert.Contains(t, report.Message(), "✅ API key: valid for user ada@example.com")
+	})
+
+	t.Run("key of another region", func(t *testing.T) {
+		var probed []string
+		report := Diagnose(context.Background(), config, nerdGraphStub(true, ""), failed, func(_ context.Context, region string) (nrdbiface.GraphQLExecutor, error) {
+			probed = append(probed, region)
+			return nerdGraphStub(false, "EU account"), nil
+		})
+		assert.Equal(t, []string{"EU"}, probed)
+		assert.Equal(t, "EU", report.SuggestedRegion)
+		assert.Equal(t, map[string]string{
+			DiagnosticAPIKey:        DiagnosticFailed,
+			DiagnosticAccountAccess: DiagnosticSkipped,
+			DiagnosticNRQLQuery:     DiagnosticFailed,
+			DiagnosticRegion:        DiagnosticFailed,
+		}, statuses(report))
+		assert.Contains(t, report.Message(), "change the datasource region from US to EU")
+	})
+
+	t.Run("key rejected everywhere", func(t *testing.T) {
+		report := Diagnose(context.Background(), config, nerdGraphStub(true, ""), failed, func(context.Context, string) (nrdbiface.GraphQLExecutor, error) {
+			return nerdGraphStub(true, ""), nil
+		})
+		assert.Empty(t, report.SuggestedRegion)
+		assert.Contains(t, report.Message(), "the API key is not accepted in EU either")
+	})
+
+	t.Run("key not in the User key format", func(t *testing.T) {
+		report := Diagnose(context.Background(), config, nerdGraphStub(true, ""), failed, nil)
+		assert.Contains(t, report.Message(), "❌ API key: rejected by the US region; it is not a User key, which starts with NRAK-")
+
+		userKey := *config
+		userKey.Secrets = &models.SecretPluginSettings{ApiKey: "NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0", AccountId: 123456}
+		report = Diagnose(context.Background(), &userKey, nerdGraphStub(true, ""), failed, nil)
+		assert.Contains(t, report.Message(), "❌ API key: rejected by the US region\n")
+	})
+
+	t.Run("key not checked", func(t *testing.T) {
+		unreachable := nrdbiface.GraphQLExecutorFunc(func(context.Context, string, map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("dial tcp: no such host")
+		})
+		report := Diagnose(context.Background(), config, unreachable, failed, func(context.Context, string) (nrdbiface.GraphQLExecutor, error) {
+			t.Fatal("regions must not be probed when the key could not be checked")
+			return nil, nil
+		})
+		assert.Equal(t, DiagnosticSkipped, statuses(report)[DiagnosticRegion])
+	})
+}
+
+func TestPerformHealthCheck1_Diagnostics(t *testing.T) {
+	originalCheckHealthFunc := checkHealthFunction
+	originalDiagnoseFunc := diagnoseFunction
+	defer func() {
+		checkHealthFunction = originalCheckHealthFunc
+		diagnoseFunction = originalDiagnoseFunc
+	}()
+
+	checkHealthFunction = func(ctx context.Context, settings *models.PluginSettings, executor nrdbiface.NRDBQueryExecutor) (*backend.CheckHealthResult, error) {
+		return &backend.CheckHealthResult{Status: backend.HealthStatusError, Message: "Authentication failed for account ID 123456."}, nil
+	}
+	diagnoseFunction = func(ctx context.Context, config *models.PluginSettings, executor nrdbiface.GraphQLExecutor, nrqlResult *backend.CheckHealthResult, dsSettings backend.DataSourceInstanceSettings) Report {
+		report := Report{Region: "US", AccountID: config.Secrets.AccountId, SuggestedRegion: "EU"}
+		report.add(DiagnosticRegion, DiagnosticFailed, "the API key belongs to the EU region")
+		return report
+	}
+
+	settings := backend.DataSourceInstanceSettings{
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+		JSONData:                []byte(`{}`),
+	}
+	result, err := PerformHealthCheck1(context.Background(), settings)
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, result.Status)
+	assert.Equal(t, "Authentication failed for account ID 123456.\n\nDiagnostics:\n❌ Region: the API key belongs to the EU region", result.Message)
+
+	var details Report
+	require.NoError(t, json.Unmarshal(result.JSONDetails, &details))
+	assert.Equal(t, "EU", details.SuggestedRegion)
+	require.Len(t, details.Diagnostics, 1)
+}
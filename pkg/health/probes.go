@@ -0,0 +1,173 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// probeTimeout bounds a run of the telemetry probes, so that an unresponsive
+// account cannot hold up the diagnostics resource.
+const probeTimeout = 20 * time.Second
+
+// StaleAfter is how old the latest event of a probed type may be before its
+// ingest is reported as stale.
+const StaleAfter = 15 * time.Minute
+
+// ProbedEventTypes are the event types probed for each account, one per kind of
+// telemetry: APM, logs, dimensional metrics and infrastructure.
+var ProbedEventTypes = []string{"Transaction", "Log", "Metric", "SystemSample"}
+
+// Probe statuses.
+const (
+	ProbeFresh  = "fresh"  // An event arrived within StaleAfter
+	ProbeStale  = "stale"  // The latest event is older than StaleAfter
+	ProbeNoData = "noData" // No event within the last day
+	ProbeFailed = "failed" // The query failed, e.g. the key has no access
+)
+
+// ProbeTarget is an account to probe, with the executor for its API key.
+type ProbeTarget struct {
+	Name      string
+	AccountID int
+	Executor  nrdbiface.NRDBQueryExecutor
+	Err       error // Set when no executor could be created for the account
+}
+
+// ProbeResult is the ingest freshness of an event type in an account.
+type ProbeResult struct {
+	EventType   string     `json:"eventType"`
+	Status      string     `json:"status"`
+	LatestEvent *time.Time `json:"latestEvent,omitempty"`
+	Age         string     `json:"age,omitempty"` // Age of the latest event, e.g. "3 minutes"
+	Message     string     `json:"message,omitempty"`
+}
+
+// AccountProbes are the probe results of an account.
+type AccountProbes struct {
+	Name      string        `json:"name"`
+	AccountID int           `json:"accountID"`
+	Summary   string        `json:"summary"` // e.g. "3 of 4 telemetry types fresh"
+	Probes    []ProbeResult `json:"probes"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ProbeAccounts runs a latest(timestamp) query per event type of
+// ProbedEventTypes for each target, concurrently, and reports how fresh each
+// type's ingest is at now. Queries the API key may not run are reported as
+// failed rather than failing the run.
+func ProbeAccounts(ctx context.Context, targets []ProbeTarget, now time.Time) []AccountProbes {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	reports := make([]AccountProbes, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		reports[i] = AccountProbes{Name: target.Name, AccountID: target.AccountID}
+		if target.Err != nil {
+			reports[i].Error = errorsx.Message(target.Err)
+			reports[i].Summary = "not probed"
+			continue
+		}
+		reports[i].Probes = make([]ProbeResult, len(ProbedEventTypes))
+		for j, eventType := range ProbedEventTypes {
+			wg.Add(1)
+			go func(result *ProbeResult, executor nrdbiface.NRDBQueryExecutor, accountID int, eventType string) {
+				defer wg.Done()
+				*result = probeEventType(ctx, executor, accountID, eventType, now)
+			}(&reports[i].Probes[j], target.Executor, target.AccountID, eventType)
+		}
+	}
+	wg.Wait()
+
+	for i := range reports {
+		if reports[i].Error == "" {
+			reports[i].Summary = probeSummary(reports[i].Probes)
+		}
+	}
+	return reports
+}
+
+// probeEventType returns the ingest freshness of eventType in accountID.
+func probeEventType(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, eventType string, now time.Time) ProbeResult {
+	result := ProbeResult{EventType: eventType}
+	query := nrdb.NRQL(fmt.Sprintf("SELECT latest(timestamp) FROM %s SINCE 1 day ago", eventType))
+	resp, err := executor.QueryWithContext(ctx, accountID, query)
+	if err != nil {
+		result.Status = ProbeFailed
+		result.Message = errorsx.Message(err)
+		return result
+	}
+
+	var millis float64
+	found := false
+	if resp != nil && len(resp.Results) > 0 {
+		millis, found = resp.Results[0]["latest.timestamp"].(float64)
+	}
+	if !found || millis <= 0 {
+		result.Status = ProbeNoData
+		result.Message = "no events in the last day"
+		return result
+	}
+
+	latest := timeutil.FromEpochMillis(millis).UTC()
+	age := now.Sub(latest)
+	if age < 0 {
+		age = 0
+	}
+	result.LatestEvent = &latest
+	result.Age = ageText(age)
+	result.Status = ProbeFresh
+	if age > StaleAfter {
+		result.Status = ProbeStale
+		result.Message = fmt.Sprintf("no events for %s", result.Age)
+	}
+	return result
+}
+
+// probeSummary returns how many of the probed types are fresh, and which failed.
+func probeSummary(probes []ProbeResult) string {
+	fresh, failed := 0, 0
+	for _, probe := range probes {
+		switch probe.Status {
+		case ProbeFresh:
+			fresh++
+		case ProbeFailed:
+			failed++
+		}
+	}
+	summary := fmt.Sprintf("%d of %d telemetry types fresh", fresh, len(probes))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	return summary
+}
+
+// ageText formats an event age in its largest whole unit, e.g. "3 minutes".
+func ageText(age time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{timeutil.Day, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	}
+	for _, unit := range units {
+		if n := int64(age / unit.size); n > 0 {
+			if n == 1 {
+				return "1 " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return "0 seconds"
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// probeExecutor returns the latest timestamp of each event type, or an error
+// for the event types in failing.
+type probeExecutor struct {
+	mu      sync.Mutex
+	latest  map[string]float64
+	failing map[string]bool
+	queries []nrdb.NRQL
+}
+
+func (e *probeExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.mu.Lock()
+	e.queries = append(e.queries, query)
+	e.mu.Unlock()
+	for _, eventType := range ProbedEventTypes {
+		if query != nrdb.NRQL("SELECT latest(timestamp) FROM "+eventType+" SINCE 1 day ago") {
+			continue
+		}
+		if e.failing[eventType] {
+			return nil, errors.New("401 Unauthorized")
+		}
+		if millis, ok := e.latest[eventType]; ok {
+			return &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"latest.timestamp": millis}}}, nil
+		}
+		return &nrdb.NRDBResultContainer{Results: []nrdb.NRDBResult{{"latest.timestamp": nil}}}, nil
+	}
+	return nil, errors.New("unexpected query")
+}
+
+func (e *probeExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func TestProbeAccounts(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	executor := &probeExecutor{
+		latest: map[string]float64{
+			"Transaction":  float64(now.Add(-30 * time.Second).UnixMilli()),
+			"Metric":       float64(now.Add(-2 * time.Hour).UnixMilli()),
+			"SystemSample": float64(now.Add(-time.Minute).UnixMilli()),
+		},
+		failing: map[string]bool{"SystemSample": true},
+	}
+	targets := []ProbeTarget{
+		{Name: "Default", AccountID: 1, Executor: executor},
+		{Name: "Staging", AccountID: 2, Err: errors.New("invalid API key")},
+	}
+
+	reports := ProbeAccounts(context.Background(), targets, now)
+	require.Len(t, reports, 2)
+	assert.Len(t, executor.queries, len(ProbedEventTypes))
+
+	report := reports[0]
+	assert.Equal(t, "Default", report.Name)
+	assert.Equal(t, "1 of 4 telemetry types fresh, 1 failed", report.Summary)
+	require.Len(t, report.Probes, 4)
+
+	byType := make(map[string]ProbeResult)
+	for _, probe := range report.Probes {
+		byType[probe.EventType] = probe
+	}
+	assert.Equal(t, ProbeFresh, byType["Transaction"].Status)
+	assert.Equal(t, "30 seconds", byType["Transaction"].Age)
+	assert.Equal(t, ProbeNoData, byType["Log"].Status)
+	assert.Nil(t, byType["Log"].LatestEvent)
+	assert.Equal(t, ProbeStale, byType["Metric"].Status)
+	assert.Equal(t, "no events for 2 hours", byType["Metric"].Message)
+	assert.Equal(t, ProbeFailed, byType["SystemSample"].Status)
+	assert.NotEmpty(t, byType["SystemSample"].Message)
+
+	assert.Equal(t, "Staging", reports[1].Name)
+	assert.Equal(t, "not probed", reports[1].Summary)
+	assert.NotEmpty(t, reports[1].Error)
+	assert.Empty(t, reports[1].Probes)
+}
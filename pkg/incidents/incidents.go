@@ -0,0 +1,242 @@
+// Package incidents fetches New Relic issues through the NerdGraph AI issues
+// API and formats them as a table of issues and as annotations, so that
+// incident overviews can be built from the same datasource as the NRQL panels.
+package incidents
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// MaxPages caps the number of issue pages fetched for one query.
+const MaxPages = 10
+
+// Names of the frames returned for an incidents query.
+const (
+	TableFrameName      = "incidents"
+	AnnotationFrameName = "incident_annotations"
+)
+
+// States are the issue states New Relic reports, in lifecycle order.
+var States = []string{"CREATED", "ACTIVATED", "DEACTIVATED", "CLOSED"}
+
+// issuesQuery fetches a page of the account's issues within a time window.
+const issuesQuery = `query($accountId: Int!, $timeWindow: TimeWindowInput!, $filter: AiIssuesFilterIssues, $cursor: String) {
+  actor {
+    account(id: $accountId) {
+      aiIssues {
+        issues(timeWindow: $timeWindow, filter: $filter, cursor: $cursor) {
+          issues {
+            issueId
+            title
+            description
+            priority
+            state
+            entityNames
+            sources
+            createdAt
+            activatedAt
+            closedAt
+          }
+          nextCursor
+        }
+      }
+    }
+  }
+}`
+
+// Querier runs NerdGraph queries. It is implemented by the New Relic client's
+// nerdgraph.NerdGraph.
+type Querier interface {
+	QueryWithResponseAndContext(ctx context.Context, query string, variables map[string]interface{}, respBody interface{}) error
+}
+
+// RequestError represents an invalid incidents query.
+type RequestError struct {
+	Msg string
+}
+
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// Issue is a New Relic issue, the grouping of incidents that alerts notify about.
+type Issue struct {
+	IssueID     string   `json:"issueId"`
+	Title       []string `json:"title"`
+	Description []string `json:"description"`
+	Priority    string   `json:"priority"`
+	State       string   `json:"state"`
+	EntityNames []string `json:"entityNames"`
+	Sources     []string `json:"sources"`
+	CreatedAt   int64    `json:"createdAt"`   // Epoch milliseconds
+	ActivatedAt int64    `json:"activatedAt"` // Epoch milliseconds, 0 until activated
+	ClosedAt    int64    `json:"closedAt"`    // Epoch milliseconds, 0 while open
+}
+
+// issuesResponse is the data of an issuesQuery response.
+type issuesResponse struct {
+	Actor struct {
+		Account struct {
+			AiIssues struct {
+				Issues struct {
+					Issues     []Issue `json:"issues"`
+					NextCursor string  `json:"nextCursor"`
+				} `json:"issues"`
+			} `json:"aiIssues"`
+		} `json:"account"`
+	} `json:"actor"`
+}
+
+// ValidateStates returns the states upper-cased, or a *RequestError naming the
+// first state New Relic does not report.
+func ValidateStates(states []string) ([]string, error) {
+	valid := make([]string, 0, len(states))
+	for _, state := range states {
+		upper := strings.ToUpper(strings.TrimSpace(state))
+		known := false
+		for _, s := range States {
+			known = known || s == upper
+		}
+		if !known {
+			return nil, &RequestError{Msg: fmt.Sprintf("invalid incident state '%s': must be one of %s", state, strings.Join(States, ", "))}
+		}
+		valid = append(valid, upper)
+	}
+	return valid, nil
+}
+
+// Fetch returns the issues of the account that were open at any time between
+// from and to, optionally limited to the given states, following up to MaxPages
+// pages. Issues are sorted by start time, most recent first.
+func Fetch(ctx context.Context, querier Querier, accountID int, from, to time.Time, states []string) ([]Issue, error) {
+	states, err := ValidateStates(states)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := map[string]interface{}{
+		"accountId":  accountID,
+		"timeWindow": map[string]interface{}{"startTime": from.UnixMilli(), "endTime": to.UnixMilli()},
+	}
+	if len(states) > 0 {
+		variables["filter"] = map[string]interface{}{"states": states}
+	}
+
+	var issues []Issue
+	for page := 0; page < MaxPages; page++ {
+		var resp issuesResponse
+		if err := querier.QueryWithResponseAndContext(ctx, issuesQuery, variables, &resp); err != nil {
+			return nil, err
+		}
+		result := resp.Actor.Account.AiIssues.Issues
+		issues = append(issues, result.Issues...)
+		if result.NextCursor == "" {
+			break
+		}
+		variables["cursor"] = result.NextCursor
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].start() > issues[j].start() })
+	return issues, nil
+}
+
+// start returns when the issue was activated, or created if it never was.
+func (i Issue) start() int64 {
+	if i.ActivatedAt > 0 {
+		return i.ActivatedAt
+	}
+	return i.CreatedAt
+}
+
+// end returns when the issue was closed, or nil while it is open.
+func (i Issue) end() *time.Time {
+	if i.ClosedAt <= 0 {
+		return nil
+	}
+	t := timeutil.FromEpochMillis(float64(i.ClosedAt))
+	return &t
+}
+
+// Response returns the issues as a table frame with a row per issue, and as a
+// frame of annotations spanning each issue's open period.
+func Response(issues []Issue) *backend.DataResponse {
+	return &backend.DataResponse{Frames: data.Frames{tableFrame(issues), annotationFrame(issues)}}
+}
+
+// tableFrame returns a table of the issues.
+func tableFrame(issues []Issue) *data.Frame {
+	var (
+		starts     []time.Time
+		ends       []*time.Time
+		titles     []string
+		priorities []string
+		states     []string
+		entities   []string
+		sources    []string
+		ids        []string
+	)
+	for _, issue := range issues {
+		starts = append(starts, timeutil.FromEpochMillis(float64(issue.start())))
+		ends = append(ends, issue.end())
+		titles = append(titles, strings.Join(issue.Title, "; "))
+		priorities = append(priorities, issue.Priority)
+		states = append(states, issue.State)
+		entities = append(entities, strings.Join(issue.EntityNames, ", "))
+		sources = append(sources, strings.Join(issue.Sources, ", "))
+		ids = append(ids, issue.IssueID)
+	}
+
+	frame := data.NewFrame(TableFrameName,
+		data.NewField("time", nil, starts),
+		data.NewField("timeEnd", nil, ends),
+		data.NewField("title", nil, titles),
+		data.NewField("priority", nil, priorities),
+		data.NewField("state", nil, states),
+		data.NewField("entities", nil, entities),
+		data.NewField("sources", nil, sources),
+		data.NewField("issueId", nil, ids),
+	)
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	return frame
+}
+
+// annotationFrame returns the issues as annotations, with the time, timeEnd,
+// title, text and tags fields Grafana reads annotations from.
+func annotationFrame(issues []Issue) *data.Frame {
+	var (
+		starts []time.Time
+		ends   []*time.Time
+		titles []string
+		texts  []string
+		tags   []string
+	)
+	for _, issue := range issues {
+		starts = append(starts, timeutil.FromEpochMillis(float64(issue.start())))
+		ends = append(ends, issue.end())
+		titles = append(titles, strings.Join(issue.Title, "; "))
+		texts = append(texts, strings.Join(issue.Description, "\n"))
+
+		issueTags := []string{strings.ToLower(issue.Priority), strings.ToLower(issue.State)}
+		issueTags = append(issueTags, issue.EntityNames...)
+		tags = append(tags, strings.Join(issueTags, ","))
+	}
+
+	frame := data.NewFrame(AnnotationFrameName,
+		data.NewField("time", nil, starts),
+		data.NewField("timeEnd", nil, ends),
+		data.NewField("title", nil, titles),
+		data.NewField("text", nil, texts),
+		data.NewField("tags", nil, tags),
+	)
+	frame.Meta = &data.FrameMeta{DataTopic: data.DataTopicAnnotations}
+	return frame
+}
@@ -0,0 +1,109 @@
+package incidents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQuerier returns the JSON pages in order and records the variables of each call.
+type fakeQuerier struct {
+	pages     []string
+	err       error
+	variables []map[string]interface{}
+}
+
+func (f *fakeQuerier) QueryWithResponseAndContext(_ context.Context, _ string, variables map[string]interface{}, respBody interface{}) error {
+	copied := make(map[string]interface{}, len(variables))
+	for k, v := range variables {
+		copied[k] = v
+	}
+	f.variables = append(f.variables, copied)
+	if f.err != nil {
+		return f.err
+	}
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return json.Unmarshal([]byte(page), respBody)
+}
+
+// issuesPage returns an issues response with the issues and next cursor.
+func issuesPage(cursor string, issues ...string) string {
+	list := "[]"
+	if len(issues) > 0 {
+		list = "[" + issues[0]
+		for _, issue := range issues[1:] {
+			list += "," + issue
+		}
+		list += "]"
+	}
+	return `{"actor":{"account":{"aiIssues":{"issues":{"issues":` + list + `,"nextCursor":"` + cursor + `"}}}}}`
+}
+
+func TestFetch(t *testing.T) {
+	from := time.UnixMilli(1700000000000)
+	to := from.Add(time.Hour)
+	querier := &fakeQuerier{pages: []string{
+		issuesPage("next", `{"issueId":"a","title":["High CPU"],"priority":"CRITICAL","state":"CLOSED","activatedAt":1700000100000,"closedAt":1700000200000}`),
+		issuesPage("", `{"issueId":"b","title":["Errors"],"priority":"HIGH","state":"ACTIVATED","createdAt":1700000300000}`),
+	}}
+
+	issues, err := Fetch(context.Background(), querier, 123, from, to, []string{"activated", "CLOSED"})
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	assert.Equal(t, "b", issues[0].IssueID, "most recent issue first")
+	assert.Equal(t, "a", issues[1].IssueID)
+
+	require.Len(t, querier.variables, 2)
+	assert.Equal(t, 123, querier.variables[0]["accountId"])
+	assert.Equal(t, map[string]interface{}{"startTime": from.UnixMilli(), "endTime": to.UnixMilli()}, querier.variables[0]["timeWindow"])
+	assert.Equal(t, map[string]interface{}{"states": []string{"ACTIVATED", "CLOSED"}}, querier.variables[0]["filter"])
+	assert.NotContains(t, querier.variables[0], "cursor")
+	assert.Equal(t, "next", querier.variables[1]["cursor"])
+}
+
+func TestFetch_Errors(t *testing.T) {
+	_, err := Fetch(context.Background(), &fakeQuerier{}, 123, time.Now(), time.Now(), []string{"open"})
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	assert.Contains(t, err.Error(), "invalid incident state 'open'")
+
+	_, err = Fetch(context.Background(), &fakeQuerier{err: errors.New("unauthorized")}, 123, time.Now(), time.Now(), nil)
+	assert.EqualError(t, err, "unauthorized")
+}
+
+func TestResponse(t *testing.T) {
+	resp := Response([]Issue{
+		{IssueID: "a", Title: []string{"High CPU"}, Description: []string{"CPU above 90%"}, Priority: "CRITICAL", State: "CLOSED", EntityNames: []string{"web-1"}, ActivatedAt: 1700000100000, ClosedAt: 1700000200000},
+		{IssueID: "b", Title: []string{"Errors"}, Priority: "HIGH", State: "ACTIVATED", CreatedAt: 1700000300000},
+	})
+	require.Len(t, resp.Frames, 2)
+
+	table := resp.Frames[0]
+	assert.Equal(t, TableFrameName, table.Name)
+	assert.Equal(t, data.VisType(data.VisTypeTable), table.Meta.PreferredVisualization)
+	rows, err := table.RowLen()
+	require.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, time.UnixMilli(1700000100000).UTC(), table.Fields[0].At(0).(time.Time).UTC())
+	assert.Equal(t, time.UnixMilli(1700000200000).UTC(), table.Fields[1].At(0).(*time.Time).UTC())
+	assert.Nil(t, table.Fields[1].At(1).(*time.Time), "open issues have no end")
+	assert.Equal(t, "High CPU", table.Fields[2].At(0))
+	assert.Equal(t, "web-1", table.Fields[5].At(0))
+
+	annotations := resp.Frames[1]
+	assert.Equal(t, data.DataTopicAnnotations, annotations.Meta.DataTopic)
+	names := make([]string, len(annotations.Fields))
+	for i, field := range annotations.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"time", "timeEnd", "title", "text", "tags"}, names)
+	assert.Equal(t, "CPU above 90%", annotations.Fields[3].At(0))
+	assert.Equal(t, "critical,closed,web-1", annotations.Fields[4].At(0))
+}
@@ -0,0 +1,178 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+)
+
+// MaxCatalogEventTypes is the most event types a catalog lookup accepts, as each
+// costs a keyset() query.
+const MaxCatalogEventTypes = 10
+
+// AttributeDoc documents an attribute of the data dictionary.
+type AttributeDoc struct {
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"` // string, numeric or boolean
+	Unit        string `json:"unit,omitempty"` // Grafana unit, e.g. "s" or "bytes"
+}
+
+// CatalogAttribute is a reported attribute with its documentation, if the
+// data dictionary has any.
+type CatalogAttribute struct {
+	Name string `json:"name"`
+	AttributeDoc
+}
+
+// EventTypeCatalog lists the attributes reported for an event type.
+type EventTypeCatalog struct {
+	EventType   string             `json:"eventType"`
+	Description string             `json:"description,omitempty"`
+	Attributes  []CatalogAttribute `json:"attributes"`
+}
+
+// eventTypeDocs describes the event types of the data dictionary.
+var eventTypeDocs = map[string]string{
+	"Transaction":      "A web or background transaction of an APM-monitored application",
+	"TransactionError": "An error raised during an APM transaction",
+	"PageView":         "A page load measured by the browser agent",
+	"Span":             "An operation of a distributed trace",
+	"SystemSample":     "A periodic sample of a host's CPU, memory and disk usage",
+	"ProcessSample":    "A periodic sample of a process's resource usage",
+	"Log":              "A log record forwarded to New Relic",
+	"Metric":           "A dimensional metric data point",
+}
+
+// commonAttributes are documented for every event type.
+var commonAttributes = map[string]AttributeDoc{
+	"timestamp":  {Description: "When the event occurred, in epoch milliseconds", Type: "numeric", Unit: "dateTimeAsIso"},
+	"appName":    {Description: "Name of the application that reported the event", Type: "string"},
+	"appId":      {Description: "ID of the application that reported the event", Type: "numeric"},
+	"entityGuid": {Description: "GUID of the entity that reported the event", Type: "string"},
+	"host":       {Description: "Name of the host the event was reported from", Type: "string"},
+	"hostname":   {Description: "Name of the host the event was reported from", Type: "string"},
+}
+
+// attributeDocs documents attributes by event type.
+var attributeDocs = map[string]map[string]AttributeDoc{
+	"Transaction": {
+		"duration":         {Description: "Total server-side response time of the transaction", Type: "numeric", Unit: "s"},
+		"databaseDuration": {Description: "Time spent in database calls", Type: "numeric", Unit: "s"},
+		"externalDuration": {Description: "Time spent in calls to external services", Type: "numeric", Unit: "s"},
+		"queueDuration":    {Description: "Time the request waited in a queue before processing", Type: "numeric", Unit: "s"},
+		"totalTime":        {Description: "Sum of the time spent in the transaction's segments, including async work", Type: "numeric", Unit: "s"},
+		"webDuration":      {Description: "Response time of web transactions", Type: "numeric", Unit: "s"},
+		"name":             {Description: "Name of the transaction", Type: "string"},
+		"transactionType":  {Description: "Web or Other (background)", Type: "string"},
+		"httpResponseCode": {Description: "HTTP status code of the response", Type: "string"},
+		"request.method":   {Description: "HTTP method of the request", Type: "string"},
+		"error":            {Description: "Whether the transaction had an error", Type: "boolean"},
+	},
+	"TransactionError": {
+		"error.class":     {Description: "Class or type of the error", Type: "string"},
+		"error.message":   {Description: "Message of the error", Type: "string"},
+		"transactionName": {Description: "Name of the transaction the error occurred in", Type: "string"},
+	},
+	"PageView": {
+		"duration":              {Description: "Total page load time", Type: "numeric", Unit: "s"},
+		"backendDuration":       {Description: "Time from the request to the first byte of the response", Type: "numeric", Unit: "s"},
+		"networkDuration":       {Description: "Time spent on the network", Type: "numeric", Unit: "s"},
+		"domProcessingDuration": {Description: "Time to process the DOM once the page was received", Type: "numeric", Unit: "s"},
+		"pageRenderingDuration": {Description: "Time to render the page after the DOM was processed", Type: "numeric", Unit: "s"},
+		"pageUrl":               {Description: "URL of the page", Type: "string"},
+		"countryCode":           {Description: "Country of the visitor", Type: "string"},
+		"userAgentName":         {Description: "Browser of the visitor", Type: "string"},
+	},
+	"Span": {
+		"duration.ms":  {Description: "Duration of the span", Type: "numeric", Unit: "ms"},
+		"name":         {Description: "Name of the operation", Type: "string"},
+		"trace.id":     {Description: "ID of the trace the span belongs to", Type: "string"},
+		"service.name": {Description: "Name of the service that reported the span", Type: "string"},
+		"span.kind":    {Description: "Role of the span: client, server, producer, consumer or internal", Type: "string"},
+	},
+	"SystemSample": {
+		"cpuPercent":           {Description: "CPU used by the host, across all cores", Type: "numeric", Unit: "percent"},
+		"cpuIOWaitPercent":     {Description: "CPU time spent waiting for I/O", Type: "numeric", Unit: "percent"},
+		"memoryUsedPercent":    {Description: "Memory in use", Type: "numeric", Unit: "percent"},
+		"memoryUsedBytes":      {Description: "Memory in use", Type: "numeric", Unit: "bytes"},
+		"memoryTotalBytes":     {Description: "Total memory of the host", Type: "numeric", Unit: "bytes"},
+		"diskUsedPercent":      {Description: "Disk space in use", Type: "numeric", Unit: "percent"},
+		"loadAverageOneMinute": {Description: "Load average over the last minute", Type: "numeric"},
+	},
+	"ProcessSample": {
+		"cpuPercent":              {Description: "CPU used by the process", Type: "numeric", Unit: "percent"},
+		"memoryResidentSizeBytes": {Description: "Resident memory of the process", Type: "numeric", Unit: "bytes"},
+		"processDisplayName":      {Description: "Display name of the process", Type: "string"},
+		"processId":               {Description: "ID of the process", Type: "numeric"},
+	},
+	"Log": {
+		"message": {Description: "Text of the log record", Type: "string"},
+		"level":   {Description: "Severity of the log record", Type: "string"},
+	},
+	"Metric": {
+		"metricName":      {Description: "Name of the metric", Type: "string"},
+		"newrelic.source": {Description: "How the metric reached New Relic, e.g. prometheusAPI or metricAPI", Type: "string"},
+	},
+}
+
+// LookupAttribute returns the data dictionary entry of attribute for eventType.
+func LookupAttribute(eventType, attribute string) (AttributeDoc, bool) {
+	if doc, ok := attributeDocs[eventType][attribute]; ok {
+		return doc, true
+	}
+	doc, ok := commonAttributes[attribute]
+	return doc, ok
+}
+
+// Catalog returns the attributes reported for each of eventTypes within
+// Lookback, with their description, data type and unit from the data
+// dictionary where it has them. The type New Relic reports takes precedence
+// over the dictionary's.
+func Catalog(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, eventTypes []string) ([]EventTypeCatalog, error) {
+	if len(eventTypes) == 0 {
+		return nil, &RequestError{Msg: "eventType is required"}
+	}
+	if len(eventTypes) > MaxCatalogEventTypes {
+		return nil, &RequestError{Msg: fmt.Sprintf("at most %d event types can be looked up at once, got %d", MaxCatalogEventTypes, len(eventTypes))}
+	}
+
+	catalogs := make([]EventTypeCatalog, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		attributes, err := Attributes(ctx, executor, accountID, eventType)
+		if err != nil {
+			return nil, err
+		}
+		catalog := EventTypeCatalog{
+			EventType:   eventType,
+			Description: eventTypeDocs[eventType],
+			Attributes:  make([]CatalogAttribute, len(attributes)),
+		}
+		for i, attribute := range attributes {
+			doc, _ := LookupAttribute(eventType, attribute.Name)
+			if attribute.Type != "" {
+				doc.Type = attribute.Type
+			}
+			catalog.Attributes[i] = CatalogAttribute{Name: attribute.Name, AttributeDoc: doc}
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	return catalogs, nil
+}
+
+// SplitEventTypes returns the event types of the values of a repeated or
+// comma-separated eventType parameter, without duplicates.
+func SplitEventTypes(values []string) []string {
+	seen := make(map[string]bool)
+	var eventTypes []string
+	for _, value := range values {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" && !seen[eventType] {
+				seen[eventType] = true
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+	}
+	return eventTypes
+}
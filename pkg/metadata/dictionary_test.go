@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalog(t *testing.T) {
+	executor := &stubExecutor{results: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"key": "duration", "type": "numeric"},
+			{"key": "appName", "type": "string"},
+			{"key": "custom.tier", "type": "string"},
+		},
+	}}
+
+	catalogs, err := Catalog(context.Background(), executor, 12345, []string{"Transaction"})
+	require.NoError(t, err)
+	assert.Equal(t, nrdb.NRQL("SELECT keyset() FROM Transaction SINCE 1 week ago"), executor.lastQuery)
+	require.Len(t, catalogs, 1)
+	assert.Equal(t, "Transaction", catalogs[0].EventType)
+	assert.NotEmpty(t, catalogs[0].Description)
+	assert.Equal(t, []CatalogAttribute{
+		{Name: "appName", AttributeDoc: commonAttributes["appName"]},
+		{Name: "custom.tier", AttributeDoc: AttributeDoc{Type: "string"}},
+		{Name: "duration", AttributeDoc: AttributeDoc{Description: "Total server-side response time of the transaction", Type: "numeric", Unit: "s"}},
+	}, catalogs[0].Attributes)
+}
+
+func TestCatalog_ReportedTypeWins(t *testing.T) {
+	executor := &stubExecutor{results: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"key": "httpResponseCode", "type": "numeric"}, {"key": "processId"}},
+	}}
+
+	catalogs, err := Catalog(context.Background(), executor, 12345, []string{"Transaction"})
+	require.NoError(t, err)
+	assert.Equal(t, "numeric", catalogs[0].Attributes[0].Type)
+	assert.Equal(t, "", catalogs[0].Attributes[1].Type, "dictionary entries of other event types do not apply")
+}
+
+func TestCatalog_InvalidRequest(t *testing.T) {
+	executor := &stubExecutor{}
+	tests := []struct {
+		name       string
+		eventTypes []string
+		wantErr    string
+	}{
+		{"no event types", nil, "eventType is required"},
+		{"too many event types", make([]string, MaxCatalogEventTypes+1), "at most 10 event types can be looked up at once, got 11"},
+		{"invalid event type", []string{"Transaction SINCE"}, "invalid eventType 'Transaction SINCE'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Catalog(context.Background(), executor, 12345, tt.eventTypes)
+			var requestErr *RequestError
+			require.ErrorAs(t, err, &requestErr)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
+
+func TestSplitEventTypes(t *testing.T) {
+	assert.Equal(t, []string{"Transaction", "PageView", "Log"}, SplitEventTypes([]string{"Transaction, PageView", "Log", "Transaction", ""}))
+	assert.Empty(t, SplitEventTypes(nil))
+}
@@ -0,0 +1,194 @@
+// Package metadata runs the metadata lookups behind template variables and
+// query-builder dropdowns: the event types and attributes an account reports,
+// and the accounts the API key can access.
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/utils"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// Lookback is the period searched for reported event types and attributes.
+const Lookback = "1 week ago"
+
+// eventTypePattern matches event type names that can be used in a FROM clause.
+var eventTypePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_:.]*$`)
+
+// RequestError represents invalid input to a metadata lookup.
+type RequestError struct {
+	Msg string
+}
+
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// Attribute is an attribute reported for an event type.
+type Attribute struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"` // string, numeric or boolean, when New Relic reports it
+}
+
+// Account is an account the API key can access.
+type Account struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// AccountLister lists the accounts the API key can access. It is implemented by
+// the New Relic client's accounts.Accounts.
+type AccountLister interface {
+	ListAccountsWithContext(ctx context.Context, params accounts.ListAccountsParams) ([]accounts.AccountOutline, error)
+}
+
+// EventTypes returns the sorted event types the account reported within Lookback.
+func EventTypes(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int) ([]string, error) {
+	results, err := executor.QueryWithContext(ctx, accountID, nrdb.NRQL("SHOW EVENT TYPES SINCE "+Lookback))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range results.Results {
+		if eventType, ok := row["eventType"].(string); ok {
+			seen[eventType] = true
+		}
+		for _, eventType := range stringValues(row["eventTypes"]) {
+			seen[eventType] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// Attributes returns the attributes reported for eventType within Lookback, sorted by name.
+func Attributes(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, eventType string) ([]Attribute, error) {
+	if eventType == "" {
+		return nil, &RequestError{Msg: "eventType is required"}
+	}
+	if !eventTypePattern.MatchString(eventType) {
+		return nil, &RequestError{Msg: fmt.Sprintf("invalid eventType '%s'", eventType)}
+	}
+
+	query := fmt.Sprintf("SELECT keyset() FROM %s SINCE %s", eventType, Lookback)
+	results, err := executor.QueryWithContext(ctx, accountID, nrdb.NRQL(query))
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]string)
+	for _, row := range results.Results {
+		// keyset() returns either one row per attribute ...
+		if key, ok := row["key"].(string); ok {
+			attrType, _ := row["type"].(string)
+			types[key] = attrType
+		}
+		// ... or a single row listing the keys by type
+		for _, key := range stringValues(row["allKeys"]) {
+			if _, ok := types[key]; !ok {
+				types[key] = ""
+			}
+		}
+		for column, attrType := range map[string]string{"stringKeys": "string", "numericKeys": "numeric", "booleanKeys": "boolean"} {
+			for _, key := range stringValues(row[column]) {
+				types[key] = attrType
+			}
+		}
+	}
+
+	attributes := make([]Attribute, 0, len(types))
+	for name, attrType := range types {
+		attributes = append(attributes, Attribute{Name: name, Type: attrType})
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Name < attributes[j].Name })
+	return attributes, nil
+}
+
+// AttributeValues returns the values of attribute reported for eventType within
+// Lookback, sorted. The values are the facets of a count(*) query with LIMIT MAX,
+// so at most the NRQL facet limit of values is returned.
+func AttributeValues(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, eventType, attribute string) ([]string, error) {
+	if eventType == "" {
+		return nil, &RequestError{Msg: "eventType is required"}
+	}
+	if !eventTypePattern.MatchString(eventType) {
+		return nil, &RequestError{Msg: fmt.Sprintf("invalid eventType '%s'", eventType)}
+	}
+	if attribute == "" {
+		return nil, &RequestError{Msg: "attribute is required"}
+	}
+	if strings.Contains(attribute, "`") {
+		return nil, &RequestError{Msg: fmt.Sprintf("invalid attribute '%s'", attribute)}
+	}
+
+	query := fmt.Sprintf("SELECT count(*) FROM %s FACET `%s` SINCE %s LIMIT MAX", eventType, attribute, Lookback)
+	results, err := executor.QueryWithContext(ctx, accountID, nrdb.NRQL(query))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range results.Results {
+		value, ok := row[utils.FacetFieldName]
+		if !ok {
+			value, ok = row[attribute]
+		}
+		if ok && value != nil {
+			seen[fmt.Sprintf("%v", value)] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// Accounts returns the accounts the API key can access, sorted by name.
+func Accounts(ctx context.Context, lister AccountLister) ([]Account, error) {
+	outlines, err := lister.ListAccountsWithContext(ctx, accounts.ListAccountsParams{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Account, 0, len(outlines))
+	for _, outline := range outlines {
+		result = append(result, Account{ID: outline.ID, Name: outline.Name})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// stringValues returns the strings in a JSON array value.
+func stringValues(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// sortedKeys returns the keys of set in ascending order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubExecutor returns canned results and records the last query.
+type stubExecutor struct {
+	results   *nrdb.NRDBResultContainer
+	err       error
+	lastQuery nrdb.NRQL
+}
+
+func (e *stubExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.lastQuery = query
+	return e.results, e.err
+}
+
+func (e *stubExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, errors.New("not supported")
+}
+
+// stubLister returns canned accounts.
+type stubLister struct {
+	accounts []accounts.AccountOutline
+	err      error
+}
+
+func (l *stubLister) ListAccountsWithContext(ctx context.Context, params accounts.ListAccountsParams) ([]accounts.AccountOutline, error) {
+	return l.accounts, l.err
+}
+
+func TestEventTypes(t *testing.T) {
+	executor := &stubExecutor{results: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"eventTypes": []interface{}{"Transaction", "Log"}},
+			{"eventType": "PageView"},
+			{"eventType": "Log"},
+		},
+	}}
+
+	eventTypes, err := EventTypes(context.Background(), executor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Log", "PageView", "Transaction"}, eventTypes)
+	assert.Equal(t, nrdb.NRQL("SHOW EVENT TYPES SINCE 1 week ago"), executor.lastQuery)
+
+	executor.err = errors.New("boom")
+	_, err = EventTypes(context.Background(), executor, 1)
+	assert.EqualError(t, err, "boom")
+}
+
+func TestAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []nrdb.NRDBResult
+		want    []Attribute
+	}{
+		{
+			name: "row per attribute",
+			results: []nrdb.NRDBResult{
+				{"key": "duration", "type": "numeric"},
+				{"key": "appName", "type": "string"},
+			},
+			want: []Attribute{{Name: "appName", Type: "string"}, {Name: "duration", Type: "numeric"}},
+		},
+		{
+			name: "keys grouped by type",
+			results: []nrdb.NRDBResult{{
+				"allKeys":     []interface{}{"appName", "duration", "error", "other"},
+				"stringKeys":  []interface{}{"appName"},
+				"numericKeys": []interface{}{"duration"},
+				"booleanKeys": []interface{}{"error"},
+			}},
+			want: []Attribute{
+				{Name: "appName", Type: "string"},
+				{Name: "duration", Type: "numeric"},
+				{Name: "error", Type: "boolean"},
+				{Name: "other"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &stubExecutor{results: &nrdb.NRDBResultContainer{Results: tt.results}}
+			attributes, err := Attributes(context.Background(), executor, 1, "Transaction")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, attributes)
+			assert.Equal(t, nrdb.NRQL("SELECT keyset() FROM Transaction SINCE 1 week ago"), executor.lastQuery)
+		})
+	}
+}
+
+func TestAttributes_InvalidEventType(t *testing.T) {
+	for _, eventType := range []string{"", "Transaction SINCE 1 day ago", "`Log`", "1abc"} {
+		t.Run(eventType, func(t *testing.T) {
+			executor := &stubExecutor{}
+			_, err := Attributes(context.Background(), executor, 1, eventType)
+			var requestErr *RequestError
+			assert.True(t, errors.As(err, &requestErr))
+			assert.Empty(t, executor.lastQuery, "no query must be sent")
+		})
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	lister := &stubLister{accounts: []accounts.AccountOutline{
+		{ID: 3, Name: "Staging"},
+		{ID: 2, Name: "Production"},
+		{ID: 1, Name: "Production"},
+	}}
+
+	result, err := Accounts(context.Background(), lister)
+	require.NoError(t, err)
+	assert.Equal(t, []Account{{ID: 1, Name: "Production"}, {ID: 2, Name: "Production"}, {ID: 3, Name: "Staging"}}, result)
+
+	lister.err = errors.New("forbidden")
+	_, err = Accounts(context.Background(), lister)
+	assert.EqualError(t, err, "forbidden")
+}
+
+func TestAttributeValues(t *testing.T) {
+	executor := &stubExecutor{results: &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{
+			{"facet": "web-2", "host": "web-2", "count": 3.0},
+			{"facet": "web-1", "host": "web-1", "count": 5.0},
+			{"facet": nil, "count": 1.0},
+		},
+	}}
+
+	values, err := AttributeValues(context.Background(), executor, 1, "Transaction", "host")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web-1", "web-2"}, values)
+	assert.Equal(t, nrdb.NRQL("SELECT count(*) FROM Transaction FACET `host` SINCE 1 week ago LIMIT MAX"), executor.lastQuery)
+
+	for _, tc := range []struct{ eventType, attribute, msg string }{
+		{"", "host", "eventType is required"},
+		{"Transaction;", "host", "invalid eventType 'Transaction;'"},
+		{"Transaction", "", "attribute is required"},
+		{"Transaction", "a`b", "invalid attribute 'a`b'"},
+	} {
+		_, err := AttributeValues(context.Background(), executor, 1, tc.eventType, tc.attribute)
+		var requestErr *RequestError
+		require.True(t, errors.As(err, &requestErr), tc.msg)
+		assert.Equal(t, tc.msg, err.Error())
+	}
+}
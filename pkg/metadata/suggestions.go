@@ -0,0 +1,96 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// SampleLookback is the period sampled for recent attribute values.
+const SampleLookback = "1 hour ago"
+
+// Limits of the recent values sampled for suggestions.
+const (
+	sampleEvents = 20 // Events sampled per event type
+	MaxValues    = 5  // Recent values suggested per attribute
+)
+
+// fromPattern matches the first event type in the FROM clause of a (possibly
+// partial) NRQL query.
+var fromPattern = regexp.MustCompile("(?i)\\bFROM\\s+`?([A-Za-z_][A-Za-z0-9_:.]*)")
+
+// AttributeSuggestion is an attribute with recent values, offered by the query
+// editor's typeahead.
+type AttributeSuggestion struct {
+	Attribute
+	Values []string `json:"values,omitempty"` // Recent distinct values, most recent first
+}
+
+// QueryEventType returns the first event type in the FROM clause of a possibly
+// partial NRQL query, or "" if the query has no FROM clause yet.
+func QueryEventType(query string) string {
+	if match := fromPattern.FindStringSubmatch(query); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// Suggestions returns the attributes reported for eventType within Lookback,
+// each with up to MaxValues values seen in recent events. Values are a best
+// effort: if sampling recent events fails the attributes are returned without them.
+func Suggestions(ctx context.Context, executor nrdbiface.NRDBQueryExecutor, accountID int, eventType string) ([]AttributeSuggestion, error) {
+	attributes, err := Attributes(ctx, executor, accountID, eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s SINCE %s LIMIT %d", eventType, SampleLookback, sampleEvents)
+	var events []nrdb.NRDBResult
+	if results, err := executor.QueryWithContext(ctx, accountID, nrdb.NRQL(query)); err == nil && results != nil {
+		events = results.Results
+	}
+
+	suggestions := make([]AttributeSuggestion, 0, len(attributes))
+	for _, attribute := range attributes {
+		suggestions = append(suggestions, AttributeSuggestion{
+			Attribute: attribute,
+			Values:    recentValues(events, attribute.Name),
+		})
+	}
+	return suggestions, nil
+}
+
+// recentValues returns up to MaxValues distinct scalar values of name in events,
+// in the order they appear. Timestamps are skipped as they are never useful
+// suggestions.
+func recentValues(events []nrdb.NRDBResult, name string) []string {
+	if name == "timestamp" {
+		return nil
+	}
+	var values []string
+	seen := make(map[string]bool)
+	for _, event := range events {
+		var value string
+		switch v := event[name].(type) {
+		case string:
+			value = v
+		case float64, bool:
+			value = fmt.Sprint(v)
+		default:
+			continue
+		}
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+		if len(values) == MaxValues {
+			break
+		}
+	}
+	return values
+}
@@ -0,0 +1,76 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queryExecutor returns canned results by query.
+type queryExecutor struct {
+	results map[nrdb.NRQL]*nrdb.NRDBResultContainer
+	errs    map[nrdb.NRQL]error
+}
+
+func (e *queryExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	return e.results[query], e.errs[query]
+}
+
+func (e *queryExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestQueryEventType(t *testing.T) {
+	assert.Equal(t, "Transaction", QueryEventType("SELECT count(*) FROM Transaction WHERE "))
+	assert.Equal(t, "Log", QueryEventType("select * from `Log`"))
+	assert.Equal(t, "PageView", QueryEventType("SELECT count(*) FROM PageView, Transaction"))
+	assert.Equal(t, "", QueryEventType("SELECT count(*) FR"))
+	assert.Equal(t, "", QueryEventType(""))
+}
+
+func TestSuggestions(t *testing.T) {
+	keyset := nrdb.NRQL("SELECT keyset() FROM Transaction SINCE 1 week ago")
+	sample := nrdb.NRQL("SELECT * FROM Transaction SINCE 1 hour ago LIMIT 20")
+	executor := &queryExecutor{results: map[nrdb.NRQL]*nrdb.NRDBResultContainer{
+		keyset: {Results: []nrdb.NRDBResult{{
+			"stringKeys":  []interface{}{"appName", "name"},
+			"numericKeys": []interface{}{"duration", "timestamp"},
+			"booleanKeys": []interface{}{"error"},
+		}}},
+		sample: {Results: []nrdb.NRDBResult{
+			{"appName": "checkout", "duration": 0.25, "error": false, "timestamp": 1700000000000.0},
+			{"appName": "checkout", "duration": 1.5, "error": true, "name": ""},
+			{"appName": "cart", "name": []interface{}{"a", "b"}},
+			{"appName": "a"}, {"appName": "b"}, {"appName": "c"}, {"appName": "d"},
+		}},
+	}}
+
+	suggestions, err := Suggestions(context.Background(), executor, 1, "Transaction")
+	require.NoError(t, err)
+	assert.Equal(t, []AttributeSuggestion{
+		{Attribute: Attribute{Name: "appName", Type: "string"}, Values: []string{"checkout", "cart", "a", "b", "c"}},
+		{Attribute: Attribute{Name: "duration", Type: "numeric"}, Values: []string{"0.25", "1.5"}},
+		{Attribute: Attribute{Name: "error", Type: "boolean"}, Values: []string{"false", "true"}},
+		{Attribute: Attribute{Name: "name", Type: "string"}},
+		{Attribute: Attribute{Name: "timestamp", Type: "numeric"}},
+	}, suggestions)
+
+	// A failed sample still returns the attributes
+	executor.errs = map[nrdb.NRQL]error{sample: errors.New("boom")}
+	suggestions, err = Suggestions(context.Background(), executor, 1, "Transaction")
+	require.NoError(t, err)
+	require.Len(t, suggestions, 5)
+	assert.Nil(t, suggestions[0].Values)
+
+	executor.errs = map[nrdb.NRQL]error{keyset: errors.New("boom")}
+	_, err = Suggestions(context.Background(), executor, 1, "Transaction")
+	assert.EqualError(t, err, "boom")
+
+	_, err = Suggestions(context.Background(), executor, 1, "Bad Type")
+	var requestErr *RequestError
+	assert.ErrorAs(t, err, &requestErr)
+}
@@ -4,6 +4,7 @@
 package metrics
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -16,6 +17,16 @@ type Metrics struct {
 	AverageQueryTime  time.Duration
 	LastQueryTime     time.Time
 	ConcurrentQueries int32
+	Warmups           map[string]WarmupStats
+}
+
+// WarmupStats tracks the runs of a single scheduled warm-up query
+type WarmupStats struct {
+	Runs         uint64
+	Failures     uint64
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
 }
 
 // Internal storage with atomic access
@@ -30,6 +41,9 @@ type atomicMetrics struct {
 
 var (
 	metrics = &atomicMetrics{}
+
+	warmupMu    sync.Mutex
+	warmupStats = make(map[string]WarmupStats)
 )
 
 // RecordQuery records metrics for a completed query
@@ -52,6 +66,23 @@ func RecordQuery(duration time.Duration, err error) {
 	atomic.StoreInt64(&metrics.LastQueryTime, time.Now().UnixNano())
 }
 
+// RecordWarmup records the outcome of a scheduled warm-up query run
+func RecordWarmup(name string, duration time.Duration, err error) {
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+
+	stats := warmupStats[name]
+	stats.Runs++
+	stats.LastRun = time.Now()
+	stats.LastDuration = duration
+	stats.LastError = ""
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+	}
+	warmupStats[name] = stats
+}
+
 // IncrementConcurrentQueries increments the count of concurrent queries
 func IncrementConcurrentQueries() {
 	atomic.AddInt32(&metrics.ConcurrentQueries, 1)
@@ -71,7 +102,20 @@ func GetMetrics() *Metrics {
 		AverageQueryTime:  time.Duration(atomic.LoadInt64(&metrics.AverageQueryTime)),
 		LastQueryTime:     time.Unix(0, atomic.LoadInt64(&metrics.LastQueryTime)),
 		ConcurrentQueries: atomic.LoadInt32(&metrics.ConcurrentQueries),
+		Warmups:           getWarmupStats(),
+	}
+}
+
+// getWarmupStats returns a copy of the warm-up statistics
+func getWarmupStats() map[string]WarmupStats {
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+
+	stats := make(map[string]WarmupStats, len(warmupStats))
+	for name, s := range warmupStats {
+		stats[name] = s
 	}
+	return stats
 }
 
 // ResetMetrics resets all metrics to zero (for testing)
@@ -82,4 +126,8 @@ func ResetMetrics() {
 	atomic.StoreInt64(&metrics.AverageQueryTime, 0)
 	atomic.StoreInt64(&metrics.LastQueryTime, 0)
 	atomic.StoreInt32(&metrics.ConcurrentQueries, 0)
+
+	warmupMu.Lock()
+	warmupStats = make(map[string]WarmupStats)
+	warmupMu.Unlock()
 }
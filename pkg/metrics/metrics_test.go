@@ -111,3 +111,24 @@ func TestMetrics_Concurrency(t *testing.T) {
 		t.Errorf("QueryCount = %v, want %v", got.QueryCount, goroutines)
 	}
 }
+
+func TestMetrics_RecordWarmup(t *testing.T) {
+	ResetMetrics()
+
+	RecordWarmup("revenue", 2*time.Second, nil)
+	RecordWarmup("revenue", 3*time.Second, assert.AnError)
+
+	got := GetMetrics().Warmups["revenue"]
+	assert.Equal(t, uint64(2), got.Runs)
+	assert.Equal(t, uint64(1), got.Failures)
+	assert.Equal(t, 3*time.Second, got.LastDuration)
+	assert.Equal(t, assert.AnError.Error(), got.LastError)
+	assert.False(t, got.LastRun.IsZero())
+
+	// A successful run clears the last error
+	RecordWarmup("revenue", time.Second, nil)
+	assert.Empty(t, GetMetrics().Warmups["revenue"].LastError)
+
+	ResetMetrics()
+	assert.Empty(t, GetMetrics().Warmups)
+}
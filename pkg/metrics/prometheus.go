@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/quota"
+
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The Prometheus metrics below are registered with the default registry, which
+// the plugin SDK serves on the plugin's metrics endpoint.
+const (
+	namespace = "grafana_plugin"
+	subsystem = "newrelic"
+)
+
+// Label values of the Prometheus metrics.
+const (
+	statusOK = "ok"
+
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+
+	RateLimitBudget   = "budget"   // Rejected by the datasource's query budget
+	RateLimitNewRelic = "newrelic" // Throttled by New Relic
+)
+
+var (
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "queries_total",
+		Help:      "Queries handled, by query type.",
+	}, []string{"query_type"})
+
+	queryErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "query_errors_total",
+		Help:      "Queries that failed, by query type and error kind.",
+	}, []string{"query_type", "kind"})
+
+	nrdbRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "nrdb_request_duration_seconds",
+		Help:      "Latency of NRQL requests to New Relic, by method and status (ok or error kind).",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12), // 50ms to ~100s
+	}, []string{"method", "status"})
+
+	cacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "cache_lookups_total",
+		Help:      "Query result cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by a rate limit, by source (budget or newrelic).",
+	}, []string{"source"})
+)
+
+// ObserveQuery counts a handled query of queryType and, if it failed, its error
+// kind. Query budget rejections are also counted as rate limited.
+func ObserveQuery(queryType string, err error) {
+	if queryType == "" {
+		queryType = "nrql"
+	}
+	queriesTotal.WithLabelValues(queryType).Inc()
+	if err == nil {
+		return
+	}
+	queryErrorsTotal.WithLabelValues(queryType, string(errorsx.Classify(err))).Inc()
+
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		rateLimitedTotal.WithLabelValues(RateLimitBudget).Inc()
+	}
+}
+
+// ObserveNRDBRequest records the latency of an NRQL request to New Relic and
+// counts it as rate limited when New Relic throttled it.
+func ObserveNRDBRequest(method string, duration time.Duration, err error) {
+	status := statusOK
+	if err != nil {
+		kind := errorsx.Classify(err)
+		status = string(kind)
+		if kind == errorsx.KindRateLimit {
+			rateLimitedTotal.WithLabelValues(RateLimitNewRelic).Inc()
+		}
+	}
+	nrdbRequestDuration.WithLabelValues(method, status).Observe(duration.Seconds())
+}
+
+// RecordCacheLookup counts a query result cache lookup.
+func RecordCacheLookup(hit bool) {
+	result := CacheMiss
+	if hit {
+		result = CacheHit
+	}
+	cacheLookupsTotal.WithLabelValues(result).Inc()
+}
+
+// Executor wraps an NRDBQueryExecutor and records the latency of every request.
+type Executor struct {
+	Executor nrdbiface.NRDBQueryExecutor
+}
+
+// QueryWithContext executes a standard NRQL query and records its latency.
+func (e *Executor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	start := time.Now()
+	result, err := e.Executor.QueryWithContext(ctx, accountID, query)
+	ObserveNRDBRequest("query", time.Since(start), err)
+	return result, err
+}
+
+// PerformNRQLQueryWithContext executes an enhanced NRQL query and records its latency.
+func (e *Executor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	start := time.Now()
+	result, err := e.Executor.PerformNRQLQueryWithContext(ctx, accountID, query)
+	ObserveNRDBRequest("nrql", time.Since(start), err)
+	return result, err
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/quota"
+
+	nrerrors "github.com/newrelic/newrelic-client-go/v2/pkg/errors"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveQuery(t *testing.T) {
+	queries := testutil.ToFloat64(queriesTotal.WithLabelValues("nrql"))
+	timeouts := testutil.ToFloat64(queryErrorsTotal.WithLabelValues("nrql", "timeout"))
+	budgetRejections := testutil.ToFloat64(rateLimitedTotal.WithLabelValues(RateLimitBudget))
+
+	ObserveQuery("", nil)
+	ObserveQuery("", context.DeadlineExceeded)
+	ObserveQuery("", &quota.ExceededError{Usage: quota.Usage{AccountID: 1}})
+
+	assert.Equal(t, queries+3, testutil.ToFloat64(queriesTotal.WithLabelValues("nrql")))
+	assert.Equal(t, timeouts+1, testutil.ToFloat64(queryErrorsTotal.WithLabelValues("nrql", "timeout")))
+	assert.Equal(t, budgetRejections+1, testutil.ToFloat64(rateLimitedTotal.WithLabelValues(RateLimitBudget)))
+}
+
+func TestRecordCacheLookup(t *testing.T) {
+	hits := testutil.ToFloat64(cacheLookupsTotal.WithLabelValues(CacheHit))
+	misses := testutil.ToFloat64(cacheLookupsTotal.WithLabelValues(CacheMiss))
+
+	RecordCacheLookup(true)
+	RecordCacheLookup(false)
+	RecordCacheLookup(false)
+
+	assert.Equal(t, hits+1, testutil.ToFloat64(cacheLookupsTotal.WithLabelValues(CacheHit)))
+	assert.Equal(t, misses+2, testutil.ToFloat64(cacheLookupsTotal.WithLabelValues(CacheMiss)))
+}
+
+// failingExecutor fails every query with err.
+type failingExecutor struct {
+	err error
+}
+
+func (f *failingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	return &nrdb.NRDBResultContainer{}, f.err
+}
+
+func (f *failingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return &nrdb.NRDBResultContainerMultiResultCustomized{}, f.err
+}
+
+func TestExecutor(t *testing.T) {
+	throttled := testutil.ToFloat64(rateLimitedTotal.WithLabelValues(RateLimitNewRelic))
+
+	_, err := (&Executor{Executor: &failingExecutor{}}).QueryWithContext(context.Background(), 1, "SELECT 1")
+	assert.NoError(t, err)
+	_, err = (&Executor{Executor: &failingExecutor{err: nrerrors.NewUnexpectedStatusCode(429, "Too Many Requests")}}).PerformNRQLQueryWithContext(context.Background(), 1, "SELECT 1")
+	assert.Error(t, err)
+	_, err = (&Executor{Executor: &failingExecutor{err: errors.New("boom")}}).PerformNRQLQueryWithContext(context.Background(), 1, "SELECT 1")
+	assert.Error(t, err)
+
+	// One histogram per method and status: query/ok, nrql/rateLimit and nrql/downstream
+	assert.GreaterOrEqual(t, testutil.CollectAndCount(nrdbRequestDuration, "grafana_plugin_newrelic_nrdb_request_duration_seconds"), 3)
+	assert.Equal(t, throttled+1, testutil.ToFloat64(rateLimitedTotal.WithLabelValues(RateLimitNewRelic)))
+}
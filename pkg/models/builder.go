@@ -0,0 +1,39 @@
+package models
+
+// Editor modes control where the NRQL of a query comes from.
+const (
+	EditorModeCode    = "code"    // QueryText holds the NRQL (default)
+	EditorModeBuilder = "builder" // The NRQL is compiled from Builder
+)
+
+// QueryBuilder is a query built in the visual query editor. The backend compiles
+// it to NRQL, so the editor does not need to know NRQL quoting rules.
+type QueryBuilder struct {
+	Select     []SelectExpression `json:"select"`               // Aggregations to select, at least one
+	EventType  string             `json:"eventType"`            // Event type queried, e.g. Transaction
+	Where      []AdHocFilter      `json:"where,omitempty"`      // Conditions joined with AND
+	Facet      []string           `json:"facet,omitempty"`      // Attributes to facet by
+	Since      string             `json:"since,omitempty"`      // Start as epoch milliseconds or "<n> <unit> ago"; empty uses the dashboard time range
+	Until      string             `json:"until,omitempty"`      // End as epoch milliseconds or "<n> <unit> ago"
+	Limit      int                `json:"limit,omitempty"`      // LIMIT of the query (0 omits it)
+	Timeseries string             `json:"timeseries,omitempty"` // TIMESERIES bucket, e.g. "5 minutes", AUTO or MAX (empty omits it)
+}
+
+// SelectExpression is an aggregation function applied to an attribute.
+type SelectExpression struct {
+	Function  string   `json:"function"`            // Aggregation function, e.g. count, average or percentile
+	Attribute string   `json:"attribute,omitempty"` // Attribute aggregated; count without one counts events
+	Args      []string `json:"args,omitempty"`      // Numeric arguments after the attribute, e.g. percentiles
+	Alias     string   `json:"alias,omitempty"`     // Optional AS name of the result
+}
+
+// IsValidEditorMode reports whether editorMode is a recognised editor mode.
+// An empty value is treated as EditorModeCode.
+func IsValidEditorMode(editorMode string) bool {
+	switch editorMode {
+	case "", EditorModeCode, EditorModeBuilder:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,9 +1,409 @@
 package models
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Result modes control which NRDB executor path is used for a query.
+const (
+	ResultModeAuto     = "auto"     // Pick the executor based on the NRQL clauses (default)
+	ResultModeStandard = "standard" // Always use the standard NRDB query path
+	ResultModeMulti    = "multi"    // Always use the enhanced (multi-result) NRDB query path
+)
+
+// Facet output modes control how facet values appear in faceted query results.
+const (
+	FacetAsLabels = "labels" // Facet values as field labels (default)
+	FacetAsColumn = "column" // Facet values as dedicated string columns
+	FacetAsBoth   = "both"   // Facet values as both labels and columns
+)
+
+// Formats control the frame layout of faceted TIMESERIES results.
+const (
+	FormatMulti = "multi" // A frame per facet value (default)
+	FormatWide  = "wide"  // A single wide frame with a value column per facet value
+)
+
+// Axes place the series of a query statement on a side of the panel.
+const (
+	AxisLeft  = "left"
+	AxisRight = "right"
+)
+
+// Facet time modes control how faceted count results without TIMESERIES buckets
+// are stamped.
+const (
+	FacetTimeEnd      = "end"      // Stamp counts with the end of the query time range (default)
+	FacetTimeMidpoint = "midpoint" // Stamp counts with the midpoint of the query time range
+	FacetTimeNone     = "none"     // Omit the time field
+	FacetTimeTable    = "table"    // Return a single table frame with a column per facet
+)
+
+// Fill modes control the values of TIMESERIES buckets that have no data.
+const (
+	FillModeNull     = "null"     // Leave missing buckets null (default)
+	FillModeZero     = "zero"     // Fill missing buckets with 0
+	FillModePrevious = "previous" // Fill missing buckets with the previous value of the series
+)
+
+// Facet orders control the order of the series of faceted results.
+const (
+	FacetOrderName  = "name"  // Order series by facet value, alphabetically (default)
+	FacetOrderValue = "value" // Order series by their first bucket's value, largest first
+)
+
+// Grafana query types that request results in the frame format of a dedicated panel,
+// or that fetch something other than NRQL results.
+const (
+	QueryTypeLogs      = "logs"      // Log lines for the Logs panel
+	QueryTypeTraces    = "traces"    // Spans for the Traces panel
+	QueryTypeIncidents = "incidents" // New Relic issues from NerdGraph, as a table and annotations
+	QueryTypeEntities  = "entities"  // Entities found by a NerdGraph entity search of the query text, as a table
+	QueryTypeVariable  = "variable"  // Template variable values listed by VariableType, as a single string column
+	QueryTypeNerdGraph = "nerdgraph" // Raw GraphQL query text run against NerdGraph, flattened into a table
+	QueryTypeUsage     = "usage"     // Ingest and user consumption from NrConsumption and NrMTDConsumption, by a prebuilt query chosen by UsageMetric
+)
+
+// Variable query types: what a QueryTypeVariable query lists.
+const (
+	VariableTypeAccounts        = "accounts"        // IDs of the accounts the API key can access
+	VariableTypeEventTypes      = "eventTypes"      // Event types the account reports
+	VariableTypeAttributeKeys   = "attributeKeys"   // Attributes reported for EventType
+	VariableTypeAttributeValues = "attributeValues" // Values of Attribute reported for EventType
+)
+
+// Usage metrics: what a QueryTypeUsage query charts.
+const (
+	UsageMetricIngest            = "ingest"            // GB ingested per usage metric over the dashboard time range, as time series
+	UsageMetricIngestMonthToDate = "ingestMonthToDate" // GB ingested and billable GB this month
+	UsageMetricUsers             = "users"             // Billable full platform and core users this month
+	UsageMetricCost              = "cost"              // Estimated cost of this month's billable GB and users, at the datasource's usage pricing
+)
+
 // QueryModel represents the structure of a single query sent from Grafana.
 // This struct will be unmarshaled from the JSON data in backend.DataQuery.
 type QueryModel struct {
-	QueryText      string `json:"queryText"`
-	UseGrafanaTime bool   `json:"useGrafanaTime"` // Whether to use Grafana's time picker
-	AccountID      int    `json:"accountID"`      // Optional, overrides the default account ID from settings
+	QueryText          string                 `json:"queryText"`
+	EditorMode         string                 `json:"editorMode"`         // Optional, one of code|builder (empty means code)
+	Builder            *QueryBuilder          `json:"builder"`            // Query built in the visual editor, compiled to NRQL in builder mode
+	UseGrafanaTime     bool                   `json:"useGrafanaTime"`     // Whether to use Grafana's time picker
+	AccountID          int                    `json:"accountID"`          // Optional, overrides the default account ID from settings
+	ResultMode         string                 `json:"resultMode"`         // Optional, one of auto|standard|multi (empty means auto)
+	ExplainRouting     bool                   `json:"explainRouting"`     // Attach the formatter routing trace to frame metadata
+	RawFields          bool                   `json:"rawFields"`          // Return columns keyed exactly as New Relic returns them
+	PageSize           int                    `json:"pageSize"`           // Optional, rows per page for table queries (0 disables paging)
+	PageIndex          int                    `json:"pageIndex"`          // Zero-based page to return when PageSize is set
+	FacetAs            string                 `json:"facetAs"`            // Optional, one of labels|column|both (empty means labels)
+	Format             string                 `json:"format"`             // Optional, one of multi|wide for faceted TIMESERIES results (empty means multi)
+	FacetTime          string                 `json:"facetTime"`          // Optional, one of end|midpoint|none|table for faceted counts (empty means end)
+	Alias              string                 `json:"alias"`              // Optional, series display name pattern, e.g. "{{facet}} - {{field}}"
+	FillMode           string                 `json:"fillMode"`           // Optional, one of null|zero|previous for TIMESERIES buckets without data (empty means null)
+	FacetLabelMappings map[string]string      `json:"facetLabelMappings"` // Optional, display names of facet values in series labels, by raw value
+	TrimFacetPrefix    bool                   `json:"trimFacetPrefix"`    // Remove the leading text every value of a facet shares, e.g. the host of URLs
+	ResolveEntityNames bool                   `json:"resolveEntityNames"` // Show entity names in place of the entity GUIDs of facet values
+	EnrichEntities     bool                   `json:"enrichEntities"`     // Add the name, type, account and tags of the entities of entity GUID columns, e.g. entityGuid
+	FacetOrder         string                 `json:"facetOrder"`         // Optional, one of name|value to order faceted series (empty means name)
+	KeepUnfaceted      bool                   `json:"keepUnfaceted"`      // Group rows without a facet value instead of dropping them
+	IgnoreTimeRange    bool                   `json:"ignoreTimeRange"`    // Do not add the dashboard time range to queries without SINCE/UNTIL
+	TimeZone           string                 `json:"timeZone"`           // Dashboard time zone: an IANA name such as Europe/Berlin, utc or browser
+	UseTimeZone        bool                   `json:"useTimeZone"`        // Add WITH TIMEZONE for TimeZone to the SINCE/UNTIL clause the plugin generates, so day buckets follow local midnight
+	IgnoreMaxPoints    bool                   `json:"ignoreMaxPoints"`    // Keep the query's TIMESERIES buckets even when a series has more points than the panel's maxDataPoints
+	SplitRange         int                    `json:"splitRange"`         // Optional, sequential queries the time range of a TIMESERIES query is split into (0 or 1 runs one query)
+	AnomalyBands       float64                `json:"anomalyBands"`       // Optional, width in standard deviations of the anomaly bands added around a rolling baseline of each series (0 adds none)
+	BaselineWindow     int                    `json:"baselineWindow"`     // Optional, points the rolling baseline of anomaly bands averages (0 means 12)
+	AutoLimit          bool                   `json:"autoLimit"`          // Append LIMIT MAX to queries without LIMIT or TIMESERIES, so tables and variables get every value
+	FlattenDepth       int                    `json:"flattenDepth"`       // Optional, levels of nested object and array attributes flattened into dotted columns (0 keeps them as JSON text)
+	JoinUniques        bool                   `json:"joinUniques"`        // Join uniques() values into one comma-separated cell instead of a row each
+	DualOutput         bool                   `json:"dualOutput"`         // Also return time series as a table frame, so Explore can switch views without rerunning the query
+	Live               bool                   `json:"live"`               // Keep the panel updated over Grafana Live by polling New Relic for new data
+	LiveInterval       string                 `json:"liveInterval"`       // Optional, how often live queries poll New Relic (duration, e.g. "30s"; empty means 10s)
+	MaxSeries          int                    `json:"maxSeries"`          // Optional, overrides the datasource's series limit
+	MaxFrameRows       int                    `json:"maxFrameRows"`       // Optional, overrides the datasource's rows-per-frame limit
+	Timeout            string                 `json:"timeout"`            // Optional, overrides the datasource query timeout (duration, e.g. "2m")
+	Columns            []string               `json:"columns"`            // Optional, table columns to show first, in order; the rest follow alphabetically
+	Filters            []AdHocFilter          `json:"filters"`            // Optional, ad-hoc filters added to the query's WHERE clause
+	Variables          []TemplateVariable     `json:"variables"`          // Optional, multi-value template variables left in the query text
+	IncidentStates     []string               `json:"incidentStates"`     // Optional, issue states returned by incidents queries (empty means all)
+	VariableType       string                 `json:"variableType"`       // What a variable query lists, one of accounts|eventTypes|attributeKeys|attributeValues
+	EventType          string                 `json:"eventType"`          // Event type of attributeKeys and attributeValues variable queries
+	Attribute          string                 `json:"attribute"`          // Attribute of attributeValues variable queries
+	Selector           string                 `json:"selector"`           // Path of the nodes nerdgraph queries return as rows, e.g. "actor.account.nrql.results"
+	GraphQLVariables   map[string]interface{} `json:"graphqlVariables"`   // Optional, variables of nerdgraph queries
+	UsageMetric        string                 `json:"usageMetric"`        // What a usage query charts, one of ingest|ingestMonthToDate|users|cost
+	Statements         []QueryStatement       `json:"statements"`         // Optional, NRQL statements run concurrently instead of queryText, with their results merged
+	Expressions        []FieldExpression      `json:"expressions"`        // Optional, fields derived from the query's result fields after formatting
+}
+
+// FieldExpression is a field derived from the result fields of a query by a
+// math expression, e.g. ($A.errors / $A.total) * 100.
+type FieldExpression struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// QueryStatement is one of the NRQL statements of a query, whose series are
+// labeled with the statement's alias.
+type QueryStatement struct {
+	Alias     string `json:"alias"`
+	QueryText string `json:"queryText"`
+	Axis      string `json:"axis"` // Optional, one of left|right: the Y axis of the statement's series (empty means auto)
+}
+
+// TemplateVariable is a multi-value Grafana template variable the frontend left
+// in the query text for the backend to render with NRQL quoting.
+type TemplateVariable struct {
+	Name   string   `json:"var"`
+	Values []string `json:"values"`
+	All    bool     `json:"all,omitempty"` // The All option is selected
+}
+
+// AdHocFilter is a filter from a Grafana ad-hoc filter variable.
+type AdHocFilter struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"` // One of =, !=, <, >, <=, >=, =~, !~, =| and !=|
+	Value    string   `json:"value"`
+	Values   []string `json:"values,omitempty"` // Values of the multi-value operators =| and !=|
+}
+
+// IsValidResultMode reports whether mode is a recognised result mode.
+// An empty mode is treated as ResultModeAuto.
+func IsValidResultMode(mode string) bool {
+	switch mode {
+	case "", ResultModeAuto, ResultModeStandard, ResultModeMulti:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidFacetAs reports whether facetAs is a recognised facet output mode.
+// An empty value is treated as FacetAsLabels.
+func IsValidFacetAs(facetAs string) bool {
+	switch facetAs {
+	case "", FacetAsLabels, FacetAsColumn, FacetAsBoth:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidFormat reports whether format is a recognised frame format.
+// An empty format is treated as FormatMulti.
+func IsValidFormat(format string) bool {
+	switch format {
+	case "", FormatMulti, FormatWide:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidAxis reports whether axis is a recognised axis placement. An empty
+// axis leaves the placement to the panel.
+func IsValidAxis(axis string) bool {
+	switch axis {
+	case "", AxisLeft, AxisRight:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidFacetTime reports whether facetTime is a recognised facet time mode.
+// An empty value is treated as FacetTimeEnd.
+func IsValidFacetTime(facetTime string) bool {
+	switch facetTime {
+	case "", FacetTimeEnd, FacetTimeMidpoint, FacetTimeNone, FacetTimeTable:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidFillMode reports whether fillMode is a recognised fill mode.
+// An empty value is treated as FillModeNull.
+func IsValidFillMode(fillMode string) bool {
+	switch fillMode {
+	case "", FillModeNull, FillModeZero, FillModePrevious:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidFacetOrder reports whether facetOrder is a recognised facet order.
+// An empty value is treated as FacetOrderName.
+func IsValidFacetOrder(facetOrder string) bool {
+	switch facetOrder {
+	case "", FacetOrderName, FacetOrderValue:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidVariableType reports whether variableType is a recognised variable query type.
+func IsValidVariableType(variableType string) bool {
+	switch variableType {
+	case VariableTypeAccounts, VariableTypeEventTypes, VariableTypeAttributeKeys, VariableTypeAttributeValues:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidUsageMetric reports whether usageMetric is a recognised usage metric.
+func IsValidUsageMetric(usageMetric string) bool {
+	switch usageMetric {
+	case UsageMetricIngest, UsageMetricIngestMonthToDate, UsageMetricUsers, UsageMetricCost:
+		return true
+	default:
+		return false
+	}
+}
+
+// grafanaQueryKeys are the keys Grafana adds to every query JSON in addition
+// to the plugin's own query fields.
+var grafanaQueryKeys = []string{
+	"refId", "datasource", "datasourceId", "hide", "key", "queryType",
+	"intervalMs", "interval", "maxDataPoints", "intervalFactor",
+}
+
+// strictQueryModel accepts the plugin query fields plus the standard Grafana
+// query keys, so that DisallowUnknownFields only rejects genuinely unknown keys.
+type strictQueryModel struct {
+	QueryModel
+	RefID          json.RawMessage `json:"refId"`
+	Datasource     json.RawMessage `json:"datasource"`
+	DatasourceID   json.RawMessage `json:"datasourceId"`
+	Hide           json.RawMessage `json:"hide"`
+	Key            json.RawMessage `json:"key"`
+	QueryType      json.RawMessage `json:"queryType"`
+	IntervalMs     json.RawMessage `json:"intervalMs"`
+	Interval       json.RawMessage `json:"interval"`
+	MaxDataPoints  json.RawMessage `json:"maxDataPoints"`
+	IntervalFactor json.RawMessage `json:"intervalFactor"`
+}
+
+// QueryModelError represents an error while parsing a query's JSON model.
+type QueryModelError struct {
+	Msg           string
+	UnknownFields []string // Keys that are not part of the query model
+	Err           error    // Wrapped error
+}
+
+func (e *QueryModelError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+	}
+	return e.Msg
+}
+
+func (e *QueryModelError) Unwrap() error {
+	return e.Err
+}
+
+// ParseQueryModel unmarshals the query JSON sent by Grafana into a QueryModel and
+// returns the keys that are neither query model fields nor standard Grafana query
+// keys, sorted alphabetically; keys of nested objects are returned by path, e.g.
+// "filters[0].op". In strict mode the JSON is decoded with
+// DisallowUnknownFields and any unknown key is returned as a *QueryModelError.
+func ParseQueryModel(raw []byte, strict bool) (QueryModel, []string, error) {
+	var qm QueryModel
+	if err := json.Unmarshal(raw, &qm); err != nil {
+		return qm, nil, err
+	}
+
+	unknown := unknownQueryKeys(raw)
+	if !strict {
+		return qm, unknown, nil
+	}
+
+	var sq strictQueryModel
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&sq); err != nil {
+		return qm, unknown, &QueryModelError{
+			Msg:           fmt.Sprintf("unknown query field(s): %s", strings.Join(unknown, ", ")),
+			UnknownFields: unknown,
+			Err:           err,
+		}
+	}
+
+	return sq.QueryModel, unknown, nil
+}
+
+// unknownQueryKeys returns the keys of raw that the plugin does not recognise.
+// Keys of nested objects, such as ad-hoc filters and statements, are checked
+// against their own types and reported by path, e.g. "filters[0].op".
+func unknownQueryKeys(raw []byte) []string {
+	var unknown []string
+	collectUnknownKeys(raw, reflect.TypeOf(QueryModel{}), "", grafanaQueryKeys, &unknown)
+	sort.Strings(unknown)
+	return unknown
+}
+
+// collectUnknownKeys appends to unknown the paths of the keys of raw that are
+// not fields of t, recursing into struct, slice and map fields. Values that do
+// not decode as the expected JSON shape are left to the decoder to reject.
+func collectUnknownKeys(raw json.RawMessage, t reflect.Type, path string, extra []string, unknown *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return
+		}
+		known := make(map[string]reflect.Type, t.NumField()+len(extra))
+		for _, key := range extra {
+			known[key] = nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				known[name] = t.Field(i).Type
+			}
+		}
+		for key, value := range fields {
+			fieldType, ok := known[key]
+			switch {
+			case !ok:
+				*unknown = append(*unknown, joinKeyPath(path, key))
+			case fieldType != nil:
+				collectUnknownKeys(value, fieldType, joinKeyPath(path, key), nil, unknown)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return
+		}
+		for i, item := range items {
+			collectUnknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), nil, unknown)
+		}
+	case reflect.Map:
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return
+		}
+		for key, item := range items {
+			collectUnknownKeys(item, t.Elem(), joinKeyPath(path, key), nil, unknown)
+		}
+	}
+}
+
+// joinKeyPath appends key to the dotted JSON path of its parent object.
+func joinKeyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
 }
@@ -2,12 +2,14 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadPluginSettings_Success(t *testing.T) {
@@ -171,6 +173,60 @@ func TestLoadPluginSettings_InvalidAccountID(t *testing.T) {
 	}
 }
 
+func TestLoadPluginSettings_Accounts(t *testing.T) {
+	settings := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{
+			"apiKey":    "test_api_key",
+			"accountID": "12345",
+			"accounts":  `[{"name":"Staging","accountID":222},{"name":"Partner","accountID":333,"apiKey":"partner_key"}]`,
+		},
+	}
+
+	pluginSettings, err := LoadPluginSettings(settings)
+	assert.NoError(t, err)
+	assert.Equal(t, []AccountEntry{
+		{Name: "Staging", AccountID: 222},
+		{Name: "Partner", AccountID: 333, ApiKey: "partner_key"},
+	}, pluginSettings.Secrets.Accounts)
+
+	assert.Equal(t, "test_api_key", pluginSettings.Secrets.APIKeyFor(12345))
+	assert.Equal(t, "test_api_key", pluginSettings.Secrets.APIKeyFor(222))
+	assert.Equal(t, "partner_key", pluginSettings.Secrets.APIKeyFor(333))
+
+	settings.DecryptedSecureJSONData["accounts"] = `{"name":"Staging"}`
+	_, err = LoadPluginSettings(settings)
+	assert.ErrorContains(t, err, "could not unmarshal accounts JSON")
+}
+
+func TestLoadPluginSettings_APIKeyEnv(t *testing.T) {
+	t.Setenv("NEWRELIC_API_KEY", " env_api_key\n")
+	t.Setenv("GF_DATABASE_PASSWORD", "secret")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	load := func(jsonData string, secureData map[string]string) (*PluginSettings, error) {
+		return LoadPluginSettings(backend.DataSourceInstanceSettings{JSONData: []byte(jsonData), DecryptedSecureJSONData: secureData})
+	}
+
+	pluginSettings, err := load(`{"apiKeyEnv":"NEWRELIC_API_KEY"}`, map[string]string{"accountID": "12345"})
+	assert.NoError(t, err)
+	assert.Equal(t, "env_api_key", pluginSettings.Secrets.ApiKey)
+
+	pluginSettings, err = load(`{"apiKeyEnv":"NEWRELIC_API_KEY"}`, map[string]string{"apiKey": "secure_api_key", "accountID": "12345"})
+	assert.NoError(t, err)
+	assert.Equal(t, "secure_api_key", pluginSettings.Secrets.ApiKey, "secureJsonData takes precedence")
+
+	_, err = load(`{"apiKeyEnv":"NEWRELIC_UNSET_KEY"}`, map[string]string{"accountID": "12345"})
+	assert.ErrorContains(t, err, "environment variable NEWRELIC_UNSET_KEY named by apiKeyEnv is not set or empty")
+
+	for _, name := range []string{"GF_DATABASE_PASSWORD", "AWS_SECRET_ACCESS_KEY", "newrelic_api_key", "NEWRELIC_"} {
+		_, err = load(`{"apiKeyEnv":"`+name+`"}`, map[string]string{"accountID": "12345"})
+		assert.ErrorContains(t, err, "only variables starting with NEWRELIC_ can be used", name)
+	}
+
+	_, err = load(`{"apiKeyEnv":"$(cat key)"}`, map[string]string{"accountID": "12345"})
+	assert.ErrorContains(t, err, "not an environment variable name")
+}
+
 func TestQueryModel_Unmarshal(t *testing.T) {
 	jsonStr := `{
 		"queryText": "SELECT uniqueCount(session) FROM PageView",
@@ -239,3 +295,133 @@ func TestPluginSettingsError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestFieldErrors(t *testing.T) {
+	errs := SettingsErrors{
+		{Msg: "API key cannot be empty", Field: "apiKey", Code: SettingsErrRequired},
+		{Msg: "plugin secrets cannot be nil"},
+	}
+	assert.Equal(t, "apiKey: API key cannot be empty; plugin secrets cannot be nil", errs.Error())
+	assert.Equal(t, []*PluginSettingsError(errs), FieldErrors(fmt.Errorf("invalid plugin configuration: %w", errs)))
+
+	var settingsErr *PluginSettingsError
+	assert.True(t, errors.As(errs, &settingsErr))
+	assert.Equal(t, "apiKey", settingsErr.Field)
+
+	// Loading errors wrap the error naming the setting
+	_, err := LoadPluginSettings(backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-key", "accountID": "abc"},
+	})
+	fieldErrs := FieldErrors(err)
+	require.Len(t, fieldErrs, 1)
+	assert.Equal(t, "accountID", fieldErrs[0].Field)
+	assert.Equal(t, SettingsErrInvalid, fieldErrs[0].Code)
+
+	assert.Empty(t, FieldErrors(fmt.Errorf("unrelated")))
+}
+
+func TestParseQueryModel(t *testing.T) {
+	t.Run("known fields and Grafana keys", func(t *testing.T) {
+		raw := []byte(`{
+			"refId": "A",
+			"datasource": {"type": "newrelic", "uid": "abc"},
+			"intervalMs": 1000,
+			"maxDataPoints": 500,
+			"queryText": "SELECT count(*) FROM Transaction",
+			"accountID": 42
+		}`)
+
+		qm, unknown, err := ParseQueryModel(raw, true)
+		assert.NoError(t, err)
+		assert.Empty(t, unknown)
+		assert.Equal(t, "SELECT count(*) FROM Transaction", qm.QueryText)
+		assert.Equal(t, 42, qm.AccountID)
+	})
+
+	t.Run("unknown fields are reported in lenient mode", func(t *testing.T) {
+		raw := []byte(`{"queryText": "SELECT 1", "acountID": 42, "zeta": true}`)
+
+		qm, unknown, err := ParseQueryModel(raw, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"acountID", "zeta"}, unknown)
+		assert.Equal(t, "SELECT 1", qm.QueryText)
+		assert.Equal(t, 0, qm.AccountID)
+	})
+
+	t.Run("unknown fields are rejected in strict mode", func(t *testing.T) {
+		raw := []byte(`{"queryText": "SELECT 1", "acountID": 42}`)
+
+		_, unknown, err := ParseQueryModel(raw, true)
+		assert.Error(t, err)
+		assert.Equal(t, []string{"acountID"}, unknown)
+
+		var qmErr *QueryModelError
+		assert.ErrorAs(t, err, &qmErr)
+		assert.Equal(t, []string{"acountID"}, qmErr.UnknownFields)
+		assert.Contains(t, err.Error(), "unknown query field(s): acountID")
+		assert.NotNil(t, qmErr.Unwrap())
+	})
+
+	t.Run("unknown nested fields are reported by path", func(t *testing.T) {
+		raw := []byte(`{
+			"queryText": "SELECT 1",
+			"filters": [{"key": "host", "operator": "=", "value": "a"}, {"key": "env", "op": "="}],
+			"statements": [{"alias": "A", "queryText": "SELECT 2", "axsi": "right"}],
+			"graphqlVariables": {"anything": {"goes": true}}
+		}`)
+
+		_, unknown, err := ParseQueryModel(raw, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"filters[1].op", "statements[0].axsi"}, unknown)
+
+		_, _, err = ParseQueryModel(raw, true)
+		var qmErr *QueryModelError
+		assert.ErrorAs(t, err, &qmErr)
+		assert.Equal(t, []string{"filters[1].op", "statements[0].axsi"}, qmErr.UnknownFields)
+		assert.Contains(t, err.Error(), "unknown query field(s): filters[1].op, statements[0].axsi")
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		_, _, err := ParseQueryModel([]byte(`{invalid`), false)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong field type", func(t *testing.T) {
+		_, _, err := ParseQueryModel([]byte(`{"accountID": "abc"}`), true)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadPluginSettings_AccountIDMigration(t *testing.T) {
+	tests := []struct {
+		name       string
+		jsonData   string
+		secureData map[string]string
+		want       int
+		wantErr    string
+	}{
+		{name: "JSON data number", jsonData: `{"accountID":12345}`, secureData: map[string]string{"apiKey": "key"}, want: 12345},
+		{name: "JSON data string", jsonData: `{"accountID":" 12345 "}`, secureData: map[string]string{"apiKey": "key"}, want: 12345},
+		{name: "legacy secure field", jsonData: `{}`, secureData: map[string]string{"apiKey": "key", "accountID": "67890"}, want: 67890},
+		{name: "JSON data wins over secure field", jsonData: `{"accountID":12345}`, secureData: map[string]string{"apiKey": "key", "accountID": "67890"}, want: 12345},
+		{name: "empty JSON data falls back", jsonData: `{"accountID":""}`, secureData: map[string]string{"apiKey": "key", "accountID": "67890"}, want: 67890},
+		{name: "neither layout", jsonData: `{}`, secureData: map[string]string{"apiKey": "key"}, wantErr: "Enter an account ID"},
+		{name: "invalid JSON data", jsonData: `{"accountID":"abc"}`, secureData: map[string]string{"apiKey": "key", "accountID": "67890"}, wantErr: "could not convert accountID 'abc' to int"},
+		{name: "wrong JSON type", jsonData: `{"accountID":true}`, secureData: map[string]string{"apiKey": "key"}, wantErr: "accountID must be a number or a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pluginSettings, err := LoadPluginSettings(backend.DataSourceInstanceSettings{
+				JSONData:                []byte(tt.jsonData),
+				DecryptedSecureJSONData: tt.secureData,
+			})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, pluginSettings.Secrets.AccountId)
+		})
+	}
+}
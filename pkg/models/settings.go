@@ -5,16 +5,37 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
+// APIKeyEnvPrefix starts the names of the environment variables that the
+// apiKeyEnv setting may name.
+const APIKeyEnvPrefix = "NEWRELIC_"
+
+// envNamePattern matches valid environment variable names.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Codes of PluginSettingsError, for the config editor to tell problems apart.
+const (
+	SettingsErrRequired   = "required"   // The setting is missing
+	SettingsErrInvalid    = "invalid"    // The setting has a value that cannot be used
+	SettingsErrOutOfRange = "outOfRange" // The setting is a number outside its allowed range
+	SettingsErrDuplicate  = "duplicate"  // The setting repeats a value that must be unique
+)
+
 // PluginSettingsError represents an error specifically related to plugin settings.
 type PluginSettingsError struct {
-	Msg string
-	Err error // Wrapped error
+	Msg   string
+	Err   error  // Wrapped error
+	Field string // JSON path of the invalid setting, e.g. "apiKey" or "accounts[1].accountID"; empty if not about one setting
+	Code  string // One of the SettingsErr codes; empty if unknown
 }
 
 func (e *PluginSettingsError) Error() string {
@@ -33,16 +54,247 @@ func (e *PluginSettingsError) Unwrap() error {
 	return e.Err
 }
 
+// SettingsErrors holds every problem found in the plugin settings, so they can
+// all be fixed at once.
+type SettingsErrors []*PluginSettingsError
+
+// Error lists the problems, each prefixed with the path of its setting.
+func (e SettingsErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+		if err.Field != "" {
+			messages[i] = err.Field + ": " + messages[i]
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the problems, so errors.As finds each of them.
+func (e SettingsErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// FieldErrors returns the settings problems err reports: those of a
+// SettingsErrors, or else the innermost PluginSettingsError naming a setting.
+func FieldErrors(err error) []*PluginSettingsError {
+	var all SettingsErrors
+	if errors.As(err, &all) {
+		return all
+	}
+	var found *PluginSettingsError
+	for ; err != nil; err = errors.Unwrap(err) {
+		if settingsErr, ok := err.(*PluginSettingsError); ok && settingsErr.Field != "" {
+			found = settingsErr
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return []*PluginSettingsError{found}
+}
+
 // PluginSettings holds the configuration settings for the New Relic data source.
 type PluginSettings struct {
-	Path    string                `json:"path"`
-	Secrets *SecretPluginSettings `json:"-"`
+	Path               string                `json:"path"`
+	AccountID          AccountIDSetting      `json:"accountID,omitempty"`         // Default account ID; the legacy secureJsonData accountID is used when empty
+	APIKeyEnv          string                `json:"apiKeyEnv,omitempty"`         // Environment variable, named with APIKeyEnvPrefix, holding the API key when secureJsonData has none
+	Region             string                `json:"region,omitempty"`            // New Relic region: US (default), EU, Staging or FedRAMP
+	StrictQueryParsing bool                  `json:"strictQueryParsing"`          // Reject queries with unknown JSON fields
+	Warmup             *WarmupSettings       `json:"warmup,omitempty"`            // Optional scheduled warm-up queries
+	BlackoutWindows    []BlackoutWindow      `json:"blackoutWindows,omitempty"`   // Periods during which queries are served from cache only
+	QueryBudget        *QueryBudgetSettings  `json:"queryBudget,omitempty"`       // Optional per-account API call budget
+	QueryCache         *QueryCacheSettings   `json:"queryCache,omitempty"`        // Optional short-lived cache of query results
+	VerifyFormatter    bool                  `json:"verifyFormatter"`             // Compare the candidate formatter's output with the served one
+	MaxRows            int                   `json:"maxRows,omitempty"`           // Fetch event queries page by page up to this many rows (0 disables)
+	MaxSeries          int                   `json:"maxSeries,omitempty"`         // Series kept per response; more are truncated with a notice (0 means formatter.DefaultMaxSeries)
+	MaxFrameRows       int                   `json:"maxFrameRows,omitempty"`      // Rows kept per frame; more are truncated with a notice (0 disables)
+	MaxResponseBytes   int                   `json:"maxResponseBytes,omitempty"`  // Estimated serialized size of a query response; larger ones are downsampled or truncated with a notice (0 means formatter.DefaultMaxResponseBytes)
+	PayloadDownsample  string                `json:"payloadDownsample,omitempty"` // How time series over the response budget are downsampled: lttb (default) or nth
+	QueryLint          string                `json:"queryLint,omitempty"`         // What happens to queries that match an NRQL guardrail: off, warn (default) or block
+	RetentionDays      int                   `json:"retentionDays,omitempty"`     // Event retention of the account in days, for the SINCE guardrail (0 disables it)
+	QueryTimeout       string                `json:"queryTimeout,omitempty"`      // Default time each query may run (duration, e.g. "30s"; empty means no limit)
+	UnitOverrides      map[string]string     `json:"unitOverrides,omitempty"`     // Grafana units by result field or attribute name, replacing inferred units
+	FieldTypes         []FieldTypeRule       `json:"fieldTypes,omitempty"`        // Types forced on result fields by attribute name pattern, checked before types are inferred
+	HealthCheck        *HealthCheckSettings  `json:"healthCheck,omitempty"`       // Optional NRQL run by the health check
+	ProxyURL           string                `json:"proxyUrl,omitempty"`          // HTTP, HTTPS or SOCKS5 proxy for API requests; empty uses HTTP_PROXY/HTTPS_PROXY
+	TLSSkipVerify      bool                  `json:"tlsSkipVerify"`               // Skip TLS certificate verification
+	TLSAuth            bool                  `json:"tlsAuth"`                     // Present the TLS client certificate from the secure settings
+	TLSAuthWithCACert  bool                  `json:"tlsAuthWithCACert"`           // Trust the CA certificate from the secure settings
+	ServerName         string                `json:"serverName,omitempty"`        // Server name used to verify the TLS certificate
+	AuditLog           *AuditLogSettings     `json:"auditLog,omitempty"`          // Optional log of executed NRQL queries
+	TraceVerbosity     string                `json:"traceVerbosity,omitempty"`    // Tracing spans: off, basic (default) or detailed
+	UsagePricing       *UsagePricingSettings `json:"usagePricing,omitempty"`      // Optional prices of the cost estimates of usage queries
+	Secrets            *SecretPluginSettings `json:"-"`
+}
+
+// Query lint modes control what happens to queries that match an NRQL guardrail.
+const (
+	QueryLintOff   = "off"   // Run queries without checking them
+	QueryLintWarn  = "warn"  // Run queries and add a warning notice per issue (default)
+	QueryLintBlock = "block" // Reject queries with issues
+)
+
+// IsValidQueryLint reports whether mode is a recognised query lint mode.
+// An empty value is treated as QueryLintWarn.
+func IsValidQueryLint(mode string) bool {
+	switch mode {
+	case "", QueryLintOff, QueryLintWarn, QueryLintBlock:
+		return true
+	default:
+		return false
+	}
+}
+
+// Field types that FieldTypeRule can force on result fields.
+const (
+	FieldTypeNumber    = "number"    // Float64 values; numeric strings are parsed
+	FieldTypeString    = "string"    // Text, keeping numeric-looking values such as order IDs exactly as reported
+	FieldTypeTimestamp = "timestamp" // Times, from epoch seconds, milliseconds, microseconds or nanoseconds
+	FieldTypeBoolean   = "boolean"   // Booleans, from booleans, "true"/"false" strings or 0/1
+)
+
+// IsValidFieldType reports whether fieldType can be forced by a FieldTypeRule.
+func IsValidFieldType(fieldType string) bool {
+	switch fieldType {
+	case FieldTypeNumber, FieldTypeString, FieldTypeTimestamp, FieldTypeBoolean:
+		return true
+	default:
+		return false
+	}
+}
+
+// FieldTypeRule forces the type of the result fields whose name, or the attribute
+// of an aggregation such as latest(orderId), matches Pattern. Pattern is a glob
+// such as "orderId" or "custom.*"; the first matching rule wins.
+type FieldTypeRule struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"` // One of number, string, timestamp or boolean
+}
+
+// WarmupSettings configures queries the backend runs on a schedule to pre-populate
+// the query cache, e.g. for expensive dashboards before business hours.
+type WarmupSettings struct {
+	Queries    []WarmupQuery `json:"queries"`
+	Interval   string        `json:"interval,omitempty"`   // Run every interval (duration, e.g. "15m" or "1h30m")
+	DailyAt    []string      `json:"dailyAt,omitempty"`    // Run daily at these local times ("HH:MM")
+	TimeZone   string        `json:"timeZone,omitempty"`   // IANA time zone for DailyAt (default UTC)
+	TTL        string        `json:"ttl,omitempty"`        // How long warmed results stay cached (duration, e.g. "1h")
+	RunOnStart bool          `json:"runOnStart,omitempty"` // Also run once when the datasource starts
+}
+
+// WarmupQuery is a single NRQL query run by the warm-up scheduler.
+type WarmupQuery struct {
+	Name      string `json:"name"`
+	QueryText string `json:"queryText"`
+	AccountID int    `json:"accountID,omitempty"` // Optional, overrides the default account ID from settings
+	TimeRange string `json:"timeRange,omitempty"` // Relative time range of the dashboards showing the query (duration, e.g. "6h"; default 6h)
+}
+
+// BlackoutWindow is a period, e.g. announced New Relic maintenance, during which
+// the plugin does not query the API and serves cached results instead.
+type BlackoutWindow struct {
+	Start  string `json:"start"`            // RFC 3339 start time (inclusive)
+	End    string `json:"end"`              // RFC 3339 end time (exclusive)
+	Reason string `json:"reason,omitempty"` // Shown to users in the query notice
+}
+
+// QueryBudgetSettings limits the New Relic API calls each account may make within a
+// rolling window. A limit of zero disables it.
+type QueryBudgetSettings struct {
+	Window    string `json:"window,omitempty"` // Rolling window (duration, default "1m")
+	SoftLimit int    `json:"softLimit"`        // Calls above this add a warning to query responses
+	HardLimit int    `json:"hardLimit"`        // Calls at this limit are rejected until the window moves on
+}
+
+// QueryCacheSettings configures the short-lived cache of query results, which lets
+// dashboard panels running the same NRQL share one New Relic API call.
+type QueryCacheSettings struct {
+	TTL        string `json:"ttl"`                  // How long results stay cached (duration, e.g. "30s")
+	TimeBucket string `json:"timeBucket,omitempty"` // Time ranges within one bucket share an entry (duration, default the TTL)
+}
+
+// AuditLogSettings enables the audit log, which records every NRQL query the
+// datasource executes to the plugin log and keeps recent ones for the
+// query-stats resource.
+type AuditLogSettings struct {
+	Enabled    bool `json:"enabled"`
+	BufferSize int  `json:"bufferSize,omitempty"` // Recent queries kept for query-stats (default 200, negative keeps none)
+}
+
+// HealthCheckSettings overrides the NRQL the health check runs, for accounts that
+// do not report Transaction events, e.g. ones ingesting only logs or metrics.
+type HealthCheckSettings struct {
+	Query     string `json:"query,omitempty"`     // NRQL run instead of the default query; takes precedence over EventType
+	EventType string `json:"eventType,omitempty"` // Event type counted instead of Transaction
+}
+
+// DefaultPricePerGB is the list price of a billable GB ingested, in USD, used by
+// usage cost estimates unless the settings give the account's price.
+const DefaultPricePerGB = 0.40
+
+// UsagePricingSettings prices the billable GB and users that usage queries of
+// the cost metric estimate the cost of. Estimates leave out discounts and
+// commitments, so accounts with negotiated prices should set theirs.
+type UsagePricingSettings struct {
+	PerGB               float64 `json:"perGB,omitempty"`               // Price per billable GB ingested (default DefaultPricePerGB)
+	PerFullPlatformUser float64 `json:"perFullPlatformUser,omitempty"` // Price per billable full platform user (0 leaves them out of estimates)
+	PerCoreUser         float64 `json:"perCoreUser,omitempty"`         // Price per billable core user (0 leaves them out of estimates)
+	Currency            string  `json:"currency,omitempty"`            // ISO 4217 code of the prices, e.g. EUR (default USD)
+}
+
+// AccountIDSetting is the default account ID in the datasource JSON data.
+// Provisioning files may hold it as a number or, once templated from an
+// environment variable, as a string; it is parsed when the settings are loaded.
+type AccountIDSetting string
+
+func (a *AccountIDSetting) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = AccountIDSetting(strings.TrimSpace(s))
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("accountID must be a number or a string: %w", err)
+	}
+	*a = AccountIDSetting(n)
+	return nil
 }
 
 // SecretPluginSettings holds sensitive data like API keys and Account IDs.
 type SecretPluginSettings struct {
-	ApiKey    string `json:"apiKey"`
-	AccountId int    `json:"accountID"`
+	ApiKey          string         `json:"apiKey"`
+	SecondaryApiKey string         `json:"secondaryApiKey,omitempty"` // Used when New Relic rejects ApiKey, e.g. while rotating keys
+	AccountId       int            `json:"accountID"`
+	Accounts        []AccountEntry `json:"accounts,omitempty"` // Additional named accounts queries can target
+
+	TLSCACert     string `json:"tlsCACert,omitempty"`     // PEM CA certificate, used with TLSAuthWithCACert
+	TLSClientCert string `json:"tlsClientCert,omitempty"` // PEM client certificate, used with TLSAuth
+	TLSClientKey  string `json:"tlsClientKey,omitempty"`  // PEM client key, used with TLSAuth
+}
+
+// AccountEntry is a named New Relic account that queries can target in addition
+// to the datasource's default account.
+type AccountEntry struct {
+	Name      string `json:"name"`
+	AccountID int    `json:"accountID"`
+	ApiKey    string `json:"apiKey,omitempty"` // Optional, overrides the datasource API key for this account
+}
+
+// APIKeyFor returns the API key used for queries to accountID: the account's
+// override if it has one, otherwise the datasource API key.
+func (s *SecretPluginSettings) APIKeyFor(accountID int) string {
+	for _, account := range s.Accounts {
+		if account.AccountID == accountID && account.ApiKey != "" {
+			return account.ApiKey
+		}
+	}
+	return s.ApiKey
 }
 
 // LoadPluginSettings unmarshals the JSON data and decrypted secure JSON data
@@ -72,7 +324,7 @@ var LoadPluginSettings = func(source backend.DataSourceInstanceSettings) (*Plugi
 		return nil, &PluginSettingsError{Msg: "could not unmarshal PluginSettings JSON", Err: err}
 	}
 
-	secretSettings, err := loadSecretPluginSettings(source.DecryptedSecureJSONData)
+	secretSettings, err := loadSecretPluginSettings(source.DecryptedSecureJSONData, settings.APIKeyEnv, string(settings.AccountID))
 
 	if err != nil {
 		return nil, &PluginSettingsError{Err: err}
@@ -83,26 +335,69 @@ var LoadPluginSettings = func(source backend.DataSourceInstanceSettings) (*Plugi
 	return &settings, nil
 }
 
-// loadSecretPluginSettings extracts secure data from the decrypted map.
-func loadSecretPluginSettings(source map[string]string) (*SecretPluginSettings, error) {
+// loadSecretPluginSettings extracts secure data from the decrypted map. Without
+// an API key in the map, the key is read from the environment variable apiKeyEnv,
+// so provisioned datasources can have it injected at runtime. The account ID is
+// accountID from the JSON data; datasources saved before it moved there keep it
+// in the map, which is read when accountID is empty.
+func loadSecretPluginSettings(source map[string]string, apiKeyEnv, accountID string) (*SecretPluginSettings, error) {
 
 	apiKey := source["apiKey"]
+	if apiKey == "" && apiKeyEnv != "" {
+		var err error
+		if apiKey, err = apiKeyFromEnv(apiKeyEnv); err != nil {
+			return nil, err
+		}
+	}
 	if apiKey == "" {
-		return nil, &PluginSettingsError{Msg: "Enter New Relic API key."}
+		return nil, &PluginSettingsError{Msg: "Enter New Relic API key.", Field: "apiKey", Code: SettingsErrRequired}
 	}
 
-	accountIdStr := source["accountID"]
+	accountIdStr := accountID
+	if accountIdStr == "" {
+		accountIdStr = source["accountID"]
+	}
 	if accountIdStr == "" {
-		return nil, &PluginSettingsError{Msg: "Enter an account ID. This must be a valid, positive number."}
+		return nil, &PluginSettingsError{Msg: "Enter an account ID. This must be a valid, positive number.", Field: "accountID", Code: SettingsErrRequired}
 	}
 
 	accountId, err := strconv.Atoi(accountIdStr)
 	if err != nil {
-		return nil, &PluginSettingsError{Msg: fmt.Sprintf("could not convert accountID '%s' to int", accountIdStr), Err: err}
+		return nil, &PluginSettingsError{Msg: fmt.Sprintf("could not convert accountID '%s' to int", accountIdStr), Err: err, Field: "accountID", Code: SettingsErrInvalid}
+	}
+
+	var accounts []AccountEntry
+	if accountsJSON := source["accounts"]; accountsJSON != "" {
+		if err := json.Unmarshal([]byte(accountsJSON), &accounts); err != nil {
+			return nil, &PluginSettingsError{Msg: "could not unmarshal accounts JSON", Err: err, Field: "accounts", Code: SettingsErrInvalid}
+		}
 	}
 
 	return &SecretPluginSettings{
-		ApiKey:    apiKey,
-		AccountId: accountId,
+		ApiKey:          apiKey,
+		SecondaryApiKey: source["secondaryApiKey"],
+		AccountId:       accountId,
+		Accounts:        accounts,
+		TLSCACert:       source["tlsCACert"],
+		TLSClientCert:   source["tlsClientCert"],
+		TLSClientKey:    source["tlsClientKey"],
 	}, nil
 }
+
+// apiKeyFromEnv reads the API key from the environment variable name. Only
+// variables named with APIKeyEnvPrefix may be used: datasource editors choose
+// the name, and the key is sent to the configured API URL and proxy, so any
+// other variable of the Grafana server could otherwise be read out.
+func apiKeyFromEnv(name string) (string, error) {
+	if !envNamePattern.MatchString(name) {
+		return "", &PluginSettingsError{Msg: fmt.Sprintf("invalid apiKeyEnv '%s': not an environment variable name", name), Field: "apiKeyEnv", Code: SettingsErrInvalid}
+	}
+	if !strings.HasPrefix(name, APIKeyEnvPrefix) || name == APIKeyEnvPrefix {
+		return "", &PluginSettingsError{Msg: fmt.Sprintf("invalid apiKeyEnv '%s': only variables starting with %s can be used", name, APIKeyEnvPrefix), Field: "apiKeyEnv", Code: SettingsErrInvalid}
+	}
+	apiKey := strings.TrimSpace(os.Getenv(name))
+	if apiKey == "" {
+		return "", &PluginSettingsError{Msg: fmt.Sprintf("environment variable %s named by apiKeyEnv is not set or empty", name), Field: "apiKeyEnv", Code: SettingsErrRequired}
+	}
+	return apiKey, nil
+}
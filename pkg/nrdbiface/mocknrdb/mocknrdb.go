@@ -0,0 +1,325 @@
+// Package mocknrdb provides an HTTP-level mock of NerdGraph that replays
+// recorded responses, so queries can be tested end to end, through the New
+// Relic client and its transport, without live credentials. Responses are
+// recorded from New Relic with a Recorder and replayed by a Server.
+package mocknrdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fixture is a recorded NerdGraph response and the requests it answers.
+type Fixture struct {
+	// Name identifies the fixture in errors; LoadFixtures defaults it to the file name.
+	Name string `json:"name,omitempty"`
+	// AccountID is the account of the requests answered; 0 answers any account.
+	AccountID int `json:"accountId,omitempty"`
+	// NRQL is the NRQL query of the requests answered, compared ignoring
+	// differences in whitespace. Empty answers any NRQL query.
+	NRQL string `json:"nrql,omitempty"`
+	// Query is text the GraphQL document of the requests answered must contain,
+	// for requests that are not NRQL queries, e.g. "accessibleAccounts".
+	Query string `json:"query,omitempty"`
+	// Status is the HTTP status of the response; 0 means 200.
+	Status int `json:"status,omitempty"`
+	// Result is the nrql object of an NRQL query response: its results,
+	// metadata and so on. It is returned in the data.actor.account.nrql envelope.
+	Result json.RawMessage `json:"result,omitempty"`
+	// Response is the full response body, returned as is. It takes precedence
+	// over Result.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Request is a NerdGraph request received by a Server.
+type Request struct {
+	APIKey    string
+	AccountID int
+	NRQL      string
+	Query     string
+	Variables map[string]interface{}
+}
+
+// graphQLRequest is the body of a NerdGraph request.
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// Server is a mock NerdGraph endpoint answering requests with the first
+// matching fixture. Requests without one get a GraphQL error, which the New
+// Relic client returns as the query's error.
+type Server struct {
+	server    *httptest.Server
+	tlsServer *httptest.Server // Serves Transport, which dials it for any host
+
+	mu       sync.Mutex
+	fixtures []Fixture
+	requests []Request
+}
+
+// NewServer starts a Server replaying fixtures. Close it when done.
+func NewServer(fixtures ...Fixture) *Server {
+	s := &Server{fixtures: fixtures}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.tlsServer = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL returns the NerdGraph URL of the server, for newrelic.ConfigNerdGraphBaseURL.
+func (s *Server) URL() string {
+	return s.server.URL + "/graphql"
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+	s.tlsServer.Close()
+}
+
+// Add adds fixtures after the server's fixtures.
+func (s *Server) Add(fixtures ...Fixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures = append(s.fixtures, fixtures...)
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Transport returns an HTTP transport that sends every request to the server,
+// whatever its host, over TLS. Clients created with it query the server at New
+// Relic's endpoints in any region, e.g. as the datasource's HTTP transport.
+func (s *Server) Transport() *http.Transport {
+	addr := s.tlsServer.Listener.Addr().String()
+	transport := s.tlsServer.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	}
+	// The server's certificate is issued for example.com
+	transport.TLSClientConfig.ServerName = "example.com"
+	return transport
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var body graphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("mocknrdb: invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		APIKey:    r.Header.Get("Api-Key"),
+		AccountID: accountIDOf(body.Variables),
+		NRQL:      nrqlOf(body.Variables),
+		Query:     body.Query,
+		Variables: body.Variables,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	fixture, ok := s.match(req)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		writeGraphQLError(w, fmt.Sprintf("mocknrdb: no fixture for account %d and query %q", req.AccountID, req.NRQL))
+		return
+	}
+	status := fixture.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(fixture.body())
+}
+
+// match returns the first fixture answering req.
+func (s *Server) match(req Request) (Fixture, bool) {
+	for _, fixture := range s.fixtures {
+		if fixture.matches(req) {
+			return fixture, true
+		}
+	}
+	return Fixture{}, false
+}
+
+func (f Fixture) matches(req Request) bool {
+	if f.AccountID != 0 && f.AccountID != req.AccountID {
+		return false
+	}
+	if f.NRQL != "" && normalize(f.NRQL) != normalize(req.NRQL) {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(req.Query, f.Query) {
+		return false
+	}
+	// Fixtures matching on nothing but the account only answer NRQL queries
+	return f.NRQL != "" || f.Query != "" || req.NRQL != ""
+}
+
+// body returns the response body of the fixture.
+func (f Fixture) body() []byte {
+	if len(f.Response) > 0 {
+		return f.Response
+	}
+	result := f.Result
+	if len(result) == 0 {
+		result = json.RawMessage(`{"results":[]}`)
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"data":{"actor":{"account":{"nrql":`)
+	b.Write(result)
+	b.WriteString(`}}}}`)
+	return b.Bytes()
+}
+
+func writeGraphQLError(w http.ResponseWriter, message string) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
+
+// LoadFixtures reads the fixtures of the .json files of dir, in file name
+// order. A file holds a fixture or an array of fixtures.
+func LoadFixtures(dir string) ([]Fixture, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var fixtures []Fixture
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		var loaded []Fixture
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(raw, &loaded)
+		} else {
+			var fixture Fixture
+			err = json.Unmarshal(raw, &fixture)
+			loaded = []Fixture{fixture}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mocknrdb: invalid fixture file %s: %w", file, err)
+		}
+		for i := range loaded {
+			if loaded[i].Name == "" {
+				loaded[i].Name = name
+			}
+		}
+		fixtures = append(fixtures, loaded...)
+	}
+	return fixtures, nil
+}
+
+// Recorder is an http.RoundTripper that records the NerdGraph responses of
+// the requests it sends as fixtures. Use it as a client's transport against
+// New Relic, then Save the fixtures for a Server to replay.
+type Recorder struct {
+	// Base sends the requests; nil uses http.DefaultTransport.
+	Base http.RoundTripper
+
+	mu       sync.Mutex
+	fixtures []Fixture
+}
+
+// RoundTrip sends req through Base and records its response. The API key is
+// not recorded.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var body graphQLRequest
+	sent := req
+	if req.Body != nil && req.Body != http.NoBody {
+		raw, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		_ = json.Unmarshal(raw, &body)
+		sent = req.Clone(req.Context())
+		sent.Body = io.NopCloser(bytes.NewReader(raw))
+	}
+
+	resp, err := base.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+
+	fixture := Fixture{AccountID: accountIDOf(body.Variables), NRQL: nrqlOf(body.Variables), Response: raw}
+	if fixture.NRQL == "" {
+		fixture.Query = body.Query
+	}
+	if resp.StatusCode != http.StatusOK {
+		fixture.Status = resp.StatusCode
+	}
+	r.mu.Lock()
+	r.fixtures = append(r.fixtures, fixture)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Fixtures returns the fixtures recorded so far, in order.
+func (r *Recorder) Fixtures() []Fixture {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save writes the recorded fixtures to path as an indented JSON array, which
+// LoadFixtures reads.
+func (r *Recorder) Save(path string) error {
+	encoded, err := json.MarshalIndent(r.Fixtures(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0o600)
+}
+
+// accountIDOf returns the accountId variable of a request, or 0.
+func accountIDOf(variables map[string]interface{}) int {
+	if id, ok := variables["accountId"].(float64); ok {
+		return int(id)
+	}
+	return 0
+}
+
+// nrqlOf returns the NRQL query variable of a request, or "".
+func nrqlOf(variables map[string]interface{}) string {
+	nrql, _ := variables["query"].(string)
+	return nrql
+}
+
+// normalize collapses the whitespace of an NRQL query.
+func normalize(nrql string) string {
+	return strings.Join(strings.Fields(nrql), " ")
+}
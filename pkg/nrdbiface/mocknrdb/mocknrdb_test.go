@@ -0,0 +1,124 @@
+package mocknrdb
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T, opts ...newrelic.ConfigOption) *newrelic.NewRelic {
+	t.Helper()
+	nrClient, err := newrelic.New(append([]newrelic.ConfigOption{newrelic.ConfigPersonalAPIKey("test-api-key")}, opts...)...)
+	require.NoError(t, err)
+	return nrClient
+}
+
+func TestServer_ReplaysFixtures(t *testing.T) {
+	fixtures, err := LoadFixtures("testdata")
+	require.NoError(t, err)
+	server := NewServer(fixtures...)
+	defer server.Close()
+	nrClient := newClient(t, newrelic.ConfigNerdGraphBaseURL(server.URL()))
+
+	results, err := nrClient.Nrdb.QueryWithContext(context.Background(), 123456, "SELECT count(*)\n  FROM Transaction")
+	require.NoError(t, err)
+	require.Len(t, results.Results, 1)
+	assert.EqualValues(t, 1523, results.Results[0]["count"])
+	assert.Equal(t, []string{"Transaction"}, results.Metadata.EventTypes)
+
+	multi, err := nrClient.Nrdb.PerformNRQLQueryWithContext(context.Background(), 123456, "SELECT count(*) FROM Transaction FACET appName")
+	require.NoError(t, err)
+	assert.Len(t, multi.Results, 2)
+	assert.Equal(t, []string{"appName"}, multi.Metadata.Facets)
+
+	requests := server.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "test-api-key", requests[0].APIKey)
+	assert.Equal(t, 123456, requests[0].AccountID)
+	assert.Equal(t, "SELECT count(*)\n  FROM Transaction", requests[0].NRQL)
+}
+
+func TestServer_NoFixture(t *testing.T) {
+	server := NewServer(Fixture{AccountID: 1, NRQL: "SELECT count(*) FROM Transaction"})
+	defer server.Close()
+	nrClient := newClient(t, newrelic.ConfigNerdGraphBaseURL(server.URL()))
+
+	_, err := nrClient.Nrdb.QueryWithContext(context.Background(), 2, "SELECT count(*) FROM Transaction")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no fixture for account 2")
+
+	_, err = nrClient.Nrdb.QueryWithContext(context.Background(), 1, "SELECT count(*) FROM PageView")
+	require.Error(t, err)
+
+	results, err := nrClient.Nrdb.QueryWithContext(context.Background(), 1, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	assert.Empty(t, results.Results, "fixtures without a result return no results")
+}
+
+func TestServer_Status(t *testing.T) {
+	fixtures, err := LoadFixtures("testdata")
+	require.NoError(t, err)
+	server := NewServer(fixtures...)
+	defer server.Close()
+	nrClient := newClient(t, newrelic.ConfigNerdGraphBaseURL(server.URL()))
+
+	_, err = nrClient.Nrdb.QueryWithContext(context.Background(), 999, "SELECT count(*) FROM Transaction")
+	require.Error(t, err)
+}
+
+func TestServer_Transport(t *testing.T) {
+	server := NewServer(Fixture{NRQL: "SELECT 1", Result: []byte(`{"results":[{"value":1}]}`)})
+	defer server.Close()
+
+	for _, region := range []string{"US", "EU"} {
+		nrClient := newClient(t, newrelic.ConfigRegion(region), newrelic.ConfigHTTPTransport(server.Transport()))
+		results, err := nrClient.Nrdb.QueryWithContext(context.Background(), 1, "SELECT 1")
+		require.NoError(t, err, region)
+		assert.EqualValues(t, 1, results.Results[0]["value"])
+	}
+	assert.Len(t, server.Requests(), 2)
+}
+
+func TestLoadFixtures(t *testing.T) {
+	fixtures, err := LoadFixtures("testdata")
+	require.NoError(t, err)
+	require.Len(t, fixtures, 3)
+	assert.Equal(t, "transactions", fixtures[0].Name)
+	assert.Equal(t, "unauthorized", fixtures[2].Name)
+	assert.Equal(t, http.StatusUnauthorized, fixtures[2].Status)
+
+	_, err = LoadFixtures(filepath.Join("testdata", "missing"))
+	require.NoError(t, err, "a missing directory has no fixtures")
+}
+
+func TestRecorder(t *testing.T) {
+	upstream := NewServer(Fixture{AccountID: 7, NRQL: "SELECT count(*) FROM Log", Result: []byte(`{"results":[{"count":42}]}`)})
+	defer upstream.Close()
+
+	recorder := &Recorder{Base: upstream.Transport()}
+	nrClient := newClient(t, newrelic.ConfigHTTPTransport(recorder))
+	_, err := nrClient.Nrdb.QueryWithContext(context.Background(), 7, "SELECT count(*) FROM Log")
+	require.NoError(t, err)
+
+	recorded := recorder.Fixtures()
+	require.Len(t, recorded, 1)
+	assert.Equal(t, 7, recorded[0].AccountID)
+	assert.Equal(t, "SELECT count(*) FROM Log", recorded[0].NRQL)
+
+	// The saved fixtures replay the recorded response
+	path := filepath.Join(t.TempDir(), "recorded.json")
+	require.NoError(t, recorder.Save(path))
+	fixtures, err := LoadFixtures(filepath.Dir(path))
+	require.NoError(t, err)
+	replay := NewServer(fixtures...)
+	defer replay.Close()
+
+	results, err := newClient(t, newrelic.ConfigNerdGraphBaseURL(replay.URL())).Nrdb.QueryWithContext(context.Background(), 7, "SELECT count(*) FROM Log")
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, results.Results[0]["count"])
+}
@@ -1,14 +1,23 @@
-// Package nrdbiface provides interfaces for New Relic Database (NRDB) query execution.
+// Package nrdbiface provides interfaces for New Relic Database (NRDB) query
+// execution and NerdGraph GraphQL queries.
 // This package enables dependency injection and testing by abstracting the concrete
 // New Relic client implementation behind interfaces.
 package nrdbiface
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
 )
 
+// Bounds of the NerdGraph NRQL timeout argument, in seconds.
+const (
+	MinTimeoutSeconds = 5
+	MaxTimeoutSeconds = 120
+)
+
 // NRDBQueryExecutor defines the interface for executing NRQL queries against New Relic.
 // This abstraction allows for easier testing and dependency injection.
 type NRDBQueryExecutor interface {
@@ -16,6 +25,31 @@ type NRDBQueryExecutor interface {
 	PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error)
 }
 
+// GraphQLExecutor defines the interface for running GraphQL queries against
+// NerdGraph. The response data is decoded into respBody. It is implemented by
+// the New Relic client's nerdgraph.NerdGraph.
+type GraphQLExecutor interface {
+	QueryWithResponseAndContext(ctx context.Context, query string, variables map[string]interface{}, respBody interface{}) error
+}
+
+// GraphQLExecutorFunc adapts a function returning the response data of a
+// GraphQL query to GraphQLExecutor, for tests and mocks.
+type GraphQLExecutorFunc func(ctx context.Context, query string, variables map[string]interface{}) (interface{}, error)
+
+// QueryWithResponseAndContext calls f and decodes the data it returns into
+// respBody through JSON, as the NerdGraph client does with response bodies.
+func (f GraphQLExecutorFunc) QueryWithResponseAndContext(ctx context.Context, query string, variables map[string]interface{}, respBody interface{}) error {
+	data, err := f(ctx, query, variables)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, respBody)
+}
+
 // RealNRDBExecutor is a wrapper around the real nrdb.Nrdb that implements NRDBQueryExecutor.
 // This allows us to use dependency injection in production code.
 type RealNRDBExecutor struct {
@@ -23,11 +57,90 @@ type RealNRDBExecutor struct {
 }
 
 // QueryWithContext executes an NRQL query using the real New Relic client.
+// If ctx has a deadline, it is passed to New Relic as the query timeout so the
+// server stops working on a query the plugin has already given up on.
 func (r *RealNRDBExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
-	return r.NRDB.QueryWithContext(ctx, accountID, query)
+	return UntilDone(ctx, func() (*nrdb.NRDBResultContainer, error) {
+		if timeout, ok := TimeoutHint(ctx, time.Now()); ok {
+			return r.NRDB.QueryWithAdditionalOptionsWithContext(ctx, accountID, query, timeout, false)
+		}
+		return r.NRDB.QueryWithContext(ctx, accountID, query)
+	})
 }
 
 // PerformNRQLQueryWithContext executes an NRQL query using the enhanced New Relic client.
+// The enhanced query does not accept a timeout argument, so no deadline hint is sent,
+// but the request is abandoned once ctx is done.
 func (r *RealNRDBExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
-	return r.NRDB.PerformNRQLQuery(accountID, query)
+	return UntilDone(ctx, func() (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+		return r.NRDB.PerformNRQLQueryWithContext(ctx, accountID, query)
+	})
+}
+
+// CallTracker is told of the calls UntilDone runs for a context, so that the
+// owner of the clients making them knows when none of them is still running.
+type CallTracker interface {
+	CallStarted()
+	CallDone()
+}
+
+// callTrackerKey is the context key of the CallTracker of a context.
+type callTrackerKey struct{}
+
+// WithCallTracker returns ctx with tracker told of the calls UntilDone runs
+// for it and the contexts derived from it.
+func WithCallTracker(ctx context.Context, tracker CallTracker) context.Context {
+	return context.WithValue(ctx, callTrackerKey{}, tracker)
+}
+
+// UntilDone runs call and returns its result, or the error of ctx as soon as
+// ctx is done. The New Relic client backs off between retries of failed
+// requests without watching the context, so a cancelled query could otherwise
+// hold up its caller for seconds; call is left to finish in the background,
+// and the CallTracker of ctx, if any, is told once it has.
+func UntilDone[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	if ctx.Done() == nil {
+		return call()
+	}
+	tracker, _ := ctx.Value(callTrackerKey{}).(CallTracker)
+	if tracker != nil {
+		tracker.CallStarted()
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		if tracker != nil {
+			defer tracker.CallDone()
+		}
+		value, err := call()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// TimeoutHint returns the NerdGraph query timeout matching the deadline of ctx,
+// rounded down to whole seconds and clamped to the range New Relic accepts.
+// It returns false if ctx has no deadline.
+func TimeoutHint(ctx context.Context, now time.Time) (nrdb.Seconds, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	seconds := int(deadline.Sub(now) / time.Second)
+	if seconds < MinTimeoutSeconds {
+		seconds = MinTimeoutSeconds
+	}
+	if seconds > MaxTimeoutSeconds {
+		seconds = MaxTimeoutSeconds
+	}
+	return nrdb.Seconds(seconds), true
 }
@@ -2,11 +2,18 @@ package nrdbiface
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
 	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestNRDBExecutor is a simple implementation of NRDBQueryExecutor for testing
@@ -170,3 +177,160 @@ func TestRealNRDBExecutor_PerformNRQLQueryWithContext(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeoutHint(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		remaining time.Duration
+		want      nrdb.Seconds
+	}{
+		{name: "rounded down", remaining: 30*time.Second + 900*time.Millisecond, want: 30},
+		{name: "raised to the minimum", remaining: time.Second, want: MinTimeoutSeconds},
+		{name: "expired deadline", remaining: -time.Second, want: MinTimeoutSeconds},
+		{name: "capped at the maximum", remaining: 10 * time.Minute, want: MaxTimeoutSeconds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithDeadline(context.Background(), now.Add(tt.remaining))
+			defer cancel()
+
+			got, ok := TimeoutHint(ctx, now)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, ok := TimeoutHint(context.Background(), now)
+	assert.False(t, ok, "no hint without a deadline")
+}
+
+func TestRealNRDBExecutor_QueryWithContext_TimeoutHint(t *testing.T) {
+	var variables map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		variables = body.Variables
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"actor":{"account":{"nrql":{"results":[{"count":1}]}}}}}`))
+	}))
+	defer server.Close()
+
+	client, err := newrelic.New(newrelic.ConfigPersonalAPIKey("test-api-key"), newrelic.ConfigNerdGraphBaseURL(server.URL))
+	require.NoError(t, err)
+	executor := &RealNRDBExecutor{NRDB: client.Nrdb}
+
+	_, err = executor.QueryWithContext(context.Background(), 12345, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	assert.NotContains(t, variables, "timeout")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+	defer cancel()
+	_, err = executor.QueryWithContext(ctx, 12345, "SELECT count(*) FROM Transaction")
+	require.NoError(t, err)
+	assert.EqualValues(t, 44, variables["timeout"])
+	assert.Equal(t, false, variables["async"])
+}
+
+func TestRealNRDBExecutor_QueryWithContext_Cancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"actor":{"account":{"nrql":{"results":[{"count":1}]}}}}}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := newrelic.New(newrelic.ConfigPersonalAPIKey("test-api-key"), newrelic.ConfigNerdGraphBaseURL(server.URL))
+	require.NoError(t, err)
+	executor := &RealNRDBExecutor{NRDB: client.Nrdb}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = executor.QueryWithContext(ctx, 12345, "SELECT count(*) FROM Transaction")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestUntilDone(t *testing.T) {
+	// slow ignores its context, like the New Relic client backing off between retries
+	slow := func() (int, error) {
+		time.Sleep(time.Minute)
+		return 1, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := UntilDone(ctx, slow)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	value, err := UntilDone(context.Background(), func() (int, error) { return 2, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	_, err = UntilDone(context.Background(), func() (int, error) { return 0, errors.New("boom") })
+	assert.EqualError(t, err, "boom")
+}
+
+// countingTracker counts the calls in flight it was told of.
+type countingTracker struct {
+	running atomic.Int32
+}
+
+func (c *countingTracker) CallStarted() { c.running.Add(1) }
+func (c *countingTracker) CallDone()    { c.running.Add(-1) }
+
+// TestUntilDone_CallTracker verifies that the tracker of a context is told of
+// calls left running after the context is done, until they finish.
+func TestUntilDone_CallTracker(t *testing.T) {
+	tracker := &countingTracker{}
+	ctx, cancel := context.WithCancel(WithCallTracker(context.Background(), tracker))
+	release := make(chan struct{})
+	cancel()
+	_, err := UntilDone(ctx, func() (int, error) {
+		<-release
+		return 1, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, 1, tracker.running.Load(), "the abandoned call is still running")
+
+	close(release)
+	assert.Eventually(t, func() bool { return tracker.running.Load() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestGraphQLExecutorFunc(t *testing.T) {
+	var _ GraphQLExecutor = GraphQLExecutorFunc(nil)
+
+	var gotQuery string
+	var gotVariables map[string]interface{}
+	executor := GraphQLExecutorFunc(func(ctx context.Context, query string, variables map[string]interface{}) (interface{}, error) {
+		gotQuery, gotVariables = query, variables
+		return map[string]interface{}{"actor": map[string]interface{}{"user": map[string]interface{}{"name": "Ada"}}}, nil
+	})
+
+	var resp struct {
+		Actor struct {
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"actor"`
+	}
+	err := executor.QueryWithResponseAndContext(context.Background(), "{ actor { user { name } } }", map[string]interface{}{"id": 1}, &resp)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", resp.Actor.User.Name)
+	assert.Equal(t, "{ actor { user { name } } }", gotQuery)
+	assert.Equal(t, map[string]interface{}{"id": 1}, gotVariables)
+
+	failing := GraphQLExecutorFunc(func(context.Context, string, map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("unauthorized")
+	})
+	assert.EqualError(t, failing.QueryWithResponseAndContext(context.Background(), "{}", nil, &resp), "unauthorized")
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"newrelic-grafana-plugin/pkg/accountaccess"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// defaultAccountName is the name the configured-accounts resource gives the
+// datasource's default account.
+const defaultAccountName = "Default"
+
+// configuredAccount is an account listed by the configured-accounts resource.
+// API keys are never included.
+type configuredAccount struct {
+	Name      string `json:"name"`
+	AccountID int    `json:"accountID"`
+	Default   bool   `json:"default,omitempty"`
+}
+
+// accountRouter sends queries for named accounts with their own API key to the
+// executor for that key, and all other queries to the default executor.
+type accountRouter struct {
+	nrdbiface.NRDBQueryExecutor                                     // Default executor
+	accounts                    map[int]nrdbiface.NRDBQueryExecutor // Executors by account ID
+}
+
+// executorFor returns the executor for queries to accountID.
+func (r *accountRouter) executorFor(accountID int) nrdbiface.NRDBQueryExecutor {
+	if executor, ok := r.accounts[accountID]; ok {
+		return executor
+	}
+	return r.NRDBQueryExecutor
+}
+
+// QueryWithContext runs the query with the executor for accountID.
+func (r *accountRouter) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	return r.executorFor(accountID).QueryWithContext(ctx, accountID, query)
+}
+
+// PerformNRQLQueryWithContext runs the query with the executor for accountID.
+func (r *accountRouter) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return r.executorFor(accountID).PerformNRQLQueryWithContext(ctx, accountID, query)
+}
+
+// accountExecutor returns the executor for a query request. Without named
+// accounts that override the API key it is defaultExecutor; otherwise queries to
+// those accounts are routed to executors using their key.
+func (d *Datasource) accountExecutor(ctx context.Context, config *models.PluginSettings, datasourceUID string, defaultExecutor nrdbiface.NRDBQueryExecutor) (nrdbiface.NRDBQueryExecutor, error) {
+	router := &accountRouter{NRDBQueryExecutor: defaultExecutor}
+	for _, account := range config.Secrets.Accounts {
+		if account.ApiKey == "" {
+			continue
+		}
+		nrClient, err := d.clientForAccount(ctx, config, datasourceUID, account.AccountID)
+		if err != nil {
+			return nil, fmt.Errorf("account '%s': %w", account.Name, err)
+		}
+		if router.accounts == nil {
+			router.accounts = make(map[int]nrdbiface.NRDBQueryExecutor)
+		}
+		router.accounts[account.AccountID] = &nrdbiface.RealNRDBExecutor{NRDB: nrClient.Nrdb}
+	}
+	if router.accounts == nil {
+		return defaultExecutor, nil
+	}
+	return router, nil
+}
+
+// accountListers returns the function that gives the account access check the
+// account lister and API key of the account a query targets.
+func (d *Datasource) accountListers(config *models.PluginSettings, datasourceUID string) accountaccess.ListerFunc {
+	return func(ctx context.Context, accountID int) (metadata.AccountLister, string, error) {
+		nrClient, err := d.clientForAccount(ctx, config, datasourceUID, accountID)
+		if err != nil {
+			return nil, "", err
+		}
+		_, lister := newMetadataSources(nrClient)
+		if d.budget != nil {
+			lister = &quota.AccountLister{Lister: lister, Budget: d.budget, AccountID: accountID}
+		}
+		return lister, config.Secrets.APIKeyFor(accountID), nil
+	}
+}
+
+// handleConfiguredAccountsResource handles the configured-accounts resource
+// endpoint, which lists the default account and the named accounts for the query
+// editor's account picker.
+func (d *Datasource) handleConfiguredAccountsResource(req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+
+	config, err := models.LoadPluginSettings(*req.PluginContext.DataSourceInstanceSettings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Configured accounts request with invalid configuration", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+
+	accounts := []configuredAccount{{Name: defaultAccountName, AccountID: config.Secrets.AccountId, Default: true}}
+	for _, account := range config.Secrets.Accounts {
+		accounts = append(accounts, configuredAccount{Name: account.Name, AccountID: account.AccountID})
+	}
+	return sendJSON(sender, http.StatusOK, map[string][]configuredAccount{"accounts": accounts})
+}
@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accountsSettings are instance settings with a default account and two named accounts,
+// one of which has its own API key.
+var accountsSettings = backend.DataSourceInstanceSettings{
+	UID:      "ds-uid",
+	JSONData: []byte(`{}`),
+	DecryptedSecureJSONData: map[string]string{
+		"apiKey":    "test-api-key",
+		"accountID": "123456",
+		"accounts":  `[{"name":"Staging","accountID":222},{"name":"Partner","accountID":333,"apiKey":"partner-api-key"}]`,
+	},
+}
+
+// TestDatasource_ClientForAccount verifies that named accounts with their own API
+// key get a shared client of their own and all other accounts the default client.
+func TestDatasource_ClientForAccount(t *testing.T) {
+	instance, err := NewDatasource(context.Background(), accountsSettings)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+
+	config, err := models.LoadPluginSettings(accountsSettings)
+	require.NoError(t, err)
+
+	for _, accountID := range []int{123456, 222, 999} {
+		nrClient, err := ds.clientForAccount(context.Background(), config, accountsSettings.UID, accountID)
+		require.NoError(t, err)
+		assert.Same(t, ds.sharedClient(), nrClient, "account %d", accountID)
+	}
+
+	partner, err := ds.clientForAccount(context.Background(), config, accountsSettings.UID, 333)
+	require.NoError(t, err)
+	assert.NotSame(t, ds.sharedClient(), partner)
+	again, err := ds.clientForAccount(context.Background(), config, accountsSettings.UID, 333)
+	require.NoError(t, err)
+	assert.Same(t, partner, again)
+
+	executor, err := ds.accountExecutor(context.Background(), config, accountsSettings.UID, &recordingExecutor{})
+	require.NoError(t, err)
+	router, ok := executor.(*accountRouter)
+	require.True(t, ok)
+	assert.Len(t, router.accounts, 1)
+	assert.Contains(t, router.accounts, 333)
+
+	ds.Dispose()
+	assert.Nil(t, ds.accountClients)
+}
+
+// recordingExecutor records the accounts it was asked to query.
+type recordingExecutor struct {
+	accounts []int
+}
+
+func (e *recordingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.accounts = append(e.accounts, accountID)
+	return &nrdb.NRDBResultContainer{}, nil
+}
+
+func (e *recordingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	e.accounts = append(e.accounts, accountID)
+	return &nrdb.NRDBResultContainerMultiResultCustomized{}, nil
+}
+
+// TestAccountRouter verifies that queries are routed by account ID.
+func TestAccountRouter(t *testing.T) {
+	defaultExecutor := &recordingExecutor{}
+	partnerExecutor := &recordingExecutor{}
+	router := &accountRouter{
+		NRDBQueryExecutor: defaultExecutor,
+		accounts:          map[int]nrdbiface.NRDBQueryExecutor{333: partnerExecutor},
+	}
+
+	_, _ = router.QueryWithContext(context.Background(), 123456, "SELECT 1")
+	_, _ = router.QueryWithContext(context.Background(), 333, "SELECT 1")
+	_, _ = router.PerformNRQLQueryWithContext(context.Background(), 333, "SELECT 1")
+
+	assert.Equal(t, []int{123456}, defaultExecutor.accounts)
+	assert.Equal(t, []int{333, 333}, partnerExecutor.accounts)
+}
+
+// TestDatasource_HandleConfiguredAccountsResource verifies the configured-accounts
+// resource lists the accounts without their API keys.
+func TestDatasource_HandleConfiguredAccountsResource(t *testing.T) {
+	var captured *backend.CallResourceResponse
+	sender := &mockCallResourceResponseSender{
+		sendFunc: func(resp *backend.CallResourceResponse) error {
+			captured = resp
+			return nil
+		},
+	}
+	settings := accountsSettings
+	req := &backend.CallResourceRequest{
+		Path:          "configured-accounts",
+		URL:           "configured-accounts",
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+	}
+
+	require.NoError(t, (&Datasource{}).CallResource(context.Background(), req, sender))
+	require.NotNil(t, captured)
+	assert.Equal(t, http.StatusOK, captured.Status)
+	assert.JSONEq(t, `{"accounts":[
+		{"name":"Default","accountID":123456,"default":true},
+		{"name":"Staging","accountID":222},
+		{"name":"Partner","accountID":333}
+	]}`, string(captured.Body))
+}
+
+// TestDatasource_QueryData_InaccessibleAccount verifies that a query overriding
+// the account with one the API key cannot access fails with an error naming it.
+func TestDatasource_QueryData_InaccessibleAccount(t *testing.T) {
+	originalSources := newMetadataSources
+	newMetadataSources = func(nrClient *newrelic.NewRelic) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister) {
+		return &metadataExecutor{}, metadataLister{}
+	}
+	defer func() { newMetadataSources = originalSources }()
+
+	instance, err := NewDatasource(context.Background(), accountsSettings)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &accountsSettings},
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"queryText": "SELECT count(*) FROM Transaction", "accountID": 999999}`)},
+		},
+	})
+	require.NoError(t, err)
+	res := resp.Responses["A"]
+	require.Error(t, res.Error)
+	assert.Equal(t, "API key has no access to account 999999", res.Error.Error())
+	assert.Equal(t, backend.StatusForbidden, res.Status)
+	assert.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+}
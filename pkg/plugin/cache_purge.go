@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"time"
+
+	"newrelic-grafana-plugin/pkg/cache"
+)
+
+// cachePurgeInterval is how often the instance's caches drop expired entries.
+const cachePurgeInterval = 10 * time.Minute
+
+// staleResultRetention is how long expired query results stay available as
+// stale results, e.g. to be served during a blackout window.
+const staleResultRetention = 24 * time.Hour
+
+// startCachePurge starts purging the instance's caches every cachePurgeInterval
+// until Dispose is called.
+func (d *Datasource) startCachePurge() {
+	d.stopPurge = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(cachePurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.purgeCaches()
+			case <-stop:
+				return
+			}
+		}
+	}(d.stopPurge)
+}
+
+// stopCachePurge stops the purging started by startCachePurge, if any.
+func (d *Datasource) stopCachePurge() {
+	if d.stopPurge != nil {
+		close(d.stopPurge)
+		d.stopPurge = nil
+	}
+}
+
+// purgeCaches drops the expired entries of the instance's caches. Query results
+// are kept as stale results for staleResultRetention.
+func (d *Datasource) purgeCaches() {
+	if d.cache != nil {
+		d.cache.PurgeStale(staleResultRetention)
+	}
+	for _, c := range []*cache.Cache{d.suggestions, d.variables, d.accessible, d.liveQueries, d.entities} {
+		if c != nil {
+			c.Purge()
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/cache"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatasource_PurgeCaches(t *testing.T) {
+	ds := &Datasource{cache: cache.New(), entities: cache.New()}
+	ds.cache.Retain("recent", 1)
+	ds.entities.Set("expired", 2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	ds.purgeCaches()
+	assert.Equal(t, 1, ds.cache.Len(), "recent stale results are kept")
+	assert.Equal(t, 0, ds.entities.Len())
+}
+
+func TestDatasource_DisposeStopsCachePurge(t *testing.T) {
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{JSONData: []byte(`{}`)})
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	require.NotNil(t, ds.stopPurge)
+
+	ds.Dispose()
+	assert.Nil(t, ds.stopPurge)
+	ds.Dispose()
+}
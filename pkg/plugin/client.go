@@ -0,0 +1,217 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/health"
+	"newrelic-grafana-plugin/pkg/incidents"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/tracing"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+)
+
+// newRelicClient creates a New Relic client for the settings that sends its API
+// requests through transport. A nil transport uses http.DefaultTransport. keys,
+// if not nil, is the API key state shared with the instance's other clients.
+func newRelicClient(config *models.PluginSettings, datasourceUID string, transport http.RoundTripper, keys *client.KeyRotation) (*newrelic.NewRelic, error) {
+	clientConfig := client.ConfigFromSettings(config, datasourceUID)
+	clientConfig.Transport = transport
+	clientConfig.KeyRotation = keys
+	return client.NewClient(clientConfig)
+}
+
+// requestClient creates a New Relic client bound to a request: its API
+// requests carry the trace context of ctx and are aborted once ctx is done.
+func requestClient(ctx context.Context, config *models.PluginSettings, datasourceUID string, base http.RoundTripper, keys *client.KeyRotation) (*newrelic.NewRelic, error) {
+	clientConfig := client.ConfigFromSettings(config, datasourceUID)
+	clientConfig.Transport = base
+	if tracing.TraceIDFromContext(ctx) != "" {
+		clientConfig.Transport = tracing.NewTransport(ctx, base)
+	}
+	if ctx.Done() != nil {
+		clientConfig.Context = ctx
+	}
+	clientConfig.KeyRotation = keys
+	return client.NewClient(clientConfig)
+}
+
+// boundToRequest reports whether requests for ctx need clients bound to them:
+// the client library does not pass request contexts on to its HTTP requests, so
+// a context that can be cancelled or carries a trace context needs clients
+// whose transport applies it.
+func boundToRequest(ctx context.Context) bool {
+	return ctx.Done() != nil || tracing.TraceIDFromContext(ctx) != ""
+}
+
+// initClient creates the HTTP transport and the New Relic client shared by the
+// instance's requests. The transport routes requests through the configured
+// proxy, or Grafana's secure socks proxy when the datasource enables it, and
+// applies the TLS settings. Missing or invalid settings leave the client unset;
+// requests then report the configuration error.
+func (d *Datasource) initClient(ctx context.Context, settings backend.DataSourceInstanceSettings, config *models.PluginSettings) {
+	d.transport = http.DefaultTransport.(*http.Transport).Clone()
+	if config == nil {
+		return
+	}
+
+	err := validator.ValidatePluginSettings(config)
+	if err != nil {
+		log.DefaultLogger.Debug("Shared New Relic client not created", "error", err, "datasourceID", settings.ID)
+		return
+	}
+
+	clientConfig := client.ConfigFromSettings(config, settings.UID)
+	clientConfig.SecureSocksProxy, err = settings.ProxyOptionsFromContext(ctx)
+	if err == nil {
+		d.transport, err = client.NewTransport(clientConfig)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create HTTP transport", "error", err, "datasourceID", settings.ID)
+		d.transport = nil
+		return
+	}
+
+	if secondary := config.Secrets.SecondaryApiKey; secondary != "" {
+		d.keys = client.NewKeyRotation(config.Secrets.ApiKey, secondary)
+	}
+	nrClient, err := newRelicClient(config, settings.UID, d.transport, d.keys)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create shared New Relic client", "error", err, "datasourceID", settings.ID)
+		return
+	}
+	d.clientMu.Lock()
+	d.client = nrClient
+	d.clientMu.Unlock()
+}
+
+// clientFor returns the New Relic client for a request. The instance's shared
+// client is reused, except for requests that can be cancelled or carry a trace
+// context: those use the request clients bound to them by bindRequest, whose
+// requests are aborted when the request is cancelled, so abandoned panels stop
+// using API quota, and propagate the trace context. Such requests without
+// bound clients get a client of their own. All clients of an instance share
+// its HTTP transport and connection pool.
+func (d *Datasource) clientFor(ctx context.Context, config *models.PluginSettings, datasourceUID string) (*newrelic.NewRelic, error) {
+	if clients, ok := requestClientsFrom(ctx); ok {
+		return clients.clientFor(config, datasourceUID, d.keys)
+	}
+	base := d.baseTransport()
+	if boundToRequest(ctx) {
+		return requestClient(ctx, config, datasourceUID, base, d.keys)
+	}
+
+	if nrClient := d.sharedClient(); nrClient != nil {
+		return nrClient, nil
+	}
+	return newRelicClient(config, datasourceUID, base, d.keys)
+}
+
+// clientForAccount returns the New Relic client for requests to accountID. Named
+// accounts with their own API key get a client for that key, shared by the
+// instance's requests like the default client; all other accounts use clientFor.
+func (d *Datasource) clientForAccount(ctx context.Context, config *models.PluginSettings, datasourceUID string, accountID int) (*newrelic.NewRelic, error) {
+	apiKey := config.Secrets.APIKeyFor(accountID)
+	if apiKey == config.Secrets.ApiKey {
+		return d.clientFor(ctx, config, datasourceUID)
+	}
+
+	accountConfig := *config
+	accountConfig.Secrets = &models.SecretPluginSettings{ApiKey: apiKey, AccountId: accountID}
+	if clients, ok := requestClientsFrom(ctx); ok {
+		return clients.clientFor(&accountConfig, datasourceUID, nil)
+	}
+	base := d.baseTransport()
+	if boundToRequest(ctx) {
+		return requestClient(ctx, &accountConfig, datasourceUID, base, nil)
+	}
+
+	d.clientMu.Lock()
+	defer d.clientMu.Unlock()
+	if nrClient, ok := d.accountClients[apiKey]; ok {
+		return nrClient, nil
+	}
+	nrClient, err := newRelicClient(&accountConfig, datasourceUID, base, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.accountClients == nil {
+		d.accountClients = make(map[string]*newrelic.NewRelic)
+	}
+	d.accountClients[apiKey] = nrClient
+	return nrClient, nil
+}
+
+// incidentsQuerier returns the function that gives incidents queries the
+// NerdGraph client of the account they query, charged to its query budget.
+func (d *Datasource) incidentsQuerier(config *models.PluginSettings, datasourceUID string) handler.IncidentsQuerierFunc {
+	return func(ctx context.Context, accountID int) (incidents.Querier, error) {
+		return d.graphQLExecutor(config, datasourceUID)(ctx, accountID)
+	}
+}
+
+// graphQLExecutor returns the function that gives nerdgraph queries the
+// NerdGraph client of the account they query, charged to its query budget.
+func (d *Datasource) graphQLExecutor(config *models.PluginSettings, datasourceUID string) handler.GraphQLExecutorFunc {
+	return func(ctx context.Context, accountID int) (nrdbiface.GraphQLExecutor, error) {
+		nrClient, err := d.clientForAccount(ctx, config, datasourceUID, accountID)
+		if err != nil {
+			return nil, err
+		}
+		var executor nrdbiface.GraphQLExecutor = &nrClient.NerdGraph
+		if d.budget != nil {
+			executor = &quota.GraphQLExecutor{Executor: executor, Budget: d.budget, AccountID: accountID}
+		}
+		return executor, nil
+	}
+}
+
+// baseTransport returns the instance's HTTP transport, or nil to use http.DefaultTransport.
+func (d *Datasource) baseTransport() http.RoundTripper {
+	if d.transport == nil {
+		return nil
+	}
+	return d.transport
+}
+
+// sharedClient returns the instance's shared New Relic client, or nil if there is none.
+func (d *Datasource) sharedClient() *newrelic.NewRelic {
+	d.clientMu.RLock()
+	defer d.clientMu.RUnlock()
+	return d.client
+}
+
+// healthContext returns ctx carrying the shared client and API key state for
+// health checks to reuse.
+func (d *Datasource) healthContext(ctx context.Context) context.Context {
+	if d.keys != nil {
+		ctx = health.WithKeyRotation(ctx, d.keys)
+	}
+	nrClient := d.sharedClient()
+	if nrClient == nil {
+		return ctx
+	}
+	return health.WithClient(ctx, nrClient)
+}
+
+// closeClient drops the shared and request clients and closes the idle connections of the
+// instance's transport, which all its clients, shared or per request, send
+// their requests through.
+func (d *Datasource) closeClient() {
+	d.clientMu.Lock()
+	d.client = nil
+	d.accountClients = nil
+	d.idleClients = nil
+	d.clientMu.Unlock()
+	if d.transport != nil {
+		d.transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+)
+
+// TestDatasource_ClientReuse verifies that the New Relic client is created once per
+// instance, reused across requests and dropped on Dispose.
+func TestDatasource_ClientReuse(t *testing.T) {
+	settings := backend.DataSourceInstanceSettings{
+		UID:                     "ds-uid",
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	}
+	instance, err := NewDatasource(context.Background(), settings)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+
+	shared := ds.sharedClient()
+	require.NotNil(t, shared)
+	require.NotNil(t, ds.transport)
+
+	config, err := models.LoadPluginSettings(settings)
+	require.NoError(t, err)
+
+	nrClient, err := ds.clientFor(context.Background(), config, settings.UID)
+	require.NoError(t, err)
+	assert.Same(t, shared, nrClient)
+
+	// Requests with a trace context get a client that propagates it
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	tracedCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	traced, err := ds.clientFor(tracedCtx, config, settings.UID)
+	require.NoError(t, err)
+	assert.NotSame(t, shared, traced)
+
+	// Requests that can be cancelled get a client whose requests are aborted with them
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancellable, err := ds.clientFor(cancelCtx, config, settings.UID)
+	require.NoError(t, err)
+	assert.NotSame(t, shared, cancellable)
+
+	ds.Dispose()
+	assert.Nil(t, ds.sharedClient())
+}
+
+// TestDatasource_ClientReuse_InvalidSettings verifies that an instance with invalid
+// settings has no shared client and creates one per request instead.
+func TestDatasource_ClientReuse_InvalidSettings(t *testing.T) {
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key"},
+	})
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	assert.Nil(t, ds.sharedClient())
+
+	nrClient, err := ds.clientFor(context.Background(), &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 123456},
+	}, "")
+	require.NoError(t, err)
+	assert.NotNil(t, nrClient)
+}
+
+// TestDatasource_RequestClientsReused verifies that requests that can be
+// cancelled reuse the clients of earlier requests instead of creating their own.
+func TestDatasource_RequestClientsReused(t *testing.T) {
+	var created atomic.Int32
+	originalNewFunc := client.NewrelicNewFunc
+	defer func() { client.NewrelicNewFunc = originalNewFunc }()
+	client.NewrelicNewFunc = func(opts ...newrelic.ConfigOption) (*newrelic.NewRelic, error) {
+		created.Add(1)
+		return newrelic.New(opts...)
+	}
+
+	settings := backend.DataSourceInstanceSettings{
+		UID:                     "ds-uid",
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	}
+	instance, err := NewDatasource(context.Background(), settings)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+	require.EqualValues(t, 1, created.Load(), "the shared client")
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := ds.QueryData(ctx, &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+			Queries:       []backend.DataQuery{{RefID: "A", JSON: []byte(`{`)}},
+		})
+		cancel()
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 2, created.Load(), "one request client, reused by the second request")
+	assert.Len(t, ds.idleClients, 1)
+}
+
+// recordingTransport records the context of the requests it receives.
+type recordingTransport struct {
+	ctx context.Context
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.ctx = req.Context()
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+// TestRequestTransport verifies that API requests are sent with the context of
+// the bound request and fail once it is cancelled.
+func TestRequestTransport(t *testing.T) {
+	base := &recordingTransport{}
+	transport := &requestTransport{base: base}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), requestClientsKey{}, "request"))
+	transport.bind(ctx)
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.newrelic.com/graphql", http.NoBody)
+	require.NoError(t, err)
+	_, err = transport.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "request", base.ctx.Value(requestClientsKey{}))
+
+	cancel()
+	_, err = transport.RoundTrip(req)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	transport.bind(nil)
+	_, err = transport.RoundTrip(req)
+	assert.ErrorIs(t, err, errTransportUnbound, "idle transports send no requests")
+}
+
+// TestDatasource_RequestClientsRunningCall verifies that the clients of a
+// cancelled request are only reused once the calls it left running finish.
+func TestDatasource_RequestClientsRunningCall(t *testing.T) {
+	ds := &Datasource{}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, release := ds.bindRequest(ctx)
+	clients, ok := requestClientsFrom(ctx)
+	require.True(t, ok)
+
+	finish := make(chan struct{})
+	cancel()
+	_, err := nrdbiface.UntilDone(ctx, func() (int, error) {
+		<-finish
+		return 0, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	release()
+	assert.Empty(t, ds.idleClients, "a call of the request is still running")
+	assert.NotNil(t, clients.transport.ctx, "the transport stays bound to the cancelled request")
+
+	close(finish)
+	require.Eventually(t, func() bool {
+		ds.clientMu.Lock()
+		defer ds.clientMu.Unlock()
+		return len(ds.idleClients) == 1
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, clients.transport.ctx)
+}
+
+// TestDatasource_IdleClientsBounded verifies that an instance keeps at most
+// maxIdleRequestClients request clients.
+func TestDatasource_IdleClientsBounded(t *testing.T) {
+	ds := &Datasource{}
+	releases := make([]func(), 0, maxIdleRequestClients+10)
+	for i := 0; i < cap(releases); i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, release := ds.bindRequest(ctx)
+		releases = append(releases, release)
+	}
+	for _, release := range releases {
+		release()
+	}
+	assert.Len(t, ds.idleClients, maxIdleRequestClients)
+}
@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// handleCompileResource handles the compile-only resource endpoint, which returns
+// the NRQL the backend builds for a query from the visual query builder, so the
+// editor can preview it. The request body is the builder query as JSON. Nothing
+// is sent to New Relic.
+func (d *Datasource) handleCompileResource(req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	var builder models.QueryBuilder
+	if err := json.Unmarshal(req.Body, &builder); err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid builder query: %v", err)})
+	}
+
+	query, err := handler.CompileQuery(builder)
+	if err != nil {
+		log.DefaultLogger.Debug("Failed to compile builder query", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return sendJSON(sender, http.StatusOK, map[string]string{"query": query})
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDatasource_HandleCompileResource verifies the compile-only resource.
+func TestDatasource_HandleCompileResource(t *testing.T) {
+	send := func(t *testing.T, body string) (*backend.CallResourceResponse, map[string]string) {
+		var captured *backend.CallResourceResponse
+		sender := &mockCallResourceResponseSender{
+			sendFunc: func(resp *backend.CallResourceResponse) error {
+				captured = resp
+				return nil
+			},
+		}
+		req := &backend.CallResourceRequest{Path: "compile-only", Method: http.MethodPost, Body: []byte(body)}
+		require.NoError(t, (&Datasource{}).CallResource(context.Background(), req, sender))
+		require.NotNil(t, captured)
+
+		var decoded map[string]string
+		require.NoError(t, json.Unmarshal(captured.Body, &decoded))
+		return captured, decoded
+	}
+
+	t.Run("compiles the builder query", func(t *testing.T) {
+		resp, body := send(t, `{"select": [{"function": "average", "attribute": "duration"}], "eventType": "Transaction", "facet": ["appName"], "timeseries": "AUTO"}`)
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.Equal(t, "SELECT average(duration) FROM Transaction FACET appName TIMESERIES AUTO", body["query"])
+	})
+
+	t.Run("invalid builder query", func(t *testing.T) {
+		resp, body := send(t, `{"select": [{"function": "sum"}], "eventType": "Transaction"}`)
+		assert.Equal(t, http.StatusBadRequest, resp.Status)
+		assert.Contains(t, body["error"], "sum requires an attribute")
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		resp, body := send(t, `{"select": `)
+		assert.Equal(t, http.StatusBadRequest, resp.Status)
+		assert.Contains(t, body["error"], "invalid builder query")
+	})
+}
@@ -5,19 +5,37 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
+	"newrelic-grafana-plugin/pkg/accountaccess"
+	"newrelic-grafana-plugin/pkg/audit"
+	"newrelic-grafana-plugin/pkg/blackout"
+	"newrelic-grafana-plugin/pkg/cache"
 	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/formatter"
 	"newrelic-grafana-plugin/pkg/handler"
 	"newrelic-grafana-plugin/pkg/health"
+	"newrelic-grafana-plugin/pkg/incidents"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/metrics"
 	"newrelic-grafana-plugin/pkg/models"
 	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/tracing"
 	"newrelic-grafana-plugin/pkg/validator"
+	"newrelic-grafana-plugin/pkg/warmup"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -27,9 +45,40 @@ var (
 	_ instancemgmt.InstanceDisposer = (*Datasource)(nil)
 )
 
+// fromAlertHeader is the request header Grafana sets on queries made by alert rule evaluation.
+const fromAlertHeader = "FromAlert"
+
+// Request headers Grafana sets on queries made by dashboard panels.
+const (
+	dashboardUIDHeader = "X-Dashboard-Uid"
+	panelIDHeader      = "X-Panel-Id"
+)
+
 // Datasource implements the New Relic Grafana datasource plugin.
 // It handles data queries, health checks, and resource management.
-type Datasource struct{}
+type Datasource struct {
+	cache  *cache.Cache   // Query results pre-populated by warm-up queries
+	warmup *warmup.Runner // Scheduled warm-up runner, nil when not configured
+	budget *quota.Budget  // Per-account API call budget, nil when not configured
+	policy *cache.Policy  // Short-lived caching of query results, nil when not configured
+	audit  *audit.Log     // Log of executed queries, nil when not enabled
+
+	suggestions *cache.Cache // Query editor suggestions, by account and event type
+	variables   *cache.Cache // Values of variable queries
+	accessible  *cache.Cache // Accounts each API key can access, checked for queries to other accounts
+	liveQueries *cache.Cache // Live queries streamed over Grafana Live, by channel path
+	entities    *cache.Cache // Entities looked up by GUID, by datasource and GUID
+
+	clientMu       sync.RWMutex
+	client         *newrelic.NewRelic            // Shared New Relic client, nil when the settings are invalid
+	accountClients map[string]*newrelic.NewRelic // Shared clients for named accounts' API keys, by key
+	idleClients    []*requestClients             // Request clients of finished requests, reused by later ones
+	transport      *http.Transport               // HTTP transport shared by the instance's clients
+	keys           *client.KeyRotation           // Active API key of the default account's clients, nil without a secondary key
+
+	startedAt time.Time     // When the instance was created, reported by the status resource
+	stopPurge chan struct{} // Closed to stop purging the caches, nil when not purging
+}
 
 // NewDatasource creates a new instance of the New Relic datasource.
 // It is called by the Grafana plugin SDK when a new datasource instance is needed.
@@ -42,12 +91,130 @@ type Datasource struct{}
 //   - instancemgmt.Instance: The new datasource instance
 //   - error: Any error that occurred during creation
 func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
-	return &Datasource{}, nil
+	ds := &Datasource{cache: cache.New(), suggestions: cache.New(), variables: cache.New(), accessible: cache.New(), liveQueries: cache.New(), entities: cache.New(), startedAt: time.Now()}
+	// Settings are parsed once for every component; invalid settings leave them
+	// unset, and requests then report the configuration error
+	config, err := models.LoadPluginSettings(settings)
+	if err != nil {
+		log.DefaultLogger.Debug("Datasource settings not loaded", "error", err, "datasourceID", settings.ID)
+		config = nil
+	}
+	ds.initClient(ctx, settings, config)
+	ds.budget = loadQueryBudget(config, settings.ID)
+	ds.policy = loadQueryCache(config, settings.ID)
+	ds.audit = loadAuditLog(config)
+	ds.startWarmup(settings, config)
+	ds.startCachePurge()
+	return ds, nil
+}
+
+// loadQueryBudget creates the per-account query budget if the datasource configures
+// one. An invalid budget is logged and leaves budgeting disabled.
+func loadQueryBudget(config *models.PluginSettings, datasourceID int64) *quota.Budget {
+	if config == nil || config.QueryBudget == nil {
+		return nil
+	}
+
+	budget, err := quota.NewBudget(*config.QueryBudget)
+	if err != nil {
+		log.DefaultLogger.Error("Query budget disabled", "error", err, "datasourceID", datasourceID)
+		return nil
+	}
+	return budget
+}
+
+// loadAuditLog creates the audit log if the datasource enables it.
+func loadAuditLog(config *models.PluginSettings) *audit.Log {
+	if config == nil {
+		return nil
+	}
+	return audit.FromSettings(config)
+}
+
+// loadQueryCache creates the query cache policy if the datasource configures one.
+// An invalid configuration is logged and leaves query caching disabled.
+func loadQueryCache(config *models.PluginSettings, datasourceID int64) *cache.Policy {
+	if config == nil || config.QueryCache == nil {
+		return nil
+	}
+
+	policy, err := cache.NewPolicy(*config.QueryCache)
+	if err != nil {
+		log.DefaultLogger.Error("Query cache disabled", "error", err, "datasourceID", datasourceID)
+		return nil
+	}
+	return policy
+}
+
+// startWarmup starts the scheduled warm-up runner if the datasource configures
+// warm-up queries. Configuration problems are logged and leave warm-up disabled,
+// so they never prevent the datasource itself from working.
+func (d *Datasource) startWarmup(settings backend.DataSourceInstanceSettings, config *models.PluginSettings) {
+	if config == nil || config.Warmup == nil {
+		return
+	}
+
+	// Queries run like those of panels, through the same executors, so they are
+	// charged, audited and measured alike and cached under the keys panels use
+	run := func(ctx context.Context, query models.WarmupQuery, ttl time.Duration) error {
+		dataQuery, err := warmupDataQuery(query, time.Now())
+		if err != nil {
+			return err
+		}
+		ctx, release := d.bindRequest(ctx)
+		defer release()
+		nrClient, err := d.clientFor(ctx, config, settings.UID)
+		if err != nil {
+			return fmt.Errorf("failed to create New Relic client: %w", err)
+		}
+		ctx, executor, err := d.queryExecutor(ctx, config, settings.UID, nrClient, "", "")
+		if err != nil {
+			return fmt.Errorf("failed to create New Relic client: %w", err)
+		}
+		executor = &cache.CachingExecutor{Executor: executor, Cache: d.cache, Policy: d.policy}
+		return handler.HandleQuery(cache.WithRefresh(ctx, ttl), executor, config, dataQuery).Error
+	}
+
+	runner, err := warmup.NewRunner(*config.Warmup, run)
+	if err != nil {
+		log.DefaultLogger.Error("Warm-up queries disabled", "error", err, "datasourceID", settings.ID)
+		return
+	}
+	runner.Start()
+	d.warmup = runner
+	log.DefaultLogger.Info("Warm-up queries scheduled", "count", len(config.Warmup.Queries), "datasourceID", settings.ID)
+}
+
+// warmupDataQuery returns the panel query that a warm-up query stands for: its
+// NRQL over its time range ending at now.
+func warmupDataQuery(query models.WarmupQuery, now time.Time) (backend.DataQuery, error) {
+	timeRange, err := warmup.TimeRange(query)
+	if err != nil {
+		return backend.DataQuery{}, err
+	}
+	fields := map[string]interface{}{"queryText": query.QueryText}
+	if query.AccountID > 0 {
+		fields["accountID"] = query.AccountID
+	}
+	queryJSON, err := json.Marshal(fields)
+	if err != nil {
+		return backend.DataQuery{}, err
+	}
+	return backend.DataQuery{
+		RefID:     query.Name,
+		JSON:      queryJSON,
+		TimeRange: backend.TimeRange{From: now.Add(-timeRange), To: now},
+	}, nil
 }
 
 // Dispose cleans up resources when a datasource instance is no longer needed.
 // It is called by the Grafana plugin SDK when a datasource instance is being disposed.
 func (d *Datasource) Dispose() {
+	if d.warmup != nil {
+		d.warmup.Stop()
+	}
+	d.stopCachePurge()
+	d.closeClient()
 	log.DefaultLogger.Debug("New Relic Datasource instance disposed")
 }
 
@@ -60,39 +227,87 @@ func (d *Datasource) Dispose() {
 //
 // Returns:
 //   - *backend.QueryDataResponse: The response containing results for all queries
-//   - error: Any error that occurred during query processing
+//   - error: Always nil; settings and client errors fail each query instead, so a
+//     misconfigured datasource only fails its own panels
 func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	logger := log.DefaultLogger.FromContext(ctx)
 	response := backend.NewQueryDataResponse()
 
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return failQueries(req, configError(errors.New("datasource settings are missing"))), nil
+	}
+
 	// Get datasource UID for service naming
 	datasourceUID := req.PluginContext.DataSourceInstanceSettings.UID
 
+	// The settings choose the span verbosity, so their span is recorded once loaded
+	loadStart := time.Now()
 	config, err := models.LoadPluginSettings(*req.PluginContext.DataSourceInstanceSettings)
 	if err != nil {
+		tracing.Record(ctx, "newrelic.settings.load", loadStart, err)
 		logger.Error("Failed to load plugin settings", "error", err, "datasourceID", req.PluginContext.DataSourceInstanceSettings.ID)
-		return nil, fmt.Errorf("failed to load plugin settings: %w", err)
+		return failQueries(req, configError(fmt.Errorf("failed to load plugin settings: %w", err))), nil
 	}
+	ctx = tracing.WithVerbosity(ctx, config.TraceVerbosity)
 
-	if err := validator.ValidatePluginSettings(config); err != nil {
+	err = validator.ValidatePluginSettings(config)
+	tracing.Record(ctx, "newrelic.settings.load", loadStart, err)
+	if err != nil {
 		logger.Error("Invalid plugin configuration", "error", err, "datasourceID", req.PluginContext.DataSourceInstanceSettings.ID)
-		return nil, fmt.Errorf("invalid plugin configuration: %w", err)
+		return failQueries(req, configError(fmt.Errorf("invalid plugin configuration: %w", err))), nil
 	}
 
-	// Create a client config
-	clientConfig := client.DefaultConfig()
-	clientConfig.APIKey = config.Secrets.ApiKey
-	clientConfig.DatasourceUID = datasourceUID // Set the datasource UID for unique service name
-
-	// Create New Relic client using the new method
-	nrClient, err := client.NewClient(clientConfig)
+	// Reuse the instance's New Relic clients, bound to this request
+	ctx, release := d.bindRequest(ctx)
+	defer release()
+	_, clientSpan := tracing.Start(ctx, "newrelic.client.create")
+	nrClient, err := d.clientFor(ctx, config, datasourceUID)
 	if err != nil {
+		tracing.End(clientSpan, err)
 		logger.Error("Failed to create New Relic client", "error", err, "datasourceID", req.PluginContext.DataSourceInstanceSettings.ID)
-		return nil, fmt.Errorf("failed to create New Relic client: %w", err)
+		return failQueries(req, pluginError(fmt.Errorf("failed to create New Relic client: %w", err))), nil
+	}
+
+	ctx, executor, err := d.queryExecutor(ctx, config, datasourceUID, nrClient, req.GetHTTPHeader(dashboardUIDHeader), req.GetHTTPHeader(panelIDHeader))
+	tracing.End(clientSpan, err)
+	if err != nil {
+		logger.Error("Failed to create New Relic client for named account", "error", err, "datasourceID", req.PluginContext.DataSourceInstanceSettings.ID)
+		return failQueries(req, pluginError(fmt.Errorf("failed to create New Relic client: %w", err))), nil
+	}
+	if d.cache != nil {
+		// Serve results pre-populated by warm-up queries and, with a cache policy,
+		// results of recent identical queries
+		executor = &cache.CachingExecutor{Executor: executor, Cache: d.cache, Policy: d.policy}
+	}
+
+	incidentsQuerier := d.incidentsQuerier(config, datasourceUID)
+	entitySearcher := d.entitySearcher(config, datasourceUID)
+	graphQLExecutor := d.graphQLExecutor(config, datasourceUID)
+	variableSources := d.variableSources(config, datasourceUID)
+
+	// During a blackout window, only serve cached results and tell the user why.
+	// Query types without cached results fail without reaching New Relic.
+	window, blackoutActive := activeBlackout(config, time.Now())
+	if blackoutActive {
+		logger.Info("Blackout window active, serving cached results only", "until", window.End, "reason", window.Reason, "datasourceID", req.PluginContext.DataSourceInstanceSettings.ID)
+		ctx = cache.WithStaleOnly(ctx)
+		incidentsQuerier = func(context.Context, int) (incidents.Querier, error) { return nil, cache.ErrNotCached }
+		entitySearcher = func(context.Context, int) (entitysearch.Searcher, error) { return nil, cache.ErrNotCached }
+		graphQLExecutor = func(context.Context, int) (nrdbiface.GraphQLExecutor, error) { return nil, cache.ErrNotCached }
+		variableSources = func(context.Context, int) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister, error) {
+			return nil, nil, cache.ErrNotCached
+		}
 	}
+	entityLookup := d.entityLookup(config, datasourceUID, entitySearcher)
+
+	// Alert rule evaluation only accepts time series, so drop table frames from its responses
+	fromAlert := req.Headers[fromAlertHeader] == "true"
 
-	// Create the executor wrapper for the real client
-	executor := &nrdbiface.RealNRDBExecutor{NRDB: nrClient.Nrdb}
+	// Responses over the payload budget are downsampled or truncated before they reach the browser
+	maxResponseBytes := config.MaxResponseBytes
+	if maxResponseBytes == 0 {
+		maxResponseBytes = formatter.DefaultMaxResponseBytes
+	}
 
 	// Process queries concurrently using a worker pool
 	queryResults := make(chan struct {
@@ -102,7 +317,43 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 
 	for _, q := range req.Queries {
 		go func(query backend.DataQuery) {
-			res := handler.HandleQuery(ctx, executor, config, query)
+			queryCtx, budgetReport := quota.WithReport(ctx)
+			queryCtx = handler.WithEntityLookup(queryCtx, entityLookup)
+			queryCtx, span := tracing.Start(queryCtx, "newrelic.query", attribute.String("refId", query.RefID), attribute.String("queryType", query.QueryType))
+			var res *backend.DataResponse
+			switch query.QueryType {
+			case models.QueryTypeIncidents:
+				res = handler.HandleIncidentsQuery(queryCtx, incidentsQuerier, config, query)
+			case models.QueryTypeEntities:
+				res = handler.HandleEntitiesQuery(queryCtx, entitySearcher, config, query)
+			case models.QueryTypeNerdGraph:
+				res = handler.HandleNerdGraphQuery(queryCtx, graphQLExecutor, config, query)
+			case models.QueryTypeUsage:
+				res = handler.HandleUsageQuery(queryCtx, executor, config, query)
+			case models.QueryTypeVariable:
+				res = handler.HandleVariableQuery(queryCtx, variableSources, d.variables, config, query)
+			default:
+				res = handler.HandleQuery(queryCtx, executor, config, query)
+			}
+			metrics.ObserveQuery(query.QueryType, res.Error)
+			tracing.End(span, res.Error)
+			if fromAlert {
+				formatter.KeepTimeSeriesFrames(res)
+			} else {
+				d.attachLiveChannel(ctx, datasourceUID, query, res)
+			}
+			size := formatter.ApplyPayloadBudget(res, maxResponseBytes, config.PayloadDownsample)
+			logger.Debug("Query response size", "refId", query.RefID, "estimatedBytes", size, "budgetBytes", maxResponseBytes)
+			if notice, ok := budgetReport.Notice(); ok {
+				formatter.AppendNotices(res, notice)
+			}
+			if blackoutActive {
+				if errors.Is(res.Error, cache.ErrNotCached) {
+					res.Error = fmt.Errorf("%s: %w", window.Describe(), res.Error)
+					res.Status, res.ErrorSource = backend.StatusBadGateway, backend.ErrorSourceDownstream
+				}
+				formatter.AppendNotices(res, data.Notice{Severity: data.NoticeSeverityWarning, Text: window.Notice()})
+			}
 			queryResults <- struct {
 				refID string
 				res   backend.DataResponse
@@ -119,6 +370,79 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 	return response, nil
 }
 
+// queryExecutor returns the executor NRQL queries of a request run through: it
+// routes queries for named accounts to their clients, checks the API key can
+// access each query's account, records metrics and, when enabled, audits the
+// queries of the dashboard panel and charges the account budget. The returned
+// context carries the audit source.
+func (d *Datasource) queryExecutor(ctx context.Context, config *models.PluginSettings, datasourceUID string, nrClient *newrelic.NewRelic, dashboardUID, panelID string) (context.Context, nrdbiface.NRDBQueryExecutor, error) {
+	// Route queries for named accounts with their own API key to their clients
+	executor, err := d.accountExecutor(ctx, config, datasourceUID, &nrdbiface.RealNRDBExecutor{NRDB: nrClient.Nrdb})
+	if err != nil {
+		return ctx, nil, err
+	}
+	// Reject queries to accounts the API key cannot access with an error naming
+	// the account, rather than NRDB's generic authorization failure
+	executor = &accountaccess.Executor{
+		Executor:         executor,
+		Cache:            d.accessible,
+		Listers:          d.accountListers(config, datasourceUID),
+		DefaultAccountID: config.Secrets.AccountId,
+	}
+	// Record the latency of the requests sent to New Relic
+	executor = &metrics.Executor{Executor: executor}
+	if d.audit != nil {
+		// Record the queries sent to New Relic, and the dashboard panels making them
+		executor = &audit.Executor{Executor: executor, Log: d.audit}
+		ctx = audit.WithSource(ctx, audit.Source{
+			DatasourceUID: datasourceUID,
+			DashboardUID:  dashboardUID,
+			PanelID:       panelID,
+		})
+	}
+	if d.budget != nil {
+		// Charge API calls to the account budget; cache hits are free
+		executor = &quota.Executor{Executor: executor, Budget: d.budget}
+	}
+	return ctx, executor, nil
+}
+
+// failQueries returns a response failing every query of req with resp. Grafana
+// shows an error returned by QueryData on every panel of the dashboard, so
+// failures affecting the whole request are reported per query instead.
+func failQueries(req *backend.QueryDataRequest, resp backend.DataResponse) *backend.QueryDataResponse {
+	response := backend.NewQueryDataResponse()
+	for _, query := range req.Queries {
+		response.Responses[query.RefID] = resp
+	}
+	return response
+}
+
+// configError returns the response for queries to a datasource whose settings
+// are missing or invalid, which the user has to fix.
+func configError(err error) backend.DataResponse {
+	return backend.DataResponse{Error: err, Status: backend.StatusBadRequest, ErrorSource: backend.ErrorSourceDownstream}
+}
+
+// pluginError returns the response for queries failed by the plugin itself.
+func pluginError(err error) backend.DataResponse {
+	return backend.DataResponse{Error: err, Status: backend.StatusInternal, ErrorSource: backend.ErrorSourcePlugin}
+}
+
+// activeBlackout returns the configured blackout window containing now.
+// Invalid windows are logged and ignored so they never block querying.
+func activeBlackout(config *models.PluginSettings, now time.Time) (blackout.Window, bool) {
+	if len(config.BlackoutWindows) == 0 {
+		return blackout.Window{}, false
+	}
+	windows, err := blackout.ParseWindows(config.BlackoutWindows)
+	if err != nil {
+		log.DefaultLogger.Error("Ignoring blackout windows", "error", err)
+		return blackout.Window{}, false
+	}
+	return blackout.Active(windows, now)
+}
+
 // CheckHealth performs a health check of the datasource.
 // It validates the configuration and tests the connection to New Relic.
 //
@@ -134,7 +458,7 @@ func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRe
 
 	// Delegate the comprehensive health check to the 'health' package.
 	// We pass the context and the raw DataSourceInstanceSettings.
-	healthResult, err := health.ExecuteHealthCheck(ctx, *req.PluginContext.DataSourceInstanceSettings)
+	healthResult, err := health.ExecuteHealthCheck(d.healthContext(ctx), *req.PluginContext.DataSourceInstanceSettings)
 	if err != nil {
 		// Log the unexpected error from the health package for debugging purposes.
 		log.DefaultLogger.Error("Datasource.CheckHealth: Health check failed internally", "error", err)
@@ -162,10 +486,36 @@ func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRe
 //   - error: Any error that occurred during resource processing
 func (d *Datasource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
 	log.DefaultLogger.Debug("Datasource.CallResource: Handling resource request", "path", req.Path)
+	ctx, release := d.bindRequest(ctx)
+	defer release()
 
 	switch req.Path {
 	case "health":
 		return d.handleHealthResource(ctx, req, sender)
+	case "metrics":
+		return d.handleMetricsResource(sender)
+	case "status":
+		return d.handleStatusResource(req, sender)
+	case "event-types", "attributes", "accounts", "metrics-metadata":
+		return d.handleMetadataResource(ctx, req, sender)
+	case "configured-accounts":
+		return d.handleConfiguredAccountsResource(req, sender)
+	case "diagnostics":
+		return d.handleDiagnosticsResource(ctx, req, sender)
+	case "validate-query":
+		return d.handleValidateQueryResource(ctx, req, sender)
+	case "compile-only":
+		return d.handleCompileResource(req, sender)
+	case "time-window":
+		return d.handleTimeWindowResource(req, sender)
+	case "suggestions":
+		return d.handleSuggestionsResource(ctx, req, sender)
+	case "entities":
+		return d.handleEntitiesResource(ctx, req, sender)
+	case "query-stats":
+		return d.handleQueryStatsResource(sender)
+	case "export":
+		return d.handleExportResource(ctx, req, sender)
 	default:
 		return sender.Send(&backend.CallResourceResponse{
 			Status: http.StatusNotFound,
@@ -174,10 +524,19 @@ func (d *Datasource) CallResource(ctx context.Context, req *backend.CallResource
 	}
 }
 
+// handleQueryStatsResource handles the query-stats resource endpoint, which
+// returns the recent queries of the audit log and their totals by dashboard.
+func (d *Datasource) handleQueryStatsResource(sender backend.CallResourceResponseSender) error {
+	if d.audit == nil {
+		return sendJSON(sender, http.StatusNotFound, map[string]string{"error": "audit logging is not enabled for this datasource"})
+	}
+	return sendJSON(sender, http.StatusOK, d.audit.Stats())
+}
+
 // handleHealthResource handles the /health resource endpoint
 func (d *Datasource) handleHealthResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
 	// Call the same health check logic used by CheckHealth
-	healthResult, err := health.ExecuteHealthCheck(ctx, *req.PluginContext.DataSourceInstanceSettings)
+	healthResult, err := health.ExecuteHealthCheck(d.healthContext(ctx), *req.PluginContext.DataSourceInstanceSettings)
 	if err != nil {
 		log.DefaultLogger.Error("Resource health check failed internally", "error", err)
 		// Return 200 with error details instead of 500 to avoid browser popups
@@ -200,6 +559,10 @@ func (d *Datasource) handleHealthResource(ctx context.Context, req *backend.Call
 		"status":  healthResult.Status.String(),
 		"message": healthResult.Message,
 	}
+	if len(healthResult.JSONDetails) > 0 {
+		// Diagnostics of a failed check
+		response["details"] = json.RawMessage(healthResult.JSONDetails)
+	}
 
 	responseBody, err := json.Marshal(response)
 	if err != nil {
@@ -227,3 +590,24 @@ func (d *Datasource) handleHealthResource(ctx context.Context, req *backend.Call
 		},
 	})
 }
+
+// handleMetricsResource handles the /metrics resource endpoint, returning the
+// plugin query metrics and warm-up run statistics as JSON
+func (d *Datasource) handleMetricsResource(sender backend.CallResourceResponseSender) error {
+	responseBody, err := json.Marshal(metrics.GetMetrics())
+	if err != nil {
+		log.DefaultLogger.Error("Failed to marshal metrics response", "error", err)
+		return sender.Send(&backend.CallResourceResponse{
+			Status: http.StatusInternalServerError,
+			Body:   []byte(`{"error": "Failed to process metrics"}`),
+		})
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   responseBody,
+		Headers: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+	})
+}
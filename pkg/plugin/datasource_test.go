@@ -5,15 +5,29 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"newrelic-grafana-plugin/pkg/audit"
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/client"
 	"newrelic-grafana-plugin/pkg/health"
+	"newrelic-grafana-plugin/pkg/metrics"
 	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface/mocknrdb"
+	"newrelic-grafana-plugin/pkg/quota"
 )
 
 // TestNewDatasource ensures that a new Datasource instance can be created.
@@ -23,6 +37,122 @@ func TestNewDatasource(t *testing.T) {
 	assert.NotNil(t, ds)
 }
 
+// TestNewDatasource_LoadsSettingsOnce verifies that the settings are parsed once
+// and given to every component of the instance.
+func TestNewDatasource_LoadsSettingsOnce(t *testing.T) {
+	loads := 0
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		loads++
+		return originalLoadPluginSettings(settings)
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{
+			"queryBudget": {"hardLimit": 10},
+			"queryCache": {"ttl": "30s"},
+			"auditLog": {"enabled": true},
+			"warmup": {"interval": "5m", "queries": [{"queryText": "SELECT 1"}]}
+		}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0", "accountID": "123456"},
+	})
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	assert.Equal(t, 1, loads)
+	assert.NotNil(t, ds.client)
+	assert.NotNil(t, ds.budget)
+	assert.NotNil(t, ds.policy)
+	assert.NotNil(t, ds.audit)
+	assert.NotNil(t, ds.warmup)
+}
+
+// mockedDatasource returns a datasource instance for settings whose clients
+// query server instead of New Relic.
+func mockedDatasource(t *testing.T, settings backend.DataSourceInstanceSettings, server *mocknrdb.Server) *Datasource {
+	t.Helper()
+	instance, err := NewDatasource(context.Background(), settings)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	t.Cleanup(ds.Dispose)
+
+	ds.clientMu.Lock()
+	ds.transport = server.Transport()
+	ds.client, err = newRelicClient(mustLoadSettings(t, settings), settings.UID, ds.transport, ds.keys)
+	ds.clientMu.Unlock()
+	require.NoError(t, err)
+	return ds
+}
+
+func mustLoadSettings(t *testing.T, settings backend.DataSourceInstanceSettings) *models.PluginSettings {
+	t.Helper()
+	config, err := models.LoadPluginSettings(settings)
+	require.NoError(t, err)
+	return config
+}
+
+// TestDatasource_QueryData_MockNerdGraph runs queries end to end, from the
+// query JSON through the New Relic client to the frames, against recorded
+// NerdGraph responses.
+func TestDatasource_QueryData_MockNerdGraph(t *testing.T) {
+	server := mocknrdb.NewServer(
+		mocknrdb.Fixture{
+			AccountID: 123456,
+			NRQL:      "SELECT count(*) FROM Transaction",
+			Result:    []byte(`{"results":[{"count":1523}],"metadata":{"eventTypes":["Transaction"]}}`),
+		},
+		mocknrdb.Fixture{
+			AccountID: 123456,
+			NRQL:      "SELECT count(*) FROM Transaction FACET appName",
+			Result: []byte(`{"results":[
+				{"facet":"checkout","appName":"checkout","count":912},
+				{"facet":"billing","appName":"billing","count":611}
+			],"metadata":{"eventTypes":["Transaction"],"facets":["appName"]}}`),
+		},
+	)
+	defer server.Close()
+	settings := backend.DataSourceInstanceSettings{
+		UID:                     "mock-uid",
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	}
+	ds := mockedDatasource(t, settings, server)
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`)},
+			{RefID: "B", JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction FACET appName"}`)},
+			{RefID: "C", JSON: []byte(`{"queryText":"SELECT count(*) FROM PageView"}`)},
+		},
+	})
+	require.NoError(t, err)
+
+	a := resp.Responses["A"]
+	require.NoError(t, a.Error)
+	require.NotEmpty(t, a.Frames)
+	count := a.Frames[0].Fields[len(a.Frames[0].Fields)-1]
+	value, err := count.FloatAt(0)
+	require.NoError(t, err)
+	assert.Equal(t, 1523.0, value)
+
+	b := resp.Responses["B"]
+	require.NoError(t, b.Error)
+	require.Len(t, b.Frames, 2, "a frame per facet")
+	assert.Equal(t, "checkout", b.Frames[0].Fields[1].Labels["appName"])
+
+	require.Error(t, resp.Responses["C"].Error, "queries without a recorded response fail")
+
+	requests := server.Requests()
+	require.Len(t, requests, 3)
+	for _, req := range requests {
+		assert.Equal(t, 123456, req.AccountID)
+		assert.Equal(t, "test-api-key", req.APIKey)
+	}
+}
+
 // TestDatasource_Dispose ensures the Dispose method runs without errors or panics.
 func TestDatasource_Dispose(t *testing.T) {
 	ds := &Datasource{}
@@ -492,6 +622,192 @@ func TestDatasource_HandleHealthResource_InternalError(t *testing.T) {
 	assert.Contains(t, response["message"], "Internal health check error")
 }
 
+// TestDatasource_HandleMetricsResource verifies the metrics resource returns warm-up statistics as JSON.
+func TestDatasource_HandleMetricsResource(t *testing.T) {
+	metrics.ResetMetrics()
+	defer metrics.ResetMetrics()
+	metrics.RecordWarmup("revenue", time.Second, nil)
+
+	ds := &Datasource{}
+	var capturedResponse *backend.CallResourceResponse
+	sender := &mockCallResourceResponseSender{
+		sendFunc: func(resp *backend.CallResourceResponse) error {
+			capturedResponse = resp
+			return nil
+		},
+	}
+
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "metrics"}, sender)
+	require.NoError(t, err)
+
+	require.NotNil(t, capturedResponse)
+	assert.Equal(t, http.StatusOK, capturedResponse.Status)
+
+	var response metrics.Metrics
+	require.NoError(t, json.Unmarshal(capturedResponse.Body, &response))
+	assert.Equal(t, uint64(1), response.Warmups["revenue"].Runs)
+}
+
+// TestNewDatasource_InvalidWarmup ensures an invalid warm-up configuration does not prevent creation.
+func TestNewDatasource_InvalidWarmup(t *testing.T) {
+	ds, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"warmup": {"interval": "soon", "queries": [{"queryText": "SELECT 1"}]}}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, ds.(*Datasource).warmup)
+	ds.(*Datasource).Dispose()
+}
+
+// TestDatasource_WarmupServesPanelQueries verifies that warm-up queries run
+// through the query executors and cache their results under the keys of the
+// panel queries they stand for.
+func TestDatasource_WarmupServesPanelQueries(t *testing.T) {
+	var nrqlRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(string(body), "accounts") {
+			_, _ = w.Write([]byte(`{"data":{"actor":{"accounts":[{"id":123456,"name":"Main"}]}}}`))
+			return
+		}
+		nrqlRequests.Add(1)
+		_, _ = w.Write([]byte(`{"data":{"actor":{"account":{"nrql":{"results":[{"count":42}]}}}}}`))
+	}))
+	defer server.Close()
+
+	originalNewFunc := client.NewrelicNewFunc
+	defer func() { client.NewrelicNewFunc = originalNewFunc }()
+	client.NewrelicNewFunc = func(opts ...newrelic.ConfigOption) (*newrelic.NewRelic, error) {
+		return newrelic.New(append(opts, newrelic.ConfigNerdGraphBaseURL(server.URL))...)
+	}
+
+	settings := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{
+			"warmup": {"interval": "1h", "queries": [{"name": "tx", "queryText": "SELECT count(*) FROM Transaction", "timeRange": "1h"}]},
+			"queryCache": {"ttl": "5m", "timeBucket": "1h"},
+			"queryBudget": {"hardLimit": 100}
+		}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	}
+	instance, err := NewDatasource(context.Background(), settings)
+	require.NoError(t, err)
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+	require.NotNil(t, ds.warmup)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds.warmup.RunOnce(ctx)
+	require.EqualValues(t, 1, nrqlRequests.Load())
+	assert.Positive(t, ds.budget.Stats().Calls[123456], "warm-up queries are charged to the budget")
+
+	now := time.Now()
+	res, err := ds.QueryData(ctx, &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: &settings},
+		Queries: []backend.DataQuery{{
+			RefID:     "A",
+			JSON:      []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`),
+			TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, res.Responses["A"].Error)
+	assert.EqualValues(t, 1, nrqlRequests.Load(), "the panel query is served from the warmed cache")
+}
+
+// TestDatasource_QueryData_Blackout verifies that queries are served from cache during a blackout window.
+func TestDatasource_QueryData_Blackout(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			BlackoutWindows: []models.BlackoutWindow{{
+				Start:  time.Now().Add(-time.Hour).Format(time.RFC3339),
+				End:    time.Now().Add(time.Hour).Format(time.RFC3339),
+				Reason: "NR maintenance",
+			}},
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	ds := &Datasource{cache: cache.New()}
+	ds.cache.Retain(cache.Key("standard", 12345, "SELECT count(*) FROM Transaction"), &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"count": float64(42)}},
+	})
+
+	req := &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "cached", JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`)},
+			{RefID: "uncached", JSON: []byte(`{"queryText":"SELECT count(*) FROM PageView"}`)},
+		},
+	}
+
+	res, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	cached := res.Responses["cached"]
+	require.NoError(t, cached.Error)
+	require.NotEmpty(t, cached.Frames)
+	require.NotNil(t, cached.Frames[0].Meta)
+	require.Len(t, cached.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, cached.Frames[0].Meta.Notices[0].Text, "NR maintenance")
+
+	uncached := res.Responses["uncached"]
+	require.Error(t, uncached.Error)
+	assert.ErrorIs(t, uncached.Error, cache.ErrNotCached)
+	assert.Contains(t, uncached.Error.Error(), "New Relic querying is paused until")
+}
+
+// TestDatasource_QueryData_BlackoutAllQueryTypes verifies that no query type
+// reaches New Relic during a blackout window, and that cached variable values
+// are still served.
+func TestDatasource_QueryData_BlackoutAllQueryTypes(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			BlackoutWindows: []models.BlackoutWindow{{
+				Start: time.Now().Add(-time.Hour).Format(time.RFC3339),
+				End:   time.Now().Add(time.Hour).Format(time.RFC3339),
+			}},
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	ds := &Datasource{cache: cache.New(), variables: cache.New()}
+	ds.variables.Set("variable|accounts|12345||", []string{"12345"}, time.Minute)
+
+	req := &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "incidents", QueryType: models.QueryTypeIncidents, JSON: []byte(`{}`)},
+			{RefID: "entities", QueryType: models.QueryTypeEntities, JSON: []byte(`{"queryText":"name = 'checkout'"}`)},
+			{RefID: "nerdgraph", QueryType: models.QueryTypeNerdGraph, JSON: []byte(`{"queryText":"{ actor { user { name } } }"}`)},
+			{RefID: "eventTypes", QueryType: models.QueryTypeVariable, JSON: []byte(`{"variableType":"eventTypes"}`)},
+			{RefID: "accounts", QueryType: models.QueryTypeVariable, JSON: []byte(`{"variableType":"accounts"}`)},
+		},
+	}
+
+	res, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	for _, refID := range []string{"incidents", "entities", "nerdgraph", "eventTypes"} {
+		response := res.Responses[refID]
+		assert.ErrorIs(t, response.Error, cache.ErrNotCached, refID)
+		assert.Equal(t, backend.ErrorSourceDownstream, response.ErrorSource, refID)
+	}
+	accounts := res.Responses["accounts"]
+	require.NoError(t, accounts.Error)
+	require.Len(t, accounts.Frames, 1)
+	assert.Equal(t, "12345", accounts.Frames[0].Fields[0].At(0))
+}
+
 // Additional tests from datasource_additional_test.go
 
 // TestDatasource_QueryData_InvalidSettings_Main tests handling invalid settings (renamed to avoid redeclaration)
@@ -517,9 +833,37 @@ func TestDatasource_QueryData_InvalidSettings_Main(t *testing.T) {
 		},
 	)
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to load plugin settings")
-	assert.Nil(t, resp)
+	require.NoError(t, err, "settings errors fail the queries, not the request")
+	require.Error(t, resp.Responses["A"].Error)
+	assert.Contains(t, resp.Responses["A"].Error.Error(), "failed to load plugin settings")
+}
+
+func TestDatasource_QueryData_SettingsErrorPerQuery(t *testing.T) {
+	ds := &Datasource{}
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{JSONData: []byte(`{}`)},
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`)},
+			{RefID: "B", JSON: []byte(`{"queryText":"SELECT count(*) FROM PageView"}`)},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Responses, 2)
+	for _, refID := range []string{"A", "B"} {
+		r := resp.Responses[refID]
+		require.Error(t, r.Error, refID)
+		assert.Contains(t, r.Error.Error(), "failed to load plugin settings")
+		assert.Equal(t, backend.StatusBadRequest, r.Status)
+		assert.Equal(t, backend.ErrorSourceDownstream, r.ErrorSource)
+	}
+
+	resp, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{{RefID: "A"}},
+	})
+	require.NoError(t, err, "missing datasource settings fail the queries")
+	require.Error(t, resp.Responses["A"].Error)
 }
 
 // TestDatasource_QueryData_InvalidQuery tests handling an invalid query
@@ -657,10 +1001,11 @@ func TestDatasource_QueryData_Error_Main(t *testing.T) {
 				},
 			}
 
-			// Call QueryData and check for expected error
-			_, err := ds.QueryData(context.Background(), req)
-			assert.Error(t, err)
-			assert.Contains(t, err.Error(), tt.expectErrContains)
+			// Call QueryData and check for expected error on the query
+			resp, err := ds.QueryData(context.Background(), req)
+			require.NoError(t, err)
+			require.Error(t, resp.Responses["A"].Error)
+			assert.Contains(t, resp.Responses["A"].Error.Error(), tt.expectErrContains)
 		})
 	}
 }
@@ -772,3 +1117,206 @@ func TestDatasource_QueryData_WithUID(t *testing.T) {
 	// Key verification: the UID was present in the request
 	assert.Equal(t, testUID, req.PluginContext.DataSourceInstanceSettings.UID)
 }
+
+// TestDatasource_QueryData_QueryBudget verifies that the hard limit rejects queries
+// once an account's budget is spent, while cached results stay available.
+func TestDatasource_QueryData_QueryBudget(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	budget, err := quota.NewBudget(models.QueryBudgetSettings{Window: "1h", HardLimit: 1})
+	require.NoError(t, err)
+	_, err = budget.Reserve(12345)
+	require.NoError(t, err)
+
+	ds := &Datasource{cache: cache.New(), budget: budget}
+	ds.cache.Set(cache.Key("standard", 12345, "SELECT count(*) FROM Transaction"), &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"count": float64(42)}},
+	}, time.Hour)
+
+	req := &backend.QueryDataRequest{
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "cached", JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`)},
+			{RefID: "uncached", JSON: []byte(`{"queryText":"SELECT count(*) FROM PageView"}`)},
+		},
+	}
+
+	res, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+
+	require.NoError(t, res.Responses["cached"].Error)
+
+	uncached := res.Responses["uncached"]
+	require.Error(t, uncached.Error)
+	var exceeded *quota.ExceededError
+	assert.ErrorAs(t, uncached.Error, &exceeded)
+}
+
+// TestNewDatasource_InvalidQueryBudget ensures an invalid budget leaves budgeting disabled.
+func TestNewDatasource_InvalidQueryBudget(t *testing.T) {
+	ds, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"queryBudget": {"window": "1m"}}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, ds.(*Datasource).budget)
+	ds.(*Datasource).Dispose()
+}
+
+// TestNewDatasource_QueryCache ensures the query cache policy is loaded from the
+// settings and that an invalid one leaves query caching disabled.
+func TestNewDatasource_QueryCache(t *testing.T) {
+	secrets := map[string]string{"apiKey": "test-api-key", "accountID": "123456"}
+
+	ds, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"queryCache": {"ttl": "30s", "timeBucket": "1m"}}`),
+		DecryptedSecureJSONData: secrets,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cache.Policy{TTL: 30 * time.Second, Bucket: time.Minute}, ds.(*Datasource).policy)
+	ds.(*Datasource).Dispose()
+
+	ds, err = NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData:                []byte(`{"queryCache": {"timeBucket": "1m"}}`),
+		DecryptedSecureJSONData: secrets,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, ds.(*Datasource).policy)
+	ds.(*Datasource).Dispose()
+}
+
+// TestDatasource_HandleStatusResource verifies the status resource reports flags,
+// statistics and the effective settings without exposing the API key.
+func TestDatasource_HandleStatusResource(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			StrictQueryParsing: true,
+			QueryBudget:        &models.QueryBudgetSettings{HardLimit: 10},
+			Secrets:            &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	budget, err := quota.NewBudget(models.QueryBudgetSettings{HardLimit: 10})
+	require.NoError(t, err)
+	_, err = budget.Reserve(12345)
+	require.NoError(t, err)
+	ds := &Datasource{cache: cache.New(), budget: budget, startedAt: time.Now().Add(-time.Hour)}
+
+	var capturedResponse *backend.CallResourceResponse
+	sender := &mockCallResourceResponseSender{
+		sendFunc: func(resp *backend.CallResourceResponse) error {
+			capturedResponse = resp
+			return nil
+		},
+	}
+	req := &backend.CallResourceRequest{
+		Path: "status",
+		PluginContext: backend.PluginContext{
+			PluginVersion:              "1.2.3",
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+		},
+	}
+
+	require.NoError(t, ds.CallResource(context.Background(), req, sender))
+	require.NotNil(t, capturedResponse)
+	assert.Equal(t, http.StatusOK, capturedResponse.Status)
+	assert.NotContains(t, string(capturedResponse.Body), "test-api-key")
+
+	var status Status
+	require.NoError(t, json.Unmarshal(capturedResponse.Body, &status))
+	assert.Equal(t, "1.2.3", status.PluginVersion)
+	assert.Equal(t, "1h0m0s", status.Uptime)
+	assert.True(t, status.FeatureFlags["strictQueryParsing"])
+	assert.True(t, status.FeatureFlags["queryBudget"])
+	assert.False(t, status.FeatureFlags["warmup"])
+	require.NotNil(t, status.Settings)
+	assert.Equal(t, redactedValue, status.Settings.APIKey)
+	assert.Equal(t, 12345, status.Settings.AccountID)
+	require.NotNil(t, status.Cache)
+	require.NotNil(t, status.QueryBudget)
+	assert.Equal(t, map[int]int{12345: 1}, status.QueryBudget.Calls)
+}
+
+// TestDatasource_HandleQueryStatsResource verifies the query-stats resource
+// returns the audit log, and is not found when audit logging is disabled.
+func TestDatasource_HandleQueryStatsResource(t *testing.T) {
+	send := func(t *testing.T, ds *Datasource) *backend.CallResourceResponse {
+		var capturedResponse *backend.CallResourceResponse
+		sender := &mockCallResourceResponseSender{
+			sendFunc: func(resp *backend.CallResourceResponse) error {
+				capturedResponse = resp
+				return nil
+			},
+		}
+		require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "query-stats"}, sender))
+		require.NotNil(t, capturedResponse)
+		return capturedResponse
+	}
+
+	resp := send(t, &Datasource{})
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+
+	ds := &Datasource{audit: audit.NewLog(10)}
+	ds.audit.Record(audit.Entry{Query: "SELECT count(*) FROM Transaction", AccountID: 12345, DashboardUID: "dash-1", DurationMs: 120, Rows: 1})
+	resp = send(t, ds)
+	assert.Equal(t, http.StatusOK, resp.Status)
+
+	var stats audit.Stats
+	require.NoError(t, json.Unmarshal(resp.Body, &stats))
+	require.Len(t, stats.Queries, 1)
+	assert.Equal(t, "SELECT count(*) FROM Transaction", stats.Queries[0].Query)
+	assert.Equal(t, []audit.DashboardStats{{DashboardUID: "dash-1", Queries: 1, Rows: 1, TotalDurationMs: 120, MaxDurationMs: 120}}, stats.Dashboards)
+}
+
+// TestDatasource_QueryData_FromAlert verifies alert rule queries only get time series frames.
+func TestDatasource_QueryData_FromAlert(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	ds := &Datasource{cache: cache.New()}
+	ds.cache.Set(cache.Key("standard", 12345, "SELECT count(*) FROM Transaction"), &nrdb.NRDBResultContainer{
+		Results: []nrdb.NRDBResult{{"count": float64(42)}},
+	}, time.Hour)
+
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		frames  int
+	}{
+		{name: "dashboard", frames: 2},
+		{name: "alert", headers: map[string]string{fromAlertHeader: "true"}, frames: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+				PluginContext: backend.PluginContext{
+					DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+				},
+				Headers: tc.headers,
+				Queries: []backend.DataQuery{
+					{RefID: "A", JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`)},
+				},
+			})
+			require.NoError(t, err)
+
+			resp := res.Responses["A"]
+			require.NoError(t, resp.Error)
+			require.Len(t, resp.Frames, tc.frames)
+			assert.Equal(t, data.FrameTypeTimeSeriesMulti, resp.Frames[tc.frames-1].Meta.Type)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/health"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// handleDiagnosticsResource handles the diagnostics resource endpoint, which
+// probes the ingest freshness of each kind of telemetry in the default account
+// and every named account, so operators can see at a glance which telemetry
+// the configured API keys can read.
+func (d *Datasource) handleDiagnosticsResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+	settings := *req.PluginContext.DataSourceInstanceSettings
+
+	config, err := models.LoadPluginSettings(settings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Diagnostics request with invalid configuration", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+
+	targets := []health.ProbeTarget{{Name: defaultAccountName, AccountID: config.Secrets.AccountId}}
+	for _, account := range config.Secrets.Accounts {
+		targets = append(targets, health.ProbeTarget{Name: account.Name, AccountID: account.AccountID})
+	}
+	for i := range targets {
+		nrClient, err := d.clientForAccount(ctx, config, settings.UID, targets[i].AccountID)
+		if err != nil {
+			log.DefaultLogger.Error("Failed to create New Relic client for diagnostics", "error", err, "accountID", targets[i].AccountID)
+			targets[i].Err = err
+			continue
+		}
+		executor, _ := newMetadataSources(nrClient)
+		if d.budget != nil {
+			executor = &quota.Executor{Executor: executor, Budget: d.budget}
+		}
+		targets[i].Executor = executor
+	}
+
+	accounts := health.ProbeAccounts(ctx, targets, time.Now())
+	return sendJSON(sender, http.StatusOK, map[string]interface{}{
+		"eventTypes": health.ProbedEventTypes,
+		"accounts":   accounts,
+	})
+}
@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"newrelic-grafana-plugin/pkg/health"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+)
+
+// TestDatasource_HandleDiagnosticsResource verifies the diagnostics resource
+// probes the default and named accounts.
+func TestDatasource_HandleDiagnosticsResource(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{
+				ApiKey:    "test-api-key",
+				AccountId: 12345,
+				Accounts:  []models.AccountEntry{{Name: "Staging", AccountID: 222}},
+			},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	executor := &metadataExecutor{results: map[nrdb.NRQL]*nrdb.NRDBResultContainer{
+		"SELECT latest(timestamp) FROM Transaction SINCE 1 day ago": {
+			Results: []nrdb.NRDBResult{{"latest.timestamp": float64(time.Now().UnixMilli())}},
+		},
+	}}
+	originalSources := newMetadataSources
+	newMetadataSources = func(nrClient *newrelic.NewRelic) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister) {
+		return executor, metadataLister{}
+	}
+	defer func() { newMetadataSources = originalSources }()
+
+	var captured *backend.CallResourceResponse
+	sender := &mockCallResourceResponseSender{
+		sendFunc: func(resp *backend.CallResourceResponse) error {
+			captured = resp
+			return nil
+		},
+	}
+	req := &backend.CallResourceRequest{
+		Path: "diagnostics",
+		URL:  "diagnostics",
+		PluginContext: backend.PluginContext{
+			DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+		},
+	}
+	require.NoError(t, (&Datasource{}).CallResource(context.Background(), req, sender))
+	require.NotNil(t, captured)
+	assert.Equal(t, http.StatusOK, captured.Status)
+
+	var body struct {
+		EventTypes []string               `json:"eventTypes"`
+		Accounts   []health.AccountProbes `json:"accounts"`
+	}
+	require.NoError(t, json.Unmarshal(captured.Body, &body))
+	assert.Equal(t, health.ProbedEventTypes, body.EventTypes)
+	require.Len(t, body.Accounts, 2)
+	assert.Equal(t, defaultAccountName, body.Accounts[0].Name)
+	assert.Equal(t, 222, body.Accounts[1].AccountID)
+	for _, account := range body.Accounts {
+		assert.Equal(t, "1 of 4 telemetry types fresh", account.Summary)
+		require.Len(t, account.Probes, len(health.ProbedEventTypes))
+		assert.Equal(t, health.ProbeFresh, account.Probes[0].Status)
+		assert.Equal(t, health.ProbeNoData, account.Probes[1].Status)
+	}
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+)
+
+// newEntitySearcher returns the entity searcher of a New Relic client. It is a
+// variable so tests can replace it.
+var newEntitySearcher = func(nrClient *newrelic.NewRelic) entitysearch.Searcher {
+	return &nrClient.Entities
+}
+
+// entityLookupTTL is how long entities looked up by GUID are cached, including
+// GUIDs no entity was found for.
+const entityLookupTTL = time.Hour
+
+// entityLookup returns the function that gives queries the entities of GUIDs,
+// searched by searcherFor in the default account and cached for
+// entityLookupTTL.
+func (d *Datasource) entityLookup(config *models.PluginSettings, datasourceUID string, searcherFor handler.EntitySearcherFunc) handler.EntityLookupFunc {
+	return func(ctx context.Context, guids []string) (map[string]entitysearch.Entity, error) {
+		found := make(map[string]entitysearch.Entity, len(guids))
+		var missing []string
+		for _, guid := range guids {
+			if d.entities == nil {
+				missing = append(missing, guid)
+				continue
+			}
+			cached, ok := d.entities.Get(datasourceUID + "/" + guid)
+			if !ok {
+				missing = append(missing, guid)
+				continue
+			}
+			if entity, ok := cached.(entitysearch.Entity); ok {
+				found[guid] = entity
+			}
+		}
+		if len(missing) == 0 {
+			return found, nil
+		}
+
+		searcher, err := searcherFor(ctx, config.Secrets.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		looked, err := entitysearch.Lookup(ctx, searcher, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, guid := range missing {
+			entity, ok := looked[guid]
+			if ok {
+				found[guid] = entity
+			}
+			if d.entities != nil {
+				// GUIDs without an entity are cached too, so they are not searched on every refresh
+				var value interface{} = false
+				if ok {
+					value = entity
+				}
+				d.entities.Set(datasourceUID+"/"+guid, value, entityLookupTTL)
+			}
+		}
+		log.DefaultLogger.Debug("Looked up entities", "guids", len(missing), "found", len(looked))
+		return found, nil
+	}
+}
+
+// entitySearcher returns the function that gives entities queries the entity
+// searcher of the account they query.
+func (d *Datasource) entitySearcher(config *models.PluginSettings, datasourceUID string) handler.EntitySearcherFunc {
+	return func(ctx context.Context, accountID int) (entitysearch.Searcher, error) {
+		nrClient, err := d.clientForAccount(ctx, config, datasourceUID, accountID)
+		if err != nil {
+			return nil, err
+		}
+		searcher := newEntitySearcher(nrClient)
+		if d.budget != nil {
+			searcher = &quota.Searcher{Searcher: searcher, Budget: d.budget, AccountID: accountID}
+		}
+		return searcher, nil
+	}
+}
+
+// handleEntitiesResource handles the entities resource endpoint used for entity
+// autocomplete in the query editor. The prefix parameter returns entities whose
+// name contains it, optionally limited to the type parameter; the query
+// parameter runs a full entity search instead.
+func (d *Datasource) handleEntitiesResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+	settings := *req.PluginContext.DataSourceInstanceSettings
+
+	config, err := models.LoadPluginSettings(settings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Entities request with invalid configuration", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+
+	params, err := resourceParams(req.URL)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	accountID, err := resourceAccountID(config, params)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	searcher, err := d.entitySearcher(config, settings.UID)(ctx, accountID)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create New Relic client for entities request", "error", err)
+		return sendJSON(sender, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create New Relic client: %v", err)})
+	}
+
+	var found []entitysearch.Entity
+	if query := params.Get("query"); query != "" {
+		found, err = entitysearch.Search(ctx, searcher, query)
+	} else {
+		found, err = entitysearch.Autocomplete(ctx, searcher, params.Get("prefix"), params.Get("type"))
+	}
+	if err != nil {
+		var requestErr *entitysearch.RequestError
+		if errors.As(err, &requestErr) {
+			return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		log.DefaultLogger.Error("Entities request failed", "error", err, "accountID", accountID)
+		return sendJSON(sender, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	if found == nil {
+		found = []entitysearch.Entity{}
+	}
+	return sendJSON(sender, http.StatusOK, map[string][]entitysearch.Entity{"entities": found})
+}
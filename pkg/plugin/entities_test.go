@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entitySearcherStub records the search query and finds one entity.
+type entitySearcherStub struct {
+	query string
+}
+
+func (s *entitySearcherStub) GetEntitySearchByQueryWithContext(_ context.Context, _ entities.EntitySearchOptions, query string, _ []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error) {
+	s.query = query
+	return &entities.EntitySearch{Results: entities.EntitySearchResult{Entities: []entities.EntityOutlineInterface{
+		&entities.GenericEntityOutline{Name: "checkout", GUID: "guid-1", Type: "APPLICATION", AccountID: 12345},
+	}}}, nil
+}
+
+// TestDatasource_HandleEntitiesResource verifies the entity autocomplete resource.
+func TestDatasource_HandleEntitiesResource(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	searcher := &entitySearcherStub{}
+	originalSearcher := newEntitySearcher
+	newEntitySearcher = func(*newrelic.NewRelic) entitysearch.Searcher { return searcher }
+	defer func() { newEntitySearcher = originalSearcher }()
+
+	ds := &Datasource{}
+	send := func(t *testing.T, rawURL string) *backend.CallResourceResponse {
+		var captured *backend.CallResourceResponse
+		sender := &mockCallResourceResponseSender{
+			sendFunc: func(resp *backend.CallResourceResponse) error {
+				captured = resp
+				return nil
+			},
+		}
+		req := &backend.CallResourceRequest{
+			Path: "entities",
+			URL:  rawURL,
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+			},
+		}
+		require.NoError(t, ds.CallResource(context.Background(), req, sender))
+		require.NotNil(t, captured)
+		return captured
+	}
+
+	t.Run("autocomplete by name and type", func(t *testing.T) {
+		resp := send(t, "entities?prefix=check&type=application")
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.Equal(t, "name LIKE 'check' AND type = 'APPLICATION'", searcher.query)
+
+		var body struct {
+			Entities []entitysearch.Entity `json:"entities"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body, &body))
+		require.Len(t, body.Entities, 1)
+		assert.Equal(t, "guid-1", body.Entities[0].GUID)
+	})
+
+	t.Run("full search query", func(t *testing.T) {
+		resp := send(t, "entities?query=domain+%3D+'APM'")
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.Equal(t, "domain = 'APM'", searcher.query)
+	})
+
+	t.Run("invalid account", func(t *testing.T) {
+		resp := send(t, "entities?prefix=check&accountID=abc")
+		assert.Equal(t, http.StatusBadRequest, resp.Status)
+	})
+}
+
+// TestDatasource_EntityLookup verifies entities looked up by GUID are cached,
+// including GUIDs no entity was found for.
+func TestDatasource_EntityLookup(t *testing.T) {
+	searcher := &entitySearcherStub{}
+	searches := 0
+	originalSearcher := newEntitySearcher
+	newEntitySearcher = func(*newrelic.NewRelic) entitysearch.Searcher {
+		searches++
+		return searcher
+	}
+	defer func() { newEntitySearcher = originalSearcher }()
+
+	ds := &Datasource{entities: cache.New()}
+	config := &models.PluginSettings{Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345}}
+	lookup := ds.entityLookup(config, "uid", ds.entitySearcher(config, "uid"))
+
+	found, err := lookup(context.Background(), []string{"guid-1", "guid-2"})
+	require.NoError(t, err)
+	assert.Equal(t, "id IN ('guid-1', 'guid-2')", searcher.query)
+	assert.Equal(t, "checkout", found["guid-1"].Name)
+	assert.NotContains(t, found, "guid-2")
+
+	found, err = lookup(context.Background(), []string{"guid-1", "guid-2"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, searches, "cached GUIDs are not searched again")
+	assert.Equal(t, "checkout", found["guid-1"].Name)
+	assert.NotContains(t, found, "guid-2")
+}
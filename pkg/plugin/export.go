@@ -0,0 +1,334 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Export formats
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson" // A JSON object per row
+)
+
+// exportMaxRows is the most rows an export fetches for an event query, page by
+// page, unless the datasource allows more.
+const exportMaxRows = 50000
+
+// exportChunkRows is the number of rows sent per chunk of an export response.
+const exportChunkRows = 1000
+
+// exportRequest is the body of an export request.
+type exportRequest struct {
+	Query     json.RawMessage `json:"query"`     // The query, as a panel sends it
+	QueryType string          `json:"queryType"` // Optional, the query type: empty for NRQL, or logs or traces
+	From      int64           `json:"from"`      // Start of the time range, in epoch milliseconds
+	To        int64           `json:"to"`        // End of the time range, in epoch milliseconds
+	Format    string          `json:"format"`    // One of csv|ndjson (empty means csv)
+}
+
+// exportTable is the rows of the frames of a query in long format: a column
+// per field name and per label name, and a row per frame row.
+type exportTable struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// handleExportResource handles the export resource endpoint, which runs a
+// panel's query again and streams all of its results as CSV or NDJSON, for
+// downloads of result sets larger than the panel shows. The series and row
+// limits of the datasource do not apply, and event queries are fetched page by
+// page up to at least exportMaxRows rows. Frames are written as one table, with
+// the labels of their fields as columns.
+func (d *Datasource) handleExportResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.Method != http.MethodPost {
+		return sendJSON(sender, http.StatusMethodNotAllowed, map[string]string{"error": "export requests must be POST requests"})
+	}
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+	settings := *req.PluginContext.DataSourceInstanceSettings
+
+	var body exportRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid export request: %v", err)})
+	}
+	if body.Format == "" {
+		body.Format = ExportFormatCSV
+	}
+	if body.Format != ExportFormatCSV && body.Format != ExportFormatNDJSON {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid format '%s': must be one of csv, ndjson", body.Format)})
+	}
+	switch body.QueryType {
+	case "", models.QueryTypeLogs, models.QueryTypeTraces:
+	default:
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("queries of type '%s' cannot be exported", body.QueryType)})
+	}
+	if len(body.Query) == 0 {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "query is required"})
+	}
+	if body.From <= 0 || body.To <= body.From {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "from and to must be epoch milliseconds, with from before to"})
+	}
+
+	config, err := models.LoadPluginSettings(settings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Export request with invalid configuration", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+	nrClient, err := d.clientFor(ctx, config, settings.UID)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create New Relic client for export", "error", err)
+		return sendJSON(sender, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create New Relic client: %v", err)})
+	}
+	ctx, executor, err := d.queryExecutor(ctx, config, settings.UID, nrClient, req.GetHTTPHeader(dashboardUIDHeader), req.GetHTTPHeader(panelIDHeader))
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create New Relic client for export", "error", err)
+		return sendJSON(sender, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create New Relic client: %v", err)})
+	}
+
+	// Exports are not cut to what a panel can display
+	exportConfig := *config
+	exportConfig.MaxSeries = math.MaxInt
+	exportConfig.MaxFrameRows = 0
+	exportConfig.MaxRows = max(config.MaxRows, exportMaxRows)
+
+	// The query keeps its refId, which its expressions reference fields by
+	refID := "export"
+	var queryRef struct {
+		RefID string `json:"refId"`
+	}
+	if json.Unmarshal(body.Query, &queryRef) == nil && queryRef.RefID != "" {
+		refID = queryRef.RefID
+	}
+	query := backend.DataQuery{
+		RefID:     refID,
+		QueryType: body.QueryType,
+		JSON:      body.Query,
+		TimeRange: backend.TimeRange{From: time.UnixMilli(body.From), To: time.UnixMilli(body.To)},
+	}
+	ctx = handler.WithEntityLookup(ctx, d.entityLookup(config, settings.UID, d.entitySearcher(config, settings.UID)))
+	resp := handler.HandleQuery(ctx, executor, &exportConfig, query)
+	if resp.Error != nil {
+		log.DefaultLogger.Debug("Export query failed", "error", resp.Error)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": resp.Error.Error()})
+	}
+
+	table := exportTableOf(resp.Frames)
+	log.DefaultLogger.Debug("Exporting query results", "format", body.Format, "rows", len(table.rows), "columns", len(table.columns))
+	return writeExport(sender, body.Format, table, exportWarnings(resp.Frames))
+}
+
+// exportTableOf returns the rows of frames as one table. Columns are the field
+// names followed by the label names of each field, in the order they first
+// appear; label values fill their column in every row of the field's frame.
+// Fields sharing a name in a frame get a column named by the name and labels.
+func exportTableOf(frames data.Frames) exportTable {
+	var table exportTable
+	index := make(map[string]int)
+	column := func(name string) int {
+		i, ok := index[name]
+		if !ok {
+			i = len(table.columns)
+			index[name] = i
+			table.columns = append(table.columns, name)
+		}
+		return i
+	}
+
+	for _, frame := range frames {
+		type cell struct {
+			column int
+			field  *data.Field
+			label  string
+		}
+		names := make(map[string]int, len(frame.Fields))
+		for _, field := range frame.Fields {
+			names[field.Name]++
+		}
+		var cells []cell
+		for _, field := range frame.Fields {
+			if names[field.Name] > 1 {
+				// Fields of wide frames share a name, so their labels name their column
+				cells = append(cells, cell{column: column(fmt.Sprintf("%s {%s}", field.Name, field.Labels)), field: field})
+				continue
+			}
+			cells = append(cells, cell{column: column(field.Name), field: field})
+			keys := make([]string, 0, len(field.Labels))
+			for key := range field.Labels {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				cells = append(cells, cell{column: column(key), label: field.Labels[key]})
+			}
+		}
+
+		for row := 0; row < frame.Rows(); row++ {
+			values := make([]interface{}, len(table.columns))
+			for _, c := range cells {
+				if c.field == nil {
+					values[c.column] = c.label
+					continue
+				}
+				if value, ok := c.field.ConcreteAt(row); ok {
+					values[c.column] = value
+				}
+			}
+			table.rows = append(table.rows, values)
+		}
+	}
+
+	// Rows of earlier frames lack the columns later frames added
+	for i, values := range table.rows {
+		if len(values) < len(table.columns) {
+			table.rows[i] = append(values, make([]interface{}, len(table.columns)-len(values))...)
+		}
+	}
+	return table
+}
+
+// exportWarnings returns the texts of the warning notices of frames, such as
+// truncation, without duplicates.
+func exportWarnings(frames data.Frames) []string {
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, frame := range frames {
+		if frame.Meta == nil {
+			continue
+		}
+		for _, notice := range frame.Meta.Notices {
+			if notice.Severity == data.NoticeSeverityWarning && !seen[notice.Text] {
+				seen[notice.Text] = true
+				warnings = append(warnings, notice.Text)
+			}
+		}
+	}
+	return warnings
+}
+
+// writeExport sends the table in format, exportChunkRows rows per chunk. The
+// first chunk carries the status and the headers, including the warnings of
+// the query in X-Export-Warnings.
+func writeExport(sender backend.CallResourceResponseSender, format string, table exportTable, warnings []string) error {
+	headers := map[string][]string{
+		"Content-Disposition": {fmt.Sprintf("attachment; filename=\"newrelic-export.%s\"", format)},
+		"Content-Type":        {"text/csv; charset=utf-8"},
+	}
+	if format == ExportFormatNDJSON {
+		headers["Content-Type"] = []string{"application/x-ndjson"}
+	}
+	if len(warnings) > 0 {
+		headers["X-Export-Warnings"] = []string{strings.Join(warnings, "; ")}
+	}
+
+	var buf bytes.Buffer
+	csvWriter := csv.NewWriter(&buf)
+	first := true
+	flush := func() error {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+		chunk := &backend.CallResourceResponse{Body: bytes.Clone(buf.Bytes())}
+		if first {
+			chunk.Status = http.StatusOK
+			chunk.Headers = headers
+			first = false
+		}
+		buf.Reset()
+		return sender.Send(chunk)
+	}
+
+	if format == ExportFormatCSV {
+		if err := csvWriter.Write(table.columns); err != nil {
+			return err
+		}
+	}
+	for i, values := range table.rows {
+		if err := writeExportRow(&buf, csvWriter, format, table.columns, values); err != nil {
+			return err
+		}
+		if (i+1)%exportChunkRows == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if first || len(table.rows)%exportChunkRows != 0 {
+		return flush()
+	}
+	return nil
+}
+
+// writeExportRow writes a row as a CSV record or a JSON object keyed by column.
+// Times are written in RFC 3339 with nanoseconds and missing values as empty
+// CSV cells or JSON nulls.
+func writeExportRow(buf *bytes.Buffer, csvWriter *csv.Writer, format string, columns []string, values []interface{}) error {
+	if format == ExportFormatNDJSON {
+		// Written by hand to keep the columns in order
+		buf.WriteByte('{')
+		for i, column := range columns {
+			name, err := json.Marshal(column)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(exportValue(values[i]))
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+		return nil
+	}
+
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := exportValue(value).(type) {
+		case nil:
+		case string:
+			record[i] = v
+		case json.RawMessage:
+			record[i] = string(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return csvWriter.Write(record)
+}
+
+// exportValue returns a value as it is exported: times as RFC 3339 strings.
+func exportValue(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	if raw, ok := value.(json.RawMessage); ok {
+		return raw
+	}
+	return value
+}
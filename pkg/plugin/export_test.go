@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface/mocknrdb"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportResponse is a streamed export response: the first chunk's status and
+// headers, and the body of every chunk.
+type exportResponse struct {
+	status  int
+	headers map[string][]string
+	chunks  int
+	body    bytes.Buffer
+}
+
+func callExport(t *testing.T, ds *Datasource, settings *backend.DataSourceInstanceSettings, method, body string) *exportResponse {
+	t.Helper()
+	resp := &exportResponse{}
+	sender := &mockCallResourceResponseSender{
+		sendFunc: func(chunk *backend.CallResourceResponse) error {
+			if resp.chunks == 0 {
+				resp.status, resp.headers = chunk.Status, chunk.Headers
+			} else {
+				assert.Zero(t, chunk.Status, "later chunks only carry the body")
+			}
+			resp.chunks++
+			resp.body.Write(chunk.Body)
+			return nil
+		},
+	}
+	req := &backend.CallResourceRequest{
+		PluginContext: backend.PluginContext{DataSourceInstanceSettings: settings},
+		Path:          "export",
+		Method:        method,
+		Body:          []byte(body),
+	}
+	require.NoError(t, ds.CallResource(context.Background(), req, sender))
+	return resp
+}
+
+func TestDatasource_HandleExportResource(t *testing.T) {
+	server := mocknrdb.NewServer(mocknrdb.Fixture{
+		AccountID: 123456,
+		NRQL:      "SELECT count(*) FROM Transaction FACET appName SINCE 1700000000000 UNTIL 1700003600000",
+		Result: []byte(`{"results":[
+			{"facet":"checkout","appName":"checkout","count":912},
+			{"facet":"billing, EU","appName":"billing, EU","count":611}
+		],"metadata":{"eventTypes":["Transaction"],"facets":["appName"]}}`),
+	})
+	defer server.Close()
+	settings := backend.DataSourceInstanceSettings{
+		UID:                     "mock-uid",
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	}
+	ds := mockedDatasource(t, settings, server)
+	request := func(format string) string {
+		return `{"query":{"queryText":"SELECT count(*) FROM Transaction FACET appName"},"from":1700000000000,"to":1700003600000,"format":"` + format + `"}`
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		resp := callExport(t, ds, &settings, http.MethodPost, request(""))
+		require.Equal(t, http.StatusOK, resp.status, resp.body.String())
+		assert.Equal(t, []string{"text/csv; charset=utf-8"}, resp.headers["Content-Type"])
+		assert.Contains(t, resp.headers["Content-Disposition"][0], "newrelic-export.csv")
+
+		lines := strings.Split(strings.TrimSpace(resp.body.String()), "\n")
+		require.Len(t, lines, 3, resp.body.String())
+		assert.Contains(t, lines[0], "appName")
+		assert.Contains(t, resp.body.String(), `"billing, EU"`, "values are quoted as CSV")
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		resp := callExport(t, ds, &settings, http.MethodPost, request("ndjson"))
+		require.Equal(t, http.StatusOK, resp.status, resp.body.String())
+		assert.Equal(t, []string{"application/x-ndjson"}, resp.headers["Content-Type"])
+
+		lines := strings.Split(strings.TrimSpace(resp.body.String()), "\n")
+		require.Len(t, lines, 2)
+		apps := map[interface{}]interface{}{}
+		for _, line := range lines {
+			var row map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &row))
+			apps[row["appName"]] = row["count"]
+		}
+		assert.Equal(t, map[interface{}]interface{}{"checkout": 912.0, "billing, EU": 611.0}, apps)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		resp := callExport(t, ds, &settings, http.MethodGet, request("csv"))
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.status)
+
+		resp = callExport(t, ds, &settings, http.MethodPost, request("xml"))
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+
+		resp = callExport(t, ds, &settings, http.MethodPost, `{"query":{"queryText":"SELECT 1"},"from":2,"to":1}`)
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+
+		resp = callExport(t, ds, &settings, http.MethodPost, `{"query":{},"queryType":"incidents","from":1,"to":2}`)
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+
+		resp = callExport(t, ds, nil, http.MethodPost, request("csv"))
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+	})
+
+	t.Run("query errors", func(t *testing.T) {
+		resp := callExport(t, ds, &settings, http.MethodPost, `{"query":{"queryText":"SELECT count(*) FROM PageView"},"from":1700000000000,"to":1700003600000}`)
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+		assert.Contains(t, resp.body.String(), "no fixture")
+	})
+}
+
+func TestExportTableOf(t *testing.T) {
+	at := time.UnixMilli(1700000000000).UTC()
+	frames := data.Frames{
+		data.NewFrame("checkout",
+			data.NewField("time", nil, []time.Time{at, at.Add(time.Minute)}),
+			data.NewField("count", data.Labels{"appName": "checkout"}, []float64{1, 2}),
+		),
+		data.NewFrame("billing",
+			data.NewField("time", nil, []time.Time{at}),
+			data.NewField("count", data.Labels{"appName": "billing", "host": "a"}, []*float64{nil}),
+		),
+		data.NewFrame("wide",
+			data.NewField("time", nil, []time.Time{at}),
+			data.NewField("count", data.Labels{"appName": "x"}, []float64{5}),
+			data.NewField("count", data.Labels{"appName": "y"}, []float64{6}),
+		),
+	}
+
+	table := exportTableOf(frames)
+	assert.Equal(t, []string{"time", "count", "appName", "host", "count {appName=x}", "count {appName=y}"}, table.columns)
+	require.Len(t, table.rows, 4)
+	assert.Equal(t, []interface{}{at, 1.0, "checkout", nil, nil, nil}, table.rows[0])
+	assert.Equal(t, []interface{}{at, nil, "billing", "a", nil, nil}, table.rows[2])
+	assert.Equal(t, []interface{}{at, nil, nil, nil, 5.0, 6.0}, table.rows[3])
+}
+
+func TestWriteExport_Chunks(t *testing.T) {
+	table := exportTable{columns: []string{"n"}}
+	for i := 0; i < exportChunkRows*2+1; i++ {
+		table.rows = append(table.rows, []interface{}{i})
+	}
+	var chunks []*backend.CallResourceResponse
+	sender := &mockCallResourceResponseSender{sendFunc: func(chunk *backend.CallResourceResponse) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}}
+
+	require.NoError(t, writeExport(sender, ExportFormatCSV, table, []string{"Showing 10 of 12 series"}))
+	require.Len(t, chunks, 3)
+	assert.Equal(t, http.StatusOK, chunks[0].Status)
+	assert.Equal(t, []string{"Showing 10 of 12 series"}, chunks[0].Headers["X-Export-Warnings"])
+	var body bytes.Buffer
+	for _, chunk := range chunks {
+		body.Write(chunk.Body)
+	}
+	assert.Equal(t, exportChunkRows*2+2, strings.Count(body.String(), "\n"), "header and rows")
+
+	// Empty results still get the header
+	chunks = nil
+	require.NoError(t, writeExport(sender, ExportFormatCSV, exportTable{columns: []string{"n"}}, nil))
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "n\n", string(chunks[0].Body))
+}
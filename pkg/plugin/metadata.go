@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+)
+
+// newMetadataSources returns the query executor and account lister used by the
+// metadata and query validation resources. It is a variable so tests can replace it.
+var newMetadataSources = func(nrClient *newrelic.NewRelic) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister) {
+	return &nrdbiface.RealNRDBExecutor{NRDB: nrClient.Nrdb}, &nrClient.Accounts
+}
+
+// variableSources returns the function that gives variable queries the metadata
+// sources of the account they query, charged to the account budget.
+func (d *Datasource) variableSources(config *models.PluginSettings, datasourceUID string) handler.VariableSourcesFunc {
+	return func(ctx context.Context, accountID int) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister, error) {
+		nrClient, err := d.clientForAccount(ctx, config, datasourceUID, accountID)
+		if err != nil {
+			return nil, nil, err
+		}
+		executor, lister := newMetadataSources(nrClient)
+		if d.budget != nil {
+			executor = &quota.Executor{Executor: executor, Budget: d.budget}
+			lister = &quota.AccountLister{Lister: lister, Budget: d.budget, AccountID: accountID}
+		}
+		return executor, lister, nil
+	}
+}
+
+// handleMetadataResource handles the event-types, attributes and accounts resource
+// endpoints used to populate template variables and query-builder dropdowns, and
+// the metrics-metadata endpoint whose attribute catalog gives the query editor
+// inline docs. The accountID query parameter overrides the configured account.
+func (d *Datasource) handleMetadataResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+	settings := *req.PluginContext.DataSourceInstanceSettings
+
+	config, err := models.LoadPluginSettings(settings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Metadata request with invalid configuration", "error", err, "path", req.Path)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+
+	params, err := resourceParams(req.URL)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	accountID, err := resourceAccountID(config, params)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	nrClient, err := d.clientForAccount(ctx, config, settings.UID, accountID)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create New Relic client for metadata request", "error", err, "path", req.Path)
+		return sendJSON(sender, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create New Relic client: %v", err)})
+	}
+	executor, lister := newMetadataSources(nrClient)
+	if d.budget != nil {
+		executor = &quota.Executor{Executor: executor, Budget: d.budget}
+		lister = &quota.AccountLister{Lister: lister, Budget: d.budget, AccountID: accountID}
+	}
+
+	var body interface{}
+	switch req.Path {
+	case "event-types":
+		var eventTypes []string
+		eventTypes, err = metadata.EventTypes(ctx, executor, accountID)
+		body = map[string][]string{"eventTypes": eventTypes}
+	case "attributes":
+		var attributes []metadata.Attribute
+		attributes, err = metadata.Attributes(ctx, executor, accountID, params.Get("eventType"))
+		body = map[string][]metadata.Attribute{"attributes": attributes}
+	case "metrics-metadata":
+		var catalogs []metadata.EventTypeCatalog
+		catalogs, err = metadata.Catalog(ctx, executor, accountID, metadata.SplitEventTypes(params["eventType"]))
+		body = map[string][]metadata.EventTypeCatalog{"eventTypes": catalogs}
+	case "accounts":
+		var accounts []metadata.Account
+		accounts, err = metadata.Accounts(ctx, lister)
+		body = map[string][]metadata.Account{"accounts": accounts}
+	default:
+		return sendJSON(sender, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+	}
+
+	if err != nil {
+		var requestErr *metadata.RequestError
+		if errors.As(err, &requestErr) {
+			return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		log.DefaultLogger.Error("Metadata request failed", "error", err, "path", req.Path, "accountID", accountID)
+		return sendJSON(sender, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return sendJSON(sender, http.StatusOK, body)
+}
+
+// resourceParams returns the query parameters of a resource request URL.
+func resourceParams(rawURL string) (url.Values, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource URL: %w", err)
+	}
+	return u.Query(), nil
+}
+
+// resourceAccountID returns the account a resource request targets: the
+// accountID query parameter if set, otherwise the configured account.
+func resourceAccountID(config *models.PluginSettings, params url.Values) (int, error) {
+	value := params.Get("accountID")
+	if value == "" {
+		return config.Secrets.AccountId, nil
+	}
+	accountID, err := strconv.Atoi(value)
+	if err != nil || accountID <= 0 {
+		return 0, fmt.Errorf("invalid accountID '%s'", value)
+	}
+	return accountID, nil
+}
+
+// sendJSON sends body as a JSON resource response with the given status.
+func sendJSON(sender backend.CallResourceResponseSender, status int, body interface{}) error {
+	responseBody, err := json.Marshal(body)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to marshal resource response", "error", err)
+		status = http.StatusInternalServerError
+		responseBody = []byte(`{"error": "Failed to process response"}`)
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status: status,
+		Body:   responseBody,
+		Headers: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+	})
+}
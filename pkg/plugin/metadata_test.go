@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+)
+
+// metadataExecutor returns canned metadata query results and records the account queried.
+type metadataExecutor struct {
+	mu        sync.Mutex // Guards accountID for concurrent queries
+	accountID int
+	results   map[nrdb.NRQL]*nrdb.NRDBResultContainer
+}
+
+func (e *metadataExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.accountID = accountID
+	return e.results[query], nil
+}
+
+func (e *metadataExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	return nil, nil
+}
+
+// metadataLister returns a fixed account list.
+type metadataLister struct{}
+
+func (metadataLister) ListAccountsWithContext(ctx context.Context, params accounts.ListAccountsParams) ([]accounts.AccountOutline, error) {
+	return []accounts.AccountOutline{{ID: 12345, Name: "Production"}}, nil
+}
+
+// TestDatasource_HandleMetadataResource verifies the event-types, attributes,
+// metrics-metadata and accounts resources.
+func TestDatasource_HandleMetadataResource(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	executor := &metadataExecutor{results: map[nrdb.NRQL]*nrdb.NRDBResultContainer{
+		"SHOW EVENT TYPES SINCE 1 week ago": {
+			Results: []nrdb.NRDBResult{{"eventTypes": []interface{}{"Transaction", "Log"}}},
+		},
+		"SELECT keyset() FROM Transaction SINCE 1 week ago": {
+			Results: []nrdb.NRDBResult{{"key": "appName", "type": "string"}},
+		},
+	}}
+	originalSources := newMetadataSources
+	newMetadataSources = func(nrClient *newrelic.NewRelic) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister) {
+		return executor, metadataLister{}
+	}
+	defer func() { newMetadataSources = originalSources }()
+
+	tests := []struct {
+		name          string
+		path          string
+		url           string
+		wantStatus    int
+		wantBody      string
+		wantAccountID int
+	}{
+		{name: "event types", path: "event-types", url: "event-types", wantStatus: http.StatusOK, wantBody: `{"eventTypes":["Log","Transaction"]}`, wantAccountID: 12345},
+		{name: "event types for another account", path: "event-types", url: "event-types?accountID=999", wantStatus: http.StatusOK, wantBody: `{"eventTypes":["Log","Transaction"]}`, wantAccountID: 999},
+		{name: "attributes", path: "attributes", url: "attributes?eventType=Transaction", wantStatus: http.StatusOK, wantBody: `{"attributes":[{"name":"appName","type":"string"}]}`, wantAccountID: 12345},
+		{name: "attributes without event type", path: "attributes", url: "attributes", wantStatus: http.StatusBadRequest, wantBody: `{"error":"eventType is required"}`},
+		{name: "metrics metadata", path: "metrics-metadata", url: "metrics-metadata?eventType=Transaction", wantStatus: http.StatusOK, wantBody: `{"eventTypes":[{"eventType":"Transaction","description":"A web or background transaction of an APM-monitored application","attributes":[{"name":"appName","type":"string","description":"Name of the application that reported the event"}]}]}`, wantAccountID: 12345},
+		{name: "metrics metadata without event type", path: "metrics-metadata", url: "metrics-metadata", wantStatus: http.StatusBadRequest, wantBody: `{"error":"eventType is required"}`},
+		{name: "invalid account ID", path: "event-types", url: "event-types?accountID=abc", wantStatus: http.StatusBadRequest, wantBody: `{"error":"invalid accountID 'abc'"}`},
+		{name: "accounts", path: "accounts", url: "accounts", wantStatus: http.StatusOK, wantBody: `{"accounts":[{"id":12345,"name":"Production"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor.accountID = 0
+			var captured *backend.CallResourceResponse
+			sender := &mockCallResourceResponseSender{
+				sendFunc: func(resp *backend.CallResourceResponse) error {
+					captured = resp
+					return nil
+				},
+			}
+			req := &backend.CallResourceRequest{
+				Path: tt.path,
+				URL:  tt.url,
+				PluginContext: backend.PluginContext{
+					DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+				},
+			}
+
+			ds := &Datasource{}
+			require.NoError(t, ds.CallResource(context.Background(), req, sender))
+			require.NotNil(t, captured)
+			assert.Equal(t, tt.wantStatus, captured.Status)
+			assert.JSONEq(t, tt.wantBody, string(captured.Body))
+			assert.Equal(t, tt.wantAccountID, executor.accountID)
+		})
+	}
+}
+
+// TestResourceParams verifies query parameters are read from resource URLs.
+func TestResourceParams(t *testing.T) {
+	params, err := resourceParams("attributes?eventType=Transaction&accountID=1")
+	require.NoError(t, err)
+	assert.Equal(t, "Transaction", params.Get("eventType"))
+
+	_, err = resourceParams("%zz")
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/tracing"
+
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+)
+
+// maxIdleRequestClients bounds the request clients an instance keeps for
+// later requests; those of requests finishing while it holds as many are
+// dropped.
+const maxIdleRequestClients = 32
+
+// errTransportUnbound is the error of API requests sent through a request
+// transport that is not bound to a request.
+var errTransportUnbound = errors.New("API request to New Relic made outside of a data source request")
+
+// requestClientsKey is the context key of the request clients bound to a request.
+type requestClientsKey struct{}
+
+// requestTransport is an http.RoundTripper that sends API requests with the
+// context of the request it is bound to, so they are aborted once the request
+// is cancelled and carry its trace context. The client library drops the
+// contexts passed to its methods, so the context is bound to the transport of
+// the client instead.
+type requestTransport struct {
+	mu   sync.RWMutex
+	ctx  context.Context // Request the transport is bound to, nil when idle
+	base http.RoundTripper
+}
+
+// bind binds the transport to the request of ctx; a nil ctx unbinds it.
+func (t *requestTransport) bind(ctx context.Context) {
+	t.mu.Lock()
+	t.ctx = ctx
+	t.mu.Unlock()
+}
+
+// RoundTrip sends req with the context of the bound request. Requests made
+// after the bound request was cancelled, or while no request is bound, fail
+// without being sent.
+func (t *requestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	ctx := t.ctx
+	t.mu.RUnlock()
+	err := errTransportUnbound
+	if ctx != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	return (&tracing.Transport{Base: t.base}).RoundTrip(req.WithContext(ctx))
+}
+
+// requestClients are New Relic clients bound to one request at a time through
+// their shared transport. An instance keeps the clients of finished requests
+// for later ones, so requests in flight at once each have their own clients
+// without any being created per request. Clients are only kept once none of
+// the calls of their request is running: nrdbiface.UntilDone leaves the calls
+// of cancelled requests running, and their retries must not be sent under the
+// context of a later request.
+type requestClients struct {
+	transport *requestTransport
+
+	mu      sync.Mutex
+	clients map[string]*newrelic.NewRelic // Clients by API key, created on first use
+	running int                           // Calls of the bound request still running
+	owner   *Datasource                   // Instance to return the clients to once the request is done and no call is running
+}
+
+// clientFor returns the client for config's API key, creating it on first use.
+func (c *requestClients) clientFor(config *models.PluginSettings, datasourceUID string, keys *client.KeyRotation) (*newrelic.NewRelic, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if nrClient, ok := c.clients[config.Secrets.ApiKey]; ok {
+		return nrClient, nil
+	}
+	nrClient, err := newRelicClient(config, datasourceUID, c.transport, keys)
+	if err != nil {
+		return nil, err
+	}
+	if c.clients == nil {
+		c.clients = make(map[string]*newrelic.NewRelic)
+	}
+	c.clients[config.Secrets.ApiKey] = nrClient
+	return nrClient, nil
+}
+
+// CallStarted counts a call of the bound request, run by nrdbiface.UntilDone.
+func (c *requestClients) CallStarted() {
+	c.mu.Lock()
+	c.running++
+	c.mu.Unlock()
+}
+
+// CallDone counts a call of the bound request as finished, returning the
+// clients to their instance if it was the last one of a finished request.
+func (c *requestClients) CallDone() {
+	c.mu.Lock()
+	c.running--
+	owner := c.owner
+	idle := c.running == 0 && owner != nil
+	c.mu.Unlock()
+	if idle {
+		owner.returnClients(c)
+	}
+}
+
+// requestDone marks the bound request as done, returning the clients to d now
+// if none of its calls is running, or else once the last one finishes.
+func (c *requestClients) requestDone(d *Datasource) {
+	c.mu.Lock()
+	c.owner = d
+	idle := c.running == 0
+	c.mu.Unlock()
+	if idle {
+		d.returnClients(c)
+	}
+}
+
+// requestClientsFrom returns the request clients bound to the request of ctx.
+func requestClientsFrom(ctx context.Context) (*requestClients, bool) {
+	clients, ok := ctx.Value(requestClientsKey{}).(*requestClients)
+	return clients, ok
+}
+
+// bindRequest returns ctx carrying request clients bound to it, and a function
+// to call once the request is done. Contexts that cannot be cancelled and
+// carry no trace context use the shared clients instead.
+func (d *Datasource) bindRequest(ctx context.Context) (context.Context, func()) {
+	if !boundToRequest(ctx) {
+		return ctx, func() {}
+	}
+
+	d.clientMu.Lock()
+	var clients *requestClients
+	if n := len(d.idleClients); n > 0 {
+		clients, d.idleClients = d.idleClients[n-1], d.idleClients[:n-1]
+	} else {
+		clients = &requestClients{transport: &requestTransport{base: d.baseTransport()}}
+	}
+	d.clientMu.Unlock()
+
+	clients.transport.bind(ctx)
+	ctx = context.WithValue(ctx, requestClientsKey{}, clients)
+	return nrdbiface.WithCallTracker(ctx, clients), func() { clients.requestDone(d) }
+}
+
+// returnClients unbinds clients whose request is done and has no call running,
+// and keeps them for later requests unless the instance already keeps
+// maxIdleRequestClients.
+func (d *Datasource) returnClients(clients *requestClients) {
+	clients.mu.Lock()
+	clients.owner = nil
+	clients.mu.Unlock()
+	clients.transport.bind(nil)
+
+	d.clientMu.Lock()
+	defer d.clientMu.Unlock()
+	if len(d.idleClients) < maxIdleRequestClients {
+		d.idleClients = append(d.idleClients, clients)
+	}
+}
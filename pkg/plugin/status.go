@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/quota"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// redactedValue replaces secrets in the status response.
+const redactedValue = "[redacted]"
+
+// Status is the introspection report returned by the /status resource.
+type Status struct {
+	PluginVersion string           `json:"pluginVersion"`
+	StartedAt     time.Time        `json:"startedAt"`
+	Uptime        string           `json:"uptime"`
+	FeatureFlags  map[string]bool  `json:"featureFlags"`
+	Settings      *EffectiveConfig `json:"settings,omitempty"`
+	SettingsError string           `json:"settingsError,omitempty"`
+	Cache         *cache.Stats     `json:"cache,omitempty"`
+	QueryBudget   *quota.Stats     `json:"queryBudget,omitempty"`
+	Warmup        *warmupStatus    `json:"warmup,omitempty"`
+}
+
+// EffectiveConfig is the loaded datasource configuration with secrets redacted.
+type EffectiveConfig struct {
+	models.PluginSettings
+	APIKey    string `json:"apiKey"`
+	AccountID int    `json:"accountID"`
+}
+
+// warmupStatus reports whether the scheduled warm-up runner is active.
+type warmupStatus struct {
+	Running bool `json:"running"`
+	Queries int  `json:"queries"`
+}
+
+// status builds the introspection report for this datasource instance.
+func (d *Datasource) status(pluginCtx backend.PluginContext, now time.Time) Status {
+	s := Status{
+		PluginVersion: pluginCtx.PluginVersion,
+		StartedAt:     d.startedAt,
+		FeatureFlags:  make(map[string]bool),
+	}
+	if !d.startedAt.IsZero() {
+		s.Uptime = now.Sub(d.startedAt).Round(time.Second).String()
+	}
+	if d.cache != nil {
+		stats := d.cache.Stats()
+		s.Cache = &stats
+	}
+	if d.budget != nil {
+		stats := d.budget.Stats()
+		s.QueryBudget = &stats
+	}
+	s.FeatureFlags["queryBudget"] = d.budget != nil
+	s.FeatureFlags["warmup"] = d.warmup != nil
+	s.FeatureFlags["queryCache"] = d.policy != nil
+	s.FeatureFlags["auditLog"] = d.audit != nil
+
+	if pluginCtx.DataSourceInstanceSettings == nil {
+		return s
+	}
+	config, err := models.LoadPluginSettings(*pluginCtx.DataSourceInstanceSettings)
+	if err != nil {
+		s.SettingsError = err.Error()
+		return s
+	}
+
+	_, blackoutActive := activeBlackout(config, now)
+	s.FeatureFlags["strictQueryParsing"] = config.StrictQueryParsing
+	s.FeatureFlags["verifyFormatter"] = config.VerifyFormatter
+	s.FeatureFlags["blackoutActive"] = blackoutActive
+	if config.Warmup != nil {
+		s.Warmup = &warmupStatus{Running: d.warmup != nil, Queries: len(config.Warmup.Queries)}
+	}
+
+	s.Settings = &EffectiveConfig{PluginSettings: *config}
+	if config.Secrets != nil {
+		if config.Secrets.ApiKey != "" {
+			s.Settings.APIKey = redactedValue
+		}
+		s.Settings.AccountID = config.Secrets.AccountId
+	}
+	return s
+}
+
+// handleStatusResource handles the /status resource endpoint, reporting what this
+// datasource instance is actually running with
+func (d *Datasource) handleStatusResource(req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	responseBody, err := json.Marshal(d.status(req.PluginContext, time.Now()))
+	if err != nil {
+		log.DefaultLogger.Error("Failed to marshal status response", "error", err)
+		return sender.Send(&backend.CallResourceResponse{
+			Status: http.StatusInternalServerError,
+			Body:   []byte(`{"error": "Failed to process status"}`),
+		})
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   responseBody,
+		Headers: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+	})
+}
@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/live"
+)
+
+// Polling intervals of live queries
+const (
+	defaultLiveInterval = 10 * time.Second
+	minLiveInterval     = 5 * time.Second
+)
+
+// liveQueryTTL is how long a live query stays registered after the panel last
+// ran it. Streams started within it can be resumed, e.g. after a reconnect.
+const liveQueryTTL = time.Hour
+
+// livePathPrefix starts the channel paths of live queries.
+const livePathPrefix = "live/"
+
+// liveQuery is a query streamed over Grafana Live, registered when the panel runs it.
+type liveQuery struct {
+	query    backend.DataQuery
+	interval time.Duration
+}
+
+// livePollKey marks the context of the queries a stream polls with, so they
+// are not registered as live queries again.
+type livePollKey struct{}
+
+// liveOptions returns whether the query is live and how often it polls.
+func liveOptions(query backend.DataQuery) (bool, time.Duration, error) {
+	var qm models.QueryModel
+	if err := json.Unmarshal(query.JSON, &qm); err != nil || !qm.Live {
+		return false, 0, nil
+	}
+	if qm.LiveInterval == "" {
+		return true, defaultLiveInterval, nil
+	}
+	interval, err := timeutil.ParseDurationField("liveInterval", qm.LiveInterval)
+	if err != nil {
+		return true, 0, err
+	}
+	if interval < minLiveInterval {
+		return true, 0, fmt.Errorf("liveInterval must be at least %s, got %s", minLiveInterval, qm.LiveInterval)
+	}
+	return true, interval, nil
+}
+
+// livePath returns the channel path of a live query. It depends only on the
+// query, so rerunning the panel reuses the stream.
+func livePath(query backend.DataQuery) string {
+	sum := sha256.Sum256(append([]byte(query.RefID+"\x00"+query.QueryType+"\x00"), query.JSON...))
+	return livePathPrefix + hex.EncodeToString(sum[:16])
+}
+
+// attachLiveChannel registers a live query and sets the channel of its frames,
+// on which Grafana then subscribes to the frames of later polls. Queries a
+// stream polls with are not registered again.
+func (d *Datasource) attachLiveChannel(ctx context.Context, datasourceUID string, query backend.DataQuery, res *backend.DataResponse) {
+	if d.liveQueries == nil || ctx.Value(livePollKey{}) != nil || res.Error != nil {
+		return
+	}
+	isLive, interval, err := liveOptions(query)
+	if !isLive {
+		return
+	}
+	if err != nil {
+		*res = backend.ErrDataResponseWithSource(backend.StatusBadRequest, backend.ErrorSourceDownstream, err.Error())
+		return
+	}
+
+	path := livePath(query)
+	d.liveQueries.Set(path, liveQuery{query: query, interval: interval}, liveQueryTTL)
+	channel := live.Channel{Scope: live.ScopeDatasource, Namespace: datasourceUID, Path: path}.String()
+	for _, frame := range res.Frames {
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		frame.Meta.Channel = channel
+	}
+}
+
+// registeredLiveQuery returns the live query of a channel path.
+func (d *Datasource) registeredLiveQuery(path string) (liveQuery, bool) {
+	if d.liveQueries == nil {
+		return liveQuery{}, false
+	}
+	value, ok := d.liveQueries.Get(path)
+	if !ok {
+		return liveQuery{}, false
+	}
+	return value.(liveQuery), true
+}
+
+// SubscribeStream accepts subscriptions to the channels of registered live queries.
+func (d *Datasource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if _, ok := d.registeredLiveQuery(req.Path); !ok {
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream rejects publishing: live query channels only carry the frames
+// the plugin polls.
+func (d *Datasource) PublishStream(_ context.Context, _ *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream polls New Relic for a live query until its last subscriber leaves.
+// Each poll runs the query for the time since the previous one, starting from
+// the end of the time range the panel ran it for, and sends the frames of the
+// new data. A failed poll is retried over the same window at the next tick.
+func (d *Datasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	registered, ok := d.registeredLiveQuery(req.Path)
+	if !ok {
+		return fmt.Errorf("no live query for channel path %q", req.Path)
+	}
+	logger := log.DefaultLogger.FromContext(ctx)
+	pollCtx := context.WithValue(ctx, livePollKey{}, true)
+
+	since := registered.query.TimeRange.To
+	if since.IsZero() {
+		since = time.Now()
+	}
+	ticker := time.NewTicker(registered.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			query := registered.query
+			query.TimeRange = backend.TimeRange{From: since, To: now}
+			resp, err := d.QueryData(pollCtx, &backend.QueryDataRequest{
+				PluginContext: req.PluginContext,
+				Queries:       []backend.DataQuery{query},
+			})
+			if err != nil {
+				logger.Warn("Live query poll failed", "path", req.Path, "error", err)
+				continue
+			}
+			res := resp.Responses[query.RefID]
+			if res.Error != nil {
+				logger.Warn("Live query poll failed", "path", req.Path, "error", res.Error)
+				continue
+			}
+			for _, frame := range res.Frames {
+				if err := sender.SendFrame(frame, data.IncludeAll); err != nil {
+					return err
+				}
+			}
+			since = now
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/nrdbiface/mocknrdb"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// packetRecorder collects the packets a stream sends.
+type packetRecorder struct {
+	mu      sync.Mutex
+	packets []*backend.StreamPacket
+}
+
+func (r *packetRecorder) Send(packet *backend.StreamPacket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packets = append(r.packets, packet)
+	return nil
+}
+
+func (r *packetRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.packets)
+}
+
+func TestLiveOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		live     bool
+		interval time.Duration
+		wantErr  bool
+	}{
+		{name: "not live", json: `{"queryText":"SELECT 1"}`},
+		{name: "default interval", json: `{"live":true}`, live: true, interval: defaultLiveInterval},
+		{name: "interval", json: `{"live":true,"liveInterval":"30s"}`, live: true, interval: 30 * time.Second},
+		{name: "interval too short", json: `{"live":true,"liveInterval":"1s"}`, live: true, wantErr: true},
+		{name: "invalid interval", json: `{"live":true,"liveInterval":"often"}`, live: true, wantErr: true},
+		{name: "interval without live", json: `{"liveInterval":"30s"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live, interval, err := liveOptions(backend.DataQuery{JSON: []byte(tt.json)})
+			assert.Equal(t, tt.live, live)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.interval, interval)
+		})
+	}
+}
+
+func TestDatasource_LiveQuery(t *testing.T) {
+	server := mocknrdb.NewServer(mocknrdb.Fixture{
+		AccountID: 123456,
+		Result:    []byte(`{"results":[{"count":42}],"metadata":{"eventTypes":["Transaction"]}}`),
+	})
+	defer server.Close()
+	settings := backend.DataSourceInstanceSettings{
+		UID:                     "mock-uid",
+		JSONData:                []byte(`{}`),
+		DecryptedSecureJSONData: map[string]string{"apiKey": "test-api-key", "accountID": "123456"},
+	}
+	ds := mockedDatasource(t, settings, server)
+	pluginContext := backend.PluginContext{DataSourceInstanceSettings: &settings}
+	now := time.Now()
+	timeRange := backend.TimeRange{From: now.Add(-time.Hour), To: now}
+
+	resp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: pluginContext,
+		Queries: []backend.DataQuery{
+			{RefID: "A", TimeRange: timeRange, JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction","live":true}`)},
+			{RefID: "B", TimeRange: timeRange, JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction"}`)},
+			{RefID: "C", TimeRange: timeRange, JSON: []byte(`{"queryText":"SELECT count(*) FROM Transaction","live":true,"liveInterval":"1s"}`)},
+		},
+	})
+	require.NoError(t, err)
+
+	a := resp.Responses["A"]
+	require.NoError(t, a.Error)
+	require.NotEmpty(t, a.Frames)
+	channel := a.Frames[0].Meta.Channel
+	require.True(t, strings.HasPrefix(channel, "ds/mock-uid/"+livePathPrefix), channel)
+	path := strings.TrimPrefix(channel, "ds/mock-uid/")
+
+	b := resp.Responses["B"]
+	require.NoError(t, b.Error)
+	for _, frame := range b.Frames {
+		if frame.Meta != nil {
+			assert.Empty(t, frame.Meta.Channel, "queries that are not live have no channel")
+		}
+	}
+	assert.Error(t, resp.Responses["C"].Error, "live intervals under the minimum are rejected")
+
+	subscribed, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{PluginContext: pluginContext, Path: path})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusOK, subscribed.Status)
+	subscribed, err = ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{PluginContext: pluginContext, Path: livePathPrefix + "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, backend.SubscribeStreamStatusNotFound, subscribed.Status)
+
+	published, err := ds.PublishStream(context.Background(), &backend.PublishStreamRequest{PluginContext: pluginContext, Path: path})
+	require.NoError(t, err)
+	assert.Equal(t, backend.PublishStreamStatusPermissionDenied, published.Status)
+
+	// Poll faster than live queries may, to keep the test short
+	registered, ok := ds.registeredLiveQuery(path)
+	require.True(t, ok)
+	registered.interval = 10 * time.Millisecond
+	ds.liveQueries.Set(path, registered, liveQueryTTL)
+
+	requestsBefore := len(server.Requests())
+	recorder := &packetRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ds.RunStream(ctx, &backend.RunStreamRequest{PluginContext: pluginContext, Path: path}, backend.NewStreamSender(recorder))
+	}()
+	require.Eventually(t, func() bool { return recorder.count() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Greater(t, len(server.Requests()), requestsBefore, "each poll queries New Relic")
+
+	// Polls do not register live queries of their own
+	assert.Equal(t, 1, ds.liveQueries.Len())
+}
+
+func TestDatasource_RunStream_UnknownPath(t *testing.T) {
+	ds := &Datasource{}
+	err := ds.RunStream(context.Background(), &backend.RunStreamRequest{Path: livePathPrefix + "unknown"}, backend.NewStreamSender(&packetRecorder{}))
+	assert.Error(t, err)
+}
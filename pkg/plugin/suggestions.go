@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// suggestionsTTL is how long event types and attribute suggestions stay cached,
+// so that typing in the query editor does not run a query per keystroke.
+const suggestionsTTL = 5 * time.Minute
+
+// suggestionsResponse is the body of the suggestions resource.
+type suggestionsResponse struct {
+	EventType  string                         `json:"eventType,omitempty"`
+	EventTypes []string                       `json:"eventTypes,omitempty"`
+	Attributes []metadata.AttributeSuggestion `json:"attributes,omitempty"`
+}
+
+// handleSuggestionsResource handles the suggestions resource endpoint, which powers
+// typeahead in the query editor. The event type is taken from the eventType
+// parameter or the FROM clause of the partial NRQL in the query parameter. Without
+// one the response lists the account's event types; with one it lists the event
+// type's attributes with recent values. Either list is filtered by the prefix
+// parameter. Results are cached per datasource instance for suggestionsTTL.
+func (d *Datasource) handleSuggestionsResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+	settings := *req.PluginContext.DataSourceInstanceSettings
+
+	config, err := models.LoadPluginSettings(settings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Suggestions request with invalid configuration", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+
+	params, err := resourceParams(req.URL)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	accountID, err := resourceAccountID(config, params)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	eventType := params.Get("eventType")
+	if eventType == "" {
+		eventType = metadata.QueryEventType(params.Get("query"))
+	}
+	prefix := strings.ToLower(params.Get("prefix"))
+
+	nrClient, err := d.clientForAccount(ctx, config, settings.UID, accountID)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create New Relic client for suggestions", "error", err)
+		return sendJSON(sender, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create New Relic client: %v", err)})
+	}
+	executor, _ := newMetadataSources(nrClient)
+	if d.budget != nil {
+		executor = &quota.Executor{Executor: executor, Budget: d.budget}
+	}
+
+	body := suggestionsResponse{EventType: eventType}
+	if eventType == "" {
+		var eventTypes []string
+		eventTypes, err = cachedSuggestions(d, fmt.Sprintf("suggestions|%d", accountID), func() ([]string, error) {
+			return metadata.EventTypes(ctx, executor, accountID)
+		})
+		for _, name := range eventTypes {
+			if strings.HasPrefix(strings.ToLower(name), prefix) {
+				body.EventTypes = append(body.EventTypes, name)
+			}
+		}
+	} else {
+		var attributes []metadata.AttributeSuggestion
+		attributes, err = cachedSuggestions(d, fmt.Sprintf("suggestions|%d|%s", accountID, eventType), func() ([]metadata.AttributeSuggestion, error) {
+			return metadata.Suggestions(ctx, executor, accountID, eventType)
+		})
+		for _, attribute := range attributes {
+			if strings.HasPrefix(strings.ToLower(attribute.Name), prefix) {
+				body.Attributes = append(body.Attributes, attribute)
+			}
+		}
+	}
+
+	if err != nil {
+		var requestErr *metadata.RequestError
+		if errors.As(err, &requestErr) {
+			return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		log.DefaultLogger.Error("Suggestions request failed", "error", err, "eventType", eventType, "accountID", accountID)
+		return sendJSON(sender, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return sendJSON(sender, http.StatusOK, body)
+}
+
+// cachedSuggestions returns the suggestions cached under key, calling lookup and
+// caching its result for suggestionsTTL on a miss. Without a suggestions cache
+// lookup is always called.
+func cachedSuggestions[T any](d *Datasource, key string, lookup func() (T, error)) (T, error) {
+	if d.suggestions != nil {
+		if cached, ok := d.suggestions.Get(key); ok {
+			return cached.(T), nil
+		}
+	}
+	value, err := lookup()
+	if err == nil && d.suggestions != nil {
+		d.suggestions.Set(key, value, suggestionsTTL)
+	}
+	return value, err
+}
@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"newrelic-grafana-plugin/pkg/cache"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDatasource_HandleSuggestionsResource verifies the suggestions resource and its cache.
+func TestDatasource_HandleSuggestionsResource(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	executor := &metadataExecutor{results: map[nrdb.NRQL]*nrdb.NRDBResultContainer{
+		"SHOW EVENT TYPES SINCE 1 week ago": {Results: []nrdb.NRDBResult{
+			{"eventTypes": []interface{}{"Transaction", "TransactionError", "Log"}},
+		}},
+		"SELECT keyset() FROM Transaction SINCE 1 week ago": {Results: []nrdb.NRDBResult{
+			{"stringKeys": []interface{}{"appName", "host"}, "numericKeys": []interface{}{"duration"}},
+		}},
+		"SELECT * FROM Transaction SINCE 1 hour ago LIMIT 20": {Results: []nrdb.NRDBResult{
+			{"appName": "checkout", "host": "web-1", "duration": 0.5},
+		}},
+	}}
+	originalSources := newMetadataSources
+	newMetadataSources = func(nrClient *newrelic.NewRelic) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister) {
+		return executor, metadataLister{}
+	}
+	defer func() { newMetadataSources = originalSources }()
+
+	ds := &Datasource{suggestions: cache.New()}
+	send := func(t *testing.T, rawURL string) *backend.CallResourceResponse {
+		var captured *backend.CallResourceResponse
+		sender := &mockCallResourceResponseSender{
+			sendFunc: func(resp *backend.CallResourceResponse) error {
+				captured = resp
+				return nil
+			},
+		}
+		req := &backend.CallResourceRequest{
+			Path: "suggestions",
+			URL:  rawURL,
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+			},
+		}
+		require.NoError(t, ds.CallResource(context.Background(), req, sender))
+		require.NotNil(t, captured)
+		return captured
+	}
+
+	t.Run("event types without a FROM clause", func(t *testing.T) {
+		resp := send(t, "suggestions?query=SELECT+count(*)+FROM+&prefix=trans")
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.JSONEq(t, `{"eventTypes":["Transaction","TransactionError"]}`, string(resp.Body))
+	})
+
+	t.Run("attributes with recent values", func(t *testing.T) {
+		resp := send(t, "suggestions?query=SELECT+average(duration)+FROM+Transaction+WHERE+ap")
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.JSONEq(t, `{"eventType":"Transaction","attributes":[
+			{"name":"appName","type":"string","values":["checkout"]},
+			{"name":"duration","type":"numeric","values":["0.5"]},
+			{"name":"host","type":"string","values":["web-1"]}
+		]}`, string(resp.Body))
+
+		resp = send(t, "suggestions?eventType=Transaction&prefix=HO")
+		assert.JSONEq(t, `{"eventType":"Transaction","attributes":[{"name":"host","type":"string","values":["web-1"]}]}`, string(resp.Body))
+	})
+
+	t.Run("results are cached", func(t *testing.T) {
+		delete(executor.results, "SELECT keyset() FROM Transaction SINCE 1 week ago")
+		resp := send(t, "suggestions?eventType=Transaction&prefix=app")
+		assert.JSONEq(t, `{"eventType":"Transaction","attributes":[{"name":"appName","type":"string","values":["checkout"]}]}`, string(resp.Body))
+	})
+
+	t.Run("invalid event type", func(t *testing.T) {
+		resp := send(t, "suggestions?eventType=Bad+Type")
+		assert.Equal(t, http.StatusBadRequest, resp.Status)
+		assert.Contains(t, string(resp.Body), "invalid eventType")
+	})
+}
@@ -0,0 +1,28 @@
+package plugin
+
+import (
+	"net/http"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/handler"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// handleTimeWindowResource handles the time-window resource endpoint, which
+// resolves the since and until parameters, as entered in a query's SINCE and
+// UNTIL clauses, to the absolute window they scan, so the editor can show it.
+// The optional timeZone parameter sets the zone of calendar phrases such as
+// "yesterday". Nothing is sent to New Relic.
+func (d *Datasource) handleTimeWindowResource(req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	params, err := resourceParams(req.URL)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	window, err := handler.ResolveTimeWindow(params.Get("since"), params.Get("until"), params.Get("timeZone"), time.Now())
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return sendJSON(sender, http.StatusOK, window)
+}
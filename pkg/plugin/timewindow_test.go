@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDatasource_HandleTimeWindowResource verifies the time-window resource.
+func TestDatasource_HandleTimeWindowResource(t *testing.T) {
+	send := func(t *testing.T, url string) (*backend.CallResourceResponse, map[string]interface{}) {
+		var captured *backend.CallResourceResponse
+		sender := &mockCallResourceResponseSender{
+			sendFunc: func(resp *backend.CallResourceResponse) error {
+				captured = resp
+				return nil
+			},
+		}
+		req := &backend.CallResourceRequest{Path: "time-window", Method: http.MethodGet, URL: url}
+		require.NoError(t, (&Datasource{}).CallResource(context.Background(), req, sender))
+		require.NotNil(t, captured)
+
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal(captured.Body, &decoded))
+		return captured, decoded
+	}
+
+	t.Run("resolves the window", func(t *testing.T) {
+		resp, body := send(t, "time-window?since=2+HOURS+ago")
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.Equal(t, "2 hours ago", body["since"])
+		assert.Equal(t, "now", body["until"])
+		assert.Equal(t, "2 hours", body["duration"])
+		assert.Regexp(t, `^SINCE \d+ UNTIL \d+$`, body["clause"])
+	})
+
+	t.Run("invalid expression", func(t *testing.T) {
+		resp, body := send(t, "time-window?since=yesterday&until=last+fortnight")
+		assert.Equal(t, http.StatusBadRequest, resp.Status)
+		assert.Contains(t, body["error"], "invalid UNTIL 'last fortnight'")
+	})
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/quota"
+	"newrelic-grafana-plugin/pkg/validator"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// defaultValidationRange is the time range used to expand macros when a
+// validate-query request does not set from and to.
+const defaultValidationRange = time.Hour
+
+// handleValidateQueryResource handles the validate-query resource endpoint, which
+// lets the query editor check an NRQL query before the panel runs it. The query
+// parameter holds the NRQL; accountID overrides the configured account and from
+// and to (epoch milliseconds) set the time range used to expand macros.
+// Problems with the query are reported in the response body with status 200.
+func (d *Datasource) handleValidateQueryResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.PluginContext.DataSourceInstanceSettings == nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": "datasource settings are missing"})
+	}
+	settings := *req.PluginContext.DataSourceInstanceSettings
+
+	config, err := models.LoadPluginSettings(settings)
+	if err == nil {
+		err = validator.ValidatePluginSettings(config)
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Query validation request with invalid configuration", "error", err)
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid plugin configuration: %v", err)})
+	}
+
+	params, err := resourceParams(req.URL)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	accountID, err := resourceAccountID(config, params)
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	timeRange, err := validationTimeRange(params, time.Now())
+	if err != nil {
+		return sendJSON(sender, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	nrClient, err := d.clientForAccount(ctx, config, settings.UID, accountID)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to create New Relic client for query validation", "error", err)
+		return sendJSON(sender, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to create New Relic client: %v", err)})
+	}
+	executor, _ := newMetadataSources(nrClient)
+	if d.budget != nil {
+		executor = &quota.Executor{Executor: executor, Budget: d.budget}
+	}
+
+	validation := handler.ValidateQuery(ctx, executor, accountID, params.Get("query"), timeRange)
+	log.DefaultLogger.Debug("Validated query", "valid", validation.Valid, "accountID", accountID, "durationMs", validation.DurationMs)
+	return sendJSON(sender, http.StatusOK, validation)
+}
+
+// validationTimeRange returns the time range set by the from and to parameters in
+// epoch milliseconds, defaulting to the hour before now.
+func validationTimeRange(params url.Values, now time.Time) (backend.TimeRange, error) {
+	timeRange := backend.TimeRange{From: now.Add(-defaultValidationRange), To: now}
+	for name, target := range map[string]*time.Time{"from": &timeRange.From, "to": &timeRange.To} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || millis < 0 {
+			return backend.TimeRange{}, fmt.Errorf("invalid %s '%s'", name, value)
+		}
+		*target = time.UnixMilli(millis)
+	}
+	if !timeRange.From.Before(timeRange.To) {
+		return backend.TimeRange{}, fmt.Errorf("from must be before to")
+	}
+	return timeRange, nil
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/handler"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/newrelic/newrelic-client-go/v2/newrelic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDatasource_HandleValidateQueryResource verifies the validate-query resource.
+func TestDatasource_HandleValidateQueryResource(t *testing.T) {
+	originalLoadPluginSettings := models.LoadPluginSettings
+	models.LoadPluginSettings = func(settings backend.DataSourceInstanceSettings) (*models.PluginSettings, error) {
+		return &models.PluginSettings{
+			Secrets: &models.SecretPluginSettings{ApiKey: "test-api-key", AccountId: 12345},
+		}, nil
+	}
+	defer func() { models.LoadPluginSettings = originalLoadPluginSettings }()
+
+	executor := &metadataExecutor{}
+	originalSources := newMetadataSources
+	newMetadataSources = func(nrClient *newrelic.NewRelic) (nrdbiface.NRDBQueryExecutor, metadata.AccountLister) {
+		return executor, metadataLister{}
+	}
+	defer func() { newMetadataSources = originalSources }()
+
+	send := func(t *testing.T, rawURL string) *backend.CallResourceResponse {
+		var captured *backend.CallResourceResponse
+		sender := &mockCallResourceResponseSender{
+			sendFunc: func(resp *backend.CallResourceResponse) error {
+				captured = resp
+				return nil
+			},
+		}
+		req := &backend.CallResourceRequest{
+			Path: "validate-query",
+			URL:  rawURL,
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{},
+			},
+		}
+		require.NoError(t, (&Datasource{}).CallResource(context.Background(), req, sender))
+		require.NotNil(t, captured)
+		return captured
+	}
+
+	t.Run("valid query", func(t *testing.T) {
+		query := url.QueryEscape("SELECT count(*) FROM Transaction $__timeFilter FACET appName")
+		resp := send(t, "validate-query?accountID=999&from=1700000000000&to=1700003600000&query="+query)
+		require.Equal(t, http.StatusOK, resp.Status)
+
+		var validation handler.QueryValidation
+		require.NoError(t, json.Unmarshal(resp.Body, &validation))
+		assert.True(t, validation.Valid)
+		assert.True(t, validation.Facet)
+		assert.False(t, validation.Timeseries)
+		assert.Equal(t, []string{"Transaction"}, validation.EventTypes)
+		assert.Equal(t, "SELECT count(*) FROM Transaction SINCE 1700000000000 UNTIL 1700003600000 FACET appName LIMIT 1", validation.Probe)
+		assert.Equal(t, 999, executor.accountID)
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		resp := send(t, "validate-query?query="+url.QueryEscape("SELECT count(*"))
+		require.Equal(t, http.StatusOK, resp.Status)
+
+		var validation handler.QueryValidation
+		require.NoError(t, json.Unmarshal(resp.Body, &validation))
+		assert.False(t, validation.Valid)
+		assert.Equal(t, []string{"query has no FROM clause", "missing ')'"}, validation.Errors)
+	})
+
+	t.Run("invalid time range", func(t *testing.T) {
+		resp := send(t, "validate-query?query=x&from=abc")
+		assert.Equal(t, http.StatusBadRequest, resp.Status)
+		assert.JSONEq(t, `{"error":"invalid from 'abc'"}`, string(resp.Body))
+	})
+}
+
+// TestValidationTimeRange verifies the time range used to expand macros.
+func TestValidationTimeRange(t *testing.T) {
+	now := time.UnixMilli(1700003600000)
+
+	timeRange, err := validationTimeRange(url.Values{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour), timeRange.From)
+	assert.Equal(t, now, timeRange.To)
+
+	_, err = validationTimeRange(url.Values{"from": {"1700003600000"}, "to": {"1700000000000"}}, now)
+	assert.EqualError(t, err, "from must be before to")
+}
@@ -0,0 +1,151 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"newrelic-grafana-plugin/pkg/entitysearch"
+	"newrelic-grafana-plugin/pkg/metadata"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/entities"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+)
+
+// reportKey is the context key carrying a *Report.
+type reportKey struct{}
+
+// Report collects soft limit warnings raised while executing a query.
+type Report struct {
+	mu    sync.Mutex
+	usage *Usage
+}
+
+// WithReport returns a context that collects soft limit warnings into the returned Report.
+func WithReport(ctx context.Context) (context.Context, *Report) {
+	report := &Report{}
+	return context.WithValue(ctx, reportKey{}, report), report
+}
+
+// Notice returns a warning notice if a soft limit was exceeded.
+func (r *Report) Notice() (data.Notice, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.usage == nil {
+		return data.Notice{}, false
+	}
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("Account %d made %d New Relic API calls in the last %s, above the soft limit of %d",
+			r.usage.AccountID, r.usage.Calls, r.usage.Window, r.usage.SoftLimit),
+	}, true
+}
+
+// record stores usage that exceeded the soft limit, keeping the highest call count.
+func (r *Report) record(usage Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.usage == nil || usage.Calls > r.usage.Calls {
+		r.usage = &usage
+	}
+}
+
+// Executor wraps an NRDBQueryExecutor and charges every call to the account's
+// budget. NerdGraph calls made without NRQL are charged by GraphQLExecutor,
+// Searcher and AccountLister.
+type Executor struct {
+	Executor nrdbiface.NRDBQueryExecutor
+	Budget   *Budget
+}
+
+// QueryWithContext executes a standard NRQL query if the account's budget allows it.
+func (e *Executor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	if err := e.reserve(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return e.Executor.QueryWithContext(ctx, accountID, query)
+}
+
+// PerformNRQLQueryWithContext executes an enhanced NRQL query if the account's budget allows it.
+func (e *Executor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	if err := e.reserve(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return e.Executor.PerformNRQLQueryWithContext(ctx, accountID, query)
+}
+
+// reserve charges a call to the budget, logging and reporting soft limit breaches.
+func (e *Executor) reserve(ctx context.Context, accountID int) error {
+	return reserve(ctx, e.Budget, accountID)
+}
+
+// GraphQLExecutor wraps a NerdGraph executor, such as the one of nerdgraph and
+// incidents queries, and charges every call to the budget of AccountID.
+type GraphQLExecutor struct {
+	Executor  nrdbiface.GraphQLExecutor
+	Budget    *Budget
+	AccountID int
+}
+
+// QueryWithResponseAndContext runs a GraphQL query if the account's budget allows it.
+func (e *GraphQLExecutor) QueryWithResponseAndContext(ctx context.Context, query string, variables map[string]interface{}, respBody interface{}) error {
+	if err := reserve(ctx, e.Budget, e.AccountID); err != nil {
+		return err
+	}
+	return e.Executor.QueryWithResponseAndContext(ctx, query, variables, respBody)
+}
+
+// Searcher wraps an entity searcher and charges every search to the budget of
+// AccountID. Entity searches are not scoped to an account, so they are charged
+// to the account the searcher's client was created for.
+type Searcher struct {
+	Searcher  entitysearch.Searcher
+	Budget    *Budget
+	AccountID int
+}
+
+// GetEntitySearchByQueryWithContext searches entities if the account's budget allows it.
+func (s *Searcher) GetEntitySearchByQueryWithContext(ctx context.Context, options entities.EntitySearchOptions, query string, sortBy []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error) {
+	if err := reserve(ctx, s.Budget, s.AccountID); err != nil {
+		return nil, err
+	}
+	return s.Searcher.GetEntitySearchByQueryWithContext(ctx, options, query, sortBy)
+}
+
+// AccountLister wraps an account lister and charges every listing to the
+// budget of AccountID.
+type AccountLister struct {
+	Lister    metadata.AccountLister
+	Budget    *Budget
+	AccountID int
+}
+
+// ListAccountsWithContext lists the accounts if the account's budget allows it.
+func (l *AccountLister) ListAccountsWithContext(ctx context.Context, params accounts.ListAccountsParams) ([]accounts.AccountOutline, error) {
+	if err := reserve(ctx, l.Budget, l.AccountID); err != nil {
+		return nil, err
+	}
+	return l.Lister.ListAccountsWithContext(ctx, params)
+}
+
+// reserve charges a call to budget, logging and reporting soft limit breaches.
+func reserve(ctx context.Context, budget *Budget, accountID int) error {
+	usage, err := budget.Reserve(accountID)
+	if err != nil {
+		log.DefaultLogger.Warn("Query budget hard limit reached", "accountID", accountID, "calls", usage.Calls, "window", usage.Window, "hardLimit", usage.HardLimit)
+		return err
+	}
+	if usage.OverSoftLimit() {
+		log.DefaultLogger.Warn("Query budget soft limit exceeded", "accountID", accountID, "calls", usage.Calls, "window", usage.Window, "softLimit", usage.SoftLimit)
+		if report, ok := ctx.Value(reportKey{}).(*Report); ok {
+			report.record(usage)
+		}
+	}
+	return nil
+}
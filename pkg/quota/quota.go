@@ -0,0 +1,171 @@
+// Package quota tracks New Relic API calls per account over a rolling window and
+// enforces the configured query budget. Exceeding the soft limit adds a warning
+// to the query response; exceeding the hard limit rejects the query, so a
+// misconfigured auto-refreshing dashboard cannot use up an account's API quota.
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
+)
+
+// DefaultWindow is the rolling window used when no window is configured.
+const DefaultWindow = time.Minute
+
+// ConfigError represents an invalid query budget configuration.
+type ConfigError struct {
+	Msg string
+	Err error // Wrapped error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("invalid query budget: %v", e.Err)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("invalid query budget: %s: %v", e.Msg, e.Err)
+	}
+	return fmt.Sprintf("invalid query budget: %s", e.Msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ExceededError is returned when a call would exceed an account's hard limit.
+type ExceededError struct {
+	Usage Usage
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("query budget exceeded for account %d: %d New Relic API calls in the last %s (hard limit %d); try again later or lower the dashboard refresh rate",
+		e.Usage.AccountID, e.Usage.Calls, e.Usage.Window, e.Usage.HardLimit)
+}
+
+// Usage describes an account's API calls within the current window.
+type Usage struct {
+	AccountID int
+	Calls     int // Calls in the window, including the one just reserved
+	Window    time.Duration
+	SoftLimit int
+	HardLimit int
+}
+
+// OverSoftLimit reports whether the calls exceed the soft limit.
+func (u Usage) OverSoftLimit() bool {
+	return u.SoftLimit > 0 && u.Calls > u.SoftLimit
+}
+
+// Stats describes the budget configuration and each account's calls in the current window.
+type Stats struct {
+	Window    string      `json:"window"`
+	SoftLimit int         `json:"softLimit"`
+	HardLimit int         `json:"hardLimit"`
+	Calls     map[int]int `json:"calls"` // Calls in the window by account ID
+}
+
+// Budget counts API calls per account in a rolling window. It is safe for concurrent use.
+type Budget struct {
+	window    time.Duration
+	softLimit int
+	hardLimit int
+	now       func() time.Time
+
+	mu    sync.Mutex
+	calls map[int][]time.Time
+}
+
+// NewBudget validates the budget settings and creates a Budget. At least one of
+// the soft and hard limits must be set; a limit of zero disables it.
+func NewBudget(settings models.QueryBudgetSettings) (*Budget, error) {
+	window := DefaultWindow
+	if settings.Window != "" {
+		var err error
+		window, err = timeutil.ParseDurationField("queryBudget.window", settings.Window)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	}
+	if settings.SoftLimit < 0 || settings.HardLimit < 0 {
+		return nil, &ConfigError{Msg: "limits must not be negative"}
+	}
+	if settings.SoftLimit == 0 && settings.HardLimit == 0 {
+		return nil, &ConfigError{Msg: "either softLimit or hardLimit must be set"}
+	}
+	if settings.SoftLimit > 0 && settings.HardLimit > 0 && settings.SoftLimit >= settings.HardLimit {
+		return nil, &ConfigError{Msg: fmt.Sprintf("softLimit (%d) must be lower than hardLimit (%d)", settings.SoftLimit, settings.HardLimit)}
+	}
+
+	return &Budget{
+		window:    window,
+		softLimit: settings.SoftLimit,
+		hardLimit: settings.HardLimit,
+		now:       time.Now,
+		calls:     make(map[int][]time.Time),
+	}, nil
+}
+
+// Reserve records a call for the account and returns the resulting usage. If the
+// call would exceed the hard limit it is not recorded and an *ExceededError is returned.
+func (b *Budget) Reserve(accountID int) (Usage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	calls := b.prune(accountID, now)
+
+	usage := Usage{
+		AccountID: accountID,
+		Calls:     len(calls),
+		Window:    b.window,
+		SoftLimit: b.softLimit,
+		HardLimit: b.hardLimit,
+	}
+	if b.hardLimit > 0 && len(calls) >= b.hardLimit {
+		return usage, &ExceededError{Usage: usage}
+	}
+
+	b.calls[accountID] = append(calls, now)
+	usage.Calls++
+	return usage, nil
+}
+
+// Stats returns the budget limits and the per-account calls in the current window.
+func (b *Budget) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	stats := Stats{
+		Window:    b.window.String(),
+		SoftLimit: b.softLimit,
+		HardLimit: b.hardLimit,
+		Calls:     make(map[int]int),
+	}
+	for accountID := range b.calls {
+		if calls := b.prune(accountID, now); len(calls) > 0 {
+			b.calls[accountID] = calls
+			stats.Calls[accountID] = len(calls)
+		}
+	}
+	return stats
+}
+
+// prune drops the account's calls that fell out of the window and returns the rest.
+func (b *Budget) prune(accountID int, now time.Time) []time.Time {
+	calls := b.calls[accountID]
+	cutoff := now.Add(-b.window)
+	i := 0
+	for i < len(calls) && !calls[i].After(cutoff) {
+		i++
+	}
+	calls = calls[i:]
+	if len(calls) == 0 {
+		delete(b.calls, accountID)
+	}
+	return calls
+}
@@ -0,0 +1,212 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/nrdbiface"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/accounts"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/entities"
+	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingExecutor counts the queries that reach the underlying executor.
+type countingExecutor struct {
+	calls int
+}
+
+func (e *countingExecutor) QueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainer, error) {
+	e.calls++
+	return &nrdb.NRDBResultContainer{}, nil
+}
+
+func (e *countingExecutor) PerformNRQLQueryWithContext(ctx context.Context, accountID int, query nrdb.NRQL) (*nrdb.NRDBResultContainerMultiResultCustomized, error) {
+	e.calls++
+	return &nrdb.NRDBResultContainerMultiResultCustomized{}, nil
+}
+
+// newTestBudget creates a budget whose clock is controlled by the returned pointer.
+func newTestBudget(t *testing.T, settings models.QueryBudgetSettings) (*Budget, *time.Time) {
+	t.Helper()
+	budget, err := NewBudget(settings)
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	budget.now = func() time.Time { return now }
+	return budget, &now
+}
+
+func TestNewBudget(t *testing.T) {
+	tests := []struct {
+		name        string
+		settings    models.QueryBudgetSettings
+		wantWindow  time.Duration
+		errContains string
+	}{
+		{name: "default window", settings: models.QueryBudgetSettings{HardLimit: 10}, wantWindow: time.Minute},
+		{name: "custom window", settings: models.QueryBudgetSettings{Window: "5m", SoftLimit: 5, HardLimit: 10}, wantWindow: 5 * time.Minute},
+		{name: "soft limit only", settings: models.QueryBudgetSettings{SoftLimit: 5}, wantWindow: time.Minute},
+		{name: "invalid window", settings: models.QueryBudgetSettings{Window: "soon", HardLimit: 10}, errContains: "queryBudget.window"},
+		{name: "no limits", settings: models.QueryBudgetSettings{Window: "1m"}, errContains: "either softLimit or hardLimit must be set"},
+		{name: "negative limit", settings: models.QueryBudgetSettings{HardLimit: -1}, errContains: "must not be negative"},
+		{name: "soft not below hard", settings: models.QueryBudgetSettings{SoftLimit: 10, HardLimit: 10}, errContains: "softLimit (10) must be lower than hardLimit (10)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget, err := NewBudget(tt.settings)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				var configErr *ConfigError
+				assert.True(t, errors.As(err, &configErr))
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWindow, budget.window)
+		})
+	}
+}
+
+func TestBudget_Reserve(t *testing.T) {
+	budget, now := newTestBudget(t, models.QueryBudgetSettings{Window: "1m", SoftLimit: 1, HardLimit: 2})
+
+	usage, err := budget.Reserve(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.Calls)
+	assert.False(t, usage.OverSoftLimit())
+
+	*now = now.Add(10 * time.Second)
+	usage, err = budget.Reserve(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.Calls)
+	assert.True(t, usage.OverSoftLimit())
+
+	_, err = budget.Reserve(1)
+	var exceeded *ExceededError
+	require.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, 2, exceeded.Usage.Calls)
+	assert.Contains(t, err.Error(), "query budget exceeded for account 1: 2 New Relic API calls in the last 1m0s (hard limit 2)")
+
+	// Accounts have separate budgets
+	usage, err = budget.Reserve(2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.Calls)
+
+	// The first call leaves the window
+	*now = now.Add(50 * time.Second)
+	usage, err = budget.Reserve(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.Calls)
+}
+
+func TestExecutor(t *testing.T) {
+	budget, _ := newTestBudget(t, models.QueryBudgetSettings{SoftLimit: 1, HardLimit: 3})
+	inner := &countingExecutor{}
+	executor := &Executor{Executor: inner, Budget: budget}
+
+	ctx, report := WithReport(context.Background())
+	_, err := executor.QueryWithContext(ctx, 7, "SELECT 1")
+	require.NoError(t, err)
+	_, ok := report.Notice()
+	assert.False(t, ok, "no notice below the soft limit")
+
+	_, err = executor.PerformNRQLQueryWithContext(ctx, 7, "SELECT 1")
+	require.NoError(t, err)
+	notice, ok := report.Notice()
+	require.True(t, ok)
+	assert.Equal(t, data.NoticeSeverityWarning, notice.Severity)
+	assert.Contains(t, notice.Text, "Account 7 made 2 New Relic API calls")
+
+	// Without a report the soft limit is only logged
+	_, err = executor.QueryWithContext(context.Background(), 7, "SELECT 1")
+	require.NoError(t, err)
+
+	_, err = executor.QueryWithContext(ctx, 7, "SELECT 1")
+	var exceeded *ExceededError
+	assert.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, 3, inner.calls, "rejected queries must not reach the API")
+}
+
+// countingSearcher counts the entity searches that reach the underlying searcher.
+type countingSearcher struct {
+	calls int
+}
+
+func (s *countingSearcher) GetEntitySearchByQueryWithContext(ctx context.Context, options entities.EntitySearchOptions, query string, sortBy []entities.EntitySearchSortCriteria) (*entities.EntitySearch, error) {
+	s.calls++
+	return &entities.EntitySearch{}, nil
+}
+
+// countingLister counts the account listings that reach the underlying lister.
+type countingLister struct {
+	calls int
+}
+
+func (l *countingLister) ListAccountsWithContext(ctx context.Context, params accounts.ListAccountsParams) ([]accounts.AccountOutline, error) {
+	l.calls++
+	return nil, nil
+}
+
+// TestNerdGraphCallsCharged verifies that NerdGraph calls made without NRQL are
+// charged to the same budget as NRQL queries.
+func TestNerdGraphCallsCharged(t *testing.T) {
+	budget, _ := newTestBudget(t, models.QueryBudgetSettings{HardLimit: 4})
+	ctx := context.Background()
+
+	nrqlCalls := &countingExecutor{}
+	_, err := (&Executor{Executor: nrqlCalls, Budget: budget}).QueryWithContext(ctx, 7, "SELECT 1")
+	require.NoError(t, err)
+
+	graphQLCalls := 0
+	graphQL := &GraphQLExecutor{Budget: budget, AccountID: 7, Executor: nrdbiface.GraphQLExecutorFunc(func(context.Context, string, map[string]interface{}) (interface{}, error) {
+		graphQLCalls++
+		return map[string]interface{}{}, nil
+	})}
+	require.NoError(t, graphQL.QueryWithResponseAndContext(ctx, "{ actor { user { email } } }", nil, &map[string]interface{}{}))
+
+	searcher := &countingSearcher{}
+	_, err = (&Searcher{Searcher: searcher, Budget: budget, AccountID: 7}).GetEntitySearchByQueryWithContext(ctx, entities.EntitySearchOptions{}, "name = 'web'", nil)
+	require.NoError(t, err)
+
+	lister := &countingLister{}
+	_, err = (&AccountLister{Lister: lister, Budget: budget, AccountID: 7}).ListAccountsWithContext(ctx, accounts.ListAccountsParams{})
+	require.NoError(t, err)
+
+	// The budget of 4 calls is used up by one call of each kind
+	var exceeded *ExceededError
+	err = graphQL.QueryWithResponseAndContext(ctx, "{ actor { user { email } } }", nil, &map[string]interface{}{})
+	assert.True(t, errors.As(err, &exceeded))
+	_, err = (&Searcher{Searcher: searcher, Budget: budget, AccountID: 7}).GetEntitySearchByQueryWithContext(ctx, entities.EntitySearchOptions{}, "name = 'web'", nil)
+	assert.True(t, errors.As(err, &exceeded))
+	assert.Equal(t, 1, graphQLCalls, "rejected calls must not reach the API")
+	assert.Equal(t, 1, searcher.calls)
+	assert.Equal(t, 1, lister.calls)
+}
+
+func TestBudget_Stats(t *testing.T) {
+	budget, now := newTestBudget(t, models.QueryBudgetSettings{Window: "1m", SoftLimit: 1, HardLimit: 5})
+
+	_, err := budget.Reserve(1)
+	require.NoError(t, err)
+	*now = now.Add(30 * time.Second)
+	_, err = budget.Reserve(1)
+	require.NoError(t, err)
+	_, err = budget.Reserve(2)
+	require.NoError(t, err)
+
+	stats := budget.Stats()
+	assert.Equal(t, "1m0s", stats.Window)
+	assert.Equal(t, 1, stats.SoftLimit)
+	assert.Equal(t, 5, stats.HardLimit)
+	assert.Equal(t, map[int]int{1: 2, 2: 1}, stats.Calls)
+
+	*now = now.Add(45 * time.Second)
+	assert.Equal(t, map[int]int{1: 1, 2: 1}, budget.Stats().Calls)
+}
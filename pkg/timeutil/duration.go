@@ -0,0 +1,94 @@
+package timeutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits maps the Grafana-style duration units to their length. Days and
+// weeks are nominal (24h and 7 days); calendar months and years are not accepted
+// because they have no fixed length.
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  Day,
+	"w":  7 * Day,
+}
+
+// DurationError reports an invalid duration in a user-supplied setting or query field.
+type DurationError struct {
+	Field string // Setting or query field the value came from, e.g. "warmup.ttl"
+	Value string
+	Msg   string
+}
+
+func (e *DurationError) Error() string {
+	return fmt.Sprintf("invalid duration for %s: '%s': %s", e.Field, e.Value, e.Msg)
+}
+
+// ParseDuration parses a Grafana-style duration such as "30s", "5m", "1h30m" or
+// "1d12h". Each segment is a whole number followed by one of ms, s, m, h, d or w.
+// Bare numbers are rejected so that a missing unit is never mistaken for seconds.
+func ParseDuration(s string) (time.Duration, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return 0, fmt.Errorf("duration is empty")
+	}
+
+	var total time.Duration
+	for rest := value; rest != ""; {
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 {
+			return 0, fmt.Errorf("expected a number at '%s'", rest)
+		}
+		number, err := strconv.ParseInt(rest[:digits], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("number '%s' is out of range", rest[:digits])
+		}
+		rest = rest[digits:]
+
+		unitLen := 0
+		for unitLen < len(rest) && (rest[unitLen] < '0' || rest[unitLen] > '9') {
+			unitLen++
+		}
+		if unitLen == 0 {
+			return 0, fmt.Errorf("missing unit after %d, expected one of ms, s, m, h, d, w", number)
+		}
+		unit, ok := durationUnits[rest[:unitLen]]
+		if !ok {
+			return 0, fmt.Errorf("unknown unit '%s', expected one of ms, s, m, h, d, w", rest[:unitLen])
+		}
+		rest = rest[unitLen:]
+
+		if number > int64((1<<63-1)/unit) {
+			return 0, fmt.Errorf("duration is too large")
+		}
+		segment := time.Duration(number) * unit
+		if total > (1<<63-1)-segment {
+			return 0, fmt.Errorf("duration is too large")
+		}
+		total += segment
+	}
+	return total, nil
+}
+
+// ParseDurationField parses value with ParseDuration for the named field and
+// requires the result to be positive. Errors are *DurationError values that
+// name the field, so they can be shown to users as is.
+func ParseDurationField(field, value string) (time.Duration, error) {
+	d, err := ParseDuration(value)
+	if err != nil {
+		return 0, &DurationError{Field: field, Value: value, Msg: err.Error()}
+	}
+	if d <= 0 {
+		return 0, &DurationError{Field: field, Value: value, Msg: "must be greater than zero"}
+	}
+	return d, nil
+}
@@ -0,0 +1,60 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr string
+	}{
+		{input: "30s", want: 30 * time.Second},
+		{input: "5m", want: 5 * time.Minute},
+		{input: "1h30m", want: 90 * time.Minute},
+		{input: "1d12h", want: 36 * time.Hour},
+		{input: "2w", want: 14 * Day},
+		{input: "250ms", want: 250 * time.Millisecond},
+		{input: " 10s ", want: 10 * time.Second},
+		{input: "0s", want: 0},
+		{input: "", wantErr: "duration is empty"},
+		{input: "30", wantErr: "missing unit after 30"},
+		{input: "1y", wantErr: "unknown unit 'y'"},
+		{input: "1.5h", wantErr: "unknown unit '.'"},
+		{input: "-5m", wantErr: "expected a number at '-5m'"},
+		{input: "h", wantErr: "expected a number at 'h'"},
+		{input: "999999999w", wantErr: "duration is too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDurationField(t *testing.T) {
+	got, err := ParseDurationField("cache.ttl", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, got)
+
+	_, err = ParseDurationField("cache.ttl", "soon")
+	var durationErr *DurationError
+	require.ErrorAs(t, err, &durationErr)
+	assert.Equal(t, "cache.ttl", durationErr.Field)
+	assert.Equal(t, "invalid duration for cache.ttl: 'soon': expected a number at 'soon'", err.Error())
+
+	_, err = ParseDurationField("query.timeout", "0s")
+	assert.EqualError(t, err, "invalid duration for query.timeout: '0s': must be greater than zero")
+}
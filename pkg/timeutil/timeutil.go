@@ -0,0 +1,189 @@
+// Package timeutil provides shared time and bucket arithmetic for the New Relic
+// Grafana plugin. It converts NRDB epoch values into time.Time, infers bucket
+// widths from timeseries results, and aligns and quantizes ranges so that gap
+// filling, comparison alignment, and downsampling all agree on bucket boundaries.
+// It also parses the Grafana-style durations used by user-supplied settings.
+package timeutil
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Day is the nominal length of a calendar day. Buckets that are whole multiples
+// of a day are aligned on local calendar dates rather than absolute durations.
+const Day = 24 * time.Hour
+
+// FromEpochMillis converts an NRDB millisecond epoch value (e.g. the timestamp
+// attribute) into a time.Time, truncated to whole seconds.
+func FromEpochMillis(ms float64) time.Time {
+	return time.Unix(int64(ms/1000), 0)
+}
+
+// Epoch values of at least these magnitudes are read by FromEpoch as
+// milliseconds, microseconds and nanoseconds; smaller values are seconds. Each
+// bound is 1973-03-03 in the smaller unit, so every unit covers the years
+// 1973 to 5138.
+const (
+	epochMillisMin = 1e11
+	epochMicrosMin = 1e14
+	epochNanosMin  = 1e17
+)
+
+// FromEpoch converts an epoch value whose unit is not known, such as the
+// timestamp of logs and custom events, into a time.Time truncated to whole
+// seconds. The unit (seconds, milliseconds, microseconds or nanoseconds) is
+// inferred from the magnitude of the value.
+func FromEpoch(v float64) time.Time {
+	switch abs := math.Abs(v); {
+	case abs >= epochNanosMin:
+		return FromEpochSeconds(v / 1e9)
+	case abs >= epochMicrosMin:
+		return FromEpochSeconds(v / 1e6)
+	case abs >= epochMillisMin:
+		return FromEpochMillis(v)
+	default:
+		return FromEpochSeconds(v)
+	}
+}
+
+// FromEpochSeconds converts an NRDB second epoch value (e.g. beginTimeSeconds)
+// into a time.Time, truncated to whole seconds.
+func FromEpochSeconds(s float64) time.Time {
+	return time.Unix(int64(s), 0)
+}
+
+// InferBucketWidth infers the bucket width of a timeseries from its timestamps.
+// It returns the most common positive gap between consecutive distinct timestamps,
+// preferring the smallest gap on ties. It returns 0 if fewer than two distinct
+// timestamps are given.
+func InferBucketWidth(times []time.Time) time.Duration {
+	sorted := SortedUnique(times)
+	if len(sorted) < 2 {
+		return 0
+	}
+
+	counts := make(map[time.Duration]int)
+	for i := 1; i < len(sorted); i++ {
+		counts[sorted[i].Sub(sorted[i-1])]++
+	}
+
+	var width time.Duration
+	best := 0
+	for gap, count := range counts {
+		if count > best || (count == best && gap < width) {
+			width = gap
+			best = count
+		}
+	}
+	return width
+}
+
+// AlignToBucket returns the start of the bucket containing t.
+//
+// Widths that are whole multiples of a day are aligned on calendar days in loc
+// (a nil loc means UTC), so daily buckets start at local midnight even across
+// DST transitions. Shorter widths are aligned on absolute time from the Unix
+// epoch. A non-positive width returns t unchanged.
+func AlignToBucket(t time.Time, width time.Duration, loc *time.Location) time.Time {
+	if width <= 0 {
+		return t
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if width%Day == 0 {
+		days := int(width / Day)
+		local := t.In(loc)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		// Count calendar days since the epoch in loc so multi-day buckets are stable.
+		epochDays := daysSinceEpoch(midnight)
+		offset := epochDays % days
+		if offset < 0 {
+			offset += days
+		}
+		return midnight.AddDate(0, 0, -offset)
+	}
+
+	nanos := t.UnixNano()
+	w := int64(width)
+	rem := nanos % w
+	if rem < 0 {
+		rem += w
+	}
+	return time.Unix(0, nanos-rem).In(t.Location())
+}
+
+// NextBucket returns the start of the bucket following the one starting at start.
+// Day-multiple widths advance by calendar days in start's location.
+func NextBucket(start time.Time, width time.Duration) time.Time {
+	if width%Day == 0 {
+		return start.AddDate(0, 0, int(width/Day))
+	}
+	return start.Add(width)
+}
+
+// QuantizeRange expands [from, to] outward to whole buckets. The returned from is
+// the start of the bucket containing from; the returned to is the end of the
+// bucket containing to (or to itself if it already lies on a boundary).
+func QuantizeRange(from, to time.Time, width time.Duration, loc *time.Location) (time.Time, time.Time) {
+	if width <= 0 {
+		return from, to
+	}
+	qFrom := AlignToBucket(from, width, loc)
+	qTo := AlignToBucket(to, width, loc)
+	if qTo.Before(to) {
+		qTo = NextBucket(qTo, width)
+	}
+	return qFrom, qTo
+}
+
+// BucketStarts returns the start of every bucket of the given width that
+// overlaps [from, to). It returns nil for a non-positive width or empty range.
+func BucketStarts(from, to time.Time, width time.Duration, loc *time.Location) []time.Time {
+	if width <= 0 || !from.Before(to) {
+		return nil
+	}
+	var starts []time.Time
+	for t := AlignToBucket(from, width, loc); t.Before(to); t = NextBucket(t, width) {
+		starts = append(starts, t)
+	}
+	return starts
+}
+
+// UnionBuckets merges several series of bucket timestamps into one sorted list
+// of distinct timestamps.
+func UnionBuckets(series ...[]time.Time) []time.Time {
+	var all []time.Time
+	for _, s := range series {
+		all = append(all, s...)
+	}
+	return SortedUnique(all)
+}
+
+// SortedUnique returns the distinct timestamps in ascending order.
+func SortedUnique(times []time.Time) []time.Time {
+	if len(times) == 0 {
+		return nil
+	}
+	sorted := make([]time.Time, len(times))
+	copy(sorted, times)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	unique := sorted[:1]
+	for _, t := range sorted[1:] {
+		if !t.Equal(unique[len(unique)-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// daysSinceEpoch counts calendar days between 1970-01-01 and the date of t,
+// ignoring the time of day and any DST offset.
+func daysSinceEpoch(t time.Time) int {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int(date.Unix() / int64(Day/time.Second))
+}
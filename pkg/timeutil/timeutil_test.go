@@ -0,0 +1,308 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func utc(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+}
+
+func TestFromEpoch(t *testing.T) {
+	t.Run("milliseconds", func(t *testing.T) {
+		got := FromEpochMillis(1750148571123)
+		assert.True(t, got.Equal(time.Unix(1750148571, 0)))
+	})
+
+	t.Run("seconds", func(t *testing.T) {
+		got := FromEpochSeconds(1750148571)
+		assert.True(t, got.Equal(time.Unix(1750148571, 0)))
+	})
+}
+
+func TestFromEpoch_DetectsUnit(t *testing.T) {
+	want := time.Unix(1750148571, 0)
+	tests := []struct {
+		name  string
+		value float64
+	}{
+		{"seconds", 1750148571},
+		{"milliseconds", 1750148571123},
+		{"microseconds", 1750148571123456},
+		{"nanoseconds", 1750148571123456789},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FromEpoch(tt.value)
+			assert.True(t, got.Equal(want), "expected %s, got %s", want, got)
+		})
+	}
+
+	// Bounds fall on 1973-03-03 in each unit
+	assert.Equal(t, 1973, FromEpoch(1e11).UTC().Year())
+	assert.Equal(t, 1973, FromEpoch(1e14).UTC().Year())
+	assert.Equal(t, 1973, FromEpoch(1e17).UTC().Year())
+	assert.Equal(t, 5138, FromEpoch(1e11-1).UTC().Year())
+}
+
+func TestInferBucketWidth(t *testing.T) {
+	base := utc(2024, 1, 1, 0, 0, 0)
+
+	tests := []struct {
+		name     string
+		times    []time.Time
+		expected time.Duration
+	}{
+		{
+			name:     "empty",
+			times:    nil,
+			expected: 0,
+		},
+		{
+			name:     "single timestamp",
+			times:    []time.Time{base},
+			expected: 0,
+		},
+		{
+			name:     "duplicates only",
+			times:    []time.Time{base, base, base},
+			expected: 0,
+		},
+		{
+			name: "regular minutes",
+			times: []time.Time{
+				base, base.Add(time.Minute), base.Add(2 * time.Minute), base.Add(3 * time.Minute),
+			},
+			expected: time.Minute,
+		},
+		{
+			name: "unsorted input",
+			times: []time.Time{
+				base.Add(10 * time.Minute), base, base.Add(5 * time.Minute),
+			},
+			expected: 5 * time.Minute,
+		},
+		{
+			name: "gap in series uses most common width",
+			times: []time.Time{
+				base, base.Add(time.Minute), base.Add(2 * time.Minute), base.Add(10 * time.Minute), base.Add(11 * time.Minute),
+			},
+			expected: time.Minute,
+		},
+		{
+			name: "tie prefers smallest gap",
+			times: []time.Time{
+				base, base.Add(time.Minute), base.Add(3 * time.Minute),
+			},
+			expected: time.Minute,
+		},
+		{
+			name: "repeated timestamps from multiple facets",
+			times: []time.Time{
+				base, base, base.Add(30 * time.Second), base.Add(30 * time.Second), base.Add(time.Minute),
+			},
+			expected: 30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, InferBucketWidth(tt.times))
+		})
+	}
+}
+
+func TestAlignToBucket(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    time.Time
+		width    time.Duration
+		expected time.Time
+	}{
+		{"zero width unchanged", utc(2024, 1, 1, 10, 7, 31), 0, utc(2024, 1, 1, 10, 7, 31)},
+		{"negative width unchanged", utc(2024, 1, 1, 10, 7, 31), -time.Minute, utc(2024, 1, 1, 10, 7, 31)},
+		{"minute", utc(2024, 1, 1, 10, 7, 31), time.Minute, utc(2024, 1, 1, 10, 7, 0)},
+		{"five minutes", utc(2024, 1, 1, 10, 7, 31), 5 * time.Minute, utc(2024, 1, 1, 10, 5, 0)},
+		{"already aligned", utc(2024, 1, 1, 10, 5, 0), 5 * time.Minute, utc(2024, 1, 1, 10, 5, 0)},
+		{"hour", utc(2024, 1, 1, 10, 59, 59), time.Hour, utc(2024, 1, 1, 10, 0, 0)},
+		{"seven seconds aligned on epoch", time.Unix(20, 0).UTC(), 7 * time.Second, time.Unix(14, 0).UTC()},
+		{"day", utc(2024, 3, 15, 23, 59, 59), Day, utc(2024, 3, 15, 0, 0, 0)},
+		{"before epoch", time.Unix(-90, 0).UTC(), time.Minute, time.Unix(-120, 0).UTC()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AlignToBucket(tt.input, tt.width, nil)
+			assert.True(t, tt.expected.Equal(got), "expected %s, got %s", tt.expected, got)
+		})
+	}
+}
+
+func TestAlignToBucket_MultiDayIsStable(t *testing.T) {
+	width := 7 * Day
+	first := AlignToBucket(utc(2024, 1, 3, 12, 0, 0), width, nil)
+	for d := 0; d < 7; d++ {
+		got := AlignToBucket(first.AddDate(0, 0, d).Add(5*time.Hour), width, nil)
+		assert.True(t, first.Equal(got), "day %d: expected %s, got %s", d, first, got)
+	}
+	next := AlignToBucket(first.AddDate(0, 0, 7), width, nil)
+	assert.True(t, first.AddDate(0, 0, 7).Equal(next))
+}
+
+func TestAlignToBucket_DSTSafe(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+
+	// 2024-03-10 is the US spring-forward day: the local day is only 23 hours long.
+	springForward := time.Date(2024, 3, 10, 15, 30, 0, 0, loc)
+	got := AlignToBucket(springForward, Day, loc)
+	assert.Equal(t, time.Date(2024, 3, 10, 0, 0, 0, 0, loc), got)
+
+	// 2024-11-03 is the US fall-back day: the local day is 25 hours long.
+	fallBack := time.Date(2024, 11, 3, 23, 30, 0, 0, loc)
+	got = AlignToBucket(fallBack, Day, loc)
+	assert.Equal(t, time.Date(2024, 11, 3, 0, 0, 0, 0, loc), got)
+
+	// Input in another zone is interpreted in loc.
+	got = AlignToBucket(time.Date(2024, 3, 11, 3, 0, 0, 0, time.UTC), Day, loc)
+	assert.Equal(t, time.Date(2024, 3, 10, 0, 0, 0, 0, loc), got)
+}
+
+func TestNextBucket(t *testing.T) {
+	loc := mustLoadLocation(t, "Europe/Berlin")
+
+	t.Run("sub-day width adds absolute duration", func(t *testing.T) {
+		start := utc(2024, 1, 1, 10, 0, 0)
+		assert.Equal(t, utc(2024, 1, 1, 10, 15, 0), NextBucket(start, 15*time.Minute))
+	})
+
+	t.Run("day width across DST keeps local midnight", func(t *testing.T) {
+		// Europe/Berlin springs forward on 2024-03-31.
+		start := time.Date(2024, 3, 31, 0, 0, 0, 0, loc)
+		next := NextBucket(start, Day)
+		assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, loc), next)
+		assert.Equal(t, 23*time.Hour, next.Sub(start))
+	})
+}
+
+func TestQuantizeRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		from, to     time.Time
+		width        time.Duration
+		expectedFrom time.Time
+		expectedTo   time.Time
+	}{
+		{
+			name:         "expands both ends",
+			from:         utc(2024, 1, 1, 10, 2, 0),
+			to:           utc(2024, 1, 1, 10, 58, 0),
+			width:        5 * time.Minute,
+			expectedFrom: utc(2024, 1, 1, 10, 0, 0),
+			expectedTo:   utc(2024, 1, 1, 11, 0, 0),
+		},
+		{
+			name:         "aligned range unchanged",
+			from:         utc(2024, 1, 1, 10, 0, 0),
+			to:           utc(2024, 1, 1, 11, 0, 0),
+			width:        5 * time.Minute,
+			expectedFrom: utc(2024, 1, 1, 10, 0, 0),
+			expectedTo:   utc(2024, 1, 1, 11, 0, 0),
+		},
+		{
+			name:         "zero width unchanged",
+			from:         utc(2024, 1, 1, 10, 2, 0),
+			to:           utc(2024, 1, 1, 10, 58, 0),
+			width:        0,
+			expectedFrom: utc(2024, 1, 1, 10, 2, 0),
+			expectedTo:   utc(2024, 1, 1, 10, 58, 0),
+		},
+		{
+			name:         "daily buckets",
+			from:         utc(2024, 1, 1, 10, 0, 0),
+			to:           utc(2024, 1, 3, 1, 0, 0),
+			width:        Day,
+			expectedFrom: utc(2024, 1, 1, 0, 0, 0),
+			expectedTo:   utc(2024, 1, 4, 0, 0, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := QuantizeRange(tt.from, tt.to, tt.width, nil)
+			assert.True(t, tt.expectedFrom.Equal(from), "from: expected %s, got %s", tt.expectedFrom, from)
+			assert.True(t, tt.expectedTo.Equal(to), "to: expected %s, got %s", tt.expectedTo, to)
+		})
+	}
+}
+
+func TestBucketStarts(t *testing.T) {
+	t.Run("minute buckets", func(t *testing.T) {
+		starts := BucketStarts(utc(2024, 1, 1, 10, 0, 30), utc(2024, 1, 1, 10, 3, 0), time.Minute, nil)
+		require.Len(t, starts, 3)
+		assert.Equal(t, utc(2024, 1, 1, 10, 0, 0), starts[0])
+		assert.Equal(t, utc(2024, 1, 1, 10, 1, 0), starts[1])
+		assert.Equal(t, utc(2024, 1, 1, 10, 2, 0), starts[2])
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		assert.Nil(t, BucketStarts(utc(2024, 1, 1, 10, 0, 0), utc(2024, 1, 1, 10, 0, 0), time.Minute, nil))
+	})
+
+	t.Run("inverted range", func(t *testing.T) {
+		assert.Nil(t, BucketStarts(utc(2024, 1, 1, 11, 0, 0), utc(2024, 1, 1, 10, 0, 0), time.Minute, nil))
+	})
+
+	t.Run("zero width", func(t *testing.T) {
+		assert.Nil(t, BucketStarts(utc(2024, 1, 1, 10, 0, 0), utc(2024, 1, 1, 11, 0, 0), 0, nil))
+	})
+
+	t.Run("daily buckets across DST", func(t *testing.T) {
+		loc := mustLoadLocation(t, "America/New_York")
+		from := time.Date(2024, 3, 9, 12, 0, 0, 0, loc)
+		to := time.Date(2024, 3, 12, 0, 0, 0, 0, loc)
+		starts := BucketStarts(from, to, Day, loc)
+		require.Len(t, starts, 3)
+		for i, s := range starts {
+			assert.Equal(t, 0, s.Hour(), "bucket %d should start at local midnight", i)
+			assert.Equal(t, 9+i, s.Day())
+		}
+	})
+}
+
+func TestUnionBuckets(t *testing.T) {
+	a := []time.Time{utc(2024, 1, 1, 10, 0, 0), utc(2024, 1, 1, 10, 2, 0)}
+	b := []time.Time{utc(2024, 1, 1, 10, 1, 0), utc(2024, 1, 1, 10, 2, 0), utc(2024, 1, 1, 10, 3, 0)}
+
+	union := UnionBuckets(a, b, nil)
+	expected := []time.Time{
+		utc(2024, 1, 1, 10, 0, 0),
+		utc(2024, 1, 1, 10, 1, 0),
+		utc(2024, 1, 1, 10, 2, 0),
+		utc(2024, 1, 1, 10, 3, 0),
+	}
+	assert.Equal(t, expected, union)
+
+	assert.Nil(t, UnionBuckets())
+}
+
+func TestSortedUnique_DoesNotModifyInput(t *testing.T) {
+	input := []time.Time{utc(2024, 1, 1, 10, 2, 0), utc(2024, 1, 1, 10, 0, 0), utc(2024, 1, 1, 10, 2, 0)}
+	original := append([]time.Time(nil), input...)
+
+	got := SortedUnique(input)
+	assert.Equal(t, []time.Time{utc(2024, 1, 1, 10, 0, 0), utc(2024, 1, 1, 10, 2, 0)}, got)
+	assert.Equal(t, original, input)
+}
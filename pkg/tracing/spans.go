@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	sdktracing "github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span verbosity levels, set with the datasource's traceVerbosity setting.
+const (
+	VerbosityOff      = "off"      // No plugin spans
+	VerbosityBasic    = "basic"    // Spans for settings load, client creation, queries, NRQL execution and formatting (default)
+	VerbosityDetailed = "detailed" // Also the formatting steps, and NRQL text and row counts as span attributes
+)
+
+// levels orders the verbosity levels.
+var levels = map[string]int{VerbosityOff: 0, VerbosityBasic: 1, VerbosityDetailed: 2}
+
+// IsValidVerbosity reports whether verbosity is a known level; empty means VerbosityBasic.
+func IsValidVerbosity(verbosity string) bool {
+	_, ok := levels[verbosity]
+	return ok || verbosity == ""
+}
+
+// verbosityKey is the context key carrying the span verbosity.
+type verbosityKey struct{}
+
+// WithVerbosity returns a context whose spans are created at verbosity.
+func WithVerbosity(ctx context.Context, verbosity string) context.Context {
+	return context.WithValue(ctx, verbosityKey{}, verbosity)
+}
+
+// level returns the verbosity level of ctx.
+func level(ctx context.Context) int {
+	verbosity, _ := ctx.Value(verbosityKey{}).(string)
+	if l, ok := levels[verbosity]; ok {
+		return l
+	}
+	return levels[VerbosityBasic]
+}
+
+// Detailed reports whether ctx asks for detailed spans, so callers only compute
+// expensive attributes when they are recorded.
+func Detailed(ctx context.Context) bool {
+	return level(ctx) >= levels[VerbosityDetailed]
+}
+
+// Start starts a span as a child of the span in ctx, which carries Grafana's
+// trace context. With verbosity off it returns ctx and a span that records nothing.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return start(ctx, levels[VerbosityBasic], name, attrs)
+}
+
+// StartDetailed starts a span like Start, but only at detailed verbosity.
+func StartDetailed(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return start(ctx, levels[VerbosityDetailed], name, attrs)
+}
+
+// Record adds a span for an operation that started at start and just ended, for
+// work done before the verbosity was known, such as loading the settings.
+func Record(ctx context.Context, name string, start time.Time, err error, attrs ...attribute.KeyValue) {
+	if level(ctx) < levels[VerbosityBasic] {
+		return
+	}
+	_, span := sdktracing.DefaultTracer().Start(ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+	End(span, err)
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		_ = sdktracing.Error(span, err)
+	}
+	span.End()
+}
+
+// start starts a span if ctx's verbosity is at least minLevel.
+func start(ctx context.Context, minLevel int, name string, attrs []attribute.KeyValue) (context.Context, trace.Span) {
+	if level(ctx) < minLevel {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return sdktracing.DefaultTracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sdktracing "github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans makes the default tracer record spans for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	sdktracing.InitDefaultTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"))
+	t.Cleanup(func() { sdktracing.InitDefaultTracer(otel.Tracer("test")) })
+	return recorder
+}
+
+// spanNames returns the names of the ended spans.
+func spanNames(recorder *tracetest.SpanRecorder) []string {
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+func TestIsValidVerbosity(t *testing.T) {
+	for _, verbosity := range []string{"", VerbosityOff, VerbosityBasic, VerbosityDetailed} {
+		assert.True(t, IsValidVerbosity(verbosity), verbosity)
+	}
+	assert.False(t, IsValidVerbosity("verbose"))
+}
+
+func TestStart(t *testing.T) {
+	run := func(ctx context.Context) {
+		ctx, span := Start(ctx, "query")
+		_, detailed := StartDetailed(ctx, "format.display")
+		detailed.End()
+		End(span, errors.New("boom"))
+	}
+
+	tests := []struct {
+		verbosity string
+		want      []string
+	}{
+		{"", []string{"query"}},
+		{VerbosityOff, nil},
+		{VerbosityBasic, []string{"query"}},
+		{VerbosityDetailed, []string{"format.display", "query"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("verbosity "+tt.verbosity, func(t *testing.T) {
+			recorder := recordSpans(t)
+			run(WithVerbosity(context.Background(), tt.verbosity))
+			assert.Equal(t, tt.want, spanNames(recorder))
+		})
+	}
+
+	t.Run("child of the span in the context", func(t *testing.T) {
+		recorder := recordSpans(t)
+		parentCtx, parent := Start(context.Background(), "parent")
+		_, child := Start(parentCtx, "child")
+		End(child, nil)
+		End(parent, errors.New("boom"))
+
+		ended := recorder.Ended()
+		require.Len(t, ended, 2)
+		assert.Equal(t, ended[1].SpanContext().SpanID(), ended[0].Parent().SpanID())
+		assert.Equal(t, codes.Error, ended[1].Status().Code)
+		assert.Equal(t, codes.Unset, ended[0].Status().Code)
+	})
+}
+
+func TestRecord(t *testing.T) {
+	recorder := recordSpans(t)
+	start := time.Now().Add(-time.Second)
+
+	Record(context.Background(), "settings.load", start, nil)
+	Record(WithVerbosity(context.Background(), VerbosityOff), "skipped", start, nil)
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	assert.Equal(t, "settings.load", ended[0].Name())
+	assert.Equal(t, start, ended[0].StartTime())
+}
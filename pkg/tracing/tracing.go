@@ -0,0 +1,62 @@
+// Package tracing propagates Grafana's distributed tracing context to outgoing
+// New Relic API requests, so a slow panel can be followed end-to-end from
+// Grafana through the plugin to NerdGraph. It also records spans for the
+// plugin's own work, at the verbosity the datasource settings choose.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator writes and reads W3C Trace Context headers (traceparent, tracestate).
+var propagator = propagation.TraceContext{}
+
+// TraceIDFromContext returns the trace ID of the span in ctx, or an empty string
+// when ctx carries no valid span context.
+func TraceIDFromContext(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// Transport is an http.RoundTripper that adds trace context headers to requests.
+// The New Relic client does not pass the query context to its transport, so the
+// trace context of the request that created the client is captured up front and
+// used whenever the outgoing request itself carries no span.
+type Transport struct {
+	Base    http.RoundTripper
+	headers propagation.HeaderCarrier
+}
+
+// NewTransport returns a Transport that propagates the trace context of ctx.
+// A nil base uses http.DefaultTransport.
+func NewTransport(ctx context.Context, base http.RoundTripper) *Transport {
+	headers := propagation.HeaderCarrier(http.Header{})
+	propagator.Inject(ctx, headers)
+	return &Transport{Base: base, headers: headers}
+}
+
+// RoundTrip adds the trace context headers to a copy of req and sends it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if trace.SpanContextFromContext(req.Context()).IsValid() {
+		req = req.Clone(req.Context())
+		propagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	} else if len(t.headers) > 0 {
+		req = req.Clone(req.Context())
+		for key, values := range t.headers {
+			req.Header[key] = append([]string(nil), values...)
+		}
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextWithSpan returns a context carrying a sampled remote span with the given IDs.
+func contextWithSpan(t *testing.T, traceID, spanID string) context.Context {
+	t.Helper()
+	tid, err := trace.TraceIDFromHex(traceID)
+	require.NoError(t, err)
+	sid, err := trace.SpanIDFromHex(spanID)
+	require.NoError(t, err)
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+}
+
+func TestTraceIDFromContext(t *testing.T) {
+	assert.Empty(t, TraceIDFromContext(context.Background()))
+
+	ctx := contextWithSpan(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceIDFromContext(ctx))
+}
+
+func TestTransport_RoundTrip(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		captureCtx context.Context
+		requestCtx context.Context
+		want       string
+	}{
+		{
+			name:       "no trace context",
+			captureCtx: context.Background(),
+			requestCtx: context.Background(),
+			want:       "",
+		},
+		{
+			name:       "captured trace context",
+			captureCtx: contextWithSpan(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"),
+			requestCtx: context.Background(),
+			want:       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			name:       "request trace context takes precedence",
+			captureCtx: contextWithSpan(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"),
+			requestCtx: contextWithSpan(t, "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"),
+			want:       "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			client := &http.Client{Transport: NewTransport(tt.captureCtx, nil)}
+
+			req, err := http.NewRequestWithContext(tt.requestCtx, http.MethodPost, server.URL, nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.want, received.Get("traceparent"))
+			assert.Empty(t, req.Header.Get("traceparent"), "the original request must not be modified")
+		})
+	}
+}
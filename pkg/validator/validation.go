@@ -5,37 +5,265 @@ package validator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 
+	"newrelic-grafana-plugin/pkg/client"
+	"newrelic-grafana-plugin/pkg/errorsx"
+	"newrelic-grafana-plugin/pkg/formatter"
 	"newrelic-grafana-plugin/pkg/models"
 	"newrelic-grafana-plugin/pkg/nrdbiface"
+	"newrelic-grafana-plugin/pkg/timeutil"
+	"newrelic-grafana-plugin/pkg/tracing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
-	"github.com/newrelic/newrelic-client-go/v2/pkg/errors"
 	"github.com/newrelic/newrelic-client-go/v2/pkg/nrdb"
 )
 
-// ValidatePluginSettings validates the plugin settings
+// DefaultHealthCheckQuery is the NRQL the health check runs unless the settings
+// override it. It tests both API connectivity and account-level permissions,
+// similar to "SELECT 1 FROM dual" in Oracle.
+const DefaultHealthCheckQuery = "SELECT count(*) FROM Transaction SINCE 1 hour ago LIMIT 1"
+
+// healthCheckEventTypePattern matches event type names that can be used in a FROM clause.
+var healthCheckEventTypePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_:.]*$`)
+
+// currencyPattern matches ISO 4217 currency codes.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidatePluginSettings validates the plugin settings. All problems found are
+// returned together as models.SettingsErrors, each naming the JSON path of its
+// setting and a machine-readable code, so the config editor can highlight every
+// invalid field at once.
 func ValidatePluginSettings(settings *models.PluginSettings) error {
 	if settings == nil {
-		return &models.PluginSettingsError{Msg: "plugin settings cannot be nil"}
+		return models.SettingsErrors{{Msg: "plugin settings cannot be nil", Code: models.SettingsErrRequired}}
 	}
 
 	if settings.Secrets == nil {
-		return &models.PluginSettingsError{Msg: "plugin secrets cannot be nil"}
+		return models.SettingsErrors{{Msg: "plugin secrets cannot be nil", Code: models.SettingsErrRequired}}
+	}
+
+	var errs models.SettingsErrors
+	add := func(field, code string, err error, format string, args ...interface{}) {
+		errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf(format, args...), Err: err, Field: field, Code: code})
 	}
 
 	if settings.Secrets.ApiKey == "" {
-		return &models.PluginSettingsError{Msg: "API key cannot be empty"}
+		add("apiKey", models.SettingsErrRequired, nil, "API key cannot be empty")
+	} else if err := client.CheckQueryKey(settings.Secrets.ApiKey); err != nil {
+		add("apiKey", models.SettingsErrInvalid, err, "invalid API key")
+	}
+	if settings.Secrets.SecondaryApiKey != "" {
+		if err := client.CheckQueryKey(settings.Secrets.SecondaryApiKey); err != nil {
+			add("secondaryApiKey", models.SettingsErrInvalid, err, "invalid secondary API key")
+		}
 	}
 
 	if settings.Secrets.AccountId <= 0 {
-		return &models.PluginSettingsError{Msg: "account ID must be a positive number"}
+		add("accountID", models.SettingsErrOutOfRange, nil, "account ID must be a positive number")
+	}
+
+	errs = append(errs, validateAccounts(settings.Secrets)...)
+
+	if _, err := client.NormalizeRegion(settings.Region); err != nil {
+		add("region", models.SettingsErrInvalid, err, "invalid region")
+	}
+
+	if settings.QueryTimeout != "" {
+		if _, err := timeutil.ParseDurationField("queryTimeout", settings.QueryTimeout); err != nil {
+			add("queryTimeout", models.SettingsErrInvalid, err, "invalid query timeout")
+		}
+	}
+
+	if settings.MaxSeries < 0 {
+		add("maxSeries", models.SettingsErrOutOfRange, nil, "invalid limits: maxSeries must not be negative")
+	}
+	if settings.MaxFrameRows < 0 {
+		add("maxFrameRows", models.SettingsErrOutOfRange, nil, "invalid limits: maxFrameRows must not be negative")
+	}
+
+	if settings.MaxResponseBytes < 0 {
+		add("maxResponseBytes", models.SettingsErrOutOfRange, nil, "invalid response budget: maxResponseBytes must not be negative")
+	}
+
+	if !models.IsValidQueryLint(settings.QueryLint) {
+		add("queryLint", models.SettingsErrInvalid, nil, "invalid query lint mode '%s': must be one of off, warn, block", settings.QueryLint)
+	}
+	if settings.RetentionDays < 0 {
+		add("retentionDays", models.SettingsErrOutOfRange, nil, "invalid retention: retentionDays must not be negative")
 	}
 
+	if !formatter.IsValidDownsample(settings.PayloadDownsample) {
+		add("payloadDownsample", models.SettingsErrInvalid, nil, "invalid payload downsampling '%s': must be one of lttb, nth", settings.PayloadDownsample)
+	}
+
+	names := make([]string, 0, len(settings.UnitOverrides))
+	for name := range settings.UnitOverrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "" || settings.UnitOverrides[name] == "" {
+			add("unitOverrides."+name, models.SettingsErrRequired, nil, "invalid unit override '%s': field name and unit cannot be empty", name)
+		}
+	}
+
+	for i, rule := range settings.FieldTypes {
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			add(fmt.Sprintf("fieldTypes[%d].pattern", i), models.SettingsErrInvalid, nil, "invalid field type pattern '%s': must be an attribute name or glob such as custom.*", rule.Pattern)
+		}
+		if !models.IsValidFieldType(rule.Type) {
+			add(fmt.Sprintf("fieldTypes[%d].type", i), models.SettingsErrInvalid, nil, "invalid field type '%s' for pattern '%s': must be one of number, string, timestamp, boolean", rule.Type, rule.Pattern)
+		}
+	}
+
+	if settings.ProxyURL != "" {
+		if _, err := client.ParseProxyURL(settings.ProxyURL); err != nil {
+			add("proxyUrl", models.SettingsErrInvalid, err, "invalid proxy URL")
+		}
+	}
+
+	// The CA and client certificates are checked apart to tell which is invalid
+	if tlsConfig := client.ConfigFromSettings(settings, "").TLS; tlsConfig != nil {
+		if _, err := client.NewTLSConfig(&client.TLSConfig{CACert: tlsConfig.CACert}); err != nil {
+			add("tlsCACert", models.SettingsErrInvalid, err, "invalid TLS settings")
+		}
+		if _, err := client.NewTLSConfig(&client.TLSConfig{ClientCert: tlsConfig.ClientCert, ClientKey: tlsConfig.ClientKey}); err != nil {
+			add("tlsClientCert", models.SettingsErrInvalid, err, "invalid TLS settings")
+		}
+	}
+
+	if !tracing.IsValidVerbosity(settings.TraceVerbosity) {
+		add("traceVerbosity", models.SettingsErrInvalid, nil, "invalid trace verbosity '%s': must be one of off, basic, detailed", settings.TraceVerbosity)
+	}
+
+	errs = append(errs, validateHealthCheck(settings.HealthCheck)...)
+	errs = append(errs, validateUsagePricing(settings.UsagePricing)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
+// validateHealthCheck checks the health check overrides: the query must be a
+// SELECT or FROM query and the event type a valid event type name.
+func validateHealthCheck(healthCheck *models.HealthCheckSettings) models.SettingsErrors {
+	if healthCheck == nil {
+		return nil
+	}
+	var errs models.SettingsErrors
+	if query := strings.ToUpper(strings.TrimSpace(healthCheck.Query)); query != "" && !strings.HasPrefix(query, "SELECT ") && !strings.HasPrefix(query, "FROM ") {
+		errs = append(errs, &models.PluginSettingsError{Msg: "invalid health check query: it must start with SELECT or FROM", Field: "healthCheck.query", Code: models.SettingsErrInvalid})
+	}
+	if healthCheck.EventType != "" && !healthCheckEventTypePattern.MatchString(healthCheck.EventType) {
+		errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf("invalid health check event type '%s'", healthCheck.EventType), Field: "healthCheck.eventType", Code: models.SettingsErrInvalid})
+	}
+	return errs
+}
+
+// validateUsagePricing checks the usage pricing: prices must not be negative
+// and the currency must be an ISO 4217 code.
+func validateUsagePricing(pricing *models.UsagePricingSettings) models.SettingsErrors {
+	if pricing == nil {
+		return nil
+	}
+	var errs models.SettingsErrors
+	for _, price := range []struct {
+		field string
+		value float64
+	}{
+		{"usagePricing.perGB", pricing.PerGB},
+		{"usagePricing.perFullPlatformUser", pricing.PerFullPlatformUser},
+		{"usagePricing.perCoreUser", pricing.PerCoreUser},
+	} {
+		if price.value < 0 {
+			errs = append(errs, &models.PluginSettingsError{Msg: "invalid usage pricing: prices must not be negative", Field: price.field, Code: models.SettingsErrOutOfRange})
+		}
+	}
+	if pricing.Currency != "" && !currencyPattern.MatchString(pricing.Currency) {
+		errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf("invalid usage pricing currency '%s': must be an ISO 4217 code such as USD", pricing.Currency), Field: "usagePricing.currency", Code: models.SettingsErrInvalid})
+	}
+	return errs
+}
+
+// HealthCheckQuery returns the NRQL the health check runs for settings: the
+// configured query, a count of the configured event type, or DefaultHealthCheckQuery.
+func HealthCheckQuery(settings *models.PluginSettings) string {
+	if settings.HealthCheck != nil {
+		if query := strings.TrimSpace(settings.HealthCheck.Query); query != "" {
+			return query
+		}
+		if settings.HealthCheck.EventType != "" {
+			return fmt.Sprintf("SELECT count(*) FROM %s SINCE 1 hour ago LIMIT 1", settings.HealthCheck.EventType)
+		}
+	}
+	return DefaultHealthCheckQuery
+}
+
+// validateAccounts checks the additional named accounts: each needs a name and a
+// positive account ID, and no account may be listed twice.
+func validateAccounts(secrets *models.SecretPluginSettings) models.SettingsErrors {
+	var errs models.SettingsErrors
+	seen := map[int]bool{secrets.AccountId: true}
+	for i, account := range secrets.Accounts {
+		if account.Name == "" {
+			errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf("account %d: name cannot be empty", i+1), Field: fmt.Sprintf("accounts[%d].name", i), Code: models.SettingsErrRequired})
+		}
+		field := fmt.Sprintf("accounts[%d].accountID", i)
+		switch {
+		case account.AccountID <= 0:
+			errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf("account '%s': account ID must be a positive number", account.Name), Field: field, Code: models.SettingsErrOutOfRange})
+		case seen[account.AccountID]:
+			errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf("account '%s': account ID %d is listed more than once", account.Name, account.AccountID), Field: field, Code: models.SettingsErrDuplicate})
+		}
+		seen[account.AccountID] = true
+		if account.ApiKey == "" {
+			continue
+		}
+		if err := client.CheckQueryKey(account.ApiKey); err != nil {
+			errs = append(errs, &models.PluginSettingsError{Msg: fmt.Sprintf("account '%s': invalid API key", account.Name), Err: err, Field: fmt.Sprintf("accounts[%d].apiKey", i), Code: models.SettingsErrInvalid})
+		}
+	}
+	return errs
+}
+
+// FieldError is a settings problem in the JSON details of a failed health check.
+type FieldError struct {
+	Field   string `json:"field,omitempty"` // JSON path of the setting
+	Code    string `json:"code,omitempty"`  // One of the models.SettingsErr codes
+	Message string `json:"message"`
+}
+
+// SettingsErrorDetails is the JSON details of a health check failing on invalid settings.
+type SettingsErrorDetails struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// SettingsErrorResult returns the failed health check result for settings
+// rejected with err, with message as its message and the problems of err, with
+// their setting paths, as its JSON details.
+func SettingsErrorResult(message string, err error) *backend.CheckHealthResult {
+	result := &backend.CheckHealthResult{Status: backend.HealthStatusError, Message: message}
+	fieldErrs := models.FieldErrors(err)
+	if len(fieldErrs) == 0 {
+		return result
+	}
+	details := SettingsErrorDetails{Errors: make([]FieldError, len(fieldErrs))}
+	for i, fieldErr := range fieldErrs {
+		details.Errors[i] = FieldError{Field: fieldErr.Field, Code: fieldErr.Code, Message: fieldErr.Error()}
+	}
+	if raw, marshalErr := json.Marshal(details); marshalErr == nil {
+		result.JSONDetails = raw
+	}
+	return result
+}
+
 // CheckHealth checks the health of the New Relic connection using an NRDB query executor
 func CheckHealth(ctx context.Context, settings *models.PluginSettings, executor nrdbiface.NRDBQueryExecutor) (*backend.CheckHealthResult, error) {
 	if executor == nil {
@@ -47,30 +275,31 @@ func CheckHealth(ctx context.Context, settings *models.PluginSettings, executor
 
 	// First, perform basic settings validation
 	if err := ValidatePluginSettings(settings); err != nil {
-		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("Plugin configuration validation failed: %s", err.Error()),
-		}, nil
+		return SettingsErrorResult(fmt.Sprintf("Plugin configuration validation failed: %s", err.Error()), err), nil
 	}
 
-	// Try a comprehensive test query to check connectivity and account access
-	// This query is more realistic than "SELECT 1" and tests both API connectivity
-	// and account-level permissions similar to "SELECT 1 FROM dual" in Oracle
-	testQuery := "SELECT count(*) FROM Transaction SINCE 1 hour ago LIMIT 1"
+	// Try a test query to check connectivity and account access. Accounts without
+	// Transaction events can configure a query or event type of their own.
+	testQuery := HealthCheckQuery(settings)
 
 	result, err := executor.QueryWithContext(ctx, settings.Secrets.AccountId, nrdb.NRQL(testQuery))
 	if err != nil {
-		switch err.(type) {
-		case *errors.UnauthorizedError:
+		switch errorsx.Classify(err) {
+		case errorsx.KindAuth:
 			return &backend.CheckHealthResult{
 				Status:  backend.HealthStatusError,
 				Message: fmt.Sprintf("Authentication failed for account ID %d. Please verify your API key is correct and has access to this account.", settings.Secrets.AccountId),
 			}, nil
-		default:
+		case errorsx.KindDownstream:
 			return &backend.CheckHealthResult{
 				Status:  backend.HealthStatusError,
 				Message: fmt.Sprintf("Failed to connect to New Relic API (Account ID: %d). Error: %s", settings.Secrets.AccountId, err.Error()),
 			}, nil
+		default:
+			return &backend.CheckHealthResult{
+				Status:  backend.HealthStatusError,
+				Message: fmt.Sprintf("New Relic API check failed for account ID %d: %s. Error: %s", settings.Secrets.AccountId, errorsx.Message(err), err.Error()),
+			}, nil
 		}
 	}
 
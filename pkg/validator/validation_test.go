@@ -63,6 +63,276 @@ func TestValidatePluginSettings(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "FedRAMP region",
+			config: &models.PluginSettings{
+				Region: "FedRAMP",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown region",
+			config: &models.PluginSettings{
+				Region: "APAC",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "query timeout",
+			config: &models.PluginSettings{
+				QueryTimeout: "45s",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid query timeout",
+			config: &models.PluginSettings{
+				QueryTimeout: "45",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative series limit",
+			config: &models.PluginSettings{
+				MaxSeries: -1,
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative response budget",
+			config: &models.PluginSettings{
+				MaxResponseBytes: -1,
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown payload downsampling",
+			config: &models.PluginSettings{
+				PayloadDownsample: "average",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown query lint mode",
+			config: &models.PluginSettings{
+				QueryLint: "strict",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unit override without a unit",
+			config: &models.PluginSettings{
+				UnitOverrides: map[string]string{"average.duration": ""},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "health check query that is not NRQL",
+			config: &models.PluginSettings{
+				HealthCheck: &models.HealthCheckSettings{Query: "DELETE FROM Log"},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid health check event type",
+			config: &models.PluginSettings{
+				HealthCheck: &models.HealthCheckSettings{EventType: "Log; DROP"},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "health check event type",
+			config: &models.PluginSettings{
+				HealthCheck: &models.HealthCheckSettings{EventType: "Log"},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative usage price",
+			config: &models.PluginSettings{
+				UsagePricing: &models.UsagePricingSettings{PerGB: -0.3},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid usage pricing currency",
+			config: &models.PluginSettings{
+				UsagePricing: &models.UsagePricingSettings{Currency: "euro"},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "usage pricing",
+			config: &models.PluginSettings{
+				UsagePricing: &models.UsagePricingSettings{PerGB: 0.3, PerFullPlatformUser: 349, Currency: "EUR"},
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid proxy URL",
+			config: &models.PluginSettings{
+				ProxyURL: "proxy.internal:3128",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid CA certificate",
+			config: &models.PluginSettings{
+				TLSAuthWithCACert: true,
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+					TLSCACert: "not a certificate",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid trace verbosity",
+			config: &models.PluginSettings{
+				TraceVerbosity: "verbose",
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "named accounts",
+			config: &models.PluginSettings{
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+					Accounts: []models.AccountEntry{
+						{Name: "Staging", AccountID: 222},
+						{Name: "Partner", AccountID: 333, ApiKey: "partner-key"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "named account without name",
+			config: &models.PluginSettings{
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+					Accounts:  []models.AccountEntry{{AccountID: 222}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "named account with invalid ID",
+			config: &models.PluginSettings{
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+					Accounts:  []models.AccountEntry{{Name: "Staging", AccountID: -1}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid field type rules",
+			config: &models.PluginSettings{
+				Secrets:    &models.SecretPluginSettings{ApiKey: "test-key", AccountId: 123456},
+				FieldTypes: []models.FieldTypeRule{{Pattern: "orderId", Type: models.FieldTypeString}, {Pattern: "*Time", Type: models.FieldTypeTimestamp}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "field type rule with unknown type",
+			config: &models.PluginSettings{
+				Secrets:    &models.SecretPluginSettings{ApiKey: "test-key", AccountId: 123456},
+				FieldTypes: []models.FieldTypeRule{{Pattern: "orderId", Type: "integer"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "field type rule with invalid pattern",
+			config: &models.PluginSettings{
+				Secrets:    &models.SecretPluginSettings{ApiKey: "test-key", AccountId: 123456},
+				FieldTypes: []models.FieldTypeRule{{Pattern: "order[", Type: models.FieldTypeString}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "named account duplicates the default account",
+			config: &models.PluginSettings{
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+					Accounts:  []models.AccountEntry{{Name: "Production", AccountID: 123456}},
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -77,7 +347,99 @@ func TestValidatePluginSettings(t *testing.T) {
 	}
 }
 
+func TestValidatePluginSettings_FieldErrors(t *testing.T) {
+	err := ValidatePluginSettings(&models.PluginSettings{
+		Region:       "APAC",
+		MaxFrameRows: -1,
+		FieldTypes:   []models.FieldTypeRule{{Pattern: "orderId", Type: "integer"}},
+		HealthCheck:  &models.HealthCheckSettings{EventType: "Log; DROP"},
+		Secrets: &models.SecretPluginSettings{
+			AccountId: 123456,
+			Accounts:  []models.AccountEntry{{Name: "Staging", AccountID: 222}, {AccountID: 222}},
+		},
+	})
+	require.Error(t, err)
+
+	var errs models.SettingsErrors
+	require.True(t, errors.As(err, &errs))
+	type fieldError struct{ field, code string }
+	var got []fieldError
+	for _, e := range errs {
+		got = append(got, fieldError{e.Field, e.Code})
+	}
+	assert.Equal(t, []fieldError{
+		{"apiKey", models.SettingsErrRequired},
+		{"accounts[1].name", models.SettingsErrRequired},
+		{"accounts[1].accountID", models.SettingsErrDuplicate},
+		{"region", models.SettingsErrInvalid},
+		{"maxFrameRows", models.SettingsErrOutOfRange},
+		{"fieldTypes[0].type", models.SettingsErrInvalid},
+		{"healthCheck.eventType", models.SettingsErrInvalid},
+	}, got)
+	assert.Contains(t, err.Error(), "apiKey: API key cannot be empty; accounts[1].name: account 2: name cannot be empty")
+}
+
+func TestValidatePluginSettings_KeyTypes(t *testing.T) {
+	err := ValidatePluginSettings(&models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{
+			ApiKey:          "NRII-abcdefghijklmnopqrstuvwxyz01",
+			SecondaryApiKey: "NRJS-abcdef0123456789abc",
+			AccountId:       123456,
+			Accounts: []models.AccountEntry{
+				{Name: "Staging", AccountID: 234567, ApiKey: "NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0"},
+				{Name: "Production", AccountID: 345678, ApiKey: "NRAA-abcdef0123456789abcdef0123456789abc"},
+				{Name: "Shared", AccountID: 456789},
+			},
+		},
+	})
+	require.Error(t, err)
+	var errs models.SettingsErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 3)
+	assert.Equal(t, "apiKey", errs[0].Field)
+	assert.Equal(t, models.SettingsErrInvalid, errs[0].Code)
+	assert.Contains(t, errs[0].Error(), "the configured Insert key can only send data to New Relic")
+	assert.Equal(t, "secondaryApiKey", errs[1].Field)
+	assert.Contains(t, errs[1].Error(), "Browser key")
+	assert.Equal(t, "accounts[1].apiKey", errs[2].Field)
+	assert.Equal(t, models.SettingsErrInvalid, errs[2].Code)
+	assert.Contains(t, errs[2].Error(), "account 'Production': invalid API key")
+	assert.Contains(t, errs[2].Error(), "the configured Admin key is a deprecated REST API key, which NerdGraph does not accept")
+
+	assert.NoError(t, ValidatePluginSettings(&models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{ApiKey: "NRAK-ABCDEFGHIJKLMNOPQRSTUVWXYZ0", AccountId: 123456},
+	}))
+}
+
+func TestCheckHealth_InvalidSettingsDetails(t *testing.T) {
+	result, err := CheckHealth(context.Background(), &models.PluginSettings{
+		Secrets: &models.SecretPluginSettings{ApiKey: "test-key"},
+	}, &mockNRDBExecutor{})
+	require.NoError(t, err)
+	assert.Equal(t, backend.HealthStatusError, result.Status)
+	assert.Equal(t, "Plugin configuration validation failed: accountID: account ID must be a positive number", result.Message)
+	assert.JSONEq(t, `{"errors": [{"field": "accountID", "code": "outOfRange", "message": "account ID must be a positive number"}]}`, string(result.JSONDetails))
+}
+
 // mockNRDBExecutor implements the nrdbiface.NRDBQueryExecutor interface for testing
+func TestHealthCheckQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthCheck *models.HealthCheckSettings
+		want        string
+	}{
+		{"default", nil, DefaultHealthCheckQuery},
+		{"empty settings", &models.HealthCheckSettings{}, DefaultHealthCheckQuery},
+		{"event type", &models.HealthCheckSettings{EventType: "Log"}, "SELECT count(*) FROM Log SINCE 1 hour ago LIMIT 1"},
+		{"query wins over event type", &models.HealthCheckSettings{Query: " SELECT count(*) FROM Metric SINCE 5 minutes ago ", EventType: "Log"}, "SELECT count(*) FROM Metric SINCE 5 minutes ago"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HealthCheckQuery(&models.PluginSettings{HealthCheck: tt.healthCheck}))
+		})
+	}
+}
+
 type mockNRDBExecutor struct {
 	queryErr error
 	results  *nrdb.NRDBResultContainer
@@ -173,6 +535,23 @@ func TestCheckHealth_Validation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "rate limited",
+			config: &models.PluginSettings{
+				Secrets: &models.SecretPluginSettings{
+					ApiKey:    "test-key",
+					AccountId: 123456,
+				},
+			},
+			executor: &mockNRDBExecutor{
+				queryErr: nrErrors.NewUnexpectedStatusCode(429, "Too Many Requests"),
+			},
+			want: &backend.CheckHealthResult{
+				Status:  backend.HealthStatusError,
+				Message: "New Relic API check failed for account ID 123456: New Relic rate limit reached; reduce the dashboard refresh rate or try again later. Error: 429 response returned: Too Many Requests",
+			},
+			wantErr: false,
+		},
 		{
 			name: "empty results",
 			config: &models.PluginSettings{
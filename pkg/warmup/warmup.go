@@ -0,0 +1,259 @@
+// Package warmup runs configured NRQL queries on a schedule so that their results
+// are cached before users open the dashboards that need them. Each run is timed
+// and recorded in the plugin metrics.
+package warmup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/metrics"
+	"newrelic-grafana-plugin/pkg/models"
+	"newrelic-grafana-plugin/pkg/timeutil"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// DefaultTTL is how long warmed results stay cached when no TTL is configured.
+const DefaultTTL = time.Hour
+
+// DefaultTimeRange is the time range of warm-up queries that configure none,
+// Grafana's default dashboard time range.
+const DefaultTimeRange = 6 * time.Hour
+
+// RunFunc executes a single warm-up query and stores its result for ttl.
+type RunFunc func(ctx context.Context, query models.WarmupQuery, ttl time.Duration) error
+
+// ConfigError represents an invalid warm-up configuration.
+type ConfigError struct {
+	Msg string
+	Err error // Wrapped error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("invalid warm-up configuration: %v", e.Err)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("invalid warm-up configuration: %s: %v", e.Msg, e.Err)
+	}
+	return fmt.Sprintf("invalid warm-up configuration: %s", e.Msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// dailyTime is a time of day in hours and minutes.
+type dailyTime struct {
+	hour, minute int
+}
+
+// Schedule computes when warm-up runs happen.
+type Schedule struct {
+	interval time.Duration
+	daily    []dailyTime
+	location *time.Location
+}
+
+// ParseSchedule builds a Schedule from the warm-up settings. At least one of
+// Interval or DailyAt must be set.
+func ParseSchedule(settings models.WarmupSettings) (*Schedule, error) {
+	schedule := &Schedule{location: time.UTC}
+
+	if settings.Interval != "" {
+		interval, err := timeutil.ParseDurationField("warmup.interval", settings.Interval)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		schedule.interval = interval
+	}
+
+	if settings.TimeZone != "" {
+		loc, err := time.LoadLocation(settings.TimeZone)
+		if err != nil {
+			return nil, &ConfigError{Msg: fmt.Sprintf("unknown time zone '%s'", settings.TimeZone), Err: err}
+		}
+		schedule.location = loc
+	}
+
+	for _, at := range settings.DailyAt {
+		parsed, err := time.Parse("15:04", at)
+		if err != nil {
+			return nil, &ConfigError{Msg: fmt.Sprintf("could not parse daily time '%s', expected HH:MM", at), Err: err}
+		}
+		schedule.daily = append(schedule.daily, dailyTime{hour: parsed.Hour(), minute: parsed.Minute()})
+	}
+
+	if schedule.interval == 0 && len(schedule.daily) == 0 {
+		return nil, &ConfigError{Msg: "either interval or dailyAt must be set"}
+	}
+	return schedule, nil
+}
+
+// Next returns the first scheduled run strictly after now.
+func (s *Schedule) Next(now time.Time) time.Time {
+	var next time.Time
+	if s.interval > 0 {
+		next = now.Add(s.interval)
+	}
+
+	local := now.In(s.location)
+	for _, d := range s.daily {
+		candidate := time.Date(local.Year(), local.Month(), local.Day(), d.hour, d.minute, 0, 0, s.location)
+		if !candidate.After(now) {
+			candidate = time.Date(local.Year(), local.Month(), local.Day()+1, d.hour, d.minute, 0, 0, s.location)
+		}
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+	return next
+}
+
+// Runner runs the warm-up queries according to a schedule until stopped.
+type Runner struct {
+	queries    []models.WarmupQuery
+	schedule   *Schedule
+	ttl        time.Duration
+	runOnStart bool
+	run        RunFunc
+	now        func() time.Time
+
+	started  bool
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRunner validates the warm-up settings and creates a Runner that executes
+// queries with run. The runner does nothing until Start is called.
+func NewRunner(settings models.WarmupSettings, run RunFunc) (*Runner, error) {
+	if len(settings.Queries) == 0 {
+		return nil, &ConfigError{Msg: "no warm-up queries configured"}
+	}
+	for i, q := range settings.Queries {
+		if q.QueryText == "" {
+			return nil, &ConfigError{Msg: fmt.Sprintf("warm-up query %d has no queryText", i)}
+		}
+		if _, err := TimeRange(q); err != nil {
+			return nil, err
+		}
+	}
+
+	schedule, err := ParseSchedule(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := DefaultTTL
+	if settings.TTL != "" {
+		ttl, err = timeutil.ParseDurationField("warmup.ttl", settings.TTL)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+	}
+
+	return &Runner{
+		queries:    settings.Queries,
+		schedule:   schedule,
+		ttl:        ttl,
+		runOnStart: settings.RunOnStart,
+		run:        run,
+		now:        time.Now,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Start launches the scheduling loop in a new goroutine.
+func (r *Runner) Start() {
+	r.started = true
+	go r.loop()
+}
+
+// Stop stops the scheduling loop and waits for an in-flight run to finish.
+// It is safe to call Stop more than once, or on a runner that was never started.
+func (r *Runner) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	if r.started {
+		<-r.done
+	}
+}
+
+// loop waits for each scheduled time and runs the queries.
+func (r *Runner) loop() {
+	defer close(r.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if r.runOnStart {
+		r.RunOnce(ctx)
+	}
+
+	for {
+		next := r.schedule.Next(r.now())
+		log.DefaultLogger.Debug("warmup: next run scheduled", "at", next)
+		timer := time.NewTimer(next.Sub(r.now()))
+		select {
+		case <-timer.C:
+			r.RunOnce(ctx)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// RunOnce runs every warm-up query once, recording its duration and outcome.
+func (r *Runner) RunOnce(ctx context.Context) {
+	for _, q := range r.queries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		start := r.now()
+		err := r.run(ctx, q, r.ttl)
+		duration := r.now().Sub(start)
+
+		metrics.RecordWarmup(queryName(q), duration, err)
+		if err != nil {
+			log.DefaultLogger.Warn("warmup: query failed", "name", queryName(q), "duration", duration, "error", err)
+		} else {
+			log.DefaultLogger.Debug("warmup: query completed", "name", queryName(q), "duration", duration)
+		}
+	}
+}
+
+// TimeRange returns the length of the time range of a warm-up query, ending at
+// the time it runs.
+func TimeRange(q models.WarmupQuery) (time.Duration, error) {
+	if q.TimeRange == "" {
+		return DefaultTimeRange, nil
+	}
+	timeRange, err := timeutil.ParseDurationField("warmup.queries.timeRange", q.TimeRange)
+	if err != nil {
+		return 0, &ConfigError{Err: err}
+	}
+	return timeRange, nil
+}
+
+// queryName returns the configured name of a query, falling back to its NRQL.
+func queryName(q models.WarmupQuery) string {
+	if q.Name != "" {
+		return q.Name
+	}
+	return q.QueryText
+}
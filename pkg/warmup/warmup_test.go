@@ -0,0 +1,179 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"newrelic-grafana-plugin/pkg/metrics"
+	"newrelic-grafana-plugin/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings models.WarmupSettings
+		wantErr  string
+	}{
+		{name: "interval", settings: models.WarmupSettings{Interval: "15m"}},
+		{name: "daily", settings: models.WarmupSettings{DailyAt: []string{"07:30"}, TimeZone: "UTC"}},
+		{name: "no schedule", settings: models.WarmupSettings{}, wantErr: "either interval or dailyAt must be set"},
+		{name: "invalid interval", settings: models.WarmupSettings{Interval: "soon"}, wantErr: "invalid duration for warmup.interval: 'soon'"},
+		{name: "zero interval", settings: models.WarmupSettings{Interval: "0m"}, wantErr: "invalid duration for warmup.interval: '0m': must be greater than zero"},
+		{name: "grafana style interval", settings: models.WarmupSettings{Interval: "1d"}},
+		{name: "invalid daily time", settings: models.WarmupSettings{DailyAt: []string{"7am"}}, wantErr: "could not parse daily time"},
+		{name: "unknown time zone", settings: models.WarmupSettings{DailyAt: []string{"07:30"}, TimeZone: "Mars/Olympus"}, wantErr: "unknown time zone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchedule(tt.settings)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	t.Run("interval", func(t *testing.T) {
+		s, err := ParseSchedule(models.WarmupSettings{Interval: "15m"})
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(15*time.Minute), s.Next(now))
+	})
+
+	t.Run("daily later today", func(t *testing.T) {
+		s, err := ParseSchedule(models.WarmupSettings{DailyAt: []string{"09:30"}})
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), s.Next(now))
+	})
+
+	t.Run("daily already passed runs tomorrow", func(t *testing.T) {
+		s, err := ParseSchedule(models.WarmupSettings{DailyAt: []string{"07:30", "08:00"}})
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC), s.Next(now))
+	})
+
+	t.Run("earliest of interval and daily", func(t *testing.T) {
+		s, err := ParseSchedule(models.WarmupSettings{Interval: "4h", DailyAt: []string{"09:00"}})
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), s.Next(now))
+	})
+
+	t.Run("daily in time zone", func(t *testing.T) {
+		loc, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			t.Skip("time zone data not available")
+		}
+		s, err := ParseSchedule(models.WarmupSettings{DailyAt: []string{"07:00"}, TimeZone: "America/New_York"})
+		require.NoError(t, err)
+		assert.True(t, time.Date(2024, 1, 1, 7, 0, 0, 0, loc).Equal(s.Next(now)))
+	})
+}
+
+func TestNewRunner_Validation(t *testing.T) {
+	run := func(ctx context.Context, q models.WarmupQuery, ttl time.Duration) error { return nil }
+
+	_, err := NewRunner(models.WarmupSettings{Interval: "1m"}, run)
+	assert.ErrorContains(t, err, "no warm-up queries configured")
+
+	_, err = NewRunner(models.WarmupSettings{Interval: "1m", Queries: []models.WarmupQuery{{Name: "empty"}}}, run)
+	assert.ErrorContains(t, err, "has no queryText")
+
+	_, err = NewRunner(models.WarmupSettings{Interval: "1m", TTL: "forever", Queries: []models.WarmupQuery{{QueryText: "SELECT 1"}}}, run)
+	assert.ErrorContains(t, err, "invalid duration for warmup.ttl")
+
+	_, err = NewRunner(models.WarmupSettings{Interval: "1m", Queries: []models.WarmupQuery{{QueryText: "SELECT 1", TimeRange: "a while"}}}, run)
+	assert.ErrorContains(t, err, "invalid duration for warmup.queries.timeRange")
+
+	r, err := NewRunner(models.WarmupSettings{Interval: "1m", Queries: []models.WarmupQuery{{QueryText: "SELECT 1"}}}, run)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultTTL, r.ttl)
+
+	// Stopping a runner that was never started does not block
+	r.Stop()
+}
+
+func TestRunner_RunOnceRecordsMetrics(t *testing.T) {
+	metrics.ResetMetrics()
+	defer metrics.ResetMetrics()
+
+	var ttls []time.Duration
+	run := func(ctx context.Context, q models.WarmupQuery, ttl time.Duration) error {
+		ttls = append(ttls, ttl)
+		if q.Name == "broken" {
+			return errors.New("API error")
+		}
+		return nil
+	}
+
+	r, err := NewRunner(models.WarmupSettings{
+		Interval: "1h",
+		TTL:      "30m",
+		Queries: []models.WarmupQuery{
+			{Name: "revenue", QueryText: "SELECT sum(revenue) FROM Purchase"},
+			{Name: "broken", QueryText: "SELECT oops"},
+			{QueryText: "SELECT count(*) FROM Transaction"},
+		},
+	}, run)
+	require.NoError(t, err)
+
+	r.RunOnce(context.Background())
+	assert.Equal(t, []time.Duration{30 * time.Minute, 30 * time.Minute, 30 * time.Minute}, ttls)
+
+	stats := metrics.GetMetrics().Warmups
+	require.Len(t, stats, 3)
+	assert.Equal(t, uint64(1), stats["revenue"].Runs)
+	assert.Equal(t, uint64(0), stats["revenue"].Failures)
+	assert.Equal(t, uint64(1), stats["broken"].Failures)
+	assert.Equal(t, "API error", stats["broken"].LastError)
+	assert.Contains(t, stats, "SELECT count(*) FROM Transaction")
+}
+
+func TestRunner_StartAndStop(t *testing.T) {
+	metrics.ResetMetrics()
+	defer metrics.ResetMetrics()
+
+	var mu sync.Mutex
+	runs := 0
+	ran := make(chan struct{}, 1)
+	run := func(ctx context.Context, q models.WarmupQuery, ttl time.Duration) error {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	r, err := NewRunner(models.WarmupSettings{
+		Interval:   "1h",
+		RunOnStart: true,
+		Queries:    []models.WarmupQuery{{Name: "q", QueryText: "SELECT 1"}},
+	}, run)
+	require.NoError(t, err)
+
+	r.Start()
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("warm-up query did not run on start")
+	}
+	r.Stop()
+	r.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, runs)
+}
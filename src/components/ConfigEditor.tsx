@@ -1,12 +1,19 @@
 import React, { ChangeEvent, useState, useCallback } from 'react';
-import { InlineField, InlineFieldRow, SecretInput, Select } from '@grafana/ui';
+import { InlineField, InlineFieldRow, Input, SecretInput, Select } from '@grafana/ui';
 import { DataSourcePluginOptionsEditorProps, SelectableValue } from '@grafana/data';
-import { NewRelicDataSourceOptions, NewRelicSecureJsonData, NEW_RELIC_REGIONS } from '../types';
+import { getBackendSrv } from '@grafana/runtime';
+import { NewRelicDataSourceOptions, NewRelicSecureJsonData, NEW_RELIC_REGIONS, ValidationResult } from '../types';
 import { validateApiKeyDetailed, validateAccountIdDetailed } from '../utils/validation';
 import { logger } from '../utils/logger';
 
 interface Props extends DataSourcePluginOptionsEditorProps<NewRelicDataSourceOptions, NewRelicSecureJsonData> {}
 
+/** Default account as listed by the configured-accounts resource */
+interface ConfiguredAccount {
+  accountID: number;
+  default?: boolean;
+}
+
 /**
  * Configuration editor component for the New Relic data source
  * Handles API key, account ID, and region configuration
@@ -16,11 +23,16 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
   const [validationErrors, setValidationErrors] = useState<Record<string, string>>({});
   const [hasInteracted, setHasInteracted] = useState<Record<string, boolean>>({});
   const [hasSaveAttempted, setHasSaveAttempted] = useState(false);
+  const accountID = jsonData?.accountID?.toString() ?? '';
+  // Account ID still held only in the legacy secure field, which the editor cannot read
+  const hasLegacyAccountId = !!secureJsonFields?.accountID && accountID === '';
 
   // Region options for the select dropdown
   const regionOptions: Array<SelectableValue<string>> = [
     { label: 'United States (US)', value: NEW_RELIC_REGIONS.US },
     { label: 'Europe (EU)', value: NEW_RELIC_REGIONS.EU },
+    { label: 'US FedRAMP', value: NEW_RELIC_REGIONS.FedRAMP },
+    { label: 'Staging', value: NEW_RELIC_REGIONS.Staging },
   ];
 
   /**
@@ -79,29 +91,43 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
     logger.info('API key reset');
   }, [options, secureJsonFields, secureJsonData, onOptionsChange]);
 
+  /**
+   * Returns the secure settings without the legacy secure account ID, if one is stored
+   */
+  const clearedLegacyAccountId = useCallback(() => {
+    if (!secureJsonFields?.accountID) {
+      return {};
+    }
+    return {
+      secureJsonFields: { ...secureJsonFields, accountID: false },
+      secureJsonData: { ...secureJsonData, accountID: '' },
+    };
+  }, [secureJsonFields, secureJsonData]);
+
   /**
    * Validates and updates the account ID (without showing errors while typing)
    */
   const handleAccountIdChange = useCallback((event: ChangeEvent<HTMLInputElement>) => {
     const accountId = event.target.value;
     
-    // Update the options immediately but don't validate yet
+    // Update the options immediately but don't validate yet; the legacy secure
+    // account ID is cleared, as the backend would otherwise keep using it
     onOptionsChange({
       ...options,
-      secureJsonData: {
-        ...secureJsonData,
+      jsonData: {
+        ...jsonData,
         accountID: accountId,
       },
+      ...clearedLegacyAccountId(),
     });
-  }, [options, secureJsonData, onOptionsChange]);
+  }, [options, jsonData, onOptionsChange, clearedLegacyAccountId]);
 
   /**
    * Handles account ID field blur for validation
    */
   const handleAccountIdBlur = useCallback(() => {
     setHasInteracted(prev => ({ ...prev, accountID: true }));
-    const accountId = secureJsonData?.accountID || '';
-    const validation = validateAccountIdDetailed(accountId.toString());
+    const validation = validateAccountIdDetailed(accountID);
     
     setValidationErrors(prev => ({
       ...prev,
@@ -111,35 +137,45 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
     if (!validation.isValid) {
       logger.warn('Account ID validation failed', { error: validation.message });
     }
-  }, [secureJsonData]);
+  }, [accountID]);
 
   /**
-   * Resets the account ID field
+   * Moves an account ID stored in the legacy secure field to jsonData, where the
+   * backend looks for it first, so that it is migrated when the datasource is saved
    */
-  const handleAccountIdReset = useCallback(() => {
-    setValidationErrors(prev => ({ ...prev, accountID: '' }));
-    setHasInteracted(prev => ({ ...prev, accountID: false }));
-    
-    onOptionsChange({
-      ...options,
-      secureJsonFields: {
-        ...secureJsonFields,
-        accountID: false,
-      },
-      secureJsonData: {
-        ...secureJsonData,
-        accountID: '',
-      },
-    });
-
-    logger.info('Account ID reset');
-  }, [options, secureJsonFields, secureJsonData, onOptionsChange]);
+  React.useEffect(() => {
+    if (!hasLegacyAccountId || !options.uid) {
+      return;
+    }
+    getBackendSrv()
+      .get<{ accounts?: ConfiguredAccount[] }>(`/api/datasources/uid/${options.uid}/resources/configured-accounts`)
+      .then((response) => {
+        const defaultAccount = response?.accounts?.find((account) => account.default);
+        if (!defaultAccount) {
+          return;
+        }
+        onOptionsChange({
+          ...options,
+          jsonData: {
+            ...jsonData,
+            accountID: defaultAccount.accountID.toString(),
+          },
+          ...clearedLegacyAccountId(),
+        });
+        logger.info('Account ID moved from secure settings');
+      })
+      .catch((error) => {
+        logger.warn('Legacy account ID could not be migrated', { error });
+      });
+    // Only migrate once, when the editor is opened
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
 
   /**
    * Updates the selected region
    */
   const handleRegionChange = useCallback((selectedOption: SelectableValue<string>) => {
-    const region = selectedOption?.value as 'US' | 'EU' | undefined;
+    const region = selectedOption?.value as NewRelicDataSourceOptions['region'];
     
     onOptionsChange({
       ...options,
@@ -160,10 +196,9 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
     setHasInteracted({ apiKey: true, accountID: true });
     
     const apiKey = secureJsonData?.apiKey || '';
-    const accountID = secureJsonData?.accountID || '';
     
     const apiKeyValidation = validateApiKeyDetailed(apiKey);
-    const accountIdValidation = validateAccountIdDetailed(accountID.toString());
+    const accountIdValidation: ValidationResult = hasLegacyAccountId ? { isValid: true } : validateAccountIdDetailed(accountID);
     
     setValidationErrors({
       apiKey: apiKeyValidation.isValid ? '' : apiKeyValidation.message || 'Invalid API key',
@@ -171,7 +206,7 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
     });
     
     return apiKeyValidation.isValid && accountIdValidation.isValid;
-  }, [secureJsonData]);
+  }, [secureJsonData, accountID, hasLegacyAccountId]);
 
   // Attach validation to the form submission
   React.useEffect(() => {
@@ -252,25 +287,23 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
         <InlineField
           label="Account ID"
           labelWidth={16}
-          tooltip="Your New Relic account ID. This is stored securely and never sent to the frontend."
+          tooltip="Your New Relic account ID."
           required
-          invalid={!!validationErrors.accountID && (hasInteracted.accountID || hasSaveAttempted) && !secureJsonFields?.accountID}
-          error={validationErrors.accountID && (hasInteracted.accountID || hasSaveAttempted) && !secureJsonFields?.accountID ? validationErrors.accountID : ''}
+          invalid={!!validationErrors.accountID && (hasInteracted.accountID || hasSaveAttempted) && !hasLegacyAccountId}
+          error={validationErrors.accountID && (hasInteracted.accountID || hasSaveAttempted) && !hasLegacyAccountId ? validationErrors.accountID : ''}
         >
-          <SecretInput
+          <Input
             id="config-editor-account-id"
             data-testid="account-id-input"
-            isConfigured={!!secureJsonFields?.accountID}
-            value={secureJsonData?.accountID || ''}
-            placeholder="Enter your New Relic account ID"
+            value={accountID}
+            placeholder={hasLegacyAccountId ? 'Configured' : 'Enter your New Relic account ID'}
             width={40}
-            onReset={handleAccountIdReset}
             onChange={handleAccountIdChange}
             onBlur={handleAccountIdBlur}
             type="text"
             aria-label="New Relic Account ID"
             aria-describedby="account-id-help"
-            aria-invalid={!!validationErrors.accountID && (hasInteracted.accountID || hasSaveAttempted) && !secureJsonFields?.accountID}
+            aria-invalid={!!validationErrors.accountID && (hasInteracted.accountID || hasSaveAttempted) && !hasLegacyAccountId}
           />
         </InlineField>
       </InlineFieldRow>
@@ -285,7 +318,7 @@ export function ConfigEditor({ onOptionsChange, options }: Props) {
         <InlineField
           label="Region"
           labelWidth={16}
-          tooltip="Select the New Relic region for your account (US or EU)"
+          tooltip="Select the New Relic region for your account (US, EU, FedRAMP or Staging)"
         >
           <Select
             id="config-editor-region"
@@ -18,6 +18,15 @@ jest.mock('../../utils/validation', () => ({
   validateConfiguration: (...args: any[]) => mockValidation.validateConfiguration(...args),
 }));
 
+// Mock the backend service used to migrate the legacy account ID
+const mockBackendSrv = {
+  get: jest.fn(),
+};
+
+jest.mock('@grafana/runtime', () => ({
+  getBackendSrv: () => mockBackendSrv,
+}));
+
 // Mock the logger
 jest.mock('../../utils/logger', () => ({
   logger: {
@@ -84,9 +93,11 @@ describe('ConfigEditor', () => {
         ...defaultProps,
         options: {
           ...defaultProps.options,
+          jsonData: {
+            accountID: '1234567',
+          },
           secureJsonData: {
             apiKey: 'test-api-key',
-            accountID: '1234567',
           },
         },
       };
@@ -181,7 +192,7 @@ describe('ConfigEditor', () => {
       await waitFor(() => {
         const calls = (defaultProps.onOptionsChange as jest.Mock).mock.calls;
         const lastCall = calls[calls.length - 1];
-        expect(lastCall[0].secureJsonData.accountID).toBe('1234567');
+        expect(lastCall[0].jsonData.accountID).toBe('1234567');
       });
     });
 
@@ -206,6 +217,61 @@ describe('ConfigEditor', () => {
         expect(screen.getByText('Invalid account ID')).toBeInTheDocument();
       });
     });
+
+    it('should clear the legacy secure account ID when the account ID is edited', async () => {
+      const user = userEvent.setup();
+      mockBackendSrv.get.mockReturnValue(new Promise(() => {}));
+      render(
+        <ConfigEditor
+          {...defaultProps}
+          options={{ ...defaultProps.options, secureJsonFields: { apiKey: true, accountID: true } }}
+        />
+      );
+
+      const accountIdInput = screen.getByTestId('account-id-input');
+      await user.clear(accountIdInput);
+      await user.paste('7654321');
+
+      await waitFor(() => {
+        const calls = (defaultProps.onOptionsChange as jest.Mock).mock.calls;
+        const lastCall = calls[calls.length - 1];
+        expect(lastCall[0].jsonData.accountID).toBe('7654321');
+        expect(lastCall[0].secureJsonFields).toEqual({ apiKey: true, accountID: false });
+        expect(lastCall[0].secureJsonData.accountID).toBe('');
+      });
+    });
+
+    it('should move the legacy secure account ID to jsonData', async () => {
+      mockBackendSrv.get.mockResolvedValue({
+        accounts: [
+          { name: 'Default', accountID: 1234567, default: true },
+          { name: 'Other', accountID: 7654321 },
+        ],
+      });
+      render(
+        <ConfigEditor
+          {...defaultProps}
+          options={{ ...defaultProps.options, secureJsonFields: { apiKey: true, accountID: true } }}
+        />
+      );
+
+      await waitFor(() => {
+        expect(mockBackendSrv.get).toHaveBeenCalledWith('/api/datasources/uid/test-uid/resources/configured-accounts');
+        expect(defaultProps.onOptionsChange).toHaveBeenCalledWith(
+          expect.objectContaining({
+            jsonData: { accountID: '1234567' },
+            secureJsonFields: { apiKey: true, accountID: false },
+            secureJsonData: { accountID: '' },
+          })
+        );
+      });
+    });
+
+    it('should not look up the account ID when no legacy one is stored', () => {
+      render(<ConfigEditor {...defaultProps} />);
+
+      expect(mockBackendSrv.get).not.toHaveBeenCalled();
+    });
   });
 
   describe('Region Selection', () => {
@@ -378,7 +444,7 @@ describe('ConfigEditor', () => {
         // Check that the final values are correct
         const calls = (defaultProps.onOptionsChange as jest.Mock).mock.calls;
         const hasApiKey = calls.some(call => call[0].secureJsonData?.apiKey === 'NRAK1234567890abcdef1234567890abcdef1234');
-        const hasAccountId = calls.some(call => call[0].secureJsonData?.accountID === '1234567');
+        const hasAccountId = calls.some(call => call[0].jsonData?.accountID === '1234567');
         expect(hasApiKey).toBe(true);
         expect(hasAccountId).toBe(true);
       });
@@ -1,10 +1,34 @@
-import { DataSourceInstanceSettings, CoreApp, ScopedVars } from '@grafana/data';
+import {
+  AdHocVariableFilter,
+  CoreApp,
+  DataSourceGetTagKeysOptions,
+  DataSourceGetTagValuesOptions,
+  DataSourceInstanceSettings,
+  MetricFindValue,
+  ScopedVars,
+} from '@grafana/data';
 import { DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
 
-import { NewRelicQuery, NewRelicDataSourceOptions } from './types';
+import {
+  ConfiguredAccount,
+  NewRelicQuery,
+  NewRelicDataSourceOptions,
+  EntitySummary,
+  QUERY_TYPE_ENTITIES,
+  QUERY_TYPE_INCIDENTS,
+  QUERY_TYPE_NERDGRAPH,
+  QUERY_TYPE_VARIABLE,
+  QueryStats,
+  QueryValidationResponse,
+  SuggestionsResponse,
+  TemplateVariable,
+} from './types';
 import { validateNrqlQuery } from './utils/validation';
 import { logger } from './utils/logger';
 
+/** Value Grafana uses for the All option of a variable without a custom all value */
+const ALL_VARIABLE_VALUE = '$__all';
+
 /**
  * New Relic data source implementation
  * Handles query execution and template variable substitution
@@ -12,6 +36,9 @@ import { logger } from './utils/logger';
 export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDataSourceOptions> {
   constructor(instanceSettings: DataSourceInstanceSettings<NewRelicDataSourceOptions>) {
     super(instanceSettings);
+    // Queries of any type can be used for annotations; incidents queries return
+    // a frame of annotations spanning each New Relic issue
+    this.annotations = {};
     logger.info('New Relic data source initialized', {
       id: instanceSettings.id,
       name: instanceSettings.name,
@@ -39,12 +66,23 @@ export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDat
    * Applies template variables to the query
    * @param query - The query to process
    * @param scopedVars - Template variables to substitute
+   * @param filters - Ad-hoc filters, which the backend adds to the query's WHERE clause
    * @returns Query with template variables substituted
    */
-  applyTemplateVariables(query: NewRelicQuery, scopedVars: ScopedVars): NewRelicQuery {
+  applyTemplateVariables(query: NewRelicQuery, scopedVars: ScopedVars, filters?: AdHocVariableFilter[]): NewRelicQuery {
     try {
-      // Apply template variable substitution
-      const processedQueryText = getTemplateSrv().replace(query.queryText, scopedVars);
+      // Apply template variable substitution. The interval variables are left for the
+      // backend, which expands $__interval into an NRQL TIMESERIES bucket.
+      const variables = { ...scopedVars };
+      delete variables.__interval;
+      delete variables.__interval_ms;
+      // Multi-value variables are left in the query text and sent to the backend,
+      // which renders them as quoted NRQL lists or drops their conditions for All.
+      const multiValue = this.multiValueVariables(query.queryText, variables);
+      const names = new Set(multiValue.map((variable) => variable.var));
+      const processedQueryText = getTemplateSrv().replace(query.queryText, variables, (value: unknown, variable: any) =>
+        names.has(variable?.name) ? `\${${variable.name}}` : Array.isArray(value) ? `{${value.join(',')}}` : String(value)
+      );
       
       // Validate the processed query
       const validation = validateNrqlQuery(processedQueryText);
@@ -55,10 +93,21 @@ export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDat
         });
       }
 
-      const result = {
+      const result: NewRelicQuery = {
         ...query,
         queryText: processedQueryText,
       };
+      if (multiValue.length) {
+        result.variables = multiValue;
+      }
+      if (query.alias) {
+        // Dashboard variables in the alias are replaced here; {{...}} and $__field
+        // placeholders are left for the backend
+        result.alias = getTemplateSrv().replace(query.alias, variables);
+      }
+      if (filters?.length) {
+        result.filters = filters.map(({ key, operator, value, values }) => ({ key, operator, value, values }));
+      }
 
       logger.debug('Template variables applied', {
         refId: query.refId,
@@ -76,6 +125,35 @@ export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDat
     }
   }
 
+  /**
+   * Returns the multi-value and include-all variables referenced in the query text
+   * that are not overridden by scoped variables, with their selected values
+   */
+  private multiValueVariables(queryText: string, scopedVars: ScopedVars): TemplateVariable[] {
+    const result: TemplateVariable[] = [];
+    for (const variable of getTemplateSrv().getVariables() as any[]) {
+      const name: string = variable.name;
+      if (!(variable.multi || variable.includeAll) || scopedVars[name]) {
+        continue;
+      }
+      const reference = new RegExp(`\\$\\{${name}(:\\w+)?\\}|\\$${name}\\b|\\[\\[${name}\\]\\]`);
+      if (!reference.test(queryText)) {
+        continue;
+      }
+      const current = variable.current?.value;
+      const values: string[] = (Array.isArray(current) ? current : [current]).filter((v) => v !== undefined).map(String);
+      const all = values.includes(ALL_VARIABLE_VALUE);
+      result.push({
+        var: name,
+        values: all
+          ? (variable.options ?? []).map((o: { value: string }) => o.value).filter((v: string) => v !== ALL_VARIABLE_VALUE)
+          : values,
+        all: all || undefined,
+      });
+    }
+    return result;
+  }
+
   /**
    * Filters queries to determine which should be executed
    * @param query - The query to filter
@@ -83,12 +161,22 @@ export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDat
    */
   filterQuery(query: NewRelicQuery): boolean {
     try {
+      // Incidents and variable queries fetch New Relic metadata and have no NRQL
+      if (query.queryType === QUERY_TYPE_INCIDENTS || query.queryType === QUERY_TYPE_VARIABLE) {
+        return true;
+      }
+
       // Check if query text exists and is not empty
       if (!query.queryText || query.queryText.trim().length === 0) {
         logger.debug('Query filtered out: empty query text', { refId: query.refId });
         return false;
       }
 
+      // Entities and nerdgraph queries are entity search and GraphQL queries, not NRQL
+      if (query.queryType === QUERY_TYPE_ENTITIES || query.queryType === QUERY_TYPE_NERDGRAPH) {
+        return true;
+      }
+
       // Validate the query
       const validation = validateNrqlQuery(query.queryText);
       if (!validation.isValid) {
@@ -129,6 +217,7 @@ export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDat
         return {
           status: 'error',
           message: response?.message || 'Connection test failed. Please check your configuration.',
+          details: response?.details,
         };
       }
     } catch (error) {
@@ -140,4 +229,124 @@ export class DataSource extends DataSourceWithBackend<NewRelicQuery, NewRelicDat
       };
     }
   }
+
+  /**
+   * Lists the event types reported by the account
+   * @param accountID - Optional account ID, defaults to the configured account
+   * @returns Promise resolving to the sorted event type names
+   */
+  async getEventTypes(accountID?: number): Promise<string[]> {
+    const response = await this.getResource('event-types', accountID ? { accountID } : undefined);
+    return response?.eventTypes ?? [];
+  }
+
+  /**
+   * Lists the attributes reported for an event type
+   * @param eventType - The event type, e.g. Transaction
+   * @param accountID - Optional account ID, defaults to the configured account
+   * @returns Promise resolving to the attributes sorted by name
+   */
+  async getAttributes(eventType: string, accountID?: number): Promise<Array<{ name: string; type?: string }>> {
+    const response = await this.getResource('attributes', accountID ? { eventType, accountID } : { eventType });
+    return response?.attributes ?? [];
+  }
+
+  /**
+   * Lists the accounts the configured API key can access
+   * @returns Promise resolving to the accounts sorted by name
+   */
+  async getAccounts(): Promise<Array<{ id: number; name: string }>> {
+    const response = await this.getResource('accounts');
+    return response?.accounts ?? [];
+  }
+
+  /**
+   * Lists the default account and the named accounts configured for the data source
+   * @returns Promise resolving to the configured accounts, default account first
+   */
+  async getConfiguredAccounts(): Promise<ConfiguredAccount[]> {
+    const response = await this.getResource('configured-accounts');
+    return response?.accounts ?? [];
+  }
+
+  /**
+   * Checks an NRQL query with a LIMIT 1 probe before the panel runs it
+   * @param queryText - The NRQL query to check
+   * @param accountID - Optional account ID, defaults to the configured account
+   * @returns Promise resolving to the errors, clauses and event types found in the query
+   */
+  async validateQuery(queryText: string, accountID?: number): Promise<QueryValidationResponse> {
+    const params: Record<string, string | number> = { query: queryText };
+    if (accountID) {
+      params.accountID = accountID;
+    }
+    return this.getResource('validate-query', params);
+  }
+
+  /**
+   * Lists the attribute names offered as ad-hoc filter keys, taken from the event
+   * type of the dashboard's first query
+   * @param options - The dashboard queries
+   * @returns Promise resolving to the attribute names
+   */
+  async getTagKeys(options?: DataSourceGetTagKeysOptions<NewRelicQuery>): Promise<MetricFindValue[]> {
+    const response = await this.getSuggestions(options?.queries?.[0]?.queryText ?? '');
+    return (response.attributes ?? []).map((attribute) => ({ text: attribute.name }));
+  }
+
+  /**
+   * Lists recent values of an attribute, offered as ad-hoc filter values
+   * @param options - The filter key and the dashboard queries
+   * @returns Promise resolving to the recent values
+   */
+  async getTagValues(options: DataSourceGetTagValuesOptions<NewRelicQuery>): Promise<MetricFindValue[]> {
+    const response = await this.getSuggestions(options.queries?.[0]?.queryText ?? '', options.key);
+    const attribute = response.attributes?.find((candidate) => candidate.name === options.key);
+    return (attribute?.values ?? []).map((value) => ({ text: value }));
+  }
+
+  /**
+   * Suggests event types, or attributes with recent values, for typeahead in the query editor
+   * @param queryText - The partial NRQL query; its FROM clause selects the event type
+   * @param prefix - Optional start of the word being typed
+   * @param accountID - Optional account ID, defaults to the configured account
+   * @returns Promise resolving to the matching event types or attributes
+   */
+  async getSuggestions(queryText: string, prefix?: string, accountID?: number): Promise<SuggestionsResponse> {
+    const params: Record<string, string | number> = { query: queryText };
+    if (prefix) {
+      params.prefix = prefix;
+    }
+    if (accountID) {
+      params.accountID = accountID;
+    }
+    return this.getResource('suggestions', params);
+  }
+
+  /**
+   * Finds entities by name for autocomplete in the query editor
+   * @param prefix - Part of the entity name
+   * @param type - Optional entity type, e.g. APPLICATION
+   * @param accountID - Optional account ID whose API key runs the search, defaults to the configured account
+   * @returns Promise resolving to the matching entities sorted by name
+   */
+  async getEntities(prefix: string, type?: string, accountID?: number): Promise<EntitySummary[]> {
+    const params: Record<string, string | number> = { prefix };
+    if (type) {
+      params.type = type;
+    }
+    if (accountID) {
+      params.accountID = accountID;
+    }
+    const response = await this.getResource('entities', params);
+    return response?.entities ?? [];
+  }
+
+  /**
+   * Gets the recent queries recorded by the audit log and their totals by dashboard
+   * @returns Promise resolving to the query statistics; rejects when audit logging is disabled
+   */
+  async getQueryStats(): Promise<QueryStats> {
+    return this.getResource('query-stats');
+  }
 }
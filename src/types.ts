@@ -6,10 +6,177 @@ import { DataQuery, DataSourceJsonData } from '@grafana/data';
 export interface NewRelicQuery extends DataQuery {
   /** The NRQL query string to execute */
   queryText: string;
+  /** Where the NRQL comes from: queryText (code, the default) or the structured builder query compiled by the backend */
+  editorMode?: 'code' | 'builder';
+  /** Structured query from the visual editor, compiled to NRQL by the backend in builder mode */
+  builder?: BuilderQuery;
   /** Optional account ID to override the default configured account */
   accountID?: number;
   /** Whether to use Grafana's time picker for automatic time range integration */
   useGrafanaTime?: boolean;
+  /** Executor path for the query: auto-detected (default), standard or multi-result */
+  resultMode?: 'auto' | 'standard' | 'multi';
+  /** Attach the backend routing decision trace to frame metadata */
+  explainRouting?: boolean;
+  /** Return result columns keyed exactly as New Relic returns them, without renaming */
+  rawFields?: boolean;
+  /** Rows per page for table queries; translated into LIMIT/OFFSET by the backend */
+  pageSize?: number;
+  /** Zero-based page to return when pageSize is set */
+  pageIndex?: number;
+  /** How facet values are returned: as field labels (default), as columns, or both */
+  facetAs?: 'labels' | 'column' | 'both';
+  /** Frame layout of faceted TIMESERIES results: a frame per facet (default) or one wide frame */
+  format?: 'multi' | 'wide';
+  /** Time of faceted counts without TIMESERIES: range end (default), range midpoint, no time field, or a single table */
+  facetTime?: 'end' | 'midpoint' | 'none' | 'table';
+  /** Series display name pattern with {{field}}, {{facet}} and {{label}} placeholders, e.g. "{{facet}} - {{field}}" */
+  alias?: string;
+  /** Value of TIMESERIES buckets without data, once all series share the same buckets: null (default), zero or the previous value */
+  fillMode?: 'null' | 'zero' | 'previous';
+  /** Display names of facet values in series labels, by raw value, e.g. { "MXxBUE18...": "checkout" } */
+  facetLabelMappings?: Record<string, string>;
+  /** Remove the leading text every value of a facet shares, e.g. the host of URLs, from series labels */
+  trimFacetPrefix?: boolean;
+  /** Show entity names instead of the entity GUIDs of facet values, looked up through NerdGraph */
+  resolveEntityNames?: boolean;
+  /** Add the name, type, account and tags of the entities of entity GUID columns, e.g. entityGuid, to tables */
+  enrichEntities?: boolean;
+  /** Order of faceted series: by facet value (name, the default) or by their first bucket's value, largest first */
+  facetOrder?: 'name' | 'value';
+  /** Group faceted rows without a facet value under "(unfaceted)" instead of dropping them */
+  keepUnfaceted?: boolean;
+  /** Do not apply the dashboard time range to queries that have no SINCE/UNTIL clause */
+  ignoreTimeRange?: boolean;
+  /** Dashboard time zone: an IANA name such as Europe/Berlin, 'utc' or 'browser' */
+  timeZone?: string;
+  /** Add WITH TIMEZONE for timeZone to the generated SINCE/UNTIL clause, so day buckets start at local midnight */
+  useTimeZone?: boolean;
+  /** Keep the query's TIMESERIES buckets even when a series has more points than the panel can draw */
+  ignoreMaxPoints?: boolean;
+  /** Append LIMIT MAX to queries without a LIMIT or TIMESERIES clause, so tables and variables get every value */
+  autoLimit?: boolean;
+  /** Levels of nested object and array attributes flattened into dotted columns, e.g. attributes.request.headers.host; 0 or unset keeps them as JSON text */
+  flattenDepth?: number;
+  /** Join uniques() values into one comma-separated cell instead of returning a row per value */
+  joinUniques?: boolean;
+  /** Also return time series as a table frame, so Explore can switch between graph and table without rerunning the query */
+  dualOutput?: boolean;
+  /** Keep the panel updated over Grafana Live by polling New Relic for new data */
+  live?: boolean;
+  /** How often live queries poll New Relic, e.g. "30s" (default 10s, at least 5s) */
+  liveInterval?: string;
+  /** Sequential queries the time range of a TIMESERIES query is split into, to chart long ranges past the bucket limit of one query */
+  splitRange?: number;
+  /** Width in standard deviations of anomaly bands drawn around a rolling baseline of each series; 0 or unset draws none */
+  anomalyBands?: number;
+  /** Points the rolling baseline of anomaly bands averages (defaults to 12) */
+  baselineWindow?: number;
+  /** Series to keep before truncating, overriding the datasource limit */
+  maxSeries?: number;
+  /** Rows to keep per frame before truncating, overriding the datasource limit */
+  maxFrameRows?: number;
+  /** Give up on the query after this long (e.g. "30s"), overriding the datasource query timeout */
+  timeout?: string;
+  /** Table columns to show first, in this order; the remaining columns follow alphabetically */
+  columns?: string[];
+  /** Ad-hoc filters added to the query's WHERE clause by the backend */
+  filters?: Array<{ key: string; operator: string; value: string; values?: string[] }>;
+  /** Multi-value template variables left in the query text for the backend to quote */
+  variables?: TemplateVariable[];
+  /** Issue states returned by incidents queries; all states when empty */
+  incidentStates?: Array<'CREATED' | 'ACTIVATED' | 'DEACTIVATED' | 'CLOSED'>;
+  /** What a variable query lists */
+  variableType?: 'accounts' | 'eventTypes' | 'attributeKeys' | 'attributeValues';
+  /** Event type of attributeKeys and attributeValues variable queries */
+  eventType?: string;
+  /** Attribute of attributeValues variable queries */
+  attribute?: string;
+  /** Path of the response nodes nerdgraph queries return as rows, e.g. actor.account.nrql.results */
+  selector?: string;
+  /** Variables of nerdgraph queries; $accountId defaults to the query account */
+  graphqlVariables?: Record<string, unknown>;
+  /** What a usage query charts: GB ingested over time, this month's GB ingested or billable users, or this month's estimated cost */
+  usageMetric?: 'ingest' | 'ingestMonthToDate' | 'users' | 'cost';
+  /** NRQL statements run concurrently instead of queryText, e.g. throughput and error rate from two event types in one panel */
+  statements?: QueryStatement[];
+  /** Fields derived from the query's result fields, e.g. { name: 'error %', expr: '($A.errors / $A.total) * 100' } */
+  expressions?: FieldExpression[];
+}
+
+/**
+ * Field derived by a math expression over the fields of a query's results.
+ * Fields are referenced as $<refId>.<field>, quoting names with spaces in backticks.
+ */
+export interface FieldExpression {
+  name: string;
+  expr: string;
+}
+
+/**
+ * NRQL statement of a query with several statements
+ */
+export interface QueryStatement {
+  /** Value of the statement label of the statement's series; unique in the query */
+  alias: string;
+  queryText: string;
+  /** Y axis of the statement's series; unset leaves the placement to the panel */
+  axis?: 'left' | 'right';
+}
+
+/**
+ * Structured query compiled to NRQL by the backend
+ */
+export interface BuilderQuery {
+  /** Aggregations to select, at least one */
+  select: BuilderSelect[];
+  /** Event type queried, e.g. Transaction */
+  eventType: string;
+  /** Conditions joined with AND, using the ad-hoc filter operators */
+  where?: Array<{ key: string; operator: string; value: string; values?: string[] }>;
+  /** Attributes to facet by */
+  facet?: string[];
+  /** Start as epoch milliseconds or "<n> <unit> ago"; unset uses the dashboard time range */
+  since?: string;
+  /** End as epoch milliseconds or "<n> <unit> ago" */
+  until?: string;
+  /** LIMIT of the query; unset omits it */
+  limit?: number;
+  /** TIMESERIES bucket, e.g. "5 minutes", AUTO or MAX; unset omits it */
+  timeseries?: string;
+}
+
+/**
+ * Aggregation of a builder query
+ */
+export interface BuilderSelect {
+  /** Aggregation function, e.g. count, average or percentile */
+  function: string;
+  /** Attribute aggregated; count without one counts events */
+  attribute?: string;
+  /** Numeric arguments after the attribute, e.g. percentiles */
+  args?: string[];
+  /** Name of the result */
+  alias?: string;
+}
+
+/**
+ * Response of the compile-only resource
+ */
+export interface CompileQueryResponse {
+  /** NRQL compiled from the builder query */
+  query?: string;
+  error?: string;
+}
+
+/**
+ * Multi-value template variable rendered by the backend as a quoted NRQL list,
+ * or whose conditions are dropped when All is selected
+ */
+export interface TemplateVariable {
+  var: string;
+  values: string[];
+  all?: boolean;
 }
 
 /**
@@ -18,12 +185,74 @@ export interface NewRelicQuery extends DataQuery {
 export interface NewRelicDataSourceOptions extends DataSourceJsonData {
   /** New Relic API key (stored securely) */
   apiKey?: string;
-  /** New Relic account ID */
-  accountId?: number;
-  /** New Relic region (US or EU) */
-  region?: 'US' | 'EU';
+  /** New Relic account ID; may be templated as a string by provisioning tools */
+  accountID?: number | string;
+  /** Environment variable holding the API key when no apiKey secure setting is stored (e.g. for provisioned datasources); its name must start with NEWRELIC_ */
+  apiKeyEnv?: string;
+  /** New Relic region (US, EU, Staging or FedRAMP) */
+  region?: 'US' | 'EU' | 'Staging' | 'FedRAMP';
   /** Custom API endpoint URL (optional) */
   apiUrl?: string;
+  /** Reject queries whose JSON contains unknown fields instead of ignoring them */
+  strictQueryParsing?: boolean;
+  /** Queries run on a schedule to pre-populate the result cache */
+  warmup?: {
+    /** timeRange is the relative range of the dashboards showing the query (default "6h") */
+    queries: Array<{ name?: string; queryText: string; accountID?: number; timeRange?: string }>;
+    interval?: string;
+    dailyAt?: string[];
+    timeZone?: string;
+    ttl?: string;
+    runOnStart?: boolean;
+  };
+  /** Periods (RFC 3339 start/end) during which queries are served from cache only */
+  blackoutWindows?: Array<{ start: string; end: string; reason?: string }>;
+  /** Per-account New Relic API call budget over a rolling window (default "1m") */
+  queryBudget?: { window?: string; softLimit?: number; hardLimit?: number };
+  /** Cache query results for a TTL (e.g. "30s"); time ranges within one timeBucket (default the TTL) share an entry */
+  queryCache?: { ttl: string; timeBucket?: string };
+  /** Run the candidate formatter next to the served one and log any differences */
+  verifyFormatter?: boolean;
+  /** Fetch event queries without a LIMIT page by page up to this many rows */
+  maxRows?: number;
+  /** Series a query may return before the rest are truncated with a notice; defaults to 1000 */
+  maxSeries?: number;
+  /** Rows each frame may hold before the rest are truncated with a notice; unset means no limit */
+  maxFrameRows?: number;
+  /** Estimated size in bytes a query response may reach before it is downsampled or truncated with a notice; defaults to 64 MiB */
+  maxResponseBytes?: number;
+  /** How time series over the response budget are downsampled: 'lttb' (default) or 'nth' */
+  payloadDownsample?: 'lttb' | 'nth';
+  /** What happens to queries that match an NRQL guardrail, e.g. SELECT * without LIMIT: 'off', 'warn' (default) or 'block' */
+  queryLint?: 'off' | 'warn' | 'block';
+  /** Event retention of the account in days, to flag SINCE clauses reaching beyond it; unset disables the check */
+  retentionDays?: number;
+  /** Default time each query may run before it is abandoned (e.g. "30s"); empty means no limit */
+  queryTimeout?: string;
+  /** Grafana units by result field name (e.g. average.duration) or attribute name, replacing inferred units */
+  unitOverrides?: Record<string, string>;
+  /** Types forced on result fields whose name or attribute matches a glob pattern (e.g. orderId), in place of inferred types */
+  fieldTypes?: Array<{ pattern: string; type: 'number' | 'string' | 'timestamp' | 'boolean' }>;
+  /** NRQL run by the health check, or an event type counted instead of Transaction (e.g. Log or Metric) */
+  healthCheck?: { query?: string; eventType?: string };
+  /** HTTP, HTTPS or SOCKS5 proxy for New Relic API requests; empty uses HTTP_PROXY/HTTPS_PROXY */
+  proxyUrl?: string;
+  /** Skip TLS certificate verification */
+  tlsSkipVerify?: boolean;
+  /** Present the TLS client certificate (tlsClientCert/tlsClientKey) */
+  tlsAuth?: boolean;
+  /** Trust the CA certificate tlsCACert, e.g. of a TLS-intercepting proxy */
+  tlsAuthWithCACert?: boolean;
+  /** Server name used to verify the TLS certificate */
+  serverName?: string;
+  /** Route requests through Grafana's secure socks proxy */
+  enableSecureSocksProxy?: boolean;
+  /** Log every executed NRQL query and keep the most recent bufferSize (default 200) for the query-stats resource */
+  auditLog?: { enabled: boolean; bufferSize?: number };
+  /** Tracing spans recorded by the backend: off, basic (default) or detailed (adds formatting steps and NRQL text) */
+  traceVerbosity?: 'off' | 'basic' | 'detailed';
+  /** Prices of the cost estimates of usage queries: per billable GB (default 0.40), per billable full platform or core user, in an ISO 4217 currency (default USD) */
+  usagePricing?: { perGB?: number; perFullPlatformUser?: number; perCoreUser?: number; currency?: string };
 }
 
 /**
@@ -51,16 +280,83 @@ export interface DataSourceResponse {
 export interface NewRelicSecureJsonData {
   /** New Relic API key */
   apiKey?: string;
-  /** New Relic account ID */
+  /** Optional second API key, used when New Relic rejects apiKey so keys can be rotated without downtime */
+  secondaryApiKey?: string;
+  /** Legacy location of the account ID, read only when jsonData.accountID is empty */
   accountID?: string;
+  /** JSON list of additional named accounts: [{ name, accountID, apiKey? }] */
+  accounts?: string;
+  /** PEM CA certificate, used with tlsAuthWithCACert */
+  tlsCACert?: string;
+  /** PEM client certificate and key, used with tlsAuth */
+  tlsClientCert?: string;
+  tlsClientKey?: string;
+}
+
+/**
+ * Account listed by the configured-accounts resource
+ */
+export interface ConfiguredAccount {
+  name: string;
+  accountID: number;
+  /** Set for the datasource's default account */
+  default?: boolean;
 }
 
+/**
+ * Query type that returns raw Log events as log lines for the Logs panel.
+ * Queries reading only from Log event types are detected automatically.
+ */
+export const QUERY_TYPE_LOGS = 'logs';
+
+/**
+ * Query type that returns Span events as a trace for the Traces panel, or
+ * DistributedTraceSummary events as a list of traces.
+ * Queries reading only from those event types are detected automatically.
+ */
+export const QUERY_TYPE_TRACES = 'traces';
+
+/**
+ * Query type that fetches New Relic issues instead of running NRQL, returned as
+ * a table of issues and as annotations spanning each issue.
+ */
+export const QUERY_TYPE_INCIDENTS = 'incidents';
+
+/**
+ * Query type that runs the query text as a New Relic entity search instead of
+ * NRQL, e.g. "type = 'APPLICATION' AND name LIKE 'checkout'", returned as a
+ * table of entities.
+ */
+export const QUERY_TYPE_ENTITIES = 'entities';
+
+/**
+ * Query type that lists template variable values instead of running NRQL:
+ * account IDs, event types, attribute names or attribute values, selected by
+ * variableType and returned as a single string column.
+ */
+export const QUERY_TYPE_VARIABLE = 'variable';
+
+/**
+ * Query type that runs the query text as a read-only NerdGraph GraphQL query and
+ * returns the response nodes picked by the selector as a table.
+ */
+export const QUERY_TYPE_NERDGRAPH = 'nerdgraph';
+
+/**
+ * Query type that runs a prebuilt NRQL query of the account's consumption from
+ * NrConsumption and NrMTDConsumption, selected by usageMetric, with GB and
+ * currency units set on the results.
+ */
+export const QUERY_TYPE_USAGE = 'usage';
+
 /**
  * Available New Relic regions
  */
 export const NEW_RELIC_REGIONS = {
   US: 'US',
   EU: 'EU',
+  Staging: 'Staging',
+  FedRAMP: 'FedRAMP',
 } as const;
 
 /**
@@ -69,6 +365,8 @@ export const NEW_RELIC_REGIONS = {
 export const NEW_RELIC_API_ENDPOINTS = {
   US: 'https://api.newrelic.com/graphql',
   EU: 'https://api.eu.newrelic.com/graphql',
+  Staging: 'https://staging-api.newrelic.com/graphql',
+  FedRAMP: 'https://gov-api.newrelic.com/graphql',
 } as const;
 
 /**
@@ -114,6 +412,128 @@ export interface ValidationResult {
   message?: string;
 }
 
+/**
+ * NRQL feature of a query that the formatter does not fully handle
+ */
+export interface UnsupportedFeature {
+  /** nestedAggregation, join or subquery */
+  feature: string;
+  /** How the query's frames are degraded by the feature */
+  message: string;
+}
+
+/**
+ * Response of the validate-query resource
+ */
+export interface QueryValidationResponse {
+  valid: boolean;
+  /** Syntax and parse errors found in the query */
+  errors?: string[];
+  /** Event types named in the FROM clause */
+  eventTypes?: string[];
+  facet: boolean;
+  timeseries: boolean;
+  compare: boolean;
+  /** NRQL features of the query the formatter does not fully handle */
+  unsupported?: UnsupportedFeature[];
+  /** Query sent to New Relic to check the query */
+  probe?: string;
+  /** Time New Relic took to answer the probe */
+  durationMs?: number;
+}
+
+/**
+ * Response of the suggestions resource used for query editor typeahead
+ */
+export interface SuggestionsResponse {
+  /** Event type the attributes belong to, when one was given or found in the query */
+  eventType?: string;
+  /** Event types matching the prefix, when no event type was given */
+  eventTypes?: string[];
+  /** Attributes matching the prefix with values seen in recent events */
+  attributes?: Array<{ name: string; type?: string; values?: string[] }>;
+}
+
+/**
+ * Response of the metrics-metadata resource, which documents the attributes of
+ * the event types given as eventType parameters (repeated or comma-separated)
+ */
+export interface MetricsMetadataResponse {
+  eventTypes: Array<{
+    eventType: string;
+    description?: string;
+    attributes: Array<{
+      name: string;
+      /** string, numeric or boolean */
+      type?: string;
+      description?: string;
+      /** Grafana unit, e.g. "s" or "bytes" */
+      unit?: string;
+    }>;
+  }>;
+}
+
+/**
+ * Response of the diagnostics resource, which probes the ingest freshness of
+ * each kind of telemetry in the default and named accounts
+ */
+export interface DiagnosticsResponse {
+  /** Event types probed, e.g. Transaction, Log, Metric and SystemSample */
+  eventTypes: string[];
+  accounts: Array<{
+    name: string;
+    accountID: number;
+    /** e.g. "3 of 4 telemetry types fresh" */
+    summary: string;
+    probes?: Array<{
+      eventType: string;
+      status: 'fresh' | 'stale' | 'noData' | 'failed';
+      /** RFC 3339 time of the latest event */
+      latestEvent?: string;
+      /** Age of the latest event, e.g. "3 minutes" */
+      age?: string;
+      message?: string;
+    }>;
+    /** Why the account could not be probed */
+    error?: string;
+  }>;
+}
+
+/**
+ * Response of the time-window resource, which resolves the since and until
+ * parameters (a query's SINCE and UNTIL expressions) to the window they scan
+ */
+export interface TimeWindowResponse {
+  /** SINCE expression, normalized, e.g. "3 hours ago" */
+  since: string;
+  /** UNTIL expression, normalized; "now" when none was given */
+  until: string;
+  /** Start and end of the window, as RFC 3339 times */
+  from: string;
+  to: string;
+  /** Length of the window, e.g. "1 day" */
+  duration: string;
+  /** Equivalent SINCE/UNTIL clause in epoch milliseconds */
+  clause: string;
+  /** Time zone calendar phrases such as "yesterday" were resolved in */
+  timeZone: string;
+}
+
+/**
+ * Entity returned by the entities resource
+ */
+export interface EntitySummary {
+  name: string;
+  guid: string;
+  type: string;
+  domain: string;
+  accountId: number;
+  /** Whether the entity is reporting data; absent for entity types without a reporting status */
+  reporting?: boolean;
+  alertSeverity?: string;
+  tags?: Record<string, string[]>;
+}
+
 /**
  * Query builder component state
  */
@@ -128,3 +548,47 @@ export interface QueryBuilderState {
   timeseries: boolean;
   limit: number;
 }
+
+/**
+ * A NRQL query recorded by the audit log
+ */
+export interface AuditEntry {
+  time: string;
+  query: string;
+  accountId: number;
+  datasourceUid: string;
+  dashboardUid?: string;
+  panelId?: string;
+  durationMs: number;
+  rows: number;
+  /** Error kind of a failed query, e.g. timeout or rateLimit */
+  errorCategory?: string;
+}
+
+/**
+ * Recent audited queries and their totals by dashboard, from the query-stats resource
+ */
+export interface QueryStats {
+  queries: AuditEntry[];
+  dashboards: Array<{
+    dashboardUid: string;
+    queries: number;
+    errors: number;
+    rows: number;
+    totalDurationMs: number;
+    maxDurationMs: number;
+  }>;
+}
+
+/**
+ * JSON details of a health check failing on invalid settings, naming each
+ * invalid setting so the config editor can highlight it
+ */
+export interface SettingsErrorDetails {
+  errors: Array<{
+    /** JSON path of the setting, e.g. "apiKey", "region" or "accounts[1].accountID" */
+    field?: string;
+    code?: 'required' | 'invalid' | 'outOfRange' | 'duplicate';
+    message: string;
+  }>;
+}